@@ -29,6 +29,9 @@ ORCA instances, users, and configurations.`,
 	rootCmd.AddCommand(cli.NewLogoutCmd())
 	rootCmd.AddCommand(cli.NewStatusCmd())
 	rootCmd.AddCommand(cli.NewUserCmd())
+	rootCmd.AddCommand(cli.NewServiceAccountCmd())
+	rootCmd.AddCommand(cli.NewTokenCmd())
+	rootCmd.AddCommand(cli.NewAuditCmd())
 	rootCmd.AddCommand(cli.NewConfigCmd())
 
 	if err := rootCmd.Execute(); err != nil {
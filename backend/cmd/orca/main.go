@@ -17,6 +17,7 @@ import (
 	"github.com/orca-ng/orca/internal/database"
 	"github.com/orca-ng/orca/internal/handlers"
 	"github.com/orca-ng/orca/internal/middleware"
+	gormmodels "github.com/orca-ng/orca/internal/models/gorm"
 	"github.com/orca-ng/orca/internal/pipeline"
 	pipelinehandlers "github.com/orca-ng/orca/internal/pipeline/handlers"
 	"github.com/orca-ng/orca/internal/services"
@@ -92,15 +93,21 @@ func main() {
 
 	// Create router
 	router := gin.New()
+	// Client IPs throttle logins and are audited, so forwarding headers are
+	// only believed from configured proxies
+	if err := router.SetTrustedProxies(cfg.Server.TrustedProxies); err != nil {
+		logrus.WithError(err).Fatal("Invalid trusted proxies")
+	}
 	router.Use(gin.Recovery())
 	router.Use(gin.Logger())
+	router.Use(middleware.RequestID())
 
 	// Configure CORS
 	router.Use(cors.New(cors.Config{
 		AllowOrigins:     []string{"http://localhost:5173", "http://localhost:3000"},
 		AllowMethods:     []string{"GET", "POST", "PUT", "PATCH", "DELETE", "OPTIONS"},
-		AllowHeaders:     []string{"Origin", "Content-Type", "Authorization"},
-		ExposeHeaders:    []string{"Content-Length"},
+		AllowHeaders:     []string{"Origin", "Content-Type", "Authorization", middleware.RequestIDHeader},
+		ExposeHeaders:    []string{"Content-Length", middleware.RequestIDHeader},
 		AllowCredentials: true,
 		MaxAge:          12 * time.Hour,
 	}))
@@ -114,6 +121,57 @@ func main() {
 
 	// Initialize handlers
 	authHandler := handlers.NewAuthHandler(db, sessionTimeout)
+	if !cfg.Auth.LocalLoginEnabled {
+		authHandler.RestrictLocalLogin(cfg.Auth.BreakGlassUsers)
+		logrus.WithField("break_glass_users", cfg.Auth.BreakGlassUsers).Info("Local login restricted to break-glass accounts")
+	}
+	auditService := services.NewAuditService(db, logrus.StandardLogger())
+	authHandler.EnableAudit(auditService)
+
+	// Audit events are forwarded to the SIEM until the server has stopped
+	// taking requests, so that events of the last requests are not lost
+	auditSinks, err := services.NewAuditSinks(cfg.Audit)
+	if err != nil {
+		logrus.WithError(err).Fatal("Failed to set up audit forwarding")
+	}
+	forwardCtx, stopForwarding := context.WithCancel(context.Background())
+	var auditForwarder *services.AuditForwarder
+	if len(auditSinks) > 0 {
+		auditForwarder = services.NewAuditForwarder(auditSinks, cfg.Audit.BufferSize,
+			time.Duration(cfg.Audit.RetrySeconds)*time.Second, logrus.StandardLogger())
+		auditForwarder.Start(forwardCtx)
+		auditService.EnableForwarding(auditForwarder)
+	}
+	
+	// Failed logins are counted in the database, so that the limits hold
+	// across replicas
+	var loginLimiter *services.LoginLimiter
+	if cfg.Auth.Lockout.Enabled {
+		loginLimiter = services.NewLoginLimiter(db, cfg.Auth.Lockout, logrus.StandardLogger())
+		authHandler.EnableLoginLimits(loginLimiter)
+	}
+
+	// Rules for new passwords of local users, whose hashes are upgraded to
+	// the current Argon2 parameters as they log in
+	passwordPolicy, err := services.NewPasswordPolicy(db, cfg.Auth.PasswordPolicy, logrus.StandardLogger())
+	if err != nil {
+		logrus.WithError(err).Fatal("Failed to load password policy")
+	}
+	authHandler.EnablePasswordRehash(passwordPolicy)
+	provisioner := services.NewIdentityProvisioner(db, logrus.StandardLogger())
+	var oidcHandler *handlers.OIDCHandler
+	if cfg.Auth.OIDC.Enabled {
+		authHandler.EnableOIDC()
+		oidcHandler = handlers.NewOIDCHandler(
+			authHandler,
+			services.NewOIDCProvider(cfg.Auth.OIDC),
+			provisioner,
+			crypto.NewEncryptor(cfg.Session.Secret),
+			logrus.StandardLogger(),
+			cfg.Auth.OIDC.PostLoginRedirect,
+		)
+		logrus.WithField("issuer", cfg.Auth.OIDC.IssuerURL).Info("OIDC single sign-on enabled")
+	}
 	
 	// Get encryption key
 	encryptionKey := os.Getenv("ENCRYPTION_KEY")
@@ -125,26 +183,59 @@ func main() {
 		encryptionKey = "development-key-do-not-use-in-prod-32bytes!!"
 	}
 	
+	// TOTP second factor for password logins, secrets encrypted like other
+	// credentials
+	mfaService := services.NewMFAService(db, crypto.NewEncryptor(encryptionKey), cfg.Auth.MFA, logrus.StandardLogger())
+	authHandler.EnableMFA(mfaService)
+	if cfg.Auth.MFA.Required {
+		logrus.Info("MFA required for all password logins")
+	}
+	
 	// Initialize certificate manager
 	certManager := services.NewCertificateManager(db, logrus.StandardLogger())
 	
+	// Directory login trusts the CAs managed in ORCA
+	if cfg.Auth.LDAP.Enabled {
+		authHandler.EnableLDAP(services.NewLDAPAuthenticator(cfg.Auth.LDAP, certManager, logrus.StandardLogger()), provisioner)
+		logrus.WithField("url", cfg.Auth.LDAP.URL).Info("LDAP authentication enabled")
+	}
+	
+	// Elect one replica to run background tasks that must not run twice
+	replicaID := services.NewReplicaID()
+	leaderElector := services.NewLeaderElector(db, logrus.StandardLogger(), "orca-background", replicaID,
+		time.Duration(cfg.Cluster.LeaderLeaseTTL)*time.Second)
+	go leaderElector.Run(ctx)
+	
 	// Initialize operation event service
 	eventService := services.NewOperationEventService(logrus.StandardLogger())
+	if cfg.Cluster.Enabled {
+		eventService.EnableFanOut(ctx, db, services.NewEventBroker(db, logrus.StandardLogger()), replicaID)
+	}
+	if auditForwarder != nil {
+		eventService.EnableAuditForwarding(auditForwarder)
+	}
 	
 	// Initialize sync job service
 	syncJobService := services.NewSyncJobService(db, logrus.StandardLogger(), eventService)
 	
 	// Initialize pipeline processor
-	pipelineConfig := &pipeline.PipelineConfig{
-		TotalCapacity:      1, // Process one operation at a time
-		DefaultTimeout:     300, // 5 minutes default
-		OperationTimeouts:  make(map[pipeline.OperationType]int),
-		RetryPolicy: pipeline.RetryPolicy{
-			MaxAttempts: 3,
-		},
+	pipelineStore := pipeline.NewStore(db)
+	if err := pipelineStore.SeedPipelineConfig(ctx); err != nil {
+		logrus.WithError(err).Fatal("Failed to seed pipeline config")
+	}
+	
+	pipelineConfig, err := pipelineStore.GetPipelineConfig(ctx)
+	if err == nil {
+		err = pipelineConfig.Validate()
+	}
+	if err != nil {
+		logrus.WithError(err).Error("Stored pipeline config is unusable, starting with defaults")
+		pipelineConfig = pipeline.DefaultPipelineConfig()
 	}
 	
-	processor := pipeline.NewSimpleProcessor(db, pipelineConfig, logrus.StandardLogger(), certManager, encryptionKey, eventService)
+	processor := pipeline.NewProcessor(db, pipelineConfig, logrus.StandardLogger(), certManager, encryptionKey, eventService)
+	processor.WatchConfig(pipelineStore)
+	processor.SetLeaderElector(leaderElector)
 	
 	// Register operation handlers
 	userSyncHandler := pipelinehandlers.NewUserSyncHandler(db, logrus.StandardLogger(), certManager, crypto.NewEncryptor(encryptionKey))
@@ -160,12 +251,29 @@ func main() {
 		logrus.WithError(err).Fatal("Failed to start pipeline processor")
 	}
 	
-	cyberarkHandler := handlers.NewCyberArkInstancesHandler(db, logrus.StandardLogger(), encryptionKey, certManager)
+	// Watch stored CAs and PVWA certificates for upcoming expiry
+	expiryMonitor := services.NewCertificateExpiryMonitor(db, logrus.StandardLogger(), eventService, cfg.Certificates.ExpiryWarningDays)
+	go expiryMonitor.Run(ctx, time.Duration(cfg.Certificates.ExpiryCheckInterval)*time.Minute, leaderElector)
+	
+	cyberarkHandler := handlers.NewCyberArkInstancesHandler(db, logrus.StandardLogger(), encryptionKey, certManager, processor.Guards())
 	certAuthHandler := handlers.NewCertificateAuthoritiesHandler(db, logrus.StandardLogger(), certManager)
+	certExpiryHandler := handlers.NewCertificateExpiryHandler(db, logrus.StandardLogger(), expiryMonitor)
 	operationsHandler := handlers.NewOperationsHandler(db, logrus.StandardLogger(), eventService)
 	syncSchedulesHandler := handlers.NewSyncSchedulesHandler(db, logrus.StandardLogger(), eventService)
 	syncJobsHandler := handlers.NewSyncJobsHandler(db, logrus.StandardLogger(), syncJobService, eventService)
 	activityHandler := handlers.NewActivityHandler(db, logrus.StandardLogger(), eventService)
+	pipelineConfigHandler := handlers.NewPipelineConfigHandler(db, logrus.StandardLogger(), processor)
+	rolesHandler := handlers.NewRolesHandler(db, logrus.StandardLogger())
+	serviceAccountsHandler := handlers.NewServiceAccountsHandler(db, logrus.StandardLogger())
+	mfaHandler := handlers.NewMFAHandler(db, mfaService, logrus.StandardLogger())
+	lockoutHandler := handlers.NewLockoutHandler(loginLimiter, auditService, logrus.StandardLogger())
+	usersHandler := handlers.NewUsersHandler(db, passwordPolicy, logrus.StandardLogger())
+	authzService := services.NewAuthorizationService(db)
+	auditHandler := handlers.NewAuditHandler(auditService, logrus.StandardLogger())
+	// audited records an audit event once an administrative request succeeded
+	audited := func(action string) gin.HandlerFunc {
+		return middleware.Audit(auditService, action)
+	}
 
 	// API routes
 	api := router.Group("/api")
@@ -173,11 +281,18 @@ func main() {
 		// Auth routes
 		api.POST("/auth/login", authHandler.Login)
 		api.POST("/auth/login/cli", authHandler.LoginCLI) // CLI login endpoint that returns token
+		api.POST("/auth/login/mfa", authHandler.LoginMFA)               // second step of a login with MFA
+		api.POST("/auth/login/mfa/enroll", authHandler.LoginMFAEnroll) // enrolment a login requires
 		api.POST("/auth/logout", authHandler.Logout)
+		api.GET("/auth/providers", authHandler.Providers)
+		if oidcHandler != nil {
+			api.GET("/auth/oidc/login", oidcHandler.Login)
+			api.GET("/auth/oidc/callback", oidcHandler.Callback)
+		}
 		
 		// Protected routes
 		protected := api.Group("/")
-		protected.Use(middleware.AuthRequired(authHandler))
+		protected.Use(middleware.AuthRequired(authHandler), middleware.LoadPermissions(authzService))
 		{
 			// Session check endpoint
 			protected.GET("/auth/check", func(c *gin.Context) {
@@ -194,62 +309,144 @@ func main() {
 				c.JSON(http.StatusOK, user)
 			})
 			
-			// Operations routes
-			protected.GET("/operations", operationsHandler.ListOperations)
-			protected.GET("/operations/:id", operationsHandler.GetOperation)
-			protected.POST("/operations", operationsHandler.CreateOperation)
-			protected.POST("/operations/:id/cancel", operationsHandler.CancelOperation)
-			protected.PATCH("/operations/:id/priority", operationsHandler.UpdatePriority)
-			protected.GET("/operations/stream", operationsHandler.StreamOperations)
+			// Permissions of the current user
+			protected.GET("/auth/permissions", rolesHandler.MyPermissions)
+			
+			// Second factor of the current user
+			protected.GET("/auth/mfa", mfaHandler.Status)
+			protected.POST("/auth/mfa/enroll", mfaHandler.Enroll)
+			protected.POST("/auth/mfa/confirm", audited(gormmodels.AuditMFAEnabled), mfaHandler.Confirm)
+			protected.POST("/auth/mfa/recovery-codes", audited(gormmodels.AuditMFARecoveryCodesRegenerated), mfaHandler.RegenerateRecoveryCodes)
+			protected.DELETE("/auth/mfa", audited(gormmodels.AuditMFADisabled), mfaHandler.Disable)
+			protected.GET("/auth/sessions", usersHandler.ListMySessions)
+			protected.DELETE("/auth/sessions/:id", audited(gormmodels.AuditSessionRevoked), usersHandler.RevokeMySession)
+			
+			// Operations routes. Handlers check the operation's instance and,
+			// for creation, its type.
+			protected.GET("/operations", middleware.RequirePermissionAnywhere(gormmodels.PermOperationsRead), operationsHandler.ListOperations)
+			protected.GET("/operations/:id", middleware.RequirePermissionAnywhere(gormmodels.PermOperationsRead), operationsHandler.GetOperation)
+			protected.POST("/operations", middleware.RequirePermissionAnywhere(gormmodels.PermOperationsCreate+":*"), audited(gormmodels.AuditOperationCreated), operationsHandler.CreateOperation)
+			protected.POST("/operations/:id/cancel", middleware.RequirePermissionAnywhere(gormmodels.PermOperationsCancel), audited(gormmodels.AuditOperationCancelled), operationsHandler.CancelOperation)
+			protected.PATCH("/operations/:id/priority", middleware.RequirePermissionAnywhere(gormmodels.PermOperationsApprove), audited(gormmodels.AuditOperationPriorityChanged), operationsHandler.UpdatePriority)
+			protected.GET("/operations/stream", middleware.RequirePermissionAnywhere(gormmodels.PermOperationsRead), operationsHandler.StreamOperations)
 			
 			// CyberArk instances routes
-			protected.GET("/cyberark/instances", cyberarkHandler.ListInstances)
-			protected.GET("/cyberark/instances/:id", cyberarkHandler.GetInstance)
-			protected.POST("/cyberark/instances", cyberarkHandler.CreateInstance)
-			protected.PUT("/cyberark/instances/:id", cyberarkHandler.UpdateInstance)
-			protected.DELETE("/cyberark/instances/:id", cyberarkHandler.DeleteInstance)
-			protected.POST("/cyberark/test-connection", cyberarkHandler.TestConnection)
-			protected.POST("/cyberark/instances/:id/test", cyberarkHandler.TestInstanceConnection)
+			protected.GET("/cyberark/instances", middleware.RequirePermissionAnywhere(gormmodels.PermInstancesRead), cyberarkHandler.ListInstances)
+			protected.GET("/cyberark/instances/:id", middleware.RequireInstancePermission(gormmodels.PermInstancesRead, "id"), cyberarkHandler.GetInstance)
+			protected.POST("/cyberark/instances", middleware.RequirePermission(gormmodels.PermInstancesWrite), audited(gormmodels.AuditInstanceCreated), cyberarkHandler.CreateInstance)
+			protected.PUT("/cyberark/instances/:id", middleware.RequireInstancePermission(gormmodels.PermInstancesWrite, "id"), audited(gormmodels.AuditInstanceUpdated), cyberarkHandler.UpdateInstance)
+			protected.DELETE("/cyberark/instances/:id", middleware.RequireInstancePermission(gormmodels.PermInstancesWrite, "id"), audited(gormmodels.AuditInstanceDeleted), cyberarkHandler.DeleteInstance)
+			protected.POST("/cyberark/test-connection", middleware.RequirePermissionAnywhere(gormmodels.PermInstancesWrite), cyberarkHandler.TestConnection)
+			protected.POST("/cyberark/instances/:id/test", middleware.RequireInstancePermission(gormmodels.PermInstancesWrite, "id"), cyberarkHandler.TestInstanceConnection)
 			
-			// Certificate Authorities routes
-			protected.GET("/certificate-authorities", certAuthHandler.List)
-			protected.GET("/certificate-authorities/:id", certAuthHandler.Get)
-			protected.POST("/certificate-authorities", certAuthHandler.Create)
-			protected.PUT("/certificate-authorities/:id", certAuthHandler.Update)
-			protected.DELETE("/certificate-authorities/:id", certAuthHandler.Delete)
-			protected.POST("/certificate-authorities/refresh", certAuthHandler.RefreshPool)
+			// Certificate Authority routes
+			protected.GET("/certificate-authorities", middleware.RequirePermissionAnywhere(gormmodels.PermCertificatesRead), certAuthHandler.List)
+			protected.GET("/certificate-authorities/:id", middleware.RequirePermissionAnywhere(gormmodels.PermCertificatesRead), certAuthHandler.Get)
+			protected.POST("/certificate-authorities", middleware.RequirePermission(gormmodels.PermCertificatesManage), audited(gormmodels.AuditCACreated), certAuthHandler.Create)
+			protected.PUT("/certificate-authorities/:id", middleware.RequirePermission(gormmodels.PermCertificatesManage), audited(gormmodels.AuditCAUpdated), certAuthHandler.Update)
+			protected.DELETE("/certificate-authorities/:id", middleware.RequirePermission(gormmodels.PermCertificatesManage), audited(gormmodels.AuditCADeleted), certAuthHandler.Delete)
+			protected.POST("/certificate-authorities/refresh", middleware.RequirePermission(gormmodels.PermCertificatesManage), audited(gormmodels.AuditCAPoolRefreshed), certAuthHandler.RefreshPool)
+			protected.POST("/certificate-authorities/fetch-chain", middleware.RequirePermission(gormmodels.PermCertificatesManage), audited(gormmodels.AuditCAChainFetched), certAuthHandler.FetchChain)
 			
-			// Global sync management routes (deprecated but kept for compatibility)
-			protected.GET("/sync/schedules", syncSchedulesHandler.GetSchedules)
-			protected.POST("/sync/schedules/pause-all", syncSchedulesHandler.PauseAll)
-			protected.POST("/sync/schedules/resume-all", syncSchedulesHandler.ResumeAll)
+			// Certificate expiry monitoring
+			protected.GET("/certificates/expiry", middleware.RequirePermissionAnywhere(gormmodels.PermCertificatesRead), certExpiryHandler.List)
+			protected.POST("/certificates/expiry/check", middleware.RequirePermission(gormmodels.PermCertificatesManage), certExpiryHandler.Check)
 			
-			// Instance-specific sync schedule routes (deprecated but moved to proper location)
-			protected.PUT("/instances/:instance_id/sync-schedules", syncSchedulesHandler.UpdateInstanceSchedule)
-			protected.PUT("/instances/:instance_id/sync-schedules/:entity_type", syncSchedulesHandler.UpdateInstanceEntitySchedule)
-			protected.POST("/instances/:instance_id/sync-schedules/:entity_type/trigger", syncSchedulesHandler.TriggerInstanceSync)
-			protected.PUT("/instances/:instance_id/sync-schedules/pause", syncSchedulesHandler.PauseInstance)
-			protected.PUT("/instances/:instance_id/sync-schedules/resume", syncSchedulesHandler.ResumeInstance)
+			// Sync schedule routes
+			protected.GET("/sync/schedules", middleware.RequirePermissionAnywhere(gormmodels.PermSyncRead), syncSchedulesHandler.GetSchedules)
+			protected.POST("/sync/schedules/pause-all", middleware.RequirePermission(gormmodels.PermSyncManage), audited(gormmodels.AuditSyncPaused), syncSchedulesHandler.PauseAll)
+			protected.POST("/sync/schedules/resume-all", middleware.RequirePermission(gormmodels.PermSyncManage), audited(gormmodels.AuditSyncResumed), syncSchedulesHandler.ResumeAll)
 			
-			// Global sync job routes (for cross-instance views)
-			protected.GET("/sync-jobs/:id", syncJobsHandler.GetSyncJob)
-			protected.GET("/sync-jobs/stream", syncJobsHandler.StreamSyncJobs)
+			// Instance-specific sync schedule routes
+			protected.PUT("/instances/:instance_id/sync-schedules", middleware.RequireInstancePermission(gormmodels.PermSyncManage, "instance_id"), audited(gormmodels.AuditSyncScheduleUpdated), syncSchedulesHandler.UpdateInstanceSchedule)
+			protected.PUT("/instances/:instance_id/sync-schedules/:entity_type", middleware.RequireInstancePermission(gormmodels.PermSyncManage, "instance_id"), audited(gormmodels.AuditSyncScheduleUpdated), syncSchedulesHandler.UpdateInstanceEntitySchedule)
+			protected.POST("/instances/:instance_id/sync-schedules/:entity_type/trigger", middleware.RequireInstancePermission(gormmodels.PermSyncManage, "instance_id"), audited(gormmodels.AuditSyncTriggered), syncSchedulesHandler.TriggerInstanceSync)
+			protected.PUT("/instances/:instance_id/sync-schedules/pause", middleware.RequireInstancePermission(gormmodels.PermSyncManage, "instance_id"), audited(gormmodels.AuditSyncPaused), syncSchedulesHandler.PauseInstance)
+			protected.PUT("/instances/:instance_id/sync-schedules/resume", middleware.RequireInstancePermission(gormmodels.PermSyncManage, "instance_id"), audited(gormmodels.AuditSyncResumed), syncSchedulesHandler.ResumeInstance)
+			
+			// Sync job routes
+			protected.GET("/sync-jobs/:id", middleware.RequirePermissionAnywhere(gormmodels.PermSyncRead), syncJobsHandler.GetSyncJob)
+			protected.GET("/sync-jobs/stream", middleware.RequirePermissionAnywhere(gormmodels.PermSyncRead), syncJobsHandler.StreamSyncJobs)
 			
 			// Instance-specific sync routes
-			protected.GET("/instances/:instance_id/sync-jobs", syncJobsHandler.ListSyncJobsForInstance)
-			protected.POST("/instances/:instance_id/sync-jobs/trigger", syncJobsHandler.TriggerSyncForInstance)
-			protected.GET("/instances/:instance_id/sync-configs", syncJobsHandler.GetSyncConfigs)
-			protected.PATCH("/instances/:instance_id/sync-configs/:sync_type", syncJobsHandler.UpdateSyncConfig)
+			protected.GET("/instances/:instance_id/sync-jobs", middleware.RequireInstancePermission(gormmodels.PermSyncRead, "instance_id"), syncJobsHandler.ListSyncJobsForInstance)
+			protected.POST("/instances/:instance_id/sync-jobs/trigger", middleware.RequireInstancePermission(gormmodels.PermSyncManage, "instance_id"), audited(gormmodels.AuditSyncTriggered), syncJobsHandler.TriggerSyncForInstance)
+			protected.GET("/instances/:instance_id/sync-configs", middleware.RequireInstancePermission(gormmodels.PermSyncRead, "instance_id"), syncJobsHandler.GetSyncConfigs)
+			protected.PATCH("/instances/:instance_id/sync-configs/:sync_type", middleware.RequireInstancePermission(gormmodels.PermSyncManage, "instance_id"), audited(gormmodels.AuditSyncConfigUpdated), syncJobsHandler.UpdateSyncConfig)
 			
 			// Activity routes (unified view)
-			protected.GET("/activity", activityHandler.ListActivity)
-			protected.GET("/activity/stream", activityHandler.StreamActivity)
+			protected.GET("/activity", middleware.RequirePermissionAnywhere(gormmodels.PermOperationsRead), activityHandler.ListActivity)
+			protected.GET("/activity/stream", middleware.RequirePermissionAnywhere(gormmodels.PermOperationsRead), activityHandler.StreamActivity)
+			
+			// Roles and their assignment to users
+			roles := protected.Group("/")
+			roles.Use(middleware.RequirePermission(gormmodels.PermRolesManage))
+			{
+				roles.GET("/permissions", rolesHandler.ListPermissions)
+				roles.GET("/roles", rolesHandler.ListRoles)
+				roles.GET("/roles/:id", rolesHandler.GetRole)
+				roles.POST("/roles", audited(gormmodels.AuditRoleCreated), rolesHandler.CreateRole)
+				roles.PUT("/roles/:id", audited(gormmodels.AuditRoleUpdated), rolesHandler.UpdateRole)
+				roles.DELETE("/roles/:id", audited(gormmodels.AuditRoleDeleted), rolesHandler.DeleteRole)
+				roles.GET("/users/:id/roles", rolesHandler.ListUserRoles)
+				roles.POST("/users/:id/roles", audited(gormmodels.AuditRoleAssigned), rolesHandler.AssignRole)
+				roles.DELETE("/users/:id/roles/:assignment_id", audited(gormmodels.AuditRoleUnassigned), rolesHandler.UnassignRole)
+			}
+			
+			// Service accounts and their API tokens
+			serviceAccounts := protected.Group("/service-accounts")
+			serviceAccounts.Use(middleware.RequirePermission(gormmodels.PermServiceAccountsManage))
+			{
+				serviceAccounts.GET("", serviceAccountsHandler.ListServiceAccounts)
+				serviceAccounts.POST("", audited(gormmodels.AuditServiceAccountCreated), serviceAccountsHandler.CreateServiceAccount)
+				serviceAccounts.GET("/:id/tokens", serviceAccountsHandler.ListTokens)
+				serviceAccounts.POST("/:id/tokens", audited(gormmodels.AuditAPITokenCreated), serviceAccountsHandler.CreateToken)
+				serviceAccounts.DELETE("/:id/tokens/:token_id", audited(gormmodels.AuditAPITokenRevoked), serviceAccountsHandler.RevokeToken)
+			}
+			
+			// User accounts
+			users := protected.Group("/users")
+			users.Use(middleware.RequirePermission(gormmodels.PermUsersManage))
+			{
+				users.GET("", usersHandler.ListUsers)
+				users.POST("", audited(gormmodels.AuditUserCreated), usersHandler.CreateUser)
+				users.GET("/:id", usersHandler.GetUser)
+				users.PUT("/:id", audited(gormmodels.AuditUserUpdated), usersHandler.UpdateUser)
+				users.DELETE("/:id", audited(gormmodels.AuditUserDeleted), usersHandler.DeleteUser)
+				users.POST("/:id/password", audited(gormmodels.AuditUserPasswordReset), usersHandler.ResetPassword)
+				users.GET("/:id/sessions", usersHandler.ListUserSessions)
+				users.DELETE("/:id/sessions", audited(gormmodels.AuditSessionRevoked), usersHandler.RevokeUserSessions)
+				users.DELETE("/:id/sessions/:session_id", audited(gormmodels.AuditSessionRevoked), usersHandler.RevokeUserSession)
+				users.GET("/:id/mfa", mfaHandler.GetUserMFA)
+				users.DELETE("/:id/mfa", audited(gormmodels.AuditMFAReset), mfaHandler.ResetUserMFA)
+			}
+			
+			// Login lockouts after repeated failures
+			if loginLimiter != nil {
+				lockouts := protected.Group("/lockouts")
+				lockouts.Use(middleware.RequirePermission(gormmodels.PermUsersManage))
+				{
+					lockouts.GET("", lockoutHandler.ListLockouts)
+					lockouts.POST("/unlock", lockoutHandler.Unlock)
+				}
+			}
+			
+			// Audit log
+			audit := protected.Group("/audit")
+			audit.Use(middleware.RequirePermission(gormmodels.PermAuditRead))
+			{
+				audit.GET("/events", auditHandler.ListEvents)
+				audit.GET("/verify", auditHandler.Verify)
+			}
 			
 			// Admin routes
 			admin := protected.Group("/admin")
-			admin.Use(middleware.AdminRequiredGorm())
+			admin.Use(middleware.RequirePermission(gormmodels.PermPipelineManage))
 			{
-				// Admin-only endpoints can be added here
+				// Pipeline configuration
+				admin.GET("/pipeline/config", pipelineConfigHandler.GetConfig)
+				admin.PUT("/pipeline/config", audited(gormmodels.AuditPipelineConfigUpdated), pipelineConfigHandler.UpdateConfig)
+				admin.POST("/pipeline/config/validate", pipelineConfigHandler.ValidateConfig)
 			}
 		}
 	}
@@ -283,11 +480,19 @@ func main() {
 		for {
 			select {
 			case <-ticker.C:
+				if !leaderElector.IsLeader() {
+					continue
+				}
 				if err := authHandler.DeleteExpiredSessions(ctx); err != nil {
 					logrus.WithError(err).Error("Failed to delete expired sessions")
 				} else {
 					logrus.Info("Cleaned up expired sessions")
 				}
+				if loginLimiter != nil {
+					if err := loginLimiter.DeleteExpired(ctx); err != nil {
+						logrus.WithError(err).Error("Failed to delete expired login throttles")
+					}
+				}
 			case <-ctx.Done():
 				return
 			}
@@ -325,6 +530,11 @@ func main() {
 		logrus.WithError(err).Fatal("Server forced to shutdown")
 	}
 
+	stopForwarding()
+	if auditForwarder != nil {
+		auditForwarder.Wait()
+	}
+
 	logrus.Info("Server exited")
 }
 
@@ -348,11 +558,31 @@ func handlePasswordReset(username, newPassword string) error {
 	}
 	defer db.Close()
 
+	policyConfig, err := config.LoadPasswordPolicy()
+	if err != nil {
+		return err
+	}
+	passwords, err := services.NewPasswordPolicy(db, policyConfig, logrus.StandardLogger())
+	if err != nil {
+		return err
+	}
+
 	// Update the password
 	ctx := context.Background()
-	if err := db.UpdateUserPassword(ctx, username, newPassword); err != nil {
+	user, err := passwords.SetUserPassword(ctx, username, newPassword)
+	if err != nil {
 		return fmt.Errorf("failed to update password: %w", err)
 	}
 
+	audit := services.NewAuditService(db, logrus.StandardLogger())
+	if err := audit.Record(ctx, &gormmodels.AuditEvent{
+		Action:    gormmodels.AuditUserPasswordReset,
+		ActorName: "orca",
+		Target:    "user:" + user.ID,
+		Details:   map[string]string{"username": user.Username, "method": "local"},
+	}); err != nil {
+		logrus.WithError(err).Warn("Failed to record audit event")
+	}
+
 	return nil
 }
\ No newline at end of file
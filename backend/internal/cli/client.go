@@ -6,6 +6,7 @@ import (
 	"fmt"
 	"io"
 	"net/http"
+	"net/url"
 	"time"
 )
 
@@ -64,6 +65,19 @@ type LoginResponse struct {
 		Username string `json:"username"`
 		IsAdmin  bool   `json:"is_admin"`
 	} `json:"user"`
+
+	// Set instead of the token when the login needs a second factor
+	MFARequired        bool   `json:"mfa_required,omitempty"`
+	MFAToken           string `json:"mfa_token,omitempty"`
+	EnrollmentRequired bool   `json:"enrollment_required,omitempty"`
+
+	// Set when the login completed an MFA enrolment
+	RecoveryCodes []string `json:"recovery_codes,omitempty"`
+}
+
+type MFAEnrollment struct {
+	Secret string `json:"secret"`
+	URI    string `json:"otpauth_url"`
 }
 
 func (c *Client) Login(username, password string) (*LoginResponse, error) {
@@ -95,6 +109,29 @@ func (c *Client) Login(username, password string) (*LoginResponse, error) {
 	return &loginResp, nil
 }
 
+// LoginMFA completes a login that needs a second factor with a TOTP or
+// recovery code
+func (c *Client) LoginMFA(mfaToken, code string) (*LoginResponse, error) {
+	var loginResp LoginResponse
+	if err := c.do("POST", "/api/auth/login/mfa", map[string]string{
+		"mfa_token": mfaToken,
+		"code":      code,
+	}, &loginResp); err != nil {
+		return nil, err
+	}
+	c.token = loginResp.Token
+	return &loginResp, nil
+}
+
+// EnrollMFA starts the MFA enrolment a login requires
+func (c *Client) EnrollMFA(mfaToken string) (*MFAEnrollment, error) {
+	var enrollment MFAEnrollment
+	if err := c.do("POST", "/api/auth/login/mfa/enroll", map[string]string{"mfa_token": mfaToken}, &enrollment); err != nil {
+		return nil, err
+	}
+	return &enrollment, nil
+}
+
 func (c *Client) Logout() error {
 	resp, err := c.request("POST", "/api/auth/logout", nil)
 	if err != nil {
@@ -118,6 +155,8 @@ type User struct {
 	LastLoginAt *time.Time `json:"last_login_at,omitempty"`
 	IsActive    bool      `json:"is_active"`
 	IsAdmin     bool      `json:"is_admin"`
+	AuthProvider string   `json:"auth_provider,omitempty"`
+	Email       string    `json:"email,omitempty"`
 }
 
 func (c *Client) GetCurrentUser() (*User, error) {
@@ -137,4 +176,299 @@ func (c *Client) GetCurrentUser() (*User, error) {
 	}
 
 	return &user, nil
-}
\ No newline at end of file
+}
+
+// do sends a request and decodes a JSON response into out, which may be nil.
+// Error responses are returned with the server's message.
+func (c *Client) do(method, endpoint string, body, out interface{}) error {
+	resp, err := c.request(method, endpoint, body)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode < 200 || resp.StatusCode >= 300 {
+		var errorResp struct {
+			Error string `json:"error"`
+		}
+		if err := json.NewDecoder(resp.Body).Decode(&errorResp); err != nil || errorResp.Error == "" {
+			return fmt.Errorf("request failed with status %d", resp.StatusCode)
+		}
+		return fmt.Errorf("%s", errorResp.Error)
+	}
+
+	if out == nil {
+		return nil
+	}
+	if err := json.NewDecoder(resp.Body).Decode(out); err != nil {
+		return fmt.Errorf("failed to decode response: %w", err)
+	}
+	return nil
+}
+
+type APIToken struct {
+	ID         string     `json:"id"`
+	UserID     string     `json:"user_id"`
+	Name       string     `json:"name"`
+	Display    string     `json:"display"`
+	Scopes     []string   `json:"scopes"`
+	ExpiresAt  *time.Time `json:"expires_at,omitempty"`
+	LastUsedAt *time.Time `json:"last_used_at,omitempty"`
+	LastUsedIP *string    `json:"last_used_ip,omitempty"`
+	RevokedAt  *time.Time `json:"revoked_at,omitempty"`
+	CreatedAt  time.Time  `json:"created_at"`
+}
+
+type CreateAPITokenRequest struct {
+	Name          string   `json:"name"`
+	Scopes        []string `json:"scopes"`
+	ExpiresInDays int      `json:"expires_in_days"`
+}
+
+func (c *Client) ListServiceAccounts() ([]User, error) {
+	var resp struct {
+		ServiceAccounts []User `json:"service_accounts"`
+	}
+	if err := c.do("GET", "/api/service-accounts", nil, &resp); err != nil {
+		return nil, err
+	}
+	return resp.ServiceAccounts, nil
+}
+
+func (c *Client) CreateServiceAccount(username, email string) (*User, error) {
+	var account User
+	body := map[string]string{"username": username, "email": email}
+	if err := c.do("POST", "/api/service-accounts", body, &account); err != nil {
+		return nil, err
+	}
+	return &account, nil
+}
+
+// FindServiceAccount finds a service account by ID or username
+func (c *Client) FindServiceAccount(nameOrID string) (*User, error) {
+	accounts, err := c.ListServiceAccounts()
+	if err != nil {
+		return nil, err
+	}
+	for i := range accounts {
+		if accounts[i].ID == nameOrID || accounts[i].Username == nameOrID {
+			return &accounts[i], nil
+		}
+	}
+	return nil, fmt.Errorf("service account %q not found", nameOrID)
+}
+
+func (c *Client) ListAPITokens(accountID string) ([]APIToken, error) {
+	var resp struct {
+		Tokens []APIToken `json:"tokens"`
+	}
+	if err := c.do("GET", "/api/service-accounts/"+url.PathEscape(accountID)+"/tokens", nil, &resp); err != nil {
+		return nil, err
+	}
+	return resp.Tokens, nil
+}
+
+// CreateAPIToken returns the new token, which cannot be retrieved again, and
+// its record
+func (c *Client) CreateAPIToken(accountID string, req CreateAPITokenRequest) (string, *APIToken, error) {
+	var resp struct {
+		Token    string   `json:"token"`
+		APIToken APIToken `json:"api_token"`
+	}
+	if err := c.do("POST", "/api/service-accounts/"+url.PathEscape(accountID)+"/tokens", req, &resp); err != nil {
+		return "", nil, err
+	}
+	return resp.Token, &resp.APIToken, nil
+}
+
+func (c *Client) RevokeAPIToken(accountID, tokenID string) error {
+	return c.do("DELETE", "/api/service-accounts/"+url.PathEscape(accountID)+"/tokens/"+url.PathEscape(tokenID), nil, nil)
+}
+
+// Lockout is a username or client IP whose logins are locked out
+type Lockout struct {
+	Kind          string     `json:"kind"`
+	Subject       string     `json:"subject"`
+	Failures      int        `json:"failures"`
+	LastFailureAt time.Time  `json:"last_failure_at"`
+	LockedUntil   *time.Time `json:"locked_until,omitempty"`
+}
+
+func (c *Client) ListLockouts() ([]Lockout, error) {
+	var resp struct {
+		Lockouts []Lockout `json:"lockouts"`
+	}
+	if err := c.do("GET", "/api/lockouts", nil, &resp); err != nil {
+		return nil, err
+	}
+	return resp.Lockouts, nil
+}
+
+// Unlock lifts the lockout of a username or, when username is empty, of a
+// client IP
+func (c *Client) Unlock(username, ip string) error {
+	return c.do("POST", "/api/lockouts/unlock", map[string]string{"username": username, "ip": ip}, nil)
+}
+
+type CreateUserRequest struct {
+	Username string `json:"username"`
+	Password string `json:"password"`
+	Email    string `json:"email,omitempty"`
+	IsAdmin  bool   `json:"is_admin"`
+}
+
+// UpdateUserRequest changes the fields that are set
+type UpdateUserRequest struct {
+	Username *string `json:"username,omitempty"`
+	Email    *string `json:"email,omitempty"`
+	IsAdmin  *bool   `json:"is_admin,omitempty"`
+	IsActive *bool   `json:"is_active,omitempty"`
+}
+
+type Session struct {
+	ID        string    `json:"id"`
+	CreatedAt time.Time `json:"created_at"`
+	ExpiresAt time.Time `json:"expires_at"`
+	UserAgent *string   `json:"user_agent,omitempty"`
+	IPAddress *string   `json:"ip_address,omitempty"`
+	Current   bool      `json:"current"`
+}
+
+func (c *Client) ListUsers() ([]User, error) {
+	var resp struct {
+		Users []User `json:"users"`
+	}
+	if err := c.do("GET", "/api/users", nil, &resp); err != nil {
+		return nil, err
+	}
+	return resp.Users, nil
+}
+
+// FindUser finds a user by ID or username
+func (c *Client) FindUser(nameOrID string) (*User, error) {
+	users, err := c.ListUsers()
+	if err != nil {
+		return nil, err
+	}
+	for i := range users {
+		if users[i].ID == nameOrID || users[i].Username == nameOrID {
+			return &users[i], nil
+		}
+	}
+	return nil, fmt.Errorf("user %q not found", nameOrID)
+}
+
+func (c *Client) CreateUser(req CreateUserRequest) (*User, error) {
+	var user User
+	if err := c.do("POST", "/api/users", req, &user); err != nil {
+		return nil, err
+	}
+	return &user, nil
+}
+
+func (c *Client) UpdateUser(id string, req UpdateUserRequest) (*User, error) {
+	var user User
+	if err := c.do("PUT", "/api/users/"+url.PathEscape(id), req, &user); err != nil {
+		return nil, err
+	}
+	return &user, nil
+}
+
+func (c *Client) DeleteUser(id string) error {
+	return c.do("DELETE", "/api/users/"+url.PathEscape(id), nil, nil)
+}
+
+// ResetPassword sets a new password for a local user, ending their sessions
+func (c *Client) ResetPassword(id, password string) error {
+	return c.do("POST", "/api/users/"+url.PathEscape(id)+"/password", map[string]string{"password": password}, nil)
+}
+
+// ListSessions returns the active sessions of a user, or of the current user
+// when id is empty
+func (c *Client) ListSessions(id string) ([]Session, error) {
+	endpoint := "/api/auth/sessions"
+	if id != "" {
+		endpoint = "/api/users/" + url.PathEscape(id) + "/sessions"
+	}
+	var resp struct {
+		Sessions []Session `json:"sessions"`
+	}
+	if err := c.do("GET", endpoint, nil, &resp); err != nil {
+		return nil, err
+	}
+	return resp.Sessions, nil
+}
+
+// RevokeSession ends a session of a user, or of the current user when id is
+// empty
+func (c *Client) RevokeSession(id, sessionID string) error {
+	endpoint := "/api/auth/sessions/" + url.PathEscape(sessionID)
+	if id != "" {
+		endpoint = "/api/users/" + url.PathEscape(id) + "/sessions/" + url.PathEscape(sessionID)
+	}
+	return c.do("DELETE", endpoint, nil, nil)
+}
+
+// RevokeSessions ends all sessions of a user
+func (c *Client) RevokeSessions(id string) error {
+	return c.do("DELETE", "/api/users/"+url.PathEscape(id)+"/sessions", nil, nil)
+}
+
+// AuditChange is the value of a field before and after an audited action
+type AuditChange struct {
+	Before string `json:"before,omitempty"`
+	After  string `json:"after,omitempty"`
+}
+
+// AuditEvent is an entry of the audit log
+type AuditEvent struct {
+	ID        string                 `json:"id"`
+	Sequence  int64                  `json:"sequence"`
+	Action    string                 `json:"action"`
+	ActorID   *string                `json:"actor_id,omitempty"`
+	ActorName string                 `json:"actor_name"`
+	Target    string                 `json:"target"`
+	ClientIP  string                 `json:"client_ip"`
+	UserAgent string                 `json:"user_agent"`
+	RequestID string                 `json:"request_id"`
+	Details   map[string]string      `json:"details,omitempty"`
+	Changes   map[string]AuditChange `json:"changes,omitempty"`
+	Hash      string                 `json:"hash"`
+	CreatedAt time.Time              `json:"created_at"`
+}
+
+// AuditVerification is the result of checking the audit hash chain
+type AuditVerification struct {
+	Valid     bool   `json:"valid"`
+	Events    int64  `json:"events"`
+	Unchained int64  `json:"unchained"`
+	LastHash  string `json:"last_hash,omitempty"`
+	BrokenAt  int64  `json:"broken_at,omitempty"`
+	Problem   string `json:"problem,omitempty"`
+}
+
+// ListAuditEvents returns the audit events matching the filters, newest
+// first, and how many match in total
+func (c *Client) ListAuditEvents(filters url.Values) ([]AuditEvent, int64, error) {
+	var resp struct {
+		Events []AuditEvent `json:"events"`
+		Total  int64        `json:"total"`
+	}
+	endpoint := "/api/audit/events"
+	if len(filters) > 0 {
+		endpoint += "?" + filters.Encode()
+	}
+	if err := c.do("GET", endpoint, nil, &resp); err != nil {
+		return nil, 0, err
+	}
+	return resp.Events, resp.Total, nil
+}
+
+// VerifyAudit has the server check the audit hash chain
+func (c *Client) VerifyAudit() (*AuditVerification, error) {
+	var result AuditVerification
+	if err := c.do("GET", "/api/audit/verify", nil, &result); err != nil {
+		return nil, err
+	}
+	return &result, nil
+}
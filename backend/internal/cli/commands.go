@@ -3,10 +3,19 @@ package cli
 import (
 	"context"
 	"fmt"
+	"net/url"
 	"os"
+	"sort"
+	"strconv"
+	"strings"
+	"text/tabwriter"
 	"time"
 
+	"github.com/orca-ng/orca/internal/config"
 	"github.com/orca-ng/orca/internal/database"
+	gormmodels "github.com/orca-ng/orca/internal/models/gorm"
+	"github.com/orca-ng/orca/internal/services"
+	"github.com/sirupsen/logrus"
 	"github.com/spf13/cobra"
 	"github.com/spf13/viper"
 	"golang.org/x/term"
@@ -43,6 +52,12 @@ func NewLoginCmd() *cobra.Command {
 			if err != nil {
 				return fmt.Errorf("login failed: %w", err)
 			}
+			if loginResp.MFARequired {
+				loginResp, err = completeMFALogin(client, loginResp)
+				if err != nil {
+					return fmt.Errorf("login failed: %w", err)
+				}
+			}
 
 			// Save session
 			store, err := NewSessionStore()
@@ -75,6 +90,38 @@ func NewLoginCmd() *cobra.Command {
 	return cmd
 }
 
+// completeMFALogin asks for the second factor of a login, enrolling the
+// user first when their account requires MFA
+func completeMFALogin(client *Client, challenge *LoginResponse) (*LoginResponse, error) {
+	if challenge.EnrollmentRequired {
+		enrollment, err := client.EnrollMFA(challenge.MFAToken)
+		if err != nil {
+			return nil, err
+		}
+		fmt.Println("\nYour account requires multi-factor authentication.")
+		fmt.Println("Add this account to your authenticator app:")
+		fmt.Printf("  Secret: %s\n", enrollment.Secret)
+		fmt.Printf("  URI:    %s\n\n", enrollment.URI)
+	}
+
+	fmt.Print("Authentication code: ")
+	var code string
+	fmt.Scanln(&code)
+
+	loginResp, err := client.LoginMFA(challenge.MFAToken, code)
+	if err != nil {
+		return nil, err
+	}
+	if len(loginResp.RecoveryCodes) > 0 {
+		fmt.Println("\nStore these recovery codes safely. Each logs you in once without your app:")
+		for _, recoveryCode := range loginResp.RecoveryCodes {
+			fmt.Printf("  %s\n", recoveryCode)
+		}
+		fmt.Println()
+	}
+	return loginResp, nil
+}
+
 func NewLogoutCmd() *cobra.Command {
 	return &cobra.Command{
 		Use:   "logout",
@@ -172,6 +219,13 @@ func NewUserCmd() *cobra.Command {
 	cmd.AddCommand(newUserListCmd())
 	cmd.AddCommand(newUserCreateCmd())
 	cmd.AddCommand(newUserResetPasswordCmd())
+	cmd.AddCommand(newUserSetActiveCmd("enable", true))
+	cmd.AddCommand(newUserSetActiveCmd("disable", false))
+	cmd.AddCommand(newUserDeleteCmd())
+	cmd.AddCommand(newUserSessionsCmd())
+	cmd.AddCommand(newUserRevokeSessionCmd())
+	cmd.AddCommand(newUserLockoutsCmd())
+	cmd.AddCommand(newUserUnlockCmd())
 
 	return cmd
 }
@@ -182,45 +236,71 @@ func newUserListCmd() *cobra.Command {
 		Short: "List all users",
 		Long:  `Display a list of all ORCA users.`,
 		RunE: func(cmd *cobra.Command, args []string) error {
-			// Load session
-			session, err := loadSession()
+			client, err := sessionClient()
 			if err != nil {
 				return err
 			}
 
-			// TODO: Implement user list API call
-			fmt.Println("User list functionality not yet implemented")
-			_ = session
-			return nil
+			users, err := client.ListUsers()
+			if err != nil {
+				return fmt.Errorf("failed to list users: %w", err)
+			}
+			if len(users) == 0 {
+				fmt.Println("No users")
+				return nil
+			}
+
+			w := tabwriter.NewWriter(os.Stdout, 0, 0, 2, ' ', 0)
+			fmt.Fprintln(w, "ID\tUSERNAME\tPROVIDER\tADMIN\tACTIVE\tLAST LOGIN")
+			for _, user := range users {
+				fmt.Fprintf(w, "%s\t%s\t%s\t%t\t%t\t%s\n",
+					user.ID, user.Username, user.AuthProvider, user.IsAdmin, user.IsActive,
+					formatOptionalTime(user.LastLoginAt, "never"))
+			}
+			return w.Flush()
 		},
 	}
 }
 
 func newUserCreateCmd() *cobra.Command {
 	var username string
+	var email string
+	var password string
 	var isAdmin bool
 
 	cmd := &cobra.Command{
 		Use:   "create",
 		Short: "Create a new user",
-		Long:  `Create a new ORCA user.`,
+		Long:  `Create a new local ORCA user who logs in with a password.`,
 		RunE: func(cmd *cobra.Command, args []string) error {
-			// Load session
-			session, err := loadSession()
+			client, err := sessionClient()
 			if err != nil {
 				return err
 			}
+			if password == "" {
+				if password, err = readNewPassword(); err != nil {
+					return err
+				}
+			}
+
+			user, err := client.CreateUser(CreateUserRequest{
+				Username: username,
+				Password: password,
+				Email:    email,
+				IsAdmin:  isAdmin,
+			})
+			if err != nil {
+				return fmt.Errorf("failed to create user: %w", err)
+			}
 
-			// TODO: Implement user create API call
-			fmt.Println("User create functionality not yet implemented")
-			_ = session
-			_ = username
-			_ = isAdmin
+			fmt.Printf("Created user %s (%s)\n", user.Username, user.ID)
 			return nil
 		},
 	}
 
 	cmd.Flags().StringVarP(&username, "username", "u", "", "Username for the new user")
+	cmd.Flags().StringVarP(&email, "email", "e", "", "Email address of the new user")
+	cmd.Flags().StringVarP(&password, "password", "p", "", "Password (will prompt if not provided)")
 	cmd.Flags().BoolVarP(&isAdmin, "admin", "a", false, "Grant admin privileges")
 	cmd.MarkFlagRequired("username")
 
@@ -234,28 +314,14 @@ func newUserResetPasswordCmd() *cobra.Command {
 	cmd := &cobra.Command{
 		Use:   "reset-password",
 		Short: "Reset a user's password",
-		Long:  `Reset the password for an ORCA user. This command requires admin privileges.`,
+		Long: `Reset the password for a local ORCA user, ending their sessions. This
+command requires the users:manage permission.`,
 		RunE: func(cmd *cobra.Command, args []string) error {
 			// Prompt for password if not provided
 			if password == "" {
-				fmt.Print("New password: ")
-				passwordBytes, err := term.ReadPassword(int(os.Stdin.Fd()))
-				if err != nil {
-					return fmt.Errorf("failed to read password: %w", err)
-				}
-				fmt.Println()
-				password = string(passwordBytes)
-
-				// Confirm password
-				fmt.Print("Confirm password: ")
-				confirmBytes, err := term.ReadPassword(int(os.Stdin.Fd()))
-				if err != nil {
-					return fmt.Errorf("failed to read password confirmation: %w", err)
-				}
-				fmt.Println()
-
-				if string(confirmBytes) != password {
-					return fmt.Errorf("passwords do not match")
+				var err error
+				if password, err = readNewPassword(); err != nil {
+					return err
 				}
 			}
 
@@ -265,29 +331,35 @@ func newUserResetPasswordCmd() *cobra.Command {
 				localReset, _ := cmd.Flags().GetBool("local")
 				if localReset {
 					// Direct database connection for local admin reset
-					dbURL := viper.GetString("DATABASE_URL")
-					if dbURL == "" {
-						dbURL = os.Getenv("DATABASE_URL")
-						if dbURL == "" {
-							return fmt.Errorf("DATABASE_URL environment variable not set")
-						}
+					db, err := localDatabase()
+					if err != nil {
+						return err
 					}
+					defer db.Close()
 
-					config := database.DatabaseConfig{
-						Driver: "postgres",
-						DSN:    dbURL,
+					policyConfig, err := config.LoadPasswordPolicy()
+					if err != nil {
+						return err
 					}
-					
-					db, err := database.NewGormConnection(config)
+					passwords, err := services.NewPasswordPolicy(db, policyConfig, logrus.StandardLogger())
 					if err != nil {
-						return fmt.Errorf("failed to connect to database: %w", err)
+						return err
 					}
-					defer db.Close()
 
 					ctx := context.Background()
-					if err := db.UpdateUserPassword(ctx, username, password); err != nil {
+					user, err := passwords.SetUserPassword(ctx, username, password)
+					if err != nil {
 						return fmt.Errorf("failed to update password: %w", err)
 					}
+					audit := services.NewAuditService(db, logrus.StandardLogger())
+					if err := audit.Record(ctx, &gormmodels.AuditEvent{
+						Action:    gormmodels.AuditUserPasswordReset,
+						ActorName: "orca-cli",
+						Target:    "user:" + user.ID,
+						Details:   map[string]string{"username": user.Username, "method": "local"},
+					}); err != nil {
+						fmt.Fprintf(os.Stderr, "Warning: %v\n", err)
+					}
 
 					fmt.Printf("Successfully reset password for user: %s\n", username)
 					return nil
@@ -295,14 +367,19 @@ func newUserResetPasswordCmd() *cobra.Command {
 			}
 
 			// Load session for remote password reset
-			session, err := loadSession()
+			client, err := sessionClient()
 			if err != nil {
 				return fmt.Errorf("not logged in - use 'orca-cli login' first or use --local flag for admin password reset")
 			}
+			user, err := client.FindUser(username)
+			if err != nil {
+				return err
+			}
+			if err := client.ResetPassword(user.ID, password); err != nil {
+				return fmt.Errorf("failed to reset password: %w", err)
+			}
 
-			// TODO: Implement remote password reset API call
-			fmt.Println("Remote password reset functionality not yet implemented")
-			_ = session
+			fmt.Printf("Successfully reset password for user: %s\n", user.Username)
 			return nil
 		},
 	}
@@ -315,6 +392,734 @@ func newUserResetPasswordCmd() *cobra.Command {
 	return cmd
 }
 
+// newUserSetActiveCmd creates the enable or disable command. Disabling a
+// user ends their sessions.
+func newUserSetActiveCmd(use string, active bool) *cobra.Command {
+	short := "Enable a user"
+	if !active {
+		short = "Disable a user and end their sessions"
+	}
+	return &cobra.Command{
+		Use:   use + " <username>",
+		Short: short,
+		Args:  cobra.ExactArgs(1),
+		RunE: func(cmd *cobra.Command, args []string) error {
+			client, err := sessionClient()
+			if err != nil {
+				return err
+			}
+			user, err := client.FindUser(args[0])
+			if err != nil {
+				return err
+			}
+
+			if _, err := client.UpdateUser(user.ID, UpdateUserRequest{IsActive: &active}); err != nil {
+				return fmt.Errorf("failed to %s user: %w", use, err)
+			}
+			fmt.Printf("User %s %sd\n", user.Username, use)
+			return nil
+		},
+	}
+}
+
+func newUserDeleteCmd() *cobra.Command {
+	var yes bool
+
+	cmd := &cobra.Command{
+		Use:   "delete <username>",
+		Short: "Delete a user",
+		Long: `Delete a user with their sessions, API tokens, role assignments and MFA
+enrolment. Users who created operations or instances cannot be deleted;
+disable them instead.`,
+		Args: cobra.ExactArgs(1),
+		RunE: func(cmd *cobra.Command, args []string) error {
+			client, err := sessionClient()
+			if err != nil {
+				return err
+			}
+			user, err := client.FindUser(args[0])
+			if err != nil {
+				return err
+			}
+
+			if !yes {
+				fmt.Printf("Delete user %s (%s)? [y/N]: ", user.Username, user.ID)
+				var answer string
+				fmt.Scanln(&answer)
+				if strings.ToLower(strings.TrimSpace(answer)) != "y" {
+					fmt.Println("Aborted")
+					return nil
+				}
+			}
+
+			if err := client.DeleteUser(user.ID); err != nil {
+				return fmt.Errorf("failed to delete user: %w", err)
+			}
+			fmt.Printf("Deleted user %s\n", user.Username)
+			return nil
+		},
+	}
+
+	cmd.Flags().BoolVarP(&yes, "yes", "y", false, "Do not ask for confirmation")
+
+	return cmd
+}
+
+func newUserSessionsCmd() *cobra.Command {
+	return &cobra.Command{
+		Use:   "sessions [username]",
+		Short: "List active sessions",
+		Long:  `List the active sessions of a user, or your own without a username.`,
+		Args:  cobra.MaximumNArgs(1),
+		RunE: func(cmd *cobra.Command, args []string) error {
+			client, err := sessionClient()
+			if err != nil {
+				return err
+			}
+			userID := ""
+			if len(args) == 1 {
+				user, err := client.FindUser(args[0])
+				if err != nil {
+					return err
+				}
+				userID = user.ID
+			}
+
+			sessions, err := client.ListSessions(userID)
+			if err != nil {
+				return fmt.Errorf("failed to list sessions: %w", err)
+			}
+			if len(sessions) == 0 {
+				fmt.Println("No active sessions")
+				return nil
+			}
+
+			w := tabwriter.NewWriter(os.Stdout, 0, 0, 2, ' ', 0)
+			fmt.Fprintln(w, "ID\tCREATED\tEXPIRES\tIP ADDRESS\tUSER AGENT")
+			for _, session := range sessions {
+				id := session.ID
+				if session.Current {
+					id += " (current)"
+				}
+				fmt.Fprintf(w, "%s\t%s\t%s\t%s\t%s\n",
+					id, session.CreatedAt.Local().Format(time.RFC3339), session.ExpiresAt.Local().Format(time.RFC3339),
+					optionalString(session.IPAddress), optionalString(session.UserAgent))
+			}
+			return w.Flush()
+		},
+	}
+}
+
+func newUserRevokeSessionCmd() *cobra.Command {
+	var username string
+	var all bool
+
+	cmd := &cobra.Command{
+		Use:   "revoke-session [session-id]",
+		Short: "End a session",
+		Long: `End one of your own sessions, or with --user a session of another user.
+With --all every session of the user is ended.`,
+		Args: cobra.MaximumNArgs(1),
+		RunE: func(cmd *cobra.Command, args []string) error {
+			if all && username == "" {
+				return fmt.Errorf("--all requires --user")
+			}
+			if !all && len(args) != 1 {
+				return fmt.Errorf("specify a session ID, or --all with --user")
+			}
+
+			client, err := sessionClient()
+			if err != nil {
+				return err
+			}
+			userID := ""
+			if username != "" {
+				user, err := client.FindUser(username)
+				if err != nil {
+					return err
+				}
+				userID = user.ID
+			}
+
+			if all {
+				if err := client.RevokeSessions(userID); err != nil {
+					return fmt.Errorf("failed to revoke sessions: %w", err)
+				}
+				fmt.Printf("Revoked all sessions of %s\n", username)
+				return nil
+			}
+			if err := client.RevokeSession(userID, args[0]); err != nil {
+				return fmt.Errorf("failed to revoke session: %w", err)
+			}
+			fmt.Printf("Revoked session %s\n", args[0])
+			return nil
+		},
+	}
+
+	cmd.Flags().StringVarP(&username, "user", "u", "", "User whose session to end, yourself if not given")
+	cmd.Flags().BoolVar(&all, "all", false, "End all sessions of the user")
+
+	return cmd
+}
+
+// readNewPassword prompts for a new password twice
+func readNewPassword() (string, error) {
+	fmt.Print("New password: ")
+	passwordBytes, err := term.ReadPassword(int(os.Stdin.Fd()))
+	if err != nil {
+		return "", fmt.Errorf("failed to read password: %w", err)
+	}
+	fmt.Println()
+
+	// Confirm password
+	fmt.Print("Confirm password: ")
+	confirmBytes, err := term.ReadPassword(int(os.Stdin.Fd()))
+	if err != nil {
+		return "", fmt.Errorf("failed to read password confirmation: %w", err)
+	}
+	fmt.Println()
+
+	if string(confirmBytes) != string(passwordBytes) {
+		return "", fmt.Errorf("passwords do not match")
+	}
+	return string(passwordBytes), nil
+}
+
+func optionalString(s *string) string {
+	if s == nil {
+		return "-"
+	}
+	return *s
+}
+
+func newUserLockoutsCmd() *cobra.Command {
+	return &cobra.Command{
+		Use:   "lockouts",
+		Short: "List login lockouts",
+		Long:  `List the usernames and client IPs whose logins are locked out after repeated failures.`,
+		RunE: func(cmd *cobra.Command, args []string) error {
+			client, err := sessionClient()
+			if err != nil {
+				return err
+			}
+
+			lockouts, err := client.ListLockouts()
+			if err != nil {
+				return fmt.Errorf("failed to list lockouts: %w", err)
+			}
+			if len(lockouts) == 0 {
+				fmt.Println("No lockouts")
+				return nil
+			}
+
+			w := tabwriter.NewWriter(os.Stdout, 0, 0, 2, ' ', 0)
+			fmt.Fprintln(w, "KIND\tSUBJECT\tFAILURES\tLAST FAILURE\tLOCKED UNTIL")
+			for _, lockout := range lockouts {
+				fmt.Fprintf(w, "%s\t%s\t%d\t%s\t%s\n",
+					lockout.Kind, lockout.Subject, lockout.Failures,
+					lockout.LastFailureAt.Local().Format(time.RFC3339), formatOptionalTime(lockout.LockedUntil, "-"))
+			}
+			return w.Flush()
+		},
+	}
+}
+
+func newUserUnlockCmd() *cobra.Command {
+	var ip string
+	var local bool
+
+	cmd := &cobra.Command{
+		Use:   "unlock [username]",
+		Short: "Lift a login lockout",
+		Long: `Lift the login lockout of a username, or of a client IP with --ip, and
+forget its failed logins. With --local the lockout is lifted directly in the
+database (requires DATABASE_URL), for when no admin can log in.`,
+		Args: cobra.MaximumNArgs(1),
+		RunE: func(cmd *cobra.Command, args []string) error {
+			var username string
+			if len(args) == 1 {
+				username = args[0]
+			}
+			if (username == "") == (ip == "") {
+				return fmt.Errorf("specify either a username or --ip")
+			}
+			subject := username
+			if subject == "" {
+				subject = ip
+			}
+
+			if local {
+				db, err := localDatabase()
+				if err != nil {
+					return err
+				}
+				defer db.Close()
+
+				kind, subject := gormmodels.ThrottleKindUsername, services.NormalizeUsername(username)
+				if username == "" {
+					kind, subject = gormmodels.ThrottleKindIP, ip
+				}
+				ctx := context.Background()
+				limiter := services.NewLoginLimiter(db, config.LockoutConfig{}, logrus.StandardLogger())
+				found, err := limiter.Unlock(ctx, kind, subject)
+				if err != nil {
+					return fmt.Errorf("failed to unlock: %w", err)
+				}
+				if !found {
+					return fmt.Errorf("no lockout found for %s", subject)
+				}
+				audit := services.NewAuditService(db, logrus.StandardLogger())
+				if err := audit.Record(ctx, &gormmodels.AuditEvent{
+					Action:    gormmodels.AuditLoginUnlocked,
+					ActorName: "orca-cli",
+					Target:    kind + ":" + subject,
+					Details:   map[string]string{"method": "local"},
+				}); err != nil {
+					fmt.Fprintf(os.Stderr, "Warning: %v\n", err)
+				}
+				fmt.Printf("Unlocked %s\n", subject)
+				return nil
+			}
+
+			client, err := sessionClient()
+			if err != nil {
+				return err
+			}
+			if err := client.Unlock(username, ip); err != nil {
+				return fmt.Errorf("failed to unlock: %w", err)
+			}
+			fmt.Printf("Unlocked %s\n", subject)
+			return nil
+		},
+	}
+
+	cmd.Flags().StringVar(&ip, "ip", "", "Client IP to unlock instead of a username")
+	cmd.Flags().BoolVar(&local, "local", false, "Perform local database update (requires DATABASE_URL)")
+
+	return cmd
+}
+
+func NewServiceAccountCmd() *cobra.Command {
+	cmd := &cobra.Command{
+		Use:   "service-account",
+		Short: "Manage service accounts",
+		Long:  `Commands for managing service accounts, which automation uses with API tokens.`,
+	}
+
+	cmd.AddCommand(newServiceAccountListCmd())
+	cmd.AddCommand(newServiceAccountCreateCmd())
+
+	return cmd
+}
+
+func newServiceAccountListCmd() *cobra.Command {
+	return &cobra.Command{
+		Use:   "list",
+		Short: "List service accounts",
+		RunE: func(cmd *cobra.Command, args []string) error {
+			client, err := sessionClient()
+			if err != nil {
+				return err
+			}
+
+			accounts, err := client.ListServiceAccounts()
+			if err != nil {
+				return fmt.Errorf("failed to list service accounts: %w", err)
+			}
+			if len(accounts) == 0 {
+				fmt.Println("No service accounts")
+				return nil
+			}
+
+			w := tabwriter.NewWriter(os.Stdout, 0, 0, 2, ' ', 0)
+			fmt.Fprintln(w, "ID\tUSERNAME\tACTIVE\tCREATED")
+			for _, account := range accounts {
+				fmt.Fprintf(w, "%s\t%s\t%t\t%s\n", account.ID, account.Username, account.IsActive, account.CreatedAt.Local().Format(time.RFC3339))
+			}
+			return w.Flush()
+		},
+	}
+}
+
+func newServiceAccountCreateCmd() *cobra.Command {
+	var username string
+	var email string
+
+	cmd := &cobra.Command{
+		Use:   "create",
+		Short: "Create a service account",
+		Long:  `Create a service account. Assign it roles, then create API tokens for it with 'orca-cli token create'.`,
+		RunE: func(cmd *cobra.Command, args []string) error {
+			client, err := sessionClient()
+			if err != nil {
+				return err
+			}
+
+			account, err := client.CreateServiceAccount(username, email)
+			if err != nil {
+				return fmt.Errorf("failed to create service account: %w", err)
+			}
+
+			fmt.Printf("Created service account %s (%s)\n", account.Username, account.ID)
+			return nil
+		},
+	}
+
+	cmd.Flags().StringVarP(&username, "username", "u", "", "Username of the service account")
+	cmd.Flags().StringVar(&email, "email", "", "Contact email")
+	cmd.MarkFlagRequired("username")
+
+	return cmd
+}
+
+func NewTokenCmd() *cobra.Command {
+	cmd := &cobra.Command{
+		Use:   "token",
+		Short: "Manage API tokens of service accounts",
+		Long: `Commands for managing the API tokens of service accounts. Tokens are sent
+as "Authorization: Bearer <token>" and are limited to their scopes.`,
+	}
+
+	cmd.AddCommand(newTokenListCmd())
+	cmd.AddCommand(newTokenCreateCmd())
+	cmd.AddCommand(newTokenRevokeCmd())
+
+	return cmd
+}
+
+func newTokenListCmd() *cobra.Command {
+	var account string
+
+	cmd := &cobra.Command{
+		Use:   "list",
+		Short: "List the API tokens of a service account",
+		RunE: func(cmd *cobra.Command, args []string) error {
+			client, err := sessionClient()
+			if err != nil {
+				return err
+			}
+			serviceAccount, err := client.FindServiceAccount(account)
+			if err != nil {
+				return err
+			}
+
+			tokens, err := client.ListAPITokens(serviceAccount.ID)
+			if err != nil {
+				return fmt.Errorf("failed to list API tokens: %w", err)
+			}
+			if len(tokens) == 0 {
+				fmt.Println("No API tokens")
+				return nil
+			}
+
+			w := tabwriter.NewWriter(os.Stdout, 0, 0, 2, ' ', 0)
+			fmt.Fprintln(w, "ID\tNAME\tTOKEN\tSCOPES\tSTATUS\tEXPIRES\tLAST USED")
+			for _, token := range tokens {
+				fmt.Fprintf(w, "%s\t%s\t%s...\t%s\t%s\t%s\t%s\n",
+					token.ID, token.Name, token.Display, strings.Join(token.Scopes, ","),
+					tokenStatus(token), formatOptionalTime(token.ExpiresAt, "never"), formatOptionalTime(token.LastUsedAt, "never"))
+			}
+			return w.Flush()
+		},
+	}
+
+	cmd.Flags().StringVarP(&account, "account", "a", "", "Service account username or ID")
+	cmd.MarkFlagRequired("account")
+
+	return cmd
+}
+
+func newTokenCreateCmd() *cobra.Command {
+	var account string
+	var name string
+	var scopes []string
+	var expiresInDays int
+
+	cmd := &cobra.Command{
+		Use:   "create",
+		Short: "Create an API token for a service account",
+		Long: `Create an API token for a service account. The token is printed once and
+cannot be retrieved again. Scopes are permissions such as "operations:read"
+or "operations:create:*"; "*" allows everything the account's roles grant.`,
+		RunE: func(cmd *cobra.Command, args []string) error {
+			client, err := sessionClient()
+			if err != nil {
+				return err
+			}
+			serviceAccount, err := client.FindServiceAccount(account)
+			if err != nil {
+				return err
+			}
+
+			token, apiToken, err := client.CreateAPIToken(serviceAccount.ID, CreateAPITokenRequest{
+				Name:          name,
+				Scopes:        scopes,
+				ExpiresInDays: expiresInDays,
+			})
+			if err != nil {
+				return fmt.Errorf("failed to create API token: %w", err)
+			}
+
+			fmt.Printf("Created API token %s for %s\n", apiToken.ID, serviceAccount.Username)
+			fmt.Printf("Expires: %s\n", formatOptionalTime(apiToken.ExpiresAt, "never"))
+			fmt.Println("\nStore this token now, it will not be shown again:")
+			fmt.Println(token)
+			return nil
+		},
+	}
+
+	cmd.Flags().StringVarP(&account, "account", "a", "", "Service account username or ID")
+	cmd.Flags().StringVarP(&name, "name", "n", "", "Name describing where the token is used")
+	cmd.Flags().StringSliceVar(&scopes, "scope", nil, "Permission the token is limited to (repeatable)")
+	cmd.Flags().IntVar(&expiresInDays, "expires-in-days", 90, "Days until the token expires, 0 for no expiry")
+	cmd.MarkFlagRequired("account")
+	cmd.MarkFlagRequired("name")
+	cmd.MarkFlagRequired("scope")
+
+	return cmd
+}
+
+func newTokenRevokeCmd() *cobra.Command {
+	var account string
+
+	cmd := &cobra.Command{
+		Use:   "revoke <token-id>",
+		Short: "Revoke an API token",
+		Args:  cobra.ExactArgs(1),
+		RunE: func(cmd *cobra.Command, args []string) error {
+			client, err := sessionClient()
+			if err != nil {
+				return err
+			}
+			serviceAccount, err := client.FindServiceAccount(account)
+			if err != nil {
+				return err
+			}
+
+			if err := client.RevokeAPIToken(serviceAccount.ID, args[0]); err != nil {
+				return fmt.Errorf("failed to revoke API token: %w", err)
+			}
+
+			fmt.Printf("Revoked API token %s\n", args[0])
+			return nil
+		},
+	}
+
+	cmd.Flags().StringVarP(&account, "account", "a", "", "Service account username or ID")
+	cmd.MarkFlagRequired("account")
+
+	return cmd
+}
+
+func tokenStatus(token APIToken) string {
+	switch {
+	case token.RevokedAt != nil:
+		return "revoked"
+	case token.ExpiresAt != nil && !time.Now().Before(*token.ExpiresAt):
+		return "expired"
+	}
+	return "active"
+}
+
+func formatOptionalTime(t *time.Time, fallback string) string {
+	if t == nil {
+		return fallback
+	}
+	return t.Local().Format(time.RFC3339)
+}
+
+func NewAuditCmd() *cobra.Command {
+	cmd := &cobra.Command{
+		Use:   "audit",
+		Short: "Inspect the audit log",
+		Long: `Commands for reading the audit log of administrative and security actions
+and checking that its hash chain was not tampered with.`,
+	}
+
+	cmd.AddCommand(newAuditListCmd())
+	cmd.AddCommand(newAuditVerifyCmd())
+
+	return cmd
+}
+
+func newAuditListCmd() *cobra.Command {
+	var action, actor, target, requestID, since, until string
+	var limit, offset int
+	var details bool
+
+	cmd := &cobra.Command{
+		Use:   "list",
+		Short: "List audit events",
+		Long: `List audit events, newest first. --action takes an action such as
+"instance.updated" or a prefix ending in "*" such as "user.*". --since and
+--until take RFC 3339 times or durations back from now such as 24h.`,
+		RunE: func(cmd *cobra.Command, args []string) error {
+			filters := url.Values{}
+			for key, value := range map[string]string{
+				"action":     action,
+				"actor":      actor,
+				"target":     target,
+				"request_id": requestID,
+			} {
+				if value != "" {
+					filters.Set(key, value)
+				}
+			}
+			for key, value := range map[string]string{"since": since, "until": until} {
+				if value == "" {
+					continue
+				}
+				t, err := parseAuditTime(value)
+				if err != nil {
+					return fmt.Errorf("invalid --%s: %w", key, err)
+				}
+				filters.Set(key, t.UTC().Format(time.RFC3339))
+			}
+			if limit > 0 {
+				filters.Set("limit", strconv.Itoa(limit))
+			}
+			if offset > 0 {
+				filters.Set("offset", strconv.Itoa(offset))
+			}
+
+			client, err := sessionClient()
+			if err != nil {
+				return err
+			}
+			events, total, err := client.ListAuditEvents(filters)
+			if err != nil {
+				return fmt.Errorf("failed to list audit events: %w", err)
+			}
+			if len(events) == 0 {
+				fmt.Println("No audit events")
+				return nil
+			}
+
+			w := tabwriter.NewWriter(os.Stdout, 0, 0, 2, ' ', 0)
+			fmt.Fprintln(w, "SEQ\tTIME\tACTION\tACTOR\tTARGET\tCLIENT IP\tREQUEST ID")
+			for _, event := range events {
+				fmt.Fprintf(w, "%d\t%s\t%s\t%s\t%s\t%s\t%s\n",
+					event.Sequence, event.CreatedAt.Local().Format(time.RFC3339), event.Action,
+					orDash(event.ActorName), orDash(event.Target), orDash(event.ClientIP), orDash(event.RequestID))
+				if details {
+					for _, key := range sortedKeys(event.Details) {
+						fmt.Fprintf(w, "\t\t  %s: %s\t\t\t\t\n", key, event.Details[key])
+					}
+					for _, key := range sortedKeys(event.Changes) {
+						change := event.Changes[key]
+						fmt.Fprintf(w, "\t\t  %s: %q -> %q\t\t\t\t\n", key, change.Before, change.After)
+					}
+				}
+			}
+			if err := w.Flush(); err != nil {
+				return err
+			}
+			if int64(offset+len(events)) < total {
+				fmt.Printf("\nShowing %d of %d events, use --offset for more\n", len(events), total)
+			}
+			return nil
+		},
+	}
+
+	cmd.Flags().StringVar(&action, "action", "", "Action, or action prefix ending in *")
+	cmd.Flags().StringVar(&actor, "actor", "", "Username of the actor")
+	cmd.Flags().StringVar(&target, "target", "", "Target, e.g. instance:<id>")
+	cmd.Flags().StringVar(&requestID, "request-id", "", "Request ID")
+	cmd.Flags().StringVar(&since, "since", "", "Only events at or after this time")
+	cmd.Flags().StringVar(&until, "until", "", "Only events before this time")
+	cmd.Flags().IntVar(&limit, "limit", 100, "Maximum number of events (up to 1000)")
+	cmd.Flags().IntVar(&offset, "offset", 0, "Number of events to skip")
+	cmd.Flags().BoolVar(&details, "details", false, "Show the details and changed fields of each event")
+
+	return cmd
+}
+
+// parseAuditTime takes an RFC 3339 time or a duration back from now
+func parseAuditTime(value string) (time.Time, error) {
+	if d, err := time.ParseDuration(value); err == nil {
+		return time.Now().Add(-d), nil
+	}
+	return time.Parse(time.RFC3339, value)
+}
+
+func orDash(value string) string {
+	if value == "" {
+		return "-"
+	}
+	return value
+}
+
+func sortedKeys[V any](m map[string]V) []string {
+	keys := make([]string, 0, len(m))
+	for key := range m {
+		keys = append(keys, key)
+	}
+	sort.Strings(keys)
+	return keys
+}
+
+func newAuditVerifyCmd() *cobra.Command {
+	var local bool
+
+	cmd := &cobra.Command{
+		Use:   "verify",
+		Short: "Verify the audit hash chain",
+		Long: `Check that no audit event was modified, removed or inserted since it was
+recorded. With --local the chain is read directly from the database (requires
+DATABASE_URL). Exits non-zero when the chain is broken.`,
+		RunE: func(cmd *cobra.Command, args []string) error {
+			var result *AuditVerification
+			if local {
+				db, err := localDatabase()
+				if err != nil {
+					return err
+				}
+				defer db.Close()
+
+				audit := services.NewAuditService(db, logrus.StandardLogger())
+				verification, err := audit.Verify(context.Background())
+				if err != nil {
+					return fmt.Errorf("failed to verify audit log: %w", err)
+				}
+				result = &AuditVerification{
+					Valid:     verification.Valid,
+					Events:    verification.Events,
+					Unchained: verification.Unchained,
+					LastHash:  verification.LastHash,
+					BrokenAt:  verification.BrokenAt,
+					Problem:   verification.Problem,
+				}
+			} else {
+				client, err := sessionClient()
+				if err != nil {
+					return err
+				}
+				result, err = client.VerifyAudit()
+				if err != nil {
+					return fmt.Errorf("failed to verify audit log: %w", err)
+				}
+			}
+
+			fmt.Printf("Chained events: %d\n", result.Events)
+			if result.Unchained > 0 {
+				fmt.Printf("Events recorded before the chain: %d (not verifiable)\n", result.Unchained)
+			}
+			if !result.Valid {
+				return fmt.Errorf("audit chain broken at event %d: %s", result.BrokenAt, result.Problem)
+			}
+			if result.LastHash != "" {
+				fmt.Printf("Last hash: %s\n", result.LastHash)
+			}
+			fmt.Println("Audit chain is intact")
+			return nil
+		},
+	}
+
+	cmd.Flags().BoolVar(&local, "local", false, "Read the audit log directly from the database (requires DATABASE_URL)")
+
+	return cmd
+}
+
 func NewConfigCmd() *cobra.Command {
 	cmd := &cobra.Command{
 		Use:   "config",
@@ -383,6 +1188,40 @@ func loadSession() (*SessionInfo, error) {
 	return session, nil
 }
 
+// localDatabase connects to the database in DATABASE_URL directly, for
+// admin tasks that cannot go through the API
+func localDatabase() (*database.GormDB, error) {
+	dbURL := viper.GetString("DATABASE_URL")
+	if dbURL == "" {
+		dbURL = os.Getenv("DATABASE_URL")
+		if dbURL == "" {
+			return nil, fmt.Errorf("DATABASE_URL environment variable not set")
+		}
+	}
+
+	dbConfig := database.DatabaseConfig{
+		Driver: "postgres",
+		DSN:    dbURL,
+	}
+
+	db, err := database.NewGormConnection(dbConfig)
+	if err != nil {
+		return nil, fmt.Errorf("failed to connect to database: %w", err)
+	}
+	return db, nil
+}
+
+// sessionClient returns a client authenticated with the saved session
+func sessionClient() (*Client, error) {
+	session, err := loadSession()
+	if err != nil {
+		return nil, err
+	}
+	client := NewClient(session.ServerURL)
+	client.SetToken(session.Token)
+	return client, nil
+}
+
 func init() {
 	viper.SetEnvPrefix("ORCA")
 	viper.AutomaticEnv()
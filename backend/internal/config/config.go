@@ -3,6 +3,7 @@ package config
 import (
 	"fmt"
 	"os"
+	"strings"
 
 	"github.com/spf13/viper"
 )
@@ -12,11 +13,20 @@ type Config struct {
 	Database DatabaseConfig
 	Session  SessionConfig
 	Log      LogConfig
+	Cluster  ClusterConfig
+	Certificates CertificatesConfig
+	Auth     AuthConfig
+	Audit    AuditConfig
 }
 
 type ServerConfig struct {
 	Port int
 	Host string
+
+	// Addresses or CIDRs of reverse proxies whose X-Forwarded-For and
+	// X-Real-IP headers give the client IP. Without any, the client IP is
+	// the address of the connection.
+	TrustedProxies []string
 }
 
 type DatabaseConfig struct {
@@ -32,6 +42,216 @@ type LogConfig struct {
 	Level string
 }
 
+type ClusterConfig struct {
+	Enabled        bool // share operation events with other replicas
+	LeaderLeaseTTL int  // in seconds
+}
+
+type CertificatesConfig struct {
+	ExpiryWarningDays   []int // warn as certificates come within each of these days of expiry
+	ExpiryCheckInterval int   // in minutes
+}
+
+type AuthConfig struct {
+	LocalLoginEnabled bool     // password login for every local account
+	BreakGlassUsers   []string // local accounts that may log in with a password when it is disabled
+	OIDC              OIDCConfig
+	LDAP              LDAPConfig
+	MFA               MFAConfig
+	Lockout           LockoutConfig
+	PasswordPolicy    PasswordPolicyConfig
+}
+
+type OIDCConfig struct {
+	Enabled           bool
+	IssuerURL         string
+	ClientID          string
+	ClientSecret      string // empty for a public client relying on PKCE alone
+	RedirectURL       string // e.g. https://orca.example.com/api/auth/oidc/callback
+	Scopes            []string
+	UsernameClaim     string
+	GroupsClaim       string
+	AdminGroups       []string // members are ORCA admins
+	GroupRoles        []GroupRoleMapping
+	PostLoginRedirect string // where the browser goes after login when no page was requested
+}
+
+type LDAPConfig struct {
+	Enabled           bool
+	URL               string // ldap://host:389 or ldaps://host:636
+	StartTLS          bool   // upgrade an ldap:// connection before binding
+	SkipTLSVerify     bool
+	BindDN            string // service account that searches for users, anonymous when empty
+	BindPassword      string
+	BaseDN            string
+	UserFilter        string // "{username}" is replaced by the escaped login name
+	UsernameAttribute string
+	EmailAttribute    string
+	IDAttribute       string   // stable identifier such as entryUUID or objectGUID, the DN when empty
+	GroupAttribute    string   // group DNs on the user entry, e.g. memberOf
+	GroupBaseDN       string   // also search groups here, for directories without memberOf
+	GroupFilter       string   // "{dn}" is replaced by the user's DN
+	AdminGroups       []string // group DNs whose members are ORCA admins
+	GroupRoles        []GroupRoleMapping
+	Timeout           int // in seconds
+}
+
+// MFAConfig configures TOTP second factors for password logins. Users enrol
+// by choice unless MFA is required for everyone or by one of their roles.
+type MFAConfig struct {
+	Required bool   // every password login needs a second factor
+	Issuer   string // shown in authenticator apps
+}
+
+// LockoutConfig throttles failed password logins per username and per
+// client IP. Each failure doubles the wait before the next attempt, and
+// reaching a threshold locks logins out for a while. Delays of a client IP
+// start after UsernameThreshold failures, more than one user can cause.
+type LockoutConfig struct {
+	Enabled           bool
+	UsernameThreshold int // failures before a username is locked out
+	IPThreshold       int // failures before a client IP is locked out
+	WindowMinutes     int // failures older than this are forgotten
+	LockoutMinutes    int
+	MaxDelaySeconds   int // longest wait between attempts before a lockout
+}
+
+// PasswordPolicyConfig sets the rules for passwords of local users
+type PasswordPolicyConfig struct {
+	MinLength        int    // in characters
+	MinClasses       int    // of lowercase letters, uppercase letters, digits and symbols
+	BreachedListFile string // one password, or SHA-1 hash in hex, per line
+	HistorySize      int    // previous passwords that cannot be reused, 0 allows reuse
+}
+
+// Validate checks that the policy can be enforced
+func (p PasswordPolicyConfig) Validate() error {
+	if p.MinLength < 1 {
+		return fmt.Errorf("minimum password length must be positive")
+	}
+	if p.MinClasses < 0 || p.MinClasses > 4 {
+		return fmt.Errorf("minimum password character classes must be between 0 and 4")
+	}
+	if p.HistorySize < 0 {
+		return fmt.Errorf("password history size must not be negative")
+	}
+	return nil
+}
+
+// LoadPasswordPolicy reads the password policy from the environment alone,
+// for tools that change passwords without the server configuration.
+func LoadPasswordPolicy() (PasswordPolicyConfig, error) {
+	setPasswordPolicyDefaults()
+	policy := PasswordPolicyConfig{
+		MinLength:        viper.GetInt("auth.passwordpolicy.minlength"),
+		MinClasses:       viper.GetInt("auth.passwordpolicy.minclasses"),
+		BreachedListFile: viper.GetString("auth.passwordpolicy.breachedlistfile"),
+		HistorySize:      viper.GetInt("auth.passwordpolicy.historysize"),
+	}
+	return policy, policy.Validate()
+}
+
+func setPasswordPolicyDefaults() {
+	viper.SetDefault("auth.passwordpolicy.minlength", 12)
+	viper.SetDefault("auth.passwordpolicy.minclasses", 3)
+	viper.SetDefault("auth.passwordpolicy.historysize", 5)
+	viper.BindEnv("auth.passwordpolicy.minlength", "AUTH_PASSWORD_MIN_LENGTH")
+	viper.BindEnv("auth.passwordpolicy.minclasses", "AUTH_PASSWORD_MIN_CLASSES")
+	viper.BindEnv("auth.passwordpolicy.breachedlistfile", "AUTH_PASSWORD_BREACHED_LIST_FILE")
+	viper.BindEnv("auth.passwordpolicy.historysize", "AUTH_PASSWORD_HISTORY_SIZE")
+}
+
+// AuditConfig forwards audit events and operation lifecycle events to a SIEM.
+// Each sink has its own queue, so a slow or unreachable sink delays neither
+// requests nor the other sinks.
+type AuditConfig struct {
+	Syslog       AuditSyslogConfig
+	File         AuditFileConfig
+	BufferSize   int // events queued per sink while it is unreachable, newer events are dropped
+	RetrySeconds int // wait before retrying a failed delivery, doubling up to a minute
+}
+
+// AuditSyslogConfig sends events as RFC 5424 syslog messages
+type AuditSyslogConfig struct {
+	Enabled       bool
+	Network       string // udp, tcp or tls
+	Address       string // host:port
+	Format        string // cef or leef
+	Facility      int    // 13 is "log audit"
+	CAFile        string // CAs trusted for tls, the system pool when empty
+	SkipTLSVerify bool
+	Hostname      string // sent as the origin of messages, the host name when empty
+}
+
+// AuditFileConfig appends events as JSON lines to a file
+type AuditFileConfig struct {
+	Enabled bool
+	Path    string
+}
+
+// Validate checks that the enabled sinks can be set up
+func (a AuditConfig) Validate() error {
+	if a.Syslog.Enabled {
+		switch a.Syslog.Network {
+		case "udp", "tcp", "tls":
+		default:
+			return fmt.Errorf("audit syslog network must be udp, tcp or tls")
+		}
+		if a.Syslog.Address == "" {
+			return fmt.Errorf("audit syslog address is required when syslog forwarding is enabled")
+		}
+		switch a.Syslog.Format {
+		case "cef", "leef":
+		default:
+			return fmt.Errorf("audit syslog format must be cef or leef")
+		}
+		if a.Syslog.Facility < 0 || a.Syslog.Facility > 23 {
+			return fmt.Errorf("audit syslog facility must be between 0 and 23")
+		}
+	}
+	if a.File.Enabled && a.File.Path == "" {
+		return fmt.Errorf("audit file path is required when file forwarding is enabled")
+	}
+	if a.BufferSize <= 0 {
+		return fmt.Errorf("audit buffer size must be positive")
+	}
+	if a.RetrySeconds <= 0 {
+		return fmt.Errorf("audit retry interval must be positive")
+	}
+	return nil
+}
+
+// GroupRoleMapping grants ORCA roles to members of an identity provider group
+type GroupRoleMapping struct {
+	Group string
+	Roles []string // role names
+}
+
+// ParseGroupRoles parses mappings of the form "group=role|role;group=role".
+// A group is separated from its roles by the last "=", so that LDAP DNs can
+// be used as groups.
+func ParseGroupRoles(value string) ([]GroupRoleMapping, error) {
+	var mappings []GroupRoleMapping
+	for _, entry := range strings.Split(value, ";") {
+		entry = strings.TrimSpace(entry)
+		if entry == "" {
+			continue
+		}
+		i := strings.LastIndex(entry, "=")
+		if i <= 0 || i == len(entry)-1 {
+			return nil, fmt.Errorf("invalid group role mapping %q", entry)
+		}
+		mapping := GroupRoleMapping{Group: strings.TrimSpace(entry[:i])}
+		for _, role := range strings.Split(entry[i+1:], "|") {
+			if role = strings.TrimSpace(role); role != "" {
+				mapping.Roles = append(mapping.Roles, role)
+			}
+		}
+		mappings = append(mappings, mapping)
+	}
+	return mappings, nil
+}
+
 func Load() (*Config, error) {
 	viper.SetConfigName("config")
 	viper.SetConfigType("yaml")
@@ -46,12 +266,98 @@ func Load() (*Config, error) {
 	viper.SetDefault("server.host", "0.0.0.0")
 	viper.SetDefault("session.sessiontimeout", 1440) // 24 hours
 	viper.SetDefault("log.level", "info")
+	viper.SetDefault("cluster.enabled", false)
+	viper.SetDefault("cluster.leaderleasettl", 30)
+	viper.SetDefault("certificates.expirywarningdays", []int{60, 30, 7})
+	viper.SetDefault("certificates.expirycheckinterval", 360) // 6 hours
+	viper.SetDefault("auth.localloginenabled", true)
+	viper.SetDefault("auth.breakglassusers", []string{"admin"})
+	viper.SetDefault("auth.oidc.enabled", false)
+	viper.SetDefault("auth.oidc.scopes", []string{"openid", "profile", "email", "groups"})
+	viper.SetDefault("auth.oidc.usernameclaim", "preferred_username")
+	viper.SetDefault("auth.oidc.groupsclaim", "groups")
+	viper.SetDefault("auth.oidc.postloginredirect", "/")
+	viper.SetDefault("auth.ldap.enabled", false)
+	viper.SetDefault("auth.ldap.userfilter", "(&(objectClass=person)(uid={username}))")
+	viper.SetDefault("auth.ldap.usernameattribute", "uid")
+	viper.SetDefault("auth.ldap.emailattribute", "mail")
+	viper.SetDefault("auth.ldap.groupattribute", "memberOf")
+	viper.SetDefault("auth.ldap.groupfilter", "(member={dn})")
+	viper.SetDefault("auth.ldap.timeout", 10)
+	viper.SetDefault("auth.mfa.required", false)
+	viper.SetDefault("auth.mfa.issuer", "ORCA")
+	viper.SetDefault("auth.lockout.enabled", true)
+	viper.SetDefault("auth.lockout.usernamethreshold", 5)
+	viper.SetDefault("auth.lockout.ipthreshold", 50)
+	viper.SetDefault("auth.lockout.windowminutes", 15)
+	viper.SetDefault("auth.lockout.lockoutminutes", 15)
+	viper.SetDefault("auth.lockout.maxdelayseconds", 30)
+	viper.SetDefault("audit.syslog.enabled", false)
+	viper.SetDefault("audit.syslog.network", "tls")
+	viper.SetDefault("audit.syslog.format", "cef")
+	viper.SetDefault("audit.syslog.facility", 13)
+	viper.SetDefault("audit.file.enabled", false)
+	viper.SetDefault("audit.buffersize", 10000)
+	viper.SetDefault("audit.retryseconds", 5)
 
 	// Override with environment variables
+	viper.BindEnv("server.trustedproxies", "TRUSTED_PROXIES") // e.g. "10.0.0.0/8,192.0.2.10"
 	viper.BindEnv("database.url", "DATABASE_URL")
 	viper.BindEnv("session.secret", "SESSION_SECRET")
 	viper.BindEnv("session.sessiontimeout", "SESSION_TIMEOUT")
 	viper.BindEnv("log.level", "LOG_LEVEL")
+	viper.BindEnv("cluster.enabled", "CLUSTER_ENABLED")
+	viper.BindEnv("cluster.leaderleasettl", "CLUSTER_LEADER_LEASE_TTL")
+	viper.BindEnv("certificates.expirywarningdays", "CERT_EXPIRY_WARNING_DAYS") // e.g. "60,30,7"
+	viper.BindEnv("certificates.expirycheckinterval", "CERT_EXPIRY_CHECK_INTERVAL")
+	viper.BindEnv("auth.localloginenabled", "AUTH_LOCAL_LOGIN_ENABLED")
+	viper.BindEnv("auth.breakglassusers", "AUTH_BREAK_GLASS_USERS") // e.g. "admin,root"
+	viper.BindEnv("auth.oidc.enabled", "OIDC_ENABLED")
+	viper.BindEnv("auth.oidc.issuerurl", "OIDC_ISSUER_URL")
+	viper.BindEnv("auth.oidc.clientid", "OIDC_CLIENT_ID")
+	viper.BindEnv("auth.oidc.clientsecret", "OIDC_CLIENT_SECRET")
+	viper.BindEnv("auth.oidc.redirecturl", "OIDC_REDIRECT_URL")
+	viper.BindEnv("auth.oidc.scopes", "OIDC_SCOPES")
+	viper.BindEnv("auth.oidc.usernameclaim", "OIDC_USERNAME_CLAIM")
+	viper.BindEnv("auth.oidc.groupsclaim", "OIDC_GROUPS_CLAIM")
+	viper.BindEnv("auth.oidc.admingroups", "OIDC_ADMIN_GROUPS")
+	viper.BindEnv("auth.oidc.postloginredirect", "OIDC_POST_LOGIN_REDIRECT")
+	viper.BindEnv("auth.ldap.enabled", "LDAP_ENABLED")
+	viper.BindEnv("auth.ldap.url", "LDAP_URL")
+	viper.BindEnv("auth.ldap.starttls", "LDAP_START_TLS")
+	viper.BindEnv("auth.ldap.skiptlsverify", "LDAP_SKIP_TLS_VERIFY")
+	viper.BindEnv("auth.ldap.binddn", "LDAP_BIND_DN")
+	viper.BindEnv("auth.ldap.bindpassword", "LDAP_BIND_PASSWORD")
+	viper.BindEnv("auth.ldap.basedn", "LDAP_BASE_DN")
+	viper.BindEnv("auth.ldap.userfilter", "LDAP_USER_FILTER")
+	viper.BindEnv("auth.ldap.usernameattribute", "LDAP_USERNAME_ATTRIBUTE")
+	viper.BindEnv("auth.ldap.emailattribute", "LDAP_EMAIL_ATTRIBUTE")
+	viper.BindEnv("auth.ldap.idattribute", "LDAP_ID_ATTRIBUTE")
+	viper.BindEnv("auth.ldap.groupattribute", "LDAP_GROUP_ATTRIBUTE")
+	viper.BindEnv("auth.ldap.groupbasedn", "LDAP_GROUP_BASE_DN")
+	viper.BindEnv("auth.ldap.groupfilter", "LDAP_GROUP_FILTER")
+	viper.BindEnv("auth.ldap.timeout", "LDAP_TIMEOUT")
+	viper.BindEnv("auth.mfa.required", "AUTH_MFA_REQUIRED")
+	viper.BindEnv("auth.mfa.issuer", "AUTH_MFA_ISSUER")
+	viper.BindEnv("auth.lockout.enabled", "AUTH_LOCKOUT_ENABLED")
+	viper.BindEnv("auth.lockout.usernamethreshold", "AUTH_LOCKOUT_USERNAME_THRESHOLD")
+	viper.BindEnv("auth.lockout.ipthreshold", "AUTH_LOCKOUT_IP_THRESHOLD")
+	viper.BindEnv("auth.lockout.windowminutes", "AUTH_LOCKOUT_WINDOW_MINUTES")
+	viper.BindEnv("auth.lockout.lockoutminutes", "AUTH_LOCKOUT_MINUTES")
+	viper.BindEnv("auth.lockout.maxdelayseconds", "AUTH_LOCKOUT_MAX_DELAY_SECONDS")
+	viper.BindEnv("audit.syslog.enabled", "AUDIT_SYSLOG_ENABLED")
+	viper.BindEnv("audit.syslog.network", "AUDIT_SYSLOG_NETWORK")
+	viper.BindEnv("audit.syslog.address", "AUDIT_SYSLOG_ADDRESS")
+	viper.BindEnv("audit.syslog.format", "AUDIT_SYSLOG_FORMAT")
+	viper.BindEnv("audit.syslog.facility", "AUDIT_SYSLOG_FACILITY")
+	viper.BindEnv("audit.syslog.cafile", "AUDIT_SYSLOG_CA_FILE")
+	viper.BindEnv("audit.syslog.skiptlsverify", "AUDIT_SYSLOG_SKIP_TLS_VERIFY")
+	viper.BindEnv("audit.syslog.hostname", "AUDIT_SYSLOG_HOSTNAME")
+	viper.BindEnv("audit.file.enabled", "AUDIT_FILE_ENABLED")
+	viper.BindEnv("audit.file.path", "AUDIT_FILE_PATH")
+	viper.BindEnv("audit.buffersize", "AUDIT_BUFFER_SIZE")
+	viper.BindEnv("audit.retryseconds", "AUDIT_RETRY_SECONDS")
+	setPasswordPolicyDefaults()
 
 	if err := viper.ReadInConfig(); err != nil {
 		if _, ok := err.(viper.ConfigFileNotFoundError); !ok {
@@ -79,5 +385,77 @@ func Load() (*Config, error) {
 		}
 	}
 
+	for _, days := range config.Certificates.ExpiryWarningDays {
+		if days <= 0 {
+			return nil, fmt.Errorf("certificate expiry warning days must be positive")
+		}
+	}
+	if config.Certificates.ExpiryCheckInterval <= 0 {
+		return nil, fmt.Errorf("certificate expiry check interval must be positive")
+	}
+	if lockout := config.Auth.Lockout; lockout.Enabled {
+		if lockout.UsernameThreshold <= 0 || lockout.IPThreshold <= 0 {
+			return nil, fmt.Errorf("login lockout thresholds must be positive")
+		}
+		if lockout.WindowMinutes <= 0 || lockout.LockoutMinutes <= 0 || lockout.MaxDelaySeconds < 0 {
+			return nil, fmt.Errorf("login lockout durations must be positive")
+		}
+	}
+	if err := config.Auth.PasswordPolicy.Validate(); err != nil {
+		return nil, err
+	}
+	if err := config.Audit.Validate(); err != nil {
+		return nil, err
+	}
+
+	// Group mappings from the environment, e.g. "orca-ops=operator|viewer"
+	if value := os.Getenv("OIDC_GROUP_ROLES"); value != "" {
+		mappings, err := ParseGroupRoles(value)
+		if err != nil {
+			return nil, err
+		}
+		config.Auth.OIDC.GroupRoles = mappings
+	}
+
+	// Group DNs contain commas, so LDAP group lists are separated by ";"
+	if value := os.Getenv("LDAP_ADMIN_GROUPS"); value != "" {
+		config.Auth.LDAP.AdminGroups = nil
+		for _, group := range strings.Split(value, ";") {
+			if group = strings.TrimSpace(group); group != "" {
+				config.Auth.LDAP.AdminGroups = append(config.Auth.LDAP.AdminGroups, group)
+			}
+		}
+	}
+	if value := os.Getenv("LDAP_GROUP_ROLES"); value != "" {
+		mappings, err := ParseGroupRoles(value)
+		if err != nil {
+			return nil, err
+		}
+		config.Auth.LDAP.GroupRoles = mappings
+	}
+
+	if config.Auth.OIDC.Enabled {
+		oidc := config.Auth.OIDC
+		if oidc.IssuerURL == "" || oidc.ClientID == "" || oidc.RedirectURL == "" {
+			return nil, fmt.Errorf("OIDC issuer URL, client ID and redirect URL are required when OIDC is enabled")
+		}
+	}
+
+	if config.Auth.LDAP.Enabled {
+		ldap := config.Auth.LDAP
+		if ldap.URL == "" || ldap.BaseDN == "" {
+			return nil, fmt.Errorf("LDAP URL and base DN are required when LDAP is enabled")
+		}
+		if !strings.Contains(ldap.UserFilter, "{username}") {
+			return nil, fmt.Errorf("LDAP user filter must contain {username}")
+		}
+		if ldap.StartTLS && strings.HasPrefix(strings.ToLower(ldap.URL), "ldaps://") {
+			return nil, fmt.Errorf("LDAP StartTLS cannot be used with an ldaps:// URL")
+		}
+		if ldap.Timeout <= 0 {
+			return nil, fmt.Errorf("LDAP timeout must be positive")
+		}
+	}
+
 	return &config, nil
 }
\ No newline at end of file
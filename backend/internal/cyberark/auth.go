@@ -0,0 +1,138 @@
+package cyberark
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net/http"
+)
+
+// AuthMethod selects the PVWA logon endpoint
+type AuthMethod string
+
+const (
+	AuthMethodCyberArk AuthMethod = "cyberark"
+	AuthMethodLDAP     AuthMethod = "ldap"
+	AuthMethodRADIUS   AuthMethod = "radius"
+	// AuthMethodWindows sends the credentials with HTTP basic authentication,
+	// so IIS on the PVWA must accept basic authentication for the Windows
+	// logon endpoint
+	AuthMethodWindows AuthMethod = "windows"
+	// AuthMethodPKI logs on with the client certificate; no password is
+	// needed
+	AuthMethodPKI AuthMethod = "pki"
+)
+
+// AuthMethods lists the supported authentication methods
+var AuthMethods = []AuthMethod{AuthMethodCyberArk, AuthMethodLDAP, AuthMethodRADIUS, AuthMethodWindows, AuthMethodPKI}
+
+// ParseAuthMethod validates an authentication method name. An empty name is
+// the built-in CyberArk method.
+func ParseAuthMethod(name string) (AuthMethod, error) {
+	if name == "" {
+		return AuthMethodCyberArk, nil
+	}
+	for _, m := range AuthMethods {
+		if AuthMethod(name) == m {
+			return m, nil
+		}
+	}
+	return "", fmt.Errorf("unsupported authentication method %q", name)
+}
+
+// logonPath returns the logon endpoint for the method
+func (m AuthMethod) logonPath() string {
+	switch m {
+	case AuthMethodLDAP:
+		return "/API/auth/LDAP/Logon"
+	case AuthMethodRADIUS:
+		return "/API/auth/RADIUS/Logon"
+	case AuthMethodWindows:
+		return "/API/auth/Windows/Logon"
+	case AuthMethodPKI:
+		return "/API/auth/pki/Logon"
+	default:
+		return "/API/auth/Cyberark/Logon"
+	}
+}
+
+// ErrCodeRadiusChallenge is returned by the RADIUS logon when the RADIUS
+// server asks for a further response, such as a one-time password
+const ErrCodeRadiusChallenge = "ITATS542I"
+
+// maxChallenges bounds the rounds of a RADIUS challenge/response logon
+const maxChallenges = 3
+
+// ChallengeResponder answers a RADIUS challenge. It receives the message
+// shown by the RADIUS server and returns the response to send.
+type ChallengeResponder func(ctx context.Context, challenge string) (string, error)
+
+// StaticChallengeResponse answers the first challenge with the given
+// response, for a one-time password entered before the logon
+func StaticChallengeResponse(response string) ChallengeResponder {
+	used := false
+	return func(ctx context.Context, challenge string) (string, error) {
+		if used {
+			return "", &ChallengeError{Challenge: challenge}
+		}
+		used = true
+		return response, nil
+	}
+}
+
+// ErrChallengeRequired is returned when a RADIUS logon needs a response that
+// the client cannot give
+var ErrChallengeRequired = errors.New("RADIUS challenge requires a response")
+
+// ChallengeError carries the challenge of a RADIUS logon that could not be
+// answered
+type ChallengeError struct {
+	Challenge string
+}
+
+func (e *ChallengeError) Error() string {
+	if e.Challenge == "" {
+		return ErrChallengeRequired.Error()
+	}
+	return fmt.Sprintf("%s: %s", ErrChallengeRequired, e.Challenge)
+}
+
+func (e *ChallengeError) Is(target error) bool {
+	return target == ErrChallengeRequired
+}
+
+// LogonOptions controls how the client logs on
+type LogonOptions struct {
+	Method AuthMethod
+
+	// Let the user hold other PVWA sessions at the same time
+	ConcurrentSession bool
+
+	// Answers RADIUS challenges; without one a challenge fails the logon
+	// with a ChallengeError
+	ChallengeResponder ChallengeResponder
+}
+
+// logonRequest is the body of a logon request
+type logonRequest struct {
+	Username          string `json:"username"`
+	Password          string `json:"password"`
+	ConcurrentSession bool   `json:"concurrentSession,omitempty"`
+}
+
+// radiusChallenge returns the challenge message if a failed logon response
+// is a RADIUS challenge
+func radiusChallenge(apiErr *APIError) (string, bool) {
+	if apiErr.ErrorCode != ErrCodeRadiusChallenge {
+		return "", false
+	}
+	return apiErr.ErrorMessage, true
+}
+
+// carryCookies copies the cookies set by a challenge response to the next
+// logon request, as the PVWA keeps the state of the challenge in its session
+func carryCookies(req *http.Request, cookies []*http.Cookie) {
+	for _, cookie := range cookies {
+		req.AddCookie(cookie)
+	}
+}
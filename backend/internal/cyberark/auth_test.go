@@ -0,0 +1,155 @@
+package cyberark_test
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/orca-ng/orca/internal/cyberark"
+)
+
+// logonBody is what the client posts to a logon endpoint
+type logonBody struct {
+	Username          string `json:"username"`
+	Password          string `json:"password"`
+	ConcurrentSession bool   `json:"concurrentSession"`
+}
+
+func TestLogonUsesConfiguredMethod(t *testing.T) {
+	tests := []struct {
+		method cyberark.AuthMethod
+		path   string
+	}{
+		{"", "/API/auth/Cyberark/Logon"},
+		{cyberark.AuthMethodCyberArk, "/API/auth/Cyberark/Logon"},
+		{cyberark.AuthMethodLDAP, "/API/auth/LDAP/Logon"},
+		{cyberark.AuthMethodRADIUS, "/API/auth/RADIUS/Logon"},
+		{cyberark.AuthMethodWindows, "/API/auth/Windows/Logon"},
+	}
+
+	for _, tt := range tests {
+		t.Run(string(tt.method), func(t *testing.T) {
+			var path string
+			var body logonBody
+			var basicUser, basicPassword string
+			server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+				path = r.URL.Path
+				basicUser, basicPassword, _ = r.BasicAuth()
+				require.NoError(t, json.NewDecoder(r.Body).Decode(&body))
+				fmt.Fprint(w, `"token"`)
+			}))
+			defer server.Close()
+
+			client, err := cyberark.NewClient(cyberark.Config{
+				BaseURL:  server.URL,
+				Username: "svc_orca",
+				Password: "secret",
+				Logon:    cyberark.LogonOptions{Method: tt.method, ConcurrentSession: true},
+			})
+			require.NoError(t, err)
+
+			token, err := client.Authenticate()
+			require.NoError(t, err)
+			assert.Equal(t, "token", token)
+			assert.Equal(t, tt.path, path)
+			assert.Equal(t, logonBody{Username: "svc_orca", Password: "secret", ConcurrentSession: true}, body)
+
+			if tt.method == cyberark.AuthMethodWindows {
+				assert.Equal(t, "svc_orca", basicUser)
+				assert.Equal(t, "secret", basicPassword)
+			} else {
+				assert.Empty(t, basicUser)
+			}
+		})
+	}
+}
+
+// radiusVault challenges the first logon for a one-time password and keeps
+// the state of the challenge in a session cookie
+func radiusVault(t *testing.T, otp string) *httptest.Server {
+	return httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		require.Equal(t, "/API/auth/RADIUS/Logon", r.URL.Path)
+		var body logonBody
+		require.NoError(t, json.NewDecoder(r.Body).Decode(&body))
+
+		cookie, err := r.Cookie("ASP.NET_SessionId")
+		switch {
+		case err != nil && body.Password == "secret":
+			http.SetCookie(w, &http.Cookie{Name: "ASP.NET_SessionId", Value: "challenge-1"})
+			w.WriteHeader(http.StatusInternalServerError)
+			fmt.Fprint(w, `{"ErrorCode": "ITATS542I", "ErrorMessage": "Enter PASSCODE"}`)
+		case err == nil && cookie.Value == "challenge-1" && body.Password == otp:
+			fmt.Fprint(w, `"radius-token"`)
+		default:
+			w.WriteHeader(http.StatusUnauthorized)
+			fmt.Fprint(w, `{"ErrorCode": "PASWS013E", "ErrorMessage": "Authentication failure."}`)
+		}
+	}))
+}
+
+func TestRadiusChallengeResponse(t *testing.T) {
+	server := radiusVault(t, "123456")
+	defer server.Close()
+
+	var challenges []string
+	client, err := cyberark.NewClient(cyberark.Config{
+		BaseURL:  server.URL,
+		Username: "svc_orca",
+		Password: "secret",
+		Logon: cyberark.LogonOptions{
+			Method: cyberark.AuthMethodRADIUS,
+			ChallengeResponder: func(ctx context.Context, challenge string) (string, error) {
+				challenges = append(challenges, challenge)
+				return "123456", nil
+			},
+		},
+	})
+	require.NoError(t, err)
+
+	token, err := client.Authenticate()
+	require.NoError(t, err)
+	assert.Equal(t, "radius-token", token)
+	assert.Equal(t, []string{"Enter PASSCODE"}, challenges)
+}
+
+func TestRadiusChallengeWithoutResponder(t *testing.T) {
+	server := radiusVault(t, "123456")
+	defer server.Close()
+
+	client := cyberark.NewClientWithTLSConfig(server.URL, "svc_orca", "secret", false)
+	client.SetLogonOptions(cyberark.LogonOptions{Method: cyberark.AuthMethodRADIUS})
+
+	_, err := client.Authenticate()
+	assert.ErrorIs(t, err, cyberark.ErrChallengeRequired)
+	var challengeErr *cyberark.ChallengeError
+	require.True(t, errors.As(err, &challengeErr))
+	assert.Equal(t, "Enter PASSCODE", challengeErr.Challenge)
+
+	// A wrong one-time password is rejected by the vault
+	client.SetLogonOptions(cyberark.LogonOptions{
+		Method:             cyberark.AuthMethodRADIUS,
+		ChallengeResponder: cyberark.StaticChallengeResponse("000000"),
+	})
+	_, err = client.Authenticate()
+	assert.True(t, cyberark.HasErrorCode(err, cyberark.ErrCodeAuthenticationFailure))
+}
+
+func TestParseAuthMethod(t *testing.T) {
+	method, err := cyberark.ParseAuthMethod("")
+	require.NoError(t, err)
+	assert.Equal(t, cyberark.AuthMethodCyberArk, method)
+
+	method, err = cyberark.ParseAuthMethod("ldap")
+	require.NoError(t, err)
+	assert.Equal(t, cyberark.AuthMethodLDAP, method)
+
+	_, err = cyberark.ParseAuthMethod("saml")
+	assert.Error(t, err)
+}
@@ -10,8 +10,10 @@ import (
 	"net/http"
 	"net/url"
 	"strings"
+	"sync"
 	"time"
 	
+	gormmodels "github.com/orca-ng/orca/internal/models/gorm"
 	"github.com/orca-ng/orca/internal/services"
 )
 
@@ -26,6 +28,28 @@ type Config struct {
 	SkipTLSVerify  bool
 	RequestTimeout time.Duration
 	CertManager    *services.CertificateManager
+	
+	// Certificate presented to the PVWA or a reverse proxy in front of it
+	// (optional)
+	ClientCertificate *services.ClientCertificate
+	
+	// Certificate authorities the PVWA's chain must lead to and fingerprints
+	// it must match (optional). Both need CertManager.
+	TrustedCAIDs []string
+	Pins         []gormmodels.CertificatePin
+	
+	// Rate limits and circuit breaker shared with other clients for the
+	// same instance (optional)
+	Guard *Guard
+	
+	// Authentication method and logon flags; the zero value logs on with
+	// the built-in CyberArk method
+	Logon LogonOptions
+	
+	// Privilege Cloud tenants take an OAuth token from IdentityURL instead
+	// of a PVWA logon; Username and Password are the client ID and secret
+	Type        InstanceType
+	IdentityURL string
 }
 
 // Client represents a CyberArk API client
@@ -35,9 +59,21 @@ type Client struct {
 	password          string
 	httpClient        *http.Client
 	httpClientFactory HTTPClientFactory
-	token             string
 	skipTLSVerify     bool
 	certManager       *services.CertificateManager
+	guard             *Guard
+	logonOptions      LogonOptions
+	instanceType      InstanceType
+	identityURL       string
+
+	// Session token and when it was issued and last accepted. Logons are
+	// serialized so that concurrent callers share one token.
+	token          string
+	tokenIssuedAt  time.Time
+	tokenExpiresAt time.Time // zero if the vault did not say
+	lastUsed       time.Time
+	tokenMutex    sync.RWMutex
+	logonMutex    sync.Mutex
 }
 
 // NewClient creates a new CyberArk client with configuration
@@ -49,6 +85,11 @@ func NewClient(cfg Config) (*Client, error) {
 	if err := ValidateURL(cfg.BaseURL); err != nil {
 		return nil, err
 	}
+	if cfg.Type == InstanceTypePrivilegeCloud {
+		if err := ValidateURL(cfg.IdentityURL); err != nil {
+			return nil, fmt.Errorf("identity URL: %w", err)
+		}
+	}
 	
 	// Default timeout
 	if cfg.RequestTimeout == 0 {
@@ -61,16 +102,30 @@ func NewClient(cfg Config) (*Client, error) {
 	}
 	
 	// Configure TLS
-	if cfg.SkipTLSVerify || cfg.CertManager != nil {
+	if cfg.CertManager != nil {
+		tlsConfig, err := cfg.CertManager.GetInstanceTLSConfig(context.Background(), services.TLSOptions{
+			SkipTLSVerify:     cfg.SkipTLSVerify,
+			ClientCertificate: cfg.ClientCertificate,
+			TrustedCAIDs:      cfg.TrustedCAIDs,
+			Pins:              cfg.Pins,
+		})
+		if err != nil {
+			return nil, fmt.Errorf("failed to configure TLS: %w", err)
+		}
+		httpClient.Transport = &http.Transport{
+			TLSClientConfig: tlsConfig,
+		}
+	} else if cfg.SkipTLSVerify || cfg.ClientCertificate != nil || len(cfg.Pins) > 0 {
 		tlsConfig := &tls.Config{
 			InsecureSkipVerify: cfg.SkipTLSVerify,
 		}
-		
-		// Add custom CA if certificate manager is provided
-		if cfg.CertManager != nil {
-			pool, err := cfg.CertManager.GetCertPool(context.Background())
-			if err == nil && pool != nil {
-				tlsConfig.RootCAs = pool
+		if cfg.ClientCertificate != nil {
+			tlsConfig.Certificates = []tls.Certificate{cfg.ClientCertificate.KeyPair}
+		}
+		if len(cfg.Pins) > 0 {
+			pins := cfg.Pins
+			tlsConfig.VerifyConnection = func(state tls.ConnectionState) error {
+				return services.VerifyPins(state.PeerCertificates, pins)
 			}
 		}
 		
@@ -80,12 +135,16 @@ func NewClient(cfg Config) (*Client, error) {
 	}
 	
 	return &Client{
-		baseURL:       cfg.BaseURL,
+		baseURL:       apiBaseURL(cfg.BaseURL, cfg.Type),
 		username:      cfg.Username,
 		password:      cfg.Password,
 		httpClient:    httpClient,
 		skipTLSVerify: cfg.SkipTLSVerify,
 		certManager:   cfg.CertManager,
+		guard:         cfg.Guard,
+		logonOptions:  cfg.Logon,
+		instanceType:  cfg.Type,
+		identityURL:   strings.TrimRight(cfg.IdentityURL, "/"),
 	}, nil
 }
 
@@ -129,6 +188,13 @@ func NewClientWithHTTPClientFactory(baseURL, username, password string, factory
 	}
 }
 
+// SetLogonOptions changes how the client logs on from the next logon
+func (c *Client) SetLogonOptions(opts LogonOptions) {
+	c.logonMutex.Lock()
+	defer c.logonMutex.Unlock()
+	c.logonOptions = opts
+}
+
 // Authenticate authenticates with CyberArk and returns the session token
 func (c *Client) Authenticate() (string, error) {
 	return c.AuthenticateWithContext(context.Background())
@@ -136,49 +202,103 @@ func (c *Client) Authenticate() (string, error) {
 
 // AuthenticateWithContext authenticates with CyberArk using the provided context
 func (c *Client) AuthenticateWithContext(ctx context.Context) (string, error) {
-	// Prepare the authentication request
-	authURL := fmt.Sprintf("%s/API/auth/Cyberark/Logon", c.baseURL)
+	c.logonMutex.Lock()
+	defer c.logonMutex.Unlock()
+	
+	return c.logon(ctx)
+}
+
+// logon requests a new session token with the configured authentication
+// method, answering RADIUS challenges if a responder is set. Callers hold
+// logonMutex.
+func (c *Client) logon(ctx context.Context) (string, error) {
+	if c.privilegeCloud() {
+		return c.oauthLogon(ctx)
+	}
 	
-	payload := map[string]string{
-		"username": c.username,
-		"password": c.password,
+	method := c.logonOptions.Method
+	if method == "" {
+		method = AuthMethodCyberArk
+	}
+	
+	password := c.password
+	var cookies []*http.Cookie
+	for round := 0; ; round++ {
+		resp, err := c.sendLogon(ctx, method, password, cookies)
+		if err != nil {
+			return "", err
+		}
+		if resp.StatusCode == http.StatusOK {
+			defer resp.Body.Close()
+			return c.readToken(resp)
+		}
+		
+		apiErr := logonError(resp)
+		resp.Body.Close()
+		
+		challenge, ok := radiusChallenge(apiErr)
+		if !ok || method != AuthMethodRADIUS {
+			return "", apiErr
+		}
+		if c.logonOptions.ChallengeResponder == nil || round >= maxChallenges {
+			return "", &ChallengeError{Challenge: challenge}
+		}
+		
+		password, err = c.logonOptions.ChallengeResponder(ctx, challenge)
+		if err != nil {
+			return "", fmt.Errorf("answer RADIUS challenge: %w", err)
+		}
+		cookies = resp.Cookies()
+	}
+}
+
+// sendLogon posts the credentials to the logon endpoint of the method
+func (c *Client) sendLogon(ctx context.Context, method AuthMethod, password string, cookies []*http.Cookie) (*http.Response, error) {
+	payload := logonRequest{
+		Username:          c.username,
+		Password:          password,
+		ConcurrentSession: c.logonOptions.ConcurrentSession,
 	}
 	
 	jsonData, err := json.Marshal(payload)
 	if err != nil {
-		return "", fmt.Errorf("failed to marshal auth payload: %w", err)
+		return nil, fmt.Errorf("failed to marshal auth payload: %w", err)
 	}
 	
-	req, err := http.NewRequestWithContext(ctx, "POST", authURL, bytes.NewReader(jsonData))
+	req, err := http.NewRequestWithContext(ctx, "POST", c.baseURL+method.logonPath(), bytes.NewReader(jsonData))
 	if err != nil {
-		return "", fmt.Errorf("failed to create request: %w", err)
+		return nil, fmt.Errorf("failed to create request: %w", err)
 	}
 	
 	req.Header.Set("Content-Type", "application/json")
+	if method == AuthMethodWindows {
+		req.SetBasicAuth(c.username, password)
+	}
+	carryCookies(req, cookies)
 	
-	// Get HTTP client
-	httpClient := c.getHTTPClient()
-	
-	resp, err := httpClient.Do(req)
+	resp, err := c.roundTrip(req)
 	if err != nil {
-		return "", fmt.Errorf("failed to connect to CyberArk: %w", err)
+		return nil, fmt.Errorf("failed to connect to CyberArk: %w", err)
 	}
-	defer resp.Body.Close()
-	
-	// Check the response
-	if resp.StatusCode != http.StatusOK {
-		switch resp.StatusCode {
-		case http.StatusUnauthorized:
-			return "", fmt.Errorf("authentication failed: invalid username or password")
-		case http.StatusForbidden:
-			return "", fmt.Errorf("authentication failed: user is not authorized")
-		case http.StatusNotFound:
-			return "", fmt.Errorf("invalid CyberArk URL or API endpoint not found")
-		default:
-			return "", fmt.Errorf("authentication failed with status code: %d", resp.StatusCode)
-		}
+	return resp, nil
+}
+
+// logonError converts a failed logon response to an API error
+func logonError(resp *http.Response) *APIError {
+	switch resp.StatusCode {
+	case http.StatusUnauthorized:
+		return newAPIError(resp, "authentication failed: invalid username or password")
+	case http.StatusForbidden:
+		return newAPIError(resp, "authentication failed: user is not authorized")
+	case http.StatusNotFound:
+		return newAPIError(resp, "invalid CyberArk URL or API endpoint not found")
+	default:
+		return newAPIError(resp, "authentication failed")
 	}
-	
+}
+
+// readToken parses the token from a successful logon response
+func (c *Client) readToken(resp *http.Response) (string, error) {
 	// Parse the response to get the token
 	// CyberArk v10+ returns just a string token, older versions return JSON object
 	bodyBytes, err := io.ReadAll(resp.Body)
@@ -193,7 +313,7 @@ func (c *Client) AuthenticateWithContext(ctx context.Context) (string, error) {
 	if strings.HasPrefix(bodyStr, "\"") && strings.HasSuffix(bodyStr, "\"") {
 		token := strings.Trim(bodyStr, "\"")
 		if token != "" {
-			c.token = token
+			c.setToken(token)
 			return token, nil
 		}
 	}
@@ -204,7 +324,7 @@ func (c *Client) AuthenticateWithContext(ctx context.Context) (string, error) {
 		// If it's not JSON, treat the whole response as the token
 		token := strings.TrimSpace(bodyStr)
 		if token != "" {
-			c.token = token
+			c.setToken(token)
 			return token, nil
 		}
 		return "", fmt.Errorf("failed to parse auth response: %w", err)
@@ -213,7 +333,7 @@ func (c *Client) AuthenticateWithContext(ctx context.Context) (string, error) {
 	// Look for token in JSON response
 	if tokenRaw, ok := authResp["CyberArkLogonResult"]; ok {
 		if token, ok := tokenRaw.(string); ok && token != "" {
-			c.token = token
+			c.setToken(token)
 			return token, nil
 		}
 	}
@@ -235,7 +355,7 @@ func (c *Client) TestConnection(ctx context.Context) (bool, string, error) {
 	responseTime := time.Since(startTime).Milliseconds()
 	
 	// Log off immediately after successful test
-	c.token = token
+	c.setToken(token)
 	if err := c.LogoffWithContext(ctx); err != nil {
 		// Log warning but don't fail the test
 		// This would normally be logged by the logger if we had one
@@ -252,7 +372,14 @@ func (c *Client) Logoff() error {
 
 // LogoffWithContext logs off from CyberArk using the provided context
 func (c *Client) LogoffWithContext(ctx context.Context) error {
-	if c.token == "" {
+	token := c.GetToken()
+	if token == "" {
+		return nil
+	}
+	
+	// OAuth tokens simply expire
+	if c.privilegeCloud() {
+		c.setToken("")
 		return nil
 	}
 	
@@ -263,34 +390,114 @@ func (c *Client) LogoffWithContext(ctx context.Context) error {
 		return fmt.Errorf("failed to create logoff request: %w", err)
 	}
 	
-	req.Header.Set("Authorization", c.token)
-	
-	// Get HTTP client
-	httpClient := c.getHTTPClient()
+	req.Header.Set("Authorization", token)
 	
-	resp, err := httpClient.Do(req)
+	resp, err := c.roundTrip(req)
 	if err != nil {
 		return fmt.Errorf("failed to logoff: %w", err)
 	}
 	defer resp.Body.Close()
 	
-	c.token = ""
+	// The token is unusable either way
+	c.setToken("")
+	
+	if resp.StatusCode != http.StatusOK {
+		return newAPIError(resp, "logoff failed")
+	}
 	return nil
 }
 
 // GetToken returns the current authentication token
 func (c *Client) GetToken() string {
+	c.tokenMutex.RLock()
+	defer c.tokenMutex.RUnlock()
 	return c.token
 }
 
 // SetToken sets the authentication token (useful for session reuse)
 func (c *Client) SetToken(token string) {
+	c.setToken(token)
+}
+
+// setToken replaces the session token and restarts its age
+func (c *Client) setToken(token string) {
+	c.tokenMutex.Lock()
+	defer c.tokenMutex.Unlock()
+	
 	c.token = token
+	c.tokenExpiresAt = time.Time{}
+	if token == "" {
+		c.tokenIssuedAt = time.Time{}
+		c.lastUsed = time.Time{}
+		return
+	}
+	c.tokenIssuedAt = time.Now()
+	c.lastUsed = c.tokenIssuedAt
+}
+
+// setTokenExpiry records when the current token expires
+func (c *Client) setTokenExpiry(lifetime time.Duration) {
+	c.tokenMutex.Lock()
+	defer c.tokenMutex.Unlock()
+	c.tokenExpiresAt = c.tokenIssuedAt.Add(lifetime)
+}
+
+// tokenExpiring reports whether the current token expires within the
+// refresh margin
+func (c *Client) tokenExpiring() bool {
+	c.tokenMutex.RLock()
+	defer c.tokenMutex.RUnlock()
+	return !c.tokenExpiresAt.IsZero() && time.Now().Add(tokenRefreshMargin).After(c.tokenExpiresAt)
 }
 
 // IsAuthenticated checks if the client has an authentication token
 func (c *Client) IsAuthenticated() bool {
-	return c.token != ""
+	return c.GetToken() != ""
+}
+
+// TokenAge returns how long ago the current token was issued, or zero
+// without a token
+func (c *Client) TokenAge() time.Duration {
+	c.tokenMutex.RLock()
+	defer c.tokenMutex.RUnlock()
+	
+	if c.tokenIssuedAt.IsZero() {
+		return 0
+	}
+	return time.Since(c.tokenIssuedAt)
+}
+
+// LastUsed returns when the vault last accepted the current token
+func (c *Client) LastUsed() time.Time {
+	c.tokenMutex.RLock()
+	defer c.tokenMutex.RUnlock()
+	return c.lastUsed
+}
+
+// touch records that the vault accepted the given token
+func (c *Client) touch(token string) {
+	c.tokenMutex.Lock()
+	defer c.tokenMutex.Unlock()
+	
+	if c.token == token {
+		c.lastUsed = time.Now()
+	}
+}
+
+// roundTrip sends a request through the instance guard, if any
+func (c *Client) roundTrip(req *http.Request) (*http.Response, error) {
+	if c.guard == nil {
+		return c.getHTTPClient().Do(req)
+	}
+	
+	done, err := c.guard.acquire(req.Context())
+	if err != nil {
+		return nil, err
+	}
+	
+	resp, err := c.getHTTPClient().Do(req)
+	done(requestOutcome(req.Context(), resp, err))
+	return resp, err
 }
 
 // getHTTPClient returns the appropriate HTTP client
@@ -0,0 +1,107 @@
+package cyberark_test
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/orca-ng/orca/internal/cyberark"
+)
+
+// fakeVault hands out numbered tokens and rejects those listed as expired
+type fakeVault struct {
+	logons  int32
+	expired sync.Map
+}
+
+func (v *fakeVault) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	switch r.URL.Path {
+	case "/API/auth/Cyberark/Logon":
+		// Slow enough for concurrent callers to pile up behind one logon
+		time.Sleep(20 * time.Millisecond)
+		n := atomic.AddInt32(&v.logons, 1)
+		fmt.Fprintf(w, `"token-%d"`, n)
+	case "/API/Users":
+		if _, expired := v.expired.Load(r.Header.Get("Authorization")); expired {
+			w.WriteHeader(http.StatusUnauthorized)
+			fmt.Fprint(w, `{"ErrorCode": "PASWS006E", "ErrorMessage": "Your session has expired."}`)
+			return
+		}
+		fmt.Fprint(w, `{"Users": [{"id": 1, "username": "Administrator"}], "Total": 1}`)
+	case "/API/auth/Logoff":
+		w.WriteHeader(http.StatusOK)
+	default:
+		w.WriteHeader(http.StatusNotFound)
+	}
+}
+
+func TestClientLogsOnAgainWhenTokenExpires(t *testing.T) {
+	vault := &fakeVault{}
+	server := httptest.NewServer(vault)
+	defer server.Close()
+
+	client := cyberark.NewClientWithTLSConfig(server.URL, "orca", "secret", false)
+	_, err := client.Authenticate()
+	require.NoError(t, err)
+	assert.Equal(t, "token-1", client.GetToken())
+
+	vault.expired.Store("token-1", true)
+
+	users, err := client.ListUsers(context.Background(), cyberark.ListUsersOptions{PageOffset: 1, PageSize: 10})
+	require.NoError(t, err)
+	assert.Len(t, users.Users, 1)
+	assert.Equal(t, "token-2", client.GetToken())
+	assert.Equal(t, int32(2), atomic.LoadInt32(&vault.logons))
+}
+
+func TestClientGivesUpAfterOneLogon(t *testing.T) {
+	vault := &fakeVault{}
+	server := httptest.NewServer(vault)
+	defer server.Close()
+
+	// Every token is rejected
+	for i := 1; i <= 3; i++ {
+		vault.expired.Store(fmt.Sprintf("token-%d", i), true)
+	}
+
+	client := cyberark.NewClientWithTLSConfig(server.URL, "orca", "secret", false)
+	_, err := client.ListUsers(context.Background(), cyberark.ListUsersOptions{PageOffset: 1, PageSize: 10})
+	require.Error(t, err)
+	assert.Equal(t, "PASWS006E", cyberark.ErrorCode(err))
+	assert.Equal(t, int32(2), atomic.LoadInt32(&vault.logons))
+}
+
+func TestConcurrentCallersShareOneLogon(t *testing.T) {
+	vault := &fakeVault{}
+	server := httptest.NewServer(vault)
+	defer server.Close()
+
+	client := cyberark.NewClientWithTLSConfig(server.URL, "orca", "secret", false)
+
+	var wg sync.WaitGroup
+	for i := 0; i < 20; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			_, err := client.ListUsers(context.Background(), cyberark.ListUsersOptions{PageOffset: 1, PageSize: 10})
+			assert.NoError(t, err)
+		}()
+	}
+	wg.Wait()
+
+	assert.Equal(t, int32(1), atomic.LoadInt32(&vault.logons))
+	assert.Greater(t, client.TokenAge(), time.Duration(0))
+	assert.WithinDuration(t, time.Now(), client.LastUsed(), time.Second)
+
+	require.NoError(t, client.Logoff())
+	assert.Zero(t, client.TokenAge())
+	assert.False(t, client.IsAuthenticated())
+}
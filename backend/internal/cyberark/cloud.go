@@ -0,0 +1,154 @@
+package cyberark
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"strings"
+	"time"
+)
+
+// InstanceType distinguishes a self-hosted PVWA from Privilege Cloud
+type InstanceType string
+
+const (
+	// InstanceTypeSelfHosted is a PVWA logged on to with a username and
+	// password
+	InstanceTypeSelfHosted InstanceType = "self_hosted"
+	// InstanceTypePrivilegeCloud is a Privilege Cloud tenant called with a
+	// bearer token from the Identity tenant's OAuth2 client-credentials flow
+	InstanceTypePrivilegeCloud InstanceType = "privilege_cloud"
+)
+
+// ParseInstanceType validates an instance type name. An empty name is a
+// self-hosted PVWA.
+func ParseInstanceType(name string) (InstanceType, error) {
+	switch InstanceType(name) {
+	case "", InstanceTypeSelfHosted:
+		return InstanceTypeSelfHosted, nil
+	case InstanceTypePrivilegeCloud:
+		return InstanceTypePrivilegeCloud, nil
+	}
+	return "", fmt.Errorf("unsupported instance type %q", name)
+}
+
+// privilegeCloudBasePath is where Privilege Cloud serves the PVWA API
+const privilegeCloudBasePath = "/PasswordVault"
+
+// tokenRefreshMargin is how long before it expires an OAuth token is
+// replaced, so that it does not run out during a request
+const tokenRefreshMargin = 30 * time.Second
+
+// apiBaseURL returns the URL the API paths are appended to
+func apiBaseURL(baseURL string, instanceType InstanceType) string {
+	baseURL = strings.TrimRight(baseURL, "/")
+	if instanceType == InstanceTypePrivilegeCloud && !strings.HasSuffix(strings.ToLower(baseURL), strings.ToLower(privilegeCloudBasePath)) {
+		return baseURL + privilegeCloudBasePath
+	}
+	return baseURL
+}
+
+// SetInstanceType switches the client to the given instance type. For
+// Privilege Cloud, identityURL is the Identity tenant that issues tokens and
+// the client's username and password are the OAuth client ID and secret.
+func (c *Client) SetInstanceType(instanceType InstanceType, identityURL string) {
+	c.logonMutex.Lock()
+	defer c.logonMutex.Unlock()
+
+	c.instanceType = instanceType
+	c.identityURL = strings.TrimRight(identityURL, "/")
+	c.baseURL = apiBaseURL(c.baseURL, instanceType)
+}
+
+// privilegeCloud reports whether the client talks to Privilege Cloud
+func (c *Client) privilegeCloud() bool {
+	return c.instanceType == InstanceTypePrivilegeCloud
+}
+
+// authorization returns the Authorization header for a token
+func (c *Client) authorization(token string) string {
+	if c.privilegeCloud() {
+		return "Bearer " + token
+	}
+	return token
+}
+
+// platformToken is the response of the Identity token endpoint
+type platformToken struct {
+	AccessToken string `json:"access_token"`
+	TokenType   string `json:"token_type"`
+	ExpiresIn   int    `json:"expires_in"`
+}
+
+// oauthLogon requests a token from the Identity tenant with the client
+// credentials grant. Callers hold logonMutex.
+func (c *Client) oauthLogon(ctx context.Context) (string, error) {
+	if c.identityURL == "" {
+		return "", fmt.Errorf("privilege cloud instance has no identity URL")
+	}
+
+	form := url.Values{
+		"grant_type":    {"client_credentials"},
+		"client_id":     {c.username},
+		"client_secret": {c.password},
+	}
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, c.identityURL+"/oauth2/platformtoken", strings.NewReader(form.Encode()))
+	if err != nil {
+		return "", fmt.Errorf("failed to create request: %w", err)
+	}
+	req.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+
+	resp, err := c.roundTrip(req)
+	if err != nil {
+		return "", fmt.Errorf("failed to connect to CyberArk Identity: %w", err)
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode != http.StatusOK {
+		return "", newOAuthError(resp)
+	}
+
+	var token platformToken
+	if err := json.NewDecoder(resp.Body).Decode(&token); err != nil {
+		return "", fmt.Errorf("failed to parse token response: %w", err)
+	}
+	if token.AccessToken == "" {
+		return "", fmt.Errorf("no token found in token response")
+	}
+
+	c.setToken(token.AccessToken)
+	if token.ExpiresIn > 0 {
+		c.setTokenExpiry(time.Duration(token.ExpiresIn) * time.Second)
+	}
+	return token.AccessToken, nil
+}
+
+// newOAuthError converts a failed token response to an API error. The
+// Identity tenant reports errors in the OAuth2 format rather than the
+// PVWA's.
+func newOAuthError(resp *http.Response) *APIError {
+	apiErr := &APIError{
+		Method:       resp.Request.Method,
+		Path:         resp.Request.URL.Path,
+		Status:       resp.StatusCode,
+		ErrorMessage: "token request failed",
+		RetryAfter:   parseRetryAfter(resp.Header.Get("Retry-After")),
+	}
+
+	body, err := io.ReadAll(io.LimitReader(resp.Body, maxErrorBodySize))
+	if err != nil {
+		return apiErr
+	}
+	var details struct {
+		Error            string `json:"error"`
+		ErrorDescription string `json:"error_description"`
+	}
+	if json.Unmarshal(body, &details) == nil && details.Error != "" {
+		apiErr.ErrorCode = details.Error
+		apiErr.ErrorMessage = firstNonEmpty(details.ErrorDescription, details.Error)
+	}
+	return apiErr
+}
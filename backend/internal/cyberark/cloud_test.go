@@ -0,0 +1,126 @@
+package cyberark_test
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"sync/atomic"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/orca-ng/orca/internal/cyberark"
+)
+
+// fakeIdentity issues numbered OAuth tokens to one client
+type fakeIdentity struct {
+	issued    int32
+	expiresIn int
+}
+
+func (i *fakeIdentity) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	if r.URL.Path != "/oauth2/platformtoken" || r.ParseForm() != nil {
+		w.WriteHeader(http.StatusNotFound)
+		return
+	}
+	if r.PostForm.Get("grant_type") != "client_credentials" ||
+		r.PostForm.Get("client_id") != "orca@cyberark.cloud.1234" ||
+		r.PostForm.Get("client_secret") != "secret" {
+		w.WriteHeader(http.StatusBadRequest)
+		fmt.Fprint(w, `{"error": "invalid_client", "error_description": "Client authentication failed"}`)
+		return
+	}
+	n := atomic.AddInt32(&i.issued, 1)
+	fmt.Fprintf(w, `{"access_token": "oauth-%d", "token_type": "Bearer", "expires_in": %d}`, n, i.expiresIn)
+}
+
+// privilegeCloud serves the Users API under /PasswordVault and records the
+// Authorization header of the last request
+func privilegeCloud(t *testing.T, authorization *atomic.Value) *httptest.Server {
+	return httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path != "/PasswordVault/API/Users" {
+			w.WriteHeader(http.StatusNotFound)
+			return
+		}
+		authorization.Store(r.Header.Get("Authorization"))
+		fmt.Fprint(w, `{"Users": [], "Total": 0}`)
+	}))
+}
+
+func newCloudClient(t *testing.T, tenantURL, identityURL, secret string) *cyberark.Client {
+	t.Helper()
+	client, err := cyberark.NewClient(cyberark.Config{
+		Type:        cyberark.InstanceTypePrivilegeCloud,
+		BaseURL:     tenantURL,
+		IdentityURL: identityURL,
+		Username:    "orca@cyberark.cloud.1234",
+		Password:    secret,
+	})
+	require.NoError(t, err)
+	return client
+}
+
+func TestPrivilegeCloudUsesBearerToken(t *testing.T) {
+	identity := &fakeIdentity{expiresIn: 900}
+	identityServer := httptest.NewServer(identity)
+	defer identityServer.Close()
+	var authorization atomic.Value
+	tenant := privilegeCloud(t, &authorization)
+	defer tenant.Close()
+
+	client := newCloudClient(t, tenant.URL, identityServer.URL, "secret")
+	for i := 0; i < 3; i++ {
+		require.NoError(t, listUsers(client))
+	}
+	assert.Equal(t, "Bearer oauth-1", authorization.Load())
+	assert.Equal(t, int32(1), atomic.LoadInt32(&identity.issued))
+
+	// There is no session to log off from
+	require.NoError(t, client.Logoff())
+	assert.False(t, client.IsAuthenticated())
+}
+
+func TestPrivilegeCloudRefreshesExpiringToken(t *testing.T) {
+	// Tokens expire within the refresh margin, so each request needs a new one
+	identity := &fakeIdentity{expiresIn: 10}
+	identityServer := httptest.NewServer(identity)
+	defer identityServer.Close()
+	var authorization atomic.Value
+	tenant := privilegeCloud(t, &authorization)
+	defer tenant.Close()
+
+	client := newCloudClient(t, tenant.URL+"/PasswordVault/", identityServer.URL, "secret")
+	require.NoError(t, listUsers(client))
+	require.NoError(t, listUsers(client))
+	assert.Equal(t, "Bearer oauth-2", authorization.Load())
+	assert.Equal(t, int32(2), atomic.LoadInt32(&identity.issued))
+}
+
+func TestPrivilegeCloudRejectsClientCredentials(t *testing.T) {
+	identityServer := httptest.NewServer(&fakeIdentity{expiresIn: 900})
+	defer identityServer.Close()
+
+	client := cyberark.NewClientWithTLSConfig("https://tenant.privilegecloud.cyberark.cloud", "orca@cyberark.cloud.1234", "wrong", false)
+	client.SetInstanceType(cyberark.InstanceTypePrivilegeCloud, identityServer.URL)
+
+	_, err := client.ListUsers(context.Background(), cyberark.ListUsersOptions{PageOffset: 1, PageSize: 10})
+	var apiErr *cyberark.APIError
+	require.True(t, errors.As(err, &apiErr))
+	assert.Equal(t, http.StatusBadRequest, apiErr.Status)
+	assert.Equal(t, "invalid_client", apiErr.ErrorCode)
+	assert.Equal(t, "Client authentication failed", apiErr.ErrorMessage)
+	assert.False(t, apiErr.Retryable())
+}
+
+func TestPrivilegeCloudRequiresIdentityURL(t *testing.T) {
+	_, err := cyberark.NewClient(cyberark.Config{
+		Type:     cyberark.InstanceTypePrivilegeCloud,
+		BaseURL:  "https://tenant.privilegecloud.cyberark.cloud",
+		Username: "orca",
+		Password: "secret",
+	})
+	assert.Error(t, err)
+}
@@ -0,0 +1,157 @@
+package cyberark
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// ErrNotAuthenticated is returned when a request is made before logging on
+var ErrNotAuthenticated = errors.New("client not authenticated")
+
+// PVWA error codes that callers commonly need to tell apart
+const (
+	ErrCodeAuthenticationFailure = "PASWS013E" // wrong username or password
+	ErrCodeSafeAlreadyExists     = "SFWS0002E"
+	ErrCodeSafeNotFound          = "SFWS0007E"
+	ErrCodeMemberAlreadyExists   = "SFWS0012E"
+)
+
+// maxErrorBodySize limits how much of an error response is read
+const maxErrorBodySize = 64 * 1024
+
+// APIError is returned when the PVWA answers with an unexpected status code.
+// ErrorCode and ErrorMessage come from the response body when the vault
+// provides them, e.g. PASWS013E "Authentication failure for User [orca]".
+type APIError struct {
+	Method       string
+	Path         string
+	Status       int
+	ErrorCode    string
+	ErrorMessage string
+
+	// Delay requested by the server in a Retry-After header, if any
+	RetryAfter time.Duration
+}
+
+func (e *APIError) Error() string {
+	message := e.ErrorMessage
+	if message == "" {
+		message = fmt.Sprintf("request failed with status code %d", e.Status)
+	}
+	if e.ErrorCode != "" {
+		message = e.ErrorCode + " " + message
+	}
+	return fmt.Sprintf("%s %s: %s (status %d)", e.Method, e.Path, message, e.Status)
+}
+
+// StatusCode returns the HTTP status code of the response
+func (e *APIError) StatusCode() int {
+	return e.Status
+}
+
+// Retryable reports whether the same request may succeed later: the vault
+// was busy, unavailable or rate limiting, rather than rejecting the request
+func (e *APIError) Retryable() bool {
+	switch e.Status {
+	case http.StatusRequestTimeout, http.StatusTooManyRequests:
+		return true
+	case http.StatusNotImplemented, http.StatusHTTPVersionNotSupported:
+		return false
+	}
+	return e.Status >= 500
+}
+
+// TokenExpired reports whether the session token was rejected. A 401 from
+// the logon or token endpoint itself means the credentials are wrong instead.
+func (e *APIError) TokenExpired() bool {
+	return e.Status == http.StatusUnauthorized && !strings.Contains(e.Path, "/auth/") && !strings.Contains(e.Path, "/oauth2/")
+}
+
+// ErrorCode returns the PVWA error code carried by err, or "" if there is none
+func ErrorCode(err error) string {
+	var apiErr *APIError
+	if errors.As(err, &apiErr) {
+		return apiErr.ErrorCode
+	}
+	return ""
+}
+
+// HasErrorCode reports whether err is an APIError with the given PVWA code
+func HasErrorCode(err error, code string) bool {
+	return code != "" && ErrorCode(err) == code
+}
+
+// newAPIError builds an APIError from a response, reading the PVWA error
+// details from its body. fallback describes the error when the body has none.
+func newAPIError(resp *http.Response, fallback string) *APIError {
+	apiErr := &APIError{
+		Status:       resp.StatusCode,
+		ErrorMessage: fallback,
+		RetryAfter:   parseRetryAfter(resp.Header.Get("Retry-After")),
+	}
+	if resp.Request != nil {
+		apiErr.Method = resp.Request.Method
+		apiErr.Path = resp.Request.URL.Path
+	}
+
+	body, err := io.ReadAll(io.LimitReader(resp.Body, maxErrorBodySize))
+	if err != nil || len(body) == 0 {
+		return apiErr
+	}
+
+	// Most endpoints answer with ErrorCode/ErrorMessage; some older ones and
+	// the IIS front end use Code/Message or Details
+	var details struct {
+		ErrorCode    string `json:"ErrorCode"`
+		ErrorMessage string `json:"ErrorMessage"`
+		Code         string `json:"Code"`
+		Message      string `json:"Message"`
+		Details      string `json:"Details"`
+	}
+	if json.Unmarshal(body, &details) != nil {
+		return apiErr
+	}
+
+	apiErr.ErrorCode = firstNonEmpty(details.ErrorCode, details.Code)
+	if message := firstNonEmpty(details.ErrorMessage, details.Message, details.Details); message != "" {
+		apiErr.ErrorMessage = strings.TrimSpace(message)
+	}
+
+	return apiErr
+}
+
+// firstNonEmpty returns the first of the values that is not empty
+func firstNonEmpty(values ...string) string {
+	for _, v := range values {
+		if v != "" {
+			return v
+		}
+	}
+	return ""
+}
+
+// parseRetryAfter reads a Retry-After header given either in seconds or as
+// an HTTP date
+func parseRetryAfter(value string) time.Duration {
+	if value == "" {
+		return 0
+	}
+	if seconds, err := strconv.Atoi(strings.TrimSpace(value)); err == nil {
+		if seconds < 0 {
+			return 0
+		}
+		return time.Duration(seconds) * time.Second
+	}
+	if at, err := http.ParseTime(value); err == nil {
+		if d := time.Until(at); d > 0 {
+			return d
+		}
+	}
+	return 0
+}
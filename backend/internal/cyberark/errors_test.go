@@ -0,0 +1,91 @@
+package cyberark_test
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/orca-ng/orca/internal/cyberark"
+)
+
+func TestAuthenticateReturnsAPIError(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "application/json")
+		w.WriteHeader(http.StatusForbidden)
+		fmt.Fprint(w, `{"ErrorCode": "PASWS013E", "ErrorMessage": "Authentication failure for User [orca]."}`)
+	}))
+	defer server.Close()
+
+	client := cyberark.NewClientWithTLSConfig(server.URL, "orca", "wrong", false)
+	_, err := client.Authenticate()
+	require.Error(t, err)
+
+	var apiErr *cyberark.APIError
+	require.True(t, errors.As(err, &apiErr))
+	assert.Equal(t, http.StatusForbidden, apiErr.Status)
+	assert.Equal(t, "POST", apiErr.Method)
+	assert.Equal(t, "/API/auth/Cyberark/Logon", apiErr.Path)
+	assert.Equal(t, cyberark.ErrCodeAuthenticationFailure, apiErr.ErrorCode)
+	assert.Equal(t, "Authentication failure for User [orca].", apiErr.ErrorMessage)
+	assert.False(t, apiErr.Retryable())
+	assert.True(t, cyberark.HasErrorCode(fmt.Errorf("test connection: %w", err), cyberark.ErrCodeAuthenticationFailure))
+	assert.Contains(t, err.Error(), "PASWS013E")
+}
+
+func TestListUsersReturnsAPIError(t *testing.T) {
+	tests := []struct {
+		name       string
+		status     int
+		header     string
+		body       string
+		code       string
+		retryable  bool
+		retryAfter time.Duration
+	}{
+		{"rate limited", http.StatusTooManyRequests, "30", ``, "", true, 30 * time.Second},
+		{"unavailable", http.StatusServiceUnavailable, "", `<html>Service Unavailable</html>`, "", true, 0},
+		{"token expired", http.StatusUnauthorized, "", `{"ErrorCode": "PASWS006E", "ErrorMessage": "Your session has expired."}`, "PASWS006E", false, 0},
+		{"legacy body", http.StatusBadRequest, "", `{"Code": "ITATS001E", "Message": "Invalid filter"}`, "ITATS001E", false, 0},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+				if tt.header != "" {
+					w.Header().Set("Retry-After", tt.header)
+				}
+				w.WriteHeader(tt.status)
+				fmt.Fprint(w, tt.body)
+			}))
+			defer server.Close()
+
+			// Without credentials the client cannot log on again, so the
+			// rejected token is reported as is
+			client := cyberark.NewClientWithTLSConfig(server.URL, "", "", false)
+			client.SetToken("token")
+			_, err := client.ListUsers(context.Background(), cyberark.ListUsersOptions{PageOffset: 1, PageSize: 10})
+
+			var apiErr *cyberark.APIError
+			require.True(t, errors.As(err, &apiErr))
+			assert.Equal(t, tt.status, apiErr.StatusCode())
+			assert.Equal(t, "GET", apiErr.Method)
+			assert.Equal(t, "/API/Users", apiErr.Path)
+			assert.Equal(t, tt.code, apiErr.ErrorCode)
+			assert.Equal(t, tt.retryable, apiErr.Retryable())
+			assert.Equal(t, tt.retryAfter, apiErr.RetryAfter)
+		})
+	}
+}
+
+func TestListUsersRequiresLogon(t *testing.T) {
+	client := cyberark.NewClientWithTLSConfig("https://pvwa.example.com", "", "", false)
+	_, err := client.ListUsers(context.Background(), cyberark.ListUsersOptions{PageOffset: 1, PageSize: 10})
+	assert.ErrorIs(t, err, cyberark.ErrNotAuthenticated)
+}
@@ -0,0 +1,370 @@
+package cyberark
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net/http"
+	"sync"
+	"time"
+)
+
+// ErrCircuitOpen is returned without contacting the vault while the circuit
+// breaker for an instance is open
+var ErrCircuitOpen = errors.New("circuit breaker open")
+
+// CircuitOpenError reports when the breaker lets requests through again
+type CircuitOpenError struct {
+	RetryAt time.Time
+}
+
+func (e *CircuitOpenError) Error() string {
+	return fmt.Sprintf("%s until %s", ErrCircuitOpen, e.RetryAt.Format(time.RFC3339))
+}
+
+func (e *CircuitOpenError) Is(target error) bool {
+	return target == ErrCircuitOpen
+}
+
+// Breaker defaults
+const (
+	DefaultFailureThreshold = 5
+	DefaultOpenDuration     = 30 * time.Second
+)
+
+// Limits controls how hard a client may use one PVWA
+type Limits struct {
+	RequestsPerSecond float64 // 0 = unlimited
+	MaxInFlight       int     // 0 = unlimited
+
+	// Consecutive failures that open the breaker, and how long it stays
+	// open before a single probe request is let through
+	FailureThreshold int
+	OpenDuration     time.Duration
+}
+
+// BreakerState is the state of a circuit breaker
+type BreakerState string
+
+const (
+	BreakerClosed   BreakerState = "closed"
+	BreakerOpen     BreakerState = "open"
+	BreakerHalfOpen BreakerState = "half_open"
+)
+
+// BreakerStatus describes a circuit breaker for the API
+type BreakerStatus struct {
+	State               BreakerState `json:"state"`
+	ConsecutiveFailures int          `json:"consecutive_failures"`
+	OpenedAt            *time.Time   `json:"opened_at,omitempty"`
+	RetryAt             *time.Time   `json:"retry_at,omitempty"`
+	InFlight            int          `json:"in_flight"`
+}
+
+// Guard rate limits the requests to one PVWA and stops them altogether
+// after repeated failures, so that a struggling vault gets time to recover.
+// Requests fail on the network, with a 5xx or with a 429 count as failures;
+// other responses show the vault is up.
+type Guard struct {
+	mu     sync.Mutex
+	limits Limits
+
+	// Token bucket holding up to one second of requests
+	tokens     float64
+	lastRefill time.Time
+
+	// Requests in flight; freed is closed and replaced whenever one ends
+	inFlight int
+	freed    chan struct{}
+
+	// Circuit breaker
+	failures int
+	openedAt time.Time
+	open     bool
+	probing  bool
+}
+
+// NewGuard creates a guard with the given limits
+func NewGuard(limits Limits) *Guard {
+	g := &Guard{freed: make(chan struct{})}
+	g.SetLimits(limits)
+	return g
+}
+
+// SetLimits changes the limits; the breaker state is kept
+func (g *Guard) SetLimits(limits Limits) {
+	if limits.FailureThreshold <= 0 {
+		limits.FailureThreshold = DefaultFailureThreshold
+	}
+	if limits.OpenDuration <= 0 {
+		limits.OpenDuration = DefaultOpenDuration
+	}
+
+	g.mu.Lock()
+	defer g.mu.Unlock()
+
+	if g.limits.RequestsPerSecond != limits.RequestsPerSecond {
+		g.tokens = burst(limits.RequestsPerSecond)
+		g.lastRefill = time.Now()
+	}
+	g.limits = limits
+}
+
+// burst is the bucket size for a rate: one second of requests, at least one
+func burst(rate float64) float64 {
+	if rate < 1 {
+		return 1
+	}
+	return rate
+}
+
+// Allow reports whether the breaker lets requests through
+func (g *Guard) Allow() bool {
+	g.mu.Lock()
+	defer g.mu.Unlock()
+	return !g.open || (!g.probing && !time.Now().Before(g.retryAt()))
+}
+
+// Status returns the breaker state
+func (g *Guard) Status() BreakerStatus {
+	g.mu.Lock()
+	defer g.mu.Unlock()
+
+	status := BreakerStatus{
+		State:               BreakerClosed,
+		ConsecutiveFailures: g.failures,
+		InFlight:            g.inFlight,
+	}
+	if g.open {
+		openedAt, retryAt := g.openedAt, g.retryAt()
+		status.OpenedAt = &openedAt
+		status.RetryAt = &retryAt
+		status.State = BreakerOpen
+		if g.probing || !time.Now().Before(retryAt) {
+			status.State = BreakerHalfOpen
+		}
+	}
+	return status
+}
+
+// retryAt is when an open breaker lets a probe through. Callers hold mu.
+func (g *Guard) retryAt() time.Time {
+	return g.openedAt.Add(g.limits.OpenDuration)
+}
+
+// outcome is what a finished request tells about the health of the vault
+type outcome int
+
+const (
+	outcomeSuccess outcome = iota
+	outcomeFailure
+	outcomeUnknown // cancelled or never sent, the vault did not answer
+)
+
+// acquire waits until a request may be sent. The returned function must be
+// called with the outcome once the request has finished.
+func (g *Guard) acquire(ctx context.Context) (func(outcome), error) {
+	probe, err := g.admit()
+	if err != nil {
+		return nil, err
+	}
+
+	if err := g.waitForSlot(ctx); err != nil {
+		g.abandon(probe)
+		return nil, err
+	}
+
+	if err := g.waitForToken(ctx); err != nil {
+		g.release(outcomeUnknown, probe)
+		return nil, err
+	}
+
+	return func(result outcome) {
+		g.release(result, probe)
+	}, nil
+}
+
+// admit checks the breaker. Once the open period has passed one request is
+// let through as a probe; its outcome closes or reopens the breaker.
+func (g *Guard) admit() (bool, error) {
+	g.mu.Lock()
+	defer g.mu.Unlock()
+
+	if !g.open {
+		return false, nil
+	}
+	if g.probing || time.Now().Before(g.retryAt()) {
+		return false, &CircuitOpenError{RetryAt: g.retryAt()}
+	}
+	g.probing = true
+	return true, nil
+}
+
+// waitForSlot waits until fewer than MaxInFlight requests are running
+func (g *Guard) waitForSlot(ctx context.Context) error {
+	for {
+		g.mu.Lock()
+		if g.limits.MaxInFlight <= 0 || g.inFlight < g.limits.MaxInFlight {
+			g.inFlight++
+			g.mu.Unlock()
+			return nil
+		}
+		freed := g.freed
+		g.mu.Unlock()
+
+		select {
+		case <-ctx.Done():
+			return ctx.Err()
+		case <-freed:
+		}
+	}
+}
+
+// waitForToken waits for the rate limit
+func (g *Guard) waitForToken(ctx context.Context) error {
+	for {
+		g.mu.Lock()
+		rate := g.limits.RequestsPerSecond
+		if rate <= 0 {
+			g.mu.Unlock()
+			return nil
+		}
+
+		now := time.Now()
+		g.tokens += now.Sub(g.lastRefill).Seconds() * rate
+		if limit := burst(rate); g.tokens > limit {
+			g.tokens = limit
+		}
+		g.lastRefill = now
+
+		if g.tokens >= 1 {
+			g.tokens--
+			g.mu.Unlock()
+			return nil
+		}
+		wait := time.Duration((1 - g.tokens) / rate * float64(time.Second))
+		g.mu.Unlock()
+
+		timer := time.NewTimer(wait)
+		select {
+		case <-ctx.Done():
+			timer.Stop()
+			return ctx.Err()
+		case <-timer.C:
+		}
+	}
+}
+
+// release frees the request's slot and records its outcome. A request
+// without one leaves the breaker as it was, apart from ending a probe.
+func (g *Guard) release(result outcome, probe bool) {
+	g.mu.Lock()
+	defer g.mu.Unlock()
+
+	g.inFlight--
+	close(g.freed)
+	g.freed = make(chan struct{})
+
+	if probe {
+		g.probing = false
+	}
+	switch result {
+	case outcomeUnknown:
+		return
+	case outcomeSuccess:
+		g.failures = 0
+		g.open = false
+		return
+	}
+
+	g.failures++
+	if probe || g.failures >= g.limits.FailureThreshold {
+		g.open = true
+		g.openedAt = time.Now()
+	}
+}
+
+// abandon gives up a probe that was never sent
+func (g *Guard) abandon(probe bool) {
+	if !probe {
+		return
+	}
+	g.mu.Lock()
+	g.probing = false
+	g.mu.Unlock()
+}
+
+// requestOutcome classifies a finished request for the breaker. A cancelled
+// request says nothing about the vault.
+func requestOutcome(ctx context.Context, resp *http.Response, err error) outcome {
+	switch {
+	case err != nil && ctx.Err() != nil:
+		return outcomeUnknown
+	case err != nil:
+		return outcomeFailure
+	case resp.StatusCode >= 500 || resp.StatusCode == http.StatusTooManyRequests:
+		return outcomeFailure
+	}
+	return outcomeSuccess
+}
+
+// GuardRegistry holds one guard per CyberArk instance, shared by all clients
+// for that instance in this process
+type GuardRegistry struct {
+	mu     sync.Mutex
+	guards map[string]*Guard
+}
+
+// NewGuardRegistry creates an empty registry
+func NewGuardRegistry() *GuardRegistry {
+	return &GuardRegistry{guards: make(map[string]*Guard)}
+}
+
+// Guard returns the guard for an instance, creating it or updating its
+// limits as needed
+func (r *GuardRegistry) Guard(instanceID string, limits Limits) *Guard {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	if g, ok := r.guards[instanceID]; ok {
+		g.SetLimits(limits)
+		return g
+	}
+	g := NewGuard(limits)
+	r.guards[instanceID] = g
+	return g
+}
+
+// Status returns the breaker status of an instance. Instances no client has
+// talked to yet are reported as closed.
+func (r *GuardRegistry) Status(instanceID string) BreakerStatus {
+	r.mu.Lock()
+	g, ok := r.guards[instanceID]
+	r.mu.Unlock()
+
+	if !ok {
+		return BreakerStatus{State: BreakerClosed}
+	}
+	return g.Status()
+}
+
+// Blocked returns the instances whose breaker currently rejects requests
+func (r *GuardRegistry) Blocked() []string {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	var blocked []string
+	for instanceID, g := range r.guards {
+		if !g.Allow() {
+			blocked = append(blocked, instanceID)
+		}
+	}
+	return blocked
+}
+
+// Remove forgets the guard of a deleted instance
+func (r *GuardRegistry) Remove(instanceID string) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	delete(r.guards, instanceID)
+}
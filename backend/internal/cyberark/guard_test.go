@@ -0,0 +1,213 @@
+package cyberark_test
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/orca-ng/orca/internal/cyberark"
+)
+
+func guardedClient(t *testing.T, url string, guard *cyberark.Guard) *cyberark.Client {
+	t.Helper()
+	client, err := cyberark.NewClient(cyberark.Config{BaseURL: url, Guard: guard})
+	require.NoError(t, err)
+	client.SetToken("token")
+	return client
+}
+
+func listUsers(client *cyberark.Client) error {
+	_, err := client.ListUsers(context.Background(), cyberark.ListUsersOptions{PageOffset: 1, PageSize: 10})
+	return err
+}
+
+func TestCircuitBreakerOpensAndRecovers(t *testing.T) {
+	var requests int32
+	var healthy atomic.Bool
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		atomic.AddInt32(&requests, 1)
+		if !healthy.Load() {
+			w.WriteHeader(http.StatusServiceUnavailable)
+			return
+		}
+		fmt.Fprint(w, `{"Users": [], "Total": 0}`)
+	}))
+	defer server.Close()
+
+	guard := cyberark.NewGuard(cyberark.Limits{FailureThreshold: 3, OpenDuration: 50 * time.Millisecond})
+	client := guardedClient(t, server.URL, guard)
+
+	for i := 0; i < 3; i++ {
+		require.Error(t, listUsers(client))
+	}
+	assert.Equal(t, cyberark.BreakerOpen, guard.Status().State)
+	assert.False(t, guard.Allow())
+
+	// Rejected without reaching the vault
+	err := listUsers(client)
+	assert.ErrorIs(t, err, cyberark.ErrCircuitOpen)
+	var openErr *cyberark.CircuitOpenError
+	require.True(t, errors.As(err, &openErr))
+	assert.WithinDuration(t, time.Now().Add(50*time.Millisecond), openErr.RetryAt, 50*time.Millisecond)
+	assert.Equal(t, int32(3), atomic.LoadInt32(&requests))
+
+	// A failed probe opens the breaker again
+	time.Sleep(60 * time.Millisecond)
+	assert.Equal(t, cyberark.BreakerHalfOpen, guard.Status().State)
+	require.Error(t, listUsers(client))
+	assert.Equal(t, cyberark.BreakerOpen, guard.Status().State)
+	assert.Equal(t, int32(4), atomic.LoadInt32(&requests))
+
+	// A successful probe closes it
+	healthy.Store(true)
+	time.Sleep(60 * time.Millisecond)
+	require.NoError(t, listUsers(client))
+	status := guard.Status()
+	assert.Equal(t, cyberark.BreakerClosed, status.State)
+	assert.Zero(t, status.ConsecutiveFailures)
+	assert.Nil(t, status.RetryAt)
+}
+
+func TestCircuitBreakerIgnoresCancelledRequests(t *testing.T) {
+	var hang atomic.Bool
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if hang.Load() {
+			<-r.Context().Done()
+			return
+		}
+		w.WriteHeader(http.StatusServiceUnavailable)
+	}))
+	defer server.Close()
+
+	guard := cyberark.NewGuard(cyberark.Limits{FailureThreshold: 3, OpenDuration: 50 * time.Millisecond})
+	client := guardedClient(t, server.URL, guard)
+	cancelled := func() {
+		hang.Store(true)
+		defer hang.Store(false)
+		ctx, cancel := context.WithTimeout(context.Background(), 20*time.Millisecond)
+		defer cancel()
+		_, err := client.ListUsers(ctx, cyberark.ListUsersOptions{PageOffset: 1, PageSize: 10})
+		require.Error(t, err)
+	}
+
+	// A cancelled request keeps the count of failures before it
+	for i := 0; i < 2; i++ {
+		require.Error(t, listUsers(client))
+	}
+	cancelled()
+	assert.Equal(t, 2, guard.Status().ConsecutiveFailures)
+	require.Error(t, listUsers(client))
+	assert.Equal(t, cyberark.BreakerOpen, guard.Status().State)
+
+	// A cancelled probe neither closes the breaker nor blocks the next probe
+	time.Sleep(60 * time.Millisecond)
+	cancelled()
+	status := guard.Status()
+	assert.Equal(t, cyberark.BreakerHalfOpen, status.State)
+	assert.Equal(t, 3, status.ConsecutiveFailures)
+	require.Error(t, listUsers(client))
+	assert.Equal(t, cyberark.BreakerOpen, guard.Status().State)
+}
+
+func TestCircuitBreakerIgnoresClientErrors(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusBadRequest)
+	}))
+	defer server.Close()
+
+	guard := cyberark.NewGuard(cyberark.Limits{FailureThreshold: 2})
+	client := guardedClient(t, server.URL, guard)
+
+	for i := 0; i < 5; i++ {
+		require.Error(t, listUsers(client))
+	}
+	assert.Equal(t, cyberark.BreakerClosed, guard.Status().State)
+}
+
+func TestGuardLimitsRequestsInFlight(t *testing.T) {
+	var inFlight, peak int32
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		n := atomic.AddInt32(&inFlight, 1)
+		defer atomic.AddInt32(&inFlight, -1)
+		for {
+			p := atomic.LoadInt32(&peak)
+			if n <= p || atomic.CompareAndSwapInt32(&peak, p, n) {
+				break
+			}
+		}
+		time.Sleep(20 * time.Millisecond)
+		fmt.Fprint(w, `{"Users": [], "Total": 0}`)
+	}))
+	defer server.Close()
+
+	guard := cyberark.NewGuard(cyberark.Limits{MaxInFlight: 2})
+	client := guardedClient(t, server.URL, guard)
+
+	var wg sync.WaitGroup
+	for i := 0; i < 8; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			assert.NoError(t, listUsers(client))
+		}()
+	}
+	wg.Wait()
+
+	assert.Equal(t, int32(2), atomic.LoadInt32(&peak))
+	assert.Zero(t, guard.Status().InFlight)
+}
+
+func TestGuardLimitsRequestRate(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		fmt.Fprint(w, `{"Users": [], "Total": 0}`)
+	}))
+	defer server.Close()
+
+	// A burst of one second's worth, then one request every 50ms
+	guard := cyberark.NewGuard(cyberark.Limits{RequestsPerSecond: 20})
+	client := guardedClient(t, server.URL, guard)
+
+	start := time.Now()
+	for i := 0; i < 25; i++ {
+		require.NoError(t, listUsers(client))
+	}
+	assert.GreaterOrEqual(t, time.Since(start), 240*time.Millisecond)
+
+	// Waiting for the rate limit respects the caller's deadline
+	ctx, cancel := context.WithTimeout(context.Background(), time.Millisecond)
+	defer cancel()
+	guard.SetLimits(cyberark.Limits{RequestsPerSecond: 0.1})
+	require.NoError(t, listUsers(client))
+	_, err := client.ListUsers(ctx, cyberark.ListUsersOptions{PageOffset: 1, PageSize: 10})
+	assert.ErrorIs(t, err, context.DeadlineExceeded)
+	assert.Equal(t, cyberark.BreakerClosed, guard.Status().State)
+}
+
+func TestGuardRegistrySharesGuardsPerInstance(t *testing.T) {
+	registry := cyberark.NewGuardRegistry()
+	a := registry.Guard("cai_a", cyberark.Limits{FailureThreshold: 1})
+	assert.Same(t, a, registry.Guard("cai_a", cyberark.Limits{FailureThreshold: 1}))
+	assert.NotSame(t, a, registry.Guard("cai_b", cyberark.Limits{}))
+	assert.Equal(t, cyberark.BreakerClosed, registry.Status("cai_unknown").State)
+
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusBadGateway)
+	}))
+	defer server.Close()
+
+	require.Error(t, listUsers(guardedClient(t, server.URL, a)))
+	assert.Equal(t, []string{"cai_a"}, registry.Blocked())
+	assert.Equal(t, cyberark.BreakerOpen, registry.Status("cai_a").State)
+
+	registry.Remove("cai_a")
+	assert.Empty(t, registry.Blocked())
+}
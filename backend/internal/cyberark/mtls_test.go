@@ -0,0 +1,106 @@
+package cyberark_test
+
+import (
+	"context"
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/tls"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"encoding/pem"
+	"fmt"
+	"math/big"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/orca-ng/orca/internal/cyberark"
+	"github.com/orca-ng/orca/internal/services"
+)
+
+// clientCertificate creates a self-signed client certificate
+func clientCertificate(t *testing.T) *services.ClientCertificate {
+	t.Helper()
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	require.NoError(t, err)
+	template := &x509.Certificate{
+		SerialNumber: big.NewInt(1),
+		Subject:      pkix.Name{CommonName: "svc_orca"},
+		NotBefore:    time.Now().Add(-time.Hour),
+		NotAfter:     time.Now().Add(time.Hour),
+		KeyUsage:     x509.KeyUsageDigitalSignature,
+		ExtKeyUsage:  []x509.ExtKeyUsage{x509.ExtKeyUsageClientAuth},
+	}
+	der, err := x509.CreateCertificate(rand.Reader, template, template, &key.PublicKey, key)
+	require.NoError(t, err)
+	keyDER, err := x509.MarshalECPrivateKey(key)
+	require.NoError(t, err)
+
+	cert, err := services.NewCertificateService().ParseClientCertificate(
+		string(pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE", Bytes: der})),
+		string(pem.EncodeToMemory(&pem.Block{Type: "EC PRIVATE KEY", Bytes: keyDER})),
+	)
+	require.NoError(t, err)
+	return cert
+}
+
+// mtlsVault requires a client certificate and logs on whoever presents one
+// to the certificate logon endpoint
+func mtlsVault(t *testing.T, trusted *x509.Certificate) *httptest.Server {
+	pool := x509.NewCertPool()
+	pool.AddCert(trusted)
+
+	server := httptest.NewUnstartedServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		switch r.URL.Path {
+		case "/API/auth/pki/Logon":
+			fmt.Fprintf(w, `"token-%s"`, r.TLS.PeerCertificates[0].Subject.CommonName)
+		case "/API/auth/Logoff":
+			w.WriteHeader(http.StatusOK)
+		default:
+			w.WriteHeader(http.StatusNotFound)
+		}
+	}))
+	server.TLS = &tls.Config{ClientAuth: tls.RequireAndVerifyClientCert, ClientCAs: pool}
+	server.StartTLS()
+	return server
+}
+
+func TestCertificateLogonOverMutualTLS(t *testing.T) {
+	cert := clientCertificate(t)
+	server := mtlsVault(t, cert.Leaf.Certificate)
+	defer server.Close()
+
+	client, err := cyberark.NewClient(cyberark.Config{
+		BaseURL:           server.URL,
+		Username:          "svc_orca",
+		SkipTLSVerify:     true,
+		ClientCertificate: cert,
+		Logon:             cyberark.LogonOptions{Method: cyberark.AuthMethodPKI},
+	})
+	require.NoError(t, err)
+
+	ok, _, err := client.TestConnection(context.Background())
+	require.NoError(t, err)
+	assert.True(t, ok)
+}
+
+func TestMutualTLSWithoutCertificate(t *testing.T) {
+	server := mtlsVault(t, clientCertificate(t).Leaf.Certificate)
+	defer server.Close()
+
+	client, err := cyberark.NewClient(cyberark.Config{
+		BaseURL:       server.URL,
+		Username:      "svc_orca",
+		SkipTLSVerify: true,
+		Logon:         cyberark.LogonOptions{Method: cyberark.AuthMethodPKI},
+	})
+	require.NoError(t, err)
+
+	_, err = client.Authenticate()
+	assert.Error(t, err)
+}
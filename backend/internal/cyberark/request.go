@@ -0,0 +1,114 @@
+package cyberark
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"io"
+	"net/http"
+)
+
+// do sends an authenticated request to the PVWA, logging on first if the
+// client has no token yet. When the vault rejects the token the client logs
+// on again, once, and replays the request if it is idempotent; other
+// requests return the 401 so that the caller can decide. The caller closes
+// the response body.
+func (c *Client) do(ctx context.Context, method, path string, body []byte) (*http.Response, error) {
+	token, err := c.ensureToken(ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	for replayed := false; ; replayed = true {
+		resp, err := c.send(ctx, method, path, body, token)
+		if err != nil {
+			return nil, err
+		}
+
+		if resp.StatusCode != http.StatusUnauthorized || replayed || !c.canLogon() {
+			if resp.StatusCode < http.StatusBadRequest {
+				c.touch(token)
+			}
+			return resp, nil
+		}
+
+		rejected := newAPIError(resp, "authentication failed or token expired")
+		resp.Body.Close()
+
+		token, err = c.refreshToken(ctx, token)
+		if err != nil {
+			return nil, fmt.Errorf("log on again after the token was rejected: %w", err)
+		}
+		if !idempotent(method) {
+			return nil, rejected
+		}
+	}
+}
+
+// send performs a single request with the given token
+func (c *Client) send(ctx context.Context, method, path string, body []byte, token string) (*http.Response, error) {
+	var reader io.Reader
+	if body != nil {
+		reader = bytes.NewReader(body)
+	}
+
+	req, err := http.NewRequestWithContext(ctx, method, c.baseURL+path, reader)
+	if err != nil {
+		return nil, fmt.Errorf("create request: %w", err)
+	}
+
+	req.Header.Set("Authorization", c.authorization(token))
+	req.Header.Set("Content-Type", "application/json")
+
+	resp, err := c.roundTrip(req)
+	if err != nil {
+		return nil, fmt.Errorf("execute request: %w", err)
+	}
+	return resp, nil
+}
+
+// ensureToken returns the current token, logging on if there is none or it
+// is about to expire
+func (c *Client) ensureToken(ctx context.Context) (string, error) {
+	token := c.GetToken()
+	if token != "" && !c.tokenExpiring() {
+		return token, nil
+	}
+	if !c.canLogon() {
+		if token != "" {
+			return token, nil
+		}
+		return "", ErrNotAuthenticated
+	}
+	return c.refreshToken(ctx, token)
+}
+
+// refreshToken logs on to replace a rejected token. Callers that find the
+// token already replaced by a concurrent logon use the new one instead of
+// logging on again.
+func (c *Client) refreshToken(ctx context.Context, rejected string) (string, error) {
+	c.logonMutex.Lock()
+	defer c.logonMutex.Unlock()
+
+	if token := c.GetToken(); token != "" && token != rejected {
+		return token, nil
+	}
+	return c.logon(ctx)
+}
+
+// canLogon reports whether the client has credentials to log on with, as
+// opposed to only a token handed to SetToken. Certificate logons only need
+// the certificate in the TLS configuration.
+func (c *Client) canLogon() bool {
+	return c.username != "" && (c.password != "" || c.logonOptions.Method == AuthMethodPKI)
+}
+
+// idempotent reports whether a request with the given method can safely be
+// sent again
+func idempotent(method string) bool {
+	switch method {
+	case http.MethodGet, http.MethodHead, http.MethodOptions, http.MethodPut, http.MethodDelete:
+		return true
+	}
+	return false
+}
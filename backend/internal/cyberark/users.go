@@ -7,7 +7,6 @@ import (
 	"net/http"
 	"net/url"
 	"strconv"
-	"strings"
 	"time"
 )
 
@@ -105,10 +104,6 @@ type ListUsersOptions struct {
 
 // ListUsers retrieves users from CyberArk with pagination
 func (c *Client) ListUsers(ctx context.Context, opts ListUsersOptions) (*UserListResponse, error) {
-	if !c.IsAuthenticated() {
-		return nil, fmt.Errorf("client not authenticated")
-	}
-
 	// Build query parameters
 	params := url.Values{}
 	params.Set("pageSize", strconv.Itoa(opts.PageSize))
@@ -126,29 +121,10 @@ func (c *Client) ListUsers(ctx context.Context, opts ListUsersOptions) (*UserLis
 		params.Set("extendedDetails", "true")
 	}
 
-	// Build the URL
-	// Ensure base URL has trailing slash
-	baseURL := c.baseURL
-	if !strings.HasSuffix(baseURL, "/") {
-		baseURL += "/"
-	}
-	reqURL := fmt.Sprintf("%sAPI/Users?%s", baseURL, params.Encode())
-
-	// Create request
-	req, err := http.NewRequestWithContext(ctx, "GET", reqURL, nil)
-	if err != nil {
-		return nil, fmt.Errorf("create request: %w", err)
-	}
-
-	// Set headers
-	req.Header.Set("Authorization", c.token)
-	req.Header.Set("Content-Type", "application/json")
-
 	// Execute request
-	httpClient := c.getHTTPClient()
-	resp, err := httpClient.Do(req)
+	resp, err := c.do(ctx, http.MethodGet, "/API/Users?"+params.Encode(), nil)
 	if err != nil {
-		return nil, fmt.Errorf("execute request: %w", err)
+		return nil, err
 	}
 	defer resp.Body.Close()
 
@@ -156,11 +132,11 @@ func (c *Client) ListUsers(ctx context.Context, opts ListUsersOptions) (*UserLis
 	if resp.StatusCode != http.StatusOK {
 		switch resp.StatusCode {
 		case http.StatusUnauthorized:
-			return nil, fmt.Errorf("authentication failed or token expired")
+			return nil, newAPIError(resp, "authentication failed or token expired")
 		case http.StatusForbidden:
-			return nil, fmt.Errorf("insufficient permissions to list users")
+			return nil, newAPIError(resp, "insufficient permissions to list users")
 		default:
-			return nil, fmt.Errorf("request failed with status code: %d", resp.StatusCode)
+			return nil, newAPIError(resp, "")
 		}
 	}
 
@@ -55,9 +55,14 @@ func (db *GormDB) CreateCyberArkInstance(ctx context.Context, instance *models.C
 	gormInstance := &gormmodels.CyberArkInstance{
 		ID:                 ulid.New(ulid.CyberArkInstancePrefix),
 		Name:               instance.Name,
+		InstanceType:       instance.InstanceType,
 		BaseURL:            instance.BaseURL,
+		IdentityURL:        instance.IdentityURL,
 		Username:           instance.Username,
 		PasswordEncrypted:  instance.PasswordEncrypted,
+		ClientCertificate:  instance.ClientCertificate,
+		ClientKeyEncrypted: instance.ClientKeyEncrypted,
+		AuthMethod:         instance.AuthMethod,
 		ConcurrentSessions: instance.ConcurrentSessions,
 		SkipTLSVerify:      instance.SkipTLSVerify,
 		IsActive:           instance.IsActive,
@@ -164,9 +169,14 @@ func convertToInstance(gi *gormmodels.CyberArkInstance) models.CyberArkInstance
 	instance := models.CyberArkInstance{
 		ID:                 gi.ID,
 		Name:               gi.Name,
+		InstanceType:       gi.InstanceType,
 		BaseURL:            gi.BaseURL,
+		IdentityURL:        gi.IdentityURL,
 		Username:           gi.Username,
 		PasswordEncrypted:  gi.PasswordEncrypted,
+		ClientCertificate:  gi.ClientCertificate,
+		ClientKeyEncrypted: gi.ClientKeyEncrypted,
+		AuthMethod:         gi.AuthMethod,
 		ConcurrentSessions: gi.ConcurrentSessions,
 		SkipTLSVerify:      gi.SkipTLSVerify,
 		IsActive:           gi.IsActive,
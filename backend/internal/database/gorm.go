@@ -1,6 +1,7 @@
 package database
 
 import (
+	"errors"
 	"fmt"
 	"log"
 	"os"
@@ -96,8 +97,20 @@ func (db *GormDB) AutoMigrate() error {
 	return db.DB.AutoMigrate(
 		&gormmodels.User{},
 		&gormmodels.Session{},
+		&gormmodels.APIToken{},
+		&gormmodels.UserMFA{},
+		&gormmodels.MFARecoveryCode{},
+		&gormmodels.MFAChallenge{},
+		&gormmodels.LoginThrottle{},
+		&gormmodels.AuditEvent{},
+		&gormmodels.AuditChainHead{},
+		&gormmodels.PasswordHistory{},
+		&gormmodels.Role{},
+		&gormmodels.RoleAssignment{},
 		&gormmodels.CertificateAuthority{},
 		&gormmodels.CyberArkInstance{},
+		&gormmodels.InstanceCertificateAuthority{},
+		&gormmodels.CertificateExpiry{},
 		&gormmodels.CyberArkUser{},
 		&gormmodels.CyberArkGroupMembership{},
 		&gormmodels.CyberArkVaultAuthorization{},
@@ -105,6 +118,8 @@ func (db *GormDB) AutoMigrate() error {
 		&gormmodels.PipelineConfig{},
 		&gormmodels.SyncJob{},
 		&gormmodels.InstanceSyncConfig{},
+		&gormmodels.LeaderLease{},
+		&gormmodels.ClusterEvent{},
 	)
 }
 
@@ -144,49 +159,33 @@ func (db *GormDB) SeedDefaultData() error {
 		}
 	}
 	
-	// Initialize pipeline config defaults
-	defaultConfigs := []struct {
-		Key   string
-		Value string
-		Desc  string
-	}{
-		{
-			Key:   "worker_count",
-			Value: `{"value": 5}`,
-			Desc:  "Number of concurrent pipeline workers",
-		},
-		{
-			Key:   "max_retries",
-			Value: `{"value": 3}`,
-			Desc:  "Maximum retries for failed operations",
-		},
-		{
-			Key:   "poll_interval",
-			Value: `{"value": 5}`,
-			Desc:  "Pipeline poll interval in seconds",
-		},
-	}
-	
-	for _, cfg := range defaultConfigs {
-		var count int64
-		if err := db.Model(&gormmodels.PipelineConfig{}).Where("key = ?", cfg.Key).Count(&count).Error; err != nil {
-			return err
-		}
-		
-		if count == 0 {
-			desc := cfg.Desc
-			config := &gormmodels.PipelineConfig{
-				Key:         cfg.Key,
-				Value:       []byte(cfg.Value),
-				Description: &desc,
-			}
-			
-			if err := db.Create(config).Error; err != nil {
-				return fmt.Errorf("failed to create pipeline config %s: %w", cfg.Key, err)
+	return db.seedSystemRoles()
+}
+
+// seedSystemRoles creates the built-in roles and keeps their permissions up
+// to date
+func (db *GormDB) seedSystemRoles() error {
+	for _, role := range gormmodels.SystemRoles() {
+		var existing gormmodels.Role
+		err := db.Where("name = ?", role.Name).First(&existing).Error
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			role.IsSystem = true
+			if err := db.Create(&role).Error; err != nil {
+				return fmt.Errorf("failed to create role %s: %w", role.Name, err)
 			}
+			continue
+		}
+		if err != nil {
+			return fmt.Errorf("failed to get role %s: %w", role.Name, err)
+		}
+
+		existing.Description = role.Description
+		existing.Permissions = role.Permissions
+		existing.IsSystem = true
+		if err := db.Select("description", "permissions", "is_system").Updates(&existing).Error; err != nil {
+			return fmt.Errorf("failed to update role %s: %w", role.Name, err)
 		}
 	}
-	
 	return nil
 }
 
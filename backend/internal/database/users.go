@@ -148,29 +148,6 @@ func (db *GormDB) DeleteExpiredSessions(ctx context.Context) error {
 	return nil
 }
 
-// UpdateUserPassword updates a user's password using GORM
-func (db *GormDB) UpdateUserPassword(ctx context.Context, username, newPassword string) error {
-	hashedPassword, err := crypto.HashPassword(newPassword)
-	if err != nil {
-		return fmt.Errorf("failed to hash password: %w", err)
-	}
-	
-	result := db.WithContext(ctx).
-		Model(&gormmodels.User{}).
-		Where("username = ?", username).
-		Update("password_hash", hashedPassword)
-	
-	if result.Error != nil {
-		return fmt.Errorf("failed to update password: %w", result.Error)
-	}
-	
-	if result.RowsAffected == 0 {
-		return fmt.Errorf("user not found")
-	}
-	
-	return nil
-}
-
 // convertToUser converts GORM user model to regular user model
 func convertToUser(gu *gormmodels.User) *models.User {
 	return &models.User{
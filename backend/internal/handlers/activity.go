@@ -11,6 +11,7 @@ import (
 	"github.com/sirupsen/logrus"
 
 	"github.com/orca-ng/orca/internal/database"
+	"github.com/orca-ng/orca/internal/middleware"
 	gormmodels "github.com/orca-ng/orca/internal/models/gorm"
 	"github.com/orca-ng/orca/internal/services"
 	"github.com/orca-ng/orca/pkg/ulid"
@@ -60,15 +61,17 @@ func (h *ActivityHandler) ListActivity(c *gin.Context) {
 	offset, _ := strconv.Atoi(c.DefaultQuery("offset", "0"))
 	
 	var items []ActivityItem
+	permissions := middleware.GetPermissions(c)
 	
 	// Get operations if not filtered to sync only
 	if activityType != "sync" {
 		query := h.db.Model(&gormmodels.Operation{}).
 			Preload("CyberArkInstance").
 			Preload("Creator")
+		query = scopeToInstances(query, permissions, gormmodels.PermOperationsRead, "cyber_ark_instance_id")
 			
 		if instanceID != "" {
-			query = query.Where("cyberark_instance_id = ?", instanceID)
+			query = query.Where("cyber_ark_instance_id = ?", instanceID)
 		}
 		if status != "" {
 			query = query.Where("status = ?", status)
@@ -110,6 +113,7 @@ func (h *ActivityHandler) ListActivity(c *gin.Context) {
 		query := h.db.Model(&gormmodels.SyncJob{}).
 			Preload("CyberArkInstance").
 			Preload("CreatedByUser")
+		query = scopeToInstances(query, permissions, gormmodels.PermSyncRead, "cyberark_instance_id")
 			
 		if instanceID != "" {
 			query = query.Where("cyberark_instance_id = ?", instanceID)
@@ -180,6 +184,7 @@ func (h *ActivityHandler) StreamActivity(c *gin.Context) {
 
 	// Create client ID
 	clientID := ulid.New("sseconn")
+	permissions := middleware.GetPermissions(c)
 	
 	// Subscribe to events
 	ctx, cancel := context.WithCancel(c.Request.Context())
@@ -202,7 +207,10 @@ func (h *ActivityHandler) StreamActivity(c *gin.Context) {
 			return
 			
 		case event := <-eventChan:
-			// Send all events (both operations and sync jobs)
+			// Send all events (both operations and sync jobs) the user may see
+			if !canSeeEvent(permissions, event) {
+				continue
+			}
 			eventData, err := services.MarshalEventToJSON(event)
 			if err != nil {
 				h.logger.WithError(err).Error("Failed to marshal activity event")
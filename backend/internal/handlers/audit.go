@@ -0,0 +1,109 @@
+package handlers
+
+import (
+	"context"
+	"net/http"
+	"strconv"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/sirupsen/logrus"
+
+	"github.com/orca-ng/orca/internal/middleware"
+	gormmodels "github.com/orca-ng/orca/internal/models/gorm"
+	"github.com/orca-ng/orca/internal/services"
+)
+
+// newAuditEvent starts an audit event of a request, acted by the logged in
+// user if there is one
+func newAuditEvent(c *gin.Context, action string) *gormmodels.AuditEvent {
+	return middleware.NewAuditEvent(c, action)
+}
+
+// recordAudit stores an audit event. A failure is logged but does not fail
+// the request; audit may be nil when it is not configured.
+func recordAudit(c *gin.Context, audit *services.AuditService, event *gormmodels.AuditEvent) {
+	if audit == nil {
+		return
+	}
+	if err := audit.Record(context.WithoutCancel(c.Request.Context()), event); err != nil {
+		logrus.WithError(err).Error("Failed to record audit event")
+	}
+}
+
+// AuditHandler serves the audit log
+type AuditHandler struct {
+	audit  *services.AuditService
+	logger *logrus.Logger
+}
+
+// NewAuditHandler creates a new audit handler
+func NewAuditHandler(audit *services.AuditService, logger *logrus.Logger) *AuditHandler {
+	return &AuditHandler{
+		audit:  audit,
+		logger: logger,
+	}
+}
+
+// ListEvents returns audit events, newest first, filtered by action (a
+// trailing "*" matches a prefix), actor, target, request ID, client IP and a
+// time range in RFC 3339
+func (h *AuditHandler) ListEvents(c *gin.Context) {
+	query := services.AuditQuery{
+		Action:    c.Query("action"),
+		ActorID:   c.Query("actor_id"),
+		ActorName: c.Query("actor"),
+		Target:    c.Query("target"),
+		RequestID: c.Query("request_id"),
+		ClientIP:  c.Query("client_ip"),
+	}
+	for param, value := range map[string]*time.Time{"since": &query.Since, "until": &query.Until} {
+		if raw := c.Query(param); raw != "" {
+			t, err := time.Parse(time.RFC3339, raw)
+			if err != nil {
+				c.JSON(http.StatusBadRequest, gin.H{"error": param + " must be an RFC 3339 time"})
+				return
+			}
+			*value = t
+		}
+	}
+	for param, value := range map[string]*int{"limit": &query.Limit, "offset": &query.Offset} {
+		if raw := c.Query(param); raw != "" {
+			n, err := strconv.Atoi(raw)
+			if err != nil || n < 0 {
+				c.JSON(http.StatusBadRequest, gin.H{"error": param + " must be a non-negative number"})
+				return
+			}
+			*value = n
+		}
+	}
+
+	events, total, err := h.audit.Query(c.Request.Context(), query)
+	if err != nil {
+		h.logger.WithError(err).Error("Failed to query audit events")
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to retrieve audit events"})
+		return
+	}
+	c.JSON(http.StatusOK, gin.H{
+		"events": events,
+		"count":  len(events),
+		"total":  total,
+	})
+}
+
+// Verify checks the hash chain of the audit log
+func (h *AuditHandler) Verify(c *gin.Context) {
+	result, err := h.audit.Verify(c.Request.Context())
+	if err != nil {
+		h.logger.WithError(err).Error("Failed to verify audit log")
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to verify audit log"})
+		return
+	}
+	if !result.Valid {
+		h.logger.WithFields(logrus.Fields{
+			"broken_at": result.BrokenAt,
+			"problem":   result.Problem,
+		}).Warn("Audit log hash chain is broken")
+	}
+	c.JSON(http.StatusOK, result)
+}
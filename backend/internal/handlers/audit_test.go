@@ -0,0 +1,165 @@
+package handlers_test
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/gin-gonic/gin"
+	"github.com/sirupsen/logrus"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"gorm.io/driver/sqlite"
+	"gorm.io/gorm"
+
+	"github.com/orca-ng/orca/internal/database"
+	"github.com/orca-ng/orca/internal/handlers"
+	"github.com/orca-ng/orca/internal/middleware"
+	"github.com/orca-ng/orca/internal/models"
+	gormmodels "github.com/orca-ng/orca/internal/models/gorm"
+	"github.com/orca-ng/orca/internal/services"
+)
+
+func TestAuditedAdministrativeActions(t *testing.T) {
+	db, err := gorm.Open(sqlite.Open(":memory:"), &gorm.Config{})
+	require.NoError(t, err)
+	require.NoError(t, db.AutoMigrate(
+		&gormmodels.User{},
+		&gormmodels.Role{},
+		&gormmodels.RoleAssignment{},
+		&gormmodels.AuditEvent{},
+		&gormmodels.AuditChainHead{},
+	))
+	gormDB := &database.GormDB{DB: db}
+	admin := &models.User{ID: "usr_admin", Username: "admin", IsAdmin: true}
+	require.NoError(t, db.Create(&gormmodels.User{ID: admin.ID, Username: admin.Username, PasswordHash: "x", IsAdmin: true}).Error)
+
+	logger := logrus.New()
+	auditService := services.NewAuditService(gormDB, logger)
+	roles := handlers.NewRolesHandler(gormDB, logger)
+	audit := handlers.NewAuditHandler(auditService, logger)
+
+	gin.SetMode(gin.TestMode)
+	router := gin.New()
+	router.Use(middleware.RequestID())
+	router.Use(func(c *gin.Context) {
+		c.Set("user", admin)
+		c.Next()
+	})
+	router.POST("/api/roles", middleware.Audit(auditService, gormmodels.AuditRoleCreated), roles.CreateRole)
+	router.PUT("/api/roles/:id", middleware.Audit(auditService, gormmodels.AuditRoleUpdated), roles.UpdateRole)
+	router.GET("/api/audit/events", audit.ListEvents)
+	router.GET("/api/audit/verify", audit.Verify)
+
+	send := func(method, path, body, requestID string) *httptest.ResponseRecorder {
+		req := httptest.NewRequest(method, path, nil)
+		if body != "" {
+			req = httptest.NewRequest(method, path, strings.NewReader(body))
+			req.Header.Set("Content-Type", "application/json")
+		}
+		if requestID != "" {
+			req.Header.Set(middleware.RequestIDHeader, requestID)
+		}
+		req.Header.Set("User-Agent", "audit-test")
+		w := httptest.NewRecorder()
+		router.ServeHTTP(w, req)
+		return w
+	}
+
+	w := send(http.MethodPost, "/api/roles", `{"name":"operators","permissions":["operations:read"]}`, "req-create")
+	require.Equal(t, http.StatusCreated, w.Code, w.Body.String())
+	assert.Equal(t, "req-create", w.Header().Get(middleware.RequestIDHeader))
+	var role gormmodels.Role
+	require.NoError(t, json.Unmarshal(w.Body.Bytes(), &role))
+
+	// A request ID is made up when the client sends none or a bad one
+	w = send(http.MethodPut, "/api/roles/"+role.ID, `{"description":"Runs operations"}`, "bad id\n")
+	require.Equal(t, http.StatusOK, w.Code, w.Body.String())
+	updateRequestID := w.Header().Get(middleware.RequestIDHeader)
+	assert.Len(t, updateRequestID, 32)
+
+	// Failed requests are not recorded
+	require.Equal(t, http.StatusConflict, send(http.MethodPost, "/api/roles", `{"name":"operators","permissions":["operations:read"]}`, "").Code)
+
+	w = send(http.MethodGet, "/api/audit/events?action=role.*", "", "")
+	require.Equal(t, http.StatusOK, w.Code)
+	var list struct {
+		Events []gormmodels.AuditEvent `json:"events"`
+		Total  int64                   `json:"total"`
+	}
+	require.NoError(t, json.Unmarshal(w.Body.Bytes(), &list))
+	require.Len(t, list.Events, 2)
+	assert.Equal(t, int64(2), list.Total)
+
+	updated := list.Events[0]
+	assert.Equal(t, gormmodels.AuditRoleUpdated, updated.Action)
+	assert.Equal(t, "role:"+role.ID, updated.Target)
+	assert.Equal(t, admin.ID, *updated.ActorID)
+	assert.Equal(t, "admin", updated.ActorName)
+	assert.Equal(t, "audit-test", updated.UserAgent)
+	assert.Equal(t, updateRequestID, updated.RequestID)
+	assert.Equal(t, map[string]gormmodels.AuditChange{"description": {After: "Runs operations"}}, updated.Changes)
+
+	created := list.Events[1]
+	assert.Equal(t, gormmodels.AuditRoleCreated, created.Action)
+	assert.Equal(t, "req-create", created.RequestID)
+	assert.Equal(t, "operators", created.Changes["name"].After)
+	assert.Equal(t, created.Hash, updated.PrevHash)
+
+	w = send(http.MethodGet, "/api/audit/events?request_id=req-create", "", "")
+	require.Equal(t, http.StatusOK, w.Code)
+	require.NoError(t, json.Unmarshal(w.Body.Bytes(), &list))
+	assert.Len(t, list.Events, 1)
+
+	assert.Equal(t, http.StatusBadRequest, send(http.MethodGet, "/api/audit/events?since=yesterday", "", "").Code)
+
+	w = send(http.MethodGet, "/api/audit/verify", "", "")
+	require.Equal(t, http.StatusOK, w.Code)
+	var result services.AuditVerification
+	require.NoError(t, json.Unmarshal(w.Body.Bytes(), &result))
+	assert.True(t, result.Valid, result.Problem)
+	assert.Equal(t, int64(2), result.Events)
+
+	require.NoError(t, db.Model(&gormmodels.AuditEvent{}).Where("id = ?", created.ID).Update("actor_name", "nobody").Error)
+	w = send(http.MethodGet, "/api/audit/verify", "", "")
+	require.NoError(t, json.Unmarshal(w.Body.Bytes(), &result))
+	assert.False(t, result.Valid)
+	assert.Equal(t, int64(1), result.BrokenAt)
+}
+
+func TestAuditedRequestFailsWhenEventCannotBeRecorded(t *testing.T) {
+	db, err := gorm.Open(sqlite.Open(":memory:"), &gorm.Config{})
+	require.NoError(t, err)
+	// Without the audit tables no event can be recorded
+	require.NoError(t, db.AutoMigrate(&gormmodels.Role{}))
+	gormDB := &database.GormDB{DB: db}
+
+	logger := logrus.New()
+	logger.SetLevel(logrus.PanicLevel)
+	auditService := services.NewAuditService(gormDB, logger)
+	roles := handlers.NewRolesHandler(gormDB, logger)
+
+	gin.SetMode(gin.TestMode)
+	router := gin.New()
+	router.Use(func(c *gin.Context) {
+		c.Set("user", &models.User{ID: "usr_admin", Username: "admin", IsAdmin: true})
+		c.Next()
+	})
+	router.POST("/api/roles", middleware.Audit(auditService, gormmodels.AuditRoleCreated), roles.CreateRole)
+
+	req := httptest.NewRequest(http.MethodPost, "/api/roles", strings.NewReader(`{"name":"operators","permissions":["operations:read"]}`))
+	req.Header.Set("Content-Type", "application/json")
+	w := httptest.NewRecorder()
+	router.ServeHTTP(w, req)
+
+	assert.Equal(t, http.StatusInternalServerError, w.Code)
+	assert.JSONEq(t, `{"error":"Failed to record audit event"}`, w.Body.String())
+
+	// Failed requests are passed through untouched
+	w = httptest.NewRecorder()
+	router.ServeHTTP(w, httptest.NewRequest(http.MethodPost, "/api/roles", strings.NewReader(`{`)))
+	assert.Equal(t, http.StatusBadRequest, w.Code)
+	assert.Contains(t, w.Body.String(), "error")
+}
@@ -12,6 +12,7 @@ import (
 	"github.com/orca-ng/orca/internal/database"
 	"github.com/orca-ng/orca/internal/models"
 	gormmodels "github.com/orca-ng/orca/internal/models/gorm"
+	"github.com/orca-ng/orca/internal/services"
 	"github.com/orca-ng/orca/pkg/crypto"
 	"github.com/orca-ng/orca/pkg/session"
 	"github.com/sirupsen/logrus"
@@ -20,15 +21,68 @@ import (
 type AuthHandler struct {
 	db             *database.GormDB
 	sessionTimeout time.Duration
+	localLogin     bool
+	breakGlass     []string
+	oidcEnabled    bool
+	ldap           *services.LDAPAuthenticator
+	provisioner    *services.IdentityProvisioner
+	mfa            *services.MFAService
+	limiter        *services.LoginLimiter
+	audit          *services.AuditService
+	passwords      *services.PasswordPolicy
 }
 
 func NewAuthHandler(db *database.GormDB, sessionTimeout time.Duration) *AuthHandler {
 	return &AuthHandler{
 		db:             db,
 		sessionTimeout: sessionTimeout,
+		localLogin:     true,
 	}
 }
 
+// RestrictLocalLogin allows password login only for the given break-glass
+// accounts, leaving single sign-on for everyone else
+func (h *AuthHandler) RestrictLocalLogin(breakGlassUsers []string) {
+	h.localLogin = false
+	h.breakGlass = breakGlassUsers
+}
+
+// EnableOIDC announces single sign-on to the login page
+func (h *AuthHandler) EnableOIDC() {
+	h.oidcEnabled = true
+}
+
+// EnableLDAP authenticates users without a local account against a
+// directory, creating and updating them on login
+func (h *AuthHandler) EnableLDAP(authenticator *services.LDAPAuthenticator, provisioner *services.IdentityProvisioner) {
+	h.ldap = authenticator
+	h.provisioner = provisioner
+}
+
+// EnableMFA asks password logins for a second factor from users who have
+// enrolled or must enrol
+func (h *AuthHandler) EnableMFA(mfa *services.MFAService) {
+	h.mfa = mfa
+}
+
+// EnablePasswordRehash replaces password hashes made with weaker Argon2
+// parameters than the current ones when their users log in
+func (h *AuthHandler) EnablePasswordRehash(passwords *services.PasswordPolicy) {
+	h.passwords = passwords
+}
+
+func (h *AuthHandler) localLoginAllowed(username string) bool {
+	if h.localLogin {
+		return true
+	}
+	for _, u := range h.breakGlass {
+		if u == username {
+			return true
+		}
+	}
+	return false
+}
+
 func (h *AuthHandler) Login(c *gin.Context) {
 	var req models.LoginRequest
 	if err := c.ShouldBindJSON(&req); err != nil {
@@ -36,105 +90,81 @@ func (h *AuthHandler) Login(c *gin.Context) {
 		return
 	}
 
-	// Get user by username
-	var user gormmodels.User
-	if err := h.db.Where("username = ?", req.Username).First(&user).Error; err != nil {
-		if errors.Is(err, gorm.ErrRecordNotFound) {
-			logrus.WithField("username", req.Username).Debug("User not found")
-			c.JSON(http.StatusUnauthorized, gin.H{"error": "invalid credentials"})
-			return
-		}
-		logrus.WithError(err).Error("Failed to query user")
-		c.JSON(http.StatusInternalServerError, gin.H{"error": "internal server error"})
-		return
-	}
-
-	// Verify password
-	valid, err := crypto.VerifyPassword(req.Password, user.PasswordHash)
-	if err != nil || !valid {
-		logrus.WithError(err).Debug("Invalid password")
-		c.JSON(http.StatusUnauthorized, gin.H{"error": "invalid credentials"})
+	user := h.authenticate(c, req)
+	if user == nil {
 		return
 	}
-
-	// Check if user is active
-	if !user.IsActive {
-		c.JSON(http.StatusForbidden, gin.H{"error": "account is disabled"})
+	if h.challengeMFA(c, user, false) {
 		return
 	}
+	h.finishLogin(c, user, false, nil)
+}
 
-	// Create session
+// finishLogin starts the session of an authenticated user. Browsers get it
+// as a cookie, the CLI in the response. extra is added to the response.
+func (h *AuthHandler) finishLogin(c *gin.Context, user *gormmodels.User, cli bool, extra gin.H) {
 	userAgent := c.Request.UserAgent()
-	clientIP := c.ClientIP()
-	
-	token, err := session.GenerateToken()
-	if err != nil {
-		logrus.WithError(err).Error("Failed to generate session token")
-		c.JSON(http.StatusInternalServerError, gin.H{"error": "failed to create session"})
-		return
+	if cli {
+		userAgent = "CLI"
 	}
-	
-	sess := &gormmodels.Session{
-		UserID:    user.ID,
-		Token:     token,
-		ExpiresAt: time.Now().UTC().Add(h.sessionTimeout),
-	}
-	
-	if userAgent != "" {
-		sess.UserAgent = &userAgent
-	}
-	if clientIP != "" {
-		sess.IPAddress = &clientIP
-	}
-	
-	if err := h.db.Create(sess).Error; err != nil {
+	sess, err := h.startSession(c, user, userAgent)
+	if err != nil {
 		logrus.WithError(err).Error("Failed to create session")
 		c.JSON(http.StatusInternalServerError, gin.H{"error": "failed to create session"})
 		return
 	}
+	h.loginSucceeded(c, user, user.AuthProvider)
 
-	// Update last login
-	now := time.Now().UTC()
-	if err := h.db.Model(&user).Update("last_login_at", now).Error; err != nil {
-		logrus.WithError(err).Error("Failed to update last login")
-		// Don't fail the login for this
-	}
+	var response gin.H
+	if cli {
+		// For CLI, return the token in the response
+		response = gin.H{
+			"token": sess.Token,
+			"expires_at": sess.ExpiresAt,
+			"user": gin.H{
+				"id": user.ID,
+				"username": user.Username,
+				"is_admin": user.IsAdmin,
+			},
+		}
+	} else {
+		h.setSessionCookie(c, sess.Token)
 
-	// Log session creation for debugging
-	logrus.WithFields(logrus.Fields{
-		"session_token": sess.Token,
-		"user_id": user.ID,
-		"expires_at": sess.ExpiresAt,
-	}).Debug("Session created successfully")
-	
-	// Set session cookie
-	c.SetSameSite(http.SameSiteLaxMode)
-	c.SetCookie(
-		"session_token",
-		sess.Token,
-		int(h.sessionTimeout.Seconds()),
-		"/",
-		"",
-		false, // secure - set to true in production with HTTPS
-		true,  // httpOnly
-	)
+		// Convert to old model format for API compatibility
+		userResponse := models.User{
+			ID:          user.ID,
+			Username:    user.Username,
+			CreatedAt:   user.CreatedAt,
+			UpdatedAt:   user.UpdatedAt,
+			LastLoginAt: user.LastLoginAt,
+			IsActive:    user.IsActive,
+			IsAdmin:     user.IsAdmin,
+			AuthProvider: user.AuthProvider,
+		}
 
-	// Convert to old model format for API compatibility
-	userResponse := models.User{
-		ID:          user.ID,
-		Username:    user.Username,
-		CreatedAt:   user.CreatedAt,
-		UpdatedAt:   user.UpdatedAt,
-		LastLoginAt: user.LastLoginAt,
-		IsActive:    user.IsActive,
-		IsAdmin:     user.IsAdmin,
-	}
-
-	// Return response - DO NOT include token in response body for security
-	c.JSON(http.StatusOK, gin.H{
-		"user": userResponse,
-		"message": "login successful",
-	})
+		// Return response - DO NOT include token in response body for security
+		response = gin.H{
+			"user": userResponse,
+			"message": "login successful",
+		}
+	}
+	for key, value := range extra {
+		response[key] = value
+	}
+	c.JSON(http.StatusOK, response)
+}
+
+// Providers tells the login page which ways to log in are available
+func (h *AuthHandler) Providers(c *gin.Context) {
+	response := gin.H{
+		"local": h.localLogin,
+		"oidc":  h.oidcEnabled,
+		"ldap":  h.ldap != nil,
+	}
+	if h.oidcEnabled {
+		response["oidc_login_url"] = oidcLoginPath + "/login"
+	}
+	c.JSON(http.StatusOK, response)
 }
 
 func (h *AuthHandler) Logout(c *gin.Context) {
@@ -180,76 +210,160 @@ func (h *AuthHandler) LoginCLI(c *gin.Context) {
 		return
 	}
 
-	// Get user by username
+	user := h.authenticate(c, req)
+	if user == nil {
+		return
+	}
+	if h.challengeMFA(c, user, true) {
+		return
+	}
+	h.finishLogin(c, user, true, nil)
+}
+
+// authenticate checks the credentials of a login against the local account
+// or, for users without one, the directory. On failure it writes the
+// response and returns nil.
+func (h *AuthHandler) authenticate(c *gin.Context, req models.LoginRequest) *gormmodels.User {
+	if !h.allowAttempt(c, req.Username) {
+		return nil
+	}
+
 	var user gormmodels.User
-	if err := h.db.Where("username = ?", req.Username).First(&user).Error; err != nil {
-		if errors.Is(err, gorm.ErrRecordNotFound) {
-			c.JSON(http.StatusUnauthorized, gin.H{"error": "invalid credentials"})
-			return
-		}
+	err := h.db.Where("username = ?", req.Username).First(&user).Error
+	if err != nil && !errors.Is(err, gorm.ErrRecordNotFound) {
 		logrus.WithError(err).Error("Failed to query user")
 		c.JSON(http.StatusInternalServerError, gin.H{"error": "internal server error"})
-		return
+		return nil
 	}
+	found := err == nil
 
-	// Verify password
-	valid, err := crypto.VerifyPassword(req.Password, user.PasswordHash)
-	if err != nil || !valid {
+	switch {
+	case found && user.AuthProvider == gormmodels.AuthProviderLocal:
+		if !h.localLoginAllowed(req.Username) {
+			h.loginFailed(c, req.Username, &user, loginFailureLocalDisabled)
+			c.JSON(http.StatusForbidden, gin.H{"error": "local login is disabled, use single sign-on"})
+			return nil
+		}
+		valid, err := crypto.VerifyPassword(req.Password, user.PasswordHash)
+		if err != nil || !valid {
+			logrus.WithError(err).Debug("Invalid password")
+			h.loginFailed(c, req.Username, &user, loginFailureInvalidPassword)
+			c.JSON(http.StatusUnauthorized, gin.H{"error": "invalid credentials"})
+			return nil
+		}
+		if h.passwords != nil {
+			if err := h.passwords.Rehash(c.Request.Context(), &user, req.Password); err != nil {
+				logrus.WithError(err).Warn("Failed to rehash password")
+			}
+		}
+	case h.ldap != nil && (!found || user.AuthProvider == gormmodels.AuthProviderLDAP):
+		ldapUser := h.authenticateLDAP(c, req)
+		if ldapUser == nil {
+			return nil
+		}
+		user = *ldapUser
+	case !found && !h.localLoginAllowed(req.Username):
+		h.loginFailed(c, req.Username, nil, loginFailureLocalDisabled)
+		c.JSON(http.StatusForbidden, gin.H{"error": "local login is disabled, use single sign-on"})
+		return nil
+	default:
+		// Unknown users, and accounts of identity providers that have no
+		// password here
+		logrus.WithField("username", req.Username).Debug("User not found")
+		h.loginFailed(c, req.Username, nil, loginFailureUnknownUser)
 		c.JSON(http.StatusUnauthorized, gin.H{"error": "invalid credentials"})
-		return
+		return nil
 	}
 
 	// Check if user is active
 	if !user.IsActive {
+		h.loginFailed(c, req.Username, &user, loginFailureAccountDisabled)
 		c.JSON(http.StatusForbidden, gin.H{"error": "account is disabled"})
-		return
+		return nil
 	}
+	return &user
+}
 
-	// Create session
-	userAgent := "CLI"
-	clientIP := c.ClientIP()
-	
+// authenticateLDAP checks the password against the directory and creates or
+// updates the user from the directory entry
+func (h *AuthHandler) authenticateLDAP(c *gin.Context, req models.LoginRequest) *gormmodels.User {
+	ctx := c.Request.Context()
+	identity, err := h.ldap.Authenticate(ctx, req.Username, req.Password)
+	if err != nil {
+		if errors.Is(err, services.ErrInvalidCredentials) {
+			h.loginFailed(c, req.Username, nil, loginFailureInvalidPassword)
+			c.JSON(http.StatusUnauthorized, gin.H{"error": "invalid credentials"})
+			return nil
+		}
+		logrus.WithError(err).Error("LDAP authentication failed")
+		c.JSON(http.StatusBadGateway, gin.H{"error": "directory unavailable"})
+		return nil
+	}
+
+	user, err := h.provisioner.Provision(ctx, *identity, h.ldap.GroupMapping())
+	if err != nil {
+		if errors.Is(err, services.ErrIdentityConflict) {
+			logrus.WithField("username", identity.Username).Warn("LDAP login conflicts with an existing account")
+			c.JSON(http.StatusConflict, gin.H{"error": "username is already used by another account"})
+			return nil
+		}
+		logrus.WithError(err).Error("Failed to provision LDAP user")
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "internal server error"})
+		return nil
+	}
+	return user
+}
+
+// startSession creates a session for a user who has authenticated and
+// records the login
+func (h *AuthHandler) startSession(c *gin.Context, user *gormmodels.User, userAgent string) (*gormmodels.Session, error) {
 	token, err := session.GenerateToken()
 	if err != nil {
-		logrus.WithError(err).Error("Failed to generate session token")
-		c.JSON(http.StatusInternalServerError, gin.H{"error": "failed to create session"})
-		return
+		return nil, err
 	}
-	
+
 	sess := &gormmodels.Session{
 		UserID:    user.ID,
 		Token:     token,
 		ExpiresAt: time.Now().UTC().Add(h.sessionTimeout),
-		UserAgent: &userAgent,
 	}
-	
-	if clientIP != "" {
+	if userAgent != "" {
+		sess.UserAgent = &userAgent
+	}
+	if clientIP := c.ClientIP(); clientIP != "" {
 		sess.IPAddress = &clientIP
 	}
-	
 	if err := h.db.Create(sess).Error; err != nil {
-		logrus.WithError(err).Error("Failed to create session")
-		c.JSON(http.StatusInternalServerError, gin.H{"error": "failed to create session"})
-		return
+		return nil, err
 	}
 
 	// Update last login
 	now := time.Now().UTC()
-	if err := h.db.Model(&user).Update("last_login_at", now).Error; err != nil {
+	if err := h.db.Model(user).Update("last_login_at", now).Error; err != nil {
 		logrus.WithError(err).Error("Failed to update last login")
 		// Don't fail the login for this
 	}
 
-	// For CLI, return the token in the response
-	c.JSON(http.StatusOK, gin.H{
-		"token": sess.Token,
+	logrus.WithFields(logrus.Fields{
+		"user_id":    user.ID,
 		"expires_at": sess.ExpiresAt,
-		"user": gin.H{
-			"id": user.ID,
-			"username": user.Username,
-			"is_admin": user.IsAdmin,
-		},
-	})
+	}).Debug("Session created successfully")
+
+	return sess, nil
+}
+
+// setSessionCookie hands the session token to the browser
+func (h *AuthHandler) setSessionCookie(c *gin.Context, token string) {
+	c.SetSameSite(http.SameSiteLaxMode)
+	c.SetCookie(
+		"session_token",
+		token,
+		int(h.sessionTimeout.Seconds()),
+		"/",
+		"",
+		false, // secure - set to true in production with HTTPS
+		true,  // httpOnly
+	)
 }
 
 func (h *AuthHandler) GetSessionByToken(ctx context.Context, token string) (*gormmodels.Session, *gormmodels.User, error) {
@@ -269,8 +383,52 @@ func (h *AuthHandler) GetSessionByToken(ctx context.Context, token string) (*gor
 	return &sess, &sess.User, nil
 }
 
+// apiTokenUseInterval limits how often the last use of an API token is
+// written, rather than on every request
+const apiTokenUseInterval = time.Minute
+
+// GetAPIToken returns an active API token with its service account
+func (h *AuthHandler) GetAPIToken(ctx context.Context, token, clientIP string) (*gormmodels.APIToken, *gormmodels.User, error) {
+	var apiToken gormmodels.APIToken
+	if err := h.db.WithContext(ctx).
+		Preload("User").
+		Where("token_hash = ?", session.HashAPIToken(token)).
+		First(&apiToken).Error; err != nil {
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			return nil, nil, errors.New("API token not found")
+		}
+		return nil, nil, err
+	}
+
+	now := time.Now().UTC()
+	if !apiToken.Active(now) || apiToken.User == nil {
+		return nil, nil, errors.New("API token revoked or expired")
+	}
+
+	if apiToken.LastUsedAt == nil || now.Sub(*apiToken.LastUsedAt) >= apiTokenUseInterval {
+		apiToken.LastUsedAt = &now
+		apiToken.LastUsedIP = &clientIP
+		// Not through apiToken, which would save the preloaded user too
+		if err := h.db.WithContext(ctx).Model(&gormmodels.APIToken{}).Where("id = ?", apiToken.ID).Updates(map[string]interface{}{
+			"last_used_at": now,
+			"last_used_ip": clientIP,
+		}).Error; err != nil {
+			logrus.WithError(err).Warn("Failed to record API token use")
+		}
+	}
+
+	return &apiToken, apiToken.User, nil
+}
+
+// DeleteExpiredSessions deletes expired sessions and unfinished MFA logins
 func (h *AuthHandler) DeleteExpiredSessions(ctx context.Context) error {
+	now := time.Now().UTC()
+	if err := h.db.WithContext(ctx).
+		Where("expires_at < ?", now).
+		Delete(&gormmodels.MFAChallenge{}).Error; err != nil {
+		return err
+	}
 	return h.db.WithContext(ctx).
-		Where("expires_at < ?", time.Now().UTC()).
+		Where("expires_at < ?", now).
 		Delete(&gormmodels.Session{}).Error
 }
\ No newline at end of file
@@ -0,0 +1,52 @@
+package handlers
+
+import (
+	"gorm.io/gorm"
+
+	gormmodels "github.com/orca-ng/orca/internal/models/gorm"
+	"github.com/orca-ng/orca/internal/services"
+)
+
+// scopeToInstances limits a query to the rows of instances the permission is
+// held for
+func scopeToInstances(query *gorm.DB, permissions *services.Permissions, permission, column string) *gorm.DB {
+	all, ids := permissions.Instances(permission)
+	if all {
+		return query
+	}
+	if len(ids) == 0 {
+		return query.Where("1 = 0")
+	}
+	return query.Where(column+" IN ?", ids)
+}
+
+// canAccessInstance reports whether the permission is held for a possibly
+// unset instance. Rows without an instance need the permission globally.
+func canAccessInstance(permissions *services.Permissions, permission string, instanceID *string) bool {
+	if instanceID == nil || *instanceID == "" {
+		return permissions.Has(permission)
+	}
+	return permissions.HasOnInstance(permission, *instanceID)
+}
+
+// canSeeCertificateExpiry reports whether an expiry result may be shown. PVWA
+// results belong to their instance.
+func canSeeCertificateExpiry(permissions *services.Permissions, expiry *gormmodels.CertificateExpiry) bool {
+	if expiry.SourceType == gormmodels.ExpirySourcePVWA {
+		return permissions.HasOnInstance(gormmodels.PermInstancesRead, expiry.SourceID)
+	}
+	return permissions.HasAnywhere(gormmodels.PermCertificatesRead)
+}
+
+// canSeeEvent reports whether an event may be streamed to a user
+func canSeeEvent(permissions *services.Permissions, event *services.OperationEvent) bool {
+	switch {
+	case event.Operation != nil:
+		return canAccessInstance(permissions, gormmodels.PermOperationsRead, event.Operation.CyberArkInstanceID)
+	case event.SyncJob != nil:
+		return permissions.HasOnInstance(gormmodels.PermSyncRead, event.SyncJob.CyberArkInstanceID)
+	case event.CertificateExpiry != nil:
+		return canSeeCertificateExpiry(permissions, event.CertificateExpiry)
+	}
+	return false
+}
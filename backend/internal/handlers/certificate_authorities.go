@@ -3,15 +3,19 @@ package handlers
 import (
 	"context"
 	"encoding/json"
+	"encoding/pem"
 	"errors"
 	"net/http"
+	"strconv"
 	"strings"
+	"time"
 
 	"github.com/gin-gonic/gin"
 	"github.com/sirupsen/logrus"
 	"gorm.io/gorm"
 	
 	"github.com/orca-ng/orca/internal/database"
+	"github.com/orca-ng/orca/internal/middleware"
 	"github.com/orca-ng/orca/internal/models"
 	gormmodels "github.com/orca-ng/orca/internal/models/gorm"
 	"github.com/orca-ng/orca/internal/services"
@@ -193,6 +197,9 @@ func (h *CertificateAuthoritiesHandler) Create(c *gin.Context) {
 		return
 	}
 	
+	middleware.SetAuditTarget(c, "ca:"+ca.ID)
+	middleware.SetAuditChanges(c, nil, ca)
+
 	h.logger.WithFields(logrus.Fields{
 		"ca_id": ca.ID,
 		"name":  ca.Name,
@@ -268,6 +275,10 @@ func (h *CertificateAuthoritiesHandler) Update(c *gin.Context) {
 	// Update with user context
 	ctx := context.WithValue(c.Request.Context(), "user_id", userID)
 	
+	// Kept for the audit log, a missing CA is reported by the update
+	var before gormmodels.CertificateAuthority
+	h.db.First(&before, "id = ?", id)
+
 	var ca gormmodels.CertificateAuthority
 	result := h.db.WithContext(ctx).Model(&ca).Where("id = ?", id).Updates(updates)
 	
@@ -293,6 +304,9 @@ func (h *CertificateAuthoritiesHandler) Update(c *gin.Context) {
 		return
 	}
 	
+	middleware.SetAuditTarget(c, "ca:"+ca.ID)
+	middleware.SetAuditChanges(c, &before, &ca)
+
 	h.logger.WithFields(logrus.Fields{
 		"ca_id": ca.ID,
 		"user_id": userID,
@@ -334,6 +348,20 @@ func (h *CertificateAuthoritiesHandler) Update(c *gin.Context) {
 func (h *CertificateAuthoritiesHandler) Delete(c *gin.Context) {
 	id := c.Param("id")
 	
+	// Instances bound to the CA would no longer connect
+	var bound int64
+	if err := h.db.Model(&gormmodels.InstanceCertificateAuthority{}).Where("certificate_authority_id = ?", id).Count(&bound).Error; err != nil {
+		h.logger.WithError(err).Error("Failed to check certificate authority usage")
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to delete certificate authority"})
+		return
+	}
+	if bound > 0 {
+		c.JSON(http.StatusConflict, gin.H{"error": "Certificate authority is trusted by CyberArk instances; remove it from them first"})
+		return
+	}
+	
+	var ca gormmodels.CertificateAuthority
+	h.db.First(&ca, "id = ?", id)
 	result := h.db.Delete(&gormmodels.CertificateAuthority{}, "id = ?", id)
 	if result.Error != nil {
 		h.logger.WithError(result.Error).Error("Failed to delete certificate authority")
@@ -346,6 +374,9 @@ func (h *CertificateAuthoritiesHandler) Delete(c *gin.Context) {
 		return
 	}
 	
+	middleware.SetAuditTarget(c, "ca:"+id)
+	middleware.SetAuditChanges(c, &ca, nil)
+
 	userInterface, _ := c.Get("user")
 	user := userInterface.(*models.User)
 	h.logger.WithFields(logrus.Fields{
@@ -362,6 +393,65 @@ func (h *CertificateAuthoritiesHandler) Delete(c *gin.Context) {
 	c.JSON(http.StatusOK, gin.H{"message": "Certificate authority deleted successfully"})
 }
 
+// FetchChain retrieves the certificate chain a server such as a PVWA presents,
+// so that its CA certificates can be reviewed and registered
+func (h *CertificateAuthoritiesHandler) FetchChain(c *gin.Context) {
+	var req models.FetchCertificateChainRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+	
+	chain, err := services.FetchServerChain(c.Request.Context(), req.URL, 10*time.Second)
+	if err != nil {
+		c.JSON(http.StatusBadGateway, gin.H{"error": err.Error()})
+		return
+	}
+	
+	var fingerprints []string
+	for _, cert := range chain {
+		fingerprints = append(fingerprints, services.CertificateFingerprint(cert))
+	}
+	var registered []string
+	if err := h.db.Model(&gormmodels.CertificateAuthority{}).Where("fingerprint IN ?", fingerprints).Pluck("fingerprint", &registered).Error; err != nil {
+		h.logger.WithError(err).Error("Failed to check registered certificate authorities")
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to check registered certificate authorities"})
+		return
+	}
+	isRegistered := make(map[string]bool)
+	for _, fingerprint := range registered {
+		isRegistered[fingerprint] = true
+	}
+	
+	response := models.FetchCertificateChainResponse{URL: req.URL}
+	var caPEM strings.Builder
+	for i, cert := range chain {
+		certPEM := string(pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE", Bytes: cert.Raw}))
+		response.Certificates = append(response.Certificates, models.ServerCertificateInfo{
+			CertificateChainInfo: models.CertificateChainInfo{
+				Subject:      cert.Subject.String(),
+				Issuer:       cert.Issuer.String(),
+				Fingerprint:  fingerprints[i],
+				NotBefore:    cert.NotBefore,
+				NotAfter:     cert.NotAfter,
+				IsCA:         cert.IsCA,
+				IsSelfSigned: cert.Subject.String() == cert.Issuer.String(),
+			},
+			SPKIFingerprint: services.SPKIFingerprint(cert),
+			Certificate:     certPEM,
+			Registered:      isRegistered[fingerprints[i]],
+		})
+		if cert.IsCA {
+			caPEM.WriteString(certPEM)
+		}
+	}
+	response.CACertificate = caPEM.String()
+	
+	middleware.SetAuditTarget(c, "url:"+req.URL)
+	middleware.AddAuditDetail(c, "certificates", strconv.Itoa(len(chain)))
+	c.JSON(http.StatusOK, response)
+}
+
 // RefreshPool forces a refresh of the certificate pool
 // This is useful when certificates have been modified directly in the database
 func (h *CertificateAuthoritiesHandler) RefreshPool(c *gin.Context) {
@@ -381,5 +471,6 @@ func (h *CertificateAuthoritiesHandler) RefreshPool(c *gin.Context) {
 		return
 	}
 	
+	middleware.SetAuditTarget(c, "ca_pool")
 	c.JSON(http.StatusOK, gin.H{"message": "Certificate pool refreshed successfully"})
 }
\ No newline at end of file
@@ -34,7 +34,7 @@ func setupTestDB(t *testing.T) *database.GormDB {
 	require.NoError(t, err)
 
 	// Auto-migrate the schema
-	err = db.AutoMigrate(&gormmodels.CertificateAuthority{})
+	err = db.AutoMigrate(&gormmodels.CertificateAuthority{}, &gormmodels.InstanceCertificateAuthority{})
 	require.NoError(t, err)
 
 	return &database.GormDB{DB: db}
@@ -61,6 +61,7 @@ func setupTestRouter(handler *handlers.CertificateAuthoritiesHandler) *gin.Engin
 	api.POST("/certificate-authorities", handler.Create)
 	api.PUT("/certificate-authorities/:id", handler.Update)
 	api.DELETE("/certificate-authorities/:id", handler.Delete)
+	api.POST("/certificate-authorities/fetch-chain", handler.FetchChain)
 
 	return router
 }
@@ -450,4 +451,75 @@ func TestCertificateChainValidation_ComplexScenarios(t *testing.T) {
 		require.NoError(t, err)
 		assert.Contains(t, response["error"], "already registered")
 	})
-}
\ No newline at end of file
+}
+func TestFetchChainOffersServerCAForImport(t *testing.T) {
+	db := setupTestDB(t)
+	logger := logrus.New()
+	certManager := services.NewCertificateManager(db, logger)
+	handler := handlers.NewCertificateAuthoritiesHandler(db, logger, certManager)
+	router := setupTestRouter(handler)
+
+	// httptest serves a self-signed CA certificate
+	server := httptest.NewTLSServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {}))
+	defer server.Close()
+
+	fetch := func() models.FetchCertificateChainResponse {
+		body, _ := json.Marshal(models.FetchCertificateChainRequest{URL: server.URL})
+		w := httptest.NewRecorder()
+		router.ServeHTTP(w, httptest.NewRequest(http.MethodPost, "/api/certificate-authorities/fetch-chain", bytes.NewReader(body)))
+		require.Equal(t, http.StatusOK, w.Code, w.Body.String())
+		var response models.FetchCertificateChainResponse
+		require.NoError(t, json.Unmarshal(w.Body.Bytes(), &response))
+		return response
+	}
+
+	chain := fetch()
+	require.Len(t, chain.Certificates, 1)
+	assert.Equal(t, services.CertificateFingerprint(server.Certificate()), chain.Certificates[0].Fingerprint)
+	assert.Equal(t, services.SPKIFingerprint(server.Certificate()), chain.Certificates[0].SPKIFingerprint)
+	assert.False(t, chain.Certificates[0].Registered)
+	require.NotEmpty(t, chain.CACertificate)
+
+	// The offered certificate can be registered as is
+	body, _ := json.Marshal(models.CreateCertificateAuthorityRequest{Name: "PVWA", Certificate: chain.CACertificate})
+	w := httptest.NewRecorder()
+	router.ServeHTTP(w, httptest.NewRequest(http.MethodPost, "/api/certificate-authorities", bytes.NewReader(body)))
+	require.Equal(t, http.StatusCreated, w.Code, w.Body.String())
+	assert.True(t, fetch().Certificates[0].Registered)
+
+	// Unreachable servers are reported as such
+	body, _ = json.Marshal(models.FetchCertificateChainRequest{URL: "https://127.0.0.1:1"})
+	w = httptest.NewRecorder()
+	router.ServeHTTP(w, httptest.NewRequest(http.MethodPost, "/api/certificate-authorities/fetch-chain", bytes.NewReader(body)))
+	assert.Equal(t, http.StatusBadGateway, w.Code)
+}
+
+func TestDeleteCertificateAuthorityTrustedByInstance(t *testing.T) {
+	db := setupTestDB(t)
+	logger := logrus.New()
+	certManager := services.NewCertificateManager(db, logger)
+	handler := handlers.NewCertificateAuthoritiesHandler(db, logger, certManager)
+	router := setupTestRouter(handler)
+
+	key := generatePrivateKey(t)
+	template := createCertTemplate("Bound Root CA", true)
+	certPEM := encodeCertToPEM(createAndSignCertificate(t, template, template, &key.PublicKey, key))
+	body, _ := json.Marshal(models.CreateCertificateAuthorityRequest{Name: "Bound Root CA", Certificate: certPEM})
+	w := httptest.NewRecorder()
+	router.ServeHTTP(w, httptest.NewRequest(http.MethodPost, "/api/certificate-authorities", bytes.NewReader(body)))
+	require.Equal(t, http.StatusCreated, w.Code, w.Body.String())
+	var ca models.CertificateAuthority
+	require.NoError(t, json.Unmarshal(w.Body.Bytes(), &ca))
+
+	binding := gormmodels.InstanceCertificateAuthority{CyberArkInstanceID: "cai_test", CertificateAuthorityID: ca.ID}
+	require.NoError(t, db.Create(&binding).Error)
+
+	w = httptest.NewRecorder()
+	router.ServeHTTP(w, httptest.NewRequest(http.MethodDelete, "/api/certificate-authorities/"+ca.ID, nil))
+	assert.Equal(t, http.StatusConflict, w.Code)
+
+	require.NoError(t, db.Delete(&binding).Error)
+	w = httptest.NewRecorder()
+	router.ServeHTTP(w, httptest.NewRequest(http.MethodDelete, "/api/certificate-authorities/"+ca.ID, nil))
+	assert.Equal(t, http.StatusOK, w.Code)
+}
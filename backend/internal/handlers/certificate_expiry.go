@@ -0,0 +1,79 @@
+package handlers
+
+import (
+	"net/http"
+
+	"github.com/gin-gonic/gin"
+	"github.com/sirupsen/logrus"
+
+	"github.com/orca-ng/orca/internal/database"
+	"github.com/orca-ng/orca/internal/middleware"
+	gormmodels "github.com/orca-ng/orca/internal/models/gorm"
+	"github.com/orca-ng/orca/internal/services"
+)
+
+// CertificateExpiryHandler exposes the results of the certificate expiry monitor
+type CertificateExpiryHandler struct {
+	db      *database.GormDB
+	logger  *logrus.Logger
+	monitor *services.CertificateExpiryMonitor
+}
+
+// NewCertificateExpiryHandler creates a new certificate expiry handler
+func NewCertificateExpiryHandler(db *database.GormDB, logger *logrus.Logger, monitor *services.CertificateExpiryMonitor) *CertificateExpiryHandler {
+	return &CertificateExpiryHandler{
+		db:      db,
+		logger:  logger,
+		monitor: monitor,
+	}
+}
+
+// List returns the monitored certificates, soonest to expire first. They can
+// be filtered by status and source_type.
+func (h *CertificateExpiryHandler) List(c *gin.Context) {
+	query := h.db.Model(&gormmodels.CertificateExpiry{})
+	if status := c.Query("status"); status != "" {
+		query = query.Where("status = ?", status)
+	}
+	if sourceType := c.Query("source_type"); sourceType != "" {
+		query = query.Where("source_type = ?", sourceType)
+	}
+
+	var results []gormmodels.CertificateExpiry
+	if err := query.Order("not_after ASC").Find(&results).Error; err != nil {
+		h.logger.WithError(err).Error("Failed to get certificate expiry results")
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to retrieve certificate expiry results"})
+		return
+	}
+
+	// PVWA results only for instances the user may read
+	permissions := middleware.GetPermissions(c)
+	certificates := make([]gormmodels.CertificateExpiry, 0, len(results))
+	for i := range results {
+		if canSeeCertificateExpiry(permissions, &results[i]) {
+			certificates = append(certificates, results[i])
+		}
+	}
+
+	c.JSON(http.StatusOK, gin.H{
+		"certificates": certificates,
+		"count":        len(certificates),
+		"thresholds":   h.monitor.Thresholds(),
+	})
+}
+
+// Check runs the expiry check now instead of waiting for the next scheduled one
+func (h *CertificateExpiryHandler) Check(c *gin.Context) {
+	certificates, err := h.monitor.Check(c.Request.Context())
+	if err != nil {
+		h.logger.WithError(err).Error("Certificate expiry check failed")
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Certificate expiry check failed"})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{
+		"certificates": certificates,
+		"count":        len(certificates),
+		"thresholds":   h.monitor.Thresholds(),
+	})
+}
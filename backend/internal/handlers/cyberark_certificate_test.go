@@ -42,6 +42,7 @@ func TestCyberArkConnectionWithCertificateChain(t *testing.T) {
 	err = db.AutoMigrate(
 		&gormmodels.CertificateAuthority{},
 		&gormmodels.CyberArkInstance{},
+		&gormmodels.InstanceCertificateAuthority{},
 		&gormmodels.User{},
 		&gormmodels.Session{},
 	)
@@ -55,7 +56,7 @@ func TestCyberArkConnectionWithCertificateChain(t *testing.T) {
 	
 	// Setup handlers
 	caHandler := handlers.NewCertificateAuthoritiesHandler(gormDB, logger, certManager)
-	cyberarkHandler := handlers.NewCyberArkInstancesHandler(gormDB, logger, "test-encryption-key-32-bytes-long!", certManager)
+	cyberarkHandler := handlers.NewCyberArkInstancesHandler(gormDB, logger, "test-encryption-key-32-bytes-long!", certManager, nil)
 	
 	// Setup router
 	gin.SetMode(gin.TestMode)
@@ -3,7 +3,9 @@ package handlers
 import (
 	"context"
 	"errors"
+	"fmt"
 	"net/http"
+	"strings"
 	"time"
 
 	"github.com/gin-gonic/gin"
@@ -25,24 +27,36 @@ type CyberArkInstancesHandler struct {
 	logger    *logrus.Logger
 	encryptor *crypto.Encryptor
 	certManager *services.CertificateManager
+	certService *services.CertificateService
+	guards    *cyberark.GuardRegistry
 }
 
-// NewCyberArkInstancesHandlerGorm creates a new CyberArk instances handler
-func NewCyberArkInstancesHandler(db *database.GormDB, logger *logrus.Logger, encryptionKey string, certManager *services.CertificateManager) *CyberArkInstancesHandler {
+// Limits given to new instances that do not specify their own
+const (
+	defaultRequestsPerSecond   = 10
+	defaultMaxInFlightRequests = 5
+)
+
+// NewCyberArkInstancesHandlerGorm creates a new CyberArk instances handler.
+// guards holds the circuit breakers reported with each instance and may be nil.
+func NewCyberArkInstancesHandler(db *database.GormDB, logger *logrus.Logger, encryptionKey string, certManager *services.CertificateManager, guards *cyberark.GuardRegistry) *CyberArkInstancesHandler {
 	return &CyberArkInstancesHandler{
 		db:        db,
 		logger:    logger,
 		encryptor: crypto.NewEncryptor(encryptionKey),
 		certManager: certManager,
+		certService: services.NewCertificateService(),
+		guards:    guards,
 	}
 }
 
-// ListInstances returns all CyberArk instances
+// ListInstances returns the CyberArk instances the user may read
 func (h *CyberArkInstancesHandler) ListInstances(c *gin.Context) {
 	// Check if user wants only active instances
 	onlyActive := c.Query("active") == "true"
 
 	query := h.db.Model(&gormmodels.CyberArkInstance{})
+	query = scopeToInstances(query, middleware.GetPermissions(c), gormmodels.PermInstancesRead, "id")
 	if onlyActive {
 		query = query.Where("is_active = ?", true)
 	}
@@ -57,20 +71,7 @@ func (h *CyberArkInstancesHandler) ListInstances(c *gin.Context) {
 	// Convert to response format (decrypt passwords)
 	var response []models.CyberArkInstanceInfo
 	for _, inst := range instances {
-		info := models.CyberArkInstanceInfo{
-			ID:                 inst.ID,
-			Name:               inst.Name,
-			BaseURL:            inst.BaseURL,
-			Username:           inst.Username,
-			ConcurrentSessions: inst.ConcurrentSessions,
-			SkipTLSVerify:      inst.SkipTLSVerify,
-			IsActive:           inst.IsActive,
-			LastTestAt:         inst.LastTestAt,
-			LastTestSuccess:    inst.LastTestSuccess,
-			LastTestError:      inst.LastTestError,
-			CreatedAt:          inst.CreatedAt,
-			UpdatedAt:          inst.UpdatedAt,
-		}
+		info := h.instanceInfo(&inst)
 		response = append(response, info)
 	}
 
@@ -96,20 +97,7 @@ func (h *CyberArkInstancesHandler) GetInstance(c *gin.Context) {
 	}
 
 	// Convert to response format
-	response := models.CyberArkInstanceInfo{
-		ID:                 instance.ID,
-		Name:               instance.Name,
-		BaseURL:            instance.BaseURL,
-		Username:           instance.Username,
-		ConcurrentSessions: instance.ConcurrentSessions,
-		SkipTLSVerify:      instance.SkipTLSVerify,
-		IsActive:           instance.IsActive,
-		LastTestAt:         instance.LastTestAt,
-		LastTestSuccess:    instance.LastTestSuccess,
-		LastTestError:      instance.LastTestError,
-		CreatedAt:          instance.CreatedAt,
-		UpdatedAt:          instance.UpdatedAt,
-	}
+	response := h.instanceInfo(&instance)
 
 	c.JSON(http.StatusOK, response)
 }
@@ -127,6 +115,11 @@ func (h *CyberArkInstancesHandler) CreateInstance(c *gin.Context) {
 		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
 		return
 	}
+	instanceType, err := parseInstanceType(req.InstanceType, req.IdentityURL)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
 
 	// Check if name already exists
 	var count int64
@@ -148,15 +141,34 @@ func (h *CyberArkInstancesHandler) CreateInstance(c *gin.Context) {
 	if req.SkipTLSVerify != nil {
 		skipTLS = *req.SkipTLSVerify
 	}
-	// Create client with certificate manager
-	clientFactory := func() (*http.Client, error) {
-		return h.certManager.GetHTTPClient(testCtx, skipTLS, 30*time.Second)
+	authMethod, _ := cyberark.ParseAuthMethod(req.AuthMethod)
+	concurrentSessions := true // Default to true if not specified
+	if req.ConcurrentSessions != nil {
+		concurrentSessions = *req.ConcurrentSessions
 	}
+	clientCert, err := h.parseClientCertificate(req.ClientCertificate, req.ClientKey, authMethod)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+	caIDs, pins, ok := h.parseTrust(c, req.TrustedCAIDs, req.PinnedCertificates)
+	if !ok {
+		return
+	}
+	// Create client with certificate manager
+	clientFactory := h.httpClientFactory(testCtx, services.TLSOptions{
+		SkipTLSVerify:     skipTLS,
+		ClientCertificate: clientCert,
+		TrustedCAIDs:      caIDs,
+		Pins:              pins,
+	})
 	client := cyberark.NewClientWithHTTPClientFactory(req.BaseURL, req.Username, req.Password, clientFactory)
+	client.SetInstanceType(instanceType, req.IdentityURL)
+	client.SetLogonOptions(logonOptions(authMethod, concurrentSessions, req.ChallengeResponse))
 	success, message, err := client.TestConnection(testCtx)
 	if err != nil {
 		h.logger.WithError(err).Error("Failed to test CyberArk connection")
-		c.JSON(http.StatusBadRequest, gin.H{"error": "Connection test failed: " + err.Error()})
+		c.JSON(http.StatusBadRequest, withErrorCode(gin.H{"error": "Connection test failed: " + err.Error()}, err))
 		return
 	}
 
@@ -172,30 +184,59 @@ func (h *CyberArkInstancesHandler) CreateInstance(c *gin.Context) {
 		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to secure credentials"})
 		return
 	}
+	var encryptedKey string
+	if clientCert != nil {
+		encryptedKey, err = h.encryptor.Encrypt(req.ClientKey)
+		if err != nil {
+			h.logger.WithError(err).Error("Failed to encrypt client key")
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to secure credentials"})
+			return
+		}
+	}
 
 	// Create the instance
 	user := middleware.GetUser(c)
 	instance := &gormmodels.CyberArkInstance{
 		Name:              req.Name,
+		InstanceType:      string(instanceType),
 		BaseURL:           req.BaseURL,
+		IdentityURL:       req.IdentityURL,
 		Username:          req.Username,
 		PasswordEncrypted: encryptedPassword,
-		ConcurrentSessions: true, // Default to true if not specified
+		AuthMethod:        string(authMethod),
+		ClientKeyEncrypted: encryptedKey,
+		ConcurrentSessions: concurrentSessions,
 		SkipTLSVerify:     false, // Default to false if not specified
 		IsActive:          true,
+		RequestsPerSecond:   defaultRequestsPerSecond,
+		MaxInFlightRequests: defaultMaxInFlightRequests,
+		PinnedCertificates:  pins,
 	}
 	
-	// Override with request values if provided
-	if req.ConcurrentSessions != nil {
-		instance.ConcurrentSessions = *req.ConcurrentSessions
+	if clientCert != nil {
+		instance.ClientCertificate = strings.TrimSpace(req.ClientCertificate)
 	}
+	
+	// Override with request values if provided
 	if req.SkipTLSVerify != nil {
 		instance.SkipTLSVerify = *req.SkipTLSVerify
 	}
+	if req.RequestsPerSecond != nil {
+		instance.RequestsPerSecond = *req.RequestsPerSecond
+	}
+	if req.MaxInFlightRequests != nil {
+		instance.MaxInFlightRequests = *req.MaxInFlightRequests
+	}
 
 	// Create with user context
 	ctx := context.WithValue(c.Request.Context(), "user_id", user.ID)
-	if err := h.db.WithContext(ctx).Create(instance).Error; err != nil {
+	err = h.db.WithContext(ctx).Transaction(func(tx *gorm.DB) error {
+		if err := tx.Create(instance).Error; err != nil {
+			return err
+		}
+		return replaceTrustedCAs(tx, instance.ID, caIDs)
+	})
+	if err != nil {
 		h.logger.WithError(err).Error("Failed to create CyberArk instance")
 		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to create instance"})
 		return
@@ -209,6 +250,12 @@ func (h *CyberArkInstancesHandler) CreateInstance(c *gin.Context) {
 		"last_test_error":   nil,
 	})
 
+	middleware.SetAuditTarget(c, "instance:"+instance.ID)
+	middleware.SetAuditChanges(c, nil, instance)
+	if len(caIDs) > 0 {
+		middleware.AddAuditDetail(c, "trusted_ca_ids", strings.Join(caIDs, ","))
+	}
+
 	h.logger.WithFields(logrus.Fields{
 		"instance_id": instance.ID,
 		"name":        instance.Name,
@@ -216,20 +263,7 @@ func (h *CyberArkInstancesHandler) CreateInstance(c *gin.Context) {
 	}).Info("CyberArk instance created")
 
 	// Convert to response format
-	response := models.CyberArkInstanceInfo{
-		ID:                 instance.ID,
-		Name:               instance.Name,
-		BaseURL:            instance.BaseURL,
-		Username:           instance.Username,
-		ConcurrentSessions: instance.ConcurrentSessions,
-		SkipTLSVerify:      instance.SkipTLSVerify,
-		IsActive:           instance.IsActive,
-		LastTestAt:         instance.LastTestAt,
-		LastTestSuccess:    instance.LastTestSuccess,
-		LastTestError:      instance.LastTestError,
-		CreatedAt:          instance.CreatedAt,
-		UpdatedAt:          instance.UpdatedAt,
-	}
+	response := h.instanceInfo(instance)
 
 	c.JSON(http.StatusCreated, response)
 }
@@ -309,8 +343,79 @@ func (h *CyberArkInstancesHandler) UpdateInstance(c *gin.Context) {
 		testConnection = true
 	}
 
+	newAuthMethod, _ := cyberark.ParseAuthMethod(existing.AuthMethod)
+	if req.AuthMethod != "" && req.AuthMethod != existing.AuthMethod {
+		newAuthMethod, _ = cyberark.ParseAuthMethod(req.AuthMethod)
+		updates["auth_method"] = req.AuthMethod
+		testConnection = true
+	}
+
+	// Use the new client certificate if given, otherwise the stored one
+	var clientCert *services.ClientCertificate
+	if req.ClientCertificate != nil {
+		cert, err := h.parseClientCertificate(*req.ClientCertificate, req.ClientKey, newAuthMethod)
+		if err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+			return
+		}
+		encryptedKey := ""
+		if cert != nil {
+			encryptedKey, err = h.encryptor.Encrypt(req.ClientKey)
+			if err != nil {
+				h.logger.WithError(err).Error("Failed to encrypt client key")
+				c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to secure credentials"})
+				return
+			}
+		}
+		updates["client_certificate"] = strings.TrimSpace(*req.ClientCertificate)
+		updates["client_key_encrypted"] = encryptedKey
+		clientCert = cert
+		testConnection = true
+	} else if newAuthMethod == cyberark.AuthMethodPKI && existing.ClientCertificate == "" {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Certificate logon requires a client certificate"})
+		return
+	}
+
+	var caIDs []string
+	var pins []gormmodels.CertificatePin
+	if req.TrustedCAIDs != nil || req.PinnedCertificates != nil {
+		var trustedCAs []string
+		var pinned []models.CertificatePin
+		if req.TrustedCAIDs != nil {
+			trustedCAs = *req.TrustedCAIDs
+		}
+		if req.PinnedCertificates != nil {
+			pinned = *req.PinnedCertificates
+		}
+		var ok bool
+		if caIDs, pins, ok = h.parseTrust(c, trustedCAs, pinned); !ok {
+			return
+		}
+		testConnection = true
+	}
+
+	newInstanceType := existing.InstanceType
+	newIdentityURL := existing.IdentityURL
+	if req.InstanceType != "" && req.InstanceType != existing.InstanceType {
+		updates["instance_type"] = req.InstanceType
+		newInstanceType = req.InstanceType
+		testConnection = true
+	}
+	if req.IdentityURL != "" && req.IdentityURL != existing.IdentityURL {
+		updates["identity_url"] = req.IdentityURL
+		newIdentityURL = req.IdentityURL
+		testConnection = true
+	}
+	instanceType, err := parseInstanceType(newInstanceType, newIdentityURL)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	newConcurrentSessions := existing.ConcurrentSessions
 	if req.ConcurrentSessions != nil {
 		updates["concurrent_sessions"] = *req.ConcurrentSessions
+		newConcurrentSessions = *req.ConcurrentSessions
 	}
 	
 	if req.SkipTLSVerify != nil {
@@ -320,6 +425,15 @@ func (h *CyberArkInstancesHandler) UpdateInstance(c *gin.Context) {
 	if req.IsActive != nil {
 		updates["is_active"] = *req.IsActive
 	}
+	
+	// Rate limits apply to sessions opened from now on
+	if req.RequestsPerSecond != nil {
+		updates["requests_per_second"] = *req.RequestsPerSecond
+	}
+	
+	if req.MaxInFlightRequests != nil {
+		updates["max_in_flight_requests"] = *req.MaxInFlightRequests
+	}
 
 	// If connection details changed, test the new connection
 	if testConnection {
@@ -343,15 +457,37 @@ func (h *CyberArkInstancesHandler) UpdateInstance(c *gin.Context) {
 		if req.SkipTLSVerify != nil {
 			skipTLS = *req.SkipTLSVerify
 		}
-		// Create client with certificate manager
-		clientFactory := func() (*http.Client, error) {
-			return h.certManager.GetHTTPClient(testCtx, skipTLS, 30*time.Second)
+		if req.ClientCertificate == nil {
+			var err error
+			clientCert, err = h.certService.LoadClientCertificate(existing.ClientCertificate, existing.ClientKeyEncrypted, h.encryptor)
+			if err != nil {
+				h.logger.WithError(err).Error("Failed to load client certificate")
+				c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to retrieve credentials"})
+				return
+			}
 		}
+		tlsOptions, err := h.certManager.InstanceTLSOptions(testCtx, &existing, clientCert)
+		if err != nil {
+			h.logger.WithError(err).Error("Failed to load TLS settings")
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to retrieve instance"})
+			return
+		}
+		tlsOptions.SkipTLSVerify = skipTLS
+		if req.TrustedCAIDs != nil {
+			tlsOptions.TrustedCAIDs = caIDs
+		}
+		if req.PinnedCertificates != nil {
+			tlsOptions.Pins = pins
+		}
+		// Create client with certificate manager
+		clientFactory := h.httpClientFactory(testCtx, tlsOptions)
 		client := cyberark.NewClientWithHTTPClientFactory(newBaseURL, newUsername, testPassword, clientFactory)
+		client.SetInstanceType(instanceType, newIdentityURL)
+		client.SetLogonOptions(logonOptions(newAuthMethod, newConcurrentSessions, req.ChallengeResponse))
 		success, message, err := client.TestConnection(testCtx)
 		if err != nil {
 			h.logger.WithError(err).Error("Failed to test CyberArk connection")
-			c.JSON(http.StatusBadRequest, gin.H{"error": "Connection test failed: " + err.Error()})
+			c.JSON(http.StatusBadRequest, withErrorCode(gin.H{"error": "Connection test failed: " + err.Error()}, err))
 			return
 		}
 
@@ -364,8 +500,24 @@ func (h *CyberArkInstancesHandler) UpdateInstance(c *gin.Context) {
 	// Update the instance
 	user := middleware.GetUser(c)
 	ctx := context.WithValue(c.Request.Context(), "user_id", user.ID)
-	
-	if err := h.db.WithContext(ctx).Model(&existing).Updates(updates).Error; err != nil {
+	before := existing
+
+	err = h.db.WithContext(ctx).Transaction(func(tx *gorm.DB) error {
+		if err := tx.Model(&existing).Updates(updates).Error; err != nil {
+			return err
+		}
+		// Updates with a map bypass the JSON serializer of the pins
+		if req.PinnedCertificates != nil {
+			if err := tx.Model(&existing).Select("pinned_certificates").Updates(&gormmodels.CyberArkInstance{PinnedCertificates: pins}).Error; err != nil {
+				return err
+			}
+		}
+		if req.TrustedCAIDs != nil {
+			return replaceTrustedCAs(tx, existing.ID, caIDs)
+		}
+		return nil
+	})
+	if err != nil {
 		h.logger.WithError(err).Error("Failed to update CyberArk instance")
 		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to update instance"})
 		return
@@ -381,6 +533,21 @@ func (h *CyberArkInstancesHandler) UpdateInstance(c *gin.Context) {
 		})
 	}
 
+	middleware.SetAuditTarget(c, "instance:"+id)
+	var after gormmodels.CyberArkInstance
+	if err := h.db.First(&after, "id = ?", id).Error; err == nil {
+		middleware.SetAuditChanges(c, &before, &after)
+	}
+	// Secrets are left out of the changes, only that they changed is recorded
+	for _, secret := range []string{"password_encrypted", "client_key_encrypted"} {
+		if _, changed := updates[secret]; changed {
+			middleware.AddAuditDetail(c, strings.TrimSuffix(secret, "_encrypted"), "changed")
+		}
+	}
+	if req.TrustedCAIDs != nil {
+		middleware.AddAuditDetail(c, "trusted_ca_ids", strings.Join(caIDs, ","))
+	}
+
 	h.logger.WithFields(logrus.Fields{
 		"instance_id": id,
 		"user_id":     user.ID,
@@ -407,11 +574,27 @@ func (h *CyberArkInstancesHandler) DeleteInstance(c *gin.Context) {
 	}
 
 	// Delete the instance
-	if err := h.db.Delete(&instance).Error; err != nil {
+	err := h.db.Transaction(func(tx *gorm.DB) error {
+		if err := replaceTrustedCAs(tx, instance.ID, nil); err != nil {
+			return err
+		}
+		// Role assignments scoped to the instance go with it
+		if err := tx.Where("cyber_ark_instance_id = ?", instance.ID).Delete(&gormmodels.RoleAssignment{}).Error; err != nil {
+			return err
+		}
+		return tx.Delete(&instance).Error
+	})
+	if err != nil {
 		h.logger.WithError(err).Error("Failed to delete CyberArk instance")
 		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to delete instance"})
 		return
 	}
+	if h.guards != nil {
+		h.guards.Remove(id)
+	}
+
+	middleware.SetAuditTarget(c, "instance:"+id)
+	middleware.SetAuditChanges(c, &instance, nil)
 
 	user := middleware.GetUser(c)
 	h.logger.WithFields(logrus.Fields{
@@ -443,33 +626,66 @@ func (h *CyberArkInstancesHandler) TestConnection(c *gin.Context) {
 	if req.SkipTLSVerify != nil {
 		skipTLS = *req.SkipTLSVerify
 	}
+	instanceType, err := parseInstanceType(req.InstanceType, req.IdentityURL)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+	authMethod, _ := cyberark.ParseAuthMethod(req.AuthMethod)
+	concurrentSessions := true
+	if req.ConcurrentSessions != nil {
+		concurrentSessions = *req.ConcurrentSessions
+	}
+	clientCert, err := h.parseClientCertificate(req.ClientCertificate, req.ClientKey, authMethod)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+	caIDs, pins, ok := h.parseTrust(c, req.TrustedCAIDs, req.PinnedCertificates)
+	if !ok {
+		return
+	}
 
 	// Create client with certificate manager
-	clientFactory := func() (*http.Client, error) {
-		return h.certManager.GetHTTPClient(testCtx, skipTLS, 30*time.Second)
-	}
+	clientFactory := h.httpClientFactory(testCtx, services.TLSOptions{
+		SkipTLSVerify:     skipTLS,
+		ClientCertificate: clientCert,
+		TrustedCAIDs:      caIDs,
+		Pins:              pins,
+	})
 	client := cyberark.NewClientWithHTTPClientFactory(req.BaseURL, req.Username, req.Password, clientFactory)
+	client.SetInstanceType(instanceType, req.IdentityURL)
+	client.SetLogonOptions(logonOptions(authMethod, concurrentSessions, req.ChallengeResponse))
 	
 	success, message, err := client.TestConnection(testCtx)
 	if err != nil {
 		h.logger.WithError(err).Debug("Connection test failed")
-		c.JSON(http.StatusOK, gin.H{
+		c.JSON(http.StatusOK, withClientCertificate(withErrorCode(gin.H{
 			"success": false,
 			"message": err.Error(),
-		})
+		}, err), clientCert))
 		return
 	}
 
-	c.JSON(http.StatusOK, gin.H{
+	c.JSON(http.StatusOK, withClientCertificate(gin.H{
 		"success": success,
 		"message": message,
-	})
+	}, clientCert))
 }
 
 // TestInstanceConnection tests an existing instance's connection
 func (h *CyberArkInstancesHandler) TestInstanceConnection(c *gin.Context) {
 	id := c.Param("id")
 
+	// The body is optional and only needed to answer a RADIUS challenge
+	var req models.TestInstanceConnectionRequest
+	if c.Request.ContentLength > 0 {
+		if err := c.ShouldBindJSON(&req); err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+			return
+		}
+	}
+
 	// Get the instance
 	var instance gormmodels.CyberArkInstance
 	if err := h.db.First(&instance, "id = ?", id).Error; err != nil {
@@ -490,14 +706,29 @@ func (h *CyberArkInstancesHandler) TestInstanceConnection(c *gin.Context) {
 		return
 	}
 
+	clientCert, err := h.certService.LoadClientCertificate(instance.ClientCertificate, instance.ClientKeyEncrypted, h.encryptor)
+	if err != nil {
+		h.logger.WithError(err).Error("Failed to load client certificate")
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to retrieve credentials"})
+		return
+	}
+
 	testCtx, cancel := context.WithTimeout(c.Request.Context(), 30*time.Second)
 	defer cancel()
 
-	// Create client with certificate manager
-	clientFactory := func() (*http.Client, error) {
-		return h.certManager.GetHTTPClient(testCtx, instance.SkipTLSVerify, 30*time.Second)
+	tlsOptions, err := h.certManager.InstanceTLSOptions(testCtx, &instance, clientCert)
+	if err != nil {
+		h.logger.WithError(err).Error("Failed to load TLS settings")
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to retrieve instance"})
+		return
 	}
+
+	// Create client with certificate manager
+	clientFactory := h.httpClientFactory(testCtx, tlsOptions)
 	client := cyberark.NewClientWithHTTPClientFactory(instance.BaseURL, instance.Username, password, clientFactory)
+	client.SetInstanceType(cyberark.InstanceType(instance.InstanceType), instance.IdentityURL)
+	authMethod, _ := cyberark.ParseAuthMethod(instance.AuthMethod)
+	client.SetLogonOptions(logonOptions(authMethod, instance.ConcurrentSessions, req.ChallengeResponse))
 	
 	success, message, err := client.TestConnection(testCtx)
 	testResult := map[string]interface{}{
@@ -527,15 +758,217 @@ func (h *CyberArkInstancesHandler) TestInstanceConnection(c *gin.Context) {
 		if err != nil {
 			responseMsg = err.Error()
 		}
-		c.JSON(http.StatusOK, gin.H{
+		c.JSON(http.StatusOK, withClientCertificate(withErrorCode(gin.H{
 			"success": false,
 			"message": responseMsg,
-		})
+		}, err), clientCert))
 		return
 	}
 
-	c.JSON(http.StatusOK, gin.H{
+	c.JSON(http.StatusOK, withClientCertificate(gin.H{
 		"success": true,
 		"message": message,
-	})
-}
\ No newline at end of file
+	}, clientCert))
+}
+
+// withErrorCode adds the PVWA error code of a failed CyberArk request to an
+// error response, so that the UI can explain common failures such as wrong
+// credentials. An unanswered RADIUS challenge is returned so that the UI can
+// ask for the response and test again.
+func withErrorCode(response gin.H, err error) gin.H {
+	if code := cyberark.ErrorCode(err); code != "" {
+		response["error_code"] = code
+	}
+	var challengeErr *cyberark.ChallengeError
+	if errors.As(err, &challengeErr) {
+		response["error_code"] = cyberark.ErrCodeRadiusChallenge
+		response["challenge"] = challengeErr.Challenge
+	}
+	return response
+}
+
+// parseClientCertificate validates the client certificate and key of a
+// request. It returns nil if neither is given.
+func (h *CyberArkInstancesHandler) parseClientCertificate(certPEM, keyPEM string, authMethod cyberark.AuthMethod) (*services.ClientCertificate, error) {
+	if strings.TrimSpace(certPEM) == "" && strings.TrimSpace(keyPEM) == "" {
+		if authMethod == cyberark.AuthMethodPKI {
+			return nil, fmt.Errorf("certificate logon requires a client certificate")
+		}
+		return nil, nil
+	}
+	if strings.TrimSpace(certPEM) == "" || strings.TrimSpace(keyPEM) == "" {
+		return nil, fmt.Errorf("client_certificate and client_key must be given together")
+	}
+
+	cert, err := h.certService.ParseClientCertificate(certPEM, keyPEM)
+	if err != nil {
+		return nil, err
+	}
+	if time.Now().After(cert.Leaf.NotAfter) {
+		return nil, fmt.Errorf("client certificate expired on %s", cert.Leaf.NotAfter.Format(time.RFC3339))
+	}
+	return cert, nil
+}
+
+// withClientCertificate adds the client certificate used by a connection
+// test to its response, so that its expiry can be shown
+func withClientCertificate(response gin.H, cert *services.ClientCertificate) gin.H {
+	if cert != nil {
+		response["client_certificate"] = clientCertificateInfo(cert.Leaf)
+	}
+	return response
+}
+
+// clientCertificateInfo converts a client certificate to its response format
+func clientCertificateInfo(cert *services.ParsedCertificate) *models.ClientCertificateInfo {
+	return &models.ClientCertificateInfo{
+		Subject:     cert.Subject,
+		Issuer:      cert.Issuer,
+		Fingerprint: cert.Fingerprint,
+		NotBefore:   cert.NotBefore,
+		NotAfter:    cert.NotAfter,
+	}
+}
+
+// httpClientFactory returns a factory of HTTP clients for a connection test
+func (h *CyberArkInstancesHandler) httpClientFactory(ctx context.Context, opts services.TLSOptions) cyberark.HTTPClientFactory {
+	return func() (*http.Client, error) {
+		return h.certManager.GetInstanceHTTPClient(ctx, opts, 30*time.Second)
+	}
+}
+
+// parseTrust validates the trusted certificate authorities and pins of a
+// request. It writes an error response and returns false if they are invalid.
+func (h *CyberArkInstancesHandler) parseTrust(c *gin.Context, caIDs []string, pins []models.CertificatePin) ([]string, []gormmodels.CertificatePin, bool) {
+	var ids []string
+	seen := make(map[string]bool)
+	for _, id := range caIDs {
+		if !seen[id] {
+			seen[id] = true
+			ids = append(ids, id)
+		}
+	}
+
+	if len(ids) > 0 {
+		var count int64
+		if err := h.db.Model(&gormmodels.CertificateAuthority{}).Where("id IN ?", ids).Count(&count).Error; err != nil {
+			h.logger.WithError(err).Error("Failed to check certificate authorities")
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to validate certificate authorities"})
+			return nil, nil, false
+		}
+		if int(count) != len(ids) {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "Unknown certificate authority in trusted_ca_ids"})
+			return nil, nil, false
+		}
+	}
+
+	var parsed []gormmodels.CertificatePin
+	for _, pin := range pins {
+		p, err := services.NormalizePin(gormmodels.CertificatePin{Type: pin.Type, Fingerprint: pin.Fingerprint})
+		if err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+			return nil, nil, false
+		}
+		parsed = append(parsed, p)
+	}
+	return ids, parsed, true
+}
+
+// replaceTrustedCAs binds an instance to the given certificate authorities
+func replaceTrustedCAs(tx *gorm.DB, instanceID string, caIDs []string) error {
+	if err := tx.Where("cyber_ark_instance_id = ?", instanceID).Delete(&gormmodels.InstanceCertificateAuthority{}).Error; err != nil {
+		return err
+	}
+	for _, id := range caIDs {
+		binding := gormmodels.InstanceCertificateAuthority{CyberArkInstanceID: instanceID, CertificateAuthorityID: id}
+		if err := tx.Create(&binding).Error; err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// parseInstanceType validates the instance type of a request and, for
+// Privilege Cloud, its Identity tenant URL
+func parseInstanceType(name, identityURL string) (cyberark.InstanceType, error) {
+	instanceType, err := cyberark.ParseInstanceType(name)
+	if err != nil {
+		return "", err
+	}
+	if instanceType == cyberark.InstanceTypePrivilegeCloud {
+		if identityURL == "" {
+			return "", fmt.Errorf("identity_url is required for Privilege Cloud instances")
+		}
+		if err := cyberark.ValidateURL(identityURL); err != nil {
+			return "", fmt.Errorf("identity_url: %w", err)
+		}
+	}
+	return instanceType, nil
+}
+
+// logonOptions builds the logon options for a connection test
+func logonOptions(method cyberark.AuthMethod, concurrentSessions bool, challengeResponse string) cyberark.LogonOptions {
+	opts := cyberark.LogonOptions{
+		Method:            method,
+		ConcurrentSession: concurrentSessions,
+	}
+	if challengeResponse != "" {
+		opts.ChallengeResponder = cyberark.StaticChallengeResponse(challengeResponse)
+	}
+	return opts
+}
+
+// instanceInfo converts an instance to its response format, including the
+// state of its circuit breaker
+func (h *CyberArkInstancesHandler) instanceInfo(instance *gormmodels.CyberArkInstance) models.CyberArkInstanceInfo {
+	info := models.CyberArkInstanceInfo{
+		ID:                  instance.ID,
+		Name:                instance.Name,
+		InstanceType:        instance.InstanceType,
+		BaseURL:             instance.BaseURL,
+		IdentityURL:         instance.IdentityURL,
+		Username:            instance.Username,
+		AuthMethod:          instance.AuthMethod,
+		ConcurrentSessions:  instance.ConcurrentSessions,
+		SkipTLSVerify:       instance.SkipTLSVerify,
+		IsActive:            instance.IsActive,
+		LastTestAt:          instance.LastTestAt,
+		LastTestSuccess:     instance.LastTestSuccess,
+		LastTestError:       instance.LastTestError,
+		RequestsPerSecond:   instance.RequestsPerSecond,
+		MaxInFlightRequests: instance.MaxInFlightRequests,
+		CreatedAt:           instance.CreatedAt,
+		UpdatedAt:           instance.UpdatedAt,
+	}
+
+	info.TrustedCAIDs = []string{}
+	if err := h.db.Model(&gormmodels.InstanceCertificateAuthority{}).
+		Where("cyber_ark_instance_id = ?", instance.ID).
+		Order("certificate_authority_id").
+		Pluck("certificate_authority_id", &info.TrustedCAIDs).Error; err != nil {
+		h.logger.WithError(err).Warn("Failed to load trusted certificate authorities")
+	}
+	info.PinnedCertificates = []models.CertificatePin{}
+	for _, pin := range instance.PinnedCertificates {
+		info.PinnedCertificates = append(info.PinnedCertificates, models.CertificatePin{Type: pin.Type, Fingerprint: pin.Fingerprint})
+	}
+
+	if instance.ClientCertificate != "" {
+		if cert, err := h.certService.ParseCertificate(instance.ClientCertificate); err == nil {
+			info.ClientCertificate = clientCertificateInfo(cert)
+		}
+	}
+
+	if h.guards != nil {
+		status := h.guards.Status(instance.ID)
+		info.Breaker = &models.CircuitBreakerInfo{
+			State:               string(status.State),
+			ConsecutiveFailures: status.ConsecutiveFailures,
+			OpenedAt:            status.OpenedAt,
+			RetryAt:             status.RetryAt,
+			InFlight:            status.InFlight,
+		}
+	}
+
+	return info
+}
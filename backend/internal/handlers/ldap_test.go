@@ -0,0 +1,142 @@
+package handlers_test
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/sirupsen/logrus"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"gorm.io/driver/sqlite"
+	"gorm.io/gorm"
+
+	"github.com/orca-ng/orca/internal/config"
+	"github.com/orca-ng/orca/internal/database"
+	"github.com/orca-ng/orca/internal/handlers"
+	gormmodels "github.com/orca-ng/orca/internal/models/gorm"
+	"github.com/orca-ng/orca/internal/services"
+	"github.com/orca-ng/orca/internal/services/ldaptest"
+	pkgcrypto "github.com/orca-ng/orca/pkg/crypto"
+)
+
+func setupLDAPTest(t *testing.T) (*gin.Engine, *gorm.DB, *ldaptest.Server) {
+	t.Helper()
+	server, err := ldaptest.NewServer(ldaptest.Options{},
+		ldaptest.Entry{DN: "cn=orca,dc=example,dc=com", Password: "service-secret"},
+		ldaptest.Entry{
+			DN:       "uid=jdoe,ou=people,dc=example,dc=com",
+			Password: "user-secret",
+			Attributes: map[string][]string{
+				"objectClass": {"person"},
+				"uid":         {"jdoe"},
+				"mail":        {"jdoe@example.com"},
+				"memberOf":    {"cn=ops,ou=groups,dc=example,dc=com", "cn=orca-admins,ou=groups,dc=example,dc=com"},
+			},
+		},
+	)
+	require.NoError(t, err)
+	t.Cleanup(server.Close)
+
+	db, err := gorm.Open(sqlite.Open(":memory:"), &gorm.Config{})
+	require.NoError(t, err)
+	require.NoError(t, db.AutoMigrate(&gormmodels.User{}, &gormmodels.Session{}, &gormmodels.Role{}, &gormmodels.RoleAssignment{}))
+	require.NoError(t, db.Create(&gormmodels.Role{Name: "operator", Permissions: []string{gormmodels.PermInstancesRead}}).Error)
+	gormDB := &database.GormDB{DB: db}
+
+	cfg := config.LDAPConfig{
+		Enabled:           true,
+		URL:               server.URL,
+		BindDN:            "cn=orca,dc=example,dc=com",
+		BindPassword:      "service-secret",
+		BaseDN:            "dc=example,dc=com",
+		UserFilter:        "(uid={username})",
+		UsernameAttribute: "uid",
+		EmailAttribute:    "mail",
+		GroupAttribute:    "memberOf",
+		AdminGroups:       []string{"cn=orca-admins,ou=groups,dc=example,dc=com"},
+		GroupRoles:        []config.GroupRoleMapping{{Group: "cn=ops,ou=groups,dc=example,dc=com", Roles: []string{"operator"}}},
+		Timeout:           5,
+	}
+	logger := logrus.New()
+	auth := handlers.NewAuthHandler(gormDB, time.Hour)
+	auth.EnableLDAP(
+		services.NewLDAPAuthenticator(cfg, services.NewCertificateManager(gormDB, logger), logger),
+		services.NewIdentityProvisioner(gormDB, logger),
+	)
+
+	gin.SetMode(gin.TestMode)
+	router := gin.New()
+	router.POST("/api/auth/login", auth.Login)
+	router.POST("/api/auth/login/cli", auth.LoginCLI)
+	return router, db, server
+}
+
+func postLogin(router *gin.Engine, path, username, password string) *httptest.ResponseRecorder {
+	body, _ := json.Marshal(map[string]string{"username": username, "password": password})
+	w := httptest.NewRecorder()
+	router.ServeHTTP(w, httptest.NewRequest(http.MethodPost, path, strings.NewReader(string(body))))
+	return w
+}
+
+func TestLDAPLogin(t *testing.T) {
+	router, db, _ := setupLDAPTest(t)
+
+	w := postLogin(router, "/api/auth/login/cli", "jdoe", "user-secret")
+	require.Equal(t, http.StatusOK, w.Code, w.Body.String())
+	var response struct {
+		Token string `json:"token"`
+	}
+	require.NoError(t, json.Unmarshal(w.Body.Bytes(), &response))
+	assert.NotEmpty(t, response.Token)
+
+	// Created from the directory entry
+	var user gormmodels.User
+	require.NoError(t, db.First(&user, "username = ?", "jdoe").Error)
+	assert.Equal(t, gormmodels.AuthProviderLDAP, user.AuthProvider)
+	assert.Equal(t, "uid=jdoe,ou=people,dc=example,dc=com", *user.ExternalID)
+	assert.Equal(t, "jdoe@example.com", user.Email)
+	assert.True(t, user.IsAdmin)
+	assert.Empty(t, user.PasswordHash)
+
+	var assignments []gormmodels.RoleAssignment
+	require.NoError(t, db.Preload("Role").Find(&assignments, "user_id = ?", user.ID).Error)
+	require.Len(t, assignments, 1)
+	assert.Equal(t, "operator", assignments[0].Role.Name)
+
+	// The web login finds the existing user
+	w = postLogin(router, "/api/auth/login", "jdoe", "user-secret")
+	require.Equal(t, http.StatusOK, w.Code)
+	assert.NotNil(t, sessionCookie(w))
+	var count int64
+	db.Model(&gormmodels.User{}).Count(&count)
+	assert.Equal(t, int64(1), count)
+
+	assert.Equal(t, http.StatusUnauthorized, postLogin(router, "/api/auth/login", "jdoe", "wrong").Code)
+	assert.Equal(t, http.StatusBadRequest, postLogin(router, "/api/auth/login", "jdoe", "").Code)
+	assert.Equal(t, http.StatusUnauthorized, postLogin(router, "/api/auth/login", "nobody", "user-secret").Code)
+
+	// Users disabled in ORCA stay locked out
+	require.NoError(t, db.Model(&user).Update("is_active", false).Error)
+	assert.Equal(t, http.StatusForbidden, postLogin(router, "/api/auth/login", "jdoe", "user-secret").Code)
+}
+
+func TestLDAPLoginKeepsLocalAccounts(t *testing.T) {
+	router, db, server := setupLDAPTest(t)
+	hash, err := pkgcrypto.HashPassword("local-secret")
+	require.NoError(t, err)
+	require.NoError(t, db.Create(&gormmodels.User{Username: "admin", PasswordHash: hash, IsActive: true, IsAdmin: true}).Error)
+
+	// Local accounts are checked locally and never reach the directory
+	assert.Equal(t, http.StatusOK, postLogin(router, "/api/auth/login", "admin", "local-secret").Code)
+	assert.Equal(t, http.StatusUnauthorized, postLogin(router, "/api/auth/login", "admin", "user-secret").Code)
+	assert.Empty(t, server.Binds())
+
+	// Directory outage
+	server.Close()
+	assert.Equal(t, http.StatusBadGateway, postLogin(router, "/api/auth/login", "jdoe", "user-secret").Code)
+}
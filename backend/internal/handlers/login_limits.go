@@ -0,0 +1,195 @@
+package handlers
+
+import (
+	"math"
+	"net/http"
+	"strconv"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/sirupsen/logrus"
+
+	"github.com/orca-ng/orca/internal/models"
+	gormmodels "github.com/orca-ng/orca/internal/models/gorm"
+	"github.com/orca-ng/orca/internal/services"
+)
+
+// Reasons a login failed, as recorded in the audit log
+const (
+	loginFailureUnknownUser     = "unknown_user"
+	loginFailureInvalidPassword = "invalid_password"
+	loginFailureInvalidMFACode  = "invalid_mfa_code"
+	loginFailureAccountDisabled = "account_disabled"
+	loginFailureLocalDisabled   = "local_login_disabled"
+	loginFailureThrottled       = "throttled"
+	loginFailureLockedOut       = "locked_out"
+)
+
+// EnableLoginLimits delays and locks out repeated failed logins
+func (h *AuthHandler) EnableLoginLimits(limiter *services.LoginLimiter) {
+	h.limiter = limiter
+}
+
+// EnableAudit records logins in the audit log
+func (h *AuthHandler) EnableAudit(audit *services.AuditService) {
+	h.audit = audit
+}
+
+// allowAttempt refuses a login attempt for a username or client IP that
+// must wait after earlier failures. On refusal it writes the response and
+// returns false.
+func (h *AuthHandler) allowAttempt(c *gin.Context, username string) bool {
+	if h.limiter == nil {
+		return true
+	}
+	block, err := h.limiter.Check(c.Request.Context(), username, c.ClientIP())
+	if err != nil {
+		// Logins stay possible when the limits cannot be read
+		logrus.WithError(err).Error("Failed to check login limits")
+		return true
+	}
+	if block == nil {
+		return true
+	}
+
+	reason := loginFailureThrottled
+	if block.Locked {
+		reason = loginFailureLockedOut
+	}
+	event := newAuditEvent(c, gormmodels.AuditLoginFailed)
+	event.ActorName = username
+	event.Details = map[string]string{"reason": reason}
+	recordAudit(c, h.audit, event)
+
+	retryAfter := int(math.Ceil(time.Until(block.Until).Seconds()))
+	if retryAfter < 1 {
+		retryAfter = 1
+	}
+	c.Header("Retry-After", strconv.Itoa(retryAfter))
+	c.JSON(http.StatusTooManyRequests, gin.H{
+		"error":       "too many failed logins, try again later",
+		"retry_after": retryAfter,
+	})
+	return false
+}
+
+// loginFailed records a failed login. Wrong credentials and codes count
+// towards the limits; other reasons are only audited. user is nil when the
+// username is unknown.
+func (h *AuthHandler) loginFailed(c *gin.Context, username string, user *gormmodels.User, reason string) {
+	event := newAuditEvent(c, gormmodels.AuditLoginFailed)
+	event.ActorName = username
+	if user != nil {
+		event.ActorID = &user.ID
+		event.ActorName = user.Username
+	}
+	event.Details = map[string]string{"reason": reason}
+	recordAudit(c, h.audit, event)
+
+	counted := reason == loginFailureUnknownUser || reason == loginFailureInvalidPassword || reason == loginFailureInvalidMFACode
+	if h.limiter == nil || !counted {
+		return
+	}
+	locked, err := h.limiter.Failure(c.Request.Context(), username, c.ClientIP())
+	if err != nil {
+		logrus.WithError(err).Error("Failed to record login failure")
+	}
+	for _, throttle := range locked {
+		event := newAuditEvent(c, gormmodels.AuditLoginLocked)
+		event.ActorName = username
+		event.Target = throttle.Kind + ":" + throttle.Subject
+		event.Details = map[string]string{
+			"failures":     strconv.Itoa(throttle.Failures),
+			"locked_until": throttle.LockedUntil.Format(time.RFC3339),
+		}
+		recordAudit(c, h.audit, event)
+	}
+}
+
+// loginSucceeded records a completed login and forgets the failures of its
+// username
+func (h *AuthHandler) loginSucceeded(c *gin.Context, user *gormmodels.User, provider string) {
+	event := newAuditEvent(c, gormmodels.AuditLoginSucceeded)
+	event.ActorID = &user.ID
+	event.ActorName = user.Username
+	event.Details = map[string]string{"provider": provider}
+	recordAudit(c, h.audit, event)
+
+	if h.limiter != nil {
+		if err := h.limiter.Success(c.Request.Context(), user.Username); err != nil {
+			logrus.WithError(err).Warn("Failed to clear login failures")
+		}
+	}
+}
+
+// LockoutHandler lets admins see and lift login lockouts
+type LockoutHandler struct {
+	limiter *services.LoginLimiter
+	audit   *services.AuditService
+	logger  *logrus.Logger
+}
+
+// NewLockoutHandler creates a new lockout handler
+func NewLockoutHandler(limiter *services.LoginLimiter, audit *services.AuditService, logger *logrus.Logger) *LockoutHandler {
+	return &LockoutHandler{
+		limiter: limiter,
+		audit:   audit,
+		logger:  logger,
+	}
+}
+
+// ListLockouts returns the usernames and client IPs that are locked out
+func (h *LockoutHandler) ListLockouts(c *gin.Context) {
+	lockouts, err := h.limiter.Lockouts(c.Request.Context())
+	if err != nil {
+		h.logger.WithError(err).Error("Failed to list lockouts")
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to retrieve lockouts"})
+		return
+	}
+	c.JSON(http.StatusOK, gin.H{
+		"lockouts": lockouts,
+		"count":    len(lockouts),
+	})
+}
+
+// Unlock lifts the lockout of a username or client IP
+func (h *LockoutHandler) Unlock(c *gin.Context) {
+	var req models.UnlockRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+	kind, subject := gormmodels.ThrottleKindUsername, req.Username
+	if req.Username == "" {
+		kind, subject = gormmodels.ThrottleKindIP, req.IP
+	}
+	if subject == "" || req.Username != "" && req.IP != "" {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "either username or ip is required"})
+		return
+	}
+	if kind == gormmodels.ThrottleKindUsername {
+		subject = services.NormalizeUsername(subject)
+	}
+
+	found, err := h.limiter.Unlock(c.Request.Context(), kind, subject)
+	if err != nil {
+		h.logger.WithError(err).Error("Failed to unlock login")
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to unlock"})
+		return
+	}
+	if !found {
+		c.JSON(http.StatusNotFound, gin.H{"error": "No lockout found"})
+		return
+	}
+
+	event := newAuditEvent(c, gormmodels.AuditLoginUnlocked)
+	event.Target = kind + ":" + subject
+	recordAudit(c, h.audit, event)
+
+	h.logger.WithFields(logrus.Fields{
+		"kind":    kind,
+		"subject": subject,
+		"by":      event.ActorName,
+	}).Info("Login lockout lifted")
+	c.JSON(http.StatusOK, gin.H{"message": "unlocked"})
+}
@@ -0,0 +1,196 @@
+package handlers_test
+
+import (
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/sirupsen/logrus"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"gorm.io/driver/sqlite"
+	"gorm.io/gorm"
+
+	"github.com/orca-ng/orca/internal/config"
+	"github.com/orca-ng/orca/internal/database"
+	"github.com/orca-ng/orca/internal/handlers"
+	"github.com/orca-ng/orca/internal/middleware"
+	gormmodels "github.com/orca-ng/orca/internal/models/gorm"
+	"github.com/orca-ng/orca/internal/services"
+	pkgcrypto "github.com/orca-ng/orca/pkg/crypto"
+)
+
+func setupLockoutTest(t *testing.T, cfg config.LockoutConfig) (*gin.Engine, *gorm.DB) {
+	t.Helper()
+	db, err := gorm.Open(sqlite.Open(":memory:"), &gorm.Config{})
+	require.NoError(t, err)
+	require.NoError(t, db.AutoMigrate(
+		&gormmodels.User{},
+		&gormmodels.Session{},
+		&gormmodels.LoginThrottle{},
+		&gormmodels.AuditEvent{},
+		&gormmodels.AuditChainHead{},
+		&gormmodels.Role{},
+		&gormmodels.RoleAssignment{},
+	))
+	gormDB := &database.GormDB{DB: db}
+	hash, err := pkgcrypto.HashPassword("secret")
+	require.NoError(t, err)
+	for _, user := range []gormmodels.User{
+		{ID: "usr_alice", Username: "alice", PasswordHash: hash, IsActive: true},
+		{ID: "usr_admin", Username: "admin", PasswordHash: hash, IsActive: true, IsAdmin: true},
+	} {
+		require.NoError(t, db.Create(&user).Error)
+	}
+
+	logger := logrus.New()
+	limiter := services.NewLoginLimiter(gormDB, cfg, logger)
+	audit := services.NewAuditService(gormDB, logger)
+	auth := handlers.NewAuthHandler(gormDB, time.Hour)
+	auth.EnableLoginLimits(limiter)
+	auth.EnableAudit(audit)
+	lockouts := handlers.NewLockoutHandler(limiter, audit, logger)
+
+	gin.SetMode(gin.TestMode)
+	router := gin.New()
+	require.NoError(t, router.SetTrustedProxies(nil))
+	router.POST("/api/auth/login/cli", auth.LoginCLI)
+
+	api := router.Group("/api")
+	api.Use(middleware.AuthRequired(auth), middleware.LoadPermissions(services.NewAuthorizationService(gormDB)))
+	api.GET("/lockouts", middleware.RequirePermission(gormmodels.PermUsersManage), lockouts.ListLockouts)
+	api.POST("/lockouts/unlock", middleware.RequirePermission(gormmodels.PermUsersManage), lockouts.Unlock)
+
+	return router, db
+}
+
+func auditActions(t *testing.T, db *gorm.DB) []string {
+	t.Helper()
+	var events []gormmodels.AuditEvent
+	require.NoError(t, db.Order("sequence").Find(&events).Error)
+	actions := make([]string, len(events))
+	for i, event := range events {
+		actions[i] = event.Action
+		if reason := event.Details["reason"]; reason != "" {
+			actions[i] += ":" + reason
+		}
+	}
+	return actions
+}
+
+func TestLoginLockout(t *testing.T) {
+	router, db := setupLockoutTest(t, config.LockoutConfig{
+		Enabled:           true,
+		UsernameThreshold: 3,
+		IPThreshold:       100,
+		WindowMinutes:     15,
+		LockoutMinutes:    15,
+	})
+	adminToken := decodeLogin(t, postLogin(router, "/api/auth/login/cli", "admin", "secret")).Token
+
+	for i := 0; i < 3; i++ {
+		w := postLogin(router, "/api/auth/login/cli", "alice", "wrong")
+		assert.Equal(t, http.StatusUnauthorized, w.Code)
+	}
+
+	// Locked out, even with the right password
+	w := postLogin(router, "/api/auth/login/cli", "alice", "secret")
+	require.Equal(t, http.StatusTooManyRequests, w.Code, w.Body.String())
+	assert.NotEmpty(t, w.Header().Get("Retry-After"))
+
+	var locked gormmodels.AuditEvent
+	require.NoError(t, db.First(&locked, "action = ?", gormmodels.AuditLoginLocked).Error)
+	assert.Equal(t, "username:alice", locked.Target)
+
+	w = authJSON(t, router, http.MethodGet, "/api/lockouts", adminToken, nil)
+	require.Equal(t, http.StatusOK, w.Code, w.Body.String())
+	assert.Contains(t, w.Body.String(), `"subject":"alice"`)
+
+	w = authJSON(t, router, http.MethodPost, "/api/lockouts/unlock", adminToken, map[string]string{"username": "ALICE"})
+	require.Equal(t, http.StatusOK, w.Code, w.Body.String())
+	w = authJSON(t, router, http.MethodPost, "/api/lockouts/unlock", adminToken, map[string]string{"username": "alice"})
+	assert.Equal(t, http.StatusNotFound, w.Code)
+	w = authJSON(t, router, http.MethodPost, "/api/lockouts/unlock", adminToken, map[string]string{})
+	assert.Equal(t, http.StatusBadRequest, w.Code)
+
+	decodeLogin(t, postLogin(router, "/api/auth/login/cli", "alice", "secret"))
+
+	var unlocked gormmodels.AuditEvent
+	require.NoError(t, db.First(&unlocked, "action = ?", gormmodels.AuditLoginUnlocked).Error)
+	require.NotNil(t, unlocked.ActorID)
+	assert.Equal(t, "usr_admin", *unlocked.ActorID)
+	assert.Equal(t, []string{
+		gormmodels.AuditLoginSucceeded,
+		gormmodels.AuditLoginFailed + ":invalid_password",
+		gormmodels.AuditLoginFailed + ":invalid_password",
+		gormmodels.AuditLoginFailed + ":invalid_password",
+		gormmodels.AuditLoginLocked,
+		gormmodels.AuditLoginFailed + ":locked_out",
+		gormmodels.AuditLoginUnlocked,
+		gormmodels.AuditLoginSucceeded,
+	}, auditActions(t, db))
+}
+
+func TestLoginIPLockoutIgnoresForwardedFor(t *testing.T) {
+	router, db := setupLockoutTest(t, config.LockoutConfig{
+		Enabled:           true,
+		UsernameThreshold: 100,
+		IPThreshold:       3,
+		WindowMinutes:     15,
+		LockoutMinutes:    15,
+	})
+	login := func(username, forwardedFor string) int {
+		body := strings.NewReader(`{"username":"` + username + `","password":"wrong"}`)
+		req := httptest.NewRequest(http.MethodPost, "/api/auth/login/cli", body)
+		req.Header.Set("X-Forwarded-For", forwardedFor)
+		w := httptest.NewRecorder()
+		router.ServeHTTP(w, req)
+		return w.Code
+	}
+
+	// A client claiming another address on every attempt is still counted
+	// by the address it connects from
+	for i, username := range []string{"alice", "bob", "carol"} {
+		assert.Equal(t, http.StatusUnauthorized, login(username, fmt.Sprintf("198.51.100.%d", i+1)))
+	}
+	assert.Equal(t, http.StatusTooManyRequests, login("dave", "198.51.100.99"))
+
+	// The audit log records the same address
+	var clientIPs []string
+	require.NoError(t, db.Model(&gormmodels.AuditEvent{}).Distinct().Pluck("client_ip", &clientIPs).Error)
+	assert.Equal(t, []string{"192.0.2.1"}, clientIPs)
+
+	// Behind a trusted proxy the forwarded address is the client
+	require.NoError(t, router.SetTrustedProxies([]string{"192.0.2.1"}))
+	assert.Equal(t, http.StatusUnauthorized, login("erin", "198.51.100.99"))
+}
+
+func TestLoginDelayAfterFailure(t *testing.T) {
+	router, db := setupLockoutTest(t, config.LockoutConfig{
+		Enabled:           true,
+		UsernameThreshold: 5,
+		IPThreshold:       100,
+		WindowMinutes:     15,
+		LockoutMinutes:    15,
+		MaxDelaySeconds:   30,
+	})
+
+	w := postLogin(router, "/api/auth/login/cli", "nobody", "wrong")
+	assert.Equal(t, http.StatusUnauthorized, w.Code)
+
+	// The next attempt has to wait, without the password being checked
+	w = postLogin(router, "/api/auth/login/cli", "nobody", "wrong")
+	require.Equal(t, http.StatusTooManyRequests, w.Code, w.Body.String())
+	assert.Equal(t, "1", w.Header().Get("Retry-After"))
+
+	var throttle gormmodels.LoginThrottle
+	require.NoError(t, db.First(&throttle, "kind = ? AND subject = ?", gormmodels.ThrottleKindUsername, "nobody").Error)
+	assert.Equal(t, 1, throttle.Failures)
+
+	// Other users behind the same address are not held up by one failure
+	decodeLogin(t, postLogin(router, "/api/auth/login/cli", "alice", "secret"))
+}
@@ -0,0 +1,409 @@
+package handlers
+
+import (
+	"errors"
+	"net/http"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/sirupsen/logrus"
+	"gorm.io/gorm"
+
+	"github.com/orca-ng/orca/internal/database"
+	"github.com/orca-ng/orca/internal/middleware"
+	"github.com/orca-ng/orca/internal/models"
+	gormmodels "github.com/orca-ng/orca/internal/models/gorm"
+	"github.com/orca-ng/orca/internal/services"
+	"github.com/orca-ng/orca/pkg/session"
+)
+
+const (
+	// mfaChallengeTTL is how long a user has to enter the second factor
+	mfaChallengeTTL = 5 * time.Minute
+	// mfaMaxAttempts is how many wrong codes end a login
+	mfaMaxAttempts = 5
+)
+
+// challengeMFA asks for a second factor when the user has enrolled or must
+// enrol. It returns true when it has answered the request.
+func (h *AuthHandler) challengeMFA(c *gin.Context, user *gormmodels.User, cli bool) bool {
+	if h.mfa == nil {
+		return false
+	}
+	ctx := c.Request.Context()
+	enabled, err := h.mfa.Enabled(ctx, user.ID)
+	if err == nil && !enabled {
+		var required bool
+		required, err = h.mfa.Required(ctx, user.ID)
+		if err == nil && !required {
+			return false
+		}
+	}
+	if err != nil {
+		logrus.WithError(err).Error("Failed to check MFA")
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "internal server error"})
+		return true
+	}
+
+	token, err := session.GenerateToken()
+	if err != nil {
+		logrus.WithError(err).Error("Failed to generate MFA challenge")
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "internal server error"})
+		return true
+	}
+	challenge := gormmodels.MFAChallenge{
+		UserID:    user.ID,
+		TokenHash: session.HashToken(token),
+		CLI:       cli,
+		Enroll:    !enabled,
+		ExpiresAt: time.Now().UTC().Add(mfaChallengeTTL),
+	}
+	if err := h.db.Create(&challenge).Error; err != nil {
+		logrus.WithError(err).Error("Failed to create MFA challenge")
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "internal server error"})
+		return true
+	}
+
+	c.JSON(http.StatusOK, gin.H{
+		"mfa_required":        true,
+		"mfa_token":           token,
+		"enrollment_required": !enabled,
+		"expires_at":          challenge.ExpiresAt,
+	})
+	return true
+}
+
+// LoginMFA completes a login with a TOTP or recovery code. For a user who
+// had to enrol, the code confirms the enrolment and the response carries
+// the recovery codes.
+func (h *AuthHandler) LoginMFA(c *gin.Context) {
+	var req models.MFALoginRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "invalid request"})
+		return
+	}
+	if h.mfa == nil {
+		c.JSON(http.StatusNotFound, gin.H{"error": "MFA is not enabled"})
+		return
+	}
+
+	challenge, user := h.findChallenge(c, req.MFAToken)
+	if challenge == nil {
+		return
+	}
+	// Wrong codes count against the username like wrong passwords
+	if !h.allowAttempt(c, user.Username) {
+		return
+	}
+
+	ctx := c.Request.Context()
+	var extra gin.H
+	var err error
+	if challenge.Enroll {
+		var codes []string
+		codes, err = h.mfa.ConfirmEnrollment(ctx, user.ID, req.Code)
+		if errors.Is(err, services.ErrMFANotEnrolled) {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "MFA enrollment has not been started"})
+			return
+		}
+		extra = gin.H{"recovery_codes": codes}
+	} else {
+		err = h.mfa.Verify(ctx, user.ID, req.Code)
+	}
+	if errors.Is(err, services.ErrInvalidMFACode) {
+		h.loginFailed(c, user.Username, user, loginFailureInvalidMFACode)
+		h.failChallenge(c, challenge)
+		return
+	}
+	if err != nil {
+		logrus.WithError(err).Error("Failed to verify MFA code")
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "internal server error"})
+		return
+	}
+
+	if err := h.db.Delete(challenge).Error; err != nil {
+		logrus.WithError(err).Warn("Failed to delete MFA challenge")
+	}
+	h.finishLogin(c, user, challenge.CLI, extra)
+}
+
+// LoginMFAEnroll starts the enrolment of a user whose login requires MFA
+// but who has not enrolled yet
+func (h *AuthHandler) LoginMFAEnroll(c *gin.Context) {
+	var req models.MFAEnrollLoginRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "invalid request"})
+		return
+	}
+	if h.mfa == nil {
+		c.JSON(http.StatusNotFound, gin.H{"error": "MFA is not enabled"})
+		return
+	}
+
+	challenge, user := h.findChallenge(c, req.MFAToken)
+	if challenge == nil {
+		return
+	}
+	if !challenge.Enroll {
+		c.JSON(http.StatusConflict, gin.H{"error": "MFA is already enrolled"})
+		return
+	}
+
+	enrollment, err := h.mfa.BeginEnrollment(c.Request.Context(), user.ID, user.Username)
+	if err != nil {
+		logrus.WithError(err).Error("Failed to start MFA enrollment")
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "internal server error"})
+		return
+	}
+	c.JSON(http.StatusOK, enrollment)
+}
+
+// findChallenge looks up an unexpired MFA challenge and its user. On
+// failure it writes the response and returns nil.
+func (h *AuthHandler) findChallenge(c *gin.Context, token string) (*gormmodels.MFAChallenge, *gormmodels.User) {
+	var challenge gormmodels.MFAChallenge
+	err := h.db.Preload("User").
+		Where("token_hash = ? AND expires_at > ?", session.HashToken(token), time.Now().UTC()).
+		First(&challenge).Error
+	if err != nil {
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			c.JSON(http.StatusUnauthorized, gin.H{"error": "MFA challenge expired, log in again"})
+			return nil, nil
+		}
+		logrus.WithError(err).Error("Failed to get MFA challenge")
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "internal server error"})
+		return nil, nil
+	}
+	user := challenge.User
+	if user == nil || !user.IsActive {
+		c.JSON(http.StatusForbidden, gin.H{"error": "account is disabled"})
+		return nil, nil
+	}
+	return &challenge, user
+}
+
+// failChallenge counts a wrong code, ending the login after too many
+func (h *AuthHandler) failChallenge(c *gin.Context, challenge *gormmodels.MFAChallenge) {
+	logrus.WithField("user_id", challenge.UserID).Warn("Invalid MFA code")
+	if challenge.Attempts+1 >= mfaMaxAttempts {
+		if err := h.db.Delete(challenge).Error; err != nil {
+			logrus.WithError(err).Warn("Failed to delete MFA challenge")
+		}
+		c.JSON(http.StatusUnauthorized, gin.H{"error": "too many invalid codes, log in again"})
+		return
+	}
+	if err := h.db.Model(&gormmodels.MFAChallenge{}).
+		Where("id = ?", challenge.ID).
+		Update("attempts", gorm.Expr("attempts + 1")).Error; err != nil {
+		logrus.WithError(err).Warn("Failed to count MFA attempt")
+	}
+	c.JSON(http.StatusUnauthorized, gin.H{"error": "invalid code"})
+}
+
+// MFAHandler lets users manage their own second factor and admins reset
+// the enrolment of users who lost theirs
+type MFAHandler struct {
+	db     *database.GormDB
+	mfa    *services.MFAService
+	logger *logrus.Logger
+}
+
+// NewMFAHandler creates a new MFA handler
+func NewMFAHandler(db *database.GormDB, mfa *services.MFAService, logger *logrus.Logger) *MFAHandler {
+	return &MFAHandler{
+		db:     db,
+		mfa:    mfa,
+		logger: logger,
+	}
+}
+
+// Status returns the MFA status of the current user
+func (h *MFAHandler) Status(c *gin.Context) {
+	status, err := h.mfa.Status(c.Request.Context(), middleware.GetUser(c).ID)
+	if err != nil {
+		h.logger.WithError(err).Error("Failed to get MFA status")
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to retrieve MFA status"})
+		return
+	}
+	c.JSON(http.StatusOK, status)
+}
+
+// Enroll starts enrolment for the current user. It takes effect once
+// confirmed with a code.
+func (h *MFAHandler) Enroll(c *gin.Context) {
+	user, ok := h.passwordUser(c)
+	if !ok {
+		return
+	}
+	enrollment, err := h.mfa.BeginEnrollment(c.Request.Context(), user.ID, user.Username)
+	if err != nil {
+		if errors.Is(err, services.ErrMFAAlreadyEnabled) {
+			c.JSON(http.StatusConflict, gin.H{"error": "MFA is already enabled"})
+			return
+		}
+		h.logger.WithError(err).Error("Failed to start MFA enrollment")
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to start MFA enrollment"})
+		return
+	}
+	c.JSON(http.StatusOK, enrollment)
+}
+
+// Confirm enables MFA for the current user and returns the recovery codes
+func (h *MFAHandler) Confirm(c *gin.Context) {
+	var req models.MFACodeRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+	user, ok := h.passwordUser(c)
+	if !ok {
+		return
+	}
+
+	codes, err := h.mfa.ConfirmEnrollment(c.Request.Context(), user.ID, req.Code)
+	if err != nil {
+		h.codeError(c, err, "Failed to enable MFA")
+		return
+	}
+	middleware.SetAuditTarget(c, "user:"+user.ID)
+	c.JSON(http.StatusOK, gin.H{"recovery_codes": codes})
+}
+
+// RegenerateRecoveryCodes replaces the recovery codes of the current user,
+// who proves possession of the second factor with a code
+func (h *MFAHandler) RegenerateRecoveryCodes(c *gin.Context) {
+	var req models.MFACodeRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+	userID := middleware.GetUser(c).ID
+	ctx := c.Request.Context()
+
+	if err := h.mfa.Verify(ctx, userID, req.Code); err != nil {
+		h.codeError(c, err, "Failed to regenerate recovery codes")
+		return
+	}
+	codes, err := h.mfa.RegenerateRecoveryCodes(ctx, userID)
+	if err != nil {
+		h.codeError(c, err, "Failed to regenerate recovery codes")
+		return
+	}
+	middleware.SetAuditTarget(c, "user:"+userID)
+	c.JSON(http.StatusOK, gin.H{"recovery_codes": codes})
+}
+
+// Disable removes the second factor of the current user unless it is
+// required
+func (h *MFAHandler) Disable(c *gin.Context) {
+	var req models.MFACodeRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+	userID := middleware.GetUser(c).ID
+	ctx := c.Request.Context()
+
+	required, err := h.mfa.Required(ctx, userID)
+	if err != nil {
+		h.logger.WithError(err).Error("Failed to check MFA requirement")
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to disable MFA"})
+		return
+	}
+	if required {
+		c.JSON(http.StatusForbidden, gin.H{"error": "MFA is required for your account"})
+		return
+	}
+	if err := h.mfa.Verify(ctx, userID, req.Code); err != nil {
+		h.codeError(c, err, "Failed to disable MFA")
+		return
+	}
+	if err := h.mfa.Reset(ctx, userID); err != nil {
+		h.logger.WithError(err).Error("Failed to disable MFA")
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to disable MFA"})
+		return
+	}
+
+	middleware.SetAuditTarget(c, "user:"+userID)
+	h.logger.WithField("user_id", userID).Info("MFA disabled")
+	c.JSON(http.StatusOK, gin.H{"message": "MFA disabled"})
+}
+
+// GetUserMFA returns the MFA status of a user
+func (h *MFAHandler) GetUserMFA(c *gin.Context) {
+	user, ok := h.findUser(c, c.Param("id"))
+	if !ok {
+		return
+	}
+	status, err := h.mfa.Status(c.Request.Context(), user.ID)
+	if err != nil {
+		h.logger.WithError(err).Error("Failed to get MFA status")
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to retrieve MFA status"})
+		return
+	}
+	c.JSON(http.StatusOK, status)
+}
+
+// ResetUserMFA removes the enrolment of a user who lost their
+// authenticator and recovery codes. If MFA is required, the user enrols
+// again at the next login.
+func (h *MFAHandler) ResetUserMFA(c *gin.Context) {
+	user, ok := h.findUser(c, c.Param("id"))
+	if !ok || !allowManageUser(c, h.db, h.logger, user) {
+		return
+	}
+	if err := h.mfa.Reset(c.Request.Context(), user.ID); err != nil {
+		h.logger.WithError(err).Error("Failed to reset MFA")
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to reset MFA"})
+		return
+	}
+
+	middleware.SetAuditTarget(c, "user:"+user.ID)
+	middleware.AddAuditDetail(c, "username", user.Username)
+
+	h.logger.WithFields(logrus.Fields{
+		"user_id":  user.ID,
+		"reset_by": middleware.GetUser(c).ID,
+	}).Warn("MFA enrollment reset")
+
+	c.JSON(http.StatusOK, gin.H{"message": "MFA enrollment reset"})
+}
+
+// passwordUser returns the current user if they log in with a password.
+// Single sign-on users get their second factor from the identity provider.
+func (h *MFAHandler) passwordUser(c *gin.Context) (*models.User, bool) {
+	user := middleware.GetUser(c)
+	if user.AuthProvider != gormmodels.AuthProviderLocal && user.AuthProvider != gormmodels.AuthProviderLDAP {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "MFA applies to password logins only"})
+		return nil, false
+	}
+	return user, true
+}
+
+func (h *MFAHandler) codeError(c *gin.Context, err error, message string) {
+	switch {
+	case errors.Is(err, services.ErrInvalidMFACode):
+		c.JSON(http.StatusUnauthorized, gin.H{"error": "invalid code"})
+	case errors.Is(err, services.ErrMFANotEnrolled):
+		c.JSON(http.StatusConflict, gin.H{"error": "MFA is not enrolled"})
+	case errors.Is(err, services.ErrMFAAlreadyEnabled):
+		c.JSON(http.StatusConflict, gin.H{"error": "MFA is already enabled"})
+	default:
+		h.logger.WithError(err).Error(message)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": message})
+	}
+}
+
+func (h *MFAHandler) findUser(c *gin.Context, id string) (*gormmodels.User, bool) {
+	var user gormmodels.User
+	if err := h.db.First(&user, "id = ?", id).Error; err != nil {
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			c.JSON(http.StatusNotFound, gin.H{"error": "User not found"})
+			return nil, false
+		}
+		h.logger.WithError(err).Error("Failed to get user")
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to retrieve user"})
+		return nil, false
+	}
+	return &user, true
+}
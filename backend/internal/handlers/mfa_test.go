@@ -0,0 +1,254 @@
+package handlers_test
+
+import (
+	"bytes"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/sirupsen/logrus"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"gorm.io/driver/sqlite"
+	"gorm.io/gorm"
+
+	"github.com/orca-ng/orca/internal/config"
+	"github.com/orca-ng/orca/internal/crypto"
+	"github.com/orca-ng/orca/internal/database"
+	"github.com/orca-ng/orca/internal/handlers"
+	"github.com/orca-ng/orca/internal/middleware"
+	gormmodels "github.com/orca-ng/orca/internal/models/gorm"
+	"github.com/orca-ng/orca/internal/services"
+	pkgcrypto "github.com/orca-ng/orca/pkg/crypto"
+	"github.com/orca-ng/orca/pkg/totp"
+)
+
+func setupMFATest(t *testing.T) (*gin.Engine, *gorm.DB) {
+	t.Helper()
+	db, err := gorm.Open(sqlite.Open(":memory:"), &gorm.Config{})
+	require.NoError(t, err)
+	require.NoError(t, db.AutoMigrate(
+		&gormmodels.User{},
+		&gormmodels.Session{},
+		&gormmodels.UserMFA{},
+		&gormmodels.MFARecoveryCode{},
+		&gormmodels.MFAChallenge{},
+		&gormmodels.AuditEvent{},
+		&gormmodels.AuditChainHead{},
+		&gormmodels.Role{},
+		&gormmodels.RoleAssignment{},
+	))
+	gormDB := &database.GormDB{DB: db}
+	hash, err := pkgcrypto.HashPassword("secret")
+	require.NoError(t, err)
+	for _, user := range []gormmodels.User{
+		{ID: "usr_alice", Username: "alice", PasswordHash: hash, IsActive: true},
+		{ID: "usr_admin", Username: "admin", PasswordHash: hash, IsActive: true, IsAdmin: true},
+	} {
+		require.NoError(t, db.Create(&user).Error)
+	}
+
+	logger := logrus.New()
+	mfa := services.NewMFAService(gormDB, crypto.NewEncryptor("test-key"), config.MFAConfig{}, logger)
+	auth := handlers.NewAuthHandler(gormDB, time.Hour)
+	auth.EnableMFA(mfa)
+	mfaHandler := handlers.NewMFAHandler(gormDB, mfa, logger)
+	audit := services.NewAuditService(gormDB, logger)
+
+	gin.SetMode(gin.TestMode)
+	router := gin.New()
+	router.POST("/api/auth/login", auth.Login)
+	router.POST("/api/auth/login/cli", auth.LoginCLI)
+	router.POST("/api/auth/login/mfa", auth.LoginMFA)
+	router.POST("/api/auth/login/mfa/enroll", auth.LoginMFAEnroll)
+
+	api := router.Group("/api")
+	api.Use(middleware.AuthRequired(auth), middleware.LoadPermissions(services.NewAuthorizationService(gormDB)))
+	api.GET("/auth/mfa", mfaHandler.Status)
+	api.POST("/auth/mfa/enroll", mfaHandler.Enroll)
+	api.POST("/auth/mfa/confirm", middleware.Audit(audit, gormmodels.AuditMFAEnabled), mfaHandler.Confirm)
+	api.POST("/auth/mfa/recovery-codes", middleware.Audit(audit, gormmodels.AuditMFARecoveryCodesRegenerated), mfaHandler.RegenerateRecoveryCodes)
+	api.DELETE("/auth/mfa", middleware.Audit(audit, gormmodels.AuditMFADisabled), mfaHandler.Disable)
+	api.DELETE("/users/:id/mfa", middleware.RequirePermission(gormmodels.PermUsersManage), middleware.Audit(audit, gormmodels.AuditMFAReset), mfaHandler.ResetUserMFA)
+
+	return router, db
+}
+
+type mfaLoginResponse struct {
+	Token              string   `json:"token"`
+	MFARequired        bool     `json:"mfa_required"`
+	MFAToken           string   `json:"mfa_token"`
+	EnrollmentRequired bool     `json:"enrollment_required"`
+	RecoveryCodes      []string `json:"recovery_codes"`
+}
+
+func decodeLogin(t *testing.T, w *httptest.ResponseRecorder) mfaLoginResponse {
+	t.Helper()
+	require.Equal(t, http.StatusOK, w.Code, w.Body.String())
+	var response mfaLoginResponse
+	require.NoError(t, json.Unmarshal(w.Body.Bytes(), &response))
+	return response
+}
+
+// authJSON sends a request as a signed in user
+func authJSON(t *testing.T, router *gin.Engine, method, path, token string, body interface{}) *httptest.ResponseRecorder {
+	t.Helper()
+	data, err := json.Marshal(body)
+	require.NoError(t, err)
+	req := httptest.NewRequest(method, path, bytes.NewReader(data))
+	req.Header.Set("Content-Type", "application/json")
+	req.Header.Set("Authorization", "Bearer "+token)
+	w := httptest.NewRecorder()
+	router.ServeHTTP(w, req)
+	return w
+}
+
+func mfaCode(t *testing.T, secret string, offset int64) string {
+	t.Helper()
+	code, err := totp.Code(secret, totp.Step(time.Now())+offset)
+	require.NoError(t, err)
+	return code
+}
+
+func TestMFALoginRequiredByRole(t *testing.T) {
+	router, db := setupMFATest(t)
+	role := gormmodels.Role{Name: "privileged", Permissions: []string{gormmodels.PermInstancesRead}, RequireMFA: true}
+	require.NoError(t, db.Create(&role).Error)
+	require.NoError(t, db.Create(&gormmodels.RoleAssignment{UserID: "usr_alice", RoleID: role.ID}).Error)
+
+	// The password alone no longer logs in
+	challenge := decodeLogin(t, postLogin(router, "/api/auth/login/cli", "alice", "secret"))
+	assert.True(t, challenge.MFARequired)
+	assert.True(t, challenge.EnrollmentRequired)
+	assert.Empty(t, challenge.Token)
+
+	w := doJSON(t, router, http.MethodPost, "/api/auth/login/mfa", gin.H{"mfa_token": challenge.MFAToken, "code": "123456"})
+	assert.Equal(t, http.StatusBadRequest, w.Code)
+
+	// Enrol during the login
+	w = doJSON(t, router, http.MethodPost, "/api/auth/login/mfa/enroll", gin.H{"mfa_token": challenge.MFAToken})
+	require.Equal(t, http.StatusOK, w.Code, w.Body.String())
+	var enrollment services.MFAEnrollment
+	require.NoError(t, json.Unmarshal(w.Body.Bytes(), &enrollment))
+
+	w = doJSON(t, router, http.MethodPost, "/api/auth/login/mfa", gin.H{"mfa_token": challenge.MFAToken, "code": "000000"})
+	assert.Equal(t, http.StatusUnauthorized, w.Code)
+	login := decodeLogin(t, doJSON(t, router, http.MethodPost, "/api/auth/login/mfa", gin.H{"mfa_token": challenge.MFAToken, "code": mfaCode(t, enrollment.Secret, 0)}))
+	assert.NotEmpty(t, login.Token)
+	require.Len(t, login.RecoveryCodes, services.RecoveryCodeCount)
+
+	// The challenge is used up
+	w = doJSON(t, router, http.MethodPost, "/api/auth/login/mfa", gin.H{"mfa_token": challenge.MFAToken, "code": mfaCode(t, enrollment.Secret, 1)})
+	assert.Equal(t, http.StatusUnauthorized, w.Code)
+
+	// Later web logins ask for a code, a recovery code will do
+	challenge = decodeLogin(t, postLogin(router, "/api/auth/login", "alice", "secret"))
+	assert.True(t, challenge.MFARequired)
+	assert.False(t, challenge.EnrollmentRequired)
+	assert.Equal(t, http.StatusConflict, doJSON(t, router, http.MethodPost, "/api/auth/login/mfa/enroll", gin.H{"mfa_token": challenge.MFAToken}).Code)
+	w = doJSON(t, router, http.MethodPost, "/api/auth/login/mfa", gin.H{"mfa_token": challenge.MFAToken, "code": login.RecoveryCodes[0]})
+	require.Equal(t, http.StatusOK, w.Code, w.Body.String())
+	assert.NotNil(t, sessionCookie(w))
+
+	// Required MFA cannot be turned off by the user
+	assert.Equal(t, http.StatusForbidden, authJSON(t, router, http.MethodDelete, "/api/auth/mfa", login.Token, gin.H{"code": login.RecoveryCodes[1]}).Code)
+
+	// An admin reset makes the user enrol again
+	admin := decodeLogin(t, postLogin(router, "/api/auth/login/cli", "admin", "secret"))
+	require.NotEmpty(t, admin.Token)
+	assert.Equal(t, http.StatusForbidden, authJSON(t, router, http.MethodDelete, "/api/users/usr_admin/mfa", login.Token, nil).Code)
+	assert.Equal(t, http.StatusOK, authJSON(t, router, http.MethodDelete, "/api/users/usr_alice/mfa", admin.Token, nil).Code)
+	assert.Equal(t, http.StatusNotFound, authJSON(t, router, http.MethodDelete, "/api/users/usr_nobody/mfa", admin.Token, nil).Code)
+	challenge = decodeLogin(t, postLogin(router, "/api/auth/login/cli", "alice", "secret"))
+	assert.True(t, challenge.EnrollmentRequired)
+}
+
+func TestMFALoginAttemptsLimited(t *testing.T) {
+	router, db := setupMFATest(t)
+	role := gormmodels.Role{Name: "privileged", Permissions: []string{gormmodels.PermInstancesRead}, RequireMFA: true}
+	require.NoError(t, db.Create(&role).Error)
+	require.NoError(t, db.Create(&gormmodels.RoleAssignment{UserID: "usr_alice", RoleID: role.ID}).Error)
+
+	challenge := decodeLogin(t, postLogin(router, "/api/auth/login/cli", "alice", "secret"))
+	w := doJSON(t, router, http.MethodPost, "/api/auth/login/mfa/enroll", gin.H{"mfa_token": challenge.MFAToken})
+	require.Equal(t, http.StatusOK, w.Code)
+	var enrollment services.MFAEnrollment
+	require.NoError(t, json.Unmarshal(w.Body.Bytes(), &enrollment))
+
+	for i := 0; i < 5; i++ {
+		w = doJSON(t, router, http.MethodPost, "/api/auth/login/mfa", gin.H{"mfa_token": challenge.MFAToken, "code": "000000"})
+		assert.Equal(t, http.StatusUnauthorized, w.Code)
+	}
+	assert.Contains(t, w.Body.String(), "too many")
+
+	// The right code comes too late
+	w = doJSON(t, router, http.MethodPost, "/api/auth/login/mfa", gin.H{"mfa_token": challenge.MFAToken, "code": mfaCode(t, enrollment.Secret, 0)})
+	assert.Equal(t, http.StatusUnauthorized, w.Code)
+	var count int64
+	db.Model(&gormmodels.Session{}).Count(&count)
+	assert.Zero(t, count)
+}
+
+func TestMFAOptionalEnrollment(t *testing.T) {
+	router, db := setupMFATest(t)
+
+	// Without enrolment or requirement the password is enough
+	login := decodeLogin(t, postLogin(router, "/api/auth/login/cli", "alice", "secret"))
+	require.NotEmpty(t, login.Token)
+	assert.False(t, login.MFARequired)
+
+	w := authJSON(t, router, http.MethodPost, "/api/auth/mfa/enroll", login.Token, nil)
+	require.Equal(t, http.StatusOK, w.Code, w.Body.String())
+	var enrollment services.MFAEnrollment
+	require.NoError(t, json.Unmarshal(w.Body.Bytes(), &enrollment))
+	step := totp.Step(time.Now())
+
+	// Pending until confirmed
+	assert.False(t, decodeLogin(t, postLogin(router, "/api/auth/login/cli", "alice", "secret")).MFARequired)
+	code, err := totp.Code(enrollment.Secret, step)
+	require.NoError(t, err)
+	w = authJSON(t, router, http.MethodPost, "/api/auth/mfa/confirm", login.Token, gin.H{"code": code})
+	require.Equal(t, http.StatusOK, w.Code, w.Body.String())
+	var confirmed struct {
+		RecoveryCodes []string `json:"recovery_codes"`
+	}
+	require.NoError(t, json.Unmarshal(w.Body.Bytes(), &confirmed))
+	require.NotEmpty(t, confirmed.RecoveryCodes)
+
+	// A recovery code also proves possession
+	w = authJSON(t, router, http.MethodPost, "/api/auth/mfa/recovery-codes", login.Token, gin.H{"code": confirmed.RecoveryCodes[0]})
+	require.Equal(t, http.StatusOK, w.Code, w.Body.String())
+
+	w = authJSON(t, router, http.MethodGet, "/api/auth/mfa", login.Token, nil)
+	var status services.MFAStatus
+	require.NoError(t, json.Unmarshal(w.Body.Bytes(), &status))
+	assert.Equal(t, services.MFAStatus{Enabled: true, RecoveryCodesRemaining: services.RecoveryCodeCount}, status)
+
+	challenge := decodeLogin(t, postLogin(router, "/api/auth/login/cli", "alice", "secret"))
+	assert.True(t, challenge.MFARequired)
+	assert.False(t, challenge.EnrollmentRequired)
+
+	// Disabling needs a code
+	assert.Equal(t, http.StatusUnauthorized, authJSON(t, router, http.MethodDelete, "/api/auth/mfa", login.Token, gin.H{"code": "000000"}).Code)
+	code, err = totp.Code(enrollment.Secret, step+1)
+	require.NoError(t, err)
+	assert.Equal(t, http.StatusOK, authJSON(t, router, http.MethodDelete, "/api/auth/mfa", login.Token, gin.H{"code": code}).Code)
+	assert.False(t, decodeLogin(t, postLogin(router, "/api/auth/login/cli", "alice", "secret")).MFARequired)
+
+	// Changes to the second factor are audited, failed attempts are not
+	var events []gormmodels.AuditEvent
+	require.NoError(t, db.Order("sequence").Find(&events).Error)
+	actions := make([]string, len(events))
+	for i, event := range events {
+		actions[i] = event.Action
+		assert.Equal(t, "user:usr_alice", event.Target)
+	}
+	assert.Equal(t, []string{
+		gormmodels.AuditMFAEnabled,
+		gormmodels.AuditMFARecoveryCodesRegenerated,
+		gormmodels.AuditMFADisabled,
+	}, actions)
+}
@@ -0,0 +1,196 @@
+package handlers
+
+import (
+	"crypto/subtle"
+	"encoding/json"
+	"errors"
+	"net/http"
+	"net/url"
+	"strings"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/sirupsen/logrus"
+
+	"github.com/orca-ng/orca/internal/crypto"
+	"github.com/orca-ng/orca/internal/services"
+)
+
+const (
+	oidcLoginCookie = "oidc_login"
+	oidcLoginPath   = "/api/auth/oidc"
+	oidcLoginTTL    = 10 * time.Minute
+)
+
+// oidcPendingLogin is kept in an encrypted cookie between sending the browser
+// to the identity provider and its return
+type oidcPendingLogin struct {
+	services.OIDCLogin
+	RedirectTo string    `json:"redirect_to"`
+	ExpiresAt  time.Time `json:"expires_at"`
+}
+
+// OIDCHandler handles single sign-on through an OpenID Connect provider
+type OIDCHandler struct {
+	auth              *AuthHandler
+	provider          *services.OIDCProvider
+	provisioner       *services.IdentityProvisioner
+	encryptor         *crypto.Encryptor
+	logger            *logrus.Logger
+	postLoginRedirect string
+}
+
+// NewOIDCHandler creates a new OIDC handler. Sessions are created through
+// auth, the same way as for password logins.
+func NewOIDCHandler(auth *AuthHandler, provider *services.OIDCProvider, provisioner *services.IdentityProvisioner, encryptor *crypto.Encryptor, logger *logrus.Logger, postLoginRedirect string) *OIDCHandler {
+	if postLoginRedirect == "" {
+		postLoginRedirect = "/"
+	}
+	return &OIDCHandler{
+		auth:              auth,
+		provider:          provider,
+		provisioner:       provisioner,
+		encryptor:         encryptor,
+		logger:            logger,
+		postLoginRedirect: postLoginRedirect,
+	}
+}
+
+// Login sends the browser to the identity provider. The page to return to
+// after login can be given as redirect.
+func (h *OIDCHandler) Login(c *gin.Context) {
+	login, err := services.NewOIDCLogin()
+	if err != nil {
+		h.logger.WithError(err).Error("Failed to start OIDC login")
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "failed to start login"})
+		return
+	}
+
+	authURL, err := h.provider.AuthCodeURL(c.Request.Context(), login)
+	if err != nil {
+		h.logger.WithError(err).Error("Identity provider unavailable")
+		c.JSON(http.StatusBadGateway, gin.H{"error": "identity provider unavailable"})
+		return
+	}
+
+	pending := oidcPendingLogin{
+		OIDCLogin:  *login,
+		RedirectTo: localRedirect(c.Query("redirect"), h.postLoginRedirect),
+		ExpiresAt:  time.Now().Add(oidcLoginTTL),
+	}
+	data, err := json.Marshal(pending)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "failed to start login"})
+		return
+	}
+	value, err := h.encryptor.Encrypt(string(data))
+	if err != nil {
+		h.logger.WithError(err).Error("Failed to encrypt OIDC login state")
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "failed to start login"})
+		return
+	}
+
+	// Lax, so that the cookie comes back with the provider's redirect
+	c.SetSameSite(http.SameSiteLaxMode)
+	c.SetCookie(oidcLoginCookie, value, int(oidcLoginTTL.Seconds()), oidcLoginPath, "", false, true)
+	c.Redirect(http.StatusFound, authURL)
+}
+
+// Callback completes the login when the identity provider redirects back,
+// provisioning the user and starting a session
+func (h *OIDCHandler) Callback(c *gin.Context) {
+	pending, err := h.pendingLogin(c)
+	// The state is single use
+	c.SetCookie(oidcLoginCookie, "", -1, oidcLoginPath, "", false, true)
+	if err != nil {
+		h.logger.WithError(err).Warn("OIDC callback without a valid login state")
+		h.fail(c, "invalid_state")
+		return
+	}
+
+	if providerError := c.Query("error"); providerError != "" {
+		h.logger.WithFields(logrus.Fields{
+			"error":       providerError,
+			"description": c.Query("error_description"),
+		}).Warn("Identity provider refused the login")
+		h.fail(c, "sso_failed")
+		return
+	}
+
+	if subtle.ConstantTimeCompare([]byte(c.Query("state")), []byte(pending.State)) != 1 {
+		h.logger.Warn("OIDC callback state does not match")
+		h.fail(c, "invalid_state")
+		return
+	}
+
+	identity, err := h.provider.Exchange(c.Request.Context(), c.Query("code"), &pending.OIDCLogin)
+	if err != nil {
+		h.logger.WithError(err).Warn("OIDC login failed")
+		h.fail(c, "sso_failed")
+		return
+	}
+
+	user, err := h.provisioner.Provision(c.Request.Context(), *identity, h.provider.GroupMapping())
+	if err != nil {
+		if errors.Is(err, services.ErrIdentityConflict) {
+			h.logger.WithField("username", identity.Username).Warn("OIDC login conflicts with an existing account")
+			h.fail(c, "account_conflict")
+			return
+		}
+		h.logger.WithError(err).Error("Failed to provision OIDC user")
+		h.fail(c, "sso_failed")
+		return
+	}
+	if !user.IsActive {
+		h.fail(c, "account_disabled")
+		return
+	}
+
+	sess, err := h.auth.startSession(c, user, c.Request.UserAgent())
+	if err != nil {
+		h.logger.WithError(err).Error("Failed to create session")
+		h.fail(c, "sso_failed")
+		return
+	}
+	h.auth.setSessionCookie(c, sess.Token)
+	h.auth.loginSucceeded(c, user, user.AuthProvider)
+
+	h.logger.WithFields(logrus.Fields{
+		"user_id":  user.ID,
+		"username": user.Username,
+	}).Info("User logged in through OIDC")
+
+	c.Redirect(http.StatusFound, pending.RedirectTo)
+}
+
+func (h *OIDCHandler) pendingLogin(c *gin.Context) (*oidcPendingLogin, error) {
+	value, err := c.Cookie(oidcLoginCookie)
+	if err != nil {
+		return nil, err
+	}
+	data, err := h.encryptor.Decrypt(value)
+	if err != nil {
+		return nil, err
+	}
+	var pending oidcPendingLogin
+	if err := json.Unmarshal([]byte(data), &pending); err != nil {
+		return nil, err
+	}
+	if time.Now().After(pending.ExpiresAt) {
+		return nil, errors.New("login state expired")
+	}
+	return &pending, nil
+}
+
+// fail sends the browser back to the login page with an error code
+func (h *OIDCHandler) fail(c *gin.Context, code string) {
+	c.Redirect(http.StatusFound, "/login?error="+url.QueryEscape(code))
+}
+
+// localRedirect accepts only paths on this site as redirect targets
+func localRedirect(target, fallback string) string {
+	if target == "" || !strings.HasPrefix(target, "/") || strings.HasPrefix(target, "//") || strings.Contains(target, "\\") {
+		return fallback
+	}
+	return target
+}
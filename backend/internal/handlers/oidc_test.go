@@ -0,0 +1,316 @@
+package handlers_test
+
+import (
+	"crypto"
+	"crypto/rand"
+	"crypto/rsa"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/json"
+	"math/big"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/sirupsen/logrus"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"gorm.io/driver/sqlite"
+	"gorm.io/gorm"
+
+	"github.com/orca-ng/orca/internal/config"
+	orcacrypto "github.com/orca-ng/orca/internal/crypto"
+	"github.com/orca-ng/orca/internal/database"
+	"github.com/orca-ng/orca/internal/handlers"
+	gormmodels "github.com/orca-ng/orca/internal/models/gorm"
+	"github.com/orca-ng/orca/internal/services"
+	pkgcrypto "github.com/orca-ng/orca/pkg/crypto"
+)
+
+const testClientID = "orca"
+
+// fakeIdP is a minimal OpenID Connect provider issuing RS256 ID tokens
+type fakeIdP struct {
+	server *httptest.Server
+	key    *rsa.PrivateKey
+
+	mu    sync.Mutex
+	codes map[string]fakeGrant
+}
+
+type fakeGrant struct {
+	challenge string
+	claims    map[string]interface{}
+}
+
+func newFakeIdP(t *testing.T) *fakeIdP {
+	t.Helper()
+	key, err := rsa.GenerateKey(rand.Reader, 2048)
+	require.NoError(t, err)
+	idp := &fakeIdP{key: key, codes: make(map[string]fakeGrant)}
+
+	mux := http.NewServeMux()
+	mux.HandleFunc("/.well-known/openid-configuration", func(w http.ResponseWriter, r *http.Request) {
+		json.NewEncoder(w).Encode(map[string]interface{}{
+			"issuer":                                idp.server.URL,
+			"authorization_endpoint":                idp.server.URL + "/authorize",
+			"token_endpoint":                        idp.server.URL + "/token",
+			"jwks_uri":                              idp.server.URL + "/keys",
+			"id_token_signing_alg_values_supported": []string{"RS256"},
+		})
+	})
+	mux.HandleFunc("/keys", func(w http.ResponseWriter, r *http.Request) {
+		json.NewEncoder(w).Encode(map[string]interface{}{"keys": []map[string]string{{
+			"kty": "RSA",
+			"kid": "test",
+			"alg": "RS256",
+			"use": "sig",
+			"n":   base64.RawURLEncoding.EncodeToString(key.N.Bytes()),
+			"e":   base64.RawURLEncoding.EncodeToString(big.NewInt(int64(key.E)).Bytes()),
+		}}})
+	})
+	mux.HandleFunc("/token", func(w http.ResponseWriter, r *http.Request) {
+		require.NoError(t, r.ParseForm())
+		idp.mu.Lock()
+		grant, ok := idp.codes[r.PostForm.Get("code")]
+		delete(idp.codes, r.PostForm.Get("code"))
+		idp.mu.Unlock()
+
+		verifier := sha256.Sum256([]byte(r.PostForm.Get("code_verifier")))
+		if !ok || base64.RawURLEncoding.EncodeToString(verifier[:]) != grant.challenge {
+			w.Header().Set("Content-Type", "application/json")
+			w.WriteHeader(http.StatusBadRequest)
+			w.Write([]byte(`{"error":"invalid_grant"}`))
+			return
+		}
+		w.Header().Set("Content-Type", "application/json")
+		json.NewEncoder(w).Encode(map[string]interface{}{
+			"access_token": "access",
+			"token_type":   "Bearer",
+			"expires_in":   300,
+			"id_token":     idp.sign(t, grant.claims),
+		})
+	})
+	idp.server = httptest.NewServer(mux)
+	t.Cleanup(idp.server.Close)
+	return idp
+}
+
+func (idp *fakeIdP) sign(t *testing.T, claims map[string]interface{}) string {
+	header, _ := json.Marshal(map[string]string{"alg": "RS256", "kid": "test", "typ": "JWT"})
+	payload, err := json.Marshal(claims)
+	require.NoError(t, err)
+	signingInput := base64.RawURLEncoding.EncodeToString(header) + "." + base64.RawURLEncoding.EncodeToString(payload)
+	digest := sha256.Sum256([]byte(signingInput))
+	signature, err := rsa.SignPKCS1v15(rand.Reader, idp.key, crypto.SHA256, digest[:])
+	require.NoError(t, err)
+	return signingInput + "." + base64.RawURLEncoding.EncodeToString(signature)
+}
+
+// authorize plays the user approving the login at the provider and returns
+// the callback query
+func (idp *fakeIdP) authorize(t *testing.T, location string, claims map[string]interface{}) url.Values {
+	t.Helper()
+	authURL, err := url.Parse(location)
+	require.NoError(t, err)
+	require.True(t, strings.HasPrefix(location, idp.server.URL+"/authorize"))
+	query := authURL.Query()
+	assert.Equal(t, "S256", query.Get("code_challenge_method"))
+	assert.Equal(t, testClientID, query.Get("client_id"))
+
+	now := time.Now()
+	full := map[string]interface{}{
+		"iss":   idp.server.URL,
+		"aud":   testClientID,
+		"iat":   now.Unix(),
+		"exp":   now.Add(5 * time.Minute).Unix(),
+		"nonce": query.Get("nonce"),
+	}
+	for k, v := range claims {
+		full[k] = v
+	}
+
+	code := "code-" + query.Get("state")[:8]
+	idp.mu.Lock()
+	idp.codes[code] = fakeGrant{challenge: query.Get("code_challenge"), claims: full}
+	idp.mu.Unlock()
+	return url.Values{"code": {code}, "state": {query.Get("state")}}
+}
+
+func setupOIDCTest(t *testing.T, idp *fakeIdP) (*gin.Engine, *gorm.DB, *handlers.AuthHandler) {
+	t.Helper()
+	db, err := gorm.Open(sqlite.Open(":memory:"), &gorm.Config{})
+	require.NoError(t, err)
+	require.NoError(t, db.AutoMigrate(&gormmodels.User{}, &gormmodels.Session{}, &gormmodels.Role{}, &gormmodels.RoleAssignment{}))
+	require.NoError(t, db.Create(&gormmodels.Role{Name: "operator", Permissions: []string{gormmodels.PermInstancesRead}}).Error)
+	require.NoError(t, db.Create(&gormmodels.Role{Name: "viewer", Permissions: []string{gormmodels.PermInstancesRead}}).Error)
+	gormDB := &database.GormDB{DB: db}
+
+	cfg := config.OIDCConfig{
+		Enabled:       true,
+		IssuerURL:     idp.server.URL,
+		ClientID:      testClientID,
+		RedirectURL:   "http://orca.test/api/auth/oidc/callback",
+		UsernameClaim: "preferred_username",
+		GroupsClaim:   "groups",
+		AdminGroups:   []string{"ORCA-Admins"},
+		GroupRoles:    []config.GroupRoleMapping{{Group: "orca-ops", Roles: []string{"operator"}}},
+	}
+	logger := logrus.New()
+	auth := handlers.NewAuthHandler(gormDB, time.Hour)
+	auth.EnableOIDC()
+	oidcHandler := handlers.NewOIDCHandler(auth, services.NewOIDCProvider(cfg), services.NewIdentityProvisioner(gormDB, logger),
+		orcacrypto.NewEncryptor("test-session-secret"), logger, "/")
+
+	gin.SetMode(gin.TestMode)
+	router := gin.New()
+	router.POST("/api/auth/login", auth.Login)
+	router.GET("/api/auth/providers", auth.Providers)
+	router.GET("/api/auth/oidc/login", oidcHandler.Login)
+	router.GET("/api/auth/oidc/callback", oidcHandler.Callback)
+	return router, db, auth
+}
+
+// oidcLogin runs a login through the provider and returns the final response
+func oidcLogin(t *testing.T, router *gin.Engine, idp *fakeIdP, claims map[string]interface{}, tamper func(url.Values)) *httptest.ResponseRecorder {
+	t.Helper()
+	w := httptest.NewRecorder()
+	router.ServeHTTP(w, httptest.NewRequest(http.MethodGet, "/api/auth/oidc/login?redirect=/operations", nil))
+	require.Equal(t, http.StatusFound, w.Code)
+
+	callback := idp.authorize(t, w.Header().Get("Location"), claims)
+	if tamper != nil {
+		tamper(callback)
+	}
+	req := httptest.NewRequest(http.MethodGet, "/api/auth/oidc/callback?"+callback.Encode(), nil)
+	for _, cookie := range w.Result().Cookies() {
+		req.AddCookie(cookie)
+	}
+	w = httptest.NewRecorder()
+	router.ServeHTTP(w, req)
+	require.Equal(t, http.StatusFound, w.Code)
+	return w
+}
+
+func sessionCookie(w *httptest.ResponseRecorder) *http.Cookie {
+	for _, cookie := range w.Result().Cookies() {
+		if cookie.Name == "session_token" {
+			return cookie
+		}
+	}
+	return nil
+}
+
+func TestOIDCLogin(t *testing.T) {
+	idp := newFakeIdP(t)
+	router, db, _ := setupOIDCTest(t, idp)
+
+	claims := map[string]interface{}{
+		"sub":                "subject-1",
+		"preferred_username": "jdoe",
+		"email":              "jdoe@example.com",
+		"groups":             []string{"orca-admins", "orca-ops"},
+	}
+	w := oidcLogin(t, router, idp, claims, nil)
+	assert.Equal(t, "/operations", w.Header().Get("Location"))
+	cookie := sessionCookie(w)
+	require.NotNil(t, cookie)
+
+	// Provisioned just in time, with admin status and roles from the groups
+	var user gormmodels.User
+	require.NoError(t, db.First(&user, "username = ?", "jdoe").Error)
+	assert.Equal(t, gormmodels.AuthProviderOIDC, user.AuthProvider)
+	assert.Equal(t, "subject-1", *user.ExternalID)
+	assert.True(t, user.IsAdmin)
+
+	var session gormmodels.Session
+	require.NoError(t, db.First(&session, "token = ?", cookie.Value).Error)
+	assert.Equal(t, user.ID, session.UserID)
+
+	var assignments []gormmodels.RoleAssignment
+	require.NoError(t, db.Preload("Role").Find(&assignments, "user_id = ?", user.ID).Error)
+	require.Len(t, assignments, 1)
+	assert.Equal(t, "operator", assignments[0].Role.Name)
+	assert.Equal(t, gormmodels.AuthProviderOIDC, assignments[0].Source)
+
+	// Manual assignments survive group changes, mapped ones follow them
+	var viewer gormmodels.Role
+	require.NoError(t, db.First(&viewer, "name = ?", "viewer").Error)
+	require.NoError(t, db.Create(&gormmodels.RoleAssignment{UserID: user.ID, RoleID: viewer.ID}).Error)
+
+	claims["groups"] = []string{"someone-else"}
+	oidcLogin(t, router, idp, claims, nil)
+	require.NoError(t, db.First(&user, "id = ?", user.ID).Error)
+	assert.False(t, user.IsAdmin)
+	assignments = nil
+	require.NoError(t, db.Find(&assignments, "user_id = ?", user.ID).Error)
+	require.Len(t, assignments, 1)
+	assert.Equal(t, viewer.ID, assignments[0].RoleID)
+
+	// OIDC accounts have no local password
+	w = httptest.NewRecorder()
+	router.ServeHTTP(w, httptest.NewRequest(http.MethodPost, "/api/auth/login", strings.NewReader(`{"username":"jdoe","password":""}`)))
+	assert.Equal(t, http.StatusBadRequest, w.Code)
+	w = httptest.NewRecorder()
+	router.ServeHTTP(w, httptest.NewRequest(http.MethodPost, "/api/auth/login", strings.NewReader(`{"username":"jdoe","password":"x"}`)))
+	assert.Equal(t, http.StatusUnauthorized, w.Code)
+}
+
+func TestOIDCLoginRejected(t *testing.T) {
+	idp := newFakeIdP(t)
+	router, db, _ := setupOIDCTest(t, idp)
+	require.NoError(t, db.Create(&gormmodels.User{Username: "local", PasswordHash: "x"}).Error)
+
+	tests := []struct {
+		name   string
+		claims map[string]interface{}
+		tamper func(url.Values)
+		want   string
+	}{
+		{"state mismatch", map[string]interface{}{"sub": "s1", "preferred_username": "a"}, func(v url.Values) { v.Set("state", "forged") }, "invalid_state"},
+		{"wrong code", map[string]interface{}{"sub": "s2", "preferred_username": "b"}, func(v url.Values) { v.Set("code", "unknown") }, "sso_failed"},
+		{"provider error", map[string]interface{}{"sub": "s3", "preferred_username": "c"}, func(v url.Values) { v.Set("error", "access_denied") }, "sso_failed"},
+		{"local account", map[string]interface{}{"sub": "s4", "preferred_username": "local"}, nil, "account_conflict"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			w := oidcLogin(t, router, idp, tt.claims, tt.tamper)
+			assert.Equal(t, "/login?error="+tt.want, w.Header().Get("Location"))
+			assert.Nil(t, sessionCookie(w))
+		})
+	}
+
+	// Without the login cookie
+	w := httptest.NewRecorder()
+	router.ServeHTTP(w, httptest.NewRequest(http.MethodGet, "/api/auth/oidc/callback?code=x&state=y", nil))
+	assert.Equal(t, "/login?error=invalid_state", w.Header().Get("Location"))
+}
+
+func TestLocalLoginRestrictedToBreakGlass(t *testing.T) {
+	idp := newFakeIdP(t)
+	router, db, auth := setupOIDCTest(t, idp)
+	auth.RestrictLocalLogin([]string{"admin"})
+
+	hash, err := pkgcrypto.HashPassword("secret")
+	require.NoError(t, err)
+	require.NoError(t, db.Create(&gormmodels.User{Username: "admin", PasswordHash: hash, IsActive: true, IsAdmin: true}).Error)
+	require.NoError(t, db.Create(&gormmodels.User{Username: "operator", PasswordHash: hash, IsActive: true}).Error)
+
+	login := func(username string) int {
+		w := httptest.NewRecorder()
+		router.ServeHTTP(w, httptest.NewRequest(http.MethodPost, "/api/auth/login",
+			strings.NewReader(`{"username":"`+username+`","password":"secret"}`)))
+		return w.Code
+	}
+	assert.Equal(t, http.StatusOK, login("admin"))
+	assert.Equal(t, http.StatusForbidden, login("operator"))
+
+	w := httptest.NewRecorder()
+	router.ServeHTTP(w, httptest.NewRequest(http.MethodGet, "/api/auth/providers", nil))
+	assert.JSONEq(t, `{"local":false,"oidc":true,"ldap":false,"oidc_login_url":"/api/auth/oidc/login"}`, w.Body.String())
+}
@@ -54,6 +54,11 @@ func (h *OperationsHandler) GetOperation(c *gin.Context) {
 		return
 	}
 	
+	if !canAccessInstance(middleware.GetPermissions(c), gormmodels.PermOperationsRead, op.CyberArkInstanceID) {
+		middleware.Forbidden(c, gormmodels.PermOperationsRead)
+		return
+	}
+	
 	response := h.operationToResponse(&op)
 	c.JSON(http.StatusOK, response)
 }
@@ -82,6 +87,9 @@ func (h *OperationsHandler) ListOperations(c *gin.Context) {
 		Preload("Creator").
 		Preload("CyberArkInstance")
 	
+	// Only operations of instances the user may see
+	query = scopeToInstances(query, middleware.GetPermissions(c), gormmodels.PermOperationsRead, "cyber_ark_instance_id")
+	
 	// Apply filters
 	if status := c.Query("status"); status != "" {
 		query = query.Where("status = ?", status)
@@ -177,12 +185,21 @@ func (h *OperationsHandler) ListOperations(c *gin.Context) {
 func (h *OperationsHandler) CancelOperation(c *gin.Context) {
 	id := c.Param("id")
 	
+	if !h.authorizeOperation(c, id, gormmodels.PermOperationsCancel) {
+		return
+	}
+	
+	var before gormmodels.Operation
+	h.db.Select("status").First(&before, "id = ?", id)
+
 	// Update operation status to cancelled only if it's pending or processing
 	result := h.db.Model(&gormmodels.Operation{}).
 		Where("id = ? AND status IN (?, ?)", id, gormmodels.OpStatusPending, gormmodels.OpStatusProcessing).
 		Updates(map[string]interface{}{
 			"status": gormmodels.OpStatusCancelled,
 			"completed_at": time.Now(),
+			"locked_by": nil,
+			"lease_expires_at": nil,
 		})
 	
 	if result.Error != nil {
@@ -196,6 +213,9 @@ func (h *OperationsHandler) CancelOperation(c *gin.Context) {
 		return
 	}
 	
+	middleware.SetAuditTarget(c, "operation:"+id)
+	middleware.SetAuditChanges(c, map[string]string{"status": before.Status}, map[string]string{"status": gormmodels.OpStatusCancelled})
+
 	h.logger.WithField("operation_id", id).Info("Operation cancelled")
 	
 	// Publish cancellation event
@@ -225,6 +245,12 @@ func (h *OperationsHandler) CreateOperation(c *gin.Context) {
 		return
 	}
 	
+	permission := gormmodels.OperationCreatePermission(req.Type)
+	if !canAccessInstance(middleware.GetPermissions(c), permission, req.CyberArkInstanceID) {
+		middleware.Forbidden(c, permission)
+		return
+	}
+	
 	// Get current user
 	user := middleware.GetUser(c)
 	
@@ -258,6 +284,9 @@ func (h *OperationsHandler) CreateOperation(c *gin.Context) {
 		return
 	}
 	
+	middleware.SetAuditTarget(c, "operation:"+operation.ID)
+	middleware.SetAuditChanges(c, nil, operation)
+
 	h.logger.WithFields(logrus.Fields{
 		"operation_id": operation.ID,
 		"type":         operation.Type,
@@ -275,6 +304,26 @@ func (h *OperationsHandler) CreateOperation(c *gin.Context) {
 	c.JSON(http.StatusCreated, h.operationToResponse(operation))
 }
 
+// authorizeOperation checks that the user holds the permission for the
+// instance of an operation, writing the response if not
+func (h *OperationsHandler) authorizeOperation(c *gin.Context, id, permission string) bool {
+	var op gormmodels.Operation
+	if err := h.db.Select("id", "cyber_ark_instance_id").First(&op, "id = ?", id).Error; err != nil {
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			c.JSON(http.StatusNotFound, gin.H{"error": "Operation not found"})
+			return false
+		}
+		h.logger.WithError(err).Error("Failed to get operation")
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to get operation"})
+		return false
+	}
+	if !canAccessInstance(middleware.GetPermissions(c), permission, op.CyberArkInstanceID) {
+		middleware.Forbidden(c, permission)
+		return false
+	}
+	return true
+}
+
 // operationToResponse converts an operation to API response format
 func (h *OperationsHandler) operationToResponse(op *gormmodels.Operation) interface{} {
 	resp := map[string]interface{}{
@@ -341,6 +390,11 @@ func (h *OperationsHandler) UpdatePriority(c *gin.Context) {
 		return
 	}
 	
+	if !canAccessInstance(middleware.GetPermissions(c), gormmodels.PermOperationsApprove, operation.CyberArkInstanceID) {
+		middleware.Forbidden(c, gormmodels.PermOperationsApprove)
+		return
+	}
+	
 	// Check if operation can be updated (only pending or processing)
 	if operation.Status != gormmodels.OpStatusPending && operation.Status != gormmodels.OpStatusProcessing {
 		c.JSON(http.StatusBadRequest, gin.H{"error": "Can only update priority for pending or processing operations"})
@@ -348,15 +402,19 @@ func (h *OperationsHandler) UpdatePriority(c *gin.Context) {
 	}
 	
 	// Update priority
+	oldPriority := operation.Priority
 	if err := h.db.Model(&operation).Update("priority", req.Priority).Error; err != nil {
 		h.logger.WithError(err).Error("Failed to update operation priority")
 		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to update priority"})
 		return
 	}
 	
+	middleware.SetAuditTarget(c, "operation:"+operation.ID)
+	middleware.SetAuditChanges(c, map[string]string{"priority": oldPriority}, map[string]string{"priority": req.Priority})
+
 	h.logger.WithFields(logrus.Fields{
 		"operation_id": operation.ID,
-		"old_priority": operation.Priority,
+		"old_priority": oldPriority,
 		"new_priority": req.Priority,
 	}).Info("Operation priority updated")
 	
@@ -385,6 +443,8 @@ func (h *OperationsHandler) StreamOperations(c *gin.Context) {
 		return
 	}
 	
+	permissions := middleware.GetPermissions(c)
+	
 	// Create a unique client ID
 	clientID := fmt.Sprintf("user_%s_%s", user.ID, ulid.New(ulid.SessionPrefix))
 	
@@ -415,7 +475,7 @@ func (h *OperationsHandler) StreamOperations(c *gin.Context) {
 			}
 			
 			// Convert operation to API response format
-			if event.Operation != nil {
+			if event.Operation != nil && canSeeEvent(permissions, event) {
 				// Need to preload related data for the response
 				h.db.Preload("Creator").Preload("CyberArkInstance").First(event.Operation, "id = ?", event.Operation.ID)
 				response := h.operationToResponse(event.Operation)
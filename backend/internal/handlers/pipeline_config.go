@@ -0,0 +1,156 @@
+package handlers
+
+import (
+	"encoding/json"
+	"io"
+	"net/http"
+	"strings"
+
+	"github.com/gin-gonic/gin"
+	"github.com/sirupsen/logrus"
+
+	"github.com/orca-ng/orca/internal/database"
+	"github.com/orca-ng/orca/internal/middleware"
+	"github.com/orca-ng/orca/internal/pipeline"
+)
+
+// PipelineConfigHandler handles the pipeline configuration admin endpoints
+type PipelineConfigHandler struct {
+	db        *database.GormDB
+	logger    *logrus.Logger
+	store     *pipeline.Store
+	processor *pipeline.Processor
+}
+
+// NewPipelineConfigHandler creates a new pipeline config handler
+func NewPipelineConfigHandler(db *database.GormDB, logger *logrus.Logger, processor *pipeline.Processor) *PipelineConfigHandler {
+	return &PipelineConfigHandler{
+		db:        db,
+		logger:    logger,
+		store:     pipeline.NewStore(db),
+		processor: processor,
+	}
+}
+
+// GetConfig returns the stored pipeline configuration
+func (h *PipelineConfigHandler) GetConfig(c *gin.Context) {
+	config, err := h.store.GetPipelineConfig(c.Request.Context())
+	if err != nil {
+		h.logger.WithError(err).Error("Failed to get pipeline config")
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to get pipeline config"})
+		return
+	}
+
+	c.JSON(http.StatusOK, config)
+}
+
+// UpdateConfig validates, stores and applies a pipeline configuration.
+// Fields left out of the request keep their current values.
+func (h *PipelineConfigHandler) UpdateConfig(c *gin.Context) {
+	// Kept for the audit log
+	before, _ := h.store.GetPipelineConfig(c.Request.Context())
+
+	config, ok := h.mergeRequest(c)
+	if !ok {
+		return
+	}
+
+	if err := config.Validate(); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{
+			"error":  "Invalid pipeline config",
+			"errors": validationErrors(err),
+		})
+		return
+	}
+
+	if err := h.store.SavePipelineConfig(c.Request.Context(), config); err != nil {
+		h.logger.WithError(err).Error("Failed to save pipeline config")
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to save pipeline config"})
+		return
+	}
+
+	// Apply right away on this replica; the others pick the change up
+	// from the database
+	if h.processor != nil {
+		if err := h.processor.ApplyConfig(config); err != nil {
+			h.logger.WithError(err).Error("Failed to apply pipeline config")
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to apply pipeline config"})
+			return
+		}
+	}
+
+	middleware.SetAuditTarget(c, "pipeline_config")
+	middleware.SetAuditChanges(c, before, config)
+
+	h.logger.Info("Pipeline config updated")
+	c.JSON(http.StatusOK, config)
+}
+
+// ValidateConfig checks a pipeline configuration without saving it
+func (h *PipelineConfigHandler) ValidateConfig(c *gin.Context) {
+	config, ok := h.mergeRequest(c)
+	if !ok {
+		return
+	}
+
+	if err := config.Validate(); err != nil {
+		c.JSON(http.StatusOK, gin.H{
+			"valid":  false,
+			"errors": validationErrors(err),
+		})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{"valid": true})
+}
+
+// mergeRequest applies the request body on top of the stored configuration.
+// Maps in the request replace the stored maps rather than being merged.
+func (h *PipelineConfigHandler) mergeRequest(c *gin.Context) (*pipeline.PipelineConfig, bool) {
+	body, err := io.ReadAll(c.Request.Body)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Failed to read request body"})
+		return nil, false
+	}
+
+	var fields map[string]json.RawMessage
+	if err := json.Unmarshal(body, &fields); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid request body"})
+		return nil, false
+	}
+
+	config, err := h.store.GetPipelineConfig(c.Request.Context())
+	if err != nil {
+		h.logger.WithError(err).Error("Failed to get pipeline config")
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to get pipeline config"})
+		return nil, false
+	}
+
+	if _, ok := fields["priority_allocation"]; ok {
+		config.PriorityAllocation = nil
+	}
+	if _, ok := fields["operation_timeouts"]; ok {
+		config.OperationTimeouts = nil
+	}
+	if _, ok := fields["retry_policies"]; ok {
+		config.RetryPolicies = nil
+	}
+
+	if err := json.Unmarshal(body, config); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid request body"})
+		return nil, false
+	}
+	if config.OperationTimeouts == nil {
+		config.OperationTimeouts = make(map[pipeline.OperationType]int)
+	}
+	if config.RetryPolicies == nil {
+		config.RetryPolicies = make(map[pipeline.OperationType]pipeline.RetryPolicy)
+	}
+
+	return config, true
+}
+
+// validationErrors splits a joined validation error into its messages
+func validationErrors(err error) []string {
+	return strings.Split(err.Error(), "\n")
+}
@@ -0,0 +1,124 @@
+package handlers_test
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/gin-gonic/gin"
+	"github.com/sirupsen/logrus"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"gorm.io/driver/sqlite"
+	"gorm.io/gorm"
+
+	"github.com/orca-ng/orca/internal/database"
+	"github.com/orca-ng/orca/internal/handlers"
+	gormmodels "github.com/orca-ng/orca/internal/models/gorm"
+	"github.com/orca-ng/orca/internal/pipeline"
+)
+
+func setupPipelineConfigTest(t *testing.T) (*gin.Engine, *pipeline.Processor, *database.GormDB) {
+	db, err := gorm.Open(sqlite.Open(":memory:"), &gorm.Config{})
+	require.NoError(t, err)
+	require.NoError(t, db.AutoMigrate(&gormmodels.PipelineConfig{}))
+	gormDB := &database.GormDB{DB: db}
+
+	// Rows seeded by earlier versions are replaced
+	require.NoError(t, db.Create(&gormmodels.PipelineConfig{Key: "worker_count", Value: []byte(`{"value": 8}`)}).Error)
+	require.NoError(t, pipeline.NewStore(gormDB).SeedPipelineConfig(context.Background()))
+
+	logger := logrus.New()
+	processor := pipeline.NewProcessor(gormDB, pipeline.DefaultPipelineConfig(), logger, nil, "test-key", nil)
+	handler := handlers.NewPipelineConfigHandler(gormDB, logger, processor)
+
+	gin.SetMode(gin.TestMode)
+	router := gin.New()
+	router.GET("/api/admin/pipeline/config", handler.GetConfig)
+	router.PUT("/api/admin/pipeline/config", handler.UpdateConfig)
+	router.POST("/api/admin/pipeline/config/validate", handler.ValidateConfig)
+
+	return router, processor, gormDB
+}
+
+func TestPipelineConfigSeededKeys(t *testing.T) {
+	router, _, db := setupPipelineConfigTest(t)
+
+	var keys []string
+	require.NoError(t, db.Model(&gormmodels.PipelineConfig{}).Order("key").Pluck("key", &keys).Error)
+	assert.Equal(t, []string{"fair_share", "operation_timeouts", "priority_aging", "processing_capacity", "retry_policies", "retry_policy"}, keys)
+
+	w := httptest.NewRecorder()
+	req, _ := http.NewRequest("GET", "/api/admin/pipeline/config", nil)
+	router.ServeHTTP(w, req)
+	require.Equal(t, http.StatusOK, w.Code)
+
+	var config pipeline.PipelineConfig
+	require.NoError(t, json.Unmarshal(w.Body.Bytes(), &config))
+	assert.Equal(t, 8, config.TotalCapacity, "legacy worker_count is carried over")
+	assert.Equal(t, 300, config.DefaultTimeout)
+	assert.True(t, config.RetryPolicy.ReauthOnAuthExpired)
+	assert.Empty(t, config.RetryPolicies)
+}
+
+func TestUpdatePipelineConfigAppliesLive(t *testing.T) {
+	router, processor, _ := setupPipelineConfigTest(t)
+
+	body := `{"total_capacity": 12, "default_timeout": 600, "retry_policy": {"max_attempts": 5, "backoff_base_seconds": 5, "backoff_multiplier": 3, "backoff_max_seconds": 120},
+		"retry_policies": {"safe_provision": {"max_attempts": 1, "backoff_base_seconds": 30, "backoff_multiplier": 1, "backoff_max_seconds": 30, "retry_on": ["network"]}}}`
+	w := httptest.NewRecorder()
+	req, _ := http.NewRequest("PUT", "/api/admin/pipeline/config", bytes.NewBufferString(body))
+	req.Header.Set("Content-Type", "application/json")
+	router.ServeHTTP(w, req)
+	require.Equal(t, http.StatusOK, w.Code, w.Body.String())
+
+	applied := processor.Config()
+	assert.Equal(t, 12, applied.TotalCapacity)
+	assert.Equal(t, 600, applied.DefaultTimeout)
+	assert.Equal(t, 5, applied.RetryPolicy.MaxAttempts)
+	assert.Equal(t, 1, applied.RetryPolicyFor(pipeline.OpTypeSafeProvision).MaxAttempts)
+	assert.Equal(t, 5, applied.RetryPolicyFor(pipeline.OpTypeSafeSync).MaxAttempts)
+
+	// Settings left out of the request are kept
+	assert.Equal(t, 0.5, applied.PriorityAllocation[pipeline.PriorityHigh])
+
+	// The change is persisted
+	w = httptest.NewRecorder()
+	req, _ = http.NewRequest("GET", "/api/admin/pipeline/config", nil)
+	router.ServeHTTP(w, req)
+	var stored pipeline.PipelineConfig
+	require.NoError(t, json.Unmarshal(w.Body.Bytes(), &stored))
+	assert.Equal(t, 12, stored.TotalCapacity)
+	assert.Equal(t, 120, stored.RetryPolicy.BackoffMaxSeconds)
+	assert.Equal(t, []pipeline.ErrorClass{pipeline.ErrorClassNetwork}, stored.RetryPolicies[pipeline.OpTypeSafeProvision].RetryOn)
+}
+
+func TestUpdatePipelineConfigRejectsInvalid(t *testing.T) {
+	router, processor, _ := setupPipelineConfigTest(t)
+
+	body := `{"total_capacity": 0, "priority_allocation": {"high": 0.9, "low": 0.3}, "retry_policies": {"user_sync": {"max_attempts": 2, "backoff_base_seconds": 10, "backoff_multiplier": 2, "backoff_max_seconds": 60, "retry_on": ["permanent"]}}}`
+	w := httptest.NewRecorder()
+	req, _ := http.NewRequest("PUT", "/api/admin/pipeline/config", bytes.NewBufferString(body))
+	req.Header.Set("Content-Type", "application/json")
+	router.ServeHTTP(w, req)
+	require.Equal(t, http.StatusBadRequest, w.Code)
+
+	var response struct {
+		Errors []string `json:"errors"`
+	}
+	require.NoError(t, json.Unmarshal(w.Body.Bytes(), &response))
+	assert.Len(t, response.Errors, 3)
+
+	// Nothing was applied
+	assert.Equal(t, 5, processor.Config().TotalCapacity)
+
+	// The validate endpoint reports the same problems without saving
+	w = httptest.NewRecorder()
+	req, _ = http.NewRequest("POST", "/api/admin/pipeline/config/validate", bytes.NewBufferString(body))
+	router.ServeHTTP(w, req)
+	require.Equal(t, http.StatusOK, w.Code)
+	assert.Contains(t, w.Body.String(), `"valid":false`)
+}
@@ -0,0 +1,408 @@
+package handlers
+
+import (
+	"errors"
+	"net/http"
+	"strings"
+
+	"github.com/gin-gonic/gin"
+	"github.com/sirupsen/logrus"
+	"gorm.io/gorm"
+
+	"github.com/orca-ng/orca/internal/database"
+	"github.com/orca-ng/orca/internal/middleware"
+	"github.com/orca-ng/orca/internal/models"
+	gormmodels "github.com/orca-ng/orca/internal/models/gorm"
+	"github.com/orca-ng/orca/internal/services"
+)
+
+// RolesHandler manages roles and their assignment to users
+type RolesHandler struct {
+	db     *database.GormDB
+	logger *logrus.Logger
+}
+
+// NewRolesHandler creates a new roles handler
+func NewRolesHandler(db *database.GormDB, logger *logrus.Logger) *RolesHandler {
+	return &RolesHandler{
+		db:     db,
+		logger: logger,
+	}
+}
+
+// ListPermissions returns the permissions roles can grant
+func (h *RolesHandler) ListPermissions(c *gin.Context) {
+	c.JSON(http.StatusOK, gin.H{
+		"permissions": services.KnownPermissions(),
+		"global_only": gormmodels.GlobalOnlyPermissions,
+	})
+}
+
+// MyPermissions returns the permissions of the authenticated user
+func (h *RolesHandler) MyPermissions(c *gin.Context) {
+	c.JSON(http.StatusOK, middleware.GetPermissions(c).Summary())
+}
+
+// ListRoles returns all roles
+func (h *RolesHandler) ListRoles(c *gin.Context) {
+	var roles []gormmodels.Role
+	if err := h.db.Order("name ASC").Find(&roles).Error; err != nil {
+		h.logger.WithError(err).Error("Failed to get roles")
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to retrieve roles"})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{
+		"roles": roles,
+		"count": len(roles),
+	})
+}
+
+// GetRole returns a single role
+func (h *RolesHandler) GetRole(c *gin.Context) {
+	role, ok := h.findRole(c, c.Param("id"))
+	if !ok {
+		return
+	}
+	c.JSON(http.StatusOK, role)
+}
+
+// CreateRole creates a custom role
+func (h *RolesHandler) CreateRole(c *gin.Context) {
+	var req models.CreateRoleRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	permissions, err := normalizePermissions(req.Permissions)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	role := gormmodels.Role{
+		Name:        strings.TrimSpace(req.Name),
+		Description: req.Description,
+		Permissions: permissions,
+		RequireMFA:  req.RequireMFA,
+	}
+	if exists, err := h.nameTaken(role.Name, ""); err != nil {
+		h.logger.WithError(err).Error("Failed to check role name")
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to create role"})
+		return
+	} else if exists {
+		c.JSON(http.StatusConflict, gin.H{"error": "A role with this name already exists"})
+		return
+	}
+
+	if err := h.db.Create(&role).Error; err != nil {
+		h.logger.WithError(err).Error("Failed to create role")
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to create role"})
+		return
+	}
+
+	middleware.SetAuditTarget(c, "role:"+role.ID)
+	middleware.SetAuditChanges(c, nil, &role)
+
+	h.logger.WithFields(logrus.Fields{
+		"role_id":     role.ID,
+		"name":        role.Name,
+		"permissions": role.Permissions,
+	}).Info("Role created")
+
+	c.JSON(http.StatusCreated, role)
+}
+
+// UpdateRole updates a custom role. Of built-in roles only the MFA
+// requirement can be changed.
+func (h *RolesHandler) UpdateRole(c *gin.Context) {
+	var req models.UpdateRoleRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	role, ok := h.findRole(c, c.Param("id"))
+	if !ok {
+		return
+	}
+	if role.IsSystem && (req.Name != nil || req.Description != nil || req.Permissions != nil) {
+		c.JSON(http.StatusForbidden, gin.H{"error": "Built-in roles cannot be modified"})
+		return
+	}
+	before := *role
+
+	if req.Name != nil {
+		name := strings.TrimSpace(*req.Name)
+		if exists, err := h.nameTaken(name, role.ID); err != nil {
+			h.logger.WithError(err).Error("Failed to check role name")
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to update role"})
+			return
+		} else if exists {
+			c.JSON(http.StatusConflict, gin.H{"error": "A role with this name already exists"})
+			return
+		}
+		role.Name = name
+	}
+	if req.Description != nil {
+		role.Description = *req.Description
+	}
+	if req.Permissions != nil {
+		permissions, err := normalizePermissions(req.Permissions)
+		if err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+			return
+		}
+		role.Permissions = permissions
+	}
+
+	if req.RequireMFA != nil {
+		role.RequireMFA = *req.RequireMFA
+	}
+
+	if err := h.db.Select("name", "description", "permissions", "require_mfa").Updates(role).Error; err != nil {
+		h.logger.WithError(err).Error("Failed to update role")
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to update role"})
+		return
+	}
+
+	middleware.SetAuditTarget(c, "role:"+role.ID)
+	middleware.SetAuditChanges(c, &before, role)
+
+	h.logger.WithFields(logrus.Fields{
+		"role_id":     role.ID,
+		"permissions": role.Permissions,
+		"require_mfa": role.RequireMFA,
+	}).Info("Role updated")
+
+	c.JSON(http.StatusOK, role)
+}
+
+// DeleteRole deletes a custom role that is no longer assigned
+func (h *RolesHandler) DeleteRole(c *gin.Context) {
+	role, ok := h.findRole(c, c.Param("id"))
+	if !ok {
+		return
+	}
+	if role.IsSystem {
+		c.JSON(http.StatusForbidden, gin.H{"error": "Built-in roles cannot be deleted"})
+		return
+	}
+
+	var assigned int64
+	if err := h.db.Model(&gormmodels.RoleAssignment{}).Where("role_id = ?", role.ID).Count(&assigned).Error; err != nil {
+		h.logger.WithError(err).Error("Failed to count role assignments")
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to delete role"})
+		return
+	}
+	if assigned > 0 {
+		c.JSON(http.StatusConflict, gin.H{"error": "Role is still assigned to users"})
+		return
+	}
+
+	if err := h.db.Delete(role).Error; err != nil {
+		h.logger.WithError(err).Error("Failed to delete role")
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to delete role"})
+		return
+	}
+
+	middleware.SetAuditTarget(c, "role:"+role.ID)
+	middleware.SetAuditChanges(c, role, nil)
+
+	h.logger.WithField("role_id", role.ID).Info("Role deleted")
+	c.JSON(http.StatusOK, gin.H{"message": "Role deleted successfully"})
+}
+
+// ListUserRoles returns the role assignments of a user
+func (h *RolesHandler) ListUserRoles(c *gin.Context) {
+	userID := c.Param("id")
+	if !h.userExists(c, userID) {
+		return
+	}
+
+	var assignments []gormmodels.RoleAssignment
+	if err := h.db.Preload("Role").Where("user_id = ?", userID).Order("created_at ASC").Find(&assignments).Error; err != nil {
+		h.logger.WithError(err).Error("Failed to get role assignments")
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to retrieve role assignments"})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{
+		"assignments": assignments,
+		"count":       len(assignments),
+	})
+}
+
+// AssignRole grants a role to a user, globally or for one CyberArk instance
+func (h *RolesHandler) AssignRole(c *gin.Context) {
+	userID := c.Param("id")
+
+	var req models.AssignRoleRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+	if req.CyberArkInstanceID != nil && *req.CyberArkInstanceID == "" {
+		req.CyberArkInstanceID = nil
+	}
+
+	if !h.userExists(c, userID) {
+		return
+	}
+	role, ok := h.findRole(c, req.RoleID)
+	if !ok {
+		return
+	}
+	if req.CyberArkInstanceID != nil {
+		var count int64
+		if err := h.db.Model(&gormmodels.CyberArkInstance{}).Where("id = ?", *req.CyberArkInstanceID).Count(&count).Error; err != nil {
+			h.logger.WithError(err).Error("Failed to check CyberArk instance")
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to assign role"})
+			return
+		}
+		if count == 0 {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "CyberArk instance not found"})
+			return
+		}
+	}
+
+	query := h.db.Model(&gormmodels.RoleAssignment{}).Where("user_id = ? AND role_id = ?", userID, role.ID)
+	if req.CyberArkInstanceID == nil {
+		query = query.Where("cyber_ark_instance_id IS NULL")
+	} else {
+		query = query.Where("cyber_ark_instance_id = ?", *req.CyberArkInstanceID)
+	}
+	var existing int64
+	if err := query.Count(&existing).Error; err != nil {
+		h.logger.WithError(err).Error("Failed to check role assignments")
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to assign role"})
+		return
+	}
+	if existing > 0 {
+		c.JSON(http.StatusConflict, gin.H{"error": "Role is already assigned with this scope"})
+		return
+	}
+
+	assignment := gormmodels.RoleAssignment{
+		UserID:             userID,
+		RoleID:             role.ID,
+		CyberArkInstanceID: req.CyberArkInstanceID,
+	}
+	if user := middleware.GetUser(c); user != nil {
+		assignment.CreatedBy = &user.ID
+	}
+	if err := h.db.Create(&assignment).Error; err != nil {
+		h.logger.WithError(err).Error("Failed to assign role")
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to assign role"})
+		return
+	}
+	assignment.Role = role
+
+	middleware.SetAuditTarget(c, "user:"+userID)
+	auditRoleAssignment(c, &assignment)
+
+	h.logger.WithFields(logrus.Fields{
+		"user_id":              userID,
+		"role_id":              role.ID,
+		"cyberark_instance_id": req.CyberArkInstanceID,
+	}).Info("Role assigned")
+
+	c.JSON(http.StatusCreated, assignment)
+}
+
+// UnassignRole removes a role assignment from a user
+func (h *RolesHandler) UnassignRole(c *gin.Context) {
+	// Loaded for the audit log, a missing assignment is reported below
+	var assignment gormmodels.RoleAssignment
+	h.db.Preload("Role").Where("id = ? AND user_id = ?", c.Param("assignment_id"), c.Param("id")).First(&assignment)
+
+	result := h.db.Where("id = ? AND user_id = ?", c.Param("assignment_id"), c.Param("id")).Delete(&gormmodels.RoleAssignment{})
+	if result.Error != nil {
+		h.logger.WithError(result.Error).Error("Failed to remove role assignment")
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to remove role assignment"})
+		return
+	}
+	if result.RowsAffected == 0 {
+		c.JSON(http.StatusNotFound, gin.H{"error": "Role assignment not found"})
+		return
+	}
+
+	middleware.SetAuditTarget(c, "user:"+c.Param("id"))
+	auditRoleAssignment(c, &assignment)
+
+	h.logger.WithFields(logrus.Fields{
+		"user_id":       c.Param("id"),
+		"assignment_id": c.Param("assignment_id"),
+	}).Info("Role assignment removed")
+
+	c.JSON(http.StatusOK, gin.H{"message": "Role assignment removed"})
+}
+
+// auditRoleAssignment describes a role assignment in the audit event of the
+// request
+func auditRoleAssignment(c *gin.Context, assignment *gormmodels.RoleAssignment) {
+	middleware.AddAuditDetail(c, "assignment_id", assignment.ID)
+	middleware.AddAuditDetail(c, "role_id", assignment.RoleID)
+	if assignment.Role != nil {
+		middleware.AddAuditDetail(c, "role", assignment.Role.Name)
+	}
+	if assignment.CyberArkInstanceID != nil {
+		middleware.AddAuditDetail(c, "cyberark_instance_id", *assignment.CyberArkInstanceID)
+	}
+}
+
+func (h *RolesHandler) findRole(c *gin.Context, id string) (*gormmodels.Role, bool) {
+	var role gormmodels.Role
+	if err := h.db.First(&role, "id = ?", id).Error; err != nil {
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			c.JSON(http.StatusNotFound, gin.H{"error": "Role not found"})
+			return nil, false
+		}
+		h.logger.WithError(err).Error("Failed to get role")
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to retrieve role"})
+		return nil, false
+	}
+	return &role, true
+}
+
+func (h *RolesHandler) userExists(c *gin.Context, id string) bool {
+	var count int64
+	if err := h.db.Model(&gormmodels.User{}).Where("id = ?", id).Count(&count).Error; err != nil {
+		h.logger.WithError(err).Error("Failed to get user")
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to retrieve user"})
+		return false
+	}
+	if count == 0 {
+		c.JSON(http.StatusNotFound, gin.H{"error": "User not found"})
+		return false
+	}
+	return true
+}
+
+func (h *RolesHandler) nameTaken(name, exceptID string) (bool, error) {
+	var count int64
+	query := h.db.Model(&gormmodels.Role{}).Where("name = ?", name)
+	if exceptID != "" {
+		query = query.Where("id <> ?", exceptID)
+	}
+	err := query.Count(&count).Error
+	return count > 0, err
+}
+
+// normalizePermissions validates permissions and removes duplicates
+func normalizePermissions(permissions []string) ([]string, error) {
+	var result []string
+	seen := make(map[string]bool)
+	for _, p := range permissions {
+		p = strings.TrimSpace(p)
+		if err := services.ValidatePermission(p); err != nil {
+			return nil, err
+		}
+		if !seen[p] {
+			seen[p] = true
+			result = append(result, p)
+		}
+	}
+	return result, nil
+}
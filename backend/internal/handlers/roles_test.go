@@ -0,0 +1,220 @@
+package handlers_test
+
+import (
+	"bytes"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/gin-gonic/gin"
+	"github.com/sirupsen/logrus"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"gorm.io/driver/sqlite"
+	"gorm.io/gorm"
+
+	"github.com/orca-ng/orca/internal/database"
+	"github.com/orca-ng/orca/internal/handlers"
+	"github.com/orca-ng/orca/internal/middleware"
+	"github.com/orca-ng/orca/internal/models"
+	gormmodels "github.com/orca-ng/orca/internal/models/gorm"
+	"github.com/orca-ng/orca/internal/services"
+)
+
+func setupRBACTest(t *testing.T, user *models.User) (*gin.Engine, *database.GormDB) {
+	t.Helper()
+	db, err := gorm.Open(sqlite.Open(":memory:"), &gorm.Config{})
+	require.NoError(t, err)
+	require.NoError(t, db.AutoMigrate(
+		&gormmodels.User{},
+		&gormmodels.Role{},
+		&gormmodels.RoleAssignment{},
+		&gormmodels.CyberArkInstance{},
+		&gormmodels.InstanceCertificateAuthority{},
+		&gormmodels.Operation{},
+	))
+	gormDB := &database.GormDB{DB: db}
+	require.NoError(t, db.Create(&gormmodels.User{ID: user.ID, Username: user.Username, PasswordHash: "x", IsAdmin: user.IsAdmin}).Error)
+
+	logger := logrus.New()
+	instances := handlers.NewCyberArkInstancesHandler(gormDB, logger, "test-encryption-key-32-bytes-long!", nil, nil)
+	operations := handlers.NewOperationsHandler(gormDB, logger, nil)
+	roles := handlers.NewRolesHandler(gormDB, logger)
+
+	gin.SetMode(gin.TestMode)
+	router := gin.New()
+	router.Use(func(c *gin.Context) {
+		c.Set("user", user)
+		c.Next()
+	})
+	router.Use(middleware.LoadPermissions(services.NewAuthorizationService(gormDB)))
+
+	api := router.Group("/api")
+	api.GET("/auth/permissions", roles.MyPermissions)
+	api.GET("/cyberark/instances", middleware.RequirePermissionAnywhere(gormmodels.PermInstancesRead), instances.ListInstances)
+	api.GET("/cyberark/instances/:id", middleware.RequireInstancePermission(gormmodels.PermInstancesRead, "id"), instances.GetInstance)
+	api.GET("/operations", middleware.RequirePermissionAnywhere(gormmodels.PermOperationsRead), operations.ListOperations)
+	api.GET("/operations/:id", middleware.RequirePermissionAnywhere(gormmodels.PermOperationsRead), operations.GetOperation)
+	api.POST("/operations", middleware.RequirePermissionAnywhere(gormmodels.PermOperationsCreate+":*"), operations.CreateOperation)
+
+	rolesGroup := api.Group("/")
+	rolesGroup.Use(middleware.RequirePermission(gormmodels.PermRolesManage))
+	rolesGroup.POST("/roles", roles.CreateRole)
+	rolesGroup.PUT("/roles/:id", roles.UpdateRole)
+	rolesGroup.DELETE("/roles/:id", roles.DeleteRole)
+	rolesGroup.POST("/users/:id/roles", roles.AssignRole)
+	rolesGroup.GET("/users/:id/roles", roles.ListUserRoles)
+
+	return router, gormDB
+}
+
+func doJSON(t *testing.T, router *gin.Engine, method, path string, body interface{}) *httptest.ResponseRecorder {
+	t.Helper()
+	var reader *bytes.Reader
+	if body != nil {
+		data, err := json.Marshal(body)
+		require.NoError(t, err)
+		reader = bytes.NewReader(data)
+	} else {
+		reader = bytes.NewReader(nil)
+	}
+	req := httptest.NewRequest(method, path, reader)
+	req.Header.Set("Content-Type", "application/json")
+	w := httptest.NewRecorder()
+	router.ServeHTTP(w, req)
+	return w
+}
+
+func TestInstanceScopedRoleAssignment(t *testing.T) {
+	user := &models.User{ID: "usr_team", Username: "app-team"}
+	router, db := setupRBACTest(t, user)
+
+	owned := gormmodels.CyberArkInstance{Name: "owned", BaseURL: "https://owned", Username: "u", PasswordEncrypted: "x"}
+	other := gormmodels.CyberArkInstance{Name: "other", BaseURL: "https://other", Username: "u", PasswordEncrypted: "x"}
+	require.NoError(t, db.Create(&owned).Error)
+	require.NoError(t, db.Create(&other).Error)
+
+	otherOp := gormmodels.Operation{Type: "access_grant", Priority: "normal", Status: gormmodels.OpStatusPending, Payload: json.RawMessage(`{}`), CyberArkInstanceID: &other.ID}
+	require.NoError(t, db.Create(&otherOp).Error)
+
+	role := gormmodels.Role{Name: "app-team", Permissions: []string{
+		gormmodels.PermInstancesRead,
+		gormmodels.PermOperationsRead,
+		gormmodels.OperationCreatePermission("access_grant"),
+	}}
+	require.NoError(t, db.Create(&role).Error)
+	require.NoError(t, db.Create(&gormmodels.RoleAssignment{UserID: user.ID, RoleID: role.ID, CyberArkInstanceID: &owned.ID}).Error)
+
+	// Only the owned instance is listed and readable
+	w := doJSON(t, router, http.MethodGet, "/api/cyberark/instances", nil)
+	require.Equal(t, http.StatusOK, w.Code)
+	var list struct {
+		Instances []models.CyberArkInstanceInfo `json:"instances"`
+	}
+	require.NoError(t, json.Unmarshal(w.Body.Bytes(), &list))
+	require.Len(t, list.Instances, 1)
+	assert.Equal(t, owned.ID, list.Instances[0].ID)
+
+	assert.Equal(t, http.StatusOK, doJSON(t, router, http.MethodGet, "/api/cyberark/instances/"+owned.ID, nil).Code)
+	assert.Equal(t, http.StatusForbidden, doJSON(t, router, http.MethodGet, "/api/cyberark/instances/"+other.ID, nil).Code)
+
+	// Operations of other instances are hidden
+	assert.Equal(t, http.StatusForbidden, doJSON(t, router, http.MethodGet, "/api/operations/"+otherOp.ID, nil).Code)
+
+	// Access grants only on the owned instance, and no other operation types
+	create := func(opType, instanceID string) int {
+		return doJSON(t, router, http.MethodPost, "/api/operations", gin.H{
+			"type":                 opType,
+			"priority":             "normal",
+			"payload":              gin.H{},
+			"cyberark_instance_id": instanceID,
+		}).Code
+	}
+	assert.Equal(t, http.StatusCreated, create("access_grant", owned.ID))
+	assert.Equal(t, http.StatusForbidden, create("access_grant", other.ID))
+	assert.Equal(t, http.StatusForbidden, create("safe_delete", owned.ID))
+
+	w = doJSON(t, router, http.MethodGet, "/api/operations", nil)
+	require.Equal(t, http.StatusOK, w.Code)
+	var ops struct {
+		Operations []map[string]interface{} `json:"operations"`
+	}
+	require.NoError(t, json.Unmarshal(w.Body.Bytes(), &ops))
+	require.Len(t, ops.Operations, 1)
+	assert.Equal(t, owned.ID, ops.Operations[0]["cyberark_instance_id"])
+
+	// Role management needs roles:manage
+	assert.Equal(t, http.StatusForbidden, doJSON(t, router, http.MethodPost, "/api/roles", gin.H{"name": "x", "permissions": []string{"*"}}).Code)
+
+	w = doJSON(t, router, http.MethodGet, "/api/auth/permissions", nil)
+	require.Equal(t, http.StatusOK, w.Code)
+	var summary services.PermissionSummary
+	require.NoError(t, json.Unmarshal(w.Body.Bytes(), &summary))
+	assert.Empty(t, summary.Global)
+	assert.Len(t, summary.Instances[owned.ID], 3)
+}
+
+func TestManageRoles(t *testing.T) {
+	admin := &models.User{ID: "usr_admin", Username: "admin", IsAdmin: true}
+	router, db := setupRBACTest(t, admin)
+	require.NoError(t, db.Create(&gormmodels.User{ID: "usr_team", Username: "app-team", PasswordHash: "x"}).Error)
+	instance := gormmodels.CyberArkInstance{Name: "owned", BaseURL: "https://owned", Username: "u", PasswordEncrypted: "x"}
+	require.NoError(t, db.Create(&instance).Error)
+
+	w := doJSON(t, router, http.MethodPost, "/api/roles", gin.H{"name": "bad", "permissions": []string{"vault:write"}})
+	assert.Equal(t, http.StatusBadRequest, w.Code)
+
+	w = doJSON(t, router, http.MethodPost, "/api/roles", gin.H{
+		"name":        "app-team",
+		"permissions": []string{"instances:write", "operations:create:*", "instances:write"},
+	})
+	require.Equal(t, http.StatusCreated, w.Code)
+	var role gormmodels.Role
+	require.NoError(t, json.Unmarshal(w.Body.Bytes(), &role))
+	assert.Equal(t, []string{"instances:write", "operations:create:*"}, role.Permissions)
+
+	w = doJSON(t, router, http.MethodPost, "/api/roles", gin.H{"name": "app-team", "permissions": []string{"*"}})
+	assert.Equal(t, http.StatusConflict, w.Code)
+
+	// Scoped to an instance
+	assign := gin.H{"role_id": role.ID, "cyberark_instance_id": instance.ID}
+	assert.Equal(t, http.StatusCreated, doJSON(t, router, http.MethodPost, "/api/users/usr_team/roles", assign).Code)
+	assert.Equal(t, http.StatusConflict, doJSON(t, router, http.MethodPost, "/api/users/usr_team/roles", assign).Code)
+	assert.Equal(t, http.StatusBadRequest, doJSON(t, router, http.MethodPost, "/api/users/usr_team/roles", gin.H{"role_id": role.ID, "cyberark_instance_id": "cai_missing"}).Code)
+	assert.Equal(t, http.StatusNotFound, doJSON(t, router, http.MethodPost, "/api/users/usr_missing/roles", gin.H{"role_id": role.ID}).Code)
+
+	w = doJSON(t, router, http.MethodGet, "/api/users/usr_team/roles", nil)
+	require.Equal(t, http.StatusOK, w.Code)
+	var assignments struct {
+		Assignments []gormmodels.RoleAssignment `json:"assignments"`
+	}
+	require.NoError(t, json.Unmarshal(w.Body.Bytes(), &assignments))
+	require.Len(t, assignments.Assignments, 1)
+	assert.Equal(t, instance.ID, *assignments.Assignments[0].CyberArkInstanceID)
+
+	// Assigned roles cannot be deleted
+	assert.Equal(t, http.StatusConflict, doJSON(t, router, http.MethodDelete, "/api/roles/"+role.ID, nil).Code)
+}
+
+func TestRequireMFAOnBuiltInRole(t *testing.T) {
+	admin := &models.User{ID: "usr_admin", Username: "admin", IsAdmin: true}
+	router, db := setupRBACTest(t, admin)
+	builtIn := gormmodels.Role{Name: "administrator", Permissions: []string{gormmodels.PermAll}, IsSystem: true}
+	require.NoError(t, db.Create(&builtIn).Error)
+
+	// Only the MFA requirement of built-in roles can be changed
+	w := doJSON(t, router, http.MethodPut, "/api/roles/"+builtIn.ID, gin.H{"require_mfa": true})
+	require.Equal(t, http.StatusOK, w.Code, w.Body.String())
+	assert.Equal(t, http.StatusForbidden, doJSON(t, router, http.MethodPut, "/api/roles/"+builtIn.ID, gin.H{"permissions": []string{"instances:read"}}).Code)
+
+	var stored gormmodels.Role
+	require.NoError(t, db.First(&stored, "id = ?", builtIn.ID).Error)
+	assert.True(t, stored.RequireMFA)
+	assert.Equal(t, []string{gormmodels.PermAll}, stored.Permissions)
+
+	w = doJSON(t, router, http.MethodPost, "/api/roles", gin.H{"name": "privileged", "permissions": []string{"*"}, "require_mfa": true})
+	require.Equal(t, http.StatusCreated, w.Code)
+	require.NoError(t, json.Unmarshal(w.Body.Bytes(), &stored))
+	assert.True(t, stored.RequireMFA)
+}
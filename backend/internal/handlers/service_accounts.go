@@ -0,0 +1,243 @@
+package handlers
+
+import (
+	"errors"
+	"net/http"
+	"strings"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/sirupsen/logrus"
+	"gorm.io/gorm"
+
+	"github.com/orca-ng/orca/internal/database"
+	"github.com/orca-ng/orca/internal/middleware"
+	"github.com/orca-ng/orca/internal/models"
+	gormmodels "github.com/orca-ng/orca/internal/models/gorm"
+	"github.com/orca-ng/orca/pkg/session"
+)
+
+// ServiceAccountsHandler manages service accounts and their API tokens.
+// Service accounts get their permissions from role assignments like other
+// users.
+type ServiceAccountsHandler struct {
+	db     *database.GormDB
+	logger *logrus.Logger
+}
+
+// NewServiceAccountsHandler creates a new service accounts handler
+func NewServiceAccountsHandler(db *database.GormDB, logger *logrus.Logger) *ServiceAccountsHandler {
+	return &ServiceAccountsHandler{
+		db:     db,
+		logger: logger,
+	}
+}
+
+// ListServiceAccounts returns all service accounts
+func (h *ServiceAccountsHandler) ListServiceAccounts(c *gin.Context) {
+	var accounts []gormmodels.User
+	if err := h.db.Where("auth_provider = ?", gormmodels.AuthProviderServiceAccount).
+		Order("username ASC").
+		Find(&accounts).Error; err != nil {
+		h.logger.WithError(err).Error("Failed to get service accounts")
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to retrieve service accounts"})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{
+		"service_accounts": accounts,
+		"count":            len(accounts),
+	})
+}
+
+// CreateServiceAccount creates a service account. It has no password and
+// cannot log in; it authenticates with API tokens.
+func (h *ServiceAccountsHandler) CreateServiceAccount(c *gin.Context) {
+	var req models.CreateServiceAccountRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	account := gormmodels.User{
+		Username:     strings.TrimSpace(req.Username),
+		PasswordHash: "",
+		AuthProvider: gormmodels.AuthProviderServiceAccount,
+		Email:        req.Email,
+		IsActive:     true,
+	}
+	var count int64
+	if err := h.db.Model(&gormmodels.User{}).Where("username = ?", account.Username).Count(&count).Error; err != nil {
+		h.logger.WithError(err).Error("Failed to check username")
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to create service account"})
+		return
+	}
+	if count > 0 {
+		c.JSON(http.StatusConflict, gin.H{"error": "A user with this username already exists"})
+		return
+	}
+
+	if err := h.db.Create(&account).Error; err != nil {
+		h.logger.WithError(err).Error("Failed to create service account")
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to create service account"})
+		return
+	}
+
+	middleware.SetAuditTarget(c, "user:"+account.ID)
+	middleware.SetAuditChanges(c, nil, &account)
+
+	h.logger.WithFields(logrus.Fields{
+		"user_id":    account.ID,
+		"username":   account.Username,
+		"created_by": middleware.GetUser(c).ID,
+	}).Info("Service account created")
+
+	c.JSON(http.StatusCreated, account)
+}
+
+// ListTokens returns the API tokens of a service account, including revoked
+// and expired ones
+func (h *ServiceAccountsHandler) ListTokens(c *gin.Context) {
+	account, ok := h.findServiceAccount(c, c.Param("id"))
+	if !ok {
+		return
+	}
+
+	var tokens []gormmodels.APIToken
+	if err := h.db.Where("user_id = ?", account.ID).Order("created_at DESC").Find(&tokens).Error; err != nil {
+		h.logger.WithError(err).Error("Failed to get API tokens")
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to retrieve API tokens"})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{
+		"tokens": tokens,
+		"count":  len(tokens),
+	})
+}
+
+// CreateToken issues an API token for a service account. The token is in
+// the response only; ORCA keeps a hash.
+func (h *ServiceAccountsHandler) CreateToken(c *gin.Context) {
+	var req models.CreateAPITokenRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+	scopes, err := normalizePermissions(req.Scopes)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	account, ok := h.findServiceAccount(c, c.Param("id"))
+	if !ok {
+		return
+	}
+	if !account.IsActive {
+		c.JSON(http.StatusConflict, gin.H{"error": "Service account is disabled"})
+		return
+	}
+
+	token, display, err := session.GenerateAPIToken()
+	if err != nil {
+		h.logger.WithError(err).Error("Failed to generate API token")
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to create API token"})
+		return
+	}
+	creatorID := middleware.GetUser(c).ID
+	apiToken := gormmodels.APIToken{
+		UserID:    account.ID,
+		Name:      strings.TrimSpace(req.Name),
+		Display:   display,
+		TokenHash: session.HashAPIToken(token),
+		Scopes:    scopes,
+		CreatedBy: &creatorID,
+	}
+	if req.ExpiresInDays > 0 {
+		expiresAt := time.Now().UTC().AddDate(0, 0, req.ExpiresInDays)
+		apiToken.ExpiresAt = &expiresAt
+	}
+
+	if err := h.db.Create(&apiToken).Error; err != nil {
+		h.logger.WithError(err).Error("Failed to create API token")
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to create API token"})
+		return
+	}
+
+	middleware.SetAuditTarget(c, "api_token:"+apiToken.ID)
+	middleware.SetAuditChanges(c, nil, &apiToken)
+	middleware.AddAuditDetail(c, "user_id", account.ID)
+
+	h.logger.WithFields(logrus.Fields{
+		"token_id":   apiToken.ID,
+		"user_id":    account.ID,
+		"scopes":     scopes,
+		"expires_at": apiToken.ExpiresAt,
+		"created_by": creatorID,
+	}).Info("API token created")
+
+	c.JSON(http.StatusCreated, gin.H{
+		"token":     token,
+		"api_token": apiToken,
+	})
+}
+
+// RevokeToken revokes an API token of a service account. Revoked tokens are
+// kept for the record.
+func (h *ServiceAccountsHandler) RevokeToken(c *gin.Context) {
+	account, ok := h.findServiceAccount(c, c.Param("id"))
+	if !ok {
+		return
+	}
+
+	var apiToken gormmodels.APIToken
+	if err := h.db.First(&apiToken, "id = ? AND user_id = ?", c.Param("token_id"), account.ID).Error; err != nil {
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			c.JSON(http.StatusNotFound, gin.H{"error": "API token not found"})
+			return
+		}
+		h.logger.WithError(err).Error("Failed to get API token")
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to revoke API token"})
+		return
+	}
+	if apiToken.RevokedAt != nil {
+		c.JSON(http.StatusOK, apiToken)
+		return
+	}
+
+	now := time.Now().UTC()
+	revokerID := middleware.GetUser(c).ID
+	apiToken.RevokedAt = &now
+	apiToken.RevokedBy = &revokerID
+	if err := h.db.Model(&apiToken).Select("revoked_at", "revoked_by").Updates(&apiToken).Error; err != nil {
+		h.logger.WithError(err).Error("Failed to revoke API token")
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to revoke API token"})
+		return
+	}
+
+	middleware.SetAuditTarget(c, "api_token:"+apiToken.ID)
+	middleware.AddAuditDetail(c, "user_id", account.ID)
+
+	h.logger.WithFields(logrus.Fields{
+		"token_id":   apiToken.ID,
+		"user_id":    account.ID,
+		"revoked_by": revokerID,
+	}).Info("API token revoked")
+
+	c.JSON(http.StatusOK, apiToken)
+}
+
+func (h *ServiceAccountsHandler) findServiceAccount(c *gin.Context, id string) (*gormmodels.User, bool) {
+	var account gormmodels.User
+	if err := h.db.First(&account, "id = ? AND auth_provider = ?", id, gormmodels.AuthProviderServiceAccount).Error; err != nil {
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			c.JSON(http.StatusNotFound, gin.H{"error": "Service account not found"})
+			return nil, false
+		}
+		h.logger.WithError(err).Error("Failed to get service account")
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to retrieve service account"})
+		return nil, false
+	}
+	return &account, true
+}
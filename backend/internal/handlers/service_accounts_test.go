@@ -0,0 +1,171 @@
+package handlers_test
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/sirupsen/logrus"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"gorm.io/driver/sqlite"
+	"gorm.io/gorm"
+
+	"github.com/orca-ng/orca/internal/database"
+	"github.com/orca-ng/orca/internal/handlers"
+	"github.com/orca-ng/orca/internal/middleware"
+	"github.com/orca-ng/orca/internal/models"
+	gormmodels "github.com/orca-ng/orca/internal/models/gorm"
+	"github.com/orca-ng/orca/internal/services"
+)
+
+func setupServiceAccountTest(t *testing.T) (*gin.Engine, *gorm.DB) {
+	t.Helper()
+	db, err := gorm.Open(sqlite.Open(":memory:"), &gorm.Config{})
+	require.NoError(t, err)
+	require.NoError(t, db.AutoMigrate(
+		&gormmodels.User{},
+		&gormmodels.Session{},
+		&gormmodels.APIToken{},
+		&gormmodels.Role{},
+		&gormmodels.RoleAssignment{},
+	))
+	gormDB := &database.GormDB{DB: db}
+	admin := &models.User{ID: "usr_admin", Username: "admin", IsAdmin: true}
+	require.NoError(t, db.Create(&gormmodels.User{ID: admin.ID, Username: admin.Username, PasswordHash: "x", IsActive: true, IsAdmin: true}).Error)
+
+	logger := logrus.New()
+	auth := handlers.NewAuthHandler(gormDB, time.Hour)
+	accounts := handlers.NewServiceAccountsHandler(gormDB, logger)
+	roles := handlers.NewRolesHandler(gormDB, logger)
+	authz := services.NewAuthorizationService(gormDB)
+
+	gin.SetMode(gin.TestMode)
+	router := gin.New()
+	router.POST("/api/auth/login", auth.Login)
+
+	// Management as the admin
+	manage := router.Group("/manage")
+	manage.Use(func(c *gin.Context) {
+		c.Set("user", admin)
+		c.Next()
+	}, middleware.LoadPermissions(authz))
+	manage.POST("/service-accounts", accounts.CreateServiceAccount)
+	manage.GET("/service-accounts/:id/tokens", accounts.ListTokens)
+	manage.POST("/service-accounts/:id/tokens", accounts.CreateToken)
+	manage.DELETE("/service-accounts/:id/tokens/:token_id", accounts.RevokeToken)
+	manage.POST("/users/:id/roles", roles.AssignRole)
+
+	// The API as the token holder
+	api := router.Group("/api")
+	api.Use(middleware.AuthRequired(auth), middleware.LoadPermissions(authz))
+	api.GET("/auth/permissions", roles.MyPermissions)
+	api.GET("/roles", middleware.RequirePermission(gormmodels.PermRolesManage), roles.ListRoles)
+	api.GET("/service-accounts", middleware.RequirePermission(gormmodels.PermServiceAccountsManage), accounts.ListServiceAccounts)
+
+	return router, db
+}
+
+func createAPIToken(t *testing.T, router *gin.Engine, accountID string, scopes []string, expiresInDays int) (string, gormmodels.APIToken) {
+	t.Helper()
+	w := doJSON(t, router, http.MethodPost, "/manage/service-accounts/"+accountID+"/tokens", models.CreateAPITokenRequest{
+		Name:          "pipeline",
+		Scopes:        scopes,
+		ExpiresInDays: expiresInDays,
+	})
+	require.Equal(t, http.StatusCreated, w.Code, w.Body.String())
+	var response struct {
+		Token    string              `json:"token"`
+		APIToken gormmodels.APIToken `json:"api_token"`
+	}
+	require.NoError(t, json.Unmarshal(w.Body.Bytes(), &response))
+	return response.Token, response.APIToken
+}
+
+func withToken(router *gin.Engine, path, token string) *httptest.ResponseRecorder {
+	req := httptest.NewRequest(http.MethodGet, path, nil)
+	req.Header.Set("Authorization", "Bearer "+token)
+	w := httptest.NewRecorder()
+	router.ServeHTTP(w, req)
+	return w
+}
+
+func TestServiceAccountTokens(t *testing.T) {
+	router, db := setupServiceAccountTest(t)
+
+	w := doJSON(t, router, http.MethodPost, "/manage/service-accounts", models.CreateServiceAccountRequest{Username: "ci-bot"})
+	require.Equal(t, http.StatusCreated, w.Code, w.Body.String())
+	var account gormmodels.User
+	require.NoError(t, json.Unmarshal(w.Body.Bytes(), &account))
+	assert.Equal(t, gormmodels.AuthProviderServiceAccount, account.AuthProvider)
+	assert.Equal(t, http.StatusConflict, doJSON(t, router, http.MethodPost, "/manage/service-accounts", models.CreateServiceAccountRequest{Username: "ci-bot"}).Code)
+
+	role := gormmodels.Role{Name: "automation", Permissions: []string{gormmodels.PermRolesManage, gormmodels.PermServiceAccountsManage}}
+	require.NoError(t, db.Create(&role).Error)
+	require.Equal(t, http.StatusCreated, doJSON(t, router, http.MethodPost, "/manage/users/"+account.ID+"/roles", map[string]string{"role_id": role.ID}).Code)
+
+	// Unknown scopes are refused
+	assert.Equal(t, http.StatusBadRequest, doJSON(t, router, http.MethodPost, "/manage/service-accounts/"+account.ID+"/tokens", models.CreateAPITokenRequest{
+		Name: "bad", Scopes: []string{"everything"},
+	}).Code)
+
+	token, apiToken := createAPIToken(t, router, account.ID, []string{gormmodels.PermRolesManage}, 30)
+	assert.Contains(t, token, apiToken.Display)
+	require.NotNil(t, apiToken.ExpiresAt)
+
+	// Only the hash is stored
+	var stored gormmodels.APIToken
+	require.NoError(t, db.First(&stored, "id = ?", apiToken.ID).Error)
+	assert.NotEqual(t, token, stored.TokenHash)
+	assert.NotContains(t, w.Body.String(), stored.TokenHash)
+
+	// The token works within its scopes, not with everything its roles grant
+	assert.Equal(t, http.StatusOK, withToken(router, "/api/roles", token).Code)
+	assert.Equal(t, http.StatusForbidden, withToken(router, "/api/service-accounts", token).Code)
+
+	w = withToken(router, "/api/auth/permissions", token)
+	require.Equal(t, http.StatusOK, w.Code)
+	var summary services.PermissionSummary
+	require.NoError(t, json.Unmarshal(w.Body.Bytes(), &summary))
+	assert.Equal(t, []string{gormmodels.PermRolesManage}, summary.Scopes)
+
+	require.NoError(t, db.First(&stored, "id = ?", apiToken.ID).Error)
+	require.NotNil(t, stored.LastUsedAt)
+	require.NotNil(t, stored.LastUsedIP)
+
+	// A token scoped wider than the roles gets no more than the roles
+	wide, _ := createAPIToken(t, router, account.ID, []string{"*"}, 0)
+	assert.Equal(t, http.StatusOK, withToken(router, "/api/service-accounts", wide).Code)
+	assert.Equal(t, http.StatusUnauthorized, withToken(router, "/api/roles", "orca_unknown").Code)
+
+	// Revoked tokens stop working but stay listed
+	w = doJSON(t, router, http.MethodDelete, "/manage/service-accounts/"+account.ID+"/tokens/"+apiToken.ID, nil)
+	require.Equal(t, http.StatusOK, w.Code)
+	assert.Equal(t, http.StatusUnauthorized, withToken(router, "/api/roles", token).Code)
+	assert.Equal(t, http.StatusNotFound, doJSON(t, router, http.MethodDelete, "/manage/service-accounts/"+account.ID+"/tokens/tok_unknown", nil).Code)
+
+	w = doJSON(t, router, http.MethodGet, "/manage/service-accounts/"+account.ID+"/tokens", nil)
+	require.Equal(t, http.StatusOK, w.Code)
+	var list struct {
+		Tokens []gormmodels.APIToken `json:"tokens"`
+	}
+	require.NoError(t, json.Unmarshal(w.Body.Bytes(), &list))
+	assert.Len(t, list.Tokens, 2)
+
+	// Expired tokens stop working
+	require.NoError(t, db.Model(&gormmodels.APIToken{}).Where("id <> ?", apiToken.ID).Update("expires_at", time.Now().Add(-time.Minute)).Error)
+	assert.Equal(t, http.StatusUnauthorized, withToken(router, "/api/service-accounts", wide).Code)
+
+	// Disabled accounts are locked out
+	fresh, _ := createAPIToken(t, router, account.ID, []string{"*"}, 1)
+	require.NoError(t, db.Model(&gormmodels.User{}).Where("id = ?", account.ID).Update("is_active", false).Error)
+	assert.Equal(t, http.StatusForbidden, withToken(router, "/api/roles", fresh).Code)
+	require.NoError(t, db.First(&account, "id = ?", account.ID).Error)
+	assert.False(t, account.IsActive)
+
+	// Service accounts cannot log in with a password
+	assert.Equal(t, http.StatusUnauthorized, postLogin(router, "/api/auth/login", "ci-bot", "anything").Code)
+}
@@ -48,6 +48,7 @@ func (h *SyncJobsHandler) ListSyncJobs(c *gin.Context) {
 		Preload("CyberArkInstance").
 		Preload("CreatedByUser").
 		Order("created_at DESC")
+	query = scopeToInstances(query, middleware.GetPermissions(c), gormmodels.PermSyncRead, "cyberark_instance_id")
 
 	if instanceID != "" {
 		query = query.Where("cyberark_instance_id = ?", instanceID)
@@ -94,6 +95,11 @@ func (h *SyncJobsHandler) GetSyncJob(c *gin.Context) {
 		return
 	}
 
+	if !middleware.GetPermissions(c).HasOnInstance(gormmodels.PermSyncRead, job.CyberArkInstanceID) {
+		middleware.Forbidden(c, gormmodels.PermSyncRead)
+		return
+	}
+
 	c.JSON(http.StatusOK, job)
 }
 
@@ -111,6 +117,11 @@ func (h *SyncJobsHandler) TriggerSync(c *gin.Context) {
 		return
 	}
 
+	if !middleware.GetPermissions(c).HasOnInstance(gormmodels.PermSyncManage, req.InstanceID) {
+		middleware.Forbidden(c, gormmodels.PermSyncManage)
+		return
+	}
+
 	// Get user from context
 	user := middleware.GetUser(c)
 	if user == nil {
@@ -228,6 +239,9 @@ func (h *SyncJobsHandler) UpdateSyncConfig(c *gin.Context) {
 		updates["timeout_minutes"] = *req.TimeoutMinutes
 	}
 
+	// Kept for the audit log
+	before, _ := h.syncService.GetSyncConfig(instanceID, syncType)
+
 	// Update config
 	if err := h.syncService.UpdateSyncConfig(instanceID, syncType, updates); err != nil {
 		h.logger.WithError(err).Error("Failed to update sync config")
@@ -243,6 +257,10 @@ func (h *SyncJobsHandler) UpdateSyncConfig(c *gin.Context) {
 		return
 	}
 
+	middleware.SetAuditTarget(c, "instance:"+instanceID)
+	middleware.SetAuditChanges(c, before, config)
+	middleware.AddAuditDetail(c, "sync_type", syncType)
+
 	c.JSON(http.StatusOK, config)
 }
 
@@ -256,6 +274,7 @@ func (h *SyncJobsHandler) StreamSyncJobs(c *gin.Context) {
 
 	// Create client ID
 	clientID := ulid.New("sseconn")
+	permissions := middleware.GetPermissions(c)
 	
 	// Subscribe to events
 	ctx, cancel := context.WithCancel(c.Request.Context())
@@ -279,7 +298,7 @@ func (h *SyncJobsHandler) StreamSyncJobs(c *gin.Context) {
 			
 		case event := <-eventChan:
 			// Only send sync job events
-			if event.SyncJob != nil {
+			if event.SyncJob != nil && canSeeEvent(permissions, event) {
 				eventData, err := services.MarshalEventToJSON(event)
 				if err != nil {
 					h.logger.WithError(err).Error("Failed to marshal sync job event")
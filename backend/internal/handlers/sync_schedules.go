@@ -3,6 +3,7 @@ package handlers
 import (
 	"encoding/json"
 	"net/http"
+	"strconv"
 	"time"
 
 	"github.com/gin-gonic/gin"
@@ -74,8 +75,9 @@ func NewSyncSchedulesHandler(db *database.GormDB, logger *logrus.Logger, events
 func (h *SyncSchedulesHandler) GetSchedules(c *gin.Context) {
 	var instances []gormmodels.CyberArkInstance
 	
-	// Get all instances
-	if err := h.db.Find(&instances).Error; err != nil {
+	// Get the instances the user may see
+	query := scopeToInstances(h.db.DB, middleware.GetPermissions(c), gormmodels.PermSyncRead, "id")
+	if err := query.Find(&instances).Error; err != nil {
 		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to fetch instances"})
 		return
 	}
@@ -116,6 +118,11 @@ func (h *SyncSchedulesHandler) UpdateSchedule(c *gin.Context) {
 		return
 	}
 
+	middleware.SetAuditTarget(c, "instance:"+instanceID)
+	if req.Enabled != nil {
+		middleware.AddAuditDetail(c, "enabled", strconv.FormatBool(*req.Enabled))
+	}
+
 	// Update sync settings using sync service
 	if req.Enabled != nil && h.syncService != nil {
 		// Update all sync types
@@ -155,6 +162,13 @@ func (h *SyncSchedulesHandler) UpdateEntitySchedule(c *gin.Context) {
 		return
 	}
 
+	middleware.SetAuditTarget(c, "instance:"+instanceID)
+	middleware.AddAuditDetail(c, "sync_type", entityType)
+	var before *gormmodels.InstanceSyncConfig
+	if h.syncService != nil {
+		before, _ = h.syncService.GetSyncConfig(instanceID, entityType)
+	}
+
 	// Update the sync config
 	if h.syncService != nil {
 		updates := make(map[string]interface{})
@@ -178,6 +192,11 @@ func (h *SyncSchedulesHandler) UpdateEntitySchedule(c *gin.Context) {
 			"page_size": *req.PageSize,
 		})
 	}
+	if before != nil {
+		if after, err := h.syncService.GetSyncConfig(instanceID, entityType); err == nil {
+			middleware.SetAuditChanges(c, before, after)
+		}
+	}
 
 
 	c.JSON(http.StatusOK, gin.H{"message": "Entity schedule updated successfully"})
@@ -218,7 +237,6 @@ func (h *SyncSchedulesHandler) TriggerSync(c *gin.Context) {
 		ScheduledAt:        time.Now(),
 		CyberArkInstanceID: &instanceID,
 		RetryCount:         0,
-		MaxRetries:         3,
 	}
 	
 	// Get user from context
@@ -231,6 +249,10 @@ func (h *SyncSchedulesHandler) TriggerSync(c *gin.Context) {
 		return
 	}
 	
+	middleware.SetAuditTarget(c, "instance:"+instanceID)
+	middleware.AddAuditDetail(c, "sync_type", entityType)
+	middleware.AddAuditDetail(c, "operation_id", operation.ID)
+
 	// Publish creation event
 	if h.events != nil {
 		// Load related data for the event
@@ -247,6 +269,7 @@ func (h *SyncSchedulesHandler) TriggerSync(c *gin.Context) {
 // PauseInstance pauses all sync for an instance
 func (h *SyncSchedulesHandler) PauseInstance(c *gin.Context) {
 	instanceID := c.Param("instanceId")
+	middleware.SetAuditTarget(c, "instance:"+instanceID)
 	
 	// Pause all sync types for this instance
 	if h.syncService != nil {
@@ -266,6 +289,7 @@ func (h *SyncSchedulesHandler) PauseInstance(c *gin.Context) {
 // ResumeInstance resumes all sync for an instance
 func (h *SyncSchedulesHandler) ResumeInstance(c *gin.Context) {
 	instanceID := c.Param("instanceId")
+	middleware.SetAuditTarget(c, "instance:"+instanceID)
 	
 	// Resume all sync types for this instance
 	if h.syncService != nil {
@@ -302,6 +326,7 @@ func (h *SyncSchedulesHandler) PauseAll(c *gin.Context) {
 		}
 	}
 
+	middleware.SetAuditTarget(c, "instance:*")
 	c.JSON(http.StatusOK, gin.H{"message": "All syncs paused"})
 }
 
@@ -325,6 +350,7 @@ func (h *SyncSchedulesHandler) ResumeAll(c *gin.Context) {
 		}
 	}
 
+	middleware.SetAuditTarget(c, "instance:*")
 	c.JSON(http.StatusOK, gin.H{"message": "All syncs resumed"})
 }
 
@@ -0,0 +1,558 @@
+package handlers
+
+import (
+	"errors"
+	"net/http"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/sirupsen/logrus"
+	"gorm.io/gorm"
+
+	"github.com/orca-ng/orca/internal/database"
+	"github.com/orca-ng/orca/internal/middleware"
+	"github.com/orca-ng/orca/internal/models"
+	gormmodels "github.com/orca-ng/orca/internal/models/gorm"
+	"github.com/orca-ng/orca/internal/services"
+	"github.com/orca-ng/orca/pkg/crypto"
+)
+
+// UsersHandler manages ORCA user accounts and their sessions, and lets
+// users see and revoke their own sessions
+type UsersHandler struct {
+	db        *database.GormDB
+	passwords *services.PasswordPolicy
+	logger    *logrus.Logger
+}
+
+// NewUsersHandler creates a new users handler
+func NewUsersHandler(db *database.GormDB, passwords *services.PasswordPolicy, logger *logrus.Logger) *UsersHandler {
+	return &UsersHandler{
+		db:        db,
+		passwords: passwords,
+		logger:    logger,
+	}
+}
+
+// ListUsers returns users, optionally filtered by auth provider, state and
+// a username search
+func (h *UsersHandler) ListUsers(c *gin.Context) {
+	query := h.db.Model(&gormmodels.User{})
+	if provider := c.Query("auth_provider"); provider != "" {
+		query = query.Where("auth_provider = ?", provider)
+	}
+	if active := c.Query("is_active"); active != "" {
+		isActive, err := strconv.ParseBool(active)
+		if err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "is_active must be true or false"})
+			return
+		}
+		query = query.Where("is_active = ?", isActive)
+	}
+	if search := strings.TrimSpace(c.Query("search")); search != "" {
+		query = query.Where("LOWER(username) LIKE ?", "%"+strings.ToLower(search)+"%")
+	}
+
+	var users []gormmodels.User
+	if err := query.Order("username ASC").Find(&users).Error; err != nil {
+		h.logger.WithError(err).Error("Failed to get users")
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to retrieve users"})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{
+		"users": users,
+		"count": len(users),
+	})
+}
+
+// GetUser returns a user
+func (h *UsersHandler) GetUser(c *gin.Context) {
+	user, ok := h.findUser(c, c.Param("id"))
+	if !ok {
+		return
+	}
+	c.JSON(http.StatusOK, user)
+}
+
+// CreateUser creates a local user who logs in with a password
+func (h *UsersHandler) CreateUser(c *gin.Context) {
+	var req models.CreateUserRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	if req.IsAdmin && !callerIsAdmin(c) {
+		c.JSON(http.StatusForbidden, gin.H{"error": "Only admins can create admins"})
+		return
+	}
+
+	username := strings.TrimSpace(req.Username)
+	if taken, err := h.usernameTaken(username, ""); err != nil {
+		h.logger.WithError(err).Error("Failed to check username")
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to create user"})
+		return
+	} else if taken {
+		c.JSON(http.StatusConflict, gin.H{"error": "A user with this username already exists"})
+		return
+	}
+
+	hash, err := h.passwords.Hash(username, req.Password)
+	if err != nil {
+		h.passwordError(c, err, "Failed to create user")
+		return
+	}
+	user := gormmodels.User{
+		Username:     username,
+		PasswordHash: hash,
+		AuthProvider: gormmodels.AuthProviderLocal,
+		Email:        req.Email,
+		IsAdmin:      req.IsAdmin,
+		IsActive:     req.IsActive == nil || *req.IsActive,
+	}
+	// A false IsActive would be replaced by the column default on create
+	if err := h.db.Transaction(func(tx *gorm.DB) error {
+		if err := tx.Create(&user).Error; err != nil {
+			return err
+		}
+		if !user.IsActive {
+			return tx.Model(&gormmodels.User{}).Where("id = ?", user.ID).Update("is_active", false).Error
+		}
+		return nil
+	}); err != nil {
+		h.logger.WithError(err).Error("Failed to create user")
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to create user"})
+		return
+	}
+
+	middleware.SetAuditTarget(c, "user:"+user.ID)
+	middleware.SetAuditChanges(c, nil, &user)
+
+	h.logger.WithFields(logrus.Fields{
+		"user_id":    user.ID,
+		"username":   user.Username,
+		"is_admin":   user.IsAdmin,
+		"created_by": middleware.GetUser(c).ID,
+	}).Info("User created")
+
+	c.JSON(http.StatusCreated, user)
+}
+
+// UpdateUser changes a user's username, email, admin flag or state.
+// Disabling a user ends their sessions.
+func (h *UsersHandler) UpdateUser(c *gin.Context) {
+	var req models.UpdateUserRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	user, ok := h.findUser(c, c.Param("id"))
+	if !ok || !allowManageUser(c, h.db, h.logger, user) {
+		return
+	}
+	currentUser := middleware.GetUser(c)
+	if req.IsAdmin != nil && *req.IsAdmin != user.IsAdmin && !callerIsAdmin(c) {
+		c.JSON(http.StatusForbidden, gin.H{"error": "Only admins can grant or revoke admin rights"})
+		return
+	}
+
+	updates := map[string]interface{}{}
+	if req.Username != nil {
+		username := strings.TrimSpace(*req.Username)
+		if username != user.Username {
+			if user.AuthProvider == gormmodels.AuthProviderOIDC || user.AuthProvider == gormmodels.AuthProviderLDAP {
+				c.JSON(http.StatusBadRequest, gin.H{"error": "The username of this user comes from its identity provider"})
+				return
+			}
+			taken, err := h.usernameTaken(username, user.ID)
+			if err != nil {
+				h.logger.WithError(err).Error("Failed to check username")
+				c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to update user"})
+				return
+			}
+			if taken {
+				c.JSON(http.StatusConflict, gin.H{"error": "A user with this username already exists"})
+				return
+			}
+			updates["username"] = username
+		}
+	}
+	if req.Email != nil && *req.Email != user.Email {
+		updates["email"] = strings.TrimSpace(*req.Email)
+	}
+	demoting := req.IsAdmin != nil && !*req.IsAdmin && user.IsAdmin
+	disabling := req.IsActive != nil && !*req.IsActive && user.IsActive
+	if req.IsAdmin != nil && *req.IsAdmin != user.IsAdmin {
+		updates["is_admin"] = *req.IsAdmin
+	}
+	if req.IsActive != nil && *req.IsActive != user.IsActive {
+		updates["is_active"] = *req.IsActive
+	}
+
+	if (demoting || disabling) && user.ID == currentUser.ID {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "You cannot disable or demote your own account"})
+		return
+	}
+	if demoting || disabling {
+		if !h.allowAdminRemoval(c, user) {
+			return
+		}
+	}
+	if len(updates) == 0 {
+		c.JSON(http.StatusOK, user)
+		return
+	}
+
+	before := *user
+	if err := h.db.Transaction(func(tx *gorm.DB) error {
+		if err := tx.Model(&gormmodels.User{}).Where("id = ?", user.ID).Updates(updates).Error; err != nil {
+			return err
+		}
+		if disabling {
+			return deleteUserSessions(tx, user.ID, "")
+		}
+		return nil
+	}); err != nil {
+		h.logger.WithError(err).Error("Failed to update user")
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to update user"})
+		return
+	}
+	if err := h.db.First(user, "id = ?", user.ID).Error; err != nil {
+		h.logger.WithError(err).Error("Failed to reload user")
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to update user"})
+		return
+	}
+
+	middleware.SetAuditTarget(c, "user:"+user.ID)
+	middleware.SetAuditChanges(c, &before, user)
+	middleware.AddAuditDetail(c, "username", user.Username)
+
+	h.logger.WithFields(logrus.Fields{
+		"user_id":    user.ID,
+		"changes":    sortedKeys(updates),
+		"updated_by": currentUser.ID,
+	}).Info("User updated")
+
+	c.JSON(http.StatusOK, user)
+}
+
+// DeleteUser deletes a user with their sessions, tokens, role assignments
+// and MFA enrolment
+func (h *UsersHandler) DeleteUser(c *gin.Context) {
+	user, ok := h.findUser(c, c.Param("id"))
+	if !ok || !allowManageUser(c, h.db, h.logger, user) {
+		return
+	}
+	currentUser := middleware.GetUser(c)
+	if user.ID == currentUser.ID {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "You cannot delete your own account"})
+		return
+	}
+	if !h.allowAdminRemoval(c, user) {
+		return
+	}
+
+	err := h.db.Transaction(func(tx *gorm.DB) error {
+		for _, model := range []interface{}{
+			&gormmodels.Session{},
+			&gormmodels.APIToken{},
+			&gormmodels.RoleAssignment{},
+			&gormmodels.MFAChallenge{},
+			&gormmodels.MFARecoveryCode{},
+			&gormmodels.PasswordHistory{},
+			&gormmodels.UserMFA{},
+		} {
+			if err := tx.Where("user_id = ?", user.ID).Delete(model).Error; err != nil {
+				return err
+			}
+		}
+		return tx.Delete(&gormmodels.User{}, "id = ?", user.ID).Error
+	})
+	if err != nil {
+		// Most likely operations or instances that were created by the user
+		h.logger.WithError(err).WithField("user_id", user.ID).Warn("Failed to delete user")
+		c.JSON(http.StatusConflict, gin.H{"error": "User cannot be deleted while records refer to it, disable it instead"})
+		return
+	}
+
+	middleware.SetAuditTarget(c, "user:"+user.ID)
+	middleware.SetAuditChanges(c, user, nil)
+
+	h.logger.WithFields(logrus.Fields{
+		"user_id":    user.ID,
+		"username":   user.Username,
+		"deleted_by": currentUser.ID,
+	}).Info("User deleted")
+
+	c.JSON(http.StatusOK, gin.H{"message": "User deleted"})
+}
+
+// ResetPassword sets a new password for a local user and ends their other
+// sessions
+func (h *UsersHandler) ResetPassword(c *gin.Context) {
+	var req models.ResetPasswordRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	user, ok := h.findUser(c, c.Param("id"))
+	if !ok || !allowManageUser(c, h.db, h.logger, user) {
+		return
+	}
+	if user.AuthProvider != gormmodels.AuthProviderLocal {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Only local users have a password in ORCA"})
+		return
+	}
+
+	if err := h.passwords.Check(c.Request.Context(), user, req.Password); err != nil {
+		h.passwordError(c, err, "Failed to reset password")
+		return
+	}
+	hash, err := crypto.HashPassword(req.Password)
+	if err != nil {
+		h.logger.WithError(err).Error("Failed to hash password")
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to reset password"})
+		return
+	}
+	// Keep the session of an admin resetting their own password
+	keep := ""
+	if session := middleware.GetSession(c); session != nil && session.UserID == user.ID {
+		keep = session.ID
+	}
+	if err := h.db.Transaction(func(tx *gorm.DB) error {
+		if err := h.passwords.StoreHash(tx, user, hash); err != nil {
+			return err
+		}
+		return deleteUserSessions(tx, user.ID, keep)
+	}); err != nil {
+		h.logger.WithError(err).Error("Failed to reset password")
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to reset password"})
+		return
+	}
+
+	middleware.SetAuditTarget(c, "user:"+user.ID)
+	middleware.AddAuditDetail(c, "username", user.Username)
+
+	h.logger.WithFields(logrus.Fields{
+		"user_id":  user.ID,
+		"reset_by": middleware.GetUser(c).ID,
+	}).Info("User password reset")
+
+	c.JSON(http.StatusOK, gin.H{"message": "Password reset"})
+}
+
+// ListUserSessions returns the active sessions of a user
+func (h *UsersHandler) ListUserSessions(c *gin.Context) {
+	user, ok := h.findUser(c, c.Param("id"))
+	if !ok {
+		return
+	}
+	h.listSessions(c, user.ID)
+}
+
+// RevokeUserSession ends one session of a user
+func (h *UsersHandler) RevokeUserSession(c *gin.Context) {
+	user, ok := h.findUser(c, c.Param("id"))
+	if !ok {
+		return
+	}
+	h.revokeSession(c, user, c.Param("session_id"))
+}
+
+// RevokeUserSessions ends all sessions of a user
+func (h *UsersHandler) RevokeUserSessions(c *gin.Context) {
+	user, ok := h.findUser(c, c.Param("id"))
+	if !ok {
+		return
+	}
+
+	res := h.db.Where("user_id = ?", user.ID).Delete(&gormmodels.Session{})
+	if res.Error != nil {
+		h.logger.WithError(res.Error).Error("Failed to revoke sessions")
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to revoke sessions"})
+		return
+	}
+
+	middleware.SetAuditTarget(c, "user:"+user.ID)
+	middleware.AddAuditDetail(c, "username", user.Username)
+	middleware.AddAuditDetail(c, "sessions", strconv.FormatInt(res.RowsAffected, 10))
+
+	c.JSON(http.StatusOK, gin.H{
+		"message": "Sessions revoked",
+		"count":   res.RowsAffected,
+	})
+}
+
+// ListMySessions returns the active sessions of the current user
+func (h *UsersHandler) ListMySessions(c *gin.Context) {
+	h.listSessions(c, middleware.GetUser(c).ID)
+}
+
+// RevokeMySession ends a session of the current user, which may be the
+// session of the request
+func (h *UsersHandler) RevokeMySession(c *gin.Context) {
+	currentUser := middleware.GetUser(c)
+	user := &gormmodels.User{ID: currentUser.ID, Username: currentUser.Username}
+	h.revokeSession(c, user, c.Param("id"))
+}
+
+func (h *UsersHandler) listSessions(c *gin.Context, userID string) {
+	var sessions []gormmodels.Session
+	if err := h.db.Where("user_id = ? AND expires_at > ?", userID, time.Now().UTC()).
+		Order("created_at DESC").
+		Find(&sessions).Error; err != nil {
+		h.logger.WithError(err).Error("Failed to get sessions")
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to retrieve sessions"})
+		return
+	}
+
+	current := ""
+	if session := middleware.GetSession(c); session != nil {
+		current = session.ID
+	}
+	infos := make([]models.SessionInfo, len(sessions))
+	for i, session := range sessions {
+		infos[i] = models.SessionInfo{
+			ID:        session.ID,
+			CreatedAt: session.CreatedAt,
+			ExpiresAt: session.ExpiresAt,
+			UserAgent: session.UserAgent,
+			IPAddress: session.IPAddress,
+			Current:   session.ID == current,
+		}
+	}
+
+	c.JSON(http.StatusOK, gin.H{
+		"sessions": infos,
+		"count":    len(infos),
+	})
+}
+
+func (h *UsersHandler) revokeSession(c *gin.Context, user *gormmodels.User, sessionID string) {
+	res := h.db.Where("id = ? AND user_id = ?", sessionID, user.ID).Delete(&gormmodels.Session{})
+	if res.Error != nil {
+		h.logger.WithError(res.Error).Error("Failed to revoke session")
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to revoke session"})
+		return
+	}
+	if res.RowsAffected == 0 {
+		c.JSON(http.StatusNotFound, gin.H{"error": "Session not found"})
+		return
+	}
+
+	middleware.SetAuditTarget(c, "session:"+sessionID)
+	middleware.AddAuditDetail(c, "user_id", user.ID)
+	middleware.AddAuditDetail(c, "username", user.Username)
+
+	c.JSON(http.StatusOK, gin.H{"message": "Session revoked"})
+}
+
+// allowAdminRemoval refuses to disable, demote or delete the last active
+// admin. On refusal it writes the response and returns false.
+func (h *UsersHandler) allowAdminRemoval(c *gin.Context, user *gormmodels.User) bool {
+	if !user.IsAdmin || !user.IsActive {
+		return true
+	}
+	var others int64
+	if err := h.db.Model(&gormmodels.User{}).
+		Where("is_admin = ? AND is_active = ? AND id <> ?", true, true, user.ID).
+		Count(&others).Error; err != nil {
+		h.logger.WithError(err).Error("Failed to count admins")
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to update user"})
+		return false
+	}
+	if others == 0 {
+		c.JSON(http.StatusConflict, gin.H{"error": "At least one active admin must remain"})
+		return false
+	}
+	return true
+}
+
+// callerIsAdmin reports whether the request is made by an admin holding
+// every permission, and not with an API token limited to some scopes
+func callerIsAdmin(c *gin.Context) bool {
+	return middleware.GetUser(c).IsAdmin && middleware.GetPermissions(c).Has(gormmodels.PermAll)
+}
+
+// allowManageUser refuses changes to an admin by anyone but an admin, and
+// to a user holding permissions the caller lacks, so that users:manage
+// cannot be used to take over a more privileged account. On refusal it
+// writes the response and returns false.
+func allowManageUser(c *gin.Context, db *database.GormDB, logger *logrus.Logger, user *gormmodels.User) bool {
+	if callerIsAdmin(c) {
+		return true
+	}
+	if user.IsAdmin {
+		c.JSON(http.StatusForbidden, gin.H{"error": "Only admins can manage admins"})
+		return false
+	}
+	permissions, err := services.NewAuthorizationService(db).UserPermissions(c.Request.Context(), &models.User{ID: user.ID})
+	if err != nil {
+		logger.WithError(err).Error("Failed to load user permissions")
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to load user permissions"})
+		return false
+	}
+	if !middleware.GetPermissions(c).Covers(permissions) {
+		c.JSON(http.StatusForbidden, gin.H{"error": "This user holds permissions you do not have"})
+		return false
+	}
+	return true
+}
+
+func (h *UsersHandler) usernameTaken(username, exceptID string) (bool, error) {
+	var count int64
+	err := h.db.Model(&gormmodels.User{}).
+		Where("username = ? AND id <> ?", username, exceptID).
+		Count(&count).Error
+	return count > 0, err
+}
+
+func (h *UsersHandler) findUser(c *gin.Context, id string) (*gormmodels.User, bool) {
+	var user gormmodels.User
+	if err := h.db.First(&user, "id = ?", id).Error; err != nil {
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			c.JSON(http.StatusNotFound, gin.H{"error": "User not found"})
+			return nil, false
+		}
+		h.logger.WithError(err).Error("Failed to get user")
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to retrieve user"})
+		return nil, false
+	}
+	return &user, true
+}
+
+// passwordError answers a password the policy refused with a 400, and any
+// other failure with a 500
+func (h *UsersHandler) passwordError(c *gin.Context, err error, message string) {
+	var policyErr *services.PasswordPolicyError
+	if errors.As(err, &policyErr) {
+		c.JSON(http.StatusBadRequest, gin.H{"error": policyErr.Reason})
+		return
+	}
+	h.logger.WithError(err).Error(message)
+	c.JSON(http.StatusInternalServerError, gin.H{"error": message})
+}
+
+// deleteUserSessions ends the sessions and unfinished MFA logins of a user,
+// except the session keep
+func deleteUserSessions(tx *gorm.DB, userID, keep string) error {
+	if err := tx.Where("user_id = ?", userID).Delete(&gormmodels.MFAChallenge{}).Error; err != nil {
+		return err
+	}
+	return tx.Where("user_id = ? AND id <> ?", userID, keep).Delete(&gormmodels.Session{}).Error
+}
+
+func sortedKeys(m map[string]interface{}) []string {
+	keys := make([]string, 0, len(m))
+	for key := range m {
+		keys = append(keys, key)
+	}
+	sort.Strings(keys)
+	return keys
+}
@@ -0,0 +1,294 @@
+package handlers_test
+
+import (
+	"encoding/json"
+	"net/http"
+	"testing"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/sirupsen/logrus"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"gorm.io/driver/sqlite"
+	"gorm.io/gorm"
+
+	"github.com/orca-ng/orca/internal/config"
+	"github.com/orca-ng/orca/internal/crypto"
+	"github.com/orca-ng/orca/internal/database"
+	"github.com/orca-ng/orca/internal/handlers"
+	"github.com/orca-ng/orca/internal/middleware"
+	gormmodels "github.com/orca-ng/orca/internal/models/gorm"
+	"github.com/orca-ng/orca/internal/services"
+	pkgcrypto "github.com/orca-ng/orca/pkg/crypto"
+)
+
+func setupUsersTest(t *testing.T) (*gin.Engine, *gorm.DB) {
+	t.Helper()
+	db, err := gorm.Open(sqlite.Open(":memory:"), &gorm.Config{})
+	require.NoError(t, err)
+	require.NoError(t, db.AutoMigrate(
+		&gormmodels.User{},
+		&gormmodels.Session{},
+		&gormmodels.APIToken{},
+		&gormmodels.UserMFA{},
+		&gormmodels.MFARecoveryCode{},
+		&gormmodels.MFAChallenge{},
+		&gormmodels.AuditEvent{},
+		&gormmodels.AuditChainHead{},
+		&gormmodels.PasswordHistory{},
+		&gormmodels.Role{},
+		&gormmodels.RoleAssignment{},
+	))
+	gormDB := &database.GormDB{DB: db}
+	hash, err := pkgcrypto.HashPassword("secret")
+	require.NoError(t, err)
+	for _, user := range []gormmodels.User{
+		{ID: "usr_alice", Username: "alice", PasswordHash: hash, IsActive: true},
+		{ID: "usr_admin", Username: "admin", PasswordHash: hash, IsActive: true, IsAdmin: true},
+	} {
+		require.NoError(t, db.Create(&user).Error)
+	}
+
+	logger := logrus.New()
+	audit := services.NewAuditService(gormDB, logger)
+	auth := handlers.NewAuthHandler(gormDB, time.Hour)
+	passwords, err := services.NewPasswordPolicy(gormDB, config.PasswordPolicyConfig{MinLength: 12, MinClasses: 3, HistorySize: 3}, logger)
+	require.NoError(t, err)
+	users := handlers.NewUsersHandler(gormDB, passwords, logger)
+	mfa := handlers.NewMFAHandler(gormDB, services.NewMFAService(gormDB, crypto.NewEncryptor("test-key"), config.MFAConfig{}, logger), logger)
+
+	gin.SetMode(gin.TestMode)
+	router := gin.New()
+	router.POST("/api/auth/login/cli", auth.LoginCLI)
+
+	api := router.Group("/api")
+	api.Use(middleware.AuthRequired(auth), middleware.LoadPermissions(services.NewAuthorizationService(gormDB)))
+	api.GET("/auth/sessions", users.ListMySessions)
+	api.DELETE("/auth/sessions/:id", middleware.Audit(audit, gormmodels.AuditSessionRevoked), users.RevokeMySession)
+	group := api.Group("/users")
+	group.Use(middleware.RequirePermission(gormmodels.PermUsersManage))
+	group.GET("", users.ListUsers)
+	group.POST("", middleware.Audit(audit, gormmodels.AuditUserCreated), users.CreateUser)
+	group.GET("/:id", users.GetUser)
+	group.PUT("/:id", middleware.Audit(audit, gormmodels.AuditUserUpdated), users.UpdateUser)
+	group.DELETE("/:id", middleware.Audit(audit, gormmodels.AuditUserDeleted), users.DeleteUser)
+	group.POST("/:id/password", middleware.Audit(audit, gormmodels.AuditUserPasswordReset), users.ResetPassword)
+	group.GET("/:id/sessions", users.ListUserSessions)
+	group.DELETE("/:id/sessions", middleware.Audit(audit, gormmodels.AuditSessionRevoked), users.RevokeUserSessions)
+	group.DELETE("/:id/sessions/:session_id", middleware.Audit(audit, gormmodels.AuditSessionRevoked), users.RevokeUserSession)
+	group.DELETE("/:id/mfa", middleware.Audit(audit, gormmodels.AuditMFAReset), mfa.ResetUserMFA)
+
+	return router, db
+}
+
+func cliToken(t *testing.T, router *gin.Engine, username, password string) string {
+	t.Helper()
+	return decodeLogin(t, postLogin(router, "/api/auth/login/cli", username, password)).Token
+}
+
+func TestUserLifecycle(t *testing.T) {
+	router, db := setupUsersTest(t)
+	admin := cliToken(t, router, "admin", "secret")
+
+	w := authJSON(t, router, http.MethodPost, "/api/users", admin, map[string]interface{}{"username": "bob", "password": "short"})
+	assert.Equal(t, http.StatusBadRequest, w.Code)
+	w = authJSON(t, router, http.MethodPost, "/api/users", admin, map[string]interface{}{"username": "alice", "password": "long enough"})
+	assert.Equal(t, http.StatusConflict, w.Code)
+	w = authJSON(t, router, http.MethodPost, "/api/users", admin, map[string]interface{}{"username": "bob", "password": "only lowercase letters"})
+	assert.Equal(t, http.StatusBadRequest, w.Code)
+	assert.Contains(t, w.Body.String(), "at least 3 of")
+
+	w = authJSON(t, router, http.MethodPost, "/api/users", admin, map[string]interface{}{
+		"username": "bob",
+		"password": "Correct-Horse-42",
+		"email":    "bob@example.com",
+	})
+	require.Equal(t, http.StatusCreated, w.Code, w.Body.String())
+	var bob gormmodels.User
+	require.NoError(t, json.Unmarshal(w.Body.Bytes(), &bob))
+	assert.True(t, bob.IsActive)
+	assert.NotContains(t, w.Body.String(), "password")
+
+	w = authJSON(t, router, http.MethodGet, "/api/users?search=BO", admin, nil)
+	require.Equal(t, http.StatusOK, w.Code)
+	var list struct {
+		Users []gormmodels.User `json:"users"`
+	}
+	require.NoError(t, json.Unmarshal(w.Body.Bytes(), &list))
+	require.Len(t, list.Users, 1)
+	assert.Equal(t, "bob", list.Users[0].Username)
+
+	// A password reset ends the user's sessions
+	bobToken := cliToken(t, router, "bob", "Correct-Horse-42")
+	w = authJSON(t, router, http.MethodGet, "/api/users/"+bob.ID+"/sessions", admin, nil)
+	require.Equal(t, http.StatusOK, w.Code)
+	assert.Contains(t, w.Body.String(), `"count":1`)
+	assert.NotContains(t, w.Body.String(), bobToken)
+
+	w = authJSON(t, router, http.MethodPost, "/api/users/"+bob.ID+"/password", admin, map[string]string{"password": "Battery-Staple-7"})
+	require.Equal(t, http.StatusOK, w.Code, w.Body.String())
+	assert.Equal(t, http.StatusUnauthorized, authJSON(t, router, http.MethodGet, "/api/auth/sessions", bobToken, nil).Code)
+	assert.Equal(t, http.StatusUnauthorized, postLogin(router, "/api/auth/login/cli", "bob", "Correct-Horse-42").Code)
+	bobToken = cliToken(t, router, "bob", "Battery-Staple-7")
+
+	// Recent passwords cannot be reused
+	for _, password := range []string{"Battery-Staple-7", "Correct-Horse-42"} {
+		w = authJSON(t, router, http.MethodPost, "/api/users/"+bob.ID+"/password", admin, map[string]string{"password": password})
+		assert.Equal(t, http.StatusBadRequest, w.Code, password)
+		assert.Contains(t, w.Body.String(), "must differ from the last 3 passwords")
+	}
+
+	// So does disabling
+	w = authJSON(t, router, http.MethodPut, "/api/users/"+bob.ID, admin, map[string]interface{}{"is_active": false, "email": "robert@example.com"})
+	require.Equal(t, http.StatusOK, w.Code, w.Body.String())
+	assert.Contains(t, w.Body.String(), "robert@example.com")
+	assert.Equal(t, http.StatusUnauthorized, authJSON(t, router, http.MethodGet, "/api/auth/sessions", bobToken, nil).Code)
+	assert.Equal(t, http.StatusForbidden, postLogin(router, "/api/auth/login/cli", "bob", "Battery-Staple-7").Code)
+
+	w = authJSON(t, router, http.MethodDelete, "/api/users/"+bob.ID, admin, nil)
+	require.Equal(t, http.StatusOK, w.Code, w.Body.String())
+	assert.Equal(t, http.StatusNotFound, authJSON(t, router, http.MethodGet, "/api/users/"+bob.ID, admin, nil).Code)
+
+	var events []gormmodels.AuditEvent
+	require.NoError(t, db.Where("action LIKE ?", "user.%").Order("sequence").Find(&events).Error)
+	actions := make([]string, len(events))
+	for i, event := range events {
+		actions[i] = event.Action
+		assert.Equal(t, "user:"+bob.ID, event.Target, event.Action)
+	}
+	assert.Equal(t, []string{
+		gormmodels.AuditUserCreated,
+		gormmodels.AuditUserPasswordReset,
+		gormmodels.AuditUserUpdated,
+		gormmodels.AuditUserDeleted,
+	}, actions)
+	assert.Equal(t, gormmodels.AuditChange{After: "bob"}, events[0].Changes["username"])
+	assert.Equal(t, map[string]gormmodels.AuditChange{
+		"email":     {Before: "bob@example.com", After: "robert@example.com"},
+		"is_active": {Before: "true", After: "false"},
+	}, events[2].Changes)
+	for _, event := range events {
+		assert.NotContains(t, event.Changes, "password_hash")
+	}
+}
+
+func TestUserManagementGuards(t *testing.T) {
+	router, db := setupUsersTest(t)
+	admin := cliToken(t, router, "admin", "secret")
+	alice := cliToken(t, router, "alice", "secret")
+
+	assert.Equal(t, http.StatusForbidden, authJSON(t, router, http.MethodGet, "/api/users", alice, nil).Code)
+
+	w := authJSON(t, router, http.MethodPut, "/api/users/usr_admin", admin, map[string]interface{}{"is_active": false})
+	assert.Equal(t, http.StatusBadRequest, w.Code)
+	w = authJSON(t, router, http.MethodDelete, "/api/users/usr_admin", admin, nil)
+	assert.Equal(t, http.StatusBadRequest, w.Code)
+
+	// A user manager who is no admin cannot remove an admin
+	role := gormmodels.Role{Name: "user-managers", Permissions: []string{gormmodels.PermUsersManage}}
+	require.NoError(t, db.Create(&role).Error)
+	require.NoError(t, db.Create(&gormmodels.RoleAssignment{UserID: "usr_alice", RoleID: role.ID}).Error)
+	w = authJSON(t, router, http.MethodPut, "/api/users/usr_admin", alice, map[string]interface{}{"is_admin": false})
+	assert.Equal(t, http.StatusForbidden, w.Code, w.Body.String())
+	w = authJSON(t, router, http.MethodDelete, "/api/users/usr_admin", alice, nil)
+	assert.Equal(t, http.StatusForbidden, w.Code, w.Body.String())
+
+	// Service accounts have no password
+	service := gormmodels.User{Username: "ci", AuthProvider: gormmodels.AuthProviderServiceAccount, IsActive: true}
+	require.NoError(t, db.Create(&service).Error)
+	w = authJSON(t, router, http.MethodPost, "/api/users/"+service.ID+"/password", admin, map[string]string{"password": "Battery-Staple-7"})
+	assert.Equal(t, http.StatusBadRequest, w.Code)
+}
+
+func TestUserManagerCannotEscalate(t *testing.T) {
+	router, db := setupUsersTest(t)
+	admin := cliToken(t, router, "admin", "secret")
+
+	managers := gormmodels.Role{Name: "user-managers", Permissions: []string{gormmodels.PermUsersManage}}
+	auditors := gormmodels.Role{Name: "auditors", Permissions: []string{gormmodels.PermUsersManage, gormmodels.PermAuditRead}}
+	require.NoError(t, db.Create(&managers).Error)
+	require.NoError(t, db.Create(&auditors).Error)
+	require.NoError(t, db.Create(&gormmodels.RoleAssignment{UserID: "usr_alice", RoleID: managers.ID}).Error)
+	alice := cliToken(t, router, "alice", "secret")
+
+	// No admins are made
+	w := authJSON(t, router, http.MethodPost, "/api/users", alice, map[string]interface{}{
+		"username": "mallory",
+		"password": "Battery-Staple-7",
+		"is_admin": true,
+	})
+	assert.Equal(t, http.StatusForbidden, w.Code, w.Body.String())
+	w = authJSON(t, router, http.MethodPost, "/api/users", alice, map[string]interface{}{
+		"username": "bob",
+		"password": "Battery-Staple-7",
+	})
+	require.Equal(t, http.StatusCreated, w.Code, w.Body.String())
+	var bob gormmodels.User
+	require.NoError(t, json.Unmarshal(w.Body.Bytes(), &bob))
+	w = authJSON(t, router, http.MethodPut, "/api/users/"+bob.ID, alice, map[string]interface{}{"is_admin": true})
+	assert.Equal(t, http.StatusForbidden, w.Code, w.Body.String())
+
+	// Admin accounts cannot be taken over
+	w = authJSON(t, router, http.MethodPost, "/api/users/usr_admin/password", alice, map[string]string{"password": "Battery-Staple-7"})
+	assert.Equal(t, http.StatusForbidden, w.Code, w.Body.String())
+	w = authJSON(t, router, http.MethodDelete, "/api/users/usr_admin/mfa", alice, nil)
+	assert.Equal(t, http.StatusForbidden, w.Code, w.Body.String())
+	w = authJSON(t, router, http.MethodPut, "/api/users/usr_admin", alice, map[string]interface{}{"email": "alice@example.com"})
+	assert.Equal(t, http.StatusForbidden, w.Code, w.Body.String())
+
+	// Nor accounts holding permissions the manager lacks
+	require.NoError(t, db.Create(&gormmodels.RoleAssignment{UserID: bob.ID, RoleID: auditors.ID}).Error)
+	w = authJSON(t, router, http.MethodPost, "/api/users/"+bob.ID+"/password", alice, map[string]string{"password": "Correct-Horse-8"})
+	assert.Equal(t, http.StatusForbidden, w.Code, w.Body.String())
+	w = authJSON(t, router, http.MethodDelete, "/api/users/"+bob.ID+"/mfa", alice, nil)
+	assert.Equal(t, http.StatusForbidden, w.Code, w.Body.String())
+
+	// Accounts with the same permissions or fewer can be managed
+	require.NoError(t, db.Where("user_id = ?", bob.ID).Delete(&gormmodels.RoleAssignment{}).Error)
+	w = authJSON(t, router, http.MethodPost, "/api/users/"+bob.ID+"/password", alice, map[string]string{"password": "Correct-Horse-8"})
+	assert.Equal(t, http.StatusOK, w.Code, w.Body.String())
+	w = authJSON(t, router, http.MethodDelete, "/api/users/"+bob.ID+"/mfa", alice, nil)
+	assert.Equal(t, http.StatusOK, w.Code, w.Body.String())
+
+	// Admins are not limited
+	w = authJSON(t, router, http.MethodPut, "/api/users/"+bob.ID, admin, map[string]interface{}{"is_admin": true})
+	assert.Equal(t, http.StatusOK, w.Code, w.Body.String())
+}
+
+func TestOwnSessions(t *testing.T) {
+	router, _ := setupUsersTest(t)
+	first := cliToken(t, router, "alice", "secret")
+	second := cliToken(t, router, "alice", "secret")
+	cliToken(t, router, "admin", "secret")
+
+	w := authJSON(t, router, http.MethodGet, "/api/auth/sessions", first, nil)
+	require.Equal(t, http.StatusOK, w.Code)
+	var response struct {
+		Sessions []struct {
+			ID      string `json:"id"`
+			Current bool   `json:"current"`
+		} `json:"sessions"`
+	}
+	require.NoError(t, json.Unmarshal(w.Body.Bytes(), &response))
+	require.Len(t, response.Sessions, 2)
+	var current, other string
+	for _, session := range response.Sessions {
+		if session.Current {
+			current = session.ID
+		} else {
+			other = session.ID
+		}
+	}
+	require.NotEmpty(t, current)
+	require.NotEmpty(t, other)
+
+	// Another user's session is not found
+	w = authJSON(t, router, http.MethodGet, "/api/auth/sessions", cliToken(t, router, "admin", "secret"), nil)
+	require.NoError(t, json.Unmarshal(w.Body.Bytes(), &response))
+	assert.Equal(t, http.StatusNotFound, authJSON(t, router, http.MethodDelete, "/api/auth/sessions/"+response.Sessions[0].ID, first, nil).Code)
+
+	require.Equal(t, http.StatusOK, authJSON(t, router, http.MethodDelete, "/api/auth/sessions/"+other, first, nil).Code)
+	assert.Equal(t, http.StatusUnauthorized, authJSON(t, router, http.MethodGet, "/api/auth/sessions", second, nil).Code)
+	assert.Equal(t, http.StatusOK, authJSON(t, router, http.MethodGet, "/api/auth/sessions", first, nil).Code)
+}
@@ -0,0 +1,202 @@
+package middleware
+
+import (
+	"bytes"
+	"context"
+	"crypto/rand"
+	"encoding/hex"
+	"net/http"
+	"sort"
+	"strings"
+
+	"github.com/gin-gonic/gin"
+	gormmodels "github.com/orca-ng/orca/internal/models/gorm"
+	"github.com/orca-ng/orca/internal/services"
+	"github.com/sirupsen/logrus"
+)
+
+// RequestIDHeader carries the ID of a request, from a proxy in front of ORCA
+// or made up by ORCA, back to the client
+const RequestIDHeader = "X-Request-ID"
+
+// RequestID gives every request an ID for logs and audit events. An ID from
+// the client is kept when it is short and plain.
+func RequestID() gin.HandlerFunc {
+	return func(c *gin.Context) {
+		id := c.GetHeader(RequestIDHeader)
+		if !validRequestID(id) {
+			id = newRequestID()
+		}
+		c.Set("request_id", id)
+		c.Header(RequestIDHeader, id)
+		c.Next()
+	}
+}
+
+func validRequestID(id string) bool {
+	if id == "" || len(id) > 64 {
+		return false
+	}
+	for _, r := range id {
+		if !(r >= 'a' && r <= 'z' || r >= 'A' && r <= 'Z' || r >= '0' && r <= '9' || r == '-' || r == '_' || r == '.') {
+			return false
+		}
+	}
+	return true
+}
+
+func newRequestID() string {
+	b := make([]byte, 16)
+	if _, err := rand.Read(b); err != nil {
+		return ""
+	}
+	return hex.EncodeToString(b)
+}
+
+// GetRequestID retrieves the ID RequestID gave the request
+func GetRequestID(c *gin.Context) string {
+	return c.GetString("request_id")
+}
+
+// Audit records an audit event of the action once the handler succeeded.
+// Handlers describe what they changed with SetAuditTarget, SetAuditChanges
+// and AddAuditDetail; without a target, the route parameters are used. The
+// response is held back until the event is recorded, and replaced by an error
+// when it cannot be, so no change is reported done without being audited.
+func Audit(audit *services.AuditService, action string) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		if audit == nil {
+			c.Next()
+			return
+		}
+
+		writer := &auditWriter{ResponseWriter: c.Writer, status: http.StatusOK, size: -1}
+		c.Writer = writer
+		c.Next()
+		c.Writer = writer.ResponseWriter
+		if writer.status >= http.StatusBadRequest {
+			writer.flush()
+			return
+		}
+
+		event := NewAuditEvent(c, action)
+		event.Target = c.GetString("audit_target")
+		if event.Target == "" {
+			event.Target = paramsTarget(c.Params)
+		}
+		if value, exists := c.Get("audit_changes"); exists {
+			event.Changes, _ = value.(map[string]gormmodels.AuditChange)
+		}
+		if value, exists := c.Get("audit_details"); exists {
+			event.Details, _ = value.(map[string]string)
+		}
+		// The event is kept even when the client went away meanwhile
+		if err := audit.Record(context.WithoutCancel(c.Request.Context()), event); err != nil {
+			logrus.WithError(err).WithField("request_id", event.RequestID).Error("Failed to record audit event")
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to record audit event"})
+			return
+		}
+		writer.flush()
+	}
+}
+
+// auditWriter holds back the response of an audited request
+type auditWriter struct {
+	gin.ResponseWriter
+	status int
+	size   int // -1 until the response is written
+	body   bytes.Buffer
+}
+
+func (w *auditWriter) WriteHeader(code int) {
+	if code > 0 && w.size < 0 {
+		w.status = code
+	}
+}
+
+func (w *auditWriter) WriteHeaderNow() {
+	if w.size < 0 {
+		w.size = 0
+	}
+}
+
+func (w *auditWriter) Write(data []byte) (int, error) {
+	w.WriteHeaderNow()
+	n, err := w.body.Write(data)
+	w.size += n
+	return n, err
+}
+
+func (w *auditWriter) WriteString(s string) (int, error) {
+	return w.Write([]byte(s))
+}
+
+func (w *auditWriter) Status() int {
+	return w.status
+}
+
+func (w *auditWriter) Size() int {
+	return w.size
+}
+
+func (w *auditWriter) Written() bool {
+	return w.size >= 0
+}
+
+// Flush does nothing, the response is sent once the event is recorded
+func (w *auditWriter) Flush() {}
+
+// flush sends the response held back
+func (w *auditWriter) flush() {
+	w.ResponseWriter.WriteHeader(w.status)
+	w.ResponseWriter.WriteHeaderNow()
+	if w.body.Len() > 0 {
+		w.ResponseWriter.Write(w.body.Bytes())
+	}
+}
+
+// NewAuditEvent starts an audit event of a request, acted by the logged in
+// user if there is one
+func NewAuditEvent(c *gin.Context, action string) *gormmodels.AuditEvent {
+	event := &gormmodels.AuditEvent{
+		Action:    action,
+		ClientIP:  c.ClientIP(),
+		UserAgent: c.Request.UserAgent(),
+		RequestID: GetRequestID(c),
+	}
+	if user := GetUser(c); user != nil {
+		event.ActorID = &user.ID
+		event.ActorName = user.Username
+	}
+	return event
+}
+
+func paramsTarget(params gin.Params) string {
+	parts := make([]string, 0, len(params))
+	for _, param := range params {
+		parts = append(parts, param.Key+":"+param.Value)
+	}
+	sort.Strings(parts)
+	return strings.Join(parts, ",")
+}
+
+// SetAuditTarget names what the audited action applied to, e.g. "instance:<id>"
+func SetAuditTarget(c *gin.Context, target string) {
+	c.Set("audit_target", target)
+}
+
+// SetAuditChanges records the fields the audited action changed, comparing
+// the JSON of the object before and after. Either may be nil.
+func SetAuditChanges(c *gin.Context, before, after interface{}) {
+	c.Set("audit_changes", services.AuditChanges(before, after))
+}
+
+// AddAuditDetail adds a detail to the audit event of the request
+func AddAuditDetail(c *gin.Context, key, value string) {
+	details, _ := c.Value("audit_details").(map[string]string)
+	if details == nil {
+		details = make(map[string]string)
+		c.Set("audit_details", details)
+	}
+	details[key] = value
+}
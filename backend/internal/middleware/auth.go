@@ -7,7 +7,9 @@ import (
 
 	"github.com/gin-gonic/gin"
 	"github.com/orca-ng/orca/internal/models"
+	gormmodels "github.com/orca-ng/orca/internal/models/gorm"
 	"github.com/orca-ng/orca/internal/services"
+	pkgsession "github.com/orca-ng/orca/pkg/session"
 	"github.com/sirupsen/logrus"
 )
 
@@ -44,6 +46,26 @@ func AuthRequired(sessionService services.SessionService) gin.HandlerFunc {
 			}
 		}
 		
+		// API tokens of service accounts come as bearer tokens
+		if pkgsession.IsAPIToken(token) {
+			apiToken, user, err := sessionService.GetAPIToken(c.Request.Context(), token, c.ClientIP())
+			if err != nil {
+				logrus.WithError(err).Debug("Invalid API token")
+				c.JSON(http.StatusUnauthorized, gin.H{"error": "invalid, expired or revoked API token"})
+				c.Abort()
+				return
+			}
+			if !user.IsActive {
+				c.JSON(http.StatusForbidden, gin.H{"error": "account is disabled"})
+				c.Abort()
+				return
+			}
+			c.Set("user", userModel(user))
+			c.Set("api_token", apiToken)
+			c.Next()
+			return
+		}
+		
 		// Log token for debugging
 		logrus.WithFields(logrus.Fields{
 			"token": token,
@@ -68,18 +90,6 @@ func AuthRequired(sessionService services.SessionService) gin.HandlerFunc {
 			return
 		}
 		
-		// Convert GORM models to old models for compatibility
-		userModel := &models.User{
-			ID:          user.ID,
-			Username:    user.Username,
-			PasswordHash: user.PasswordHash,
-			CreatedAt:   user.CreatedAt,
-			UpdatedAt:   user.UpdatedAt,
-			LastLoginAt: user.LastLoginAt,
-			IsActive:    user.IsActive,
-			IsAdmin:     user.IsAdmin,
-		}
-		
 		sessionModel := &models.Session{
 			ID:        session.ID,
 			UserID:    session.UserID,
@@ -91,13 +101,29 @@ func AuthRequired(sessionService services.SessionService) gin.HandlerFunc {
 			IPAddress: session.IPAddress,
 		}
 		
-		// Store user and session in context
-		c.Set("user", userModel)
+		// Store user and session in context, converted to the old models for
+		// compatibility
+		c.Set("user", userModel(user))
 		c.Set("session", sessionModel)
 		c.Next()
 	}
 }
 
+// userModel converts a GORM user to the API model
+func userModel(user *gormmodels.User) *models.User {
+	return &models.User{
+		ID:           user.ID,
+		Username:     user.Username,
+		PasswordHash: user.PasswordHash,
+		CreatedAt:    user.CreatedAt,
+		UpdatedAt:    user.UpdatedAt,
+		LastLoginAt:  user.LastLoginAt,
+		IsActive:     user.IsActive,
+		IsAdmin:      user.IsAdmin,
+		AuthProvider: user.AuthProvider,
+	}
+}
+
 func AdminRequiredGorm() gin.HandlerFunc {
 	return func(c *gin.Context) {
 		userInterface, exists := c.Get("user")
@@ -131,4 +157,25 @@ func GetUser(c *gin.Context) *models.User {
 	}
 	
 	return user
-}
\ No newline at end of file
+}
+
+// GetAPIToken retrieves the API token the request was authenticated with,
+// or nil for a session
+func GetAPIToken(c *gin.Context) *gormmodels.APIToken {
+	value, exists := c.Get("api_token")
+	if !exists {
+		return nil
+	}
+	apiToken, _ := value.(*gormmodels.APIToken)
+	return apiToken
+}
+// GetSession retrieves the session the request was authenticated with, or
+// nil for an API token
+func GetSession(c *gin.Context) *models.Session {
+	value, exists := c.Get("session")
+	if !exists {
+		return nil
+	}
+	session, _ := value.(*models.Session)
+	return session
+}
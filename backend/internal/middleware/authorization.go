@@ -0,0 +1,99 @@
+package middleware
+
+import (
+	"net/http"
+
+	"github.com/gin-gonic/gin"
+	"github.com/orca-ng/orca/internal/services"
+	"github.com/sirupsen/logrus"
+)
+
+// LoadPermissions resolves the permissions of the authenticated user. It must
+// run after AuthRequired.
+func LoadPermissions(authz *services.AuthorizationService) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		user := GetUser(c)
+		if user == nil {
+			c.JSON(http.StatusUnauthorized, gin.H{"error": "authentication required"})
+			c.Abort()
+			return
+		}
+
+		permissions, err := authz.UserPermissions(c.Request.Context(), user)
+		if err != nil {
+			logrus.WithError(err).WithField("user_id", user.ID).Error("Failed to load user permissions")
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "failed to load permissions"})
+			c.Abort()
+			return
+		}
+		if apiToken := GetAPIToken(c); apiToken != nil {
+			permissions = permissions.Restrict(apiToken.Scopes)
+		}
+
+		c.Set("permissions", permissions)
+		c.Next()
+	}
+}
+
+// GetPermissions retrieves the permissions of the authenticated user. Without
+// LoadPermissions, admins hold every permission and other users none.
+// Requests made with an API token are limited to its scopes.
+func GetPermissions(c *gin.Context) *services.Permissions {
+	if value, exists := c.Get("permissions"); exists {
+		if permissions, ok := value.(*services.Permissions); ok {
+			return permissions
+		}
+	}
+	if user := GetUser(c); user != nil && user.IsAdmin {
+		if apiToken := GetAPIToken(c); apiToken != nil {
+			return services.AllPermissions().Restrict(apiToken.Scopes)
+		}
+		return services.AllPermissions()
+	}
+	return services.NoPermissions()
+}
+
+// RequirePermission allows only users holding the permission globally
+func RequirePermission(permission string) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		if !GetPermissions(c).Has(permission) {
+			Forbidden(c, permission)
+			return
+		}
+		c.Next()
+	}
+}
+
+// RequireInstancePermission allows only users holding the permission for the
+// CyberArk instance named by the path parameter
+func RequireInstancePermission(permission, param string) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		if !GetPermissions(c).HasOnInstance(permission, c.Param(param)) {
+			Forbidden(c, permission)
+			return
+		}
+		c.Next()
+	}
+}
+
+// RequirePermissionAnywhere allows users holding the permission globally or
+// for at least one CyberArk instance. Handlers narrow access down to the
+// instances involved.
+func RequirePermissionAnywhere(permission string) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		if !GetPermissions(c).HasAnywhere(permission) {
+			Forbidden(c, permission)
+			return
+		}
+		c.Next()
+	}
+}
+
+// Forbidden aborts the request for lack of a permission
+func Forbidden(c *gin.Context, permission string) {
+	c.JSON(http.StatusForbidden, gin.H{
+		"error":      "insufficient permissions",
+		"permission": permission,
+	})
+	c.Abort()
+}
@@ -0,0 +1,12 @@
+package models
+
+type CreateServiceAccountRequest struct {
+	Username string `json:"username" binding:"required,min=1,max=255"`
+	Email    string `json:"email" binding:"omitempty,email,max=255"`
+}
+
+type CreateAPITokenRequest struct {
+	Name          string   `json:"name" binding:"required,min=1,max=100"`
+	Scopes        []string `json:"scopes" binding:"required,min=1"`          // permissions, "*" for all of the account's
+	ExpiresInDays int      `json:"expires_in_days" binding:"min=0,max=3650"` // 0 for no expiry
+}
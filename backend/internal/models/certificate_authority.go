@@ -103,4 +103,25 @@ func (ca *CertificateAuthority) ToInfo() *CertificateAuthorityInfo {
 		CreatedAt:        ca.CreatedAt,
 		UpdatedAt:        ca.UpdatedAt,
 	}
-}
\ No newline at end of file
+}
+// FetchCertificateChainRequest asks for the certificate chain a server presents
+type FetchCertificateChainRequest struct {
+	URL string `json:"url" binding:"required,url"`
+}
+
+// ServerCertificateInfo describes a certificate presented by a server
+type ServerCertificateInfo struct {
+	CertificateChainInfo
+	SPKIFingerprint string `json:"spki_fingerprint"`
+	Certificate     string `json:"certificate"` // PEM encoded
+	Registered      bool   `json:"registered"`  // Already a certificate authority
+}
+
+// FetchCertificateChainResponse is the chain a server presents, leaf first.
+// CACertificate holds its CA certificates, ready to be registered as a
+// certificate authority; it is empty if the server presents none.
+type FetchCertificateChainResponse struct {
+	URL           string                  `json:"url"`
+	Certificates  []ServerCertificateInfo `json:"certificates"`
+	CACertificate string                  `json:"ca_certificate,omitempty"`
+}
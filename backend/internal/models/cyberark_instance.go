@@ -9,9 +9,14 @@ import (
 type CyberArkInstance struct {
 	ID                string         `db:"id" json:"id"`
 	Name              string         `db:"name" json:"name"`
+	InstanceType      string         `db:"instance_type" json:"instance_type"`
 	BaseURL           string         `db:"base_url" json:"base_url"`
+	IdentityURL       string         `db:"identity_url" json:"identity_url,omitempty"`
 	Username          string         `db:"username" json:"username"`
 	PasswordEncrypted string         `db:"password_encrypted" json:"-"` // Never expose in JSON
+	ClientCertificate string         `db:"client_certificate" json:"-"`
+	ClientKeyEncrypted string        `db:"client_key_encrypted" json:"-"` // Never expose in JSON
+	AuthMethod        string         `db:"auth_method" json:"auth_method"`
 	ConcurrentSessions bool          `db:"concurrent_sessions" json:"concurrent_sessions"`
 	SkipTLSVerify     bool           `db:"skip_tls_verify" json:"skip_tls_verify"`
 	IsActive          bool           `db:"is_active" json:"is_active"`
@@ -27,22 +32,50 @@ type CyberArkInstance struct {
 // CreateCyberArkInstanceRequest represents the request to create a new instance
 type CreateCyberArkInstanceRequest struct {
 	Name     string `json:"name" binding:"required"`
+	InstanceType string `json:"instance_type" binding:"omitempty,oneof=self_hosted privilege_cloud"`
 	BaseURL  string `json:"base_url" binding:"required,url"`
-	Username string `json:"username" binding:"required"`
-	Password string `json:"password" binding:"required"`
+	IdentityURL string `json:"identity_url" binding:"omitempty,url"`
+	Username string `json:"username" binding:"required"` // OAuth client ID for Privilege Cloud
+	Password string `json:"password" binding:"required_unless=AuthMethod pki"` // OAuth client secret for Privilege Cloud
+	AuthMethod string `json:"auth_method" binding:"omitempty,oneof=cyberark ldap radius windows pki"`
+	// PEM client certificate and private key for mutual TLS
+	ClientCertificate string `json:"client_certificate,omitempty"`
+	ClientKey string `json:"client_key,omitempty"`
+	// Certificate authorities the PVWA's chain must lead to instead of any
+	// active one, and fingerprints it must match
+	TrustedCAIDs []string `json:"trusted_ca_ids,omitempty"`
+	PinnedCertificates []CertificatePin `json:"pinned_certificates,omitempty" binding:"omitempty,dive"`
 	ConcurrentSessions *bool `json:"concurrent_sessions"`
 	SkipTLSVerify *bool `json:"skip_tls_verify"`
+	RequestsPerSecond *float64 `json:"requests_per_second" binding:"omitempty,min=0"`
+	MaxInFlightRequests *int `json:"max_in_flight_requests" binding:"omitempty,min=0"`
+	// Answer to a RADIUS challenge during the connection test
+	ChallengeResponse string `json:"challenge_response,omitempty"`
 }
 
 // UpdateCyberArkInstanceRequest represents the request to update an instance
 type UpdateCyberArkInstanceRequest struct {
 	Name     string `json:"name,omitempty"`
+	InstanceType string `json:"instance_type,omitempty" binding:"omitempty,oneof=self_hosted privilege_cloud"`
 	BaseURL  string `json:"base_url,omitempty" binding:"omitempty,url"`
+	IdentityURL string `json:"identity_url,omitempty" binding:"omitempty,url"`
 	Username string `json:"username,omitempty"`
 	Password string `json:"password,omitempty"`
+	AuthMethod string `json:"auth_method,omitempty" binding:"omitempty,oneof=cyberark ldap radius windows pki"`
+	// Replaces the client certificate and key; an empty certificate removes them
+	ClientCertificate *string `json:"client_certificate,omitempty"`
+	ClientKey string `json:"client_key,omitempty"`
+	// Replace the trusted certificate authorities and pins; empty lists
+	// remove them
+	TrustedCAIDs *[]string `json:"trusted_ca_ids,omitempty"`
+	PinnedCertificates *[]CertificatePin `json:"pinned_certificates,omitempty" binding:"omitempty,dive"`
 	ConcurrentSessions *bool `json:"concurrent_sessions,omitempty"`
 	SkipTLSVerify *bool `json:"skip_tls_verify,omitempty"`
 	IsActive *bool  `json:"is_active,omitempty"`
+	RequestsPerSecond *float64 `json:"requests_per_second,omitempty" binding:"omitempty,min=0"`
+	MaxInFlightRequests *int `json:"max_in_flight_requests,omitempty" binding:"omitempty,min=0"`
+	// Answer to a RADIUS challenge during the connection test
+	ChallengeResponse string `json:"challenge_response,omitempty"`
 }
 
 // TestConnectionRequest represents the request to test a CyberArk connection
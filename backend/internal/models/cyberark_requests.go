@@ -6,22 +6,76 @@ import "time"
 type CyberArkInstanceInfo struct {
 	ID                 string    `json:"id"`
 	Name               string    `json:"name"`
+	InstanceType       string    `json:"instance_type"`
 	BaseURL            string    `json:"base_url"`
+	IdentityURL        string    `json:"identity_url,omitempty"`
 	Username           string    `json:"username"`
+	AuthMethod         string    `json:"auth_method"`
 	ConcurrentSessions bool      `json:"concurrent_sessions"`
 	SkipTLSVerify      bool      `json:"skip_tls_verify"`
 	IsActive           bool      `json:"is_active"`
 	LastTestAt         *time.Time `json:"last_test_at,omitempty"`
 	LastTestSuccess    *bool      `json:"last_test_success,omitempty"`
 	LastTestError      *string    `json:"last_test_error,omitempty"`
+	RequestsPerSecond   float64   `json:"requests_per_second"`
+	MaxInFlightRequests int       `json:"max_in_flight_requests"`
+	ClientCertificate  *ClientCertificateInfo `json:"client_certificate,omitempty"`
+	TrustedCAIDs       []string         `json:"trusted_ca_ids"`
+	PinnedCertificates []CertificatePin `json:"pinned_certificates"`
 	CreatedAt          time.Time  `json:"created_at"`
 	UpdatedAt          time.Time  `json:"updated_at"`
+
+	// Circuit breaker for the vault as seen by this server
+	Breaker *CircuitBreakerInfo `json:"breaker,omitempty"`
+}
+
+// ClientCertificateInfo is the response model for the client certificate of
+// an instance (without the key)
+type ClientCertificateInfo struct {
+	Subject     string    `json:"subject"`
+	Issuer      string    `json:"issuer"`
+	Fingerprint string    `json:"fingerprint"`
+	NotBefore   time.Time `json:"not_before"`
+	NotAfter    time.Time `json:"not_after"`
+}
+
+// CertificatePin is a leaf or SPKI fingerprint the certificate chain of an
+// instance must match
+type CertificatePin struct {
+	Type        string `json:"type" binding:"required,oneof=leaf spki"`
+	Fingerprint string `json:"fingerprint" binding:"required"` // hex encoded SHA-256
+}
+
+// CircuitBreakerInfo is the response model for the circuit breaker of an instance
+type CircuitBreakerInfo struct {
+	State               string     `json:"state"`
+	ConsecutiveFailures int        `json:"consecutive_failures"`
+	OpenedAt            *time.Time `json:"opened_at,omitempty"`
+	RetryAt             *time.Time `json:"retry_at,omitempty"`
+	InFlight            int        `json:"in_flight"`
+}
+
+// TestInstanceConnectionRequest is the optional request model for testing a
+// stored CyberArk instance
+type TestInstanceConnectionRequest struct {
+	// Answer to a RADIUS challenge returned by an earlier attempt
+	ChallengeResponse string `json:"challenge_response,omitempty"`
 }
 
 // TestCyberArkConnectionRequest is the request model for testing a CyberArk connection
 type TestCyberArkConnectionRequest struct {
+	InstanceType  string  `json:"instance_type,omitempty" binding:"omitempty,oneof=self_hosted privilege_cloud"`
 	BaseURL       string  `json:"base_url" binding:"required"`
+	IdentityURL   string  `json:"identity_url,omitempty"`
 	Username      string  `json:"username" binding:"required"`
-	Password      string  `json:"password" binding:"required"`
+	Password      string  `json:"password" binding:"required_unless=AuthMethod pki"`
 	SkipTLSVerify *bool   `json:"skip_tls_verify,omitempty"`
+	AuthMethod    string  `json:"auth_method,omitempty" binding:"omitempty,oneof=cyberark ldap radius windows pki"`
+	ClientCertificate string `json:"client_certificate,omitempty"`
+	ClientKey     string  `json:"client_key,omitempty"`
+	TrustedCAIDs  []string `json:"trusted_ca_ids,omitempty"`
+	PinnedCertificates []CertificatePin `json:"pinned_certificates,omitempty" binding:"omitempty,dive"`
+	ConcurrentSessions *bool `json:"concurrent_sessions,omitempty"`
+	// Answer to a RADIUS challenge returned by an earlier attempt
+	ChallengeResponse string `json:"challenge_response,omitempty"`
 }
\ No newline at end of file
@@ -0,0 +1,45 @@
+package gorm
+
+import (
+	"time"
+
+	"github.com/orca-ng/orca/pkg/ulid"
+	"gorm.io/gorm"
+)
+
+// APIToken is a long-lived credential of a service account. Only a hash of
+// the token is stored; it is shown once when created.
+type APIToken struct {
+	ID         string     `gorm:"primaryKey;size:30" json:"id"`
+	UserID     string     `gorm:"size:30;not null;index" json:"user_id"`
+	Name       string     `gorm:"size:100;not null" json:"name"`
+	Display    string     `gorm:"size:20;not null" json:"display"` // start of the token, to recognise it by
+	TokenHash  string     `gorm:"size:64;not null;uniqueIndex" json:"-"`
+	Scopes     []string   `gorm:"type:text;serializer:json" json:"scopes"` // permissions the token is limited to
+	ExpiresAt  *time.Time `json:"expires_at,omitempty"`                    // nil for no expiry
+	LastUsedAt *time.Time `json:"last_used_at,omitempty"`
+	LastUsedIP *string    `gorm:"size:45" json:"last_used_ip,omitempty"`
+	RevokedAt  *time.Time `gorm:"index" json:"revoked_at,omitempty"`
+	RevokedBy  *string    `gorm:"size:30" json:"revoked_by,omitempty"`
+	CreatedBy  *string    `gorm:"size:30" json:"created_by,omitempty"`
+	CreatedAt  time.Time  `gorm:"autoCreateTime" json:"created_at"`
+
+	// Relationships
+	User *User `gorm:"foreignKey:UserID;constraint:OnDelete:CASCADE" json:"-"`
+}
+
+func (t *APIToken) BeforeCreate(tx *gorm.DB) error {
+	if t.ID == "" {
+		t.ID = ulid.New(ulid.APITokenPrefix)
+	}
+	return nil
+}
+
+func (APIToken) TableName() string {
+	return "api_tokens"
+}
+
+// Active reports whether the token can be used at the given time
+func (t *APIToken) Active(now time.Time) bool {
+	return t.RevokedAt == nil && (t.ExpiresAt == nil || now.Before(*t.ExpiresAt))
+}
@@ -0,0 +1,143 @@
+package gorm
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"time"
+
+	"github.com/orca-ng/orca/pkg/ulid"
+	"gorm.io/gorm"
+)
+
+// Audit event actions
+const (
+	AuditLoginSucceeded = "login.succeeded"
+	AuditLoginFailed    = "login.failed"
+	AuditLoginLocked    = "login.locked"   // failures reached a lockout threshold
+	AuditLoginUnlocked  = "login.unlocked" // an admin lifted a lockout
+
+	AuditUserCreated       = "user.created"
+	AuditUserUpdated       = "user.updated"
+	AuditUserDeleted       = "user.deleted"
+	AuditUserPasswordReset = "user.password_reset"
+	AuditSessionRevoked    = "session.revoked"
+
+	AuditInstanceCreated = "instance.created"
+	AuditInstanceUpdated = "instance.updated"
+	AuditInstanceDeleted = "instance.deleted"
+
+	AuditCACreated       = "ca.created"
+	AuditCAUpdated       = "ca.updated"
+	AuditCADeleted       = "ca.deleted"
+	AuditCAPoolRefreshed = "ca.pool_refreshed"
+	AuditCAChainFetched  = "ca.chain_fetched" // a server's chain was fetched to be trusted
+
+	AuditSyncConfigUpdated   = "sync_config.updated"
+	AuditSyncScheduleUpdated = "sync_schedule.updated"
+	AuditSyncPaused          = "sync.paused"
+	AuditSyncResumed         = "sync.resumed"
+	AuditSyncTriggered       = "sync.triggered"
+
+	AuditOperationCreated         = "operation.created"
+	AuditOperationCancelled       = "operation.cancelled"
+	AuditOperationPriorityChanged = "operation.priority_changed"
+
+	AuditRoleCreated    = "role.created"
+	AuditRoleUpdated    = "role.updated"
+	AuditRoleDeleted    = "role.deleted"
+	AuditRoleAssigned   = "role.assigned"
+	AuditRoleUnassigned = "role.unassigned"
+
+	AuditServiceAccountCreated = "service_account.created"
+	AuditAPITokenCreated       = "api_token.created"
+	AuditAPITokenRevoked       = "api_token.revoked"
+
+	AuditMFAEnabled                  = "mfa.enabled"
+	AuditMFADisabled                 = "mfa.disabled"
+	AuditMFARecoveryCodesRegenerated = "mfa.recovery_codes_regenerated"
+	AuditMFAReset                    = "mfa.reset" // an admin removed a user's enrolment
+
+	AuditPipelineConfigUpdated = "pipeline_config.updated"
+)
+
+// AuditChange is the value of a field before and after a change, empty when
+// the field did not exist
+type AuditChange struct {
+	Before string `json:"before,omitempty"`
+	After  string `json:"after,omitempty"`
+}
+
+// AuditEvent records a security relevant action
+type AuditEvent struct {
+	ID        string                 `gorm:"primaryKey;size:30" json:"id"`
+	Action    string                 `gorm:"size:50;not null;index" json:"action"`
+	ActorID   *string                `gorm:"size:30;index" json:"actor_id,omitempty"` // nil when the actor is not a known user
+	ActorName string                 `gorm:"size:255" json:"actor_name"`              // username, as given for failed logins
+	Target    string                 `gorm:"size:255" json:"target,omitempty"`        // what the action applied to, e.g. "ip:192.0.2.1"
+	ClientIP  string                 `gorm:"size:45" json:"client_ip,omitempty"`
+	UserAgent string                 `gorm:"type:text" json:"user_agent,omitempty"`
+	RequestID string                 `gorm:"size:64;index" json:"request_id,omitempty"`
+	Details   map[string]string      `gorm:"type:text;serializer:json" json:"details,omitempty"`
+	Changes   map[string]AuditChange `gorm:"type:text;serializer:json" json:"changes,omitempty"` // fields changed by the action
+	CreatedAt time.Time              `gorm:"autoCreateTime;index" json:"created_at"`
+
+	// Hash chain. Each event hashes its content together with the hash of the
+	// event before it, so that changing or removing an event breaks the chain.
+	// Events recorded before the chain existed have sequence 0.
+	Sequence int64  `gorm:"not null;default:0;index" json:"sequence"`
+	PrevHash string `gorm:"size:64" json:"prev_hash"`
+	Hash     string `gorm:"size:64" json:"hash"`
+}
+
+func (e *AuditEvent) BeforeCreate(tx *gorm.DB) error {
+	if e.ID == "" {
+		e.ID = ulid.New(ulid.AuditEventPrefix)
+	}
+	return nil
+}
+
+func (AuditEvent) TableName() string {
+	return "audit_events"
+}
+
+// ComputeHash returns the SHA-256 hash, in hex, of the event content and the
+// hash of the previous event
+func (e *AuditEvent) ComputeHash() string {
+	content := struct {
+		Sequence  int64                  `json:"sequence"`
+		PrevHash  string                 `json:"prev_hash"`
+		ID        string                 `json:"id"`
+		Action    string                 `json:"action"`
+		ActorID   *string                `json:"actor_id"`
+		ActorName string                 `json:"actor_name"`
+		Target    string                 `json:"target"`
+		ClientIP  string                 `json:"client_ip"`
+		UserAgent string                 `json:"user_agent"`
+		RequestID string                 `json:"request_id"`
+		Details   map[string]string      `json:"details,omitempty"`
+		Changes   map[string]AuditChange `json:"changes,omitempty"`
+		CreatedAt int64                  `json:"created_at"` // in milliseconds, what every database keeps
+	}{e.Sequence, e.PrevHash, e.ID, e.Action, e.ActorID, e.ActorName, e.Target, e.ClientIP, e.UserAgent, e.RequestID, e.Details, e.Changes, e.CreatedAt.UnixMilli()}
+	// Marshalling cannot fail for these types, and sorts map keys
+	data, _ := json.Marshal(content)
+	sum := sha256.Sum256(data)
+	return hex.EncodeToString(sum[:])
+}
+
+// AuditChainHead is the single row that holds the last event of the audit
+// hash chain. Appending to the chain updates it conditionally, so that
+// replicas cannot append two events with the same sequence.
+type AuditChainHead struct {
+	ID        string    `gorm:"primaryKey;size:30" json:"id"`
+	Sequence  int64     `gorm:"not null;default:0" json:"sequence"`
+	Hash      string    `gorm:"size:64" json:"hash"`
+	UpdatedAt time.Time `gorm:"autoUpdateTime" json:"updated_at"`
+}
+
+// AuditChainID is the ID of the audit chain head row
+const AuditChainID = "audit"
+
+func (AuditChainHead) TableName() string {
+	return "audit_chain_heads"
+}
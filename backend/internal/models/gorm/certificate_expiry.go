@@ -0,0 +1,56 @@
+package gorm
+
+import (
+	"time"
+
+	"github.com/orca-ng/orca/pkg/ulid"
+	"gorm.io/gorm"
+)
+
+// Sources of monitored certificates
+const (
+	ExpirySourceCertificateAuthority = "certificate_authority"
+	ExpirySourcePVWA                 = "pvwa" // chain presented by an instance's PVWA
+)
+
+// Expiry states
+const (
+	ExpiryStatusValid    = "valid"
+	ExpiryStatusExpiring = "expiring"
+	ExpiryStatusExpired  = "expired"
+)
+
+// CertificateExpiry is the latest expiry check of one certificate, either
+// from a stored CA chain or from the chain a PVWA presents
+type CertificateExpiry struct {
+	ID            string    `gorm:"primaryKey;size:30" json:"id"`
+	SourceType    string    `gorm:"size:30;not null;uniqueIndex:idx_certificate_expiry_source" json:"source_type"`
+	SourceID      string    `gorm:"size:30;not null;uniqueIndex:idx_certificate_expiry_source" json:"source_id"`
+	SourceName    string    `gorm:"type:text" json:"source_name"`
+	Fingerprint   string    `gorm:"size:64;not null;uniqueIndex:idx_certificate_expiry_source" json:"fingerprint"`
+	Subject       string    `gorm:"type:text" json:"subject"`
+	Issuer        string    `gorm:"type:text" json:"issuer"`
+	IsCA          bool      `json:"is_ca"`
+	NotAfter      time.Time `gorm:"not null;index" json:"not_after"`
+	DaysRemaining int       `json:"days_remaining"`
+	Status        string    `gorm:"size:20;not null;index" json:"status"`
+
+	// Smallest warning threshold, in days, the certificate is within; 0
+	// once expired and nil while it is further away than every threshold
+	Threshold *int `json:"threshold,omitempty"`
+
+	// Threshold a notification was last raised for, so that each one is
+	// only raised once
+	NotifiedThreshold *int `json:"notified_threshold,omitempty"`
+
+	CheckedAt time.Time `gorm:"not null" json:"checked_at"`
+	CreatedAt time.Time `json:"created_at"`
+	UpdatedAt time.Time `json:"updated_at"`
+}
+
+func (e *CertificateExpiry) BeforeCreate(tx *gorm.DB) error {
+	if e.ID == "" {
+		e.ID = ulid.New(ulid.CertificateExpiryPrefix)
+	}
+	return nil
+}
@@ -0,0 +1,36 @@
+package gorm
+
+import (
+	"time"
+)
+
+// LeaderLease records which ORCA replica currently runs the singleton
+// background tasks. A replica keeps the lease by renewing ExpiresAt; once it
+// lapses any other replica may take it over.
+type LeaderLease struct {
+	Name      string    `gorm:"primaryKey;size:100" json:"name"`
+	HolderID  string    `gorm:"size:100;not null" json:"holder_id"`
+	ExpiresAt time.Time `gorm:"not null;index" json:"expires_at"`
+	UpdatedAt time.Time `gorm:"autoUpdateTime" json:"updated_at"`
+}
+
+func (LeaderLease) TableName() string {
+	return "leader_leases"
+}
+
+// ClusterEvent is an operation, sync job or certificate expiry event shared between replicas on
+// databases without LISTEN/NOTIFY. Events only reference the changed row;
+// receivers reload it themselves.
+type ClusterEvent struct {
+	ID                  uint64    `gorm:"primaryKey;autoIncrement" json:"id"`
+	Origin              string    `gorm:"size:100;not null" json:"origin"`
+	Type                string    `gorm:"size:30;not null" json:"type"`
+	OperationID         *string   `gorm:"size:30" json:"operation_id,omitempty"`
+	SyncJobID           *string   `gorm:"size:30" json:"sync_job_id,omitempty"`
+	CertificateExpiryID *string   `gorm:"size:30" json:"certificate_expiry_id,omitempty"`
+	CreatedAt           time.Time `gorm:"autoCreateTime;index" json:"created_at"`
+}
+
+func (ClusterEvent) TableName() string {
+	return "cluster_events"
+}
@@ -10,12 +10,20 @@ import (
 type CyberArkInstance struct {
 	ID                  string     `gorm:"primaryKey;size:30" json:"id"`
 	Name                string     `gorm:"size:255;not null;uniqueIndex" json:"name"`
+	InstanceType        string     `gorm:"size:20;not null;default:self_hosted" json:"instance_type"` // self_hosted, privilege_cloud
 	BaseURL             string     `gorm:"type:text;not null" json:"base_url"`
-	Username            string     `gorm:"size:255;not null" json:"username"`
-	PasswordEncrypted   string     `gorm:"type:text;not null" json:"-"`
+	IdentityURL         string     `gorm:"type:text" json:"identity_url,omitempty"` // Privilege Cloud: Identity tenant issuing OAuth tokens
+	Username            string     `gorm:"size:255;not null" json:"username"`         // OAuth client ID for Privilege Cloud
+	PasswordEncrypted   string     `gorm:"type:text;not null" json:"-"`               // OAuth client secret for Privilege Cloud
+	ClientCertificate   string     `gorm:"type:text" json:"-"`                        // PEM certificate (and chain) for mutual TLS
+	ClientKeyEncrypted  string     `gorm:"type:text" json:"-"`                        // PEM private key of the client certificate
+	AuthMethod          string     `gorm:"size:20;not null;default:cyberark" json:"auth_method"` // cyberark, ldap, radius, windows
 	Password            string     `gorm:"-" json:"-"` // Not stored in DB
 	ConcurrentSessions  bool       `gorm:"default:true;not null" json:"concurrent_sessions"`
 	SkipTLSVerify       bool       `gorm:"default:false" json:"skip_tls_verify"`
+	PinnedCertificates  []CertificatePin `gorm:"type:text;serializer:json" json:"pinned_certificates,omitempty"`
+	RequestsPerSecond   float64    `gorm:"not null;default:0" json:"requests_per_second"`      // 0 = unlimited
+	MaxInFlightRequests int        `gorm:"not null;default:0" json:"max_in_flight_requests"`   // 0 = unlimited
 	IsActive            bool       `gorm:"default:true" json:"is_active"`
 	LastTestAt          *time.Time `json:"last_test_at,omitempty"`
 	LastTestSuccess     *bool      `json:"last_test_success,omitempty"`
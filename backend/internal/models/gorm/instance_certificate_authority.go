@@ -0,0 +1,24 @@
+package gorm
+
+import "time"
+
+// InstanceCertificateAuthority binds a CyberArk instance to a certificate
+// authority. Instances with bindings trust only those CAs instead of every
+// active one.
+type InstanceCertificateAuthority struct {
+	CyberArkInstanceID     string    `gorm:"primaryKey;size:30" json:"cyberark_instance_id"`
+	CertificateAuthorityID string    `gorm:"primaryKey;type:text;index" json:"certificate_authority_id"`
+	CreatedAt              time.Time `gorm:"autoCreateTime" json:"created_at"`
+}
+
+// Certificate pin types
+const (
+	PinTypeLeaf = "leaf" // SHA-256 of the PVWA's own certificate
+	PinTypeSPKI = "spki" // SHA-256 of the public key of any certificate in the chain
+)
+
+// CertificatePin is a fingerprint the certificate chain of a PVWA must match
+type CertificatePin struct {
+	Type        string `json:"type"`
+	Fingerprint string `json:"fingerprint"` // hex encoded SHA-256
+}
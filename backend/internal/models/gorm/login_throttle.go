@@ -0,0 +1,31 @@
+package gorm
+
+import "time"
+
+// Kinds of login throttles
+const (
+	ThrottleKindUsername = "username"
+	ThrottleKindIP       = "ip"
+)
+
+// LoginThrottle counts the recent failed logins of one username or client
+// IP. It lives in the database so that every replica enforces the same
+// delays and lockouts.
+type LoginThrottle struct {
+	Kind          string     `gorm:"primaryKey;size:20" json:"kind"`
+	Subject       string     `gorm:"primaryKey;size:255" json:"subject"` // lower-cased username or client IP
+	Failures      int        `gorm:"not null;default:0" json:"failures"` // since the last success, within the window
+	LastFailureAt time.Time  `gorm:"index" json:"last_failure_at"`
+	RetryAt       *time.Time `json:"retry_at,omitempty"`                  // no attempt is checked before this
+	LockedUntil   *time.Time `gorm:"index" json:"locked_until,omitempty"` // set once the failures reach the threshold
+	UpdatedAt     time.Time  `gorm:"autoUpdateTime" json:"updated_at"`
+}
+
+func (LoginThrottle) TableName() string {
+	return "login_throttles"
+}
+
+// Locked reports whether logins are locked out at the given time
+func (t *LoginThrottle) Locked(now time.Time) bool {
+	return t.LockedUntil != nil && now.Before(*t.LockedUntil)
+}
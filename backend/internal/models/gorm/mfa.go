@@ -0,0 +1,77 @@
+package gorm
+
+import (
+	"time"
+
+	"github.com/orca-ng/orca/pkg/ulid"
+	"gorm.io/gorm"
+)
+
+// UserMFA is the TOTP enrolment of a user. It is created when enrolment
+// starts and enabled once the user confirms a code from their app.
+type UserMFA struct {
+	UserID          string     `gorm:"primaryKey;size:30" json:"user_id"`
+	SecretEncrypted string     `gorm:"type:text;not null" json:"-"`
+	EnabledAt       *time.Time `json:"enabled_at,omitempty"` // nil while enrolment is pending
+	LastUsedStep    int64      `gorm:"default:0" json:"-"`   // time step of the last accepted code, so a code is used once
+	CreatedAt       time.Time  `gorm:"autoCreateTime" json:"created_at"`
+	UpdatedAt       time.Time  `gorm:"autoUpdateTime" json:"updated_at"`
+
+	// Relationships
+	User *User `gorm:"foreignKey:UserID;constraint:OnDelete:CASCADE" json:"-"`
+}
+
+func (UserMFA) TableName() string {
+	return "user_mfa"
+}
+
+// MFARecoveryCode is a single-use code to log in without the authenticator
+// app. Only its Argon2 hash is stored.
+type MFARecoveryCode struct {
+	ID        string     `gorm:"primaryKey;size:30" json:"id"`
+	UserID    string     `gorm:"size:30;not null;index" json:"user_id"`
+	CodeHash  string     `gorm:"size:255;not null" json:"-"`
+	UsedAt    *time.Time `json:"used_at,omitempty"`
+	CreatedAt time.Time  `gorm:"autoCreateTime" json:"created_at"`
+
+	// Relationships
+	User *User `gorm:"foreignKey:UserID;constraint:OnDelete:CASCADE" json:"-"`
+}
+
+func (c *MFARecoveryCode) BeforeCreate(tx *gorm.DB) error {
+	if c.ID == "" {
+		c.ID = ulid.New(ulid.MFARecoveryCodePrefix)
+	}
+	return nil
+}
+
+func (MFARecoveryCode) TableName() string {
+	return "mfa_recovery_codes"
+}
+
+// MFAChallenge is a login that passed the password check and waits for the
+// second factor. The token handed to the client is stored hashed.
+type MFAChallenge struct {
+	ID        string    `gorm:"primaryKey;size:30" json:"id"`
+	UserID    string    `gorm:"size:30;not null;index" json:"user_id"`
+	TokenHash string    `gorm:"size:64;not null;uniqueIndex" json:"-"`
+	CLI       bool      `gorm:"default:false" json:"cli"`    // started by LoginCLI, answered with a token instead of a cookie
+	Enroll    bool      `gorm:"default:false" json:"enroll"` // the user must enrol before the login completes
+	Attempts  int       `gorm:"default:0" json:"attempts"`
+	ExpiresAt time.Time `gorm:"not null;index" json:"expires_at"`
+	CreatedAt time.Time `gorm:"autoCreateTime" json:"created_at"`
+
+	// Relationships
+	User *User `gorm:"foreignKey:UserID;constraint:OnDelete:CASCADE" json:"-"`
+}
+
+func (c *MFAChallenge) BeforeCreate(tx *gorm.DB) error {
+	if c.ID == "" {
+		c.ID = ulid.New(ulid.MFAChallengePrefix)
+	}
+	return nil
+}
+
+func (MFAChallenge) TableName() string {
+	return "mfa_challenges"
+}
@@ -17,13 +17,15 @@ type Operation struct {
 	Result              *json.RawMessage `gorm:"type:json" json:"result,omitempty"`
 	ErrorMessage        *string        `gorm:"type:text" json:"error_message,omitempty"`
 	RetryCount          int            `gorm:"default:0" json:"retry_count"`
-	MaxRetries          int            `gorm:"default:3" json:"max_retries"`
+	MaxRetries          int            `gorm:"default:0" json:"max_retries"` // lowers the retry policy's limit when set
 	ScheduledAt         time.Time      `gorm:"not null;default:CURRENT_TIMESTAMP" json:"scheduled_at"`
 	StartedAt           *time.Time     `json:"started_at,omitempty"`
 	CompletedAt         *time.Time     `json:"completed_at,omitempty"`
 	CreatedBy           *string        `gorm:"size:30" json:"created_by,omitempty"`
 	CyberArkInstanceID  *string        `gorm:"size:30" json:"cyberark_instance_id,omitempty"`
 	CorrelationID       *string        `gorm:"size:30" json:"correlation_id,omitempty"`
+	LockedBy            *string        `gorm:"size:100;index" json:"locked_by,omitempty"` // processor that holds the lease
+	LeaseExpiresAt      *time.Time     `gorm:"index" json:"lease_expires_at,omitempty"` // reclaimed by the reaper once passed
 	CreatedAt           time.Time      `gorm:"autoCreateTime" json:"created_at"`
 	UpdatedAt           time.Time      `gorm:"autoUpdateTime" json:"updated_at"`
 	
@@ -0,0 +1,31 @@
+package gorm
+
+import (
+	"time"
+
+	"github.com/orca-ng/orca/pkg/ulid"
+	"gorm.io/gorm"
+)
+
+// PasswordHistory keeps the Argon2 hash of a previous password of a local
+// user, so that recent passwords cannot be reused.
+type PasswordHistory struct {
+	ID           string    `gorm:"primaryKey;size:30" json:"id"`
+	UserID       string    `gorm:"size:30;not null;index" json:"user_id"`
+	PasswordHash string    `gorm:"size:255;not null" json:"-"`
+	CreatedAt    time.Time `gorm:"autoCreateTime;index" json:"created_at"` // when the password was replaced
+
+	// Relationships
+	User *User `gorm:"foreignKey:UserID;constraint:OnDelete:CASCADE" json:"-"`
+}
+
+func (h *PasswordHistory) BeforeCreate(tx *gorm.DB) error {
+	if h.ID == "" {
+		h.ID = ulid.New(ulid.PasswordHistoryPrefix)
+	}
+	return nil
+}
+
+func (PasswordHistory) TableName() string {
+	return "password_history"
+}
@@ -0,0 +1,178 @@
+package gorm
+
+import (
+	"time"
+
+	"github.com/orca-ng/orca/pkg/ulid"
+	"gorm.io/gorm"
+)
+
+// Permissions. A permission ending in ":*" grants every permission it
+// prefixes and "*" grants everything.
+const (
+	PermAll = "*"
+
+	PermInstancesRead  = "instances:read"
+	PermInstancesWrite = "instances:write"
+
+	PermOperationsRead    = "operations:read"
+	PermOperationsCreate  = "operations:create" // followed by ":<operation type>"
+	PermOperationsCancel  = "operations:cancel"
+	PermOperationsApprove = "operations:approve" // approve and reprioritise queued operations
+
+	PermSyncRead   = "sync:read"
+	PermSyncManage = "sync:manage"
+
+	PermCertificatesRead   = "certificates:read"
+	PermCertificatesManage = "certificates:manage"
+
+	PermPipelineManage        = "pipeline:manage"
+	PermRolesManage           = "roles:manage"
+	PermServiceAccountsManage = "service-accounts:manage" // create service accounts and their API tokens
+	PermUsersManage           = "users:manage"            // manage user accounts and reset their MFA enrolment
+	PermAuditRead             = "audit:read"              // query and verify the audit log
+)
+
+// OperationTypes are the operation types creation permissions exist for
+var OperationTypes = []string{
+	"safe_provision",
+	"safe_modify",
+	"safe_delete",
+	"access_grant",
+	"access_revoke",
+	"user_sync",
+	"safe_sync",
+	"group_sync",
+}
+
+// GlobalOnlyPermissions are not tied to a CyberArk instance. They are
+// ignored in role assignments scoped to an instance.
+var GlobalOnlyPermissions = []string{
+	PermCertificatesManage,
+	PermPipelineManage,
+	PermRolesManage,
+	PermServiceAccountsManage,
+	PermUsersManage,
+	PermAuditRead,
+}
+
+// OperationCreatePermission returns the permission to create operations of a type
+func OperationCreatePermission(opType string) string {
+	return PermOperationsCreate + ":" + opType
+}
+
+// Role is a named set of permissions
+type Role struct {
+	ID          string    `gorm:"primaryKey;size:30" json:"id"`
+	Name        string    `gorm:"size:100;not null;uniqueIndex" json:"name"`
+	Description string    `gorm:"type:text" json:"description"`
+	Permissions []string  `gorm:"type:text;serializer:json" json:"permissions"`
+	IsSystem    bool      `gorm:"default:false" json:"is_system"`   // built in, cannot be changed or deleted
+	RequireMFA  bool      `gorm:"default:false" json:"require_mfa"` // holders must log in with a second factor
+	CreatedAt   time.Time `gorm:"autoCreateTime" json:"created_at"`
+	UpdatedAt   time.Time `gorm:"autoUpdateTime" json:"updated_at"`
+}
+
+func (r *Role) BeforeCreate(tx *gorm.DB) error {
+	if r.ID == "" {
+		r.ID = ulid.New(ulid.RolePrefix)
+	}
+	return nil
+}
+
+func (Role) TableName() string {
+	return "roles"
+}
+
+// RoleAssignment grants a role to a user, either globally or only for one
+// CyberArk instance
+type RoleAssignment struct {
+	ID                 string    `gorm:"primaryKey;size:30" json:"id"`
+	UserID             string    `gorm:"size:30;not null;index" json:"user_id"`
+	RoleID             string    `gorm:"size:30;not null;index" json:"role_id"`
+	CyberArkInstanceID *string   `gorm:"size:30;index" json:"cyberark_instance_id,omitempty"` // nil for a global assignment
+	Source             string    `gorm:"size:20;not null;default:manual" json:"source"`       // manual, or the provider that maps it from groups
+	CreatedBy          *string   `gorm:"size:30" json:"created_by,omitempty"`
+	CreatedAt          time.Time `gorm:"autoCreateTime" json:"created_at"`
+
+	// Relationships
+	Role *Role `gorm:"foreignKey:RoleID" json:"role,omitempty"`
+}
+
+func (a *RoleAssignment) BeforeCreate(tx *gorm.DB) error {
+	if a.ID == "" {
+		a.ID = ulid.New(ulid.RoleAssignmentPrefix)
+	}
+	if a.Source == "" {
+		a.Source = RoleAssignmentSourceManual
+	}
+	return nil
+}
+
+func (RoleAssignment) TableName() string {
+	return "role_assignments"
+}
+
+// RoleAssignmentSourceManual marks assignments made through the API. Others
+// are named after the authentication provider that maintains them.
+const RoleAssignmentSourceManual = "manual"
+
+// SystemRoles are the built-in roles seeded on startup
+func SystemRoles() []Role {
+	return []Role{
+		{
+			Name:        "administrator",
+			Description: "Full access to ORCA",
+			Permissions: []string{PermAll},
+		},
+		{
+			Name:        "operator",
+			Description: "Runs operations and syncs against CyberArk instances",
+			Permissions: []string{
+				PermInstancesRead,
+				PermOperationsRead,
+				PermOperationsCreate + ":*",
+				PermOperationsCancel,
+				PermSyncRead,
+				PermSyncManage,
+				PermCertificatesRead,
+			},
+		},
+		{
+			Name:        "instance-owner",
+			Description: "Manages the CyberArk instances it is assigned for, meant to be scoped to the instances of an app team",
+			Permissions: []string{
+				PermInstancesRead,
+				PermInstancesWrite,
+				PermOperationsRead,
+				PermOperationsCreate + ":*",
+				PermOperationsCancel,
+				PermOperationsApprove,
+				PermSyncRead,
+				PermSyncManage,
+				PermCertificatesRead,
+			},
+		},
+		{
+			Name:        "auditor",
+			Description: "Reads the audit log and everything else, without changing anything",
+			Permissions: []string{
+				PermAuditRead,
+				PermInstancesRead,
+				PermOperationsRead,
+				PermSyncRead,
+				PermCertificatesRead,
+			},
+		},
+		{
+			Name:        "viewer",
+			Description: "Read-only access",
+			Permissions: []string{
+				PermInstancesRead,
+				PermOperationsRead,
+				PermSyncRead,
+				PermCertificatesRead,
+			},
+		},
+	}
+}
@@ -16,6 +16,9 @@ type User struct {
 	LastLoginAt  *time.Time `json:"last_login_at,omitempty"`
 	IsActive     bool       `gorm:"default:true" json:"is_active"`
 	IsAdmin      bool       `gorm:"default:false" json:"is_admin"`
+	AuthProvider string     `gorm:"size:20;not null;default:local;index:idx_users_external" json:"auth_provider"` // local, oidc, ldap, service
+	ExternalID   *string    `gorm:"size:255;index:idx_users_external" json:"external_id,omitempty"`            // subject at the identity provider
+	Email        string     `gorm:"size:255" json:"email,omitempty"`
 	
 	// Relationships
 	Sessions            []Session            `gorm:"foreignKey:UserID;constraint:OnDelete:CASCADE" json:"-"`
@@ -26,10 +29,21 @@ type User struct {
 	UpdatedAuthorities  []CertificateAuthority `gorm:"foreignKey:UpdatedBy" json:"-"`
 }
 
+// Authentication providers of users
+const (
+	AuthProviderLocal          = "local"
+	AuthProviderOIDC           = "oidc"
+	AuthProviderLDAP           = "ldap"
+	AuthProviderServiceAccount = "service" // no password, authenticates with API tokens
+)
+
 func (u *User) BeforeCreate(tx *gorm.DB) error {
 	if u.ID == "" {
 		u.ID = ulid.New(ulid.UserPrefix)
 	}
+	if u.AuthProvider == "" {
+		u.AuthProvider = AuthProviderLocal
+	}
 	return nil
 }
 
@@ -0,0 +1,16 @@
+package models
+
+// MFALoginRequest completes a login with a TOTP or recovery code
+type MFALoginRequest struct {
+	MFAToken string `json:"mfa_token" binding:"required"`
+	Code     string `json:"code" binding:"required"`
+}
+
+// MFAEnrollLoginRequest starts the enrolment a login requires
+type MFAEnrollLoginRequest struct {
+	MFAToken string `json:"mfa_token" binding:"required"`
+}
+
+type MFACodeRequest struct {
+	Code string `json:"code" binding:"required"`
+}
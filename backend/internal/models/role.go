@@ -0,0 +1,20 @@
+package models
+
+type CreateRoleRequest struct {
+	Name        string   `json:"name" binding:"required,min=1,max=100"`
+	Description string   `json:"description" binding:"max=1000"`
+	Permissions []string `json:"permissions" binding:"required,min=1"`
+	RequireMFA  bool     `json:"require_mfa"`
+}
+
+type UpdateRoleRequest struct {
+	Name        *string  `json:"name" binding:"omitempty,min=1,max=100"`
+	Description *string  `json:"description" binding:"omitempty,max=1000"`
+	Permissions []string `json:"permissions" binding:"omitempty,min=1"`
+	RequireMFA  *bool    `json:"require_mfa"` // may also be changed on built-in roles
+}
+
+type AssignRoleRequest struct {
+	RoleID             string  `json:"role_id" binding:"required"`
+	CyberArkInstanceID *string `json:"cyberark_instance_id"` // omitted for a global assignment
+}
@@ -13,6 +13,7 @@ type User struct {
 	LastLoginAt *time.Time `json:"last_login_at,omitempty" db:"last_login_at"`
 	IsActive    bool       `json:"is_active" db:"is_active"`
 	IsAdmin     bool       `json:"is_admin" db:"is_admin"`
+	AuthProvider string    `json:"auth_provider" db:"auth_provider"`
 }
 
 type Session struct {
@@ -29,4 +30,42 @@ type Session struct {
 type LoginRequest struct {
 	Username string `json:"username" binding:"required"`
 	Password string `json:"password" binding:"required"`
-}
\ No newline at end of file
+}
+
+// UnlockRequest lifts the login lockout of either a username or a client IP
+type UnlockRequest struct {
+	Username string `json:"username"`
+	IP       string `json:"ip"`
+}
+
+type CreateUserRequest struct {
+	Username string `json:"username" binding:"required,min=1,max=255"`
+	Password string `json:"password" binding:"required"`
+	Email    string `json:"email" binding:"omitempty,email,max=255"`
+	IsAdmin  bool   `json:"is_admin"`
+	IsActive *bool  `json:"is_active"` // defaults to true
+}
+
+// UpdateUserRequest changes the given fields of a user. Usernames of
+// accounts from an identity provider come from the provider and cannot be
+// changed.
+type UpdateUserRequest struct {
+	Username *string `json:"username" binding:"omitempty,min=1,max=255"`
+	Email    *string `json:"email" binding:"omitempty,max=255"`
+	IsAdmin  *bool   `json:"is_admin"`
+	IsActive *bool   `json:"is_active"`
+}
+
+type ResetPasswordRequest struct {
+	Password string `json:"password" binding:"required"`
+}
+
+// SessionInfo describes an active session without its token
+type SessionInfo struct {
+	ID        string    `json:"id"`
+	CreatedAt time.Time `json:"created_at"`
+	ExpiresAt time.Time `json:"expires_at"`
+	UserAgent *string   `json:"user_agent,omitempty"`
+	IPAddress *string   `json:"ip_address,omitempty"`
+	Current   bool      `json:"current"` // the session of the request
+}
@@ -0,0 +1,270 @@
+package pipeline
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"math"
+	"reflect"
+	"slices"
+	"time"
+
+	"github.com/sirupsen/logrus"
+)
+
+// configReloadInterval is how often a processor checks the pipeline_config
+// table for changes made by other replicas
+const configReloadInterval = 15 * time.Second
+
+// Validate checks that the configuration can be applied
+func (c *PipelineConfig) Validate() error {
+	var errs []error
+
+	if c.TotalCapacity < 1 || c.TotalCapacity > 100 {
+		errs = append(errs, fmt.Errorf("total_capacity must be between 1 and 100"))
+	}
+
+	if len(c.PriorityAllocation) > 0 {
+		sum := 0.0
+		for priority, share := range c.PriorityAllocation {
+			if priorityRank(priority) == len(allPriorities) {
+				errs = append(errs, fmt.Errorf("priority_allocation: unknown priority %q", priority))
+			}
+			if share < 0 || share > 1 {
+				errs = append(errs, fmt.Errorf("priority_allocation: share for %s must be between 0 and 1", priority))
+			}
+			sum += share
+		}
+		if math.Abs(sum-1) > 0.01 {
+			errs = append(errs, fmt.Errorf("priority_allocation shares must add up to 1, got %.2f", sum))
+		}
+	}
+
+	errs = append(errs, c.RetryPolicy.validate("retry_policy")...)
+	for opType, policy := range c.RetryPolicies {
+		errs = append(errs, policy.validate(fmt.Sprintf("retry_policies.%s", opType))...)
+	}
+
+	if c.DefaultTimeout < 1 {
+		errs = append(errs, fmt.Errorf("default_timeout must be at least 1 second"))
+	}
+	for opType, timeout := range c.OperationTimeouts {
+		if timeout < 1 {
+			errs = append(errs, fmt.Errorf("operation_timeouts: timeout for %s must be at least 1 second", opType))
+		}
+	}
+
+	if c.InstanceConcurrency < 0 {
+		errs = append(errs, fmt.Errorf("instance_concurrency must not be negative"))
+	}
+	if c.LeaseSeconds < 10 {
+		errs = append(errs, fmt.Errorf("lease_seconds must be at least 10"))
+	}
+
+	if c.PriorityAging.Enabled && c.PriorityAging.IntervalSeconds < 1 {
+		errs = append(errs, fmt.Errorf("priority_aging.interval_seconds must be at least 1"))
+	}
+
+	if c.FairShare.GroupBy != "" && c.FairShare.GroupBy != FairShareByCreator && c.FairShare.GroupBy != FairShareByCorrelation {
+		errs = append(errs, fmt.Errorf("fair_share.group_by must be %q or %q", FairShareByCreator, FairShareByCorrelation))
+	}
+	if c.FairShare.MaxInFlightPerGroup < 0 {
+		errs = append(errs, fmt.Errorf("fair_share.max_in_flight_per_group must not be negative"))
+	}
+
+	return errors.Join(errs...)
+}
+
+// validate checks a retry policy, naming its fields with the given prefix
+func (r RetryPolicy) validate(field string) []error {
+	var errs []error
+
+	if r.MaxAttempts < 0 {
+		errs = append(errs, fmt.Errorf("%s.max_attempts must not be negative", field))
+	}
+	if r.BackoffBaseSeconds < 1 {
+		errs = append(errs, fmt.Errorf("%s.backoff_base_seconds must be at least 1", field))
+	}
+	if r.BackoffMultiplier < 1 {
+		errs = append(errs, fmt.Errorf("%s.backoff_multiplier must be at least 1", field))
+	}
+	if r.BackoffMaxSeconds < r.BackoffBaseSeconds {
+		errs = append(errs, fmt.Errorf("%s.backoff_max_seconds must not be less than backoff_base_seconds", field))
+	}
+	if r.MaxRetryAfterSeconds < 0 {
+		errs = append(errs, fmt.Errorf("%s.max_retry_after_seconds must not be negative", field))
+	}
+	for _, class := range r.RetryOn {
+		if !slices.Contains(retryableErrorClasses, class) {
+			errs = append(errs, fmt.Errorf("%s.retry_on: %q cannot be retried", field, class))
+		}
+	}
+
+	return errs
+}
+
+// Clone returns a deep copy of the configuration
+func (c *PipelineConfig) Clone() *PipelineConfig {
+	clone := *c
+
+	clone.PriorityAllocation = make(map[Priority]float64, len(c.PriorityAllocation))
+	for k, v := range c.PriorityAllocation {
+		clone.PriorityAllocation[k] = v
+	}
+
+	clone.RetryPolicy.RetryOn = slices.Clone(c.RetryPolicy.RetryOn)
+	clone.RetryPolicies = make(map[OperationType]RetryPolicy, len(c.RetryPolicies))
+	for k, v := range c.RetryPolicies {
+		v.RetryOn = slices.Clone(v.RetryOn)
+		clone.RetryPolicies[k] = v
+	}
+
+	clone.OperationTimeouts = make(map[OperationType]int, len(c.OperationTimeouts))
+	for k, v := range c.OperationTimeouts {
+		clone.OperationTimeouts[k] = v
+	}
+
+	return &clone
+}
+
+// currentConfig returns the configuration in effect. The returned value must
+// not be modified; ApplyConfig replaces it as a whole.
+func (p *Processor) currentConfig() *PipelineConfig {
+	p.configMutex.RLock()
+	defer p.configMutex.RUnlock()
+	return p.config
+}
+
+// Config returns a copy of the configuration in effect
+func (p *Processor) Config() *PipelineConfig {
+	return p.currentConfig().Clone()
+}
+
+// WatchConfig makes the processor follow changes to the stored configuration,
+// including those made on other replicas. Call before Start.
+func (p *Processor) WatchConfig(store *Store) {
+	p.configStore = store
+}
+
+// ApplyConfig validates and applies a new configuration without a restart.
+// Timeouts, retry backoff and scheduling settings take effect with the next
+// operation; worker counts are adjusted immediately, with surplus workers
+// finishing their current operation before they exit.
+func (p *Processor) ApplyConfig(config *PipelineConfig) error {
+	if err := config.Validate(); err != nil {
+		return err
+	}
+	config = config.Clone()
+
+	p.configMutex.Lock()
+	previous := p.config
+	p.config = config
+	p.configMutex.Unlock()
+
+	if reflect.DeepEqual(previous, config) {
+		return nil
+	}
+
+	allocation := calculateWorkerAllocation(config)
+	p.logger.WithFields(logrus.Fields{
+		"total_capacity":       config.TotalCapacity,
+		"worker_allocation":    allocation,
+		"instance_concurrency": config.InstanceConcurrency,
+	}).Info("Applied pipeline configuration")
+
+	// Workers are only managed once the processor is running
+	if p.ctx != nil && p.ctx.Err() == nil {
+		p.resizeWorkers(allocation)
+	}
+
+	return nil
+}
+
+// resizeWorkers starts or retires workers so that each priority lane has the
+// allocated number
+func (p *Processor) resizeWorkers(allocation map[Priority]int) {
+	p.workersMutex.Lock()
+	defer p.workersMutex.Unlock()
+
+	// Stop() may have started waiting for the workers already
+	if p.ctx.Err() != nil {
+		return
+	}
+
+	for _, priority := range allPriorities {
+		workers := p.workers[priority]
+		want := allocation[priority]
+
+		for len(workers) < want {
+			w := &worker{
+				id:       p.nextWorkerID,
+				priority: priority,
+				proc:     p,
+				retire:   make(chan struct{}),
+			}
+			p.nextWorkerID++
+			workers = append(workers, w)
+
+			p.wg.Add(1)
+			go w.run(p.ctx)
+		}
+
+		for len(workers) > want {
+			last := workers[len(workers)-1]
+			close(last.retire)
+			workers = workers[:len(workers)-1]
+		}
+
+		p.workers[priority] = workers
+	}
+}
+
+// workerCount returns the number of workers across all lanes
+func (p *Processor) workerCount() int {
+	p.workersMutex.Lock()
+	defer p.workersMutex.Unlock()
+
+	count := 0
+	for _, workers := range p.workers {
+		count += len(workers)
+	}
+	return count
+}
+
+// watchConfig periodically reloads the stored configuration
+func (p *Processor) watchConfig() {
+	defer p.wg.Done()
+
+	ticker := time.NewTicker(configReloadInterval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-p.ctx.Done():
+			return
+		case <-ticker.C:
+			p.reloadConfig()
+		}
+	}
+}
+
+// reloadConfig applies the stored configuration if it differs from the
+// configuration in effect
+func (p *Processor) reloadConfig() {
+	stored, err := p.configStore.GetPipelineConfig(p.ctx)
+	if err != nil {
+		p.logger.WithError(err).Warn("Failed to reload pipeline configuration")
+		return
+	}
+
+	// Compare the serialized forms, which is what is actually stored
+	current, _ := json.Marshal(p.currentConfig())
+	updated, _ := json.Marshal(stored)
+	if string(current) == string(updated) {
+		return
+	}
+
+	if err := p.ApplyConfig(stored); err != nil {
+		p.logger.WithError(err).Error("Stored pipeline configuration is invalid, keeping the current one")
+	}
+}
@@ -0,0 +1,147 @@
+package pipeline
+
+import (
+	"context"
+	"errors"
+	"io"
+	"net"
+	"net/http"
+	"time"
+
+	"github.com/orca-ng/orca/internal/cyberark"
+)
+
+// ErrorClass groups operation errors by how they should be retried
+type ErrorClass string
+
+const (
+	// ErrorClassTransient is a temporary server-side failure (5xx, 408)
+	ErrorClassTransient ErrorClass = "transient"
+	// ErrorClassRateLimited is an HTTP 429, possibly with a Retry-After delay
+	ErrorClassRateLimited ErrorClass = "rate_limited"
+	// ErrorClassNetwork is a connection failure before a response arrived
+	ErrorClassNetwork ErrorClass = "network"
+	// ErrorClassTimeout is a request or operation that ran out of time
+	ErrorClassTimeout ErrorClass = "timeout"
+	// ErrorClassAuthExpired is a session token rejected by the vault
+	ErrorClassAuthExpired ErrorClass = "auth_expired"
+	// ErrorClassPermanent is a failure that will not go away by retrying
+	ErrorClassPermanent ErrorClass = "permanent"
+	// ErrorClassUnknown is an error without type information; the handler's
+	// CanRetry decides
+	ErrorClassUnknown ErrorClass = "unknown"
+)
+
+// retryableErrorClasses are the classes a policy may list in retry_on
+var retryableErrorClasses = []ErrorClass{
+	ErrorClassTransient,
+	ErrorClassRateLimited,
+	ErrorClassNetwork,
+	ErrorClassTimeout,
+	ErrorClassAuthExpired,
+}
+
+// defaultRetryOn is used by policies that do not list their own classes
+var defaultRetryOn = []ErrorClass{
+	ErrorClassTransient,
+	ErrorClassRateLimited,
+	ErrorClassNetwork,
+	ErrorClassTimeout,
+}
+
+// classifiedError lets a handler state the class of an error explicitly
+type classifiedError struct {
+	class ErrorClass
+	err   error
+}
+
+func (e *classifiedError) Error() string { return e.err.Error() }
+func (e *classifiedError) Unwrap() error { return e.err }
+
+// Permanent marks an error as not worth retrying, whatever its cause
+func Permanent(err error) error {
+	if err == nil {
+		return nil
+	}
+	return &classifiedError{class: ErrorClassPermanent, err: err}
+}
+
+// Transient marks an error as temporary so the retry policy applies to it
+func Transient(err error) error {
+	if err == nil {
+		return nil
+	}
+	return &classifiedError{class: ErrorClassTransient, err: err}
+}
+
+// ClassifyError determines the class of an error from its type. For rate
+// limited errors it also returns the delay the server asked for, if any.
+func ClassifyError(err error) (ErrorClass, time.Duration) {
+	if err == nil {
+		return ErrorClassUnknown, 0
+	}
+
+	var classified *classifiedError
+	if errors.As(err, &classified) {
+		return classified.class, 0
+	}
+
+	var apiErr *cyberark.APIError
+	if errors.As(err, &apiErr) {
+		return classifyAPIError(apiErr), apiErr.RetryAfter
+	}
+
+	if errors.Is(err, cyberark.ErrNotAuthenticated) {
+		return ErrorClassAuthExpired, 0
+	}
+
+	// Nobody is there to answer a RADIUS challenge
+	if errors.Is(err, cyberark.ErrChallengeRequired) {
+		return ErrorClassPermanent, 0
+	}
+
+	if errors.Is(err, context.DeadlineExceeded) {
+		return ErrorClassTimeout, 0
+	}
+
+	var netErr net.Error
+	if errors.As(err, &netErr) {
+		if netErr.Timeout() {
+			return ErrorClassTimeout, 0
+		}
+		return ErrorClassNetwork, 0
+	}
+
+	// The server closed the connection mid-response
+	if errors.Is(err, io.ErrUnexpectedEOF) || errors.Is(err, io.EOF) {
+		return ErrorClassNetwork, 0
+	}
+
+	return ErrorClassUnknown, 0
+}
+
+// classifyAPIError maps a PVWA error response to an error class
+func classifyAPIError(apiErr *cyberark.APIError) ErrorClass {
+	switch {
+	case apiErr.Status == http.StatusTooManyRequests:
+		return ErrorClassRateLimited
+	case apiErr.TokenExpired():
+		return ErrorClassAuthExpired
+	case apiErr.Retryable():
+		return ErrorClassTransient
+	default:
+		return ErrorClassPermanent
+	}
+}
+
+// IsRetryable reports whether an error belongs to one of the classes retried
+// by default. Handlers can use it in their CanRetry implementation.
+func IsRetryable(err error) bool {
+	class, _ := ClassifyError(err)
+	for _, c := range defaultRetryOn {
+		if c == class {
+			return true
+		}
+	}
+	return false
+}
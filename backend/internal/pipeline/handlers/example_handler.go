@@ -58,48 +58,10 @@ func (h *ExampleHandler) Handle(ctx context.Context, op *pipeline.Operation) err
 	return nil
 }
 
-// CanRetry determines if the error is retryable
+// CanRetry determines if the error is retryable. Errors returned by the
+// CyberArk client and the network are classified by the pipeline's retry
+// policy; this is only asked about errors without a class. Wrap errors in
+// pipeline.Transient or pipeline.Permanent to classify them explicitly.
 func (h *ExampleHandler) CanRetry(err error) bool {
-	// Define which errors are retryable
-	// For example: network errors, temporary failures, etc.
-	
-	// Check for specific error types
-	if err == nil {
-		return false
-	}
-	
-	errMsg := err.Error()
-	
-	// Retry on network/connection errors
-	if contains(errMsg, []string{
-		"connection refused",
-		"timeout",
-		"temporary failure",
-		"service unavailable",
-	}) {
-		return true
-	}
-	
-	// Don't retry on authentication or authorization errors
-	if contains(errMsg, []string{
-		"unauthorized",
-		"forbidden",
-		"invalid credentials",
-		"authentication failed",
-	}) {
-		return false
-	}
-	
-	// Default to not retrying
-	return false
+	return pipeline.IsRetryable(err)
 }
-
-// contains checks if the string contains any of the substrings
-func contains(s string, substrs []string) bool {
-	for _, substr := range substrs {
-		if len(s) >= len(substr) && s[len(s)-len(substr):] == substr {
-			return true
-		}
-	}
-	return false
-}
\ No newline at end of file
@@ -4,7 +4,6 @@ import (
 	"context"
 	"encoding/json"
 	"fmt"
-	"net/http"
 	"time"
 
 	"github.com/orca-ng/orca/internal/pipeline"
@@ -96,29 +95,9 @@ func (h *SafeProvisionHandler) Handle(ctx context.Context, op *pipeline.Operatio
 
 // CanRetry determines if an error is retryable
 func (h *SafeProvisionHandler) CanRetry(err error) bool {
-	// In real implementation, check for:
-	// - Network errors
-	// - Timeout errors
-	// - HTTP 429 (rate limit)
-	// - HTTP 503 (service unavailable)
-	// - Specific CyberArk temporary errors
-	
-	// For now, just check if it's a timeout
-	if err == context.DeadlineExceeded {
-		return true
-	}
-	
-	// Check for specific HTTP status codes
-	if httpErr, ok := err.(interface{ StatusCode() int }); ok {
-		switch httpErr.StatusCode() {
-		case http.StatusTooManyRequests,
-		     http.StatusServiceUnavailable,
-		     http.StatusGatewayTimeout:
-			return true
-		}
-	}
-	
-	return false
+	// Timeouts, rate limiting and unavailable servers are classified by the
+	// retry policy already
+	return pipeline.IsRetryable(err)
 }
 
 // ValidatePayload validates the operation payload
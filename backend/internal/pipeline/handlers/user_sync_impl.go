@@ -104,6 +104,21 @@ func (h *UserSyncHandler) Handle(ctx context.Context, op *pipeline.Operation) er
 			return fmt.Errorf("decrypt password: %w", err)
 		}
 
+		clientCert, err := services.NewCertificateService().LoadClientCertificate(instance.ClientCertificate, instance.ClientKeyEncrypted, h.encryptor)
+		if err != nil {
+			h.updateInstanceSyncStatus(&instance, "failed", err)
+			return fmt.Errorf("load client certificate: %w", err)
+		}
+		var trustedCAIDs []string
+		if h.certManager != nil {
+			tlsOptions, err := h.certManager.InstanceTLSOptions(ctx, &instance, clientCert)
+			if err != nil {
+				h.updateInstanceSyncStatus(&instance, "failed", err)
+				return fmt.Errorf("load trusted certificate authorities: %w", err)
+			}
+			trustedCAIDs = tlsOptions.TrustedCAIDs
+		}
+
 		client, err = cyberark.NewClient(cyberark.Config{
 			BaseURL:        instance.BaseURL,
 			Username:       instance.Username,
@@ -111,6 +126,15 @@ func (h *UserSyncHandler) Handle(ctx context.Context, op *pipeline.Operation) er
 			SkipTLSVerify:  instance.SkipTLSVerify,
 			RequestTimeout: 30 * time.Second,
 			CertManager:    h.certManager,
+			ClientCertificate: clientCert,
+			TrustedCAIDs:      trustedCAIDs,
+			Pins:              instance.PinnedCertificates,
+			Logon: cyberark.LogonOptions{
+				Method:            cyberark.AuthMethod(instance.AuthMethod),
+				ConcurrentSession: instance.ConcurrentSessions,
+			},
+			Type:        cyberark.InstanceType(instance.InstanceType),
+			IdentityURL: instance.IdentityURL,
 		})
 		if err != nil {
 			h.updateInstanceSyncStatus(&instance, "failed", err)
@@ -208,15 +232,6 @@ func (h *UserSyncHandler) syncUsers(ctx context.Context, client *cyberark.Client
 				return result, err
 			}
 			
-			// Handle token expiration mid-sync
-			if h.isAuthError(err) {
-				h.logger.Info("Token expired during sync, attempting to re-authenticate")
-				if _, authErr := client.AuthenticateWithContext(ctx); authErr != nil {
-					result.Errors = append(result.Errors, fmt.Sprintf("Failed to re-authenticate: %v", authErr))
-					return result, authErr
-				}
-			}
-			
 			// Wait before retry
 			waitTime := time.Duration(attempt+1) * time.Second
 			h.logger.WithField("wait_seconds", waitTime.Seconds()).Debug("Waiting before retry")
@@ -469,23 +484,11 @@ func (h *UserSyncHandler) updateInstanceSyncStatus(instance *gormmodels.CyberArk
 	}
 }
 
-// CanRetry determines if an error is retryable
+// CanRetry determines if an error is retryable. Typed errors are handled
+// by the retry policy before this is consulted, so untyped errors such as
+// database failures are not retried.
 func (h *UserSyncHandler) CanRetry(err error) bool {
-	// Retry on network errors or temporary failures
-	// Don't retry on authentication errors or permission issues
-	errMsg := err.Error()
-	
-	// Don't retry authentication errors
-	if containsSubstring(errMsg, "authentication", "unauthorized", "forbidden", "permission") {
-		return false
-	}
-	
-	// Retry network and temporary errors
-	if containsSubstring(errMsg, "timeout", "connection", "network", "temporary") {
-		return true
-	}
-	
-	return false
+	return pipeline.IsRetryable(err)
 }
 
 // processUserGroupMemberships processes the group memberships for a user
@@ -665,38 +668,8 @@ func (h *UserSyncHandler) ValidatePayload(payload json.RawMessage) error {
 	return nil
 }
 
-// Helper function - checks if string contains any of the substrings
-func containsSubstring(s string, substrs ...string) bool {
-	s = strings.ToLower(s)
-	for _, substr := range substrs {
-		if strings.Contains(s, strings.ToLower(substr)) {
-			return true
-		}
-	}
-	return false
-}
-
-// isRetryableError checks if an error is retryable
+// isRetryableError checks if a failed page request is worth repeating.
+// Expired tokens are renewed by the client itself.
 func (h *UserSyncHandler) isRetryableError(err error) bool {
-	if err == nil {
-		return false
-	}
-	
-	errMsg := err.Error()
-	
-	// Don't retry client errors (4xx)
-	if containsSubstring(errMsg, "400", "401", "403", "404") {
-		return false
-	}
-	
-	// Retry server errors and network issues
-	return containsSubstring(errMsg, "500", "502", "503", "504", "timeout", "connection", "network")
+	return pipeline.IsRetryable(err)
 }
-
-// isAuthError checks if an error is an authentication error
-func (h *UserSyncHandler) isAuthError(err error) bool {
-	if err == nil {
-		return false
-	}
-	return containsSubstring(err.Error(), "401", "unauthorized", "authentication", "token expired")
-}
\ No newline at end of file
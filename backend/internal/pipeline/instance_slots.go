@@ -0,0 +1,59 @@
+package pipeline
+
+import (
+	"sync"
+)
+
+// instanceSlots tracks how many operations this processor has in flight per
+// CyberArk instance. The per-instance limits are enforced across replicas
+// when operations are claimed, see saturatedInstances.
+type instanceSlots struct {
+	mu     sync.Mutex
+	counts map[string]int
+}
+
+func newInstanceSlots() *instanceSlots {
+	return &instanceSlots{
+		counts: make(map[string]int),
+	}
+}
+
+// acquire records an operation in flight for the instance
+func (s *instanceSlots) acquire(instanceID string) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	s.counts[instanceID]++
+}
+
+// release forgets an operation recorded with acquire
+func (s *instanceSlots) release(instanceID string) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if s.counts[instanceID] <= 1 {
+		delete(s.counts, instanceID)
+		return
+	}
+	s.counts[instanceID]--
+}
+
+// active returns the number of operations in flight for the instance
+func (s *instanceSlots) active(instanceID string) int {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	return s.counts[instanceID]
+}
+
+// snapshot returns a copy of the in-flight counts per instance
+func (s *instanceSlots) snapshot() map[string]int {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	counts := make(map[string]int, len(s.counts))
+	for id, count := range s.counts {
+		counts[id] = count
+	}
+	return counts
+}
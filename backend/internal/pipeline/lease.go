@@ -0,0 +1,148 @@
+package pipeline
+
+import (
+	"context"
+	"fmt"
+	"time"
+
+	"github.com/sirupsen/logrus"
+
+	gormmodels "github.com/orca-ng/orca/internal/models/gorm"
+)
+
+// expiredLease matches processing operations whose lease has run out. Rows
+// claimed before leases existed have no expiry and fall back to started_at.
+const expiredLease = "(lease_expires_at < ? OR (lease_expires_at IS NULL AND (started_at IS NULL OR started_at < ?)))"
+
+// leaseDuration returns how long a claim is valid without a heartbeat
+func (p *Processor) leaseDuration() time.Duration {
+	if seconds := p.currentConfig().LeaseSeconds; seconds > 0 {
+		return time.Duration(seconds) * time.Second
+	}
+	return 60 * time.Second
+}
+
+// heartbeat extends the lease on an operation until ctx is done. If the lease
+// can no longer be renewed - the operation was cancelled or reclaimed by
+// another processor - lost is called so the handler can be stopped.
+func (p *Processor) heartbeat(ctx context.Context, opID string, lost func()) {
+	for {
+		// The lease duration is read on every beat to follow configuration
+		// changes
+		select {
+		case <-ctx.Done():
+			return
+		case <-time.After(p.leaseDuration() / 3):
+			res := p.db.Model(&gormmodels.Operation{}).
+				Where("id = ? AND status = ? AND locked_by = ?", opID, gormmodels.OpStatusProcessing, p.id).
+				Update("lease_expires_at", time.Now().Add(p.leaseDuration()))
+			if res.Error != nil {
+				// Keep trying; the lease only lapses if the database stays
+				// unreachable for longer than the lease duration
+				p.logger.WithError(res.Error).WithField("operation_id", opID).Warn("Failed to renew operation lease")
+				continue
+			}
+			if res.RowsAffected == 0 {
+				p.logger.WithField("operation_id", opID).Warn("Lost lease on operation, stopping")
+				lost()
+				return
+			}
+		}
+	}
+}
+
+// reapExpiredLeases periodically recovers operations whose lease has expired
+func (p *Processor) reapExpiredLeases() {
+	defer p.wg.Done()
+
+	// Recover anything left behind by a crashed processor straight away
+	p.recoverExpiredLeases()
+
+	for {
+		// The lease duration is read on every round to follow configuration
+		// changes
+		select {
+		case <-p.ctx.Done():
+			return
+		case <-time.After(p.leaseDuration()):
+			p.recoverExpiredLeases()
+		}
+	}
+}
+
+// recoverExpiredLeases returns operations with an expired lease to pending,
+// counting the interrupted run as an attempt, or fails them once their
+// retries are used up. Each row is updated conditionally, so when several
+// replicas reap at the same time only one of them wins.
+func (p *Processor) recoverExpiredLeases() {
+	// Reaping is safe on every replica, but one is enough
+	if !p.isLeader() {
+		return
+	}
+
+	now := time.Now()
+
+	var expired []gormmodels.Operation
+	err := p.db.Where("status = ?", gormmodels.OpStatusProcessing).
+		Where(expiredLease, now, now.Add(-p.leaseDuration())).
+		Find(&expired).Error
+	if err != nil {
+		p.logger.WithError(err).Error("Failed to query expired operation leases")
+		return
+	}
+
+	for i := range expired {
+		op := &expired[i]
+
+		lockedBy := "unknown processor"
+		if op.LockedBy != nil {
+			lockedBy = *op.LockedBy
+		}
+		errMsg := fmt.Sprintf("lease held by %s expired before the operation finished", lockedBy)
+
+		updates := map[string]interface{}{
+			"locked_by":        nil,
+			"lease_expires_at": nil,
+			"error_message":    errMsg,
+		}
+		// An interrupted run counts as an attempt, limited by the same
+		// retry policy as a failed one
+		policy := p.currentConfig().RetryPolicyFor(OperationType(op.Type))
+		if !policy.Exhausted(op.RetryCount, op.MaxRetries) {
+			updates["status"] = gormmodels.OpStatusPending
+			updates["retry_count"] = op.RetryCount + 1
+			updates["scheduled_at"] = now
+			updates["started_at"] = nil
+		} else {
+			updates["status"] = gormmodels.OpStatusFailed
+			updates["completed_at"] = now
+		}
+
+		// Only touch the row if its lease is still expired; a renewal or a
+		// competing reaper makes this a no-op
+		query := p.db.Model(&gormmodels.Operation{}).
+			Where("id = ? AND status = ?", op.ID, gormmodels.OpStatusProcessing).
+			Where(expiredLease, now, now.Add(-p.leaseDuration()))
+
+		res := query.Updates(updates)
+		if res.Error != nil {
+			p.logger.WithError(res.Error).WithField("operation_id", op.ID).Error("Failed to recover expired operation")
+			continue
+		}
+		if res.RowsAffected == 0 {
+			continue
+		}
+
+		p.logger.WithFields(logrus.Fields{
+			"operation_id": op.ID,
+			"locked_by":    lockedBy,
+			"status":       updates["status"],
+		}).Warn("Recovered operation with expired lease")
+
+		// Reload so subscribers see the current state
+		var updated gormmodels.Operation
+		if p.events != nil && p.db.First(&updated, "id = ?", op.ID).Error == nil {
+			p.events.PublishOperationUpdated(&updated)
+		}
+	}
+}
@@ -0,0 +1,162 @@
+package pipeline_test
+
+import (
+	"context"
+	"encoding/json"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/sirupsen/logrus"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/orca-ng/orca/internal/database"
+	gormmodels "github.com/orca-ng/orca/internal/models/gorm"
+	"github.com/orca-ng/orca/internal/pipeline"
+	"github.com/orca-ng/orca/internal/services"
+)
+
+// createLeasedOperation stores an operation claimed by another processor
+// whose lease runs out at leaseExpiresAt
+func createLeasedOperation(t *testing.T, db *database.GormDB, leaseExpiresAt time.Time) *gormmodels.Operation {
+	lockedBy := "crashed-replica"
+	startedAt := time.Now().Add(-time.Hour)
+	op := &gormmodels.Operation{
+		Type:           string(pipeline.OpTypeUserSync),
+		Priority:       gormmodels.OpPriorityNormal,
+		Status:         gormmodels.OpStatusProcessing,
+		Payload:        json.RawMessage(`{}`),
+		ScheduledAt:    startedAt,
+		StartedAt:      &startedAt,
+		LockedBy:       &lockedBy,
+		LeaseExpiresAt: &leaseExpiresAt,
+	}
+	require.NoError(t, db.Create(op).Error)
+	return op
+}
+
+// startReaper starts a processor that reaps leases and runs user syncs
+func startReaper(t *testing.T, db *database.GormDB, config *pipeline.PipelineConfig, leader *services.LeaderElector) (*pipeline.Processor, *countingHandler) {
+	logger := logrus.New()
+	logger.SetLevel(logrus.ErrorLevel)
+
+	if config == nil {
+		config = pipeline.DefaultPipelineConfig()
+	}
+	config.TotalCapacity = 1
+
+	ctx, cancel := context.WithCancel(context.Background())
+	t.Cleanup(cancel)
+
+	handler := &countingHandler{calls: make(map[string]int)}
+	proc := pipeline.NewProcessor(db, config, logger, nil, "test-key", nil)
+	proc.RegisterHandler(pipeline.OpTypeUserSync, handler)
+	if leader != nil {
+		proc.SetLeaderElector(leader)
+	}
+	require.NoError(t, proc.Start(ctx))
+	return proc, handler
+}
+
+func TestExpiredLeaseIsRequeued(t *testing.T) {
+	db := openReplicaDB(t, filepath.Join(t.TempDir(), "pipeline.db"))
+	op := createLeasedOperation(t, db, time.Now().Add(-time.Minute))
+
+	proc, handler := startReaper(t, db, nil, nil)
+
+	// The interrupted run counts as an attempt and the operation runs again
+	var stored gormmodels.Operation
+	require.Eventually(t, func() bool {
+		db.First(&stored, "id = ?", op.ID)
+		return stored.Status == gormmodels.OpStatusCompleted
+	}, 10*time.Second, 20*time.Millisecond)
+	require.NoError(t, proc.Stop())
+
+	assert.Equal(t, 1, stored.RetryCount)
+	assert.Nil(t, stored.LockedBy)
+	handler.mu.Lock()
+	defer handler.mu.Unlock()
+	assert.Equal(t, 1, handler.calls[op.ID])
+}
+
+func TestRenewedLeaseIsLeftAlone(t *testing.T) {
+	db := openReplicaDB(t, filepath.Join(t.TempDir(), "pipeline.db"))
+	// Started long ago, but its processor keeps renewing the lease
+	op := createLeasedOperation(t, db, time.Now().Add(time.Minute))
+
+	proc, handler := startReaper(t, db, nil, nil)
+	time.Sleep(500 * time.Millisecond)
+	require.NoError(t, proc.Stop())
+
+	var stored gormmodels.Operation
+	require.NoError(t, db.First(&stored, "id = ?", op.ID).Error)
+	assert.Equal(t, gormmodels.OpStatusProcessing, stored.Status)
+	require.NotNil(t, stored.LockedBy)
+	assert.Equal(t, "crashed-replica", *stored.LockedBy)
+	assert.Zero(t, stored.RetryCount)
+	assert.Empty(t, handler.calls)
+}
+
+func TestNonLeaderDoesNotReap(t *testing.T) {
+	db := openReplicaDB(t, filepath.Join(t.TempDir(), "pipeline.db"))
+	op := createLeasedOperation(t, db, time.Now().Add(-time.Minute))
+
+	// An elector that never campaigns, as on a replica that lost the election
+	follower := services.NewLeaderElector(db, logrus.New(), "pipeline", "follower", time.Minute)
+	proc, _ := startReaper(t, db, nil, follower)
+	time.Sleep(500 * time.Millisecond)
+	require.NoError(t, proc.Stop())
+
+	var stored gormmodels.Operation
+	require.NoError(t, db.First(&stored, "id = ?", op.ID).Error)
+	assert.Equal(t, gormmodels.OpStatusProcessing, stored.Status)
+	assert.Zero(t, stored.RetryCount)
+}
+
+func TestExpiredLeaseFollowsRetryPolicy(t *testing.T) {
+	db := openReplicaDB(t, filepath.Join(t.TempDir(), "pipeline.db"))
+	// The operation allows retries, but the policy does not
+	op := createLeasedOperation(t, db, time.Now().Add(-time.Minute))
+	require.NoError(t, db.Model(op).Update("max_retries", 3).Error)
+
+	config := pipeline.DefaultPipelineConfig()
+	policy := config.RetryPolicy
+	policy.MaxAttempts = 0
+	config.RetryPolicies = map[pipeline.OperationType]pipeline.RetryPolicy{
+		pipeline.OpTypeUserSync: policy,
+	}
+
+	proc, handler := startReaper(t, db, config, nil)
+
+	var stored gormmodels.Operation
+	require.Eventually(t, func() bool {
+		db.First(&stored, "id = ?", op.ID)
+		return stored.Status == gormmodels.OpStatusFailed
+	}, 10*time.Second, 20*time.Millisecond)
+	require.NoError(t, proc.Stop())
+
+	assert.Zero(t, stored.RetryCount)
+	assert.NotNil(t, stored.CompletedAt)
+	assert.Empty(t, handler.calls)
+}
+
+func TestExpiredLeaseFollowsOperationLimit(t *testing.T) {
+	db := openReplicaDB(t, filepath.Join(t.TempDir(), "pipeline.db"))
+	// The policy allows more retries than the operation's own limit
+	op := createLeasedOperation(t, db, time.Now().Add(-time.Minute))
+	require.NoError(t, db.Model(op).Updates(map[string]interface{}{"retry_count": 1, "max_retries": 1}).Error)
+
+	proc, handler := startReaper(t, db, nil, nil)
+
+	var stored gormmodels.Operation
+	require.Eventually(t, func() bool {
+		db.First(&stored, "id = ?", op.ID)
+		return stored.Status == gormmodels.OpStatusFailed
+	}, 10*time.Second, 20*time.Millisecond)
+	require.NoError(t, proc.Stop())
+
+	assert.Equal(t, 1, stored.RetryCount)
+	assert.Equal(t, 1, stored.MaxRetries)
+	assert.Empty(t, handler.calls)
+}
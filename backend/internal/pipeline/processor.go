@@ -6,35 +6,69 @@ import (
 	"errors"
 	"fmt"
 	"math"
-	"math/rand"
 	"sync"
 	"sync/atomic"
 	"time"
 
 	"github.com/sirupsen/logrus"
 	"gorm.io/gorm"
-	
+
+	"github.com/orca-ng/orca/internal/crypto"
+	"github.com/orca-ng/orca/internal/cyberark"
 	"github.com/orca-ng/orca/internal/database"
 	gormmodels "github.com/orca-ng/orca/internal/models/gorm"
+	"github.com/orca-ng/orca/internal/services"
 )
 
-// Processor manages the processing pipeline with priority lanes using GORM
+// pollInterval is how long an idle worker waits before looking for work again
+const pollInterval = time.Second
+
+// allPriorities lists the priority lanes from most to least urgent
+var allPriorities = []Priority{PriorityHigh, PriorityNormal, PriorityLow}
+
+// Processor runs a pool of workers that claim operations from the database.
+// Workers are assigned to priority lanes according to PipelineConfig.PriorityAllocation
+// and fall back to other lanes when their own lane is empty. Operations for the
+// same CyberArk instance share one authenticated session, and the number of
+// operations in flight per instance is limited so that a long sync on one vault
+// does not hold up work on the others.
 type Processor struct {
+	id              string // identifies this processor in operation leases
 	db              *database.GormDB
-	config          *PipelineConfig
+	config          *PipelineConfig // replaced wholesale by ApplyConfig
+	configMutex     sync.RWMutex
+	configStore     *Store
 	handlers        map[OperationType]OperationHandler
 	logger          *logrus.Logger
-	
+	certManager     *services.CertificateManager
+	encryptor       *crypto.Encryptor
+	events          *services.OperationEventService
+	leader          *services.LeaderElector
+
 	// Worker management
-	workers         []*worker
+	workers         map[Priority][]*worker
+	workersMutex    sync.Mutex
+	nextWorkerID    int
 	ctx             context.Context
 	cancel          context.CancelFunc
 	wg              sync.WaitGroup
-	
+
+	// Claiming is serialized within the process so that instance slot
+	// accounting stays consistent with what has been claimed
+	claimMutex      sync.Mutex
+	slots           *instanceSlots
+	lastServed      map[string]time.Time // fair-share group -> last claim
+
+	// CyberArk session management
+	sessions      map[string]*cyberArkSession // instanceID -> session
+	sessionLocks  map[string]*sync.Mutex      // instanceID -> lock serializing logons
+	sessionsMutex sync.RWMutex
+	guards        *cyberark.GuardRegistry // rate limits and circuit breakers per instance
+
 	// Metrics
 	activeWorkers   int32
 	processedOps    map[OperationType]*int64
-	metricsLock     sync.RWMutex
+	failedOps       map[OperationType]*int64
 }
 
 // worker represents a processing unit assigned to a priority lane
@@ -42,26 +76,40 @@ type worker struct {
 	id       int
 	priority Priority
 	proc     *Processor
+	retire   chan struct{} // closed to stop the worker after its current operation
 }
 
-// NewProcessor creates a new pipeline processor using GORM
-func NewProcessor(db *database.GormDB, config *PipelineConfig, logger *logrus.Logger) *Processor {
+// NewProcessor creates a new pipeline processor
+func NewProcessor(db *database.GormDB, config *PipelineConfig, logger *logrus.Logger, certManager *services.CertificateManager, encryptionKey string, events *services.OperationEventService) *Processor {
 	processedOps := make(map[OperationType]*int64)
+	failedOps := make(map[OperationType]*int64)
 	for _, opType := range []OperationType{
 		OpTypeSafeProvision, OpTypeSafeModify, OpTypeSafeDelete,
 		OpTypeAccessGrant, OpTypeAccessRevoke,
 		OpTypeUserSync, OpTypeSafeSync, OpTypeGroupSync,
 	} {
-		var count int64
-		processedOps[opType] = &count
+		var processed, failed int64
+		processedOps[opType] = &processed
+		failedOps[opType] = &failed
 	}
-	
+
 	return &Processor{
+		id:           services.NewReplicaID(),
 		db:           db,
 		config:       config,
 		handlers:     make(map[OperationType]OperationHandler),
+		workers:      make(map[Priority][]*worker),
 		logger:       logger,
+		certManager:  certManager,
+		encryptor:    crypto.NewEncryptor(encryptionKey),
+		events:       events,
+		slots:        newInstanceSlots(),
+		lastServed:   make(map[string]time.Time),
+		sessions:     make(map[string]*cyberArkSession),
+		sessionLocks: make(map[string]*sync.Mutex),
+		guards:       cyberark.NewGuardRegistry(),
 		processedOps: processedOps,
+		failedOps:    failedOps,
 	}
 }
 
@@ -70,59 +118,87 @@ func (p *Processor) RegisterHandler(opType OperationType, handler OperationHandl
 	p.handlers[opType] = handler
 }
 
+// Guards returns the rate limits and circuit breakers of the CyberArk
+// instances this processor talks to
+func (p *Processor) Guards() *cyberark.GuardRegistry {
+	return p.guards
+}
+
+// SetLeaderElector restricts the lease reaper and metrics logging to the
+// elected replica. Without an elector every processor runs them.
+func (p *Processor) SetLeaderElector(leader *services.LeaderElector) {
+	p.leader = leader
+}
+
+// isLeader reports whether this processor should run singleton tasks
+func (p *Processor) isLeader() bool {
+	return p.leader == nil || p.leader.IsLeader()
+}
+
 // Start begins processing operations
 func (p *Processor) Start(ctx context.Context) error {
+	config := p.currentConfig()
+	if err := config.Validate(); err != nil {
+		return fmt.Errorf("invalid pipeline configuration: %w", err)
+	}
+
 	p.ctx, p.cancel = context.WithCancel(ctx)
-	
+
 	// Calculate worker allocation based on priority percentages
-	workerAllocation := p.calculateWorkerAllocation()
-	
+	workerAllocation := calculateWorkerAllocation(config)
+
 	p.logger.WithFields(logrus.Fields{
-		"total_capacity":    p.config.TotalCapacity,
-		"worker_allocation": workerAllocation,
+		"total_capacity":       config.TotalCapacity,
+		"worker_allocation":    workerAllocation,
+		"instance_concurrency": config.InstanceConcurrency,
+		"processor_id":         p.id,
 	}).Info("Starting processing pipeline")
-	
+
 	// Create workers for each priority lane
-	workerID := 0
-	for priority, count := range workerAllocation {
-		for i := 0; i < count; i++ {
-			w := &worker{
-				id:       workerID,
-				priority: priority,
-				proc:     p,
-			}
-			p.workers = append(p.workers, w)
-			
-			p.wg.Add(1)
-			go w.run(p.ctx)
-			
-			workerID++
-		}
+	p.resizeWorkers(workerAllocation)
+
+	// Follow configuration changes made through the API or other replicas
+	if p.configStore != nil {
+		p.wg.Add(1)
+		go p.watchConfig()
 	}
-	
+
+	// Start lease reaper to recover operations from crashed processors
+	p.wg.Add(1)
+	go p.reapExpiredLeases()
+
+	// Start session cleanup routine
+	p.wg.Add(1)
+	go p.cleanupSessions()
+
 	// Start metrics collector
 	p.wg.Add(1)
 	go p.collectMetrics(p.ctx)
-	
+
 	return nil
 }
 
 // Stop gracefully shuts down the processor
 func (p *Processor) Stop() error {
 	p.logger.Info("Stopping processing pipeline")
-	
-	// Signal all workers to stop
+
+	// Signal all workers to stop. Holding workersMutex keeps a concurrent
+	// ApplyConfig from starting new workers while we wait.
+	p.workersMutex.Lock()
 	p.cancel()
-	
+	p.workersMutex.Unlock()
+
 	// Wait for all workers to finish with timeout
 	done := make(chan struct{})
 	go func() {
 		p.wg.Wait()
 		close(done)
 	}()
-	
+
 	select {
 	case <-done:
+		// Clean up all sessions
+		p.closeAllSessions()
 		p.logger.Info("Processing pipeline stopped successfully")
 		return nil
 	case <-time.After(30 * time.Second):
@@ -131,153 +207,340 @@ func (p *Processor) Stop() error {
 }
 
 // calculateWorkerAllocation determines how many workers per priority
-func (p *Processor) calculateWorkerAllocation() map[Priority]int {
+func calculateWorkerAllocation(config *PipelineConfig) map[Priority]int {
 	allocation := make(map[Priority]int)
-	
-	for priority, percentage := range p.config.PriorityAllocation {
-		count := int(math.Round(float64(p.config.TotalCapacity) * percentage))
+
+	// Without an allocation every worker starts in the high lane and
+	// falls through to the lower lanes when it is empty
+	if len(config.PriorityAllocation) == 0 {
+		allocation[PriorityHigh] = config.TotalCapacity
+		return allocation
+	}
+
+	for priority, percentage := range config.PriorityAllocation {
+		count := int(math.Round(float64(config.TotalCapacity) * percentage))
 		if count < 1 && percentage > 0 {
 			count = 1 // Ensure at least 1 worker if percentage > 0
 		}
 		allocation[priority] = count
 	}
-	
+
 	// Adjust for rounding errors
 	total := 0
 	for _, count := range allocation {
 		total += count
 	}
-	
-	if total < p.config.TotalCapacity && len(allocation) > 0 {
+
+	if total < config.TotalCapacity {
 		// Add remaining capacity to highest priority
-		allocation[PriorityHigh] += p.config.TotalCapacity - total
+		allocation[PriorityHigh] += config.TotalCapacity - total
 	}
-	
+
+	// Remove surplus created by the minimum of one worker per lane,
+	// taking from the lowest priority lanes first. With fewer workers than
+	// lanes, the lowest lanes are left to workers falling through to them.
+	for _, minimum := range []int{1, 0} {
+		for i := len(allPriorities) - 1; i >= 0 && total > config.TotalCapacity; i-- {
+			priority := allPriorities[i]
+			for allocation[priority] > minimum && total > config.TotalCapacity {
+				allocation[priority]--
+				total--
+			}
+		}
+	}
+
 	return allocation
 }
 
+// lanes returns the priorities this worker polls, its own lane first
+func (w *worker) lanes() []Priority {
+	lanes := []Priority{w.priority}
+	for _, priority := range allPriorities {
+		if priority != w.priority {
+			lanes = append(lanes, priority)
+		}
+	}
+	return lanes
+}
+
 // run is the main worker loop
 func (w *worker) run(ctx context.Context) {
 	defer w.proc.wg.Done()
-	
+
 	w.proc.logger.WithFields(logrus.Fields{
 		"worker_id": w.id,
 		"priority":  w.priority,
 	}).Debug("Worker started")
-	
+
 	for {
 		select {
 		case <-ctx.Done():
 			w.proc.logger.WithField("worker_id", w.id).Debug("Worker stopped")
 			return
+		case <-w.retire:
+			w.proc.logger.WithField("worker_id", w.id).Debug("Worker retired")
+			return
 		default:
-			// Try to fetch and process an operation
-			if err := w.processNext(ctx); err != nil {
-				if !errors.Is(err, gorm.ErrRecordNotFound) {
-					w.proc.logger.WithError(err).Error("Error processing operation")
-				}
-				// Back off a bit if no work or error
-				time.Sleep(100 * time.Millisecond)
+		}
+
+		// Try to fetch and process an operation
+		if err := w.processNext(ctx); err != nil {
+			if !errors.Is(err, gorm.ErrRecordNotFound) {
+				w.proc.logger.WithError(err).Error("Error processing operation")
+			}
+
+			// Wait before checking for more work
+			select {
+			case <-ctx.Done():
+			case <-w.retire:
+			case <-time.After(pollInterval):
 			}
 		}
 	}
 }
 
-// processNext fetches and processes the next operation for this worker's priority
+// processNext claims and processes the next operation for this worker
 func (w *worker) processNext(ctx context.Context) error {
-	var op gormmodels.Operation
-	
-	// Use a transaction to fetch and lock an operation
-	err := w.proc.db.Transaction(func(tx *gorm.DB) error {
-		// Fetch next pending operation for this priority
-		// Using raw SQL for FOR UPDATE SKIP LOCKED as GORM doesn't have direct support
-		result := tx.Set("gorm:query_option", "FOR UPDATE SKIP LOCKED").
-			Where("status = ? AND priority = ? AND scheduled_at <= ?", 
-				gormmodels.OpStatusPending, w.priority, time.Now()).
-			Order("scheduled_at").
-			Limit(1).
-			First(&op)
-		
-		if result.Error != nil {
-			return result.Error
-		}
-		
-		// Mark as processing
-		now := time.Now()
-		updates := map[string]interface{}{
-			"status":     gormmodels.OpStatusProcessing,
-			"started_at": now,
-		}
-		
-		if err := tx.Model(&op).Updates(updates).Error; err != nil {
-			return fmt.Errorf("update operation status: %w", err)
-		}
-		
-		return nil
-	})
-	
+	op, err := w.proc.claimNext(w.lanes())
 	if err != nil {
 		return err
 	}
-	
+
+	if op.CyberArkInstanceID != nil {
+		defer w.proc.slots.release(*op.CyberArkInstanceID)
+	}
+
 	// Increment active workers count
 	atomic.AddInt32(&w.proc.activeWorkers, 1)
 	defer atomic.AddInt32(&w.proc.activeWorkers, -1)
-	
+
 	// Process the operation
 	w.proc.logger.WithFields(logrus.Fields{
 		"operation_id": op.ID,
-		"type":        op.Type,
-		"priority":    op.Priority,
-		"worker_id":   w.id,
+		"type":         op.Type,
+		"priority":     op.Priority,
+		"instance_id":  op.CyberArkInstanceID,
+		"worker_id":    w.id,
 	}).Info("Processing operation")
-	
-	// Convert GORM operation to pipeline Operation
-	pipelineOp := w.convertToOperation(&op)
-	
+
+	// Publish processing event
+	if w.proc.events != nil {
+		w.proc.events.PublishOperationUpdated(op)
+	}
+
+	// Keep the lease alive while the operation runs, and stop the handler
+	// if the lease is lost
+	runCtx, cancelRun := context.WithCancel(ctx)
+	go w.proc.heartbeat(runCtx, op.ID, cancelRun)
+
+	// Execute the operation with the appropriate CyberArk session
+	err = w.proc.executeOperation(runCtx, op)
+	cancelRun()
+
+	// An operation interrupted by shutdown goes back to the queue as-is
+	if err != nil && ctx.Err() != nil {
+		w.proc.releaseOperation(op)
+		return nil
+	}
+
+	if err != nil {
+		w.proc.handleFailure(op, err)
+	} else {
+		// Success
+		w.proc.completeOperation(op, nil, nil)
+	}
+
+	return nil
+}
+
+// claimCandidates is how many pending operations are considered per lane
+// when another processor wins the race for the first one
+const claimCandidates = 5
+
+// claimNext claims the next runnable operation, trying the given priority
+// lanes in order. Operations for instances without a free slot are skipped,
+// and with fair sharing enabled the least busy submitters are served first.
+//
+// Claiming is a conditional UPDATE ... WHERE status = 'pending' followed by a
+// rows-affected check, so it is atomic on every supported database without
+// row locking: when two processors pick the same candidate, only one update
+// matches and the other moves on to the next candidate. The update also
+// re-counts the instance's operations in flight, so replicas share its limit;
+// databases that run the updates of two replicas side by side may still let
+// both take the instance's last slot.
+func (p *Processor) claimNext(lanes []Priority) (*gormmodels.Operation, error) {
+	p.claimMutex.Lock()
+	defer p.claimMutex.Unlock()
+
+	// Operations for instances without a free slot, or whose circuit
+	// breaker is open, stay queued
+	saturated, err := p.saturatedInstances()
+	if err != nil {
+		return nil, err
+	}
+	excluded := append(saturated, p.guards.Blocked()...)
+	fairShare := p.currentConfig().FairShare.Enabled
+
+	for _, priority := range lanes {
+		scopes := []func(*gorm.DB) *gorm.DB{
+			p.laneScope(priority, time.Now()),
+			instanceScope(excluded),
+		}
+
+		if fairShare {
+			groupScope, ok, err := p.fairShareScope(scopes...)
+			if err != nil {
+				return nil, err
+			}
+			if !ok {
+				continue
+			}
+			scopes = append(scopes, groupScope)
+		}
+
+		var candidates []gormmodels.Operation
+		if err := p.db.Model(&gormmodels.Operation{}).
+			Scopes(scopes...).
+			Select("id", "cyber_ark_instance_id").
+			Order("scheduled_at").Order("id").
+			Limit(claimCandidates).
+			Find(&candidates).Error; err != nil {
+			return nil, fmt.Errorf("find pending operations: %w", err)
+		}
+
+		for _, candidate := range candidates {
+			op, err := p.claim(candidate.ID, p.instanceSlotScope(candidate.CyberArkInstanceID))
+			if errors.Is(err, gorm.ErrRecordNotFound) {
+				// Claimed by another processor in the meantime, or its
+				// instance ran out of slots
+				continue
+			}
+			if err != nil {
+				return nil, err
+			}
+
+			if op.CyberArkInstanceID != nil {
+				p.slots.acquire(*op.CyberArkInstanceID)
+			}
+			if fairShare {
+				p.markServed(op)
+			}
+
+			return op, nil
+		}
+	}
+
+	return nil, gorm.ErrRecordNotFound
+}
+
+// claim atomically moves a pending operation to processing and takes its
+// lease. It returns gorm.ErrRecordNotFound if the operation is no longer
+// pending or the scopes no longer match it.
+func (p *Processor) claim(id string, scopes ...func(*gorm.DB) *gorm.DB) (*gormmodels.Operation, error) {
+	now := time.Now()
+	res := p.db.Model(&gormmodels.Operation{}).
+		Scopes(scopes...).
+		Where("id = ? AND status = ?", id, gormmodels.OpStatusPending).
+		Updates(map[string]interface{}{
+			"status":           gormmodels.OpStatusProcessing,
+			"started_at":       now,
+			"locked_by":        p.id,
+			"lease_expires_at": now.Add(p.leaseDuration()),
+		})
+	if res.Error != nil {
+		return nil, fmt.Errorf("claim operation: %w", res.Error)
+	}
+	if res.RowsAffected == 0 {
+		return nil, gorm.ErrRecordNotFound
+	}
+
+	var op gormmodels.Operation
+	if err := p.db.First(&op, "id = ?", id).Error; err != nil {
+		return nil, fmt.Errorf("load claimed operation: %w", err)
+	}
+
+	return &op, nil
+}
+
+// instanceLimit returns how many operations may run at once against an instance
+func (p *Processor) instanceLimit(instanceID string) int {
+	var instance gormmodels.CyberArkInstance
+	if err := p.db.Select("id", "concurrent_sessions").First(&instance, "id = ?", instanceID).Error; err != nil {
+		// Be conservative if the instance cannot be loaded
+		return 1
+	}
+
+	if !instance.ConcurrentSessions {
+		return 1
+	}
+	return p.currentConfig().InstanceConcurrency
+}
+
+// executeOperation executes an operation with proper session management
+func (p *Processor) executeOperation(ctx context.Context, op *gormmodels.Operation) error {
 	// Get handler
-	handler, exists := w.proc.handlers[OperationType(op.Type)]
+	handler, exists := p.handlers[OperationType(op.Type)]
 	if !exists {
-		w.proc.completeOperation(&op, nil, fmt.Errorf("no handler registered for operation type: %s", op.Type))
-		return nil
+		return fmt.Errorf("no handler registered for operation type: %s", op.Type)
 	}
-	
+
 	// Create timeout context
-	timeout := w.proc.config.DefaultTimeout
-	if t, ok := w.proc.config.OperationTimeouts[OperationType(op.Type)]; ok {
+	config := p.currentConfig()
+	timeout := config.DefaultTimeout
+	if t, ok := config.OperationTimeouts[OperationType(op.Type)]; ok {
 		timeout = t
 	}
-	
+
 	opCtx, cancel := context.WithTimeout(ctx, time.Duration(timeout)*time.Second)
 	defer cancel()
-	
-	// Execute handler
-	err = handler.Handle(opCtx, pipelineOp)
-	
-	if err != nil {
-		// Check if retryable
-		if handler.CanRetry(err) && op.RetryCount < op.MaxRetries {
-			w.proc.retryOperation(&op, err)
-		} else {
-			w.proc.completeOperation(&op, nil, err)
+
+	policy := config.RetryPolicyFor(OperationType(op.Type))
+	reauthenticated := false
+
+	for {
+		// Get or create CyberArk session if instance ID is set
+		var session *cyberArkSession
+		if op.CyberArkInstanceID != nil {
+			var err error
+			session, err = p.getOrCreateSession(*op.CyberArkInstanceID)
+			if err != nil {
+				return fmt.Errorf("get CyberArk session: %w", err)
+			}
 		}
-	} else {
-		// Success - use Result from the pipeline operation
-		var result json.RawMessage
+
+		// Convert to pipeline operation
+		pipelineOp := convertToOperation(op)
+
+		// Inject CyberArk client into context if we have a session
+		runCtx := opCtx
+		if session != nil {
+			runCtx = context.WithValue(opCtx, "cyberark_client", session.client)
+		}
+
+		// Execute handler
+		err := handler.Handle(runCtx, pipelineOp)
+
+		// Update operation result if handler modified it
 		if pipelineOp.Result != nil {
-			result = *pipelineOp.Result
+			op.Result = pipelineOp.Result
+		}
+
+		// The client logs on again when its token is rejected but only
+		// replays idempotent requests, so run the operation once more right
+		// away with the new token instead of waiting for a retry
+		if err != nil && session != nil && policy.ReauthOnAuthExpired && !reauthenticated && opCtx.Err() == nil {
+			if class, _ := ClassifyError(err); class == ErrorClassAuthExpired {
+				reauthenticated = true
+				continue
+			}
 		}
-		w.proc.completeOperation(&op, result, nil)
-		
-		// Update metrics
-		atomic.AddInt64(w.proc.processedOps[OperationType(op.Type)], 1)
+
+		return err
 	}
-	
-	return nil
 }
 
 // convertToOperation converts GORM operation to pipeline Operation
-func (w *worker) convertToOperation(gormOp *gormmodels.Operation) *Operation {
+func convertToOperation(gormOp *gormmodels.Operation) *Operation {
 	return &Operation{
 		ID:                 gormOp.ID,
 		Type:               OperationType(gormOp.Type),
@@ -303,14 +566,22 @@ func (w *worker) convertToOperation(gormOp *gormmodels.Operation) *Operation {
 func (p *Processor) completeOperation(op *gormmodels.Operation, result json.RawMessage, err error) {
 	now := time.Now()
 	updates := map[string]interface{}{
-		"completed_at": now,
+		"completed_at":     now,
+		"locked_by":        nil,
+		"lease_expires_at": nil,
 	}
-	
+
+	// Handlers store their result on the operation
+	if result == nil && op.Result != nil {
+		result = *op.Result
+	}
+
+	var errMsg string
 	if err != nil {
 		updates["status"] = gormmodels.OpStatusFailed
-		errMsg := err.Error()
+		errMsg = err.Error()
 		updates["error_message"] = errMsg
-		
+
 		p.logger.WithFields(logrus.Fields{
 			"operation_id": op.ID,
 			"error":        err,
@@ -320,91 +591,225 @@ func (p *Processor) completeOperation(op *gormmodels.Operation, result json.RawM
 		if result != nil {
 			updates["result"] = result
 		}
-		
+
 		duration := now.Sub(*op.StartedAt).Seconds()
 		p.logger.WithFields(logrus.Fields{
 			"operation_id": op.ID,
 			"duration":     duration,
 		}).Info("Operation completed")
 	}
-	
-	// Update in database
-	if dbErr := p.db.Model(op).Updates(updates).Error; dbErr != nil {
-		p.logger.WithError(dbErr).Error("Failed to update operation status")
+
+	// Update in database, unless the operation was cancelled or its lease
+	// was taken over while running
+	res := p.db.Model(&gormmodels.Operation{}).
+		Where("id = ? AND status = ? AND locked_by = ?", op.ID, gormmodels.OpStatusProcessing, p.id).
+		Updates(updates)
+	if res.Error != nil {
+		p.logger.WithError(res.Error).Error("Failed to update operation status")
+		return
+	}
+	if res.RowsAffected == 0 {
+		p.logger.WithField("operation_id", op.ID).Warn("Operation no longer processing, discarding result")
+		return
+	}
+
+	// Apply updates to the operation object
+	if err != nil {
+		op.Status = gormmodels.OpStatusFailed
+		op.ErrorMessage = &errMsg
+		if counter, ok := p.failedOps[OperationType(op.Type)]; ok {
+			atomic.AddInt64(counter, 1)
+		}
+	} else {
+		op.Status = gormmodels.OpStatusCompleted
+		if result != nil {
+			op.Result = &result
+		}
+		if counter, ok := p.processedOps[OperationType(op.Type)]; ok {
+			atomic.AddInt64(counter, 1)
+		}
+	}
+	op.CompletedAt = &now
+	op.LockedBy = nil
+	op.LeaseExpiresAt = nil
+
+	// Publish event
+	if p.events != nil {
+		p.events.PublishOperationUpdated(op)
 	}
 }
 
+// handleFailure retries a failed operation or marks it failed, following the
+// retry policy for its type. The error class decides whether it is retried;
+// errors without a class are left to the handler's CanRetry.
+func (p *Processor) handleFailure(op *gormmodels.Operation, err error) {
+	// The vault is being given time to recover; try again once the circuit
+	// breaker lets requests through, without using up a retry
+	var circuitOpen *cyberark.CircuitOpenError
+	if errors.As(err, &circuitOpen) {
+		p.deferOperation(op, err, circuitOpen.RetryAt)
+		return
+	}
+
+	policy := p.currentConfig().RetryPolicyFor(OperationType(op.Type))
+	class, retryAfter := ClassifyError(err)
+
+	retryable := false
+	switch class {
+	case ErrorClassPermanent:
+	case ErrorClassUnknown:
+		if handler, exists := p.handlers[OperationType(op.Type)]; exists {
+			retryable = handler.CanRetry(err)
+		}
+	default:
+		retryable = policy.Retries(class)
+	}
+
+	if !retryable || policy.Exhausted(op.RetryCount, op.MaxRetries) {
+		p.logger.WithFields(logrus.Fields{
+			"operation_id": op.ID,
+			"error_class":  class,
+			"retry_count":  op.RetryCount,
+		}).Debug("Operation will not be retried")
+		p.completeOperation(op, nil, err)
+		return
+	}
+
+	backoff := policy.Backoff(op.RetryCount + 1)
+	if class == ErrorClassRateLimited && policy.HonorRetryAfter && retryAfter > 0 {
+		backoff = policy.RetryAfter(retryAfter)
+	}
+
+	p.retryOperation(op, err, backoff)
+}
+
 // retryOperation schedules an operation for retry
-func (p *Processor) retryOperation(op *gormmodels.Operation, err error) {
-	op.RetryCount++
-	
-	// Calculate next retry time with exponential backoff
-	backoffSeconds := p.config.RetryPolicy.BackoffBaseSeconds * 
-		int(math.Pow(float64(p.config.RetryPolicy.BackoffMultiplier), float64(op.RetryCount-1)))
-	
-	// Add jitter if enabled
-	if p.config.RetryPolicy.BackoffJitter {
-		jitter := rand.Intn(backoffSeconds / 2)
-		backoffSeconds += jitter
-	}
-	
-	scheduledAt := time.Now().Add(time.Duration(backoffSeconds) * time.Second)
-	
+func (p *Processor) retryOperation(op *gormmodels.Operation, err error, backoff time.Duration) {
 	p.logger.WithFields(logrus.Fields{
 		"operation_id":  op.ID,
-		"retry_count":   op.RetryCount,
-		"next_retry_in": backoffSeconds,
+		"retry_count":   op.RetryCount + 1,
+		"next_retry_in": backoff.Seconds(),
 		"error":         err,
 	}).Warn("Scheduling operation for retry")
-	
-	// Update in database
+
+	op.RetryCount++
+	p.rescheduleOperation(op, err, time.Now().Add(backoff))
+}
+
+// deferOperation puts an operation back in the queue until the given time
+// without counting it as a retry
+func (p *Processor) deferOperation(op *gormmodels.Operation, err error, until time.Time) {
+	p.logger.WithFields(logrus.Fields{
+		"operation_id": op.ID,
+		"instance_id":  op.CyberArkInstanceID,
+		"deferred_to":  until,
+		"error":        err,
+	}).Warn("Deferring operation")
+
+	p.rescheduleOperation(op, err, until)
+}
+
+// rescheduleOperation returns a processing operation to the queue
+func (p *Processor) rescheduleOperation(op *gormmodels.Operation, err error, scheduledAt time.Time) {
 	errMsg := err.Error()
 	updates := map[string]interface{}{
-		"status":        gormmodels.OpStatusPending,
-		"retry_count":   op.RetryCount,
-		"scheduled_at":  scheduledAt,
-		"error_message": errMsg,
-		"started_at":    nil,
+		"status":           gormmodels.OpStatusPending,
+		"retry_count":      op.RetryCount,
+		"scheduled_at":     scheduledAt,
+		"error_message":    errMsg,
+		"started_at":       nil,
+		"locked_by":        nil,
+		"lease_expires_at": nil,
+	}
+
+	res := p.db.Model(&gormmodels.Operation{}).
+		Where("id = ? AND status = ? AND locked_by = ?", op.ID, gormmodels.OpStatusProcessing, p.id).
+		Updates(updates)
+	if res.Error != nil {
+		p.logger.WithError(res.Error).Error("Failed to schedule retry")
+		return
+	}
+	if res.RowsAffected == 0 {
+		p.logger.WithField("operation_id", op.ID).Warn("Operation no longer processing, not scheduling retry")
+		return
+	}
+
+	// Update the operation object
+	op.Status = gormmodels.OpStatusPending
+	op.ScheduledAt = scheduledAt
+	op.ErrorMessage = &errMsg
+	op.StartedAt = nil
+	op.LockedBy = nil
+	op.LeaseExpiresAt = nil
+
+	// Publish retry event
+	if p.events != nil {
+		p.events.PublishOperationUpdated(op)
 	}
-	
-	if dbErr := p.db.Model(op).Updates(updates).Error; dbErr != nil {
-		p.logger.WithError(dbErr).Error("Failed to schedule retry")
+}
+
+// releaseOperation returns an operation interrupted by shutdown to the queue
+// without counting the attempt
+func (p *Processor) releaseOperation(op *gormmodels.Operation) {
+	res := p.db.Model(&gormmodels.Operation{}).
+		Where("id = ? AND status = ? AND locked_by = ?", op.ID, gormmodels.OpStatusProcessing, p.id).
+		Updates(map[string]interface{}{
+			"status":           gormmodels.OpStatusPending,
+			"started_at":       nil,
+			"locked_by":        nil,
+			"lease_expires_at": nil,
+		})
+	if res.Error != nil {
+		// The reaper will pick it up once the lease expires
+		p.logger.WithError(res.Error).WithField("operation_id", op.ID).Warn("Failed to release operation")
+		return
 	}
+
+	p.logger.WithField("operation_id", op.ID).Info("Released operation interrupted by shutdown")
 }
 
 // GetMetrics returns current processing metrics
 func (p *Processor) GetMetrics() ProcessingMetrics {
-	p.metricsLock.RLock()
-	defer p.metricsLock.RUnlock()
-	
+	totalWorkers := p.workerCount()
+	activeWorkers := int(atomic.LoadInt32(&p.activeWorkers))
+
 	metrics := ProcessingMetrics{
 		QueueDepth:        make(map[Priority]int),
 		ProcessingCount:   make(map[Priority]int),
 		CompletedCount:    make(map[OperationType]int64),
 		FailedCount:       make(map[OperationType]int64),
 		AvgProcessingTime: make(map[OperationType]float64),
-		WorkerUtilization: float64(atomic.LoadInt32(&p.activeWorkers)) / float64(p.config.TotalCapacity),
+		ActiveWorkers:     activeWorkers,
+		TotalWorkers:      totalWorkers,
+		InstanceInFlight:  p.slots.snapshot(),
+	}
+
+	if totalWorkers > 0 {
+		metrics.WorkerUtilization = float64(activeWorkers) / float64(totalWorkers)
 	}
-	
-	// Copy completed counts
+
+	// Copy completed and failed counts
 	for opType, count := range p.processedOps {
 		metrics.CompletedCount[opType] = atomic.LoadInt64(count)
 	}
-	
+	for opType, count := range p.failedOps {
+		metrics.FailedCount[opType] = atomic.LoadInt64(count)
+	}
+
 	// Query queue depths and processing counts from database
 	type metricResult struct {
 		Priority string
 		Status   string
 		Count    int64
 	}
-	
+
 	var results []metricResult
 	err := p.db.Model(&gormmodels.Operation{}).
 		Select("priority, status, COUNT(*) as count").
 		Where("status IN ?", []string{gormmodels.OpStatusPending, gormmodels.OpStatusProcessing}).
 		Group("priority, status").
 		Scan(&results).Error
-		
+
 	if err == nil {
 		for _, r := range results {
 			priority := Priority(r.Priority)
@@ -415,28 +820,39 @@ func (p *Processor) GetMetrics() ProcessingMetrics {
 			}
 		}
 	}
-	
+
+	// Active sessions count
+	p.sessionsMutex.RLock()
+	metrics.ActiveSessions = len(p.sessions)
+	p.sessionsMutex.RUnlock()
+
 	return metrics
 }
 
 // collectMetrics periodically collects metrics
 func (p *Processor) collectMetrics(ctx context.Context) {
 	defer p.wg.Done()
-	
+
 	ticker := time.NewTicker(30 * time.Second)
 	defer ticker.Stop()
-	
+
 	for {
 		select {
 		case <-ctx.Done():
 			return
 		case <-ticker.C:
+			// Queue figures are cluster-wide, so only the leader logs them
+			if !p.isLeader() {
+				continue
+			}
 			metrics := p.GetMetrics()
 			p.logger.WithFields(logrus.Fields{
 				"queue_depth":        metrics.QueueDepth,
 				"processing_count":   metrics.ProcessingCount,
 				"worker_utilization": metrics.WorkerUtilization,
+				"instance_in_flight": metrics.InstanceInFlight,
+				"active_sessions":    metrics.ActiveSessions,
 			}).Debug("Pipeline metrics")
 		}
 	}
-}
\ No newline at end of file
+}
@@ -0,0 +1,520 @@
+package pipeline_test
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"path/filepath"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/sirupsen/logrus"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"gorm.io/driver/sqlite"
+	"gorm.io/gorm"
+
+	"github.com/orca-ng/orca/internal/crypto"
+	"github.com/orca-ng/orca/internal/database"
+	gormmodels "github.com/orca-ng/orca/internal/models/gorm"
+	"github.com/orca-ng/orca/internal/pipeline"
+)
+
+// countingHandler records how many times and in which order operations
+// were executed
+type countingHandler struct {
+	mu    sync.Mutex
+	calls map[string]int
+	order []string
+}
+
+func (h *countingHandler) Handle(ctx context.Context, op *pipeline.Operation) error {
+	h.mu.Lock()
+	h.calls[op.ID]++
+	h.order = append(h.order, op.ID)
+	h.mu.Unlock()
+
+	time.Sleep(5 * time.Millisecond)
+	return nil
+}
+
+func (h *countingHandler) CanRetry(err error) bool {
+	return false
+}
+
+func (h *countingHandler) ValidatePayload(payload json.RawMessage) error {
+	return nil
+}
+
+// openReplicaDB opens its own connection pool to a shared SQLite file, the way
+// separate ORCA replicas each connect to the same database
+func openReplicaDB(t *testing.T, path string) *database.GormDB {
+	db, err := gorm.Open(sqlite.Open(path+"?_busy_timeout=10000"), &gorm.Config{})
+	require.NoError(t, err)
+
+	err = db.AutoMigrate(&gormmodels.Operation{}, &gormmodels.CyberArkInstance{})
+	require.NoError(t, err)
+
+	return &database.GormDB{DB: db}
+}
+
+func TestConcurrentClaimingSQLite(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "pipeline.db")
+	dbA := openReplicaDB(t, path)
+	dbB := openReplicaDB(t, path)
+
+	const total = 60
+	priorities := []string{gormmodels.OpPriorityHigh, gormmodels.OpPriorityNormal, gormmodels.OpPriorityLow}
+	for i := 0; i < total; i++ {
+		op := &gormmodels.Operation{
+			Type:        string(pipeline.OpTypeUserSync),
+			Priority:    priorities[i%len(priorities)],
+			Status:      gormmodels.OpStatusPending,
+			Payload:     json.RawMessage(fmt.Sprintf(`{"n":%d}`, i)),
+			ScheduledAt: time.Now().Add(-time.Minute),
+		}
+		require.NoError(t, dbA.Create(op).Error)
+	}
+
+	handler := &countingHandler{calls: make(map[string]int)}
+	logger := logrus.New()
+	logger.SetLevel(logrus.WarnLevel)
+
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	// Two processors with several workers each compete for the same queue
+	var processors []*pipeline.Processor
+	for _, db := range []*database.GormDB{dbA, dbB} {
+		config := pipeline.DefaultPipelineConfig()
+		config.TotalCapacity = 4
+
+		proc := pipeline.NewProcessor(db, config, logger, nil, "test-key", nil)
+		proc.RegisterHandler(pipeline.OpTypeUserSync, handler)
+		require.NoError(t, proc.Start(ctx))
+		processors = append(processors, proc)
+	}
+
+	require.Eventually(t, func() bool {
+		var completed int64
+		dbA.Model(&gormmodels.Operation{}).Where("status = ?", gormmodels.OpStatusCompleted).Count(&completed)
+		return completed == total
+	}, 30*time.Second, 100*time.Millisecond)
+
+	for _, proc := range processors {
+		require.NoError(t, proc.Stop())
+	}
+
+	handler.mu.Lock()
+	defer handler.mu.Unlock()
+
+	assert.Len(t, handler.calls, total)
+	for id, calls := range handler.calls {
+		assert.Equal(t, 1, calls, "operation %s executed more than once", id)
+	}
+
+	// Completed operations release their lease
+	var locked int64
+	require.NoError(t, dbA.Model(&gormmodels.Operation{}).Where("locked_by IS NOT NULL").Count(&locked).Error)
+	assert.Zero(t, locked)
+}
+
+func TestClaimSkipsOperationsNotYetDue(t *testing.T) {
+	db := openReplicaDB(t, filepath.Join(t.TempDir(), "pipeline.db"))
+
+	op := &gormmodels.Operation{
+		Type:        string(pipeline.OpTypeUserSync),
+		Priority:    gormmodels.OpPriorityNormal,
+		Status:      gormmodels.OpStatusPending,
+		Payload:     json.RawMessage(`{}`),
+		ScheduledAt: time.Now().Add(time.Hour),
+	}
+	require.NoError(t, db.Create(op).Error)
+
+	handler := &countingHandler{calls: make(map[string]int)}
+	logger := logrus.New()
+	logger.SetLevel(logrus.WarnLevel)
+
+	config := pipeline.DefaultPipelineConfig()
+	config.TotalCapacity = 2
+
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	proc := pipeline.NewProcessor(db, config, logger, nil, "test-key", nil)
+	proc.RegisterHandler(pipeline.OpTypeUserSync, handler)
+	require.NoError(t, proc.Start(ctx))
+
+	time.Sleep(1500 * time.Millisecond)
+	require.NoError(t, proc.Stop())
+
+	var stored gormmodels.Operation
+	require.NoError(t, db.First(&stored, "id = ?", op.ID).Error)
+	assert.Equal(t, gormmodels.OpStatusPending, stored.Status)
+	assert.Empty(t, handler.calls)
+}
+
+// runUntilDrained processes all pending operations with a single worker and
+// returns the order in which they were executed
+func runUntilDrained(t *testing.T, db *database.GormDB, config *pipeline.PipelineConfig, total int) []string {
+	handler := &countingHandler{calls: make(map[string]int)}
+	logger := logrus.New()
+	logger.SetLevel(logrus.WarnLevel)
+
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	proc := pipeline.NewProcessor(db, config, logger, nil, "test-key", nil)
+	proc.RegisterHandler(pipeline.OpTypeUserSync, handler)
+	require.NoError(t, proc.Start(ctx))
+
+	require.Eventually(t, func() bool {
+		handler.mu.Lock()
+		defer handler.mu.Unlock()
+		return len(handler.order) == total
+	}, 30*time.Second, 50*time.Millisecond)
+	require.NoError(t, proc.Stop())
+
+	return handler.order
+}
+
+func TestPriorityAgingPromotesWaitingOperations(t *testing.T) {
+	db := openReplicaDB(t, filepath.Join(t.TempDir(), "pipeline.db"))
+
+	// A low priority operation that has waited for two aging intervals
+	aged := &gormmodels.Operation{
+		Type:        string(pipeline.OpTypeUserSync),
+		Priority:    gormmodels.OpPriorityLow,
+		Status:      gormmodels.OpStatusPending,
+		Payload:     json.RawMessage(`{}`),
+		ScheduledAt: time.Now().Add(-11 * time.Minute),
+	}
+	require.NoError(t, db.Create(aged).Error)
+
+	for i := 0; i < 5; i++ {
+		require.NoError(t, db.Create(&gormmodels.Operation{
+			Type:        string(pipeline.OpTypeUserSync),
+			Priority:    gormmodels.OpPriorityHigh,
+			Status:      gormmodels.OpStatusPending,
+			Payload:     json.RawMessage(`{}`),
+			ScheduledAt: time.Now().Add(-time.Minute),
+		}).Error)
+	}
+
+	config := pipeline.DefaultPipelineConfig()
+	config.TotalCapacity = 1
+	config.PriorityAging = pipeline.PriorityAging{Enabled: true, IntervalSeconds: 300}
+
+	order := runUntilDrained(t, db, config, 6)
+	assert.Equal(t, aged.ID, order[0])
+}
+
+func TestFairShareAlternatesBetweenUsers(t *testing.T) {
+	db := openReplicaDB(t, filepath.Join(t.TempDir(), "pipeline.db"))
+
+	userOf := make(map[string]string)
+	create := func(user string, scheduledAt time.Time) {
+		op := &gormmodels.Operation{
+			Type:        string(pipeline.OpTypeUserSync),
+			Priority:    gormmodels.OpPriorityNormal,
+			Status:      gormmodels.OpStatusPending,
+			Payload:     json.RawMessage(`{}`),
+			ScheduledAt: scheduledAt,
+			CreatedBy:   &user,
+		}
+		require.NoError(t, db.Create(op).Error)
+		userOf[op.ID] = user
+	}
+
+	// A bulk submission followed by a single user's few operations
+	for i := 0; i < 10; i++ {
+		create("usr_bulk", time.Now().Add(-10*time.Minute))
+	}
+	for i := 0; i < 3; i++ {
+		create("usr_other", time.Now().Add(-time.Minute))
+	}
+
+	config := pipeline.DefaultPipelineConfig()
+	config.TotalCapacity = 1
+	config.PriorityAging.Enabled = false
+	config.FairShare = pipeline.FairShare{Enabled: true, GroupBy: pipeline.FairShareByCreator}
+
+	order := runUntilDrained(t, db, config, 13)
+
+	// The other user is served within the first round-robin turns instead
+	// of after the whole bulk submission
+	served := 0
+	for _, id := range order[:6] {
+		if userOf[id] == "usr_other" {
+			served++
+		}
+	}
+	assert.Equal(t, 3, served)
+}
+
+func TestApplyConfigResizesWorkers(t *testing.T) {
+	db := openReplicaDB(t, filepath.Join(t.TempDir(), "pipeline.db"))
+	logger := logrus.New()
+	logger.SetLevel(logrus.WarnLevel)
+
+	config := pipeline.DefaultPipelineConfig()
+	config.TotalCapacity = 2
+
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	proc := pipeline.NewProcessor(db, config, logger, nil, "test-key", nil)
+	require.NoError(t, proc.Start(ctx))
+	assert.Equal(t, 2, proc.GetMetrics().TotalWorkers)
+
+	grown := proc.Config()
+	grown.TotalCapacity = 6
+	require.NoError(t, proc.ApplyConfig(grown))
+	assert.Equal(t, 6, proc.GetMetrics().TotalWorkers)
+
+	shrunk := proc.Config()
+	shrunk.TotalCapacity = 1
+	require.NoError(t, proc.ApplyConfig(shrunk))
+	assert.Equal(t, 1, proc.GetMetrics().TotalWorkers)
+
+	invalid := proc.Config()
+	invalid.TotalCapacity = 0
+	assert.Error(t, proc.ApplyConfig(invalid))
+	assert.Equal(t, 1, proc.Config().TotalCapacity)
+
+	require.NoError(t, proc.Stop())
+}
+
+// gatedHandler holds the operations of one instance until released
+type gatedHandler struct {
+	instanceID string
+	release    chan struct{}
+}
+
+func (h *gatedHandler) Handle(ctx context.Context, op *pipeline.Operation) error {
+	if op.CyberArkInstanceID != nil && *op.CyberArkInstanceID == h.instanceID {
+		select {
+		case <-h.release:
+		case <-ctx.Done():
+			return ctx.Err()
+		}
+	}
+	return nil
+}
+
+func (h *gatedHandler) CanRetry(err error) bool {
+	return false
+}
+
+func (h *gatedHandler) ValidatePayload(payload json.RawMessage) error {
+	return nil
+}
+
+func TestSaturatedInstanceDoesNotBlockOthers(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		fmt.Fprint(w, `"token"`)
+	}))
+	defer server.Close()
+
+	db := openReplicaDB(t, filepath.Join(t.TempDir(), "pipeline.db"))
+	password, err := crypto.NewEncryptor("test-key").Encrypt("secret")
+	require.NoError(t, err)
+
+	// An instance allowing a single session, and one without a limit
+	single := &gormmodels.CyberArkInstance{Name: "single", BaseURL: server.URL, Username: "orca", PasswordEncrypted: password}
+	other := &gormmodels.CyberArkInstance{Name: "other", BaseURL: server.URL, Username: "orca", PasswordEncrypted: password}
+	require.NoError(t, db.Create(single).Error)
+	require.NoError(t, db.Create(other).Error)
+	require.NoError(t, db.Model(single).Update("concurrent_sessions", false).Error)
+
+	create := func(instanceID string, scheduledAt time.Time) *gormmodels.Operation {
+		op := &gormmodels.Operation{
+			Type:               string(pipeline.OpTypeSafeSync),
+			Priority:           gormmodels.OpPriorityNormal,
+			Status:             gormmodels.OpStatusPending,
+			Payload:            json.RawMessage(`{}`),
+			ScheduledAt:        scheduledAt,
+			CyberArkInstanceID: &instanceID,
+		}
+		require.NoError(t, db.Create(op).Error)
+		return op
+	}
+	first := create(single.ID, time.Now().Add(-10*time.Minute))
+	second := create(single.ID, time.Now().Add(-9*time.Minute))
+	unrelated := create(other.ID, time.Now().Add(-time.Minute))
+
+	handler := &gatedHandler{instanceID: single.ID, release: make(chan struct{})}
+	logger := logrus.New()
+	logger.SetLevel(logrus.WarnLevel)
+
+	config := pipeline.DefaultPipelineConfig()
+	config.TotalCapacity = 2
+
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	proc := pipeline.NewProcessor(db, config, logger, nil, "test-key", nil)
+	proc.RegisterHandler(pipeline.OpTypeSafeSync, handler)
+	require.NoError(t, proc.Start(ctx))
+
+	status := func(op *gormmodels.Operation) string {
+		var stored gormmodels.Operation
+		require.NoError(t, db.First(&stored, "id = ?", op.ID).Error)
+		return stored.Status
+	}
+
+	// The single session instance is busy, so its second operation waits
+	// while the other instance's operation is claimed past it
+	require.Eventually(t, func() bool {
+		return status(unrelated) == gormmodels.OpStatusCompleted
+	}, 10*time.Second, 20*time.Millisecond)
+	assert.Equal(t, gormmodels.OpStatusProcessing, status(first))
+	assert.Equal(t, gormmodels.OpStatusPending, status(second))
+
+	close(handler.release)
+	require.Eventually(t, func() bool {
+		return status(first) == gormmodels.OpStatusCompleted && status(second) == gormmodels.OpStatusCompleted
+	}, 10*time.Second, 20*time.Millisecond)
+	require.NoError(t, proc.Stop())
+}
+
+func TestInstanceLimitIsSharedByReplicas(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		fmt.Fprint(w, `"token"`)
+	}))
+	defer server.Close()
+
+	path := filepath.Join(t.TempDir(), "pipeline.db")
+	dbA := openReplicaDB(t, path)
+	dbB := openReplicaDB(t, path)
+	password, err := crypto.NewEncryptor("test-key").Encrypt("secret")
+	require.NoError(t, err)
+
+	single := &gormmodels.CyberArkInstance{Name: "single", BaseURL: server.URL, Username: "orca", PasswordEncrypted: password}
+	require.NoError(t, dbA.Create(single).Error)
+	require.NoError(t, dbA.Model(single).Update("concurrent_sessions", false).Error)
+	for i := 0; i < 2; i++ {
+		require.NoError(t, dbA.Create(&gormmodels.Operation{
+			Type:               string(pipeline.OpTypeSafeSync),
+			Priority:           gormmodels.OpPriorityNormal,
+			Status:             gormmodels.OpStatusPending,
+			Payload:            json.RawMessage(`{}`),
+			ScheduledAt:        time.Now().Add(-time.Minute),
+			CyberArkInstanceID: &single.ID,
+		}).Error)
+	}
+
+	handler := &gatedHandler{instanceID: single.ID, release: make(chan struct{})}
+	logger := logrus.New()
+	logger.SetLevel(logrus.WarnLevel)
+
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	// Each replica has a free worker for the second operation
+	var processors []*pipeline.Processor
+	for _, db := range []*database.GormDB{dbA, dbB} {
+		config := pipeline.DefaultPipelineConfig()
+		config.TotalCapacity = 2
+
+		proc := pipeline.NewProcessor(db, config, logger, nil, "test-key", nil)
+		proc.RegisterHandler(pipeline.OpTypeSafeSync, handler)
+		require.NoError(t, proc.Start(ctx))
+		processors = append(processors, proc)
+	}
+
+	count := func(status string) int64 {
+		var n int64
+		require.NoError(t, dbA.Model(&gormmodels.Operation{}).Where("status = ?", status).Count(&n).Error)
+		return n
+	}
+	require.Eventually(t, func() bool {
+		return count(gormmodels.OpStatusProcessing) == 1
+	}, 10*time.Second, 20*time.Millisecond)
+	for i := 0; i < 20; i++ {
+		time.Sleep(20 * time.Millisecond)
+		require.Equal(t, int64(1), count(gormmodels.OpStatusProcessing), "instance limit exceeded across replicas")
+	}
+
+	close(handler.release)
+	require.Eventually(t, func() bool {
+		return count(gormmodels.OpStatusCompleted) == 2
+	}, 10*time.Second, 20*time.Millisecond)
+	for _, proc := range processors {
+		require.NoError(t, proc.Stop())
+	}
+}
+
+func TestHungLogonDoesNotDelayOtherInstances(t *testing.T) {
+	hang := make(chan struct{})
+	var releaseOnce sync.Once
+	release := func() { releaseOnce.Do(func() { close(hang) }) }
+	hung := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		<-hang
+		fmt.Fprint(w, `"token"`)
+	}))
+	defer hung.Close()
+	defer release()
+	healthy := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		fmt.Fprint(w, `"token"`)
+	}))
+	defer healthy.Close()
+
+	db := openReplicaDB(t, filepath.Join(t.TempDir(), "pipeline.db"))
+	password, err := crypto.NewEncryptor("test-key").Encrypt("secret")
+	require.NoError(t, err)
+
+	slow := &gormmodels.CyberArkInstance{Name: "slow", BaseURL: hung.URL, Username: "orca", PasswordEncrypted: password}
+	fast := &gormmodels.CyberArkInstance{Name: "fast", BaseURL: healthy.URL, Username: "orca", PasswordEncrypted: password}
+	require.NoError(t, db.Create(slow).Error)
+	require.NoError(t, db.Create(fast).Error)
+
+	create := func(instanceID string, scheduledAt time.Time) *gormmodels.Operation {
+		op := &gormmodels.Operation{
+			Type:               string(pipeline.OpTypeSafeSync),
+			Priority:           gormmodels.OpPriorityNormal,
+			Status:             gormmodels.OpStatusPending,
+			Payload:            json.RawMessage(`{}`),
+			ScheduledAt:        scheduledAt,
+			CyberArkInstanceID: &instanceID,
+		}
+		require.NoError(t, db.Create(op).Error)
+		return op
+	}
+	waiting := create(slow.ID, time.Now().Add(-10*time.Minute))
+	unrelated := create(fast.ID, time.Now().Add(-time.Minute))
+
+	logger := logrus.New()
+	logger.SetLevel(logrus.ErrorLevel)
+
+	config := pipeline.DefaultPipelineConfig()
+	config.TotalCapacity = 2
+
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	proc := pipeline.NewProcessor(db, config, logger, nil, "test-key", nil)
+	proc.RegisterHandler(pipeline.OpTypeSafeSync, &gatedHandler{release: make(chan struct{})})
+	require.NoError(t, proc.Start(ctx))
+
+	status := func(op *gormmodels.Operation) string {
+		var stored gormmodels.Operation
+		require.NoError(t, db.First(&stored, "id = ?", op.ID).Error)
+		return stored.Status
+	}
+
+	// The logon to the slow vault hangs, the other instance logs on anyway
+	require.Eventually(t, func() bool {
+		return status(unrelated) == gormmodels.OpStatusCompleted
+	}, 5*time.Second, 20*time.Millisecond)
+	assert.Equal(t, gormmodels.OpStatusProcessing, status(waiting))
+
+	release()
+	require.Eventually(t, func() bool {
+		return status(waiting) == gormmodels.OpStatusCompleted
+	}, 10*time.Second, 20*time.Millisecond)
+	require.NoError(t, proc.Stop())
+}
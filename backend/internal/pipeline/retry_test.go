@@ -0,0 +1,253 @@
+package pipeline_test
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"path/filepath"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/sirupsen/logrus"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/orca-ng/orca/internal/crypto"
+	"github.com/orca-ng/orca/internal/cyberark"
+	"github.com/orca-ng/orca/internal/database"
+	gormmodels "github.com/orca-ng/orca/internal/models/gorm"
+	"github.com/orca-ng/orca/internal/pipeline"
+)
+
+func TestClassifyError(t *testing.T) {
+	tests := []struct {
+		name       string
+		err        error
+		class      pipeline.ErrorClass
+		retryAfter time.Duration
+	}{
+		{"rate limited", &cyberark.APIError{Status: http.StatusTooManyRequests, RetryAfter: time.Minute}, pipeline.ErrorClassRateLimited, time.Minute},
+		{"token expired", &cyberark.APIError{Path: "/API/Users", Status: http.StatusUnauthorized}, pipeline.ErrorClassAuthExpired, 0},
+		{"bad credentials", &cyberark.APIError{Path: "/API/auth/Cyberark/Logon", Status: http.StatusUnauthorized}, pipeline.ErrorClassPermanent, 0},
+		{"not found", &cyberark.APIError{Path: "/API/Safes/x", Status: http.StatusNotFound}, pipeline.ErrorClassPermanent, 0},
+		{"server error", fmt.Errorf("list users: %w", &cyberark.APIError{Status: http.StatusBadGateway}), pipeline.ErrorClassTransient, 0},
+		{"connection refused", &net.OpError{Op: "dial", Net: "tcp", Err: fmt.Errorf("connection refused")}, pipeline.ErrorClassNetwork, 0},
+		{"deadline", fmt.Errorf("sync: %w", context.DeadlineExceeded), pipeline.ErrorClassTimeout, 0},
+		{"radius challenge", fmt.Errorf("authenticate: %w", &cyberark.ChallengeError{Challenge: "Enter PASSCODE"}), pipeline.ErrorClassPermanent, 0},
+		{"marked permanent", pipeline.Permanent(fmt.Errorf("safe already exists")), pipeline.ErrorClassPermanent, 0},
+		{"untyped", fmt.Errorf("timeout while talking to the database"), pipeline.ErrorClassUnknown, 0},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			class, retryAfter := pipeline.ClassifyError(tt.err)
+			assert.Equal(t, tt.class, class)
+			assert.Equal(t, tt.retryAfter, retryAfter)
+		})
+	}
+}
+
+func TestRetryPolicyBackoff(t *testing.T) {
+	policy := pipeline.RetryPolicy{BackoffBaseSeconds: 5, BackoffMultiplier: 3, BackoffMaxSeconds: 60}
+
+	assert.Equal(t, 5*time.Second, policy.Backoff(1))
+	assert.Equal(t, 15*time.Second, policy.Backoff(2))
+	assert.Equal(t, 45*time.Second, policy.Backoff(3))
+	assert.Equal(t, 60*time.Second, policy.Backoff(4))
+
+	policy.BackoffJitter = true
+	for i := 0; i < 20; i++ {
+		backoff := policy.Backoff(2)
+		assert.GreaterOrEqual(t, backoff, 12*time.Second)
+		assert.LessOrEqual(t, backoff, 18*time.Second)
+	}
+}
+
+func TestRetryPolicyExhausted(t *testing.T) {
+	policy := pipeline.RetryPolicy{MaxAttempts: 3}
+
+	assert.False(t, policy.Exhausted(2, 0))
+	assert.True(t, policy.Exhausted(3, 0))
+
+	// An operation's own limit can only lower the policy's
+	assert.True(t, policy.Exhausted(1, 1))
+	assert.True(t, policy.Exhausted(3, 5))
+}
+
+// failingHandler fails every operation with the same error
+type failingHandler struct {
+	err   error
+	calls int32
+}
+
+func (h *failingHandler) Handle(ctx context.Context, op *pipeline.Operation) error {
+	atomic.AddInt32(&h.calls, 1)
+	return h.err
+}
+
+func (h *failingHandler) CanRetry(err error) bool {
+	return false
+}
+
+func (h *failingHandler) ValidatePayload(payload json.RawMessage) error {
+	return nil
+}
+
+// runOnce creates an operation, runs the processor until it has been
+// attempted and returns the stored operation
+func runOnce(t *testing.T, db *database.GormDB, config *pipeline.PipelineConfig, handler pipeline.OperationHandler, instanceID *string) *gormmodels.Operation {
+	op := &gormmodels.Operation{
+		Type:               string(pipeline.OpTypeSafeSync),
+		Priority:           gormmodels.OpPriorityNormal,
+		Status:             gormmodels.OpStatusPending,
+		Payload:            json.RawMessage(`{}`),
+		ScheduledAt:        time.Now().Add(-time.Second),
+		CyberArkInstanceID: instanceID,
+	}
+	require.NoError(t, db.Create(op).Error)
+
+	logger := logrus.New()
+	logger.SetLevel(logrus.WarnLevel)
+
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	proc := pipeline.NewProcessor(db, config, logger, nil, "test-key", nil)
+	proc.RegisterHandler(pipeline.OpTypeSafeSync, handler)
+	require.NoError(t, proc.Start(ctx))
+
+	var stored gormmodels.Operation
+	require.Eventually(t, func() bool {
+		db.First(&stored, "id = ?", op.ID)
+		switch stored.Status {
+		case gormmodels.OpStatusCompleted, gormmodels.OpStatusFailed:
+			return true
+		case gormmodels.OpStatusPending:
+			// Retried or deferred
+			return stored.RetryCount > 0 || stored.ScheduledAt.After(time.Now())
+		}
+		return false
+	}, 10*time.Second, 20*time.Millisecond)
+	require.NoError(t, proc.Stop())
+
+	return &stored
+}
+
+func TestRateLimitedOperationHonorsRetryAfter(t *testing.T) {
+	db := openReplicaDB(t, filepath.Join(t.TempDir(), "pipeline.db"))
+
+	handler := &failingHandler{err: &cyberark.APIError{Status: http.StatusTooManyRequests, RetryAfter: 2 * time.Hour}}
+	config := pipeline.DefaultPipelineConfig()
+	config.TotalCapacity = 1
+	config.RetryPolicy.MaxRetryAfterSeconds = 900
+
+	before := time.Now()
+	stored := runOnce(t, db, config, handler, nil)
+
+	assert.Equal(t, gormmodels.OpStatusPending, stored.Status)
+	assert.Equal(t, 1, stored.RetryCount)
+
+	// The requested two hours are capped at the policy maximum
+	delay := stored.ScheduledAt.Sub(before)
+	assert.InDelta(t, (15 * time.Minute).Seconds(), delay.Seconds(), 5)
+}
+
+func TestRetryPolicyPerOperationType(t *testing.T) {
+	db := openReplicaDB(t, filepath.Join(t.TempDir(), "pipeline.db"))
+
+	handler := &failingHandler{err: &cyberark.APIError{Status: http.StatusServiceUnavailable}}
+	config := pipeline.DefaultPipelineConfig()
+	config.TotalCapacity = 1
+
+	// Safe sync does not retry server errors at all
+	policy := config.RetryPolicy
+	policy.RetryOn = []pipeline.ErrorClass{pipeline.ErrorClassNetwork}
+	config.RetryPolicies[pipeline.OpTypeSafeSync] = policy
+
+	stored := runOnce(t, db, config, handler, nil)
+	assert.Equal(t, gormmodels.OpStatusFailed, stored.Status)
+	assert.Equal(t, 0, stored.RetryCount)
+
+	// With the default policy the same error is retried after the backoff
+	delete(config.RetryPolicies, pipeline.OpTypeSafeSync)
+	before := time.Now()
+	stored = runOnce(t, db, config, handler, nil)
+	assert.Equal(t, gormmodels.OpStatusPending, stored.Status)
+	assert.InDelta(t, 10, stored.ScheduledAt.Sub(before).Seconds(), 2)
+}
+
+func TestOpenCircuitDefersOperation(t *testing.T) {
+	db := openReplicaDB(t, filepath.Join(t.TempDir(), "pipeline.db"))
+
+	retryAt := time.Now().Add(time.Hour)
+	handler := &failingHandler{err: fmt.Errorf("list users: %w", &cyberark.CircuitOpenError{RetryAt: retryAt})}
+	config := pipeline.DefaultPipelineConfig()
+	config.TotalCapacity = 1
+
+	stored := runOnce(t, db, config, handler, nil)
+	assert.Equal(t, gormmodels.OpStatusPending, stored.Status)
+	assert.Equal(t, 0, stored.RetryCount, "waiting for the breaker is not a retry")
+	assert.WithinDuration(t, retryAt, stored.ScheduledAt, time.Second)
+	assert.Nil(t, stored.LockedBy)
+}
+
+// listUsersHandler lists one page of users with the client from the context
+type listUsersHandler struct{}
+
+func (h *listUsersHandler) Handle(ctx context.Context, op *pipeline.Operation) error {
+	client := ctx.Value("cyberark_client").(*cyberark.Client)
+	_, err := client.ListUsers(ctx, cyberark.ListUsersOptions{PageOffset: 1, PageSize: 1})
+	return err
+}
+
+func (h *listUsersHandler) CanRetry(err error) bool {
+	return false
+}
+
+func (h *listUsersHandler) ValidatePayload(payload json.RawMessage) error {
+	return nil
+}
+
+func TestExpiredTokenReauthenticatesImmediately(t *testing.T) {
+	// The first token handed out is rejected as expired
+	var logons int32
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		switch r.URL.Path {
+		case "/API/auth/Cyberark/Logon":
+			n := atomic.AddInt32(&logons, 1)
+			fmt.Fprintf(w, `"token-%d"`, n)
+		case "/API/Users":
+			if r.Header.Get("Authorization") == "token-1" {
+				w.WriteHeader(http.StatusUnauthorized)
+				return
+			}
+			fmt.Fprint(w, `{"Users": [], "Total": 0}`)
+		default:
+			w.WriteHeader(http.StatusNotFound)
+		}
+	}))
+	defer server.Close()
+
+	db := openReplicaDB(t, filepath.Join(t.TempDir(), "pipeline.db"))
+	password, err := crypto.NewEncryptor("test-key").Encrypt("secret")
+	require.NoError(t, err)
+	instance := &gormmodels.CyberArkInstance{
+		Name:              "vault",
+		BaseURL:           server.URL,
+		Username:          "orca",
+		PasswordEncrypted: password,
+	}
+	require.NoError(t, db.Create(instance).Error)
+
+	config := pipeline.DefaultPipelineConfig()
+	config.TotalCapacity = 1
+
+	stored := runOnce(t, db, config, &listUsersHandler{}, &instance.ID)
+	assert.Equal(t, gormmodels.OpStatusCompleted, stored.Status)
+	assert.Equal(t, 0, stored.RetryCount, "logging on again is not a retry")
+	assert.Equal(t, int32(2), atomic.LoadInt32(&logons))
+}
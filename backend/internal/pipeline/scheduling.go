@@ -0,0 +1,223 @@
+package pipeline
+
+import (
+	"fmt"
+	"strings"
+	"time"
+
+	"gorm.io/gorm"
+
+	gormmodels "github.com/orca-ng/orca/internal/models/gorm"
+)
+
+// priorityRank orders priorities from most (0) to least urgent
+func priorityRank(priority Priority) int {
+	for i, p := range allPriorities {
+		if p == priority {
+			return i
+		}
+	}
+	return len(allPriorities)
+}
+
+// laneScope restricts a query to the pending operations that are due and
+// belong to a priority lane. With priority aging enabled, a lane also holds
+// lower priority operations that have waited long enough to be promoted into
+// it: one level per aging interval.
+func (p *Processor) laneScope(priority Priority, now time.Time) func(*gorm.DB) *gorm.DB {
+	return func(db *gorm.DB) *gorm.DB {
+		db = db.Where("status = ? AND scheduled_at <= ?", gormmodels.OpStatusPending, now)
+
+		aging := p.currentConfig().PriorityAging
+		if !aging.Enabled || aging.IntervalSeconds <= 0 {
+			return db.Where("priority = ?", priority)
+		}
+
+		conditions := []string{"priority = ?"}
+		args := []interface{}{priority}
+
+		interval := time.Duration(aging.IntervalSeconds) * time.Second
+		rank := priorityRank(priority)
+		for i := rank + 1; i < len(allPriorities); i++ {
+			levels := time.Duration(i - rank)
+			conditions = append(conditions, "(priority = ? AND scheduled_at <= ?)")
+			args = append(args, allPriorities[i], now.Add(-levels*interval))
+		}
+
+		return db.Where("("+strings.Join(conditions, " OR ")+")", args...)
+	}
+}
+
+// instanceScope skips operations for instances without a free slot
+func instanceScope(saturated []string) func(*gorm.DB) *gorm.DB {
+	return func(db *gorm.DB) *gorm.DB {
+		if len(saturated) == 0 {
+			return db
+		}
+		return db.Where("(cyber_ark_instance_id IS NULL OR cyber_ark_instance_id NOT IN ?)", saturated)
+	}
+}
+
+// saturatedInstances returns the IDs of instances whose operations in flight,
+// counted across all replicas, reach the instance's limit
+func (p *Processor) saturatedInstances() ([]string, error) {
+	var running []struct {
+		InstanceID string
+		Count      int
+	}
+	if err := p.db.Model(&gormmodels.Operation{}).
+		Select("cyber_ark_instance_id AS instance_id, COUNT(*) AS count").
+		Where("status = ? AND cyber_ark_instance_id IS NOT NULL", gormmodels.OpStatusProcessing).
+		Group("cyber_ark_instance_id").
+		Scan(&running).Error; err != nil {
+		return nil, fmt.Errorf("count in-flight instances: %w", err)
+	}
+
+	var ids []string
+	for _, r := range running {
+		if limit := p.instanceLimit(r.InstanceID); limit > 0 && r.Count >= limit {
+			ids = append(ids, r.InstanceID)
+		}
+	}
+	return ids, nil
+}
+
+// instanceSlotScope restricts a claim to an operation whose instance is
+// still below its limit when the claim is made. The count reads a derived
+// table since MySQL cannot read the table being updated directly.
+func (p *Processor) instanceSlotScope(instanceID *string) func(*gorm.DB) *gorm.DB {
+	return func(db *gorm.DB) *gorm.DB {
+		if instanceID == nil {
+			return db
+		}
+		limit := p.instanceLimit(*instanceID)
+		if limit <= 0 {
+			return db
+		}
+		return db.Where("(SELECT COUNT(*) FROM (SELECT id FROM operations WHERE cyber_ark_instance_id = ? AND status = ?) AS running) < ?",
+			*instanceID, gormmodels.OpStatusProcessing, limit)
+	}
+}
+
+// fairShareColumn returns the column operations are grouped by for fair-share
+// scheduling. Only known columns are accepted since the name is used in SQL.
+func (p *Processor) fairShareColumn() string {
+	if p.currentConfig().FairShare.GroupBy == FairShareByCorrelation {
+		return FairShareByCorrelation
+	}
+	return FairShareByCreator
+}
+
+// fairShareScope selects the group that should be served next from a lane:
+// the one with the fewest operations in flight across all replicas, or on a
+// tie the one this processor served longest ago, skipping groups at their
+// in-flight cap. Operations without a group (such as scheduled syncs) form a
+// group of their own. ok is false when there is no
+// pending work or every group with pending work is at its cap.
+func (p *Processor) fairShareScope(lane ...func(*gorm.DB) *gorm.DB) (scope func(*gorm.DB) *gorm.DB, ok bool, err error) {
+	column := p.fairShareColumn()
+
+	type groupCount struct {
+		Grp   *string
+		Count int64
+	}
+
+	// Groups with eligible pending work
+	var pending []groupCount
+	if err := p.db.Model(&gormmodels.Operation{}).
+		Scopes(lane...).
+		Select(column + " AS grp").
+		Distinct().
+		Scan(&pending).Error; err != nil {
+		return nil, false, fmt.Errorf("find pending groups: %w", err)
+	}
+	if len(pending) == 0 {
+		return nil, false, nil
+	}
+
+	// Operations in flight per group
+	var running []groupCount
+	if err := p.db.Model(&gormmodels.Operation{}).
+		Select(column+" AS grp, COUNT(*) AS count").
+		Where("status = ?", gormmodels.OpStatusProcessing).
+		Group(column).
+		Scan(&running).Error; err != nil {
+		return nil, false, fmt.Errorf("count in-flight groups: %w", err)
+	}
+
+	inFlight := make(map[string]int64)
+	var inFlightUngrouped int64
+	for _, r := range running {
+		if r.Grp == nil {
+			inFlightUngrouped = r.Count
+		} else {
+			inFlight[*r.Grp] = r.Count
+		}
+	}
+
+	// Pick the least loaded group below the cap; between equally loaded
+	// groups, the one served longest ago goes first
+	maxInFlight := int64(p.currentConfig().FairShare.MaxInFlightPerGroup)
+	var chosen *groupCount
+	var chosenCount int64
+	var chosenServed time.Time
+	for i := range pending {
+		g := &pending[i]
+		count := inFlightUngrouped
+		if g.Grp != nil {
+			count = inFlight[*g.Grp]
+		}
+		if maxInFlight > 0 && count >= maxInFlight {
+			continue
+		}
+
+		served := p.lastServed[fairShareKey(g.Grp)]
+		if chosen == nil || count < chosenCount || (count == chosenCount && served.Before(chosenServed)) {
+			chosen, chosenCount, chosenServed = g, count, served
+		}
+	}
+
+	if chosen == nil {
+		return nil, false, nil
+	}
+
+	group := chosen.Grp
+	return func(db *gorm.DB) *gorm.DB {
+		if group == nil {
+			return db.Where(column + " IS NULL")
+		}
+		return db.Where(column+" = ?", *group)
+	}, true, nil
+}
+
+// ungroupedKey stands for operations without a fair-share group
+const ungroupedKey = "\x00ungrouped"
+
+// fairShareKey returns the lastServed key for a group
+func fairShareKey(group *string) string {
+	if group == nil {
+		return ungroupedKey
+	}
+	return *group
+}
+
+// markServed records that a group was just given an operation. Called with
+// claimMutex held.
+func (p *Processor) markServed(op *gormmodels.Operation) {
+	group := op.CreatedBy
+	if p.fairShareColumn() == FairShareByCorrelation {
+		group = op.CorrelationID
+	}
+
+	now := time.Now()
+	p.lastServed[fairShareKey(group)] = now
+
+	// Forget groups that have not been served for a while
+	if len(p.lastServed) > 1000 {
+		for key, served := range p.lastServed {
+			if now.Sub(served) > 10*time.Minute {
+				delete(p.lastServed, key)
+			}
+		}
+	}
+}
@@ -0,0 +1,212 @@
+package pipeline
+
+import (
+	"context"
+	"fmt"
+	"sync"
+	"time"
+
+	"github.com/orca-ng/orca/internal/cyberark"
+	gormmodels "github.com/orca-ng/orca/internal/models/gorm"
+	"github.com/orca-ng/orca/internal/services"
+)
+
+// cyberArkSession represents an authenticated session with a CyberArk instance.
+// The client renews its own token when the vault rejects it; lastUsed only
+// tracks when the session was last handed to a worker so that idle sessions
+// can be logged off.
+type cyberArkSession struct {
+	client     *cyberark.Client
+	instanceID string
+	lastUsed   time.Time
+	mutex      sync.Mutex
+}
+
+// getOrCreateSession gets an existing session or creates a new one.
+// Sessions are shared by all workers processing operations for the same instance.
+func (p *Processor) getOrCreateSession(instanceID string) (*cyberArkSession, error) {
+	// Check for existing session
+	p.sessionsMutex.RLock()
+	session, exists := p.sessions[instanceID]
+	p.sessionsMutex.RUnlock()
+
+	if !exists {
+		// Serialize session creation so that concurrent workers for the same
+		// instance share one logon instead of racing each other. Logons to
+		// other instances go ahead, however long this one takes.
+		lock := p.sessionLock(instanceID)
+		lock.Lock()
+		defer lock.Unlock()
+
+		// Another worker may have created the session while we waited
+		p.sessionsMutex.RLock()
+		session, exists = p.sessions[instanceID]
+		p.sessionsMutex.RUnlock()
+		if !exists {
+			return p.createSession(instanceID)
+		}
+	}
+
+	session.mutex.Lock()
+	session.lastUsed = time.Now()
+	session.mutex.Unlock()
+
+	return session, nil
+}
+
+// sessionLock returns the lock serializing logons to an instance
+func (p *Processor) sessionLock(instanceID string) *sync.Mutex {
+	p.sessionsMutex.Lock()
+	defer p.sessionsMutex.Unlock()
+	lock, exists := p.sessionLocks[instanceID]
+	if !exists {
+		lock = &sync.Mutex{}
+		p.sessionLocks[instanceID] = lock
+	}
+	return lock
+}
+
+// createSession creates a new authenticated session
+func (p *Processor) createSession(instanceID string) (*cyberArkSession, error) {
+	// Load instance configuration
+	var instance gormmodels.CyberArkInstance
+	if err := p.db.Where("id = ?", instanceID).First(&instance).Error; err != nil {
+		return nil, fmt.Errorf("load instance: %w", err)
+	}
+
+	// Decrypt password
+	password, err := p.encryptor.Decrypt(instance.PasswordEncrypted)
+	if err != nil {
+		return nil, fmt.Errorf("decrypt password: %w", err)
+	}
+
+	authMethod, err := cyberark.ParseAuthMethod(instance.AuthMethod)
+	if err != nil {
+		return nil, err
+	}
+
+	clientCert, err := services.NewCertificateService().LoadClientCertificate(instance.ClientCertificate, instance.ClientKeyEncrypted, p.encryptor)
+	if err != nil {
+		return nil, fmt.Errorf("load client certificate: %w", err)
+	}
+	var trustedCAIDs []string
+	if p.certManager != nil {
+		tlsOptions, err := p.certManager.InstanceTLSOptions(context.Background(), &instance, clientCert)
+		if err != nil {
+			return nil, fmt.Errorf("load trusted certificate authorities: %w", err)
+		}
+		trustedCAIDs = tlsOptions.TrustedCAIDs
+	}
+
+	// Create client. RADIUS challenges cannot be answered here, so instances
+	// that need one fail to log on.
+	client, err := cyberark.NewClient(cyberark.Config{
+		BaseURL:           instance.BaseURL,
+		Username:          instance.Username,
+		Password:          password,
+		SkipTLSVerify:     instance.SkipTLSVerify,
+		RequestTimeout:    30 * time.Second,
+		CertManager:       p.certManager,
+		ClientCertificate: clientCert,
+		TrustedCAIDs:      trustedCAIDs,
+		Pins:              instance.PinnedCertificates,
+		Guard: p.guards.Guard(instance.ID, cyberark.Limits{
+			RequestsPerSecond: instance.RequestsPerSecond,
+			MaxInFlight:       instance.MaxInFlightRequests,
+		}),
+		Logon: cyberark.LogonOptions{
+			Method:            authMethod,
+			ConcurrentSession: instance.ConcurrentSessions,
+		},
+		Type:        cyberark.InstanceType(instance.InstanceType),
+		IdentityURL: instance.IdentityURL,
+	})
+	if err != nil {
+		return nil, fmt.Errorf("create client: %w", err)
+	}
+
+	// Authenticate up front so that bad credentials fail the operation here
+	if _, err := client.Authenticate(); err != nil {
+		return nil, fmt.Errorf("authenticate: %w", err)
+	}
+
+	// Create session
+	session := &cyberArkSession{
+		client:     client,
+		instanceID: instanceID,
+		lastUsed:   time.Now(),
+	}
+
+	// Store session
+	p.sessionsMutex.Lock()
+	oldSession := p.sessions[instanceID]
+	p.sessions[instanceID] = session
+	p.sessionsMutex.Unlock()
+
+	// Clean up old session if exists
+	if oldSession != nil {
+		go func() {
+			if err := oldSession.client.Logoff(); err != nil {
+				p.logger.WithError(err).Warn("Failed to logoff old session")
+			}
+		}()
+	}
+
+	p.logger.WithField("instance_id", instanceID).Info("Created new CyberArk session")
+
+	return session, nil
+}
+
+// cleanupSessions periodically cleans up expired sessions
+func (p *Processor) cleanupSessions() {
+	defer p.wg.Done()
+
+	ticker := time.NewTicker(5 * time.Minute)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-p.ctx.Done():
+			return
+		case <-ticker.C:
+			p.cleanupExpiredSessions()
+		}
+	}
+}
+
+// cleanupExpiredSessions removes sessions that haven't been used recently
+func (p *Processor) cleanupExpiredSessions() {
+	p.sessionsMutex.Lock()
+	defer p.sessionsMutex.Unlock()
+
+	for instanceID, session := range p.sessions {
+		session.mutex.Lock()
+		if time.Since(session.lastUsed) > 20*time.Minute && p.slots.active(instanceID) == 0 {
+			// Session expired, remove it
+			delete(p.sessions, instanceID)
+
+			// Logoff in background
+			go func(s *cyberArkSession) {
+				if err := s.client.Logoff(); err != nil {
+					p.logger.WithError(err).Warn("Failed to logoff expired session")
+				}
+			}(session)
+
+			p.logger.WithField("instance_id", instanceID).Debug("Cleaned up expired session")
+		}
+		session.mutex.Unlock()
+	}
+}
+
+// closeAllSessions closes all active sessions
+func (p *Processor) closeAllSessions() {
+	p.sessionsMutex.Lock()
+	defer p.sessionsMutex.Unlock()
+
+	for instanceID, session := range p.sessions {
+		if err := session.client.Logoff(); err != nil {
+			p.logger.WithError(err).Warn("Failed to logoff session")
+		}
+		delete(p.sessions, instanceID)
+	}
+}
@@ -32,7 +32,6 @@ func (s *Store) CreateOperation(ctx context.Context, req *CreateOperationRequest
 		Status:     gormmodels.OpStatusPending,
 		Payload:    req.Payload,
 		RetryCount: 0,
-		MaxRetries: 3, // Default, can be overridden
 		CreatedBy:  createdBy,
 	}
 	
@@ -394,7 +393,11 @@ func (s *Store) CancelOperation(ctx context.Context, id string) error {
 	result := s.db.WithContext(ctx).
 		Model(&gormmodels.Operation{}).
 		Where("id = ? AND status IN (?, ?)", id, gormmodels.OpStatusPending, gormmodels.OpStatusProcessing).
-		Update("status", gormmodels.OpStatusCancelled)
+		Updates(map[string]interface{}{
+			"status":           gormmodels.OpStatusCancelled,
+			"locked_by":        nil,
+			"lease_expires_at": nil,
+		})
 	
 	if result.Error != nil {
 		return fmt.Errorf("cancel operation: %w", result.Error)
@@ -407,56 +410,82 @@ func (s *Store) CancelOperation(ctx context.Context, id string) error {
 	return nil
 }
 
-// GetPipelineConfig retrieves pipeline configuration from database
+// Keys of the pipeline_config table
+const (
+	ConfigKeyProcessingCapacity = "processing_capacity"
+	ConfigKeyRetryPolicy        = "retry_policy"
+	ConfigKeyRetryPolicies      = "retry_policies"
+	ConfigKeyOperationTimeouts  = "operation_timeouts"
+	ConfigKeyPriorityAging      = "priority_aging"
+	ConfigKeyFairShare          = "fair_share"
+)
+
+// legacyConfigKeys were seeded by earlier versions but never read
+var legacyConfigKeys = []string{"worker_count", "max_retries", "poll_interval"}
+
+// capacitySetting is the stored form of the processing_capacity key
+type capacitySetting struct {
+	Total               int                  `json:"total"`
+	PriorityAllocation  map[Priority]float64 `json:"priority_allocation"`
+	InstanceConcurrency int                  `json:"instance_concurrency"`
+	LeaseSeconds        int                  `json:"lease_seconds"`
+}
+
+// timeoutsSetting is the stored form of the operation_timeouts key
+type timeoutsSetting struct {
+	Default           int                   `json:"default"`
+	OperationTimeouts map[OperationType]int `json:"operation_timeouts"`
+}
+
+// GetPipelineConfig retrieves pipeline configuration from database. Settings
+// that are not stored keep their defaults.
 func (s *Store) GetPipelineConfig(ctx context.Context) (*PipelineConfig, error) {
-	config := &PipelineConfig{
-		PriorityAllocation: make(map[Priority]float64),
-		OperationTimeouts:  make(map[OperationType]int),
-	}
-	
-	// Define a model for pipeline_config table
-	type pipelineConfigRow struct {
-		Key   string          `gorm:"primaryKey"`
-		Value json.RawMessage `gorm:"type:json"`
-	}
+	config := DefaultPipelineConfig()
 	
 	// Query all config values
-	var rows []pipelineConfigRow
-	if err := s.db.WithContext(ctx).
-		Table("pipeline_config").
-		Find(&rows).Error; err != nil {
+	var rows []gormmodels.PipelineConfig
+	if err := s.db.WithContext(ctx).Find(&rows).Error; err != nil {
 		return nil, fmt.Errorf("query config: %w", err)
 	}
 	
 	for _, row := range rows {
 		switch row.Key {
-		case "processing_capacity":
-			var capacityConfig struct {
-				Total              int                  `json:"total"`
-				PriorityAllocation map[Priority]float64 `json:"priority_allocation"`
+		case ConfigKeyProcessingCapacity:
+			capacity := capacitySetting{
+				Total:               config.TotalCapacity,
+				InstanceConcurrency: config.InstanceConcurrency,
+				LeaseSeconds:        config.LeaseSeconds,
 			}
-			if err := json.Unmarshal(row.Value, &capacityConfig); err != nil {
+			if err := json.Unmarshal(row.Value, &capacity); err != nil {
 				return nil, fmt.Errorf("unmarshal capacity config: %w", err)
 			}
-			config.TotalCapacity = capacityConfig.Total
-			config.PriorityAllocation = capacityConfig.PriorityAllocation
+			config.TotalCapacity = capacity.Total
+			config.InstanceConcurrency = capacity.InstanceConcurrency
+			config.LeaseSeconds = capacity.LeaseSeconds
+			if capacity.PriorityAllocation != nil {
+				config.PriorityAllocation = capacity.PriorityAllocation
+			}
 			
-		case "retry_policy":
+		case ConfigKeyRetryPolicy:
 			if err := json.Unmarshal(row.Value, &config.RetryPolicy); err != nil {
 				return nil, fmt.Errorf("unmarshal retry policy: %w", err)
 			}
 			
-		case "operation_timeouts":
-			var timeouts struct {
-				Default           int                       `json:"default"`
-				OperationTimeouts map[OperationType]int     `json:"operation_timeouts"`
+		case ConfigKeyRetryPolicies:
+			if err := json.Unmarshal(row.Value, &config.RetryPolicies); err != nil {
+				return nil, fmt.Errorf("unmarshal retry policies: %w", err)
 			}
+			if config.RetryPolicies == nil {
+				config.RetryPolicies = make(map[OperationType]RetryPolicy)
+			}
+			
+		case ConfigKeyOperationTimeouts:
+			timeouts := timeoutsSetting{Default: config.DefaultTimeout}
 			if err := json.Unmarshal(row.Value, &timeouts); err != nil {
 				// Try unmarshaling directly as map
 				if err := json.Unmarshal(row.Value, &config.OperationTimeouts); err != nil {
 					return nil, fmt.Errorf("unmarshal timeouts: %w", err)
 				}
-				config.DefaultTimeout = 300 // Default 5 minutes
 			} else {
 				config.DefaultTimeout = timeouts.Default
 				// Copy specific timeouts
@@ -464,19 +493,128 @@ func (s *Store) GetPipelineConfig(ctx context.Context) (*PipelineConfig, error)
 					config.OperationTimeouts[k] = v
 				}
 			}
+			
+		case ConfigKeyPriorityAging:
+			if err := json.Unmarshal(row.Value, &config.PriorityAging); err != nil {
+				return nil, fmt.Errorf("unmarshal priority aging: %w", err)
+			}
+			
+		case ConfigKeyFairShare:
+			if err := json.Unmarshal(row.Value, &config.FairShare); err != nil {
+				return nil, fmt.Errorf("unmarshal fair share: %w", err)
+			}
 		}
 	}
 	
-	// Set defaults if not configured
-	if config.DefaultTimeout == 0 {
-		config.DefaultTimeout = 300
-	}
-	
 	return config, nil
 }
 
+// SavePipelineConfig validates and stores a complete pipeline configuration
+func (s *Store) SavePipelineConfig(ctx context.Context, config *PipelineConfig) error {
+	if err := config.Validate(); err != nil {
+		return err
+	}
+	
+	settings := map[string]interface{}{
+		ConfigKeyProcessingCapacity: capacitySetting{
+			Total:               config.TotalCapacity,
+			PriorityAllocation:  config.PriorityAllocation,
+			InstanceConcurrency: config.InstanceConcurrency,
+			LeaseSeconds:        config.LeaseSeconds,
+		},
+		ConfigKeyRetryPolicy: config.RetryPolicy,
+		ConfigKeyRetryPolicies: config.RetryPolicies,
+		ConfigKeyOperationTimeouts: timeoutsSetting{
+			Default:           config.DefaultTimeout,
+			OperationTimeouts: config.OperationTimeouts,
+		},
+		ConfigKeyPriorityAging: config.PriorityAging,
+		ConfigKeyFairShare:     config.FairShare,
+	}
+	
+	return s.db.WithContext(ctx).Transaction(func(tx *gorm.DB) error {
+		for key, value := range settings {
+			if err := upsertConfig(tx, key, value, nil); err != nil {
+				return err
+			}
+		}
+		return nil
+	})
+}
+
+// SeedPipelineConfig stores the default value of every configuration key that
+// is missing and removes keys left behind by earlier versions
+func (s *Store) SeedPipelineConfig(ctx context.Context) error {
+	defaults := DefaultPipelineConfig()
+	
+	// Carry over a worker count configured under the old key
+	var legacy gormmodels.PipelineConfig
+	err := s.db.WithContext(ctx).Where(&gormmodels.PipelineConfig{Key: "worker_count"}).First(&legacy).Error
+	if err == nil {
+		var workerCount struct {
+			Value int `json:"value"`
+		}
+		if json.Unmarshal(legacy.Value, &workerCount) == nil && workerCount.Value > 0 {
+			defaults.TotalCapacity = workerCount.Value
+		}
+	} else if err != gorm.ErrRecordNotFound {
+		return fmt.Errorf("query legacy config: %w", err)
+	}
+	
+	seeds := []struct {
+		key   string
+		value interface{}
+		desc  string
+	}{
+		{ConfigKeyProcessingCapacity, capacitySetting{
+			Total:               defaults.TotalCapacity,
+			PriorityAllocation:  defaults.PriorityAllocation,
+			InstanceConcurrency: defaults.InstanceConcurrency,
+			LeaseSeconds:        defaults.LeaseSeconds,
+		}, "Worker count, share of workers per priority, operations in flight per instance and worker lease length"},
+		{ConfigKeyRetryPolicy, defaults.RetryPolicy, "Retry attempts and exponential backoff for failed operations"},
+		{ConfigKeyRetryPolicies, defaults.RetryPolicies, "Retry policies for specific operation types, replacing the default policy"},
+		{ConfigKeyOperationTimeouts, timeoutsSetting{
+			Default:           defaults.DefaultTimeout,
+			OperationTimeouts: defaults.OperationTimeouts,
+		}, "Operation timeouts in seconds, by operation type"},
+		{ConfigKeyPriorityAging, defaults.PriorityAging, "Promotion of waiting operations to a higher priority"},
+		{ConfigKeyFairShare, defaults.FairShare, "Fair sharing of workers between users or correlation groups"},
+	}
+	
+	return s.db.WithContext(ctx).Transaction(func(tx *gorm.DB) error {
+		for _, seed := range seeds {
+			var count int64
+			if err := tx.Model(&gormmodels.PipelineConfig{}).Where(&gormmodels.PipelineConfig{Key: seed.key}).Count(&count).Error; err != nil {
+				return fmt.Errorf("query config %s: %w", seed.key, err)
+			}
+			if count > 0 {
+				continue
+			}
+			
+			desc := seed.desc
+			if err := upsertConfig(tx, seed.key, seed.value, &desc); err != nil {
+				return err
+			}
+		}
+		
+		for _, key := range legacyConfigKeys {
+			if err := tx.Where(&gormmodels.PipelineConfig{Key: key}).Delete(&gormmodels.PipelineConfig{}).Error; err != nil {
+				return fmt.Errorf("remove legacy config %s: %w", key, err)
+			}
+		}
+		
+		return nil
+	})
+}
+
 // UpdatePipelineConfig updates pipeline configuration
 func (s *Store) UpdatePipelineConfig(ctx context.Context, key string, value interface{}) error {
+	return upsertConfig(s.db.WithContext(ctx), key, value, nil)
+}
+
+// upsertConfig creates or updates a single configuration key
+func upsertConfig(tx *gorm.DB, key string, value interface{}, description *string) error {
 	jsonValue, err := json.Marshal(value)
 	if err != nil {
 		return fmt.Errorf("marshal config value: %w", err)
@@ -484,17 +622,28 @@ func (s *Store) UpdatePipelineConfig(ctx context.Context, key string, value inte
 	
 	// Use map for updates to avoid struct tags
 	updates := map[string]interface{}{
-		"value":      jsonValue,
+		"value":      json.RawMessage(jsonValue),
 		"updated_at": time.Now(),
 	}
 	
-	result := s.db.WithContext(ctx).
-		Table("pipeline_config").
-		Where("key = ?", key).
+	// A struct condition lets GORM quote the column; key is reserved in MySQL
+	result := tx.Model(&gormmodels.PipelineConfig{}).
+		Where(&gormmodels.PipelineConfig{Key: key}).
 		Updates(updates)
-	
 	if result.Error != nil {
-		return fmt.Errorf("update config: %w", result.Error)
+		return fmt.Errorf("update config %s: %w", key, result.Error)
+	}
+	if result.RowsAffected > 0 {
+		return nil
+	}
+	
+	row := &gormmodels.PipelineConfig{
+		Key:         key,
+		Value:       jsonValue,
+		Description: description,
+	}
+	if err := tx.Create(row).Error; err != nil {
+		return fmt.Errorf("create config %s: %w", key, err)
 	}
 	
 	return nil
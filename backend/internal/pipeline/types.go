@@ -3,6 +3,7 @@ package pipeline
 import (
 	"context"
 	"encoding/json"
+	"math/rand"
 	"time"
 )
 
@@ -50,7 +51,7 @@ type Operation struct {
 	Result             *json.RawMessage `json:"result,omitempty" db:"result"`
 	ErrorMessage       *string          `json:"error_message,omitempty" db:"error_message"`
 	RetryCount         int              `json:"retry_count" db:"retry_count"`
-	MaxRetries         int              `json:"max_retries" db:"max_retries"`
+	MaxRetries         int              `json:"max_retries" db:"max_retries"` // 0 follows the retry policy
 	ScheduledAt        time.Time        `json:"scheduled_at" db:"scheduled_at"`
 	StartedAt          *time.Time       `json:"started_at,omitempty" db:"started_at"`
 	CompletedAt        *time.Time       `json:"completed_at,omitempty" db:"completed_at"`
@@ -84,11 +85,87 @@ type PipelineConfig struct {
 	// Retry policy
 	RetryPolicy RetryPolicy `json:"retry_policy"`
 	
+	// Retry policies for specific operation types, replacing RetryPolicy
+	RetryPolicies map[OperationType]RetryPolicy `json:"retry_policies"`
+	
 	// Operation timeouts in seconds
 	OperationTimeouts map[OperationType]int `json:"operation_timeouts"`
 	
 	// Default timeout for operations not in the map
 	DefaultTimeout int `json:"default_timeout"`
+	
+	// Maximum operations in flight per CyberArk instance across all replicas
+	// (0 = limited only by TotalCapacity). Instances without concurrent
+	// sessions always get 1.
+	InstanceConcurrency int `json:"instance_concurrency"`
+	
+	// How long a claimed operation stays locked to a processor without a
+	// heartbeat before another processor may reclaim it
+	LeaseSeconds int `json:"lease_seconds"`
+	
+	// Priority aging so that waiting operations are not starved
+	PriorityAging PriorityAging `json:"priority_aging"`
+	
+	// Fair-share scheduling between submitters
+	FairShare FairShare `json:"fair_share"`
+}
+
+// PriorityAging raises the effective priority of pending operations by one
+// level for every interval they have been waiting
+type PriorityAging struct {
+	Enabled         bool `json:"enabled"`
+	IntervalSeconds int  `json:"interval_seconds"`
+}
+
+// FairShare spreads processing capacity across groups of operations, so one
+// user submitting thousands of operations cannot block everyone else.
+// Operations are grouped by the user who created them or by correlation ID.
+type FairShare struct {
+	Enabled bool   `json:"enabled"`
+	GroupBy string `json:"group_by"` // created_by or correlation_id
+	
+	// Maximum operations in flight per group across all replicas (0 = no cap)
+	MaxInFlightPerGroup int `json:"max_in_flight_per_group"`
+}
+
+// Fair-share grouping keys
+const (
+	FairShareByCreator     = "created_by"
+	FairShareByCorrelation = "correlation_id"
+)
+
+// DefaultPipelineConfig returns the configuration used when nothing is stored
+func DefaultPipelineConfig() *PipelineConfig {
+	return &PipelineConfig{
+		TotalCapacity: 5,
+		PriorityAllocation: map[Priority]float64{
+			PriorityHigh:   0.5,
+			PriorityNormal: 0.3,
+			PriorityLow:    0.2,
+		},
+		RetryPolicy: RetryPolicy{
+			MaxAttempts:          3,
+			BackoffBaseSeconds:   10,
+			BackoffMultiplier:    2,
+			BackoffMaxSeconds:    300, // 5 minutes
+			HonorRetryAfter:      true,
+			MaxRetryAfterSeconds: 600,
+			ReauthOnAuthExpired:  true,
+		},
+		RetryPolicies:       make(map[OperationType]RetryPolicy),
+		OperationTimeouts:   make(map[OperationType]int),
+		DefaultTimeout:      300, // 5 minutes
+		InstanceConcurrency: 3,
+		LeaseSeconds:        60,
+		PriorityAging: PriorityAging{
+			Enabled:         true,
+			IntervalSeconds: 300, // one level per 5 minutes waiting
+		},
+		FairShare: FairShare{
+			Enabled: true,
+			GroupBy: FairShareByCreator,
+		},
+	}
 }
 
 // RetryPolicy defines retry behavior
@@ -96,7 +173,98 @@ type RetryPolicy struct {
 	MaxAttempts        int  `json:"max_attempts"`
 	BackoffBaseSeconds int  `json:"backoff_base_seconds"`
 	BackoffMultiplier  int  `json:"backoff_multiplier"`
+	BackoffMaxSeconds  int  `json:"backoff_max_seconds"`
 	BackoffJitter      bool `json:"backoff_jitter"`
+	
+	// Error classes that are retried (empty = transient, rate_limited,
+	// network and timeout). Errors without a class are left to the
+	// handler's CanRetry.
+	RetryOn []ErrorClass `json:"retry_on,omitempty"`
+	
+	// Wait for the server's Retry-After delay on HTTP 429 instead of the
+	// backoff, up to MaxRetryAfterSeconds
+	HonorRetryAfter      bool `json:"honor_retry_after"`
+	MaxRetryAfterSeconds int  `json:"max_retry_after_seconds"`
+	
+	// Log on again and rerun the operation right away when the session
+	// token has expired. This does not count as a retry.
+	ReauthOnAuthExpired bool `json:"reauth_on_auth_expired"`
+}
+
+// RetryPolicyFor returns the retry policy for an operation type
+func (c *PipelineConfig) RetryPolicyFor(opType OperationType) RetryPolicy {
+	if policy, ok := c.RetryPolicies[opType]; ok {
+		return policy
+	}
+	return c.RetryPolicy
+}
+
+// Retries reports whether the policy retries errors of the given class
+func (r RetryPolicy) Retries(class ErrorClass) bool {
+	retryOn := r.RetryOn
+	if len(retryOn) == 0 {
+		retryOn = defaultRetryOn
+	}
+	for _, c := range retryOn {
+		if c == class {
+			return true
+		}
+	}
+	return false
+}
+
+// Exhausted reports whether an operation retried retryCount times may not be
+// retried again. A positive maxRetries, set on the operation, lowers the
+// policy's limit for it.
+func (r RetryPolicy) Exhausted(retryCount, maxRetries int) bool {
+	limit := r.MaxAttempts
+	if maxRetries > 0 {
+		limit = min(limit, maxRetries)
+	}
+	return retryCount >= limit
+}
+
+// RetryAfter returns the delay to use for a server-requested Retry-After,
+// capped at the policy maximum
+func (r RetryPolicy) RetryAfter(requested time.Duration) time.Duration {
+	if r.MaxRetryAfterSeconds > 0 {
+		if limit := time.Duration(r.MaxRetryAfterSeconds) * time.Second; requested > limit {
+			return limit
+		}
+	}
+	return requested
+}
+
+// Backoff returns the delay before the given retry (starting at 1):
+// base * multiplier^(retry-1), capped at the maximum. Jitter spreads the
+// delay by up to 20% either way so that retries do not arrive in bursts.
+func (r RetryPolicy) Backoff(retry int) time.Duration {
+	base := r.BackoffBaseSeconds
+	if base < 1 {
+		base = 1
+	}
+	multiplier := r.BackoffMultiplier
+	if multiplier < 1 {
+		multiplier = 1
+	}
+	maxSeconds := r.BackoffMaxSeconds
+	if maxSeconds < 1 {
+		maxSeconds = 300
+	}
+
+	seconds := float64(base)
+	for i := 1; i < retry && seconds < float64(maxSeconds); i++ {
+		seconds *= float64(multiplier)
+	}
+	if seconds > float64(maxSeconds) {
+		seconds = float64(maxSeconds)
+	}
+
+	if r.BackoffJitter {
+		seconds *= 0.8 + 0.4*rand.Float64()
+	}
+
+	return time.Duration(seconds * float64(time.Second))
 }
 
 // ProcessingMetrics holds pipeline performance metrics
@@ -107,6 +275,10 @@ type ProcessingMetrics struct {
 	FailedCount        map[OperationType]int64 `json:"failed_count"`
 	AvgProcessingTime  map[OperationType]float64 `json:"avg_processing_time"`
 	WorkerUtilization  float64                `json:"worker_utilization"`
+	ActiveWorkers      int                    `json:"active_workers"`
+	TotalWorkers       int                    `json:"total_workers"`
+	InstanceInFlight   map[string]int         `json:"instance_in_flight"`
+	ActiveSessions     int                    `json:"active_sessions"`
 }
 
 // CreateOperationRequest represents an API request to create an operation
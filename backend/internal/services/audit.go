@@ -0,0 +1,303 @@
+package services
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"reflect"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/sirupsen/logrus"
+	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
+
+	"github.com/orca-ng/orca/internal/database"
+	gormmodels "github.com/orca-ng/orca/internal/models/gorm"
+	"github.com/orca-ng/orca/pkg/ulid"
+)
+
+// errChainMoved means another replica appended to the audit chain first
+var errChainMoved = errors.New("audit chain head moved")
+
+// auditAppendAttempts bounds the retries of an append racing other replicas
+const auditAppendAttempts = 10
+
+// AuditService records security audit events in an append-only hash chain
+type AuditService struct {
+	db     *database.GormDB
+	logger *logrus.Logger
+	mu     sync.Mutex // appends of this replica wait for each other instead of retrying
+
+	forwarder *AuditForwarder // set by EnableForwarding
+}
+
+// NewAuditService creates a new audit service
+func NewAuditService(db *database.GormDB, logger *logrus.Logger) *AuditService {
+	return &AuditService{
+		db:     db,
+		logger: logger,
+	}
+}
+
+// EnableForwarding sends every recorded event to the forwarder's sinks.
+// It must be called before events are recorded.
+func (a *AuditService) EnableForwarding(forwarder *AuditForwarder) {
+	a.forwarder = forwarder
+}
+
+// Record appends an audit event to the chain
+func (a *AuditService) Record(ctx context.Context, event *gormmodels.AuditEvent) error {
+	a.mu.Lock()
+	defer a.mu.Unlock()
+
+	var err error
+	for attempt := 0; attempt < auditAppendAttempts; attempt++ {
+		if err = a.append(ctx, event); !errors.Is(err, errChainMoved) {
+			break
+		}
+	}
+	if err != nil {
+		return fmt.Errorf("record audit event %s: %w", event.Action, err)
+	}
+	a.logger.WithFields(logrus.Fields{
+		"action":     event.Action,
+		"actor":      event.ActorName,
+		"target":     event.Target,
+		"client_ip":  event.ClientIP,
+		"request_id": event.RequestID,
+		"sequence":   event.Sequence,
+	}).Debug("Recorded audit event")
+	if a.forwarder != nil {
+		a.forwarder.ForwardAuditEvent(event)
+	}
+	return nil
+}
+
+func (a *AuditService) append(ctx context.Context, event *gormmodels.AuditEvent) error {
+	return a.db.WithContext(ctx).Transaction(func(tx *gorm.DB) error {
+		if err := tx.Clauses(clause.OnConflict{DoNothing: true}).
+			Create(&gormmodels.AuditChainHead{ID: gormmodels.AuditChainID}).Error; err != nil {
+			return err
+		}
+		var head gormmodels.AuditChainHead
+		if err := tx.First(&head, "id = ?", gormmodels.AuditChainID).Error; err != nil {
+			return err
+		}
+
+		if event.ID == "" {
+			event.ID = ulid.New(ulid.AuditEventPrefix)
+		}
+		event.Sequence = head.Sequence + 1
+		event.PrevHash = head.Hash
+		// Databases keep timestamps at different precisions, the hash covers
+		// milliseconds
+		event.CreatedAt = time.Now().UTC().Truncate(time.Millisecond)
+		event.Hash = event.ComputeHash()
+
+		result := tx.Model(&gormmodels.AuditChainHead{}).
+			Where("id = ? AND sequence = ?", gormmodels.AuditChainID, head.Sequence).
+			Updates(map[string]interface{}{"sequence": event.Sequence, "hash": event.Hash})
+		if result.Error != nil {
+			return result.Error
+		}
+		if result.RowsAffected == 0 {
+			return errChainMoved
+		}
+		return tx.Create(event).Error
+	})
+}
+
+// AuditQuery filters audit events. Empty fields match everything.
+type AuditQuery struct {
+	Action    string // an action, or a prefix of actions ending in "*" such as "user.*"
+	ActorID   string
+	ActorName string
+	Target    string
+	RequestID string
+	ClientIP  string
+	Since     time.Time
+	Until     time.Time
+	Limit     int
+	Offset    int
+}
+
+// Query returns the audit events matching a query, newest first, and how
+// many there are in total
+func (a *AuditService) Query(ctx context.Context, q AuditQuery) ([]gormmodels.AuditEvent, int64, error) {
+	query := a.db.WithContext(ctx).Model(&gormmodels.AuditEvent{})
+	if q.Action != "" {
+		if prefix, ok := strings.CutSuffix(q.Action, "*"); ok {
+			query = query.Where("action LIKE ?", prefix+"%")
+		} else {
+			query = query.Where("action = ?", q.Action)
+		}
+	}
+	if q.ActorID != "" {
+		query = query.Where("actor_id = ?", q.ActorID)
+	}
+	if q.ActorName != "" {
+		query = query.Where("actor_name = ?", q.ActorName)
+	}
+	if q.Target != "" {
+		query = query.Where("target = ?", q.Target)
+	}
+	if q.RequestID != "" {
+		query = query.Where("request_id = ?", q.RequestID)
+	}
+	if q.ClientIP != "" {
+		query = query.Where("client_ip = ?", q.ClientIP)
+	}
+	if !q.Since.IsZero() {
+		query = query.Where("created_at >= ?", q.Since.UTC())
+	}
+	if !q.Until.IsZero() {
+		query = query.Where("created_at < ?", q.Until.UTC())
+	}
+
+	var total int64
+	if err := query.Count(&total).Error; err != nil {
+		return nil, 0, fmt.Errorf("count audit events: %w", err)
+	}
+	limit := q.Limit
+	if limit <= 0 || limit > 1000 {
+		limit = 100
+	}
+	var events []gormmodels.AuditEvent
+	if err := query.Order("created_at DESC").Order("sequence DESC").
+		Limit(limit).Offset(q.Offset).
+		Find(&events).Error; err != nil {
+		return nil, 0, fmt.Errorf("query audit events: %w", err)
+	}
+	return events, total, nil
+}
+
+// AuditVerification is the result of checking the audit hash chain
+type AuditVerification struct {
+	Valid     bool   `json:"valid"`
+	Events    int64  `json:"events"`    // chained events checked
+	Unchained int64  `json:"unchained"` // events recorded before the chain existed
+	LastHash  string `json:"last_hash,omitempty"`
+	BrokenAt  int64  `json:"broken_at,omitempty"` // sequence where the chain breaks
+	Problem   string `json:"problem,omitempty"`
+}
+
+// auditVerifyBatch is how many events verification reads at a time
+const auditVerifyBatch = 500
+
+// Verify walks the audit hash chain and reports the first event that was
+// changed, removed or inserted
+func (a *AuditService) Verify(ctx context.Context) (*AuditVerification, error) {
+	db := a.db.WithContext(ctx)
+	result := &AuditVerification{}
+	if err := db.Model(&gormmodels.AuditEvent{}).Where("sequence = 0").Count(&result.Unchained).Error; err != nil {
+		return nil, fmt.Errorf("count unchained audit events: %w", err)
+	}
+
+	broken := func(sequence int64, problem string) (*AuditVerification, error) {
+		result.BrokenAt = sequence
+		result.Problem = problem
+		return result, nil
+	}
+
+	var expected int64 = 1
+	prevHash := ""
+	for offset := 0; ; offset += auditVerifyBatch {
+		var events []gormmodels.AuditEvent
+		if err := db.Where("sequence > 0").
+			Order("sequence ASC").Order("id ASC").
+			Offset(offset).Limit(auditVerifyBatch).
+			Find(&events).Error; err != nil {
+			return nil, fmt.Errorf("read audit events: %w", err)
+		}
+		for i := range events {
+			event := &events[i]
+			switch {
+			case event.Sequence < expected:
+				return broken(event.Sequence, fmt.Sprintf("event %s repeats sequence %d", event.ID, event.Sequence))
+			case event.Sequence > expected:
+				return broken(expected, fmt.Sprintf("event %d is missing", expected))
+			case event.PrevHash != prevHash:
+				return broken(event.Sequence, fmt.Sprintf("event %s does not follow the event before it", event.ID))
+			case event.ComputeHash() != event.Hash:
+				return broken(event.Sequence, fmt.Sprintf("event %s was modified", event.ID))
+			}
+			prevHash = event.Hash
+			expected++
+			result.Events++
+			result.LastHash = event.Hash
+		}
+		if len(events) < auditVerifyBatch {
+			break
+		}
+	}
+
+	// The head catches events removed from the end of the chain
+	var head gormmodels.AuditChainHead
+	err := db.First(&head, "id = ?", gormmodels.AuditChainID).Error
+	if err != nil && !errors.Is(err, gorm.ErrRecordNotFound) {
+		return nil, fmt.Errorf("read audit chain head: %w", err)
+	}
+	if head.Sequence != result.Events || head.Hash != prevHash {
+		return broken(result.Events+1, fmt.Sprintf("the chain ends at event %d but %d were recorded", result.Events, head.Sequence))
+	}
+
+	result.Valid = true
+	return result, nil
+}
+
+// AuditChanges compares two values by their JSON fields and returns the
+// fields that differ. Either value may be nil for something created or
+// deleted. Fields hidden from JSON, such as secrets, are never included.
+func AuditChanges(before, after interface{}) map[string]gormmodels.AuditChange {
+	beforeFields, afterFields := auditFields(before), auditFields(after)
+	changes := make(map[string]gormmodels.AuditChange)
+	for name, value := range afterFields {
+		if old, found := beforeFields[name]; !found || !reflect.DeepEqual(old, value) {
+			changes[name] = gormmodels.AuditChange{Before: auditValue(beforeFields[name]), After: auditValue(value)}
+		}
+	}
+	for name, value := range beforeFields {
+		if _, found := afterFields[name]; !found {
+			changes[name] = gormmodels.AuditChange{Before: auditValue(value)}
+		}
+	}
+	for _, name := range auditIgnoredFields {
+		delete(changes, name)
+	}
+	if len(changes) == 0 {
+		return nil
+	}
+	return changes
+}
+
+// auditIgnoredFields change with every update and say nothing about it
+var auditIgnoredFields = []string{"created_at", "updated_at", "updated_by"}
+
+func auditFields(value interface{}) map[string]interface{} {
+	if value == nil || (reflect.ValueOf(value).Kind() == reflect.Ptr && reflect.ValueOf(value).IsNil()) {
+		return nil
+	}
+	data, err := json.Marshal(value)
+	if err != nil {
+		return nil
+	}
+	var fields map[string]interface{}
+	if err := json.Unmarshal(data, &fields); err != nil {
+		return nil
+	}
+	return fields
+}
+
+func auditValue(value interface{}) string {
+	switch v := value.(type) {
+	case nil:
+		return ""
+	case string:
+		return v
+	}
+	data, _ := json.Marshal(value)
+	return string(data)
+}
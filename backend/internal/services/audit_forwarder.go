@@ -0,0 +1,190 @@
+package services
+
+import (
+	"context"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"github.com/sirupsen/logrus"
+
+	gormmodels "github.com/orca-ng/orca/internal/models/gorm"
+)
+
+const (
+	// auditMaxRetryWait caps the doubling wait between delivery attempts
+	auditMaxRetryWait = time.Minute
+
+	// auditFlushTimeout bounds sending the queued records on shutdown
+	auditFlushTimeout = 5 * time.Second
+)
+
+// AuditForwarder delivers audit records to sinks in the background. Each
+// sink has a queue of its own and retries failed deliveries in order until
+// they succeed; records arriving while its queue is full are dropped rather
+// than holding up the caller.
+type AuditForwarder struct {
+	queues []*auditSinkQueue
+	retry  time.Duration
+	logger *logrus.Logger
+	wg     sync.WaitGroup
+}
+
+type auditSinkQueue struct {
+	sink    AuditSink
+	records chan *AuditRecord
+	dropped atomic.Int64 // records dropped since the last delivery
+}
+
+// NewAuditForwarder creates a forwarder queueing up to bufferSize records
+// per sink and waiting retry before the first retry of a failed delivery
+func NewAuditForwarder(sinks []AuditSink, bufferSize int, retry time.Duration, logger *logrus.Logger) *AuditForwarder {
+	f := &AuditForwarder{
+		retry:  retry,
+		logger: logger,
+	}
+	for _, sink := range sinks {
+		f.queues = append(f.queues, &auditSinkQueue{
+			sink:    sink,
+			records: make(chan *AuditRecord, bufferSize),
+		})
+	}
+	return f
+}
+
+// Start delivers queued records until ctx is done. Records still queued
+// then are sent once more, briefly, before the sinks are closed.
+func (f *AuditForwarder) Start(ctx context.Context) {
+	for _, queue := range f.queues {
+		f.wg.Add(1)
+		go f.run(ctx, queue)
+		f.logger.WithField("sink", queue.sink.Name()).Info("Audit forwarding enabled")
+	}
+}
+
+// Wait blocks until the sinks are closed after the context passed to Start
+// is done
+func (f *AuditForwarder) Wait() {
+	f.wg.Wait()
+}
+
+// ForwardAuditEvent queues a recorded audit event for every sink
+func (f *AuditForwarder) ForwardAuditEvent(event *gormmodels.AuditEvent) {
+	f.forward(auditEventRecord(event))
+}
+
+// ForwardOperationEvent queues an operation lifecycle event for every sink
+func (f *AuditForwarder) ForwardOperationEvent(event *OperationEvent) {
+	if record := operationEventRecord(event); record != nil {
+		f.forward(record)
+	}
+}
+
+func (f *AuditForwarder) forward(record *AuditRecord) {
+	for _, queue := range f.queues {
+		select {
+		case queue.records <- record:
+		default:
+			if queue.dropped.Add(1) == 1 {
+				f.logger.WithField("sink", queue.sink.Name()).Warn("Audit forwarding queue full, dropping events")
+			}
+		}
+	}
+}
+
+// idler is implemented by sinks that let go of resources while no records
+// are waiting
+type idler interface {
+	Idle()
+}
+
+func (f *AuditForwarder) run(ctx context.Context, queue *auditSinkQueue) {
+	defer f.wg.Done()
+	defer queue.sink.Close()
+
+	for {
+		var record *AuditRecord
+		select {
+		case <-ctx.Done():
+			f.flush(queue, nil)
+			return
+		case record = <-queue.records:
+		}
+		if !f.deliver(ctx, queue, record) {
+			f.flush(queue, record)
+			return
+		}
+		if len(queue.records) == 0 {
+			if sink, ok := queue.sink.(idler); ok {
+				sink.Idle()
+			}
+		}
+	}
+}
+
+// deliver sends a record until it succeeds, returning false when ctx is done
+// first
+func (f *AuditForwarder) deliver(ctx context.Context, queue *auditSinkQueue, record *AuditRecord) bool {
+	wait := f.retry
+	for attempt := 1; ; attempt++ {
+		err := queue.sink.Send(record)
+		if err == nil {
+			if attempt > 1 {
+				f.logger.WithField("sink", queue.sink.Name()).Info("Audit forwarding recovered")
+			}
+			if dropped := queue.dropped.Swap(0); dropped > 0 {
+				f.logger.WithFields(logrus.Fields{
+					"sink":    queue.sink.Name(),
+					"dropped": dropped,
+				}).Warn("Audit events were dropped while the forwarding queue was full")
+			}
+			return true
+		}
+
+		f.logger.WithError(err).WithFields(logrus.Fields{
+			"sink":    queue.sink.Name(),
+			"action":  record.Action,
+			"attempt": attempt,
+			"queued":  len(queue.records),
+		}).Warn("Failed to forward audit event, retrying")
+
+		select {
+		case <-ctx.Done():
+			return false
+		case <-time.After(wait):
+		}
+		wait = min(2*wait, auditMaxRetryWait)
+	}
+}
+
+// flush makes a last attempt at sending the record that was being delivered
+// and the queued ones, giving up at the first failure
+func (f *AuditForwarder) flush(queue *auditSinkQueue, pending *AuditRecord) {
+	deadline := time.Now().Add(auditFlushTimeout)
+	lost := len(queue.records)
+	if pending != nil {
+		lost++
+	}
+	for time.Now().Before(deadline) {
+		record := pending
+		pending = nil
+		if record == nil {
+			select {
+			case record = <-queue.records:
+			default:
+				return
+			}
+		}
+		if err := queue.sink.Send(record); err != nil {
+			lost = len(queue.records) + 1
+			break
+		}
+		lost = len(queue.records)
+	}
+	if lost > 0 {
+		f.logger.WithFields(logrus.Fields{
+			"sink": queue.sink.Name(),
+			"lost": lost,
+		}).Warn("Audit events not forwarded before shutdown")
+	}
+}
@@ -0,0 +1,379 @@
+package services_test
+
+import (
+	"bufio"
+	"context"
+	"crypto/tls"
+	"crypto/x509"
+	"encoding/json"
+	"encoding/pem"
+	"errors"
+	"io"
+	"net"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/sirupsen/logrus"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/orca-ng/orca/internal/config"
+	gormmodels "github.com/orca-ng/orca/internal/models/gorm"
+	"github.com/orca-ng/orca/internal/services"
+)
+
+func testAuditRecord() *services.AuditRecord {
+	return &services.AuditRecord{
+		ID:        "aev_1",
+		Time:      time.Date(2026, 10, 18, 12, 0, 0, 0, time.UTC),
+		Category:  "audit",
+		Action:    gormmodels.AuditInstanceDeleted,
+		Severity:  5,
+		ActorID:   "usr_1",
+		ActorName: "admin",
+		Target:    "instance:cai_1",
+		ClientIP:  "192.0.2.1",
+		UserAgent: "curl/8.0",
+		RequestID: "req-1",
+		Details:   map[string]string{"note": "a=b|c\nd"},
+		Sequence:  42,
+		Hash:      "abc",
+	}
+}
+
+func TestFormatCEF(t *testing.T) {
+	message := services.FormatCEF(testAuditRecord())
+
+	assert.True(t, strings.HasPrefix(message, "CEF:0|ORCA|ORCA|1.0|instance.deleted|instance deleted|5|rt=1792324800000 "), message)
+	for _, field := range []string{
+		"act=instance.deleted",
+		"externalId=aev_1",
+		"suid=usr_1",
+		"suser=admin",
+		"src=192.0.2.1",
+		"requestClientApplication=curl/8.0",
+		"cs1Label=target cs1=instance:cai_1",
+		"cs2Label=requestId cs2=req-1",
+		`cs3Label=details cs3={"note":"a\=b|c\\nd"}`,
+		"cs5Label=hash cs5=abc",
+		"cn1Label=sequence cn1=42",
+	} {
+		assert.Contains(t, message, field)
+	}
+	assert.NotContains(t, message, "cs4")
+	assert.NotContains(t, message, "\n")
+}
+
+func TestFormatLEEF(t *testing.T) {
+	record := testAuditRecord()
+	record.UserAgent = "agent\twith tab"
+	message := services.FormatLEEF(record)
+
+	header, attributes, found := strings.Cut(message, "|x09|")
+	require.True(t, found, message)
+	assert.Equal(t, "LEEF:2.0|ORCA|ORCA|1.0|instance.deleted", header)
+	fields := strings.Split(attributes, "\t")
+	for _, field := range []string{
+		"devTime=1792324800000",
+		"devTimeFormat=epoch",
+		"cat=audit",
+		"sev=5",
+		"usrName=admin",
+		"src=192.0.2.1",
+		`userAgent=agent\twith tab`,
+		"target=instance:cai_1",
+		"requestId=req-1",
+		"sequence=42",
+	} {
+		assert.Contains(t, fields, field)
+	}
+}
+
+func TestSyslogSinkUDP(t *testing.T) {
+	conn, err := net.ListenPacket("udp", "127.0.0.1:0")
+	require.NoError(t, err)
+	defer conn.Close()
+
+	sink, err := services.NewSyslogSink(config.AuditSyslogConfig{
+		Network: "udp", Address: conn.LocalAddr().String(), Format: "cef", Facility: 13, Hostname: "orca-1",
+	})
+	require.NoError(t, err)
+	defer sink.Close()
+	require.NoError(t, sink.Send(testAuditRecord()))
+
+	buf := make([]byte, 4096)
+	conn.SetReadDeadline(time.Now().Add(5 * time.Second))
+	n, _, err := conn.ReadFrom(buf)
+	require.NoError(t, err)
+	message := string(buf[:n])
+	// Facility 13 and notice severity
+	assert.Regexp(t, `^<109>1 2026-10-18T12:00:00.000Z orca-1 orca \d+ instance.deleted - CEF:0\|`, message)
+}
+
+// readFramed reads one octet counted syslog message
+func readFramed(t *testing.T, r *bufio.Reader) string {
+	t.Helper()
+	length, err := r.ReadString(' ')
+	require.NoError(t, err)
+	n, err := strconv.Atoi(strings.TrimSuffix(length, " "))
+	require.NoError(t, err)
+	message := make([]byte, n)
+	_, err = io.ReadFull(r, message)
+	require.NoError(t, err)
+	return string(message)
+}
+
+func TestSyslogSinkTCPReconnects(t *testing.T) {
+	listener, err := net.Listen("tcp", "127.0.0.1:0")
+	require.NoError(t, err)
+	defer listener.Close()
+
+	sink, err := services.NewSyslogSink(config.AuditSyslogConfig{
+		Network: "tcp", Address: listener.Addr().String(), Format: "leef", Facility: 10,
+	})
+	require.NoError(t, err)
+	defer sink.Close()
+
+	record := testAuditRecord()
+	require.NoError(t, sink.Send(record))
+	conn, err := listener.Accept()
+	require.NoError(t, err)
+	message := readFramed(t, bufio.NewReader(conn))
+	assert.Contains(t, message, " - LEEF:2.0|ORCA|ORCA|1.0|instance.deleted|x09|")
+	assert.True(t, strings.HasPrefix(message, "<85>1 "), message)
+
+	// The collector going away fails a send, after which the sink reconnects
+	conn.Close()
+	require.Eventually(t, func() bool { return sink.Send(record) != nil }, 5*time.Second, 10*time.Millisecond)
+	require.NoError(t, sink.Send(record))
+	conn, err = listener.Accept()
+	require.NoError(t, err)
+	defer conn.Close()
+	assert.Contains(t, readFramed(t, bufio.NewReader(conn)), "LEEF:2.0")
+}
+
+func TestSyslogSinkTLS(t *testing.T) {
+	key := generatePrivateKey(t)
+	template := createCertTemplate("syslog", true, true)
+	template.IPAddresses = []net.IP{net.ParseIP("127.0.0.1")}
+	template.ExtKeyUsage = []x509.ExtKeyUsage{x509.ExtKeyUsageServerAuth}
+	certPEM := encodeCertToPEM(createCertificate(t, template, template, &key.PublicKey, key))
+	keyPEM := pem.EncodeToMemory(&pem.Block{Type: "RSA PRIVATE KEY", Bytes: x509.MarshalPKCS1PrivateKey(key)})
+	cert, err := tls.X509KeyPair([]byte(certPEM), keyPEM)
+	require.NoError(t, err)
+
+	listener, err := tls.Listen("tcp", "127.0.0.1:0", &tls.Config{Certificates: []tls.Certificate{cert}})
+	require.NoError(t, err)
+	defer listener.Close()
+	received := make(chan string, 1)
+	go func() {
+		for {
+			conn, err := listener.Accept()
+			if err != nil {
+				return
+			}
+			go func() {
+				defer conn.Close()
+				r := bufio.NewReader(conn)
+				length, err := r.ReadString(' ')
+				if err != nil {
+					return
+				}
+				n, _ := strconv.Atoi(strings.TrimSuffix(length, " "))
+				message := make([]byte, n)
+				if _, err := io.ReadFull(r, message); err == nil {
+					received <- string(message)
+				}
+			}()
+		}
+	}()
+
+	cfg := config.AuditSyslogConfig{Network: "tls", Address: listener.Addr().String(), Format: "cef", Facility: 13}
+
+	// The server is not trusted without its CA
+	untrusted, err := services.NewSyslogSink(cfg)
+	require.NoError(t, err)
+	assert.Error(t, untrusted.Send(testAuditRecord()))
+
+	cfg.CAFile = filepath.Join(t.TempDir(), "ca.pem")
+	require.NoError(t, os.WriteFile(cfg.CAFile, []byte(certPEM), 0o600))
+	sink, err := services.NewSyslogSink(cfg)
+	require.NoError(t, err)
+	defer sink.Close()
+	require.NoError(t, sink.Send(testAuditRecord()))
+
+	select {
+	case message := <-received:
+		assert.Contains(t, message, "CEF:0|ORCA|ORCA|1.0|instance.deleted|")
+	case <-time.After(5 * time.Second):
+		t.Fatal("no message received")
+	}
+}
+
+// flakySink fails until it is told to recover, and blocks while held
+type flakySink struct {
+	mu       sync.Mutex
+	failing  bool
+	hold     chan struct{}
+	entered  chan struct{} // signalled when a held send starts
+	attempts int
+	received []string
+}
+
+func (s *flakySink) Name() string { return "flaky" }
+
+func (s *flakySink) Send(record *services.AuditRecord) error {
+	if s.hold != nil {
+		select {
+		case s.entered <- struct{}{}:
+		default:
+		}
+		<-s.hold
+	}
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.attempts++
+	if s.failing {
+		return errors.New("collector unreachable")
+	}
+	s.received = append(s.received, record.Action)
+	return nil
+}
+
+func (s *flakySink) Close() error { return nil }
+
+func (s *flakySink) setFailing(failing bool) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.failing = failing
+}
+
+func (s *flakySink) snapshot() (int, []string) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return s.attempts, append([]string(nil), s.received...)
+}
+
+func TestAuditForwarderRetries(t *testing.T) {
+	sink := &flakySink{failing: true}
+	forwarder := services.NewAuditForwarder([]services.AuditSink{sink}, 10, 10*time.Millisecond, logrus.New())
+	ctx, cancel := context.WithCancel(context.Background())
+	forwarder.Start(ctx)
+
+	forwarder.ForwardAuditEvent(&gormmodels.AuditEvent{Action: "first"})
+	forwarder.ForwardAuditEvent(&gormmodels.AuditEvent{Action: "second"})
+	require.Eventually(t, func() bool {
+		attempts, _ := sink.snapshot()
+		return attempts >= 3
+	}, 5*time.Second, 5*time.Millisecond)
+
+	// Events are delivered in order once the sink recovers
+	sink.setFailing(false)
+	require.Eventually(t, func() bool {
+		_, received := sink.snapshot()
+		return len(received) == 2
+	}, 5*time.Second, 5*time.Millisecond)
+	_, received := sink.snapshot()
+	assert.Equal(t, []string{"first", "second"}, received)
+
+	cancel()
+	forwarder.Wait()
+}
+
+func TestAuditForwarderDoesNotBlock(t *testing.T) {
+	sink := &flakySink{hold: make(chan struct{}), entered: make(chan struct{}, 1)}
+	forwarder := services.NewAuditForwarder([]services.AuditSink{sink}, 2, time.Millisecond, logrus.New())
+	ctx, cancel := context.WithCancel(context.Background())
+	forwarder.Start(ctx)
+
+	// One event is being sent, two are queued and the rest are dropped
+	forwarder.ForwardAuditEvent(&gormmodels.AuditEvent{Action: "event.0"})
+	<-sink.entered
+	done := make(chan struct{})
+	go func() {
+		for i := 1; i < 10; i++ {
+			forwarder.ForwardAuditEvent(&gormmodels.AuditEvent{Action: "event." + strconv.Itoa(i)})
+		}
+		close(done)
+	}()
+	select {
+	case <-done:
+	case <-time.After(5 * time.Second):
+		t.Fatal("forwarding blocked on a stuck sink")
+	}
+
+	close(sink.hold)
+	require.Eventually(t, func() bool {
+		_, received := sink.snapshot()
+		return len(received) == 3
+	}, 5*time.Second, 5*time.Millisecond)
+	cancel()
+	forwarder.Wait()
+	_, received := sink.snapshot()
+	assert.Equal(t, "event.0", received[0])
+	assert.Len(t, received, 3)
+}
+
+func TestAuditForwarding(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "audit.jsonl")
+	sinks, err := services.NewAuditSinks(config.AuditConfig{File: config.AuditFileConfig{Enabled: true, Path: path}})
+	require.NoError(t, err)
+	forwarder := services.NewAuditForwarder(sinks, 10, 10*time.Millisecond, logrus.New())
+	ctx, cancel := context.WithCancel(context.Background())
+	forwarder.Start(ctx)
+
+	audit, _ := setupAudit(t)
+	audit.EnableForwarding(forwarder)
+	events := services.NewOperationEventService(logrus.New())
+	events.EnableAuditForwarding(forwarder)
+
+	actorID := "usr_1"
+	require.NoError(t, audit.Record(context.Background(), &gormmodels.AuditEvent{
+		Action: gormmodels.AuditRoleDeleted, ActorID: &actorID, ActorName: "admin", Target: "role:rol_1", RequestID: "req-1",
+		Changes: map[string]gormmodels.AuditChange{"name": {Before: "operators"}},
+	}))
+	message := "CyberArk unreachable"
+	events.PublishOperationUpdated(&gormmodels.Operation{
+		ID: "op_1", Type: "safe_provision", Priority: "high", Status: gormmodels.OpStatusFailed,
+		CreatedBy: &actorID, ErrorMessage: &message,
+	})
+
+	var records []services.AuditRecord
+	require.Eventually(t, func() bool {
+		data, err := os.ReadFile(path)
+		if err != nil {
+			return false
+		}
+		records = nil
+		for _, line := range strings.Split(strings.TrimSpace(string(data)), "\n") {
+			var record services.AuditRecord
+			if json.Unmarshal([]byte(line), &record) == nil {
+				records = append(records, record)
+			}
+		}
+		return len(records) == 2
+	}, 5*time.Second, 10*time.Millisecond)
+
+	assert.Equal(t, "audit", records[0].Category)
+	assert.Equal(t, gormmodels.AuditRoleDeleted, records[0].Action)
+	assert.Equal(t, 5, records[0].Severity)
+	assert.Equal(t, "req-1", records[0].RequestID)
+	assert.Equal(t, "operators", records[0].Changes["name"].Before)
+	assert.Equal(t, int64(1), records[0].Sequence)
+	assert.NotEmpty(t, records[0].Hash)
+
+	assert.Equal(t, "operation", records[1].Category)
+	assert.Equal(t, "operation.failed", records[1].Action)
+	assert.Equal(t, "operation:op_1", records[1].Target)
+	assert.Equal(t, actorID, records[1].ActorID)
+	assert.Equal(t, message, records[1].Details["error"])
+	assert.Equal(t, "safe_provision", records[1].Details["type"])
+
+	cancel()
+	forwarder.Wait()
+}
@@ -0,0 +1,466 @@
+package services
+
+import (
+	"crypto/tls"
+	"crypto/x509"
+	"encoding/json"
+	"fmt"
+	"net"
+	"os"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/orca-ng/orca/internal/config"
+	gormmodels "github.com/orca-ng/orca/internal/models/gorm"
+)
+
+// AuditRecord is an audit event or operation lifecycle event as it is
+// forwarded to a SIEM
+type AuditRecord struct {
+	ID        string                            `json:"id,omitempty"`
+	Time      time.Time                         `json:"time"`
+	Category  string                            `json:"category"` // audit, operation, sync_job or certificate
+	Action    string                            `json:"action"`
+	Severity  int                               `json:"severity"` // 0 to 10, as in CEF
+	ActorID   string                            `json:"actor_id,omitempty"`
+	ActorName string                            `json:"actor_name,omitempty"`
+	Target    string                            `json:"target,omitempty"`
+	ClientIP  string                            `json:"client_ip,omitempty"`
+	UserAgent string                            `json:"user_agent,omitempty"`
+	RequestID string                            `json:"request_id,omitempty"`
+	Details   map[string]string                 `json:"details,omitempty"`
+	Changes   map[string]gormmodels.AuditChange `json:"changes,omitempty"`
+	Sequence  int64                             `json:"sequence,omitempty"` // position in the audit hash chain
+	Hash      string                            `json:"hash,omitempty"`
+}
+
+// AuditSink delivers records to a SIEM. Send is only called by one goroutine
+// at a time; a failed record is sent again later.
+type AuditSink interface {
+	Name() string
+	Send(record *AuditRecord) error
+	Close() error
+}
+
+// NewAuditSinks creates the sinks enabled in the configuration
+func NewAuditSinks(cfg config.AuditConfig) ([]AuditSink, error) {
+	var sinks []AuditSink
+	if cfg.Syslog.Enabled {
+		sink, err := NewSyslogSink(cfg.Syslog)
+		if err != nil {
+			return nil, err
+		}
+		sinks = append(sinks, sink)
+	}
+	if cfg.File.Enabled {
+		sinks = append(sinks, NewFileSink(cfg.File.Path))
+	}
+	return sinks, nil
+}
+
+// auditEventRecord converts a recorded audit event
+func auditEventRecord(event *gormmodels.AuditEvent) *AuditRecord {
+	record := &AuditRecord{
+		ID:        event.ID,
+		Time:      event.CreatedAt,
+		Category:  "audit",
+		Action:    event.Action,
+		Severity:  auditSeverity(event.Action),
+		ActorName: event.ActorName,
+		Target:    event.Target,
+		ClientIP:  event.ClientIP,
+		UserAgent: event.UserAgent,
+		RequestID: event.RequestID,
+		Details:   event.Details,
+		Changes:   event.Changes,
+		Sequence:  event.Sequence,
+		Hash:      event.Hash,
+	}
+	if event.ActorID != nil {
+		record.ActorID = *event.ActorID
+	}
+	return record
+}
+
+// operationEventRecord converts an operation lifecycle event, or nil when
+// the event carries nothing to forward
+func operationEventRecord(event *OperationEvent) *AuditRecord {
+	record := &AuditRecord{
+		Time:    event.Timestamp.UTC(),
+		Details: make(map[string]string),
+	}
+	switch {
+	case event.Operation != nil:
+		op := event.Operation
+		record.Category = "operation"
+		record.Action = "operation." + event.Type
+		record.Target = "operation:" + op.ID
+		record.Details["type"] = op.Type
+		record.Details["status"] = op.Status
+		record.Details["priority"] = op.Priority
+		record.Details["retry_count"] = strconv.Itoa(op.RetryCount)
+		if op.CreatedBy != nil {
+			record.ActorID = *op.CreatedBy
+		}
+		if op.CyberArkInstanceID != nil {
+			record.Details["cyberark_instance_id"] = *op.CyberArkInstanceID
+		}
+		if op.CorrelationID != nil {
+			record.Details["correlation_id"] = *op.CorrelationID
+		}
+		if op.ErrorMessage != nil {
+			record.Details["error"] = *op.ErrorMessage
+		}
+	case event.SyncJob != nil:
+		job := event.SyncJob
+		record.Category = "sync_job"
+		record.Action = "sync_job." + strings.TrimPrefix(event.Type, "sync_")
+		record.Target = "sync_job:" + job.ID
+		record.Details["sync_type"] = job.SyncType
+		record.Details["status"] = job.Status
+		record.Details["triggered_by"] = job.TriggeredBy
+		record.Details["cyberark_instance_id"] = job.CyberArkInstanceID
+		if job.ErrorMessage != nil {
+			record.Details["error"] = *job.ErrorMessage
+		}
+	case event.CertificateExpiry != nil:
+		expiry := event.CertificateExpiry
+		record.Category = "certificate"
+		record.Action = "certificate." + strings.TrimPrefix(event.Type, "certificate_")
+		record.Target = expiry.SourceType + ":" + expiry.SourceID
+		record.Details["subject"] = expiry.Subject
+		record.Details["fingerprint"] = expiry.Fingerprint
+		record.Details["not_after"] = expiry.NotAfter.UTC().Format(time.RFC3339)
+		record.Details["days_remaining"] = strconv.Itoa(expiry.DaysRemaining)
+	default:
+		return nil
+	}
+	record.Severity = auditSeverity(record.Action)
+	return record
+}
+
+// auditSeverity rates an action on the CEF scale
+func auditSeverity(action string) int {
+	switch {
+	case action == gormmodels.AuditLoginLocked, action == "certificate.expired":
+		return 7
+	case strings.HasSuffix(action, ".failed"),
+		strings.HasSuffix(action, ".deleted"),
+		strings.HasSuffix(action, ".revoked"),
+		strings.HasSuffix(action, "reset"),
+		strings.HasSuffix(action, ".unassigned"),
+		action == gormmodels.AuditLoginUnlocked,
+		action == "certificate.expiring":
+		return 5
+	}
+	return 3
+}
+
+// syslogSeverity maps a CEF severity to a syslog one
+func syslogSeverity(severity int) int {
+	switch {
+	case severity >= 7:
+		return 4 // warning
+	case severity >= 5:
+		return 5 // notice
+	}
+	return 6 // informational
+}
+
+const (
+	auditVendor         = "ORCA"
+	auditProduct        = "ORCA"
+	auditProductVersion = "1.0"
+)
+
+// FormatCEF formats a record in ArcSight Common Event Format
+func FormatCEF(record *AuditRecord) string {
+	header := strings.NewReplacer(`\`, `\\`, `|`, `\|`, "\r", " ", "\n", " ")
+	value := strings.NewReplacer(`\`, `\\`, `=`, `\=`, "\r", `\r`, "\n", `\n`)
+
+	var b strings.Builder
+	fmt.Fprintf(&b, "CEF:0|%s|%s|%s|%s|%s|%d|",
+		header.Replace(auditVendor), header.Replace(auditProduct), header.Replace(auditProductVersion),
+		header.Replace(record.Action), header.Replace(auditEventName(record.Action)), record.Severity)
+
+	var fields []string
+	add := func(key, v string) {
+		if v != "" {
+			fields = append(fields, key+"="+value.Replace(v))
+		}
+	}
+	add("rt", strconv.FormatInt(record.Time.UnixMilli(), 10))
+	add("cat", record.Category)
+	add("act", record.Action)
+	add("externalId", record.ID)
+	add("suid", record.ActorID)
+	add("suser", record.ActorName)
+	add("src", record.ClientIP)
+	add("requestClientApplication", record.UserAgent)
+	for i, custom := range auditCustomFields(record) {
+		if custom.value != "" {
+			add(fmt.Sprintf("cs%dLabel", i+1), custom.label)
+			add(fmt.Sprintf("cs%d", i+1), custom.value)
+		}
+	}
+	if record.Sequence > 0 {
+		add("cn1Label", "sequence")
+		add("cn1", strconv.FormatInt(record.Sequence, 10))
+	}
+	b.WriteString(strings.Join(fields, " "))
+	return b.String()
+}
+
+// FormatLEEF formats a record in IBM QRadar Log Event Extended Format 2.0,
+// with tab separated attributes
+func FormatLEEF(record *AuditRecord) string {
+	header := strings.NewReplacer(`\`, `\\`, `|`, `\|`, "\r", " ", "\n", " ", "\t", " ")
+	value := strings.NewReplacer("\t", `\t`, "\r", `\r`, "\n", `\n`)
+
+	var b strings.Builder
+	fmt.Fprintf(&b, "LEEF:2.0|%s|%s|%s|%s|x09|",
+		header.Replace(auditVendor), header.Replace(auditProduct), header.Replace(auditProductVersion),
+		header.Replace(record.Action))
+
+	var fields []string
+	add := func(key, v string) {
+		if v != "" {
+			fields = append(fields, key+"="+value.Replace(v))
+		}
+	}
+	add("devTime", strconv.FormatInt(record.Time.UnixMilli(), 10))
+	add("devTimeFormat", "epoch")
+	add("cat", record.Category)
+	add("sev", strconv.Itoa(record.Severity))
+	add("eventId", record.ID)
+	add("usrName", record.ActorName)
+	add("actorId", record.ActorID)
+	add("src", record.ClientIP)
+	add("userAgent", record.UserAgent)
+	for _, custom := range auditCustomFields(record) {
+		add(custom.label, custom.value)
+	}
+	if record.Sequence > 0 {
+		add("sequence", strconv.FormatInt(record.Sequence, 10))
+	}
+	b.WriteString(strings.Join(fields, "\t"))
+	return b.String()
+}
+
+type auditCustomField struct {
+	label string
+	value string
+}
+
+// auditCustomFields are the fields neither format has a key of its own for
+func auditCustomFields(record *AuditRecord) []auditCustomField {
+	return []auditCustomField{
+		{"target", record.Target},
+		{"requestId", record.RequestID},
+		{"details", auditJSON(record.Details)},
+		{"changes", auditJSON(record.Changes)},
+		{"hash", record.Hash},
+	}
+}
+
+func auditJSON[V any](m map[string]V) string {
+	if len(m) == 0 {
+		return ""
+	}
+	data, _ := json.Marshal(m)
+	return string(data)
+}
+
+// auditEventName turns an action such as "operation.priority_changed" into
+// "operation priority changed"
+func auditEventName(action string) string {
+	return strings.NewReplacer(".", " ", "_", " ").Replace(action)
+}
+
+// SyslogSink sends records as RFC 5424 syslog messages over UDP, or over TCP
+// and TLS framed by octet counting as in RFC 6587 and RFC 5425
+type SyslogSink struct {
+	network   string
+	address   string
+	format    func(*AuditRecord) string
+	facility  int
+	hostname  string
+	tlsConfig *tls.Config
+	timeout   time.Duration
+	conn      net.Conn
+}
+
+// NewSyslogSink creates a syslog sink. It connects on the first send.
+func NewSyslogSink(cfg config.AuditSyslogConfig) (*SyslogSink, error) {
+	s := &SyslogSink{
+		network:  cfg.Network,
+		address:  cfg.Address,
+		facility: cfg.Facility,
+		hostname: cfg.Hostname,
+		timeout:  10 * time.Second,
+	}
+	switch cfg.Format {
+	case "cef":
+		s.format = FormatCEF
+	case "leef":
+		s.format = FormatLEEF
+	default:
+		return nil, fmt.Errorf("unknown audit syslog format %q", cfg.Format)
+	}
+	if s.hostname == "" {
+		s.hostname, _ = os.Hostname()
+	}
+	if s.hostname == "" {
+		s.hostname = "-"
+	}
+
+	if cfg.Network == "tls" {
+		host, _, err := net.SplitHostPort(cfg.Address)
+		if err != nil {
+			return nil, fmt.Errorf("invalid audit syslog address: %w", err)
+		}
+		s.tlsConfig = &tls.Config{
+			ServerName:         host,
+			MinVersion:         tls.VersionTLS12,
+			InsecureSkipVerify: cfg.SkipTLSVerify,
+		}
+		if cfg.CAFile != "" {
+			pem, err := os.ReadFile(cfg.CAFile)
+			if err != nil {
+				return nil, fmt.Errorf("failed to read audit syslog CA file: %w", err)
+			}
+			pool := x509.NewCertPool()
+			if !pool.AppendCertsFromPEM(pem) {
+				return nil, fmt.Errorf("audit syslog CA file contains no certificates")
+			}
+			s.tlsConfig.RootCAs = pool
+		}
+	}
+	return s, nil
+}
+
+func (s *SyslogSink) Name() string {
+	return "syslog " + s.network + "://" + s.address
+}
+
+// Send writes a record, reconnecting when the previous connection failed
+func (s *SyslogSink) Send(record *AuditRecord) error {
+	if s.conn == nil {
+		conn, err := s.dial()
+		if err != nil {
+			return err
+		}
+		s.conn = conn
+	}
+
+	message := s.message(record)
+	if s.network != "udp" {
+		message = strconv.Itoa(len(message)) + " " + message
+	}
+	s.conn.SetWriteDeadline(time.Now().Add(s.timeout))
+	if _, err := s.conn.Write([]byte(message)); err != nil {
+		s.conn.Close()
+		s.conn = nil
+		return err
+	}
+	return nil
+}
+
+func (s *SyslogSink) dial() (net.Conn, error) {
+	dialer := &net.Dialer{Timeout: s.timeout}
+	if s.network == "tls" {
+		return tls.DialWithDialer(dialer, "tcp", s.address, s.tlsConfig)
+	}
+	return dialer.Dial(s.network, s.address)
+}
+
+// message formats a record as an RFC 5424 message without structured data
+func (s *SyslogSink) message(record *AuditRecord) string {
+	priority := s.facility*8 + syslogSeverity(record.Severity)
+	return fmt.Sprintf("<%d>1 %s %s orca %d %s - %s",
+		priority,
+		record.Time.UTC().Format("2006-01-02T15:04:05.000Z"),
+		syslogHeaderField(s.hostname, 255),
+		os.Getpid(),
+		syslogHeaderField(record.Action, 32),
+		s.format(record))
+}
+
+// syslogHeaderField keeps a header field to printable ASCII without spaces
+func syslogHeaderField(value string, max int) string {
+	field := strings.Map(func(r rune) rune {
+		if r < 33 || r > 126 {
+			return '_'
+		}
+		return r
+	}, value)
+	if len(field) > max {
+		field = field[:max]
+	}
+	if field == "" {
+		return "-"
+	}
+	return field
+}
+
+func (s *SyslogSink) Close() error {
+	if s.conn == nil {
+		return nil
+	}
+	err := s.conn.Close()
+	s.conn = nil
+	return err
+}
+
+// FileSink appends records as JSON lines to a file. The file is closed
+// whenever no records are waiting, so that it can be rotated by renaming it.
+type FileSink struct {
+	path string
+	file *os.File
+}
+
+// NewFileSink creates a sink appending to the file at path
+func NewFileSink(path string) *FileSink {
+	return &FileSink{path: path}
+}
+
+func (f *FileSink) Name() string {
+	return "file " + f.path
+}
+
+func (f *FileSink) Send(record *AuditRecord) error {
+	line, err := json.Marshal(record)
+	if err != nil {
+		return err
+	}
+
+	if f.file == nil {
+		file, err := os.OpenFile(f.path, os.O_WRONLY|os.O_APPEND|os.O_CREATE, 0o600)
+		if err != nil {
+			return err
+		}
+		f.file = file
+	}
+	if _, err := f.file.Write(append(line, '\n')); err != nil {
+		f.file.Close()
+		f.file = nil
+		return err
+	}
+	return nil
+}
+
+// Idle closes the file while no records are waiting, so that a rotated file
+// is let go of
+func (f *FileSink) Idle() {
+	f.Close()
+}
+
+func (f *FileSink) Close() error {
+	if f.file == nil {
+		return nil
+	}
+	err := f.file.Close()
+	f.file = nil
+	return err
+}
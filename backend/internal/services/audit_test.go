@@ -0,0 +1,201 @@
+package services_test
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/sirupsen/logrus"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"gorm.io/driver/sqlite"
+	"gorm.io/gorm"
+
+	"github.com/orca-ng/orca/internal/database"
+	gormmodels "github.com/orca-ng/orca/internal/models/gorm"
+	"github.com/orca-ng/orca/internal/services"
+)
+
+func setupAudit(t *testing.T) (*services.AuditService, *gorm.DB) {
+	t.Helper()
+	db, err := gorm.Open(sqlite.Open(":memory:"), &gorm.Config{})
+	require.NoError(t, err)
+	require.NoError(t, db.AutoMigrate(&gormmodels.AuditEvent{}, &gormmodels.AuditChainHead{}))
+	return services.NewAuditService(&database.GormDB{DB: db}, logrus.New()), db
+}
+
+func recordAuditEvents(t *testing.T, audit *services.AuditService, actions ...string) []*gormmodels.AuditEvent {
+	t.Helper()
+	var events []*gormmodels.AuditEvent
+	for _, action := range actions {
+		event := &gormmodels.AuditEvent{Action: action, ActorName: "admin", Target: "instance:1", RequestID: "req-" + action}
+		require.NoError(t, audit.Record(context.Background(), event))
+		events = append(events, event)
+	}
+	return events
+}
+
+func TestAuditChain(t *testing.T) {
+	ctx := context.Background()
+
+	t.Run("intact chain verifies", func(t *testing.T) {
+		audit, db := setupAudit(t)
+		// Events from before the chain are counted but not verified
+		require.NoError(t, db.Create(&gormmodels.AuditEvent{ID: "aud_legacy", Action: gormmodels.AuditLoginSucceeded}).Error)
+
+		events := recordAuditEvents(t, audit, gormmodels.AuditInstanceCreated, gormmodels.AuditInstanceUpdated, gormmodels.AuditInstanceDeleted)
+		assert.Equal(t, int64(1), events[0].Sequence)
+		assert.Empty(t, events[0].PrevHash)
+		assert.Equal(t, events[0].Hash, events[1].PrevHash)
+		assert.Equal(t, events[1].Hash, events[2].PrevHash)
+
+		result, err := audit.Verify(ctx)
+		require.NoError(t, err)
+		assert.True(t, result.Valid, result.Problem)
+		assert.Equal(t, int64(3), result.Events)
+		assert.Equal(t, int64(1), result.Unchained)
+		assert.Equal(t, events[2].Hash, result.LastHash)
+	})
+
+	t.Run("empty chain verifies", func(t *testing.T) {
+		audit, _ := setupAudit(t)
+		result, err := audit.Verify(ctx)
+		require.NoError(t, err)
+		assert.True(t, result.Valid)
+		assert.Zero(t, result.Events)
+	})
+
+	for name, tc := range map[string]struct {
+		tamper   func(db *gorm.DB, events []*gormmodels.AuditEvent)
+		brokenAt int64
+		problem  string
+	}{
+		"modified event": {
+			tamper: func(db *gorm.DB, events []*gormmodels.AuditEvent) {
+				db.Model(&gormmodels.AuditEvent{}).Where("id = ?", events[1].ID).Update("actor_name", "someone-else")
+			},
+			brokenAt: 2,
+			problem:  "was modified",
+		},
+		"rehashed event": {
+			tamper: func(db *gorm.DB, events []*gormmodels.AuditEvent) {
+				event := *events[1]
+				event.Target = "instance:2"
+				db.Model(&gormmodels.AuditEvent{}).Where("id = ?", event.ID).
+					Updates(map[string]interface{}{"target": event.Target, "hash": event.ComputeHash()})
+			},
+			brokenAt: 3,
+			problem:  "does not follow",
+		},
+		"removed event": {
+			tamper: func(db *gorm.DB, events []*gormmodels.AuditEvent) {
+				db.Delete(&gormmodels.AuditEvent{}, "id = ?", events[1].ID)
+			},
+			brokenAt: 2,
+			problem:  "missing",
+		},
+		"removed last event": {
+			tamper: func(db *gorm.DB, events []*gormmodels.AuditEvent) {
+				db.Delete(&gormmodels.AuditEvent{}, "id = ?", events[3].ID)
+			},
+			brokenAt: 4,
+			problem:  "but 4 were recorded",
+		},
+		"inserted event": {
+			tamper: func(db *gorm.DB, events []*gormmodels.AuditEvent) {
+				forged := *events[1]
+				forged.ID = "aud_forged"
+				db.Create(&forged)
+			},
+			brokenAt: 2,
+			problem:  "repeats sequence 2",
+		},
+	} {
+		t.Run(name, func(t *testing.T) {
+			audit, db := setupAudit(t)
+			events := recordAuditEvents(t, audit, "a.one", "a.two", "a.three", "a.four")
+			tc.tamper(db, events)
+
+			result, err := audit.Verify(ctx)
+			require.NoError(t, err)
+			assert.False(t, result.Valid)
+			assert.Equal(t, tc.brokenAt, result.BrokenAt)
+			assert.Contains(t, result.Problem, tc.problem)
+		})
+	}
+}
+
+func TestAuditQuery(t *testing.T) {
+	ctx := context.Background()
+	audit, db := setupAudit(t)
+
+	actorID := "usr_1"
+	for _, event := range []*gormmodels.AuditEvent{
+		{Action: gormmodels.AuditInstanceCreated, ActorID: &actorID, ActorName: "alice", Target: "instance:1", RequestID: "r1", ClientIP: "192.0.2.1"},
+		{Action: gormmodels.AuditInstanceUpdated, ActorID: &actorID, ActorName: "alice", Target: "instance:1", RequestID: "r2", ClientIP: "192.0.2.1"},
+		{Action: gormmodels.AuditUserCreated, ActorName: "bob", Target: "user:2", RequestID: "r3", ClientIP: "192.0.2.2"},
+	} {
+		require.NoError(t, audit.Record(ctx, event))
+	}
+	old := time.Now().UTC().Add(-48 * time.Hour)
+	require.NoError(t, db.Create(&gormmodels.AuditEvent{ID: "aud_old", Action: gormmodels.AuditLoginSucceeded, ActorName: "alice", CreatedAt: old}).Error)
+
+	for name, tc := range map[string]struct {
+		query   services.AuditQuery
+		actions []string
+	}{
+		"all, newest first": {
+			query:   services.AuditQuery{},
+			actions: []string{gormmodels.AuditUserCreated, gormmodels.AuditInstanceUpdated, gormmodels.AuditInstanceCreated, gormmodels.AuditLoginSucceeded},
+		},
+		"action":        {services.AuditQuery{Action: gormmodels.AuditUserCreated}, []string{gormmodels.AuditUserCreated}},
+		"action prefix": {services.AuditQuery{Action: "instance.*"}, []string{gormmodels.AuditInstanceUpdated, gormmodels.AuditInstanceCreated}},
+		"actor id":      {services.AuditQuery{ActorID: actorID}, []string{gormmodels.AuditInstanceUpdated, gormmodels.AuditInstanceCreated}},
+		"actor name":    {services.AuditQuery{ActorName: "bob"}, []string{gormmodels.AuditUserCreated}},
+		"target":        {services.AuditQuery{Target: "user:2"}, []string{gormmodels.AuditUserCreated}},
+		"request id":    {services.AuditQuery{RequestID: "r2"}, []string{gormmodels.AuditInstanceUpdated}},
+		"client ip":     {services.AuditQuery{ClientIP: "192.0.2.2"}, []string{gormmodels.AuditUserCreated}},
+		"since":         {services.AuditQuery{ActorName: "alice", Since: time.Now().Add(-time.Hour)}, []string{gormmodels.AuditInstanceUpdated, gormmodels.AuditInstanceCreated}},
+		"until":         {services.AuditQuery{Until: time.Now().Add(-time.Hour)}, []string{gormmodels.AuditLoginSucceeded}},
+		"limit":         {services.AuditQuery{Limit: 1}, []string{gormmodels.AuditUserCreated}},
+		"limit, offset": {services.AuditQuery{Limit: 1, Offset: 1}, []string{gormmodels.AuditInstanceUpdated}},
+	} {
+		t.Run(name, func(t *testing.T) {
+			events, total, err := audit.Query(ctx, tc.query)
+			require.NoError(t, err)
+			var actions []string
+			for _, event := range events {
+				actions = append(actions, event.Action)
+			}
+			assert.Equal(t, tc.actions, actions)
+			if tc.query.Limit == 0 {
+				assert.Equal(t, int64(len(tc.actions)), total)
+			} else {
+				assert.Equal(t, int64(4), total)
+			}
+		})
+	}
+}
+
+func TestAuditChanges(t *testing.T) {
+	type secretThing struct {
+		Name      string    `json:"name"`
+		Port      int       `json:"port"`
+		Password  string    `json:"-"`
+		UpdatedAt time.Time `json:"updated_at"`
+	}
+	before := &secretThing{Name: "a", Port: 1, Password: "old", UpdatedAt: time.Now()}
+	after := &secretThing{Name: "b", Port: 1, Password: "new", UpdatedAt: time.Now().Add(time.Minute)}
+
+	assert.Equal(t, map[string]gormmodels.AuditChange{"name": {Before: "a", After: "b"}}, services.AuditChanges(before, after))
+	assert.Nil(t, services.AuditChanges(before, before))
+
+	created := services.AuditChanges(nil, after)
+	assert.Equal(t, gormmodels.AuditChange{After: "b"}, created["name"])
+	assert.Equal(t, gormmodels.AuditChange{After: "1"}, created["port"])
+	assert.NotContains(t, created, "updated_at")
+
+	var none *secretThing
+	deleted := services.AuditChanges(before, none)
+	assert.Equal(t, gormmodels.AuditChange{Before: "a"}, deleted["name"])
+}
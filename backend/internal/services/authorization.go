@@ -0,0 +1,251 @@
+package services
+
+import (
+	"context"
+	"fmt"
+	"sort"
+	"strings"
+
+	"github.com/orca-ng/orca/internal/database"
+	"github.com/orca-ng/orca/internal/models"
+	gormmodels "github.com/orca-ng/orca/internal/models/gorm"
+)
+
+// Permissions are the permissions a user holds, globally and per CyberArk
+// instance, optionally limited to the scopes of an API token
+type Permissions struct {
+	global    []string
+	instances map[string][]string
+	scopes    []string // nil when not limited
+}
+
+// PermissionSummary is the JSON form of Permissions
+type PermissionSummary struct {
+	Global    []string            `json:"global"`
+	Instances map[string][]string `json:"instances"`
+	Scopes    []string            `json:"scopes,omitempty"`
+}
+
+// AllPermissions returns permissions granting everything, as held by admins
+func AllPermissions() *Permissions {
+	return &Permissions{global: []string{gormmodels.PermAll}}
+}
+
+// NoPermissions returns permissions granting nothing
+func NoPermissions() *Permissions {
+	return &Permissions{}
+}
+
+// Restrict returns the permissions limited to those the scopes grant
+func (p *Permissions) Restrict(scopes []string) *Permissions {
+	restricted := *p
+	restricted.scopes = append([]string{}, scopes...)
+	return &restricted
+}
+
+func (p *Permissions) inScope(permission string) bool {
+	return p.scopes == nil || anyGrants(p.scopes, permission)
+}
+
+// Has reports whether the permission is held globally
+func (p *Permissions) Has(permission string) bool {
+	return p.inScope(permission) && anyGrants(p.global, permission)
+}
+
+// HasOnInstance reports whether the permission is held for the instance,
+// either globally or through an assignment scoped to it
+func (p *Permissions) HasOnInstance(permission, instanceID string) bool {
+	if p.Has(permission) {
+		return true
+	}
+	if isGlobalOnly(permission) || !p.inScope(permission) {
+		return false
+	}
+	return anyGrants(p.instances[instanceID], permission)
+}
+
+// HasAnywhere reports whether the permission is held globally or for at
+// least one instance. A permission ending in ":*" asks for any permission
+// it prefixes.
+func (p *Permissions) HasAnywhere(permission string) bool {
+	if p.Has(permission) {
+		return true
+	}
+	if isGlobalOnly(permission) || !p.inScope(permission) {
+		return false
+	}
+	for _, granted := range p.instances {
+		if anyGrants(granted, permission) {
+			return true
+		}
+	}
+	return false
+}
+
+// Instances returns the instances the permission is held for. all is true
+// when it is held globally, in which case ids is nil.
+func (p *Permissions) Instances(permission string) (all bool, ids []string) {
+	if p.Has(permission) {
+		return true, nil
+	}
+	if isGlobalOnly(permission) || !p.inScope(permission) {
+		return false, nil
+	}
+	for instanceID, granted := range p.instances {
+		if anyGrants(granted, permission) {
+			ids = append(ids, instanceID)
+		}
+	}
+	sort.Strings(ids)
+	return false, ids
+}
+
+// Covers reports whether every permission other holds, globally or for an
+// instance, is held here too
+func (p *Permissions) Covers(other *Permissions) bool {
+	for _, permission := range KnownPermissions() {
+		if other.Has(permission) && !p.Has(permission) {
+			return false
+		}
+		for instanceID := range other.instances {
+			if other.HasOnInstance(permission, instanceID) && !p.HasOnInstance(permission, instanceID) {
+				return false
+			}
+		}
+	}
+	return true
+}
+
+// Summary returns the permissions for API responses
+func (p *Permissions) Summary() PermissionSummary {
+	summary := PermissionSummary{
+		Global:    append([]string{}, p.global...),
+		Instances: make(map[string][]string, len(p.instances)),
+		Scopes:    p.scopes,
+	}
+	for instanceID, granted := range p.instances {
+		summary.Instances[instanceID] = append([]string{}, granted...)
+	}
+	return summary
+}
+
+func anyGrants(granted []string, required string) bool {
+	for _, g := range granted {
+		if permissionMatches(g, required) {
+			return true
+		}
+	}
+	return false
+}
+
+func permissionMatches(granted, required string) bool {
+	if granted == gormmodels.PermAll || granted == required {
+		return true
+	}
+	if strings.HasSuffix(granted, ":*") && strings.HasPrefix(required, strings.TrimSuffix(granted, "*")) {
+		return true
+	}
+	// Asking for any permission under a prefix
+	return strings.HasSuffix(required, ":*") && strings.HasPrefix(granted, strings.TrimSuffix(required, "*"))
+}
+
+func isGlobalOnly(permission string) bool {
+	for _, p := range gormmodels.GlobalOnlyPermissions {
+		if permissionMatches(p, permission) && !strings.HasSuffix(permission, ":*") {
+			return true
+		}
+	}
+	return false
+}
+
+// KnownPermissions returns every concrete permission that can be granted
+func KnownPermissions() []string {
+	permissions := []string{
+		gormmodels.PermInstancesRead,
+		gormmodels.PermInstancesWrite,
+		gormmodels.PermOperationsRead,
+	}
+	for _, opType := range gormmodels.OperationTypes {
+		permissions = append(permissions, gormmodels.OperationCreatePermission(opType))
+	}
+	return append(permissions,
+		gormmodels.PermOperationsCancel,
+		gormmodels.PermOperationsApprove,
+		gormmodels.PermSyncRead,
+		gormmodels.PermSyncManage,
+		gormmodels.PermCertificatesRead,
+		gormmodels.PermCertificatesManage,
+		gormmodels.PermPipelineManage,
+		gormmodels.PermRolesManage,
+		gormmodels.PermServiceAccountsManage,
+		gormmodels.PermUsersManage,
+		gormmodels.PermAuditRead,
+	)
+}
+
+// ValidatePermission checks that a permission is known, or is "*" or a
+// wildcard over known permissions such as "operations:create:*"
+func ValidatePermission(permission string) error {
+	if permission == gormmodels.PermAll {
+		return nil
+	}
+	for _, known := range KnownPermissions() {
+		if permission == known {
+			return nil
+		}
+		if strings.HasSuffix(permission, ":*") && strings.HasPrefix(known, strings.TrimSuffix(permission, "*")) {
+			return nil
+		}
+	}
+	return fmt.Errorf("unknown permission %q", permission)
+}
+
+// AuthorizationService resolves the permissions of users from their role
+// assignments
+type AuthorizationService struct {
+	db *database.GormDB
+}
+
+// NewAuthorizationService creates a new authorization service
+func NewAuthorizationService(db *database.GormDB) *AuthorizationService {
+	return &AuthorizationService{db: db}
+}
+
+// UserPermissions returns the permissions of a user. Admins hold every
+// permission regardless of their role assignments.
+func (s *AuthorizationService) UserPermissions(ctx context.Context, user *models.User) (*Permissions, error) {
+	if user.IsAdmin {
+		return AllPermissions(), nil
+	}
+
+	var assignments []gormmodels.RoleAssignment
+	if err := s.db.WithContext(ctx).
+		Preload("Role").
+		Where("user_id = ?", user.ID).
+		Find(&assignments).Error; err != nil {
+		return nil, fmt.Errorf("failed to load role assignments: %w", err)
+	}
+
+	permissions := &Permissions{instances: make(map[string][]string)}
+	for _, assignment := range assignments {
+		if assignment.Role == nil {
+			continue
+		}
+		if assignment.CyberArkInstanceID == nil {
+			permissions.global = appendUnique(permissions.global, assignment.Role.Permissions...)
+			continue
+		}
+		instanceID := *assignment.CyberArkInstanceID
+		permissions.instances[instanceID] = appendUnique(permissions.instances[instanceID], assignment.Role.Permissions...)
+	}
+	return permissions, nil
+}
+
+func appendUnique(values []string, add ...string) []string {
+	for _, v := range add {
+		if !containsString(values, v) {
+			values = append(values, v)
+		}
+	}
+	return values
+}
@@ -0,0 +1,103 @@
+package services_test
+
+import (
+	"context"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"gorm.io/driver/sqlite"
+	"gorm.io/gorm"
+
+	"github.com/orca-ng/orca/internal/database"
+	"github.com/orca-ng/orca/internal/models"
+	gormmodels "github.com/orca-ng/orca/internal/models/gorm"
+	"github.com/orca-ng/orca/internal/services"
+)
+
+func TestUserPermissions(t *testing.T) {
+	db, err := gorm.Open(sqlite.Open(":memory:"), &gorm.Config{})
+	require.NoError(t, err)
+	require.NoError(t, db.AutoMigrate(&gormmodels.Role{}, &gormmodels.RoleAssignment{}))
+
+	owner := gormmodels.Role{Name: "owner", Permissions: []string{
+		gormmodels.PermInstancesWrite,
+		gormmodels.OperationCreatePermission("access_grant"),
+		gormmodels.PermCertificatesManage,
+	}}
+	viewer := gormmodels.Role{Name: "viewer", Permissions: []string{gormmodels.PermInstancesRead, gormmodels.PermOperationsCreate + ":*"}}
+	require.NoError(t, db.Create(&owner).Error)
+	require.NoError(t, db.Create(&viewer).Error)
+
+	instanceA := "cai_a"
+	require.NoError(t, db.Create(&gormmodels.RoleAssignment{UserID: "usr_1", RoleID: owner.ID, CyberArkInstanceID: &instanceA}).Error)
+	require.NoError(t, db.Create(&gormmodels.RoleAssignment{UserID: "usr_1", RoleID: viewer.ID}).Error)
+
+	authz := services.NewAuthorizationService(&database.GormDB{DB: db})
+	perms, err := authz.UserPermissions(context.Background(), &models.User{ID: "usr_1"})
+	require.NoError(t, err)
+
+	// Scoped permissions only apply to their instance
+	assert.True(t, perms.HasOnInstance(gormmodels.PermInstancesWrite, "cai_a"))
+	assert.False(t, perms.HasOnInstance(gormmodels.PermInstancesWrite, "cai_b"))
+	assert.False(t, perms.Has(gormmodels.PermInstancesWrite))
+	assert.True(t, perms.HasAnywhere(gormmodels.PermInstancesWrite))
+
+	// Global permissions apply everywhere, wildcards included
+	assert.True(t, perms.Has(gormmodels.PermInstancesRead))
+	assert.True(t, perms.HasOnInstance(gormmodels.PermInstancesRead, "cai_b"))
+	assert.True(t, perms.HasOnInstance(gormmodels.OperationCreatePermission("safe_delete"), "cai_b"))
+
+	// Global-only permissions are ignored in scoped assignments
+	assert.False(t, perms.HasAnywhere(gormmodels.PermCertificatesManage))
+	assert.False(t, perms.HasOnInstance(gormmodels.PermCertificatesManage, "cai_a"))
+
+	all, ids := perms.Instances(gormmodels.PermInstancesWrite)
+	assert.False(t, all)
+	assert.Equal(t, []string{"cai_a"}, ids)
+	all, _ = perms.Instances(gormmodels.PermInstancesRead)
+	assert.True(t, all)
+
+	// Users without assignments hold nothing, admins everything
+	none, err := authz.UserPermissions(context.Background(), &models.User{ID: "usr_2"})
+	require.NoError(t, err)
+	assert.False(t, none.HasAnywhere(gormmodels.PermInstancesRead))
+
+	admin, err := authz.UserPermissions(context.Background(), &models.User{ID: "usr_3", IsAdmin: true})
+	require.NoError(t, err)
+	assert.True(t, admin.Has(gormmodels.PermRolesManage))
+
+	// Instance permissions count towards what a user holds
+	assert.True(t, admin.Covers(perms))
+	assert.True(t, perms.Covers(none))
+	assert.False(t, perms.Covers(admin))
+	assert.False(t, none.Covers(perms))
+	assert.False(t, services.AllPermissions().Restrict([]string{gormmodels.PermInstancesRead}).Covers(perms))
+}
+
+func TestValidatePermission(t *testing.T) {
+	for _, p := range []string{"*", "instances:write", "operations:create:access_grant", "operations:create:*", "operations:*"} {
+		assert.NoError(t, services.ValidatePermission(p), p)
+	}
+	for _, p := range []string{"", "instances", "operations:create:unknown", "vault:*"} {
+		assert.Error(t, services.ValidatePermission(p), p)
+	}
+}
+
+func TestPermissionsRestrict(t *testing.T) {
+	perms := services.AllPermissions().Restrict([]string{gormmodels.PermInstancesRead, gormmodels.PermOperationsCreate + ":*"})
+
+	// Scopes narrow what the roles grant
+	assert.True(t, perms.Has(gormmodels.PermInstancesRead))
+	assert.True(t, perms.HasOnInstance(gormmodels.OperationCreatePermission("access_grant"), "cai_a"))
+	assert.False(t, perms.Has(gormmodels.PermInstancesWrite))
+	assert.False(t, perms.HasAnywhere(gormmodels.PermRolesManage))
+
+	// They never add to them
+	none := services.NoPermissions().Restrict([]string{"*"})
+	assert.False(t, none.HasAnywhere(gormmodels.PermInstancesRead))
+
+	// No scopes means nothing
+	assert.False(t, services.AllPermissions().Restrict(nil).Has(gormmodels.PermInstancesRead))
+	assert.True(t, services.AllPermissions().Restrict([]string{"*"}).Has(gormmodels.PermRolesManage))
+}
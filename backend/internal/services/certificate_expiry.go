@@ -0,0 +1,284 @@
+package services
+
+import (
+	"context"
+	"crypto/x509"
+	"fmt"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/sirupsen/logrus"
+
+	"github.com/orca-ng/orca/internal/database"
+	gormmodels "github.com/orca-ng/orca/internal/models/gorm"
+)
+
+// DefaultExpiryWarningDays are the thresholds used when none are configured
+var DefaultExpiryWarningDays = []int{60, 30, 7}
+
+// pvwaFetchTimeout bounds fetching the chain of one PVWA
+const pvwaFetchTimeout = 10 * time.Second
+
+// CertificateExpiryMonitor watches the stored CA chains and the chains the
+// PVWAs present, and raises a notification each time a certificate comes
+// within one of the warning thresholds or expires
+type CertificateExpiryMonitor struct {
+	db          *database.GormDB
+	logger      *logrus.Logger
+	certService *CertificateService
+	events      *OperationEventService
+	thresholds  []int // days, largest first
+}
+
+// NewCertificateExpiryMonitor creates a monitor warning at the given numbers
+// of days before expiry. events may be nil, in which case findings are only
+// logged.
+func NewCertificateExpiryMonitor(db *database.GormDB, logger *logrus.Logger, events *OperationEventService, warningDays []int) *CertificateExpiryMonitor {
+	if len(warningDays) == 0 {
+		warningDays = DefaultExpiryWarningDays
+	}
+	thresholds := append([]int(nil), warningDays...)
+	sort.Sort(sort.Reverse(sort.IntSlice(thresholds)))
+
+	return &CertificateExpiryMonitor{
+		db:          db,
+		logger:      logger,
+		certService: NewCertificateService(),
+		events:      events,
+		thresholds:  thresholds,
+	}
+}
+
+// Thresholds returns the warning thresholds in days, largest first
+func (m *CertificateExpiryMonitor) Thresholds() []int {
+	return append([]int(nil), m.thresholds...)
+}
+
+// Run checks all certificates at the given interval while this replica is
+// the leader. A replica that becomes leader checks straight away.
+func (m *CertificateExpiryMonitor) Run(ctx context.Context, interval time.Duration, leader *LeaderElector) {
+	poll := interval
+	if poll > time.Minute {
+		poll = time.Minute
+	}
+	ticker := time.NewTicker(poll)
+	defer ticker.Stop()
+
+	var lastCheck time.Time
+	for {
+		if leader == nil || leader.IsLeader() {
+			if time.Since(lastCheck) >= interval {
+				lastCheck = time.Now()
+				if _, err := m.Check(ctx); err != nil && ctx.Err() == nil {
+					m.logger.WithError(err).Error("Certificate expiry check failed")
+				}
+			}
+		} else {
+			lastCheck = time.Time{}
+		}
+
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+		}
+	}
+}
+
+// Check examines every active certificate authority and active instance's
+// PVWA, records the results and raises notifications for certificates that
+// crossed a threshold since the last check
+func (m *CertificateExpiryMonitor) Check(ctx context.Context) ([]gormmodels.CertificateExpiry, error) {
+	now := time.Now()
+
+	var cas []gormmodels.CertificateAuthority
+	if err := m.db.WithContext(ctx).Where("is_active = ?", true).Find(&cas).Error; err != nil {
+		return nil, fmt.Errorf("failed to query certificate authorities: %w", err)
+	}
+
+	var results []gormmodels.CertificateExpiry
+	checked := map[string]map[string]bool{
+		gormmodels.ExpirySourceCertificateAuthority: {},
+		gormmodels.ExpirySourcePVWA:                 {},
+	}
+
+	for _, ca := range cas {
+		chain, err := m.certService.ParseCertificateChain(ca.Certificate)
+		if err != nil {
+			m.logger.WithError(err).WithField("ca_id", ca.ID).Warn("Failed to parse stored certificate authority")
+			continue
+		}
+		var certs []*x509.Certificate
+		for _, cert := range chain.Certificates {
+			certs = append(certs, cert.Certificate)
+		}
+		recorded, err := m.record(ctx, gormmodels.ExpirySourceCertificateAuthority, ca.ID, ca.Name, certs, now)
+		if err != nil {
+			return nil, err
+		}
+		checked[gormmodels.ExpirySourceCertificateAuthority][ca.ID] = true
+		results = append(results, recorded...)
+	}
+
+	var instances []gormmodels.CyberArkInstance
+	if err := m.db.WithContext(ctx).Where("is_active = ?", true).Find(&instances).Error; err != nil {
+		return nil, fmt.Errorf("failed to query CyberArk instances: %w", err)
+	}
+
+	for _, instance := range instances {
+		if !strings.HasPrefix(strings.ToLower(instance.BaseURL), "https://") {
+			continue
+		}
+		chain, err := FetchServerChain(ctx, instance.BaseURL, pvwaFetchTimeout)
+		if err != nil {
+			// Keep the last known results of an unreachable PVWA
+			m.logger.WithError(err).WithField("instance_id", instance.ID).Warn("Failed to fetch PVWA certificate for expiry check")
+			checked[gormmodels.ExpirySourcePVWA][instance.ID] = true
+			continue
+		}
+		recorded, err := m.record(ctx, gormmodels.ExpirySourcePVWA, instance.ID, instance.Name, chain, now)
+		if err != nil {
+			return nil, err
+		}
+		checked[gormmodels.ExpirySourcePVWA][instance.ID] = true
+		results = append(results, recorded...)
+	}
+
+	// Forget sources that were deleted or deactivated
+	for sourceType, sourceIDs := range checked {
+		query := m.db.WithContext(ctx).Where("source_type = ?", sourceType)
+		if len(sourceIDs) > 0 {
+			var ids []string
+			for id := range sourceIDs {
+				ids = append(ids, id)
+			}
+			query = query.Where("source_id NOT IN ?", ids)
+		}
+		if err := query.Delete(&gormmodels.CertificateExpiry{}).Error; err != nil {
+			return nil, fmt.Errorf("failed to prune certificate expiry results: %w", err)
+		}
+	}
+
+	return results, nil
+}
+
+// record stores the results for the chain of one source, replacing those of
+// certificates it no longer contains
+func (m *CertificateExpiryMonitor) record(ctx context.Context, sourceType, sourceID, sourceName string, chain []*x509.Certificate, now time.Time) ([]gormmodels.CertificateExpiry, error) {
+	var existing []gormmodels.CertificateExpiry
+	if err := m.db.WithContext(ctx).
+		Where("source_type = ? AND source_id = ?", sourceType, sourceID).
+		Find(&existing).Error; err != nil {
+		return nil, fmt.Errorf("failed to load certificate expiry results: %w", err)
+	}
+	previous := make(map[string]gormmodels.CertificateExpiry)
+	for _, e := range existing {
+		previous[e.Fingerprint] = e
+	}
+
+	var results []gormmodels.CertificateExpiry
+	var fingerprints []string
+	for _, cert := range chain {
+		fingerprint := CertificateFingerprint(cert)
+		if containsString(fingerprints, fingerprint) {
+			continue
+		}
+		fingerprints = append(fingerprints, fingerprint)
+
+		expiry := previous[fingerprint]
+		expiry.SourceType = sourceType
+		expiry.SourceID = sourceID
+		expiry.SourceName = sourceName
+		expiry.Fingerprint = fingerprint
+		expiry.Subject = cert.Subject.String()
+		expiry.Issuer = cert.Issuer.String()
+		expiry.IsCA = cert.IsCA
+		expiry.NotAfter = cert.NotAfter
+		expiry.CheckedAt = now
+		m.classify(&expiry, now)
+
+		notify := expiry.Threshold != nil &&
+			(expiry.NotifiedThreshold == nil || *expiry.Threshold < *expiry.NotifiedThreshold)
+		if notify {
+			threshold := *expiry.Threshold
+			expiry.NotifiedThreshold = &threshold
+		} else if expiry.Threshold == nil {
+			// Out of every threshold again, e.g. after they were lowered
+			expiry.NotifiedThreshold = nil
+		}
+
+		if err := m.db.WithContext(ctx).Save(&expiry).Error; err != nil {
+			return nil, fmt.Errorf("failed to save certificate expiry result: %w", err)
+		}
+		if notify {
+			m.notify(&expiry)
+		}
+		results = append(results, expiry)
+	}
+
+	query := m.db.WithContext(ctx).Where("source_type = ? AND source_id = ?", sourceType, sourceID)
+	if len(fingerprints) > 0 {
+		query = query.Where("fingerprint NOT IN ?", fingerprints)
+	}
+	if err := query.Delete(&gormmodels.CertificateExpiry{}).Error; err != nil {
+		return nil, fmt.Errorf("failed to prune certificate expiry results: %w", err)
+	}
+
+	return results, nil
+}
+
+// classify sets the status, remaining days and threshold of a result
+func (m *CertificateExpiryMonitor) classify(expiry *gormmodels.CertificateExpiry, now time.Time) {
+	remaining := expiry.NotAfter.Sub(now)
+	expiry.DaysRemaining = int(remaining.Hours() / 24)
+	expiry.Threshold = nil
+
+	if remaining <= 0 {
+		expired := 0
+		expiry.DaysRemaining = 0
+		expiry.Status = gormmodels.ExpiryStatusExpired
+		expiry.Threshold = &expired
+		return
+	}
+
+	expiry.Status = gormmodels.ExpiryStatusValid
+	for _, days := range m.thresholds {
+		if remaining <= time.Duration(days)*24*time.Hour {
+			threshold := days
+			expiry.Status = gormmodels.ExpiryStatusExpiring
+			expiry.Threshold = &threshold
+		}
+	}
+}
+
+// notify logs a certificate that crossed a threshold and publishes it
+func (m *CertificateExpiryMonitor) notify(expiry *gormmodels.CertificateExpiry) {
+	fields := logrus.Fields{
+		"source_type":    expiry.SourceType,
+		"source_id":      expiry.SourceID,
+		"source_name":    expiry.SourceName,
+		"subject":        expiry.Subject,
+		"fingerprint":    expiry.Fingerprint,
+		"not_after":      expiry.NotAfter,
+		"days_remaining": expiry.DaysRemaining,
+	}
+	if expiry.Status == gormmodels.ExpiryStatusExpired {
+		m.logger.WithFields(fields).Error("Certificate has expired")
+	} else {
+		m.logger.WithFields(fields).Warn("Certificate is about to expire")
+	}
+
+	if m.events != nil {
+		m.events.PublishCertificateExpiry(expiry)
+	}
+}
+
+func containsString(values []string, value string) bool {
+	for _, v := range values {
+		if v == value {
+			return true
+		}
+	}
+	return false
+}
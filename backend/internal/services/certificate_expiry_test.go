@@ -0,0 +1,128 @@
+package services_test
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/sirupsen/logrus"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"gorm.io/driver/sqlite"
+	"gorm.io/gorm"
+
+	"github.com/orca-ng/orca/internal/database"
+	gormmodels "github.com/orca-ng/orca/internal/models/gorm"
+	"github.com/orca-ng/orca/internal/services"
+)
+
+func drainEvents(events <-chan *services.OperationEvent) []*services.OperationEvent {
+	var received []*services.OperationEvent
+	for {
+		select {
+		case event := <-events:
+			received = append(received, event)
+		case <-time.After(50 * time.Millisecond):
+			return received
+		}
+	}
+}
+
+func TestCertificateExpiryMonitor(t *testing.T) {
+	db, err := gorm.Open(sqlite.Open(":memory:"), &gorm.Config{})
+	require.NoError(t, err)
+	require.NoError(t, db.AutoMigrate(&gormmodels.CertificateAuthority{}, &gormmodels.CyberArkInstance{}, &gormmodels.CertificateExpiry{}))
+	gormDB := &database.GormDB{DB: db}
+
+	soon := newTestCAExpiring(t, "Soon CA", time.Now().Add(20*24*time.Hour))
+	later := newTestCAExpiring(t, "Later CA", time.Now().Add(400*24*time.Hour))
+	expired := newTestCAExpiring(t, "Expired CA", time.Now().Add(-24*time.Hour))
+	var caIDs []string
+	for _, ca := range []*testCA{soon, later, expired} {
+		record := gormmodels.CertificateAuthority{
+			Name:        ca.cert.Subject.CommonName,
+			Certificate: ca.pem(),
+			Fingerprint: services.CertificateFingerprint(ca.cert),
+			Subject:     ca.cert.Subject.String(),
+			Issuer:      ca.cert.Issuer.String(),
+			NotBefore:   ca.cert.NotBefore,
+			NotAfter:    ca.cert.NotAfter,
+			IsActive:    true,
+		}
+		require.NoError(t, db.Create(&record).Error)
+		caIDs = append(caIDs, record.ID)
+	}
+
+	// The PVWA's own certificate expires within a day
+	server := later.pvwa(t)
+	instance := gormmodels.CyberArkInstance{Name: "PVWA", BaseURL: server.URL, Username: "svc", PasswordEncrypted: "x", IsActive: true}
+	require.NoError(t, db.Create(&instance).Error)
+
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	eventService := services.NewOperationEventService(logrus.New())
+	events := eventService.Subscribe(ctx, "test")
+
+	monitor := services.NewCertificateExpiryMonitor(gormDB, logrus.New(), eventService, []int{7, 60, 30})
+	assert.Equal(t, []int{60, 30, 7}, monitor.Thresholds())
+
+	results, err := monitor.Check(ctx)
+	require.NoError(t, err)
+	require.Len(t, results, 5)
+
+	bySubject := make(map[string]gormmodels.CertificateExpiry)
+	for _, r := range results {
+		bySubject[r.SourceType+"/"+r.Subject] = r
+	}
+	soonResult := bySubject[gormmodels.ExpirySourceCertificateAuthority+"/CN=Soon CA"]
+	assert.Equal(t, gormmodels.ExpiryStatusExpiring, soonResult.Status)
+	require.NotNil(t, soonResult.Threshold)
+	assert.Equal(t, 30, *soonResult.Threshold)
+	assert.Equal(t, 19, soonResult.DaysRemaining)
+
+	laterResult := bySubject[gormmodels.ExpirySourceCertificateAuthority+"/CN=Later CA"]
+	assert.Equal(t, gormmodels.ExpiryStatusValid, laterResult.Status)
+	assert.Nil(t, laterResult.Threshold)
+
+	expiredResult := bySubject[gormmodels.ExpirySourceCertificateAuthority+"/CN=Expired CA"]
+	assert.Equal(t, gormmodels.ExpiryStatusExpired, expiredResult.Status)
+
+	leafResult := bySubject[gormmodels.ExpirySourcePVWA+"/CN=pvwa"]
+	assert.Equal(t, instance.ID, leafResult.SourceID)
+	assert.Equal(t, gormmodels.ExpiryStatusExpiring, leafResult.Status)
+	require.NotNil(t, leafResult.Threshold)
+	assert.Equal(t, 7, *leafResult.Threshold)
+	assert.Equal(t, gormmodels.ExpiryStatusValid, bySubject[gormmodels.ExpirySourcePVWA+"/CN=Later CA"].Status)
+
+	received := drainEvents(events)
+	types := make(map[string]int)
+	for _, event := range received {
+		require.NotNil(t, event.CertificateExpiry)
+		types[event.Type]++
+	}
+	assert.Equal(t, map[string]int{"certificate_expiring": 2, "certificate_expired": 1}, types)
+
+	// Each threshold is only raised once
+	_, err = monitor.Check(ctx)
+	require.NoError(t, err)
+	assert.Empty(t, drainEvents(events))
+
+	// Reaching a lower threshold raises it again
+	tighter := services.NewCertificateExpiryMonitor(gormDB, logrus.New(), eventService, []int{60, 30, 21})
+	_, err = tighter.Check(ctx)
+	require.NoError(t, err)
+	received = drainEvents(events)
+	require.Len(t, received, 1)
+	assert.Equal(t, "CN=Soon CA", received[0].CertificateExpiry.Subject)
+	assert.Equal(t, 21, *received[0].CertificateExpiry.Threshold)
+
+	// Deactivated sources are forgotten
+	require.NoError(t, db.Model(&gormmodels.CertificateAuthority{}).Where("id = ?", caIDs[2]).Update("is_active", false).Error)
+	_, err = monitor.Check(ctx)
+	require.NoError(t, err)
+	var count int64
+	require.NoError(t, db.Model(&gormmodels.CertificateExpiry{}).Where("source_id = ?", caIDs[2]).Count(&count).Error)
+	assert.Zero(t, count)
+	require.NoError(t, db.Model(&gormmodels.CertificateExpiry{}).Count(&count).Error)
+	assert.Equal(t, int64(4), count)
+}
@@ -23,6 +23,9 @@ type CertificateManager struct {
 	certPoolMutex   sync.RWMutex
 	lastRefresh     time.Time
 	refreshInterval time.Duration
+	
+	// Expired CAs already reported as left out of the pool
+	droppedExpired map[string]bool
 }
 
 func NewCertificateManager(db *database.GormDB, logger *logrus.Logger) *CertificateManager {
@@ -31,6 +34,7 @@ func NewCertificateManager(db *database.GormDB, logger *logrus.Logger) *Certific
 		logger:          logger,
 		certService:     NewCertificateService(),
 		refreshInterval: 5 * time.Minute, // Refresh certificates every 5 minutes
+		droppedExpired:  make(map[string]bool),
 	}
 }
 
@@ -75,7 +79,31 @@ func (cm *CertificateManager) refreshCertificates(ctx context.Context) error {
 		return fmt.Errorf("failed to create certificate pool: %w", err)
 	}
 	
+	// Active CAs that expired are left out; say so once for each
+	var expired []gormmodels.CertificateAuthority
+	expiredErr := cm.db.WithContext(ctx).
+		Where("is_active = ? AND not_after <= ?", true, time.Now()).
+		Find(&expired).Error
+	if expiredErr != nil {
+		cm.logger.WithError(expiredErr).Warn("Failed to query expired certificates")
+	}
+	
 	cm.certPoolMutex.Lock()
+	if expiredErr == nil {
+		dropped := make(map[string]bool)
+		for _, cert := range expired {
+			dropped[cert.ID] = true
+			if !cm.droppedExpired[cert.ID] {
+				cm.logger.WithFields(logrus.Fields{
+					"ca_id":       cert.ID,
+					"name":        cert.Name,
+					"fingerprint": cert.Fingerprint,
+					"not_after":   cert.NotAfter,
+				}).Warn("Expired certificate authority dropped from the certificate pool")
+			}
+		}
+		cm.droppedExpired = dropped
+	}
 	cm.certPool = pool
 	cm.lastRefresh = time.Now()
 	cm.certPoolMutex.Unlock()
@@ -102,17 +130,7 @@ func (cm *CertificateManager) GetTLSConfig(ctx context.Context, skipTLSVerify bo
 }
 
 func (cm *CertificateManager) GetHTTPClient(ctx context.Context, skipTLSVerify bool, timeout time.Duration) (*http.Client, error) {
-	tlsConfig, err := cm.GetTLSConfig(ctx, skipTLSVerify)
-	if err != nil {
-		return nil, err
-	}
-	
-	return &http.Client{
-		Timeout: timeout,
-		Transport: &http.Transport{
-			TLSClientConfig: tlsConfig,
-		},
-	}, nil
+	return cm.GetInstanceHTTPClient(ctx, TLSOptions{SkipTLSVerify: skipTLSVerify}, timeout)
 }
 
 // ForceRefresh immediately refreshes the certificate pool, bypassing the refresh interval.
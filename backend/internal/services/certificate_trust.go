@@ -0,0 +1,205 @@
+package services
+
+import (
+	"context"
+	"crypto/sha256"
+	"crypto/tls"
+	"crypto/x509"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"net"
+	"net/http"
+	"net/url"
+	"regexp"
+	"strings"
+	"time"
+
+	gormmodels "github.com/orca-ng/orca/internal/models/gorm"
+)
+
+// ErrCertificateNotPinned is returned when a PVWA presents a chain that
+// matches none of the instance's pins
+var ErrCertificateNotPinned = errors.New("server certificate does not match any pinned fingerprint")
+
+// TLSOptions describes how to connect to one PVWA
+type TLSOptions struct {
+	SkipTLSVerify     bool
+	ClientCertificate *ClientCertificate
+
+	// Certificate authorities the PVWA's chain must lead to. Without any,
+	// the system roots and every active CA are trusted.
+	TrustedCAIDs []string
+
+	// Fingerprints of which at least one must match the chain. Pins are
+	// checked even when chain verification is skipped.
+	Pins []gormmodels.CertificatePin
+}
+
+// InstanceTLSOptions loads the TLS settings of a CyberArk instance
+func (cm *CertificateManager) InstanceTLSOptions(ctx context.Context, instance *gormmodels.CyberArkInstance, clientCert *ClientCertificate) (TLSOptions, error) {
+	var caIDs []string
+	if err := cm.db.WithContext(ctx).Model(&gormmodels.InstanceCertificateAuthority{}).
+		Where("cyber_ark_instance_id = ?", instance.ID).
+		Pluck("certificate_authority_id", &caIDs).Error; err != nil {
+		return TLSOptions{}, fmt.Errorf("failed to load trusted certificate authorities: %w", err)
+	}
+
+	return TLSOptions{
+		SkipTLSVerify:     instance.SkipTLSVerify,
+		ClientCertificate: clientCert,
+		TrustedCAIDs:      caIDs,
+		Pins:              instance.PinnedCertificates,
+	}, nil
+}
+
+// GetInstanceTLSConfig builds the TLS configuration for a PVWA
+func (cm *CertificateManager) GetInstanceTLSConfig(ctx context.Context, opts TLSOptions) (*tls.Config, error) {
+	var tlsConfig *tls.Config
+	if len(opts.TrustedCAIDs) > 0 && !opts.SkipTLSVerify {
+		pool, err := cm.boundCertPool(ctx, opts.TrustedCAIDs)
+		if err != nil {
+			return nil, err
+		}
+		tlsConfig = &tls.Config{RootCAs: pool}
+	} else {
+		var err error
+		tlsConfig, err = cm.GetTLSConfig(ctx, opts.SkipTLSVerify)
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	if opts.ClientCertificate != nil {
+		tlsConfig.Certificates = []tls.Certificate{opts.ClientCertificate.KeyPair}
+	}
+	if len(opts.Pins) > 0 {
+		pins := opts.Pins
+		tlsConfig.VerifyConnection = func(state tls.ConnectionState) error {
+			return VerifyPins(state.PeerCertificates, pins)
+		}
+	}
+	return tlsConfig, nil
+}
+
+// GetInstanceHTTPClient returns an HTTP client for a PVWA
+func (cm *CertificateManager) GetInstanceHTTPClient(ctx context.Context, opts TLSOptions, timeout time.Duration) (*http.Client, error) {
+	tlsConfig, err := cm.GetInstanceTLSConfig(ctx, opts)
+	if err != nil {
+		return nil, err
+	}
+
+	return &http.Client{
+		Timeout: timeout,
+		Transport: &http.Transport{
+			TLSClientConfig: tlsConfig,
+		},
+	}, nil
+}
+
+// boundCertPool builds a pool from the given certificate authorities only
+func (cm *CertificateManager) boundCertPool(ctx context.Context, caIDs []string) (*x509.CertPool, error) {
+	var certificates []gormmodels.CertificateAuthority
+	if err := cm.db.WithContext(ctx).
+		Where("id IN ? AND is_active = ? AND not_after > ?", caIDs, true, time.Now()).
+		Find(&certificates).Error; err != nil {
+		return nil, fmt.Errorf("failed to query trusted certificate authorities: %w", err)
+	}
+	if len(certificates) == 0 {
+		return nil, fmt.Errorf("none of the certificate authorities trusted by the instance is active")
+	}
+
+	var pemCertificates []string
+	for _, cert := range certificates {
+		pemCertificates = append(pemCertificates, cert.Certificate)
+	}
+	return cm.certService.GetCertificatePool(pemCertificates)
+}
+
+var fingerprintPattern = regexp.MustCompile(`^[0-9a-f]{64}$`)
+
+// NormalizePin validates a pin and returns it with a lower case fingerprint
+// without separators, so that fingerprints copied from tools that print
+// them as AB:CD:... are accepted
+func NormalizePin(pin gormmodels.CertificatePin) (gormmodels.CertificatePin, error) {
+	if pin.Type != gormmodels.PinTypeLeaf && pin.Type != gormmodels.PinTypeSPKI {
+		return pin, fmt.Errorf("unsupported pin type %q", pin.Type)
+	}
+	pin.Fingerprint = strings.ToLower(strings.ReplaceAll(pin.Fingerprint, ":", ""))
+	if !fingerprintPattern.MatchString(pin.Fingerprint) {
+		return pin, fmt.Errorf("pin fingerprint must be a hex encoded SHA-256 hash")
+	}
+	return pin, nil
+}
+
+// VerifyPins checks a certificate chain, leaf first, against pins. A leaf pin
+// matches the first certificate, an SPKI pin the public key of any
+// certificate in the chain.
+func VerifyPins(chain []*x509.Certificate, pins []gormmodels.CertificatePin) error {
+	if len(chain) == 0 {
+		return ErrCertificateNotPinned
+	}
+	for _, pin := range pins {
+		switch pin.Type {
+		case gormmodels.PinTypeLeaf:
+			if CertificateFingerprint(chain[0]) == pin.Fingerprint {
+				return nil
+			}
+		case gormmodels.PinTypeSPKI:
+			for _, cert := range chain {
+				if SPKIFingerprint(cert) == pin.Fingerprint {
+					return nil
+				}
+			}
+		}
+	}
+	return ErrCertificateNotPinned
+}
+
+// CertificateFingerprint returns the hex SHA-256 hash of a certificate
+func CertificateFingerprint(cert *x509.Certificate) string {
+	hash := sha256.Sum256(cert.Raw)
+	return hex.EncodeToString(hash[:])
+}
+
+// SPKIFingerprint returns the hex SHA-256 hash of a certificate's public key
+func SPKIFingerprint(cert *x509.Certificate) string {
+	hash := sha256.Sum256(cert.RawSubjectPublicKeyInfo)
+	return hex.EncodeToString(hash[:])
+}
+
+// FetchServerChain connects to a TLS server and returns the certificate chain
+// it presents, leaf first. The chain is not verified, so that it can be
+// inspected before it is trusted.
+func FetchServerChain(ctx context.Context, rawURL string, timeout time.Duration) ([]*x509.Certificate, error) {
+	u, err := url.Parse(rawURL)
+	if err != nil || u.Hostname() == "" {
+		return nil, fmt.Errorf("invalid URL %q", rawURL)
+	}
+	if u.Scheme != "https" {
+		return nil, fmt.Errorf("URL must use https")
+	}
+	port := u.Port()
+	if port == "" {
+		port = "443"
+	}
+
+	dialer := &tls.Dialer{
+		NetDialer: &net.Dialer{Timeout: timeout},
+		Config: &tls.Config{
+			ServerName:         u.Hostname(),
+			InsecureSkipVerify: true,
+		},
+	}
+	conn, err := dialer.DialContext(ctx, "tcp", net.JoinHostPort(u.Hostname(), port))
+	if err != nil {
+		return nil, fmt.Errorf("failed to connect to %s: %w", u.Host, err)
+	}
+	defer conn.Close()
+
+	chain := conn.(*tls.Conn).ConnectionState().PeerCertificates
+	if len(chain) == 0 {
+		return nil, fmt.Errorf("%s presented no certificate", u.Host)
+	}
+	return chain, nil
+}
@@ -0,0 +1,215 @@
+package services_test
+
+import (
+	"context"
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/tls"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"encoding/pem"
+	"math/big"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/sirupsen/logrus"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"gorm.io/driver/sqlite"
+	"gorm.io/gorm"
+
+	"github.com/orca-ng/orca/internal/database"
+	gormmodels "github.com/orca-ng/orca/internal/models/gorm"
+	"github.com/orca-ng/orca/internal/services"
+)
+
+type testCA struct {
+	cert *x509.Certificate
+	key  *ecdsa.PrivateKey
+}
+
+func newTestCA(t *testing.T, name string) *testCA {
+	t.Helper()
+	return newTestCAExpiring(t, name, time.Now().Add(24*time.Hour))
+}
+
+func newTestCAExpiring(t *testing.T, name string, notAfter time.Time) *testCA {
+	t.Helper()
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	require.NoError(t, err)
+	template := &x509.Certificate{
+		SerialNumber:          big.NewInt(time.Now().UnixNano()),
+		Subject:               pkix.Name{CommonName: name},
+		NotBefore:             time.Now().Add(-48 * time.Hour),
+		NotAfter:              notAfter,
+		KeyUsage:              x509.KeyUsageCertSign,
+		BasicConstraintsValid: true,
+		IsCA:                  true,
+	}
+	der, err := x509.CreateCertificate(rand.Reader, template, template, &key.PublicKey, key)
+	require.NoError(t, err)
+	cert, err := x509.ParseCertificate(der)
+	require.NoError(t, err)
+	return &testCA{cert: cert, key: key}
+}
+
+func (ca *testCA) pem() string {
+	return string(pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE", Bytes: ca.cert.Raw}))
+}
+
+// serverCertificate issues a certificate for 127.0.0.1, presented with the CA
+func (ca *testCA) serverCertificate(t *testing.T, name string) tls.Certificate {
+	t.Helper()
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	require.NoError(t, err)
+	template := &x509.Certificate{
+		SerialNumber: big.NewInt(time.Now().UnixNano()),
+		Subject:      pkix.Name{CommonName: name},
+		NotBefore:    time.Now().Add(-time.Hour),
+		NotAfter:     time.Now().Add(24 * time.Hour),
+		KeyUsage:     x509.KeyUsageDigitalSignature,
+		ExtKeyUsage:  []x509.ExtKeyUsage{x509.ExtKeyUsageServerAuth},
+		IPAddresses:  []net.IP{net.ParseIP("127.0.0.1")},
+	}
+	der, err := x509.CreateCertificate(rand.Reader, template, ca.cert, &key.PublicKey, ca.key)
+	require.NoError(t, err)
+	return tls.Certificate{
+		Certificate: [][]byte{der, ca.cert.Raw},
+		PrivateKey:  key,
+	}
+}
+
+// pvwa starts a TLS server for 127.0.0.1 with a certificate issued by the CA
+func (ca *testCA) pvwa(t *testing.T) *httptest.Server {
+	t.Helper()
+	server := httptest.NewUnstartedServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {}))
+	server.TLS = &tls.Config{Certificates: []tls.Certificate{ca.serverCertificate(t, "pvwa")}}
+	server.StartTLS()
+	t.Cleanup(server.Close)
+	return server
+}
+
+func setupTrustDB(t *testing.T, cas ...*testCA) (*services.CertificateManager, []string) {
+	t.Helper()
+	db, err := gorm.Open(sqlite.Open(":memory:"), &gorm.Config{})
+	require.NoError(t, err)
+	require.NoError(t, db.AutoMigrate(&gormmodels.CertificateAuthority{}, &gormmodels.InstanceCertificateAuthority{}))
+
+	var ids []string
+	for _, ca := range cas {
+		record := gormmodels.CertificateAuthority{
+			Name:        ca.cert.Subject.CommonName,
+			Certificate: ca.pem(),
+			Fingerprint: services.CertificateFingerprint(ca.cert),
+			Subject:     ca.cert.Subject.String(),
+			Issuer:      ca.cert.Issuer.String(),
+			NotBefore:   ca.cert.NotBefore,
+			NotAfter:    ca.cert.NotAfter,
+			IsActive:    true,
+		}
+		require.NoError(t, db.Create(&record).Error)
+		ids = append(ids, record.ID)
+	}
+	return services.NewCertificateManager(&database.GormDB{DB: db}, logrus.New()), ids
+}
+
+func get(t *testing.T, cm *services.CertificateManager, opts services.TLSOptions, url string) error {
+	t.Helper()
+	client, err := cm.GetInstanceHTTPClient(context.Background(), opts, 5*time.Second)
+	require.NoError(t, err)
+	resp, err := client.Get(url)
+	if err == nil {
+		resp.Body.Close()
+	}
+	return err
+}
+
+func TestInstanceTrustsOnlyBoundCertificateAuthorities(t *testing.T) {
+	issuing := newTestCA(t, "Issuing CA")
+	other := newTestCA(t, "Other CA")
+	cm, ids := setupTrustDB(t, issuing, other)
+	server := issuing.pvwa(t)
+
+	// Any active CA is trusted without bindings
+	assert.NoError(t, get(t, cm, services.TLSOptions{}, server.URL))
+
+	// Bound to the CA that issued the certificate
+	assert.NoError(t, get(t, cm, services.TLSOptions{TrustedCAIDs: ids[:1]}, server.URL))
+
+	// Bound to another CA, although the issuing one is registered
+	err := get(t, cm, services.TLSOptions{TrustedCAIDs: ids[1:]}, server.URL)
+	require.Error(t, err)
+	assert.Contains(t, err.Error(), "certificate signed by unknown authority")
+
+	// Bound only to inactive CAs
+	_, err = cm.GetInstanceHTTPClient(context.Background(), services.TLSOptions{TrustedCAIDs: []string{"ca_missing"}}, time.Second)
+	assert.Error(t, err)
+}
+
+func TestInstanceCertificatePins(t *testing.T) {
+	issuing := newTestCA(t, "Issuing CA")
+	cm, _ := setupTrustDB(t, issuing)
+	server := issuing.pvwa(t)
+	leaf := server.TLS.Certificates[0].Certificate[0]
+	leafCert, err := x509.ParseCertificate(leaf)
+	require.NoError(t, err)
+
+	other := newTestCA(t, "Other CA")
+	tests := []struct {
+		name    string
+		pin     gormmodels.CertificatePin
+		wantErr bool
+	}{
+		{"leaf", gormmodels.CertificatePin{Type: gormmodels.PinTypeLeaf, Fingerprint: services.CertificateFingerprint(leafCert)}, false},
+		{"spki of issuing CA", gormmodels.CertificatePin{Type: gormmodels.PinTypeSPKI, Fingerprint: services.SPKIFingerprint(issuing.cert)}, false},
+		{"leaf pin of CA", gormmodels.CertificatePin{Type: gormmodels.PinTypeLeaf, Fingerprint: services.CertificateFingerprint(issuing.cert)}, true},
+		{"spki of other CA", gormmodels.CertificatePin{Type: gormmodels.PinTypeSPKI, Fingerprint: services.SPKIFingerprint(other.cert)}, true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			pins := []gormmodels.CertificatePin{tt.pin}
+			err := get(t, cm, services.TLSOptions{Pins: pins}, server.URL)
+			// Pins hold even when chain verification is skipped
+			skipErr := get(t, cm, services.TLSOptions{SkipTLSVerify: true, Pins: pins}, server.URL)
+			if tt.wantErr {
+				assert.ErrorIs(t, err, services.ErrCertificateNotPinned)
+				assert.ErrorIs(t, skipErr, services.ErrCertificateNotPinned)
+			} else {
+				assert.NoError(t, err)
+				assert.NoError(t, skipErr)
+			}
+		})
+	}
+}
+
+func TestNormalizePin(t *testing.T) {
+	pin, err := services.NormalizePin(gormmodels.CertificatePin{
+		Type:        gormmodels.PinTypeSPKI,
+		Fingerprint: "AB:CD:EF:01:23:45:67:89:AB:CD:EF:01:23:45:67:89:AB:CD:EF:01:23:45:67:89:AB:CD:EF:01:23:45:67:89",
+	})
+	require.NoError(t, err)
+	assert.Equal(t, "abcdef0123456789abcdef0123456789abcdef0123456789abcdef0123456789", pin.Fingerprint)
+
+	_, err = services.NormalizePin(gormmodels.CertificatePin{Type: "sha1", Fingerprint: pin.Fingerprint})
+	assert.Error(t, err)
+	_, err = services.NormalizePin(gormmodels.CertificatePin{Type: gormmodels.PinTypeLeaf, Fingerprint: "abcd"})
+	assert.Error(t, err)
+}
+
+func TestFetchServerChain(t *testing.T) {
+	issuing := newTestCA(t, "Issuing CA")
+	server := issuing.pvwa(t)
+
+	chain, err := services.FetchServerChain(context.Background(), server.URL, 5*time.Second)
+	require.NoError(t, err)
+	require.Len(t, chain, 2)
+	assert.Equal(t, "pvwa", chain[0].Subject.CommonName)
+	assert.True(t, chain[1].Equal(issuing.cert))
+
+	_, err = services.FetchServerChain(context.Background(), "http://"+server.Listener.Addr().String(), time.Second)
+	assert.Error(t, err)
+}
@@ -0,0 +1,60 @@
+package services
+
+import (
+	"crypto/tls"
+	"crypto/x509"
+	"fmt"
+	"strings"
+
+	"github.com/orca-ng/orca/internal/crypto"
+)
+
+// ClientCertificate is a certificate and private key presented to a PVWA
+// for mutual TLS or certificate logon
+type ClientCertificate struct {
+	KeyPair tls.Certificate
+	Leaf    *ParsedCertificate
+}
+
+// ParseClientCertificate parses a PEM certificate, optionally followed by
+// its chain, and the matching PEM private key
+func (s *CertificateService) ParseClientCertificate(certPEM, keyPEM string) (*ClientCertificate, error) {
+	keyPair, err := tls.X509KeyPair([]byte(strings.TrimSpace(certPEM)), []byte(strings.TrimSpace(keyPEM)))
+	if err != nil {
+		return nil, fmt.Errorf("invalid client certificate or key: %w", err)
+	}
+
+	leaf, err := x509.ParseCertificate(keyPair.Certificate[0])
+	if err != nil {
+		return nil, fmt.Errorf("failed to parse client certificate: %w", err)
+	}
+	keyPair.Leaf = leaf
+
+	return &ClientCertificate{
+		KeyPair: keyPair,
+		Leaf: &ParsedCertificate{
+			Certificate:  leaf,
+			Fingerprint:  s.calculateFingerprint(leaf.Raw),
+			Subject:      leaf.Subject.String(),
+			Issuer:       leaf.Issuer.String(),
+			NotBefore:    leaf.NotBefore,
+			NotAfter:     leaf.NotAfter,
+			IsCA:         leaf.IsCA,
+			IsSelfSigned: leaf.Subject.String() == leaf.Issuer.String(),
+		},
+	}, nil
+}
+
+// LoadClientCertificate decrypts a stored private key and parses it with its
+// certificate. It returns nil if no certificate is stored.
+func (s *CertificateService) LoadClientCertificate(certPEM, encryptedKey string, encryptor *crypto.Encryptor) (*ClientCertificate, error) {
+	if certPEM == "" {
+		return nil, nil
+	}
+
+	keyPEM, err := encryptor.Decrypt(encryptedKey)
+	if err != nil {
+		return nil, fmt.Errorf("decrypt client key: %w", err)
+	}
+	return s.ParseClientCertificate(certPEM, keyPEM)
+}
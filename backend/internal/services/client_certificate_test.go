@@ -0,0 +1,62 @@
+package services_test
+
+import (
+	"crypto/rsa"
+	"crypto/x509"
+	"encoding/pem"
+	"testing"
+	"time"
+
+	"github.com/orca-ng/orca/internal/crypto"
+	"github.com/orca-ng/orca/internal/services"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// Helper function to encode a private key to PEM
+func encodeKeyToPEM(key *rsa.PrivateKey) string {
+	return string(pem.EncodeToMemory(&pem.Block{
+		Type:  "RSA PRIVATE KEY",
+		Bytes: x509.MarshalPKCS1PrivateKey(key),
+	}))
+}
+
+func TestParseClientCertificate(t *testing.T) {
+	key := generatePrivateKey(t)
+	template := createCertTemplate("orca-client", false, true)
+	template.ExtKeyUsage = []x509.ExtKeyUsage{x509.ExtKeyUsageClientAuth}
+	certPEM := encodeCertToPEM(createCertificate(t, template, template, &key.PublicKey, key))
+
+	certService := services.NewCertificateService()
+	cert, err := certService.ParseClientCertificate(certPEM, encodeKeyToPEM(key))
+	require.NoError(t, err)
+	assert.Equal(t, "CN=orca-client,OU=Test Unit,O=Test Organization,C=US", cert.Leaf.Subject)
+	assert.WithinDuration(t, template.NotAfter, cert.Leaf.NotAfter, time.Second)
+	assert.Len(t, cert.Leaf.Fingerprint, 64)
+	assert.NotNil(t, cert.KeyPair.Leaf)
+
+	// The key must belong to the certificate
+	_, err = certService.ParseClientCertificate(certPEM, encodeKeyToPEM(generatePrivateKey(t)))
+	assert.Error(t, err)
+}
+
+func TestLoadClientCertificate(t *testing.T) {
+	key := generatePrivateKey(t)
+	template := createCertTemplate("orca-client", false, true)
+	certPEM := encodeCertToPEM(createCertificate(t, template, template, &key.PublicKey, key))
+
+	encryptor := crypto.NewEncryptor("test-encryption-key")
+	encryptedKey, err := encryptor.Encrypt(encodeKeyToPEM(key))
+	require.NoError(t, err)
+
+	certService := services.NewCertificateService()
+	cert, err := certService.LoadClientCertificate(certPEM, encryptedKey, encryptor)
+	require.NoError(t, err)
+	require.NotNil(t, cert)
+	assert.Equal(t, "CN=orca-client,OU=Test Unit,O=Test Organization,C=US", cert.Leaf.Subject)
+
+	// Instances without a client certificate
+	cert, err = certService.LoadClientCertificate("", "", encryptor)
+	assert.NoError(t, err)
+	assert.Nil(t, cert)
+}
@@ -0,0 +1,159 @@
+package services
+
+import (
+	"context"
+	"time"
+
+	"github.com/sirupsen/logrus"
+
+	"github.com/orca-ng/orca/internal/database"
+	gormmodels "github.com/orca-ng/orca/internal/models/gorm"
+)
+
+// EventNotice is the form in which events travel between replicas. It only
+// references the changed row, keeping notices well within NOTIFY's payload
+// limit; the receiving replica reloads the row before delivering the event.
+type EventNotice struct {
+	Origin              string    `json:"origin"`
+	Type                string    `json:"type"`
+	OperationID         string    `json:"operation_id,omitempty"`
+	SyncJobID           string    `json:"sync_job_id,omitempty"`
+	CertificateExpiryID string    `json:"certificate_expiry_id,omitempty"`
+	Timestamp           time.Time `json:"timestamp"`
+}
+
+// EventBroker relays event notices between ORCA replicas
+type EventBroker interface {
+	// Publish announces a locally produced event to the other replicas
+	Publish(ctx context.Context, notice *EventNotice) error
+
+	// Listen delivers notices from all replicas until ctx is done or the
+	// connection fails
+	Listen(ctx context.Context, deliver func(*EventNotice)) error
+}
+
+// NewEventBroker returns the best broker for the database: LISTEN/NOTIFY on
+// Postgres, and polling the cluster_events table everywhere else
+func NewEventBroker(db *database.GormDB, logger *logrus.Logger) EventBroker {
+	if db.Dialector.Name() == "postgres" {
+		return NewPostgresEventBroker(db, logger)
+	}
+	return NewPollingEventBroker(db, logger)
+}
+
+// EnableFanOut shares events published on this replica with the other
+// replicas through broker, and delivers theirs to local subscribers.
+// It must be called before events are published.
+func (s *OperationEventService) EnableFanOut(ctx context.Context, db *database.GormDB, broker EventBroker, origin string) {
+	s.db = db
+	s.origin = origin
+	s.outbox = make(chan *EventNotice, 1000)
+
+	go s.forwardNotices(ctx, broker)
+	go s.receiveNotices(ctx, broker)
+
+	s.logger.WithField("origin", origin).Info("Cross-replica event fan-out enabled")
+}
+
+// announce queues an event for the other replicas without blocking the caller
+func (s *OperationEventService) announce(event *OperationEvent) {
+	if s.outbox == nil {
+		return
+	}
+
+	notice := &EventNotice{
+		Origin:    s.origin,
+		Type:      event.Type,
+		Timestamp: event.Timestamp,
+	}
+	if event.Operation != nil {
+		notice.OperationID = event.Operation.ID
+	}
+	if event.SyncJob != nil {
+		notice.SyncJobID = event.SyncJob.ID
+	}
+	if event.CertificateExpiry != nil {
+		notice.CertificateExpiryID = event.CertificateExpiry.ID
+	}
+
+	select {
+	case s.outbox <- notice:
+	default:
+		s.logger.WithField("type", event.Type).Warn("Event fan-out queue full, event not shared with other replicas")
+	}
+}
+
+// forwardNotices publishes queued notices through the broker
+func (s *OperationEventService) forwardNotices(ctx context.Context, broker EventBroker) {
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case notice := <-s.outbox:
+			if err := broker.Publish(ctx, notice); err != nil && ctx.Err() == nil {
+				s.logger.WithError(err).Warn("Failed to share event with other replicas")
+			}
+		}
+	}
+}
+
+// receiveNotices listens for notices from other replicas, reconnecting
+// after failures
+func (s *OperationEventService) receiveNotices(ctx context.Context, broker EventBroker) {
+	for {
+		err := broker.Listen(ctx, s.deliverNotice)
+		if ctx.Err() != nil {
+			return
+		}
+
+		s.logger.WithError(err).Warn("Event fan-out listener stopped, reconnecting")
+		select {
+		case <-ctx.Done():
+			return
+		case <-time.After(5 * time.Second):
+		}
+	}
+}
+
+// deliverNotice reloads the row a remote notice refers to and delivers the
+// event to local subscribers
+func (s *OperationEventService) deliverNotice(notice *EventNotice) {
+	// Our own events have already been delivered locally
+	if notice.Origin == s.origin {
+		return
+	}
+
+	event := &OperationEvent{
+		Type:      notice.Type,
+		Timestamp: notice.Timestamp,
+	}
+
+	if notice.OperationID != "" {
+		var op gormmodels.Operation
+		if err := s.db.First(&op, "id = ?", notice.OperationID).Error; err != nil {
+			s.logger.WithError(err).WithField("operation_id", notice.OperationID).Debug("Skipping remote event for unknown operation")
+			return
+		}
+		event.Operation = &op
+	}
+
+	if notice.SyncJobID != "" {
+		var job gormmodels.SyncJob
+		if err := s.db.First(&job, "id = ?", notice.SyncJobID).Error; err != nil {
+			s.logger.WithError(err).WithField("sync_job_id", notice.SyncJobID).Debug("Skipping remote event for unknown sync job")
+			return
+		}
+		event.SyncJob = &job
+	}
+
+	if notice.CertificateExpiryID != "" {
+		var expiry gormmodels.CertificateExpiry
+		if err := s.db.First(&expiry, "id = ?", notice.CertificateExpiryID).Error; err != nil {
+			s.logger.WithError(err).WithField("certificate_expiry_id", notice.CertificateExpiryID).Debug("Skipping remote event for unknown certificate")
+			return
+		}
+		event.CertificateExpiry = &expiry
+	}
+
+	s.deliver(event)
+}
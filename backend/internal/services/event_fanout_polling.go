@@ -0,0 +1,177 @@
+package services
+
+import (
+	"context"
+	"fmt"
+	"time"
+
+	"github.com/sirupsen/logrus"
+
+	"github.com/orca-ng/orca/internal/database"
+	gormmodels "github.com/orca-ng/orca/internal/models/gorm"
+)
+
+const (
+	// eventPollInterval is how often replicas check for new cluster events
+	eventPollInterval = time.Second
+
+	// eventRetention is how long cluster events are kept. Replicas that fall
+	// further behind than this miss events; SSE clients resync on reconnect.
+	eventRetention = 5 * time.Minute
+
+	// eventCommitWindow bounds how long after its creation an event may
+	// commit. Ids are allocated at insert, so on MySQL and SQL Server an
+	// event can become visible after events with higher ids; ids this
+	// recent are read again on every poll until they are settled.
+	eventCommitWindow = 30 * time.Second
+
+	// eventPollBatch is the page size when reading cluster events
+	eventPollBatch = 500
+)
+
+// PollingEventBroker relays events between replicas through the
+// cluster_events table, for databases without LISTEN/NOTIFY
+type PollingEventBroker struct {
+	db     *database.GormDB
+	logger *logrus.Logger
+}
+
+// NewPollingEventBroker creates a new polling event broker
+func NewPollingEventBroker(db *database.GormDB, logger *logrus.Logger) *PollingEventBroker {
+	return &PollingEventBroker{
+		db:     db,
+		logger: logger,
+	}
+}
+
+// Publish records a notice in the cluster_events table
+func (b *PollingEventBroker) Publish(ctx context.Context, notice *EventNotice) error {
+	event := &gormmodels.ClusterEvent{
+		Origin:    notice.Origin,
+		Type:      notice.Type,
+		CreatedAt: notice.Timestamp,
+	}
+	if notice.OperationID != "" {
+		event.OperationID = &notice.OperationID
+	}
+	if notice.SyncJobID != "" {
+		event.SyncJobID = &notice.SyncJobID
+	}
+	if notice.CertificateExpiryID != "" {
+		event.CertificateExpiryID = &notice.CertificateExpiryID
+	}
+
+	if err := b.db.WithContext(ctx).Create(event).Error; err != nil {
+		return fmt.Errorf("record cluster event: %w", err)
+	}
+	return nil
+}
+
+// Listen polls for events recorded after it started
+func (b *PollingEventBroker) Listen(ctx context.Context, deliver func(*EventNotice)) error {
+	// Only events from now on are of interest. Events still inside the
+	// commit window are marked seen so that they are not delivered, while
+	// ones committing later below them are.
+	var floor uint64
+	if err := b.db.WithContext(ctx).Model(&gormmodels.ClusterEvent{}).
+		Where("created_at < ?", time.Now().Add(-eventCommitWindow)).
+		Select("COALESCE(MAX(id), 0)").Scan(&floor).Error; err != nil {
+		return fmt.Errorf("find latest cluster event: %w", err)
+	}
+	seen := make(map[uint64]time.Time)
+	if _, err := b.poll(ctx, floor, seen, nil); err != nil {
+		return err
+	}
+
+	ticker := time.NewTicker(eventPollInterval)
+	defer ticker.Stop()
+
+	lastPrune := time.Now()
+
+	for {
+		select {
+		case <-ctx.Done():
+			return ctx.Err()
+		case <-ticker.C:
+		}
+
+		var err error
+		if floor, err = b.poll(ctx, floor, seen, deliver); err != nil {
+			return err
+		}
+
+		// Any replica may prune; concurrent deletes are harmless
+		if time.Since(lastPrune) > time.Minute {
+			lastPrune = time.Now()
+			if err := b.db.WithContext(ctx).
+				Where("created_at < ?", time.Now().Add(-eventRetention)).
+				Delete(&gormmodels.ClusterEvent{}).Error; err != nil {
+				b.logger.WithError(err).Warn("Failed to prune cluster events")
+			}
+		}
+	}
+}
+
+// poll delivers the events above floor that are not in seen, marking them
+// seen, and returns the new floor: the highest id whose event is older than
+// the commit window, below which nothing can commit any more. A nil deliver
+// only marks events seen.
+func (b *PollingEventBroker) poll(ctx context.Context, floor uint64, seen map[uint64]time.Time, deliver func(*EventNotice)) (uint64, error) {
+	cursor := floor
+	for {
+		var events []gormmodels.ClusterEvent
+		if err := b.db.WithContext(ctx).
+			Where("id > ?", cursor).
+			Order("id").
+			Limit(eventPollBatch).
+			Find(&events).Error; err != nil {
+			return floor, fmt.Errorf("poll cluster events: %w", err)
+		}
+
+		for _, event := range events {
+			cursor = event.ID
+			if _, ok := seen[event.ID]; ok {
+				continue
+			}
+			seen[event.ID] = event.CreatedAt
+			if deliver != nil {
+				deliver(clusterEventNotice(&event))
+			}
+		}
+
+		if len(events) < eventPollBatch {
+			break
+		}
+	}
+
+	settled := time.Now().Add(-eventCommitWindow)
+	for id, createdAt := range seen {
+		if id > floor && createdAt.Before(settled) {
+			floor = id
+		}
+	}
+	for id := range seen {
+		if id <= floor {
+			delete(seen, id)
+		}
+	}
+	return floor, nil
+}
+
+func clusterEventNotice(event *gormmodels.ClusterEvent) *EventNotice {
+	notice := &EventNotice{
+		Origin:    event.Origin,
+		Type:      event.Type,
+		Timestamp: event.CreatedAt,
+	}
+	if event.OperationID != nil {
+		notice.OperationID = *event.OperationID
+	}
+	if event.SyncJobID != nil {
+		notice.SyncJobID = *event.SyncJobID
+	}
+	if event.CertificateExpiryID != nil {
+		notice.CertificateExpiryID = *event.CertificateExpiryID
+	}
+	return notice
+}
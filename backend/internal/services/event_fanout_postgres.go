@@ -0,0 +1,87 @@
+package services
+
+import (
+	"context"
+	"database/sql/driver"
+	"encoding/json"
+	"fmt"
+
+	"github.com/jackc/pgx/v5/stdlib"
+	"github.com/sirupsen/logrus"
+
+	"github.com/orca-ng/orca/internal/database"
+)
+
+// eventChannel is the Postgres notification channel used for event fan-out
+const eventChannel = "orca_events"
+
+// PostgresEventBroker relays events between replicas with LISTEN/NOTIFY
+type PostgresEventBroker struct {
+	db     *database.GormDB
+	logger *logrus.Logger
+}
+
+// NewPostgresEventBroker creates a new Postgres event broker
+func NewPostgresEventBroker(db *database.GormDB, logger *logrus.Logger) *PostgresEventBroker {
+	return &PostgresEventBroker{
+		db:     db,
+		logger: logger,
+	}
+}
+
+// Publish sends a notice on the event channel
+func (b *PostgresEventBroker) Publish(ctx context.Context, notice *EventNotice) error {
+	payload, err := json.Marshal(notice)
+	if err != nil {
+		return fmt.Errorf("marshal event notice: %w", err)
+	}
+
+	return b.db.WithContext(ctx).Exec("SELECT pg_notify(?, ?)", eventChannel, string(payload)).Error
+}
+
+// Listen holds a dedicated connection listening on the event channel
+func (b *PostgresEventBroker) Listen(ctx context.Context, deliver func(*EventNotice)) error {
+	sqlDB, err := b.db.DB.DB()
+	if err != nil {
+		return fmt.Errorf("get database handle: %w", err)
+	}
+
+	conn, err := sqlDB.Conn(ctx)
+	if err != nil {
+		return fmt.Errorf("get listener connection: %w", err)
+	}
+	defer conn.Close()
+
+	return conn.Raw(func(driverConn any) error {
+		stdConn, ok := driverConn.(*stdlib.Conn)
+		if !ok {
+			return fmt.Errorf("unexpected postgres driver connection %T", driverConn)
+		}
+		pgConn := stdConn.Conn()
+
+		if _, err := pgConn.Exec(ctx, "LISTEN "+eventChannel); err != nil {
+			return fmt.Errorf("listen: %w", err)
+		}
+
+		b.logger.WithField("channel", eventChannel).Debug("Listening for events from other replicas")
+
+		for {
+			notification, err := pgConn.WaitForNotification(ctx)
+			if err != nil {
+				if ctx.Err() == nil {
+					b.logger.WithError(err).Warn("Lost event listener connection")
+				}
+				// The connection is still subscribed to the channel, so
+				// keep it out of the pool
+				return driver.ErrBadConn
+			}
+
+			var notice EventNotice
+			if err := json.Unmarshal([]byte(notification.Payload), &notice); err != nil {
+				b.logger.WithError(err).Warn("Ignoring malformed event notice")
+				continue
+			}
+			deliver(&notice)
+		}
+	})
+}
@@ -0,0 +1,201 @@
+package services
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"strings"
+	"time"
+
+	"github.com/sirupsen/logrus"
+	"gorm.io/gorm"
+
+	"github.com/orca-ng/orca/internal/database"
+	gormmodels "github.com/orca-ng/orca/internal/models/gorm"
+)
+
+// ErrIdentityConflict is returned when an external identity would take over
+// an account of another provider
+var ErrIdentityConflict = errors.New("username is already used by another account")
+
+// ExternalIdentity is a user as asserted by an external identity provider
+type ExternalIdentity struct {
+	Provider string // gormmodels.AuthProvider*
+	Subject  string // stable identifier at the provider
+	Username string
+	Email    string
+	Groups   []string
+}
+
+// GroupMapping maps identity provider groups to admin status and ORCA roles.
+// Groups are compared case-insensitively.
+type GroupMapping struct {
+	AdminGroups []string
+	GroupRoles  map[string][]string // group -> role names
+}
+
+// IdentityProvisioner creates and updates users authenticated by external
+// identity providers when they log in
+type IdentityProvisioner struct {
+	db     *database.GormDB
+	logger *logrus.Logger
+}
+
+// NewIdentityProvisioner creates a new identity provisioner
+func NewIdentityProvisioner(db *database.GormDB, logger *logrus.Logger) *IdentityProvisioner {
+	return &IdentityProvisioner{
+		db:     db,
+		logger: logger,
+	}
+}
+
+// Provision creates the user of an external identity or updates it, setting
+// admin status and the global role assignments of the provider from the
+// identity's groups. Role assignments made through the API are kept. The
+// returned user may be inactive, which callers must check.
+func (p *IdentityProvisioner) Provision(ctx context.Context, identity ExternalIdentity, mapping GroupMapping) (*gormmodels.User, error) {
+	if identity.Provider == "" || identity.Subject == "" || identity.Username == "" {
+		return nil, fmt.Errorf("identity is missing provider, subject or username")
+	}
+
+	isAdmin := false
+	for _, group := range identity.Groups {
+		if containsFold(mapping.AdminGroups, group) {
+			isAdmin = true
+			break
+		}
+	}
+
+	var roleNames []string
+	for group, roles := range mapping.GroupRoles {
+		if containsFold(identity.Groups, group) {
+			roleNames = appendUnique(roleNames, roles...)
+		}
+	}
+
+	var user gormmodels.User
+	err := p.db.WithContext(ctx).Transaction(func(tx *gorm.DB) error {
+		err := tx.Where("auth_provider = ? AND external_id = ?", identity.Provider, identity.Subject).First(&user).Error
+		switch {
+		case errors.Is(err, gorm.ErrRecordNotFound):
+			var taken int64
+			if err := tx.Model(&gormmodels.User{}).Where("username = ?", identity.Username).Count(&taken).Error; err != nil {
+				return err
+			}
+			if taken > 0 {
+				return ErrIdentityConflict
+			}
+			subject := identity.Subject
+			user = gormmodels.User{
+				Username:     identity.Username,
+				PasswordHash: "", // no local password
+				AuthProvider: identity.Provider,
+				ExternalID:   &subject,
+				Email:        identity.Email,
+				IsActive:     true,
+				IsAdmin:      isAdmin,
+			}
+			if err := tx.Create(&user).Error; err != nil {
+				return err
+			}
+			p.logger.WithFields(logrus.Fields{
+				"user_id":  user.ID,
+				"username": user.Username,
+				"provider": identity.Provider,
+			}).Info("User provisioned from identity provider")
+		case err != nil:
+			return err
+		default:
+			if user.Username != identity.Username {
+				var taken int64
+				if err := tx.Model(&gormmodels.User{}).Where("username = ? AND id <> ?", identity.Username, user.ID).Count(&taken).Error; err != nil {
+					return err
+				}
+				if taken > 0 {
+					return ErrIdentityConflict
+				}
+			}
+			user.Username = identity.Username
+			user.Email = identity.Email
+			user.IsAdmin = isAdmin
+			if err := tx.Model(&user).Select("username", "email", "is_admin").Updates(&user).Error; err != nil {
+				return err
+			}
+		}
+
+		now := time.Now().UTC()
+		user.LastLoginAt = &now
+		if err := tx.Model(&user).Update("last_login_at", now).Error; err != nil {
+			return err
+		}
+
+		return p.syncRoles(tx, &user, identity.Provider, roleNames)
+	})
+	if err != nil {
+		if errors.Is(err, ErrIdentityConflict) {
+			return nil, err
+		}
+		return nil, fmt.Errorf("failed to provision user: %w", err)
+	}
+	return &user, nil
+}
+
+// syncRoles makes the global assignments maintained by the provider match
+// the mapped roles
+func (p *IdentityProvisioner) syncRoles(tx *gorm.DB, user *gormmodels.User, provider string, roleNames []string) error {
+	var roles []gormmodels.Role
+	if len(roleNames) > 0 {
+		if err := tx.Where("name IN ?", roleNames).Find(&roles).Error; err != nil {
+			return err
+		}
+	}
+	wanted := make(map[string]bool)
+	for _, role := range roles {
+		wanted[role.ID] = true
+	}
+	if len(roles) < len(roleNames) {
+		p.logger.WithFields(logrus.Fields{
+			"user_id": user.ID,
+			"roles":   roleNames,
+		}).Warn("Some mapped roles do not exist")
+	}
+
+	var existing []gormmodels.RoleAssignment
+	if err := tx.Where("user_id = ? AND cyber_ark_instance_id IS NULL", user.ID).Find(&existing).Error; err != nil {
+		return err
+	}
+	held := make(map[string]bool)
+	for _, assignment := range existing {
+		if assignment.Source == provider && !wanted[assignment.RoleID] {
+			if err := tx.Delete(&assignment).Error; err != nil {
+				return err
+			}
+			continue
+		}
+		held[assignment.RoleID] = true
+	}
+
+	for _, role := range roles {
+		if held[role.ID] {
+			continue
+		}
+		assignment := gormmodels.RoleAssignment{
+			UserID: user.ID,
+			RoleID: role.ID,
+			Source: provider,
+		}
+		if err := tx.Create(&assignment).Error; err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func containsFold(values []string, value string) bool {
+	for _, v := range values {
+		if strings.EqualFold(v, value) {
+			return true
+		}
+	}
+	return false
+}
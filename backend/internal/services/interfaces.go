@@ -9,4 +9,6 @@ import (
 // SessionService defines the interface for session operations
 type SessionService interface {
 	GetSessionByToken(ctx context.Context, token string) (*gormmodels.Session, *gormmodels.User, error)
+	// GetAPIToken validates an API token and records its use from clientIP
+	GetAPIToken(ctx context.Context, token, clientIP string) (*gormmodels.APIToken, *gormmodels.User, error)
 }
\ No newline at end of file
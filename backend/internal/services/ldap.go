@@ -0,0 +1,219 @@
+package services
+
+import (
+	"context"
+	"crypto/tls"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"net"
+	"net/url"
+	"strings"
+	"time"
+	"unicode/utf8"
+
+	"github.com/go-ldap/ldap/v3"
+	"github.com/sirupsen/logrus"
+
+	"github.com/orca-ng/orca/internal/config"
+	gormmodels "github.com/orca-ng/orca/internal/models/gorm"
+)
+
+// ErrInvalidCredentials is returned when the directory does not know the
+// user or refuses the password
+var ErrInvalidCredentials = errors.New("invalid credentials")
+
+// LDAPAuthenticator checks passwords against an LDAP directory such as
+// Active Directory. Users are looked up with a service account and then
+// authenticated by binding as the user. TLS trusts the CAs managed in ORCA.
+type LDAPAuthenticator struct {
+	cfg         config.LDAPConfig
+	certManager *CertificateManager
+	logger      *logrus.Logger
+}
+
+// NewLDAPAuthenticator creates an authenticator for the configuration
+func NewLDAPAuthenticator(cfg config.LDAPConfig, certManager *CertificateManager, logger *logrus.Logger) *LDAPAuthenticator {
+	return &LDAPAuthenticator{
+		cfg:         cfg,
+		certManager: certManager,
+		logger:      logger,
+	}
+}
+
+// Authenticate verifies the password of a user and returns the identity
+// found in the directory. It returns ErrInvalidCredentials when the login is
+// refused and other errors when the directory cannot be used.
+func (a *LDAPAuthenticator) Authenticate(ctx context.Context, username, password string) (*ExternalIdentity, error) {
+	// An empty password would make an unauthenticated bind, which succeeds
+	if username == "" || password == "" {
+		return nil, ErrInvalidCredentials
+	}
+
+	conn, err := a.connect(ctx)
+	if err != nil {
+		return nil, err
+	}
+	defer conn.Close()
+
+	if a.cfg.BindDN != "" {
+		if err := conn.Bind(a.cfg.BindDN, a.cfg.BindPassword); err != nil {
+			return nil, fmt.Errorf("LDAP service account bind failed: %w", err)
+		}
+	}
+
+	entry, err := a.findUser(conn, username)
+	if err != nil {
+		return nil, err
+	}
+
+	// Groups are read with the service account, users may not see them
+	groups := entry.GetEqualFoldAttributeValues(a.cfg.GroupAttribute)
+	if a.cfg.GroupBaseDN != "" {
+		found, err := a.searchGroups(conn, entry.DN)
+		if err != nil {
+			return nil, err
+		}
+		groups = append(groups, found...)
+	}
+
+	if err := conn.Bind(entry.DN, password); err != nil {
+		if ldap.IsErrorWithCode(err, ldap.LDAPResultInvalidCredentials) {
+			return nil, ErrInvalidCredentials
+		}
+		return nil, fmt.Errorf("LDAP bind failed: %w", err)
+	}
+
+	identity := &ExternalIdentity{
+		Provider: gormmodels.AuthProviderLDAP,
+		Subject:  a.subject(entry),
+		Username: entry.GetEqualFoldAttributeValue(a.cfg.UsernameAttribute),
+		Email:    entry.GetEqualFoldAttributeValue(a.cfg.EmailAttribute),
+	}
+	if identity.Username == "" {
+		identity.Username = username
+	}
+	for _, group := range groups {
+		identity.Groups = appendUnique(identity.Groups, normalizeDN(group))
+	}
+	return identity, nil
+}
+
+// GroupMapping returns the configured mapping of group DNs to admin status
+// and roles
+func (a *LDAPAuthenticator) GroupMapping() GroupMapping {
+	mapping := groupMappingFromConfig(nil, a.cfg.GroupRoles)
+	for _, group := range a.cfg.AdminGroups {
+		mapping.AdminGroups = append(mapping.AdminGroups, normalizeDN(group))
+	}
+	normalized := make(map[string][]string, len(mapping.GroupRoles))
+	for group, roles := range mapping.GroupRoles {
+		dn := normalizeDN(group)
+		normalized[dn] = appendUnique(normalized[dn], roles...)
+	}
+	mapping.GroupRoles = normalized
+	return mapping
+}
+
+func (a *LDAPAuthenticator) connect(ctx context.Context) (*ldap.Conn, error) {
+	u, err := url.Parse(a.cfg.URL)
+	if err != nil {
+		return nil, fmt.Errorf("invalid LDAP URL: %w", err)
+	}
+	ldaps := strings.EqualFold(u.Scheme, "ldaps")
+
+	var tlsConfig *tls.Config
+	if ldaps || a.cfg.StartTLS {
+		tlsConfig, err = a.certManager.GetTLSConfig(ctx, a.cfg.SkipTLSVerify)
+		if err != nil {
+			return nil, err
+		}
+		tlsConfig.ServerName = u.Hostname()
+	}
+
+	timeout := time.Duration(a.cfg.Timeout) * time.Second
+	opts := []ldap.DialOpt{ldap.DialWithDialer(&net.Dialer{Timeout: timeout})}
+	if ldaps {
+		opts = append(opts, ldap.DialWithTLSConfig(tlsConfig))
+	}
+	conn, err := ldap.DialURL(a.cfg.URL, opts...)
+	if err != nil {
+		return nil, fmt.Errorf("failed to connect to LDAP server: %w", err)
+	}
+	conn.SetTimeout(timeout)
+
+	if a.cfg.StartTLS {
+		if err := conn.StartTLS(tlsConfig); err != nil {
+			conn.Close()
+			return nil, fmt.Errorf("LDAP StartTLS failed: %w", err)
+		}
+	}
+	return conn, nil
+}
+
+func (a *LDAPAuthenticator) findUser(conn *ldap.Conn, username string) (*ldap.Entry, error) {
+	filter := strings.ReplaceAll(a.cfg.UserFilter, "{username}", ldap.EscapeFilter(username))
+	var attributes []string
+	for _, attribute := range []string{a.cfg.UsernameAttribute, a.cfg.EmailAttribute, a.cfg.IDAttribute, a.cfg.GroupAttribute} {
+		if attribute != "" {
+			attributes = append(attributes, attribute)
+		}
+	}
+
+	// A size limit of two is enough to tell an ambiguous filter
+	result, err := conn.Search(ldap.NewSearchRequest(
+		a.cfg.BaseDN, ldap.ScopeWholeSubtree, ldap.NeverDerefAliases, 2, a.cfg.Timeout, false,
+		filter, attributes, nil,
+	))
+	if err != nil && !ldap.IsErrorWithCode(err, ldap.LDAPResultSizeLimitExceeded) {
+		return nil, fmt.Errorf("LDAP user search failed: %w", err)
+	}
+	if result == nil || len(result.Entries) == 0 {
+		a.logger.WithField("username", username).Debug("User not found in directory")
+		return nil, ErrInvalidCredentials
+	}
+	if len(result.Entries) > 1 || err != nil {
+		a.logger.WithField("username", username).Warn("LDAP user filter matches more than one entry")
+		return nil, ErrInvalidCredentials
+	}
+	return result.Entries[0], nil
+}
+
+func (a *LDAPAuthenticator) searchGroups(conn *ldap.Conn, userDN string) ([]string, error) {
+	filter := strings.ReplaceAll(a.cfg.GroupFilter, "{dn}", ldap.EscapeFilter(userDN))
+	result, err := conn.Search(ldap.NewSearchRequest(
+		a.cfg.GroupBaseDN, ldap.ScopeWholeSubtree, ldap.NeverDerefAliases, 0, a.cfg.Timeout, false,
+		filter, []string{"1.1"}, nil, // no attributes, only DNs
+	))
+	if err != nil {
+		return nil, fmt.Errorf("LDAP group search failed: %w", err)
+	}
+	groups := make([]string, 0, len(result.Entries))
+	for _, entry := range result.Entries {
+		groups = append(groups, entry.DN)
+	}
+	return groups, nil
+}
+
+// subject returns the stable identifier of an entry. Binary values such as
+// Active Directory's objectGUID are hex encoded.
+func (a *LDAPAuthenticator) subject(entry *ldap.Entry) string {
+	if a.cfg.IDAttribute != "" {
+		if raw := entry.GetEqualFoldRawAttributeValue(a.cfg.IDAttribute); len(raw) > 0 {
+			if utf8.Valid(raw) && !strings.ContainsRune(string(raw), 0) {
+				return string(raw)
+			}
+			return hex.EncodeToString(raw)
+		}
+	}
+	return normalizeDN(entry.DN)
+}
+
+// normalizeDN makes DNs comparable regardless of spacing and case
+func normalizeDN(dn string) string {
+	parsed, err := ldap.ParseDN(dn)
+	if err != nil {
+		return strings.ToLower(strings.TrimSpace(dn))
+	}
+	return strings.ToLower(parsed.String())
+}
@@ -0,0 +1,157 @@
+package services_test
+
+import (
+	"context"
+	"crypto/tls"
+	"testing"
+
+	"github.com/sirupsen/logrus"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/orca-ng/orca/internal/config"
+	gormmodels "github.com/orca-ng/orca/internal/models/gorm"
+	"github.com/orca-ng/orca/internal/services"
+	"github.com/orca-ng/orca/internal/services/ldaptest"
+)
+
+const (
+	testServiceDN = "cn=orca,ou=services,dc=example,dc=com"
+	testUserDN    = "uid=jdoe,ou=people,dc=example,dc=com"
+)
+
+func testDirectory() []ldaptest.Entry {
+	return []ldaptest.Entry{
+		{DN: testServiceDN, Password: "service-secret"},
+		{
+			DN:       testUserDN,
+			Password: "user-secret",
+			Attributes: map[string][]string{
+				"objectClass": {"person"},
+				"uid":         {"jdoe"},
+				"mail":        {"jdoe@example.com"},
+				"entryUUID":   {"5f0c2a56-3b1e-4c36-9d8f-000000000001"},
+				"memberOf":    {"CN=ORCA Admins,OU=Groups,DC=example,DC=com"},
+			},
+		},
+		{
+			DN:         "cn=ops,ou=groups,dc=example,dc=com",
+			Attributes: map[string][]string{"objectClass": {"groupOfNames"}, "member": {testUserDN}},
+		},
+	}
+}
+
+func testLDAPConfig(url string) config.LDAPConfig {
+	return config.LDAPConfig{
+		Enabled:           true,
+		URL:               url,
+		BindDN:            testServiceDN,
+		BindPassword:      "service-secret",
+		BaseDN:            "ou=people,dc=example,dc=com",
+		UserFilter:        "(&(objectClass=person)(uid={username}))",
+		UsernameAttribute: "uid",
+		EmailAttribute:    "mail",
+		IDAttribute:       "entryUUID",
+		GroupAttribute:    "memberOf",
+		GroupBaseDN:       "ou=groups,dc=example,dc=com",
+		GroupFilter:       "(member={dn})",
+		AdminGroups:       []string{"cn=orca admins, ou=groups, dc=example, dc=com"},
+		GroupRoles:        []config.GroupRoleMapping{{Group: "CN=Ops,OU=Groups,DC=example,DC=com", Roles: []string{"operator"}}},
+		Timeout:           5,
+	}
+}
+
+func TestLDAPAuthenticate(t *testing.T) {
+	ca := newTestCA(t, "Directory CA")
+	cm, _ := setupTrustDB(t, ca)
+	cert := ca.serverCertificate(t, "ldap")
+
+	tests := []struct {
+		name     string
+		opts     ldaptest.Options
+		startTLS bool
+	}{
+		{"StartTLS", ldaptest.Options{Certificate: &cert}, true},
+		{"LDAPS", ldaptest.Options{Certificate: &cert, LDAPS: true}, false},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			server, err := ldaptest.NewServer(tt.opts, testDirectory()...)
+			require.NoError(t, err)
+			defer server.Close()
+
+			cfg := testLDAPConfig(server.URL)
+			cfg.StartTLS = tt.startTLS
+			authenticator := services.NewLDAPAuthenticator(cfg, cm, logrus.New())
+
+			identity, err := authenticator.Authenticate(context.Background(), "jdoe", "user-secret")
+			require.NoError(t, err)
+			assert.Equal(t, gormmodels.AuthProviderLDAP, identity.Provider)
+			assert.Equal(t, "5f0c2a56-3b1e-4c36-9d8f-000000000001", identity.Subject)
+			assert.Equal(t, "jdoe", identity.Username)
+			assert.Equal(t, "jdoe@example.com", identity.Email)
+			assert.ElementsMatch(t, []string{
+				"cn=orca admins,ou=groups,dc=example,dc=com",
+				"cn=ops,ou=groups,dc=example,dc=com",
+			}, identity.Groups)
+			assert.Equal(t, []string{testServiceDN, testUserDN}, server.Binds())
+
+			mapping := authenticator.GroupMapping()
+			assert.Equal(t, []string{"cn=orca admins,ou=groups,dc=example,dc=com"}, mapping.AdminGroups)
+			assert.Equal(t, []string{"operator"}, mapping.GroupRoles["cn=ops,ou=groups,dc=example,dc=com"])
+		})
+	}
+}
+
+func TestLDAPAuthenticateRefused(t *testing.T) {
+	server, err := ldaptest.NewServer(ldaptest.Options{}, testDirectory()...)
+	require.NoError(t, err)
+	defer server.Close()
+	cm, _ := setupTrustDB(t)
+	authenticator := services.NewLDAPAuthenticator(testLDAPConfig(server.URL), cm, logrus.New())
+
+	tests := []struct {
+		name     string
+		username string
+		password string
+	}{
+		{"wrong password", "jdoe", "wrong"},
+		{"empty password", "jdoe", ""},
+		{"unknown user", "nobody", "user-secret"},
+		{"filter injection", "*", "user-secret"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			_, err := authenticator.Authenticate(context.Background(), tt.username, tt.password)
+			assert.ErrorIs(t, err, services.ErrInvalidCredentials)
+		})
+	}
+	// Only the service account got in
+	for _, dn := range server.Binds() {
+		assert.Equal(t, testServiceDN, dn)
+	}
+
+	// A directory that cannot be used is not a refused login
+	cfg := testLDAPConfig(server.URL)
+	cfg.BindPassword = "wrong"
+	_, err = services.NewLDAPAuthenticator(cfg, cm, logrus.New()).Authenticate(context.Background(), "jdoe", "user-secret")
+	require.Error(t, err)
+	assert.NotErrorIs(t, err, services.ErrInvalidCredentials)
+}
+
+func TestLDAPUntrustedCertificate(t *testing.T) {
+	ca := newTestCA(t, "Directory CA")
+	cert := ca.serverCertificate(t, "ldap")
+	server, err := ldaptest.NewServer(ldaptest.Options{Certificate: &cert, LDAPS: true}, testDirectory()...)
+	require.NoError(t, err)
+	defer server.Close()
+
+	// The CA is not managed in ORCA
+	cm, _ := setupTrustDB(t, newTestCA(t, "Other CA"))
+	_, err = services.NewLDAPAuthenticator(testLDAPConfig(server.URL), cm, logrus.New()).
+		Authenticate(context.Background(), "jdoe", "user-secret")
+	require.Error(t, err)
+	assert.NotErrorIs(t, err, services.ErrInvalidCredentials)
+	var certErr *tls.CertificateVerificationError
+	assert.ErrorAs(t, err, &certErr)
+}
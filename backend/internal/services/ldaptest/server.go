@@ -0,0 +1,441 @@
+// Package ldaptest provides an in-process LDAP server for tests, in the
+// spirit of net/http/httptest. It supports simple binds, searches with the
+// common filters, StartTLS and LDAPS, which is what ORCA's directory login
+// uses.
+package ldaptest
+
+import (
+	"crypto/tls"
+	"errors"
+	"fmt"
+	"net"
+	"strings"
+	"sync"
+
+	ber "github.com/go-asn1-ber/asn1-ber"
+	"github.com/go-ldap/ldap/v3"
+)
+
+const startTLSOID = "1.3.6.1.4.1.1466.20037"
+
+// Entry is a directory entry
+type Entry struct {
+	DN         string
+	Password   string // for simple binds, binding as the entry fails when empty
+	Attributes map[string][]string
+}
+
+// Options configure a Server
+type Options struct {
+	// Certificate is offered through StartTLS, or from the start with LDAPS
+	Certificate *tls.Certificate
+	LDAPS       bool
+	// AllowAnonymous lets connections search without binding
+	AllowAnonymous bool
+}
+
+// Server is an LDAP server listening on a loopback address
+type Server struct {
+	// URL is ldap://127.0.0.1:port, or ldaps:// with LDAPS
+	URL string
+
+	opts     Options
+	listener net.Listener
+	wg       sync.WaitGroup
+
+	mu      sync.Mutex
+	entries []Entry
+	conns   map[net.Conn]struct{}
+	binds   []string
+	closed  bool
+}
+
+// NewServer starts a server holding the entries
+func NewServer(opts Options, entries ...Entry) (*Server, error) {
+	listener, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		return nil, err
+	}
+	scheme := "ldap"
+	if opts.LDAPS {
+		if opts.Certificate == nil {
+			listener.Close()
+			return nil, errors.New("LDAPS needs a certificate")
+		}
+		listener = tls.NewListener(listener, &tls.Config{Certificates: []tls.Certificate{*opts.Certificate}})
+		scheme = "ldaps"
+	}
+
+	s := &Server{
+		URL:      fmt.Sprintf("%s://%s", scheme, listener.Addr()),
+		opts:     opts,
+		listener: listener,
+		entries:  entries,
+		conns:    make(map[net.Conn]struct{}),
+	}
+	s.wg.Add(1)
+	go s.serve()
+	return s, nil
+}
+
+// AddEntry adds an entry to the directory
+func (s *Server) AddEntry(entry Entry) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.entries = append(s.entries, entry)
+}
+
+// Binds returns the DNs of successful simple binds with a password, in order
+func (s *Server) Binds() []string {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return append([]string(nil), s.binds...)
+}
+
+// Close stops the server and closes open connections
+func (s *Server) Close() {
+	s.mu.Lock()
+	s.closed = true
+	for conn := range s.conns {
+		conn.Close()
+	}
+	s.mu.Unlock()
+	s.listener.Close()
+	s.wg.Wait()
+}
+
+func (s *Server) serve() {
+	defer s.wg.Done()
+	for {
+		conn, err := s.listener.Accept()
+		if err != nil {
+			return
+		}
+		s.mu.Lock()
+		if s.closed {
+			s.mu.Unlock()
+			conn.Close()
+			return
+		}
+		s.conns[conn] = struct{}{}
+		s.mu.Unlock()
+
+		s.wg.Add(1)
+		go func() {
+			defer s.wg.Done()
+			s.handle(conn)
+		}()
+	}
+}
+
+// session is the state of one client connection
+type session struct {
+	conn  net.Conn
+	bound bool // bound with a password
+}
+
+func (s *Server) handle(conn net.Conn) {
+	sess := &session{conn: conn}
+	defer func() {
+		s.mu.Lock()
+		delete(s.conns, sess.conn)
+		s.mu.Unlock()
+		sess.conn.Close()
+	}()
+
+	for {
+		packet, err := ber.ReadPacket(sess.conn)
+		if err != nil {
+			return
+		}
+		if len(packet.Children) < 2 {
+			return
+		}
+		messageID, ok := packet.Children[0].Value.(int64)
+		if !ok {
+			return
+		}
+		request := packet.Children[1]
+
+		switch request.Tag {
+		case ldap.ApplicationBindRequest:
+			s.bind(sess, messageID, request)
+		case ldap.ApplicationSearchRequest:
+			s.search(sess, messageID, request)
+		case ldap.ApplicationExtendedRequest:
+			if !s.extended(sess, messageID, request) {
+				return
+			}
+		case ldap.ApplicationUnbindRequest:
+			return
+		default:
+			// Other operations are not needed by the tests
+			return
+		}
+	}
+}
+
+func (s *Server) bind(sess *session, messageID int64, request *ber.Packet) {
+	if len(request.Children) < 3 || request.Children[2].Tag != 0 {
+		s.respond(sess, messageID, ldap.ApplicationBindResponse, ldap.LDAPResultAuthMethodNotSupported, "only simple binds are supported")
+		return
+	}
+	dn, _ := request.Children[1].Value.(string)
+	password := request.Children[2].Data.String()
+
+	sess.bound = false
+	if password == "" {
+		// Anonymous, or an unauthenticated bind, which succeeds without
+		// checking anything (RFC 4513 section 5.1.2)
+		s.respond(sess, messageID, ldap.ApplicationBindResponse, ldap.LDAPResultSuccess, "")
+		return
+	}
+
+	entry := s.find(dn)
+	if entry == nil || entry.Password == "" || entry.Password != password {
+		s.respond(sess, messageID, ldap.ApplicationBindResponse, ldap.LDAPResultInvalidCredentials, "invalid credentials")
+		return
+	}
+	sess.bound = true
+	s.mu.Lock()
+	s.binds = append(s.binds, entry.DN)
+	s.mu.Unlock()
+	s.respond(sess, messageID, ldap.ApplicationBindResponse, ldap.LDAPResultSuccess, "")
+}
+
+func (s *Server) search(sess *session, messageID int64, request *ber.Packet) {
+	if !sess.bound && !s.opts.AllowAnonymous {
+		s.respond(sess, messageID, ldap.ApplicationSearchResultDone, ldap.LDAPResultInsufficientAccessRights, "bind required")
+		return
+	}
+	if len(request.Children) < 8 {
+		s.respond(sess, messageID, ldap.ApplicationSearchResultDone, ldap.LDAPResultProtocolError, "malformed search")
+		return
+	}
+	baseDN, _ := request.Children[0].Value.(string)
+	scope, _ := request.Children[1].Value.(int64)
+	filter := request.Children[6]
+	var attributes []string
+	for _, child := range request.Children[7].Children {
+		if name, ok := child.Value.(string); ok {
+			attributes = append(attributes, name)
+		}
+	}
+
+	base, err := ldap.ParseDN(baseDN)
+	if err != nil {
+		s.respond(sess, messageID, ldap.ApplicationSearchResultDone, ldap.LDAPResultInvalidDNSyntax, err.Error())
+		return
+	}
+
+	s.mu.Lock()
+	entries := append([]Entry(nil), s.entries...)
+	s.mu.Unlock()
+
+	for _, entry := range entries {
+		dn, err := ldap.ParseDN(entry.DN)
+		if err != nil || !inScope(base, dn, scope) {
+			continue
+		}
+		matched, err := matches(filter, entry)
+		if err != nil {
+			s.respond(sess, messageID, ldap.ApplicationSearchResultDone, ldap.LDAPResultProtocolError, err.Error())
+			return
+		}
+		if matched {
+			s.write(sess, envelope(messageID, searchEntry(entry, attributes)))
+		}
+	}
+	s.respond(sess, messageID, ldap.ApplicationSearchResultDone, ldap.LDAPResultSuccess, "")
+}
+
+// extended handles StartTLS and reports whether the connection stays open
+func (s *Server) extended(sess *session, messageID int64, request *ber.Packet) bool {
+	var oid string
+	if len(request.Children) > 0 {
+		oid = request.Children[0].Data.String()
+	}
+	if oid != startTLSOID || s.opts.Certificate == nil || s.opts.LDAPS {
+		s.respond(sess, messageID, ldap.ApplicationExtendedResponse, ldap.LDAPResultProtocolError, "unsupported extended operation")
+		return true
+	}
+
+	s.respond(sess, messageID, ldap.ApplicationExtendedResponse, ldap.LDAPResultSuccess, "")
+	tlsConn := tls.Server(sess.conn, &tls.Config{Certificates: []tls.Certificate{*s.opts.Certificate}})
+	if err := tlsConn.Handshake(); err != nil {
+		return false
+	}
+	s.mu.Lock()
+	delete(s.conns, sess.conn)
+	s.conns[tlsConn] = struct{}{}
+	s.mu.Unlock()
+	sess.conn = tlsConn
+	return true
+}
+
+func (s *Server) find(dn string) *Entry {
+	want, err := ldap.ParseDN(dn)
+	if err != nil {
+		return nil
+	}
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	for i := range s.entries {
+		if have, err := ldap.ParseDN(s.entries[i].DN); err == nil && have.EqualFold(want) {
+			entry := s.entries[i]
+			return &entry
+		}
+	}
+	return nil
+}
+
+func (s *Server) respond(sess *session, messageID int64, tag ber.Tag, resultCode uint16, message string) {
+	response := ber.Encode(ber.ClassApplication, ber.TypeConstructed, tag, nil, "Response")
+	response.AppendChild(ber.NewInteger(ber.ClassUniversal, ber.TypePrimitive, ber.TagEnumerated, int64(resultCode), "Result Code"))
+	response.AppendChild(ber.NewString(ber.ClassUniversal, ber.TypePrimitive, ber.TagOctetString, "", "Matched DN"))
+	response.AppendChild(ber.NewString(ber.ClassUniversal, ber.TypePrimitive, ber.TagOctetString, message, "Diagnostic Message"))
+	s.write(sess, envelope(messageID, response))
+}
+
+func (s *Server) write(sess *session, packet *ber.Packet) {
+	sess.conn.Write(packet.Bytes())
+}
+
+func envelope(messageID int64, op *ber.Packet) *ber.Packet {
+	packet := ber.Encode(ber.ClassUniversal, ber.TypeConstructed, ber.TagSequence, nil, "LDAP Response")
+	packet.AppendChild(ber.NewInteger(ber.ClassUniversal, ber.TypePrimitive, ber.TagInteger, messageID, "Message ID"))
+	packet.AppendChild(op)
+	return packet
+}
+
+func searchEntry(entry Entry, attributes []string) *ber.Packet {
+	result := ber.Encode(ber.ClassApplication, ber.TypeConstructed, ldap.ApplicationSearchResultEntry, nil, "Search Result Entry")
+	result.AppendChild(ber.NewString(ber.ClassUniversal, ber.TypePrimitive, ber.TagOctetString, entry.DN, "DN"))
+	list := ber.Encode(ber.ClassUniversal, ber.TypeConstructed, ber.TagSequence, nil, "Attributes")
+	for name, values := range entry.Attributes {
+		if !requested(attributes, name) {
+			continue
+		}
+		attribute := ber.Encode(ber.ClassUniversal, ber.TypeConstructed, ber.TagSequence, nil, "Attribute")
+		attribute.AppendChild(ber.NewString(ber.ClassUniversal, ber.TypePrimitive, ber.TagOctetString, name, "Type"))
+		set := ber.Encode(ber.ClassUniversal, ber.TypeConstructed, ber.TagSet, nil, "Values")
+		for _, value := range values {
+			set.AppendChild(ber.NewString(ber.ClassUniversal, ber.TypePrimitive, ber.TagOctetString, value, "Value"))
+		}
+		attribute.AppendChild(set)
+		list.AppendChild(attribute)
+	}
+	result.AppendChild(list)
+	return result
+}
+
+func requested(attributes []string, name string) bool {
+	if len(attributes) == 0 {
+		return true
+	}
+	for _, attribute := range attributes {
+		if attribute == "*" || strings.EqualFold(attribute, name) {
+			return true
+		}
+	}
+	return false
+}
+
+func inScope(base, dn *ldap.DN, scope int64) bool {
+	switch scope {
+	case ldap.ScopeBaseObject:
+		return base.EqualFold(dn)
+	case ldap.ScopeSingleLevel:
+		return base.AncestorOfFold(dn) && len(dn.RDNs) == len(base.RDNs)+1
+	default:
+		return base.EqualFold(dn) || base.AncestorOfFold(dn)
+	}
+}
+
+// matches evaluates and, or, not, equality, substring and presence filters.
+// Values compare case-insensitively, as with most directory schemas.
+func matches(filter *ber.Packet, entry Entry) (bool, error) {
+	switch filter.Tag {
+	case ldap.FilterAnd:
+		for _, child := range filter.Children {
+			matched, err := matches(child, entry)
+			if err != nil || !matched {
+				return false, err
+			}
+		}
+		return true, nil
+	case ldap.FilterOr:
+		for _, child := range filter.Children {
+			matched, err := matches(child, entry)
+			if err != nil || matched {
+				return matched, err
+			}
+		}
+		return false, nil
+	case ldap.FilterNot:
+		if len(filter.Children) != 1 {
+			return false, errors.New("malformed not filter")
+		}
+		matched, err := matches(filter.Children[0], entry)
+		return !matched, err
+	case ldap.FilterEqualityMatch:
+		if len(filter.Children) != 2 {
+			return false, errors.New("malformed equality filter")
+		}
+		name, _ := filter.Children[0].Value.(string)
+		value, _ := filter.Children[1].Value.(string)
+		for _, v := range attributeValues(entry, name) {
+			if strings.EqualFold(v, value) {
+				return true, nil
+			}
+		}
+		return false, nil
+	case ldap.FilterPresent:
+		return len(attributeValues(entry, filter.Data.String())) > 0, nil
+	case ldap.FilterSubstrings:
+		if len(filter.Children) != 2 {
+			return false, errors.New("malformed substrings filter")
+		}
+		name, _ := filter.Children[0].Value.(string)
+		for _, v := range attributeValues(entry, name) {
+			if substringMatch(strings.ToLower(v), filter.Children[1].Children) {
+				return true, nil
+			}
+		}
+		return false, nil
+	}
+	return false, fmt.Errorf("unsupported filter %d", filter.Tag)
+}
+
+func substringMatch(value string, parts []*ber.Packet) bool {
+	for _, part := range parts {
+		sub := strings.ToLower(part.Data.String())
+		switch part.Tag {
+		case ldap.FilterSubstringsInitial:
+			if !strings.HasPrefix(value, sub) {
+				return false
+			}
+			value = value[len(sub):]
+		case ldap.FilterSubstringsAny:
+			i := strings.Index(value, sub)
+			if i < 0 {
+				return false
+			}
+			value = value[i+len(sub):]
+		case ldap.FilterSubstringsFinal:
+			if !strings.HasSuffix(value, sub) {
+				return false
+			}
+		}
+	}
+	return true
+}
+
+func attributeValues(entry Entry, name string) []string {
+	for attribute, values := range entry.Attributes {
+		if strings.EqualFold(attribute, name) {
+			return values
+		}
+	}
+	return nil
+}
@@ -0,0 +1,149 @@
+package services
+
+import (
+	"context"
+	"fmt"
+	"os"
+	"sync/atomic"
+	"time"
+
+	"github.com/sirupsen/logrus"
+	"gorm.io/gorm/clause"
+
+	"github.com/orca-ng/orca/internal/database"
+	gormmodels "github.com/orca-ng/orca/internal/models/gorm"
+	"github.com/orca-ng/orca/pkg/ulid"
+)
+
+// NewReplicaID returns an identifier for this ORCA process, unique even when
+// several replicas run on the same host
+func NewReplicaID() string {
+	hostname, err := os.Hostname()
+	if err != nil || hostname == "" {
+		hostname = "orca"
+	}
+	if len(hostname) > 50 {
+		hostname = hostname[:50]
+	}
+	return fmt.Sprintf("%s-%d-%s", hostname, os.Getpid(), ulid.New(ulid.ReplicaPrefix))
+}
+
+// LeaderElector elects a single replica to run background tasks that must not
+// run more than once across a deployment, such as session cleanup. Election
+// uses a row in leader_leases, so it works on every supported database.
+type LeaderElector struct {
+	db       *database.GormDB
+	logger   *logrus.Logger
+	name     string
+	holderID string
+	ttl      time.Duration
+	leader   atomic.Bool
+}
+
+// NewLeaderElector creates a leader elector for the named lease
+func NewLeaderElector(db *database.GormDB, logger *logrus.Logger, name, holderID string, ttl time.Duration) *LeaderElector {
+	if ttl <= 0 {
+		ttl = 30 * time.Second
+	}
+
+	return &LeaderElector{
+		db:       db,
+		logger:   logger,
+		name:     name,
+		holderID: holderID,
+		ttl:      ttl,
+	}
+}
+
+// IsLeader reports whether this replica currently holds the lease
+func (e *LeaderElector) IsLeader() bool {
+	return e.leader.Load()
+}
+
+// HolderID returns the ID this replica uses in the lease
+func (e *LeaderElector) HolderID() string {
+	return e.holderID
+}
+
+// Run campaigns for and renews the lease until ctx is cancelled, then
+// releases it so another replica can take over without waiting for expiry
+func (e *LeaderElector) Run(ctx context.Context) {
+	ticker := time.NewTicker(e.ttl / 3)
+	defer ticker.Stop()
+
+	e.campaign()
+
+	for {
+		select {
+		case <-ctx.Done():
+			e.release()
+			return
+		case <-ticker.C:
+			e.campaign()
+		}
+	}
+}
+
+// campaign tries to acquire or renew the lease
+func (e *LeaderElector) campaign() {
+	acquired, err := e.tryAcquire()
+	if err != nil {
+		// Step down: another replica may take over once our lease lapses,
+		// and we must not keep running singleton tasks in the meantime
+		e.logger.WithError(err).Warn("Leader election failed")
+		acquired = false
+	}
+
+	if was := e.leader.Swap(acquired); was != acquired {
+		e.logger.WithFields(logrus.Fields{
+			"lease":     e.name,
+			"holder_id": e.holderID,
+			"leader":    acquired,
+		}).Info("Leadership changed")
+	}
+}
+
+// tryAcquire takes the lease if it is free, expired or already ours
+func (e *LeaderElector) tryAcquire() (bool, error) {
+	now := time.Now()
+
+	// Make sure the lease row exists; an expired placeholder can then be
+	// claimed through the conditional update below
+	placeholder := &gormmodels.LeaderLease{
+		Name:      e.name,
+		HolderID:  e.holderID,
+		ExpiresAt: now.Add(-time.Second),
+	}
+	if err := e.db.Clauses(clause.OnConflict{DoNothing: true}).Create(placeholder).Error; err != nil {
+		return false, fmt.Errorf("create leader lease: %w", err)
+	}
+
+	res := e.db.Model(&gormmodels.LeaderLease{}).
+		Where("name = ? AND (holder_id = ? OR expires_at < ?)", e.name, e.holderID, now).
+		Updates(map[string]interface{}{
+			"holder_id":  e.holderID,
+			"expires_at": now.Add(e.ttl),
+		})
+	if res.Error != nil {
+		return false, fmt.Errorf("renew leader lease: %w", res.Error)
+	}
+
+	return res.RowsAffected == 1, nil
+}
+
+// release gives up the lease if this replica holds it
+func (e *LeaderElector) release() {
+	if !e.leader.Swap(false) {
+		return
+	}
+
+	err := e.db.Model(&gormmodels.LeaderLease{}).
+		Where("name = ? AND holder_id = ?", e.name, e.holderID).
+		Update("expires_at", time.Now().Add(-time.Second)).Error
+	if err != nil {
+		e.logger.WithError(err).Warn("Failed to release leader lease")
+		return
+	}
+
+	e.logger.WithField("lease", e.name).Info("Released leadership")
+}
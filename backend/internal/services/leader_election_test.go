@@ -0,0 +1,161 @@
+package services_test
+
+import (
+	"context"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/sirupsen/logrus"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"gorm.io/driver/sqlite"
+	"gorm.io/gorm"
+
+	"github.com/orca-ng/orca/internal/database"
+	gormmodels "github.com/orca-ng/orca/internal/models/gorm"
+	"github.com/orca-ng/orca/internal/services"
+)
+
+// setupClusterDB creates a file-backed SQLite database so that several
+// connections, standing in for replicas, see the same data
+func setupClusterDB(t *testing.T) *database.GormDB {
+	db, err := gorm.Open(sqlite.Open(filepath.Join(t.TempDir(), "cluster.db")+"?_busy_timeout=5000"), &gorm.Config{})
+	require.NoError(t, err)
+
+	err = db.AutoMigrate(&gormmodels.LeaderLease{}, &gormmodels.ClusterEvent{}, &gormmodels.Operation{})
+	require.NoError(t, err)
+
+	return &database.GormDB{DB: db}
+}
+
+func TestLeaderElectionSingleLeader(t *testing.T) {
+	db := setupClusterDB(t)
+	logger := logrus.New()
+
+	ctxA, cancelA := context.WithCancel(context.Background())
+	ctxB, cancelB := context.WithCancel(context.Background())
+	defer cancelB()
+
+	a := services.NewLeaderElector(db, logger, "test", "replica-a", 300*time.Millisecond)
+	b := services.NewLeaderElector(db, logger, "test", "replica-b", 300*time.Millisecond)
+
+	doneA := make(chan struct{})
+	go func() {
+		a.Run(ctxA)
+		close(doneA)
+	}()
+	require.Eventually(t, a.IsLeader, 2*time.Second, 10*time.Millisecond)
+
+	go b.Run(ctxB)
+
+	// B must not take over while A keeps renewing
+	time.Sleep(500 * time.Millisecond)
+	assert.True(t, a.IsLeader())
+	assert.False(t, b.IsLeader())
+
+	// Once A steps down, B takes over
+	cancelA()
+	<-doneA
+	assert.False(t, a.IsLeader())
+	require.Eventually(t, b.IsLeader, 2*time.Second, 10*time.Millisecond)
+}
+
+func TestEventFanOutPolling(t *testing.T) {
+	db := setupClusterDB(t)
+	logger := logrus.New()
+
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	op := &gormmodels.Operation{
+		Type:     gormmodels.OpTypeUserSync,
+		Priority: gormmodels.OpPriorityNormal,
+		Status:   gormmodels.OpStatusCompleted,
+		Payload:  []byte(`{}`),
+	}
+	require.NoError(t, db.Create(op).Error)
+
+	replicaA := services.NewOperationEventService(logger)
+	replicaA.EnableFanOut(ctx, db, services.NewPollingEventBroker(db, logger), "replica-a")
+
+	replicaB := services.NewOperationEventService(logger)
+	replicaB.EnableFanOut(ctx, db, services.NewPollingEventBroker(db, logger), "replica-b")
+
+	eventsA := replicaA.Subscribe(ctx, "client-a")
+	eventsB := replicaB.Subscribe(ctx, "client-b")
+
+	// Let both listeners record their starting position
+	time.Sleep(200 * time.Millisecond)
+
+	replicaA.PublishOperationUpdated(op)
+
+	select {
+	case event := <-eventsA:
+		assert.Equal(t, "completed", event.Type)
+	case <-time.After(time.Second):
+		t.Fatal("local subscriber did not receive event")
+	}
+
+	select {
+	case event := <-eventsB:
+		assert.Equal(t, "completed", event.Type)
+		require.NotNil(t, event.Operation)
+		assert.Equal(t, op.ID, event.Operation.ID)
+	case <-time.After(5 * time.Second):
+		t.Fatal("remote subscriber did not receive event")
+	}
+
+	// Replica A must not receive its own event a second time
+	select {
+	case event := <-eventsA:
+		t.Fatalf("unexpected duplicate event %q", event.Type)
+	case <-time.After(1500 * time.Millisecond):
+	}
+}
+
+func TestPollingBrokerDeliversLateCommits(t *testing.T) {
+	db := setupClusterDB(t)
+	logger := logrus.New()
+
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	// An event from before the listener started is not delivered
+	require.NoError(t, db.Create(&gormmodels.ClusterEvent{ID: 10, Origin: "replica-a", Type: "old"}).Error)
+
+	notices := make(chan *services.EventNotice, 10)
+	broker := services.NewPollingEventBroker(db, logger)
+	go broker.Listen(ctx, func(notice *services.EventNotice) { notices <- notice })
+	time.Sleep(200 * time.Millisecond)
+
+	receive := func() string {
+		select {
+		case notice := <-notices:
+			return notice.Type
+		case <-time.After(5 * time.Second):
+			t.Fatal("event was not delivered")
+			return ""
+		}
+	}
+
+	require.NoError(t, db.Create(&gormmodels.ClusterEvent{ID: 30, Origin: "replica-a", Type: "first"}).Error)
+	assert.Equal(t, "first", receive())
+
+	// A lower id committing after a higher one, as a slow transaction on
+	// MySQL or SQL Server does
+	require.NoError(t, db.Create(&gormmodels.ClusterEvent{
+		ID:        20,
+		Origin:    "replica-b",
+		Type:      "late",
+		CreatedAt: time.Now().Add(-2 * time.Second),
+	}).Error)
+	assert.Equal(t, "late", receive())
+
+	// Nothing is delivered twice
+	select {
+	case notice := <-notices:
+		t.Fatalf("unexpected duplicate event %q", notice.Type)
+	case <-time.After(1500 * time.Millisecond):
+	}
+}
@@ -0,0 +1,232 @@
+package services
+
+import (
+	"context"
+	"fmt"
+	"strings"
+	"time"
+
+	"github.com/sirupsen/logrus"
+	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
+
+	"github.com/orca-ng/orca/internal/config"
+	"github.com/orca-ng/orca/internal/database"
+	gormmodels "github.com/orca-ng/orca/internal/models/gorm"
+)
+
+// LoginBlock tells why a login attempt is refused, and until when
+type LoginBlock struct {
+	Locked bool // locked out, rather than waiting out the delay after a failure
+	Until  time.Time
+}
+
+// LoginLimiter slows down repeated failed logins of a username or from a
+// client IP and locks them out once the failures reach a threshold. The
+// counts are kept in the database so that they hold across replicas.
+type LoginLimiter struct {
+	db     *database.GormDB
+	cfg    config.LockoutConfig
+	logger *logrus.Logger
+}
+
+// NewLoginLimiter creates a new login limiter
+func NewLoginLimiter(db *database.GormDB, cfg config.LockoutConfig, logger *logrus.Logger) *LoginLimiter {
+	return &LoginLimiter{
+		db:     db,
+		cfg:    cfg,
+		logger: logger,
+	}
+}
+
+// NormalizeUsername returns the subject a username is throttled under
+func NormalizeUsername(username string) string {
+	return strings.ToLower(strings.TrimSpace(username))
+}
+
+// Check returns why a login attempt must be refused, or nil if it may go
+// ahead. ip may be empty.
+func (l *LoginLimiter) Check(ctx context.Context, username, ip string) (*LoginBlock, error) {
+	now := time.Now().UTC()
+	query := l.db.WithContext(ctx).Where("kind = ? AND subject = ?", gormmodels.ThrottleKindUsername, NormalizeUsername(username))
+	if ip != "" {
+		query = query.Or("kind = ? AND subject = ?", gormmodels.ThrottleKindIP, ip)
+	}
+	var throttles []gormmodels.LoginThrottle
+	if err := query.Find(&throttles).Error; err != nil {
+		return nil, fmt.Errorf("check login throttles: %w", err)
+	}
+
+	var block *LoginBlock
+	for _, throttle := range throttles {
+		current := LoginBlock{}
+		switch {
+		case throttle.Locked(now):
+			current = LoginBlock{Locked: true, Until: *throttle.LockedUntil}
+		case throttle.RetryAt != nil && now.Before(*throttle.RetryAt):
+			current = LoginBlock{Until: *throttle.RetryAt}
+		default:
+			continue
+		}
+		if block == nil || current.Locked && !block.Locked || current.Locked == block.Locked && current.Until.After(block.Until) {
+			block = &current
+		}
+	}
+	return block, nil
+}
+
+// Failure records a failed login and returns the throttles it locked out
+func (l *LoginLimiter) Failure(ctx context.Context, username, ip string) ([]gormmodels.LoginThrottle, error) {
+	var locked []gormmodels.LoginThrottle
+	// A client IP is only slowed down once it has failed more often than a
+	// single username may, so that one mistyped password does not hold up
+	// everyone behind the same address
+	subjects := []struct {
+		kind, subject string
+		threshold     int
+		free          int // failures before delays start
+	}{
+		{gormmodels.ThrottleKindUsername, NormalizeUsername(username), l.cfg.UsernameThreshold, 0},
+		{gormmodels.ThrottleKindIP, ip, l.cfg.IPThreshold, l.cfg.UsernameThreshold},
+	}
+	for _, s := range subjects {
+		if s.subject == "" {
+			continue
+		}
+		throttle, lockedNow, err := l.fail(ctx, s.kind, s.subject, s.threshold, s.free)
+		if err != nil {
+			return locked, err
+		}
+		if lockedNow {
+			l.logger.WithFields(logrus.Fields{
+				"kind":         s.kind,
+				"subject":      s.subject,
+				"failures":     throttle.Failures,
+				"locked_until": throttle.LockedUntil,
+			}).Warn("Login locked out after repeated failures")
+			locked = append(locked, *throttle)
+		}
+	}
+	return locked, nil
+}
+
+// fail counts a failure against one throttle and reports whether this
+// failure locked it out
+func (l *LoginLimiter) fail(ctx context.Context, kind, subject string, threshold, free int) (*gormmodels.LoginThrottle, bool, error) {
+	now := time.Now().UTC()
+	db := l.db.WithContext(ctx)
+
+	// Make sure the row exists, then count through updates so that
+	// concurrent failures on other replicas are not lost
+	placeholder := &gormmodels.LoginThrottle{Kind: kind, Subject: subject, LastFailureAt: now}
+	if err := db.Clauses(clause.OnConflict{DoNothing: true}).Create(placeholder).Error; err != nil {
+		return nil, false, fmt.Errorf("create login throttle: %w", err)
+	}
+
+	// Stale failures and lapsed lockouts start the count again
+	window := time.Duration(l.cfg.WindowMinutes) * time.Minute
+	if err := l.throttle(ctx, kind, subject).
+		Where("last_failure_at < ? OR locked_until <= ?", now.Add(-window), now).
+		Updates(map[string]interface{}{"failures": 0, "retry_at": nil, "locked_until": nil}).Error; err != nil {
+		return nil, false, fmt.Errorf("reset login throttle: %w", err)
+	}
+	if err := l.throttle(ctx, kind, subject).
+		Updates(map[string]interface{}{"failures": gorm.Expr("failures + 1"), "last_failure_at": now}).Error; err != nil {
+		return nil, false, fmt.Errorf("count login failure: %w", err)
+	}
+
+	var throttle gormmodels.LoginThrottle
+	if err := db.First(&throttle, "kind = ? AND subject = ?", kind, subject).Error; err != nil {
+		return nil, false, fmt.Errorf("load login throttle: %w", err)
+	}
+
+	updates := map[string]interface{}{"retry_at": nil}
+	lockedNow := false
+	if throttle.Failures >= threshold {
+		until := now.Add(time.Duration(l.cfg.LockoutMinutes) * time.Minute)
+		updates["locked_until"] = until
+		updates["retry_at"] = until
+		throttle.LockedUntil = &until
+		throttle.RetryAt = &until
+		// Failures while locked, such as second factors of a login that
+		// began earlier, extend the lockout without raising it again
+		lockedNow = throttle.Failures == threshold
+	} else if throttle.Failures > free {
+		retryAt := now.Add(l.delay(throttle.Failures - free))
+		updates["retry_at"] = retryAt
+		throttle.RetryAt = &retryAt
+	}
+	if err := l.throttle(ctx, kind, subject).Updates(updates).Error; err != nil {
+		return nil, false, fmt.Errorf("update login throttle: %w", err)
+	}
+	return &throttle, lockedNow, nil
+}
+
+// delay is the wait after the given number of consecutive failures, doubling
+// from a second up to the configured maximum
+func (l *LoginLimiter) delay(failures int) time.Duration {
+	maxDelay := time.Duration(l.cfg.MaxDelaySeconds) * time.Second
+	delay := time.Second
+	for i := 1; i < failures && delay < maxDelay; i++ {
+		delay *= 2
+	}
+	if delay > maxDelay {
+		delay = maxDelay
+	}
+	return delay
+}
+
+func (l *LoginLimiter) throttle(ctx context.Context, kind, subject string) *gorm.DB {
+	return l.db.WithContext(ctx).Model(&gormmodels.LoginThrottle{}).
+		Where("kind = ? AND subject = ?", kind, subject)
+}
+
+// Success forgets the failures of a username once its user has logged in.
+// Failures from the client IP still count, so that one valid account does
+// not lift the limit for guessing others.
+func (l *LoginLimiter) Success(ctx context.Context, username string) error {
+	err := l.db.WithContext(ctx).
+		Where("kind = ? AND subject = ?", gormmodels.ThrottleKindUsername, NormalizeUsername(username)).
+		Delete(&gormmodels.LoginThrottle{}).Error
+	if err != nil {
+		return fmt.Errorf("clear login throttle: %w", err)
+	}
+	return nil
+}
+
+// Lockouts returns the usernames and client IPs that are locked out
+func (l *LoginLimiter) Lockouts(ctx context.Context) ([]gormmodels.LoginThrottle, error) {
+	var throttles []gormmodels.LoginThrottle
+	if err := l.db.WithContext(ctx).
+		Where("locked_until > ?", time.Now().UTC()).
+		Order("locked_until DESC").
+		Find(&throttles).Error; err != nil {
+		return nil, fmt.Errorf("list lockouts: %w", err)
+	}
+	return throttles, nil
+}
+
+// Unlock lifts the lockout or delay of a username or client IP and forgets
+// its failures. It reports whether there was anything to lift.
+func (l *LoginLimiter) Unlock(ctx context.Context, kind, subject string) (bool, error) {
+	if kind == gormmodels.ThrottleKindUsername {
+		subject = NormalizeUsername(subject)
+	}
+	res := l.db.WithContext(ctx).
+		Where("kind = ? AND subject = ?", kind, subject).
+		Delete(&gormmodels.LoginThrottle{})
+	if res.Error != nil {
+		return false, fmt.Errorf("unlock %s %s: %w", kind, subject, res.Error)
+	}
+	return res.RowsAffected > 0, nil
+}
+
+// DeleteExpired deletes throttles whose failures are stale and that are not
+// locked out
+func (l *LoginLimiter) DeleteExpired(ctx context.Context) error {
+	now := time.Now().UTC()
+	window := time.Duration(l.cfg.WindowMinutes) * time.Minute
+	return l.db.WithContext(ctx).
+		Where("last_failure_at < ? AND (locked_until IS NULL OR locked_until < ?)", now.Add(-window), now).
+		Delete(&gormmodels.LoginThrottle{}).Error
+}
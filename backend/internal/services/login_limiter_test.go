@@ -0,0 +1,110 @@
+package services_test
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/sirupsen/logrus"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"gorm.io/driver/sqlite"
+	"gorm.io/gorm"
+
+	"github.com/orca-ng/orca/internal/config"
+	"github.com/orca-ng/orca/internal/database"
+	gormmodels "github.com/orca-ng/orca/internal/models/gorm"
+	"github.com/orca-ng/orca/internal/services"
+)
+
+func setupLoginLimiter(t *testing.T) (*services.LoginLimiter, *gorm.DB) {
+	t.Helper()
+	db, err := gorm.Open(sqlite.Open(":memory:"), &gorm.Config{})
+	require.NoError(t, err)
+	require.NoError(t, db.AutoMigrate(&gormmodels.LoginThrottle{}))
+	cfg := config.LockoutConfig{
+		Enabled:           true,
+		UsernameThreshold: 3,
+		IPThreshold:       5,
+		WindowMinutes:     15,
+		LockoutMinutes:    15,
+	}
+	return services.NewLoginLimiter(&database.GormDB{DB: db}, cfg, logrus.New()), db
+}
+
+func TestLoginLimiterIPLockout(t *testing.T) {
+	limiter, _ := setupLoginLimiter(t)
+	ctx := context.Background()
+
+	// Guessing across usernames still locks out the client
+	for i, username := range []string{"a", "b", "c", "d"} {
+		locked, err := limiter.Failure(ctx, username, "192.0.2.1")
+		require.NoError(t, err)
+		assert.Empty(t, locked, "failure %d", i+1)
+	}
+	locked, err := limiter.Failure(ctx, "e", "192.0.2.1")
+	require.NoError(t, err)
+	require.Len(t, locked, 1)
+	assert.Equal(t, gormmodels.ThrottleKindIP, locked[0].Kind)
+
+	block, err := limiter.Check(ctx, "f", "192.0.2.1")
+	require.NoError(t, err)
+	require.NotNil(t, block)
+	assert.True(t, block.Locked)
+	block, err = limiter.Check(ctx, "f", "192.0.2.2")
+	require.NoError(t, err)
+	assert.Nil(t, block)
+
+	lockouts, err := limiter.Lockouts(ctx)
+	require.NoError(t, err)
+	require.Len(t, lockouts, 1)
+	assert.Equal(t, "192.0.2.1", lockouts[0].Subject)
+
+	found, err := limiter.Unlock(ctx, gormmodels.ThrottleKindIP, "192.0.2.1")
+	require.NoError(t, err)
+	assert.True(t, found)
+	block, err = limiter.Check(ctx, "f", "192.0.2.1")
+	require.NoError(t, err)
+	assert.Nil(t, block)
+}
+
+func TestLoginLimiterWindow(t *testing.T) {
+	limiter, db := setupLoginLimiter(t)
+	ctx := context.Background()
+	failures := func() int {
+		var throttle gormmodels.LoginThrottle
+		require.NoError(t, db.First(&throttle, "kind = ? AND subject = ?", gormmodels.ThrottleKindUsername, "alice").Error)
+		return throttle.Failures
+	}
+
+	for i := 0; i < 2; i++ {
+		_, err := limiter.Failure(ctx, "Alice", "")
+		require.NoError(t, err)
+	}
+	assert.Equal(t, 2, failures())
+
+	// Failures outside the window are forgotten
+	require.NoError(t, db.Model(&gormmodels.LoginThrottle{}).
+		Where("subject = ?", "alice").
+		Update("last_failure_at", time.Now().UTC().Add(-time.Hour)).Error)
+	locked, err := limiter.Failure(ctx, "alice", "")
+	require.NoError(t, err)
+	assert.Empty(t, locked)
+	assert.Equal(t, 1, failures())
+
+	// A login clears the username, and stale rows are cleaned up
+	require.NoError(t, limiter.Success(ctx, "ALICE"))
+	var count int64
+	db.Model(&gormmodels.LoginThrottle{}).Count(&count)
+	assert.Zero(t, count)
+
+	require.NoError(t, db.Create(&gormmodels.LoginThrottle{
+		Kind:          gormmodels.ThrottleKindIP,
+		Subject:       "192.0.2.9",
+		Failures:      1,
+		LastFailureAt: time.Now().UTC().Add(-time.Hour),
+	}).Error)
+	require.NoError(t, limiter.DeleteExpired(ctx))
+	db.Model(&gormmodels.LoginThrottle{}).Count(&count)
+	assert.Zero(t, count)
+}
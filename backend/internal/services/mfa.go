@@ -0,0 +1,352 @@
+package services
+
+import (
+	"context"
+	"crypto/rand"
+	"encoding/base32"
+	"errors"
+	"fmt"
+	"strings"
+	"time"
+
+	"github.com/sirupsen/logrus"
+	"gorm.io/gorm"
+
+	"github.com/orca-ng/orca/internal/config"
+	"github.com/orca-ng/orca/internal/crypto"
+	"github.com/orca-ng/orca/internal/database"
+	gormmodels "github.com/orca-ng/orca/internal/models/gorm"
+	pkgcrypto "github.com/orca-ng/orca/pkg/crypto"
+	"github.com/orca-ng/orca/pkg/totp"
+)
+
+var (
+	// ErrInvalidMFACode is returned for a wrong, reused or expired code
+	ErrInvalidMFACode = errors.New("invalid MFA code")
+	// ErrMFANotEnrolled is returned when the user has no enabled second factor
+	ErrMFANotEnrolled = errors.New("MFA is not enrolled")
+	// ErrMFAAlreadyEnabled is returned when enrolling a user who already has MFA
+	ErrMFAAlreadyEnabled = errors.New("MFA is already enabled")
+)
+
+const (
+	// RecoveryCodeCount is how many recovery codes a user gets
+	RecoveryCodeCount = 10
+
+	recoveryCodeLength = 10
+	// totpSkew accepts codes one period either side, for clock drift
+	totpSkew = 1
+)
+
+// MFAStatus describes the second factor of a user
+type MFAStatus struct {
+	Enabled                bool `json:"enabled"`
+	Required               bool `json:"required"`
+	RecoveryCodesRemaining int  `json:"recovery_codes_remaining"`
+}
+
+// MFAEnrollment is what a user needs to add ORCA to an authenticator app
+type MFAEnrollment struct {
+	Secret string `json:"secret"`
+	URI    string `json:"otpauth_url"`
+}
+
+// MFAService manages TOTP enrolment and checks second factors. Secrets are
+// stored encrypted, recovery codes as Argon2 hashes.
+type MFAService struct {
+	db        *database.GormDB
+	encryptor *crypto.Encryptor
+	cfg       config.MFAConfig
+	logger    *logrus.Logger
+}
+
+// NewMFAService creates a new MFA service
+func NewMFAService(db *database.GormDB, encryptor *crypto.Encryptor, cfg config.MFAConfig, logger *logrus.Logger) *MFAService {
+	if cfg.Issuer == "" {
+		cfg.Issuer = "ORCA"
+	}
+	return &MFAService{
+		db:        db,
+		encryptor: encryptor,
+		cfg:       cfg,
+		logger:    logger,
+	}
+}
+
+// Required reports whether a user must log in with a second factor, because
+// it is required for everyone or by one of the user's roles
+func (s *MFAService) Required(ctx context.Context, userID string) (bool, error) {
+	if s.cfg.Required {
+		return true, nil
+	}
+	var count int64
+	err := s.db.WithContext(ctx).
+		Model(&gormmodels.RoleAssignment{}).
+		Joins("JOIN roles ON roles.id = role_assignments.role_id").
+		Where("role_assignments.user_id = ? AND roles.require_mfa = ?", userID, true).
+		Count(&count).Error
+	if err != nil {
+		return false, fmt.Errorf("failed to check MFA requirement: %w", err)
+	}
+	return count > 0, nil
+}
+
+// Enabled reports whether a user has completed enrolment
+func (s *MFAService) Enabled(ctx context.Context, userID string) (bool, error) {
+	var count int64
+	err := s.db.WithContext(ctx).
+		Model(&gormmodels.UserMFA{}).
+		Where("user_id = ? AND enabled_at IS NOT NULL", userID).
+		Count(&count).Error
+	if err != nil {
+		return false, fmt.Errorf("failed to check MFA enrolment: %w", err)
+	}
+	return count > 0, nil
+}
+
+// Status returns the second factor status of a user
+func (s *MFAService) Status(ctx context.Context, userID string) (*MFAStatus, error) {
+	enabled, err := s.Enabled(ctx, userID)
+	if err != nil {
+		return nil, err
+	}
+	required, err := s.Required(ctx, userID)
+	if err != nil {
+		return nil, err
+	}
+	status := &MFAStatus{Enabled: enabled, Required: required}
+	if enabled {
+		var remaining int64
+		if err := s.db.WithContext(ctx).
+			Model(&gormmodels.MFARecoveryCode{}).
+			Where("user_id = ? AND used_at IS NULL", userID).
+			Count(&remaining).Error; err != nil {
+			return nil, fmt.Errorf("failed to count recovery codes: %w", err)
+		}
+		status.RecoveryCodesRemaining = int(remaining)
+	}
+	return status, nil
+}
+
+// BeginEnrollment creates a new secret for a user, labelled with the account
+// name in authenticator apps. It replaces any pending enrolment and takes
+// effect once confirmed with ConfirmEnrollment.
+func (s *MFAService) BeginEnrollment(ctx context.Context, userID, account string) (*MFAEnrollment, error) {
+	enabled, err := s.Enabled(ctx, userID)
+	if err != nil {
+		return nil, err
+	}
+	if enabled {
+		return nil, ErrMFAAlreadyEnabled
+	}
+
+	secret, err := totp.GenerateSecret()
+	if err != nil {
+		return nil, err
+	}
+	encrypted, err := s.encryptor.Encrypt(secret)
+	if err != nil {
+		return nil, fmt.Errorf("failed to encrypt TOTP secret: %w", err)
+	}
+	enrollment := gormmodels.UserMFA{UserID: userID, SecretEncrypted: encrypted}
+	if err := s.db.WithContext(ctx).Transaction(func(tx *gorm.DB) error {
+		if err := tx.Where("user_id = ?", userID).Delete(&gormmodels.UserMFA{}).Error; err != nil {
+			return err
+		}
+		return tx.Create(&enrollment).Error
+	}); err != nil {
+		return nil, fmt.Errorf("failed to store MFA enrolment: %w", err)
+	}
+
+	return &MFAEnrollment{
+		Secret: secret,
+		URI:    totp.URI(s.cfg.Issuer, account, secret),
+	}, nil
+}
+
+// ConfirmEnrollment enables MFA once the user proves their app produces
+// codes, and returns a fresh set of recovery codes
+func (s *MFAService) ConfirmEnrollment(ctx context.Context, userID, code string) ([]string, error) {
+	var enrollment gormmodels.UserMFA
+	if err := s.db.WithContext(ctx).First(&enrollment, "user_id = ?", userID).Error; err != nil {
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			return nil, ErrMFANotEnrolled
+		}
+		return nil, fmt.Errorf("failed to get MFA enrolment: %w", err)
+	}
+	if enrollment.EnabledAt != nil {
+		return nil, ErrMFAAlreadyEnabled
+	}
+	step, err := s.validateTOTP(&enrollment, code)
+	if err != nil {
+		return nil, err
+	}
+
+	codes, hashes, err := generateRecoveryCodes()
+	if err != nil {
+		return nil, err
+	}
+	now := time.Now().UTC()
+	err = s.db.WithContext(ctx).Transaction(func(tx *gorm.DB) error {
+		if err := tx.Model(&gormmodels.UserMFA{}).Where("user_id = ?", userID).Updates(map[string]interface{}{
+			"enabled_at":     now,
+			"last_used_step": step,
+		}).Error; err != nil {
+			return err
+		}
+		return replaceRecoveryCodes(tx, userID, hashes)
+	})
+	if err != nil {
+		return nil, fmt.Errorf("failed to enable MFA: %w", err)
+	}
+
+	s.logger.WithField("user_id", userID).Info("MFA enabled")
+	return codes, nil
+}
+
+// Verify checks a TOTP code or an unused recovery code of a user. Each is
+// accepted once.
+func (s *MFAService) Verify(ctx context.Context, userID, code string) error {
+	var enrollment gormmodels.UserMFA
+	if err := s.db.WithContext(ctx).First(&enrollment, "user_id = ? AND enabled_at IS NOT NULL", userID).Error; err != nil {
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			return ErrMFANotEnrolled
+		}
+		return fmt.Errorf("failed to get MFA enrolment: %w", err)
+	}
+
+	if recovery, ok := normalizeRecoveryCode(code); ok {
+		return s.useRecoveryCode(ctx, userID, recovery)
+	}
+
+	step, err := s.validateTOTP(&enrollment, code)
+	if err != nil {
+		return err
+	}
+	// Conditional on the step, so concurrent logins cannot both use a code
+	result := s.db.WithContext(ctx).
+		Model(&gormmodels.UserMFA{}).
+		Where("user_id = ? AND last_used_step < ?", userID, step).
+		Update("last_used_step", step)
+	if result.Error != nil {
+		return fmt.Errorf("failed to record MFA code use: %w", result.Error)
+	}
+	if result.RowsAffected == 0 {
+		return ErrInvalidMFACode
+	}
+	return nil
+}
+
+// RegenerateRecoveryCodes replaces the recovery codes of an enrolled user
+func (s *MFAService) RegenerateRecoveryCodes(ctx context.Context, userID string) ([]string, error) {
+	enabled, err := s.Enabled(ctx, userID)
+	if err != nil {
+		return nil, err
+	}
+	if !enabled {
+		return nil, ErrMFANotEnrolled
+	}
+
+	codes, hashes, err := generateRecoveryCodes()
+	if err != nil {
+		return nil, err
+	}
+	if err := s.db.WithContext(ctx).Transaction(func(tx *gorm.DB) error {
+		return replaceRecoveryCodes(tx, userID, hashes)
+	}); err != nil {
+		return nil, fmt.Errorf("failed to store recovery codes: %w", err)
+	}
+	return codes, nil
+}
+
+// Reset removes the enrolment and recovery codes of a user. If MFA is
+// required, the user enrols again at the next login.
+func (s *MFAService) Reset(ctx context.Context, userID string) error {
+	return s.db.WithContext(ctx).Transaction(func(tx *gorm.DB) error {
+		if err := tx.Where("user_id = ?", userID).Delete(&gormmodels.MFARecoveryCode{}).Error; err != nil {
+			return err
+		}
+		if err := tx.Where("user_id = ?", userID).Delete(&gormmodels.MFAChallenge{}).Error; err != nil {
+			return err
+		}
+		return tx.Where("user_id = ?", userID).Delete(&gormmodels.UserMFA{}).Error
+	})
+}
+
+func (s *MFAService) validateTOTP(enrollment *gormmodels.UserMFA, code string) (int64, error) {
+	secret, err := s.encryptor.Decrypt(enrollment.SecretEncrypted)
+	if err != nil {
+		return 0, fmt.Errorf("failed to decrypt TOTP secret: %w", err)
+	}
+	step, ok := totp.Validate(secret, code, time.Now(), totpSkew)
+	if !ok || step <= enrollment.LastUsedStep {
+		return 0, ErrInvalidMFACode
+	}
+	return step, nil
+}
+
+func (s *MFAService) useRecoveryCode(ctx context.Context, userID, code string) error {
+	var codes []gormmodels.MFARecoveryCode
+	if err := s.db.WithContext(ctx).Where("user_id = ? AND used_at IS NULL", userID).Find(&codes).Error; err != nil {
+		return fmt.Errorf("failed to get recovery codes: %w", err)
+	}
+	for _, candidate := range codes {
+		if valid, err := pkgcrypto.VerifyPassword(code, candidate.CodeHash); err != nil || !valid {
+			continue
+		}
+		result := s.db.WithContext(ctx).
+			Model(&gormmodels.MFARecoveryCode{}).
+			Where("id = ? AND used_at IS NULL", candidate.ID).
+			Update("used_at", time.Now().UTC())
+		if result.Error != nil {
+			return fmt.Errorf("failed to use recovery code: %w", result.Error)
+		}
+		if result.RowsAffected == 0 {
+			return ErrInvalidMFACode
+		}
+		s.logger.WithField("user_id", userID).Warn("Recovery code used for login")
+		return nil
+	}
+	return ErrInvalidMFACode
+}
+
+func replaceRecoveryCodes(tx *gorm.DB, userID string, hashes []string) error {
+	if err := tx.Where("user_id = ?", userID).Delete(&gormmodels.MFARecoveryCode{}).Error; err != nil {
+		return err
+	}
+	codes := make([]gormmodels.MFARecoveryCode, 0, len(hashes))
+	for _, hash := range hashes {
+		codes = append(codes, gormmodels.MFARecoveryCode{UserID: userID, CodeHash: hash})
+	}
+	return tx.Create(&codes).Error
+}
+
+var recoveryCodeEncoding = base32.StdEncoding.WithPadding(base32.NoPadding)
+
+// generateRecoveryCodes returns codes such as "k3m2p-7qx4a" and their hashes
+func generateRecoveryCodes() (codes, hashes []string, err error) {
+	for i := 0; i < RecoveryCodeCount; i++ {
+		b := make([]byte, 8)
+		if _, err := rand.Read(b); err != nil {
+			return nil, nil, fmt.Errorf("failed to generate recovery code: %w", err)
+		}
+		code := strings.ToLower(recoveryCodeEncoding.EncodeToString(b))[:recoveryCodeLength]
+		hash, err := pkgcrypto.HashPassword(code)
+		if err != nil {
+			return nil, nil, fmt.Errorf("failed to hash recovery code: %w", err)
+		}
+		codes = append(codes, code[:5]+"-"+code[5:])
+		hashes = append(hashes, hash)
+	}
+	return codes, hashes, nil
+}
+
+// normalizeRecoveryCode tells recovery codes from TOTP codes and strips what
+// users add or leave out when typing them
+func normalizeRecoveryCode(code string) (string, bool) {
+	normalized := strings.ToLower(strings.NewReplacer("-", "", " ", "").Replace(code))
+	if len(normalized) != recoveryCodeLength {
+		return "", false
+	}
+	return normalized, true
+}
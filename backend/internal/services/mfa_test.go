@@ -0,0 +1,157 @@
+package services_test
+
+import (
+	"context"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/sirupsen/logrus"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"gorm.io/driver/sqlite"
+	"gorm.io/gorm"
+
+	"github.com/orca-ng/orca/internal/config"
+	"github.com/orca-ng/orca/internal/crypto"
+	"github.com/orca-ng/orca/internal/database"
+	gormmodels "github.com/orca-ng/orca/internal/models/gorm"
+	"github.com/orca-ng/orca/internal/services"
+	"github.com/orca-ng/orca/pkg/totp"
+)
+
+func TestTOTPCode(t *testing.T) {
+	// RFC 6238 appendix B, truncated to six digits
+	secret := "GEZDGNBVGY3TQOJQGEZDGNBVGY3TQOJQ" // "12345678901234567890"
+	tests := []struct {
+		unix int64
+		code string
+	}{
+		{59, "287082"},
+		{1111111109, "081804"},
+		{1234567890, "005924"},
+		{2000000000, "279037"},
+	}
+	for _, tt := range tests {
+		code, err := totp.Code(secret, totp.Step(time.Unix(tt.unix, 0)))
+		require.NoError(t, err)
+		assert.Equal(t, tt.code, code, "at %d", tt.unix)
+	}
+
+	step, ok := totp.Validate(secret, "081804", time.Unix(1111111109+30, 0), 1)
+	assert.True(t, ok)
+	assert.Equal(t, totp.Step(time.Unix(1111111109, 0)), step)
+	_, ok = totp.Validate(secret, "081804", time.Unix(1111111109+90, 0), 1)
+	assert.False(t, ok)
+}
+
+func setupMFA(t *testing.T, cfg config.MFAConfig) (*services.MFAService, *gorm.DB) {
+	t.Helper()
+	db, err := gorm.Open(sqlite.Open(":memory:"), &gorm.Config{})
+	require.NoError(t, err)
+	require.NoError(t, db.AutoMigrate(
+		&gormmodels.User{},
+		&gormmodels.UserMFA{},
+		&gormmodels.MFARecoveryCode{},
+		&gormmodels.MFAChallenge{},
+		&gormmodels.Role{},
+		&gormmodels.RoleAssignment{},
+	))
+	return services.NewMFAService(&database.GormDB{DB: db}, crypto.NewEncryptor("test-key"), cfg, logrus.New()), db
+}
+
+func codeAt(t *testing.T, secret string, step int64) string {
+	t.Helper()
+	code, err := totp.Code(secret, step)
+	require.NoError(t, err)
+	return code
+}
+
+func TestMFAEnrollment(t *testing.T) {
+	mfa, db := setupMFA(t, config.MFAConfig{Issuer: "ORCA Test"})
+	ctx := context.Background()
+	user := gormmodels.User{Username: "alice", PasswordHash: "x"}
+	require.NoError(t, db.Create(&user).Error)
+
+	_, err := mfa.ConfirmEnrollment(ctx, user.ID, "123456")
+	assert.ErrorIs(t, err, services.ErrMFANotEnrolled)
+
+	enrollment, err := mfa.BeginEnrollment(ctx, user.ID, user.Username)
+	require.NoError(t, err)
+	step := totp.Step(time.Now())
+	assert.True(t, strings.HasPrefix(enrollment.URI, "otpauth://totp/ORCA%20Test:alice?"))
+	assert.Contains(t, enrollment.URI, "secret="+enrollment.Secret)
+
+	// The secret is stored encrypted, and pending until confirmed
+	var stored gormmodels.UserMFA
+	require.NoError(t, db.First(&stored, "user_id = ?", user.ID).Error)
+	assert.NotContains(t, stored.SecretEncrypted, enrollment.Secret)
+	enabled, err := mfa.Enabled(ctx, user.ID)
+	require.NoError(t, err)
+	assert.False(t, enabled)
+
+	_, err = mfa.ConfirmEnrollment(ctx, user.ID, "000000")
+	assert.ErrorIs(t, err, services.ErrInvalidMFACode)
+	codes, err := mfa.ConfirmEnrollment(ctx, user.ID, codeAt(t, enrollment.Secret, step))
+	require.NoError(t, err)
+	require.Len(t, codes, services.RecoveryCodeCount)
+
+	_, err = mfa.BeginEnrollment(ctx, user.ID, user.Username)
+	assert.ErrorIs(t, err, services.ErrMFAAlreadyEnabled)
+
+	// A code is accepted once
+	assert.ErrorIs(t, mfa.Verify(ctx, user.ID, codeAt(t, enrollment.Secret, step)), services.ErrInvalidMFACode)
+	assert.NoError(t, mfa.Verify(ctx, user.ID, codeAt(t, enrollment.Secret, step+1)))
+	assert.ErrorIs(t, mfa.Verify(ctx, user.ID, codeAt(t, enrollment.Secret, step+1)), services.ErrInvalidMFACode)
+
+	// So is a recovery code, however it is typed
+	var hashes []gormmodels.MFARecoveryCode
+	require.NoError(t, db.Find(&hashes, "user_id = ?", user.ID).Error)
+	for _, hash := range hashes {
+		assert.NotContains(t, hash.CodeHash, strings.ReplaceAll(codes[0], "-", ""))
+	}
+	assert.NoError(t, mfa.Verify(ctx, user.ID, strings.ToUpper(strings.ReplaceAll(codes[0], "-", ""))))
+	assert.ErrorIs(t, mfa.Verify(ctx, user.ID, codes[0]), services.ErrInvalidMFACode)
+	assert.ErrorIs(t, mfa.Verify(ctx, user.ID, "aaaaa-bbbbb"), services.ErrInvalidMFACode)
+
+	status, err := mfa.Status(ctx, user.ID)
+	require.NoError(t, err)
+	assert.Equal(t, services.MFAStatus{Enabled: true, RecoveryCodesRemaining: services.RecoveryCodeCount - 1}, *status)
+
+	// New codes replace the old ones
+	fresh, err := mfa.RegenerateRecoveryCodes(ctx, user.ID)
+	require.NoError(t, err)
+	assert.ErrorIs(t, mfa.Verify(ctx, user.ID, codes[1]), services.ErrInvalidMFACode)
+	assert.NoError(t, mfa.Verify(ctx, user.ID, fresh[1]))
+
+	require.NoError(t, mfa.Reset(ctx, user.ID))
+	assert.ErrorIs(t, mfa.Verify(ctx, user.ID, fresh[2]), services.ErrMFANotEnrolled)
+	var remaining int64
+	db.Model(&gormmodels.MFARecoveryCode{}).Count(&remaining)
+	assert.Zero(t, remaining)
+}
+
+func TestMFARequired(t *testing.T) {
+	mfa, db := setupMFA(t, config.MFAConfig{})
+	ctx := context.Background()
+
+	admins := gormmodels.Role{Name: "admins", Permissions: []string{gormmodels.PermAll}, RequireMFA: true}
+	viewers := gormmodels.Role{Name: "viewers", Permissions: []string{gormmodels.PermInstancesRead}}
+	require.NoError(t, db.Create(&admins).Error)
+	require.NoError(t, db.Create(&viewers).Error)
+	require.NoError(t, db.Create(&gormmodels.RoleAssignment{UserID: "usr_admin", RoleID: admins.ID}).Error)
+	require.NoError(t, db.Create(&gormmodels.RoleAssignment{UserID: "usr_viewer", RoleID: viewers.ID}).Error)
+
+	required, err := mfa.Required(ctx, "usr_admin")
+	require.NoError(t, err)
+	assert.True(t, required)
+	required, err = mfa.Required(ctx, "usr_viewer")
+	require.NoError(t, err)
+	assert.False(t, required)
+
+	// Required for everyone
+	everyone, _ := setupMFA(t, config.MFAConfig{Required: true})
+	required, err = everyone.Required(ctx, "usr_viewer")
+	require.NoError(t, err)
+	assert.True(t, required)
+}
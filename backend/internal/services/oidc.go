@@ -0,0 +1,186 @@
+package services
+
+import (
+	"context"
+	"fmt"
+	"strings"
+	"sync"
+
+	"github.com/coreos/go-oidc/v3/oidc"
+	"golang.org/x/oauth2"
+
+	"github.com/orca-ng/orca/internal/config"
+	gormmodels "github.com/orca-ng/orca/internal/models/gorm"
+	"github.com/orca-ng/orca/pkg/session"
+)
+
+// OIDCProvider runs the authorization code flow with PKCE against an OpenID
+// Connect identity provider. Discovery happens on first use and is retried
+// until it succeeds, so ORCA starts while the provider is unreachable.
+type OIDCProvider struct {
+	cfg config.OIDCConfig
+
+	mu       sync.Mutex
+	oauth    *oauth2.Config
+	verifier *oidc.IDTokenVerifier
+}
+
+// OIDCLogin holds the values of one login attempt that must be presented
+// again when the provider redirects back
+type OIDCLogin struct {
+	State        string
+	Nonce        string
+	CodeVerifier string
+}
+
+// NewOIDCProvider creates a provider for the configuration
+func NewOIDCProvider(cfg config.OIDCConfig) *OIDCProvider {
+	return &OIDCProvider{cfg: cfg}
+}
+
+// NewOIDCLogin generates the state, nonce and PKCE code verifier of a login
+func NewOIDCLogin() (*OIDCLogin, error) {
+	state, err := session.GenerateToken()
+	if err != nil {
+		return nil, err
+	}
+	nonce, err := session.GenerateToken()
+	if err != nil {
+		return nil, err
+	}
+	return &OIDCLogin{
+		State:        state,
+		Nonce:        nonce,
+		CodeVerifier: oauth2.GenerateVerifier(),
+	}, nil
+}
+
+func (p *OIDCProvider) discover(ctx context.Context) (*oauth2.Config, *oidc.IDTokenVerifier, error) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	if p.oauth != nil {
+		return p.oauth, p.verifier, nil
+	}
+
+	// Keys are fetched with this context later on, long after the request
+	provider, err := oidc.NewProvider(context.WithoutCancel(ctx), p.cfg.IssuerURL)
+	if err != nil {
+		return nil, nil, fmt.Errorf("OIDC discovery failed: %w", err)
+	}
+
+	scopes := p.cfg.Scopes
+	if !containsString(scopes, oidc.ScopeOpenID) {
+		scopes = append([]string{oidc.ScopeOpenID}, scopes...)
+	}
+	p.oauth = &oauth2.Config{
+		ClientID:     p.cfg.ClientID,
+		ClientSecret: p.cfg.ClientSecret,
+		RedirectURL:  p.cfg.RedirectURL,
+		Endpoint:     provider.Endpoint(),
+		Scopes:       scopes,
+	}
+	p.verifier = provider.Verifier(&oidc.Config{ClientID: p.cfg.ClientID})
+	return p.oauth, p.verifier, nil
+}
+
+// AuthCodeURL returns the URL of the provider to send the browser to
+func (p *OIDCProvider) AuthCodeURL(ctx context.Context, login *OIDCLogin) (string, error) {
+	oauth, _, err := p.discover(ctx)
+	if err != nil {
+		return "", err
+	}
+	return oauth.AuthCodeURL(login.State,
+		oidc.Nonce(login.Nonce),
+		oauth2.S256ChallengeOption(login.CodeVerifier),
+	), nil
+}
+
+// Exchange redeems an authorization code and returns the identity asserted
+// by the verified ID token
+func (p *OIDCProvider) Exchange(ctx context.Context, code string, login *OIDCLogin) (*ExternalIdentity, error) {
+	oauth, verifier, err := p.discover(ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	token, err := oauth.Exchange(ctx, code, oauth2.VerifierOption(login.CodeVerifier))
+	if err != nil {
+		return nil, fmt.Errorf("failed to redeem authorization code: %w", err)
+	}
+	rawIDToken, ok := token.Extra("id_token").(string)
+	if !ok || rawIDToken == "" {
+		return nil, fmt.Errorf("token response contains no ID token")
+	}
+
+	idToken, err := verifier.Verify(ctx, rawIDToken)
+	if err != nil {
+		return nil, fmt.Errorf("invalid ID token: %w", err)
+	}
+	if idToken.Nonce != login.Nonce {
+		return nil, fmt.Errorf("ID token nonce does not match")
+	}
+
+	var claims map[string]interface{}
+	if err := idToken.Claims(&claims); err != nil {
+		return nil, fmt.Errorf("failed to parse ID token claims: %w", err)
+	}
+
+	identity := &ExternalIdentity{
+		Provider: gormmodels.AuthProviderOIDC,
+		Subject:  idToken.Subject,
+		Username: stringClaim(claims, p.cfg.UsernameClaim),
+		Email:    stringClaim(claims, "email"),
+		Groups:   stringsClaim(claims, p.cfg.GroupsClaim),
+	}
+	if identity.Username == "" {
+		identity.Username = identity.Email
+	}
+	if identity.Username == "" {
+		return nil, fmt.Errorf("ID token has no %q claim", p.cfg.UsernameClaim)
+	}
+	return identity, nil
+}
+
+// GroupMapping returns the configured mapping of groups to admin status and roles
+func (p *OIDCProvider) GroupMapping() GroupMapping {
+	return groupMappingFromConfig(p.cfg.AdminGroups, p.cfg.GroupRoles)
+}
+
+func groupMappingFromConfig(adminGroups []string, groupRoles []config.GroupRoleMapping) GroupMapping {
+	mapping := GroupMapping{
+		AdminGroups: adminGroups,
+		GroupRoles:  make(map[string][]string),
+	}
+	for _, m := range groupRoles {
+		mapping.GroupRoles[m.Group] = appendUnique(mapping.GroupRoles[m.Group], m.Roles...)
+	}
+	return mapping
+}
+
+func stringClaim(claims map[string]interface{}, name string) string {
+	if name == "" {
+		return ""
+	}
+	value, _ := claims[name].(string)
+	return strings.TrimSpace(value)
+}
+
+// stringsClaim reads a claim holding a list of strings, or a single string
+func stringsClaim(claims map[string]interface{}, name string) []string {
+	if name == "" {
+		return nil
+	}
+	switch value := claims[name].(type) {
+	case string:
+		return []string{value}
+	case []interface{}:
+		var result []string
+		for _, v := range value {
+			if s, ok := v.(string); ok {
+				result = append(result, s)
+			}
+		}
+		return result
+	}
+	return nil
+}
@@ -7,14 +7,16 @@ import (
 	"time"
 
 	"github.com/sirupsen/logrus"
+	"github.com/orca-ng/orca/internal/database"
 	gormmodels "github.com/orca-ng/orca/internal/models/gorm"
 )
 
 // OperationEvent represents an operation state change event
 type OperationEvent struct {
-	Type      string                 `json:"type"` // "created", "updated", "completed", "failed", "sync_created", "sync_updated"
+	Type      string                 `json:"type"` // "created", "updated", "completed", "failed", "sync_created", "sync_updated", "certificate_expiring", "certificate_expired"
 	Operation *gormmodels.Operation  `json:"operation,omitempty"`
 	SyncJob   *gormmodels.SyncJob    `json:"sync_job,omitempty"`
+	CertificateExpiry *gormmodels.CertificateExpiry `json:"certificate_expiry,omitempty"`
 	Timestamp time.Time              `json:"timestamp"`
 }
 
@@ -23,6 +25,13 @@ type OperationEventService struct {
 	mu          sync.RWMutex
 	subscribers map[string]chan *OperationEvent
 	logger      *logrus.Logger
+
+	// Cross-replica fan-out, set by EnableFanOut
+	db          *database.GormDB
+	origin      string
+	outbox      chan *EventNotice
+
+	forwarder *AuditForwarder // set by EnableAuditForwarding
 }
 
 // NewOperationEventService creates a new operation event service
@@ -96,8 +105,24 @@ func (s *OperationEventService) PublishOperationUpdated(operation *gormmodels.Op
 	})
 }
 
-// publish sends an event to all subscribers
+// EnableAuditForwarding sends events published on this replica to the
+// forwarder's sinks. It must be called before events are published.
+func (s *OperationEventService) EnableAuditForwarding(forwarder *AuditForwarder) {
+	s.forwarder = forwarder
+}
+
+// publish sends an event to all local subscribers, to the other replicas and
+// to the audit sinks
 func (s *OperationEventService) publish(event *OperationEvent) {
+	s.deliver(event)
+	s.announce(event)
+	if s.forwarder != nil {
+		s.forwarder.ForwardOperationEvent(event)
+	}
+}
+
+// deliver sends an event to all subscribers on this replica
+func (s *OperationEventService) deliver(event *OperationEvent) {
 	s.mu.RLock()
 	defer s.mu.RUnlock()
 
@@ -113,6 +138,9 @@ func (s *OperationEventService) publish(event *OperationEvent) {
 		logFields["sync_job_id"] = event.SyncJob.ID
 		logFields["sync_type"] = event.SyncJob.SyncType
 	}
+	if event.CertificateExpiry != nil {
+		logFields["certificate_expiry_id"] = event.CertificateExpiry.ID
+	}
 	s.logger.WithFields(logFields).Debug("Publishing event")
 
 	// Send to all subscribers
@@ -159,4 +187,18 @@ func (s *OperationEventService) PublishSyncJobUpdated(job *gormmodels.SyncJob) {
 		SyncJob:   job,
 		Timestamp: time.Now(),
 	})
-}
\ No newline at end of file
+}
+// PublishCertificateExpiry publishes a certificate that came within a
+// warning threshold of its expiry or expired
+func (s *OperationEventService) PublishCertificateExpiry(expiry *gormmodels.CertificateExpiry) {
+	eventType := "certificate_expiring"
+	if expiry.Status == gormmodels.ExpiryStatusExpired {
+		eventType = "certificate_expired"
+	}
+
+	s.publish(&OperationEvent{
+		Type:              eventType,
+		CertificateExpiry: expiry,
+		Timestamp:         time.Now(),
+	})
+}
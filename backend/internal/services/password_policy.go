@@ -0,0 +1,277 @@
+package services
+
+import (
+	"bufio"
+	"context"
+	"crypto/sha1"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"os"
+	"strings"
+	"unicode"
+	"unicode/utf8"
+
+	"github.com/sirupsen/logrus"
+	"gorm.io/gorm"
+
+	"github.com/orca-ng/orca/internal/config"
+	"github.com/orca-ng/orca/internal/database"
+	gormmodels "github.com/orca-ng/orca/internal/models/gorm"
+	"github.com/orca-ng/orca/pkg/crypto"
+)
+
+// PasswordPolicyError tells why a password was refused. Its message is meant
+// for the user choosing the password.
+type PasswordPolicyError struct {
+	Reason string
+}
+
+func (e *PasswordPolicyError) Error() string {
+	return e.Reason
+}
+
+// PasswordPolicy checks new passwords of local users and stores them
+type PasswordPolicy struct {
+	db       *database.GormDB
+	cfg      config.PasswordPolicyConfig
+	breached map[[sha1.Size]byte]struct{}
+	logger   *logrus.Logger
+}
+
+// NewPasswordPolicy creates a password policy, loading the breached password
+// list when one is configured
+func NewPasswordPolicy(db *database.GormDB, cfg config.PasswordPolicyConfig, logger *logrus.Logger) (*PasswordPolicy, error) {
+	p := &PasswordPolicy{
+		db:     db,
+		cfg:    cfg,
+		logger: logger,
+	}
+	if cfg.BreachedListFile != "" {
+		breached, err := loadBreachedPasswords(cfg.BreachedListFile)
+		if err != nil {
+			return nil, err
+		}
+		p.breached = breached
+		logger.WithField("passwords", len(breached)).Info("Loaded breached password list")
+	}
+	return p, nil
+}
+
+// loadBreachedPasswords reads a file of one password per line. Lines of 40
+// hex digits, optionally followed by ":count" as in the Have I Been Pwned
+// downloads, are taken as SHA-1 hashes of passwords.
+func loadBreachedPasswords(path string) (map[[sha1.Size]byte]struct{}, error) {
+	f, err := os.Open(path)
+	if err != nil {
+		return nil, fmt.Errorf("failed to open breached password list: %w", err)
+	}
+	defer f.Close()
+
+	breached := make(map[[sha1.Size]byte]struct{})
+	scanner := bufio.NewScanner(f)
+	for scanner.Scan() {
+		line := strings.TrimRight(scanner.Text(), "\r")
+		if line == "" {
+			continue
+		}
+		breached[breachedKey(line)] = struct{}{}
+	}
+	if err := scanner.Err(); err != nil {
+		return nil, fmt.Errorf("failed to read breached password list: %w", err)
+	}
+	return breached, nil
+}
+
+func breachedKey(line string) [sha1.Size]byte {
+	hash := line
+	if i := strings.IndexByte(line, ':'); i == 2*sha1.Size {
+		hash = line[:i]
+	}
+	var key [sha1.Size]byte
+	if len(hash) == 2*sha1.Size {
+		if _, err := hex.Decode(key[:], []byte(hash)); err == nil {
+			return key
+		}
+	}
+	return sha1.Sum([]byte(line))
+}
+
+// Validate checks a password against the length, character class and
+// breached password rules
+func (p *PasswordPolicy) Validate(username, password string) error {
+	if utf8.RuneCountInString(password) < p.cfg.MinLength {
+		return &PasswordPolicyError{Reason: fmt.Sprintf("password must be at least %d characters long", p.cfg.MinLength)}
+	}
+	if classes := characterClasses(password); classes < p.cfg.MinClasses {
+		return &PasswordPolicyError{Reason: fmt.Sprintf("password must contain at least %d of lowercase letters, uppercase letters, digits and symbols", p.cfg.MinClasses)}
+	}
+	if len(username) >= 3 && strings.Contains(strings.ToLower(password), strings.ToLower(username)) {
+		return &PasswordPolicyError{Reason: "password must not contain the username"}
+	}
+	if _, found := p.breached[sha1.Sum([]byte(password))]; found {
+		return &PasswordPolicyError{Reason: "password appears in a list of breached passwords"}
+	}
+	return nil
+}
+
+func characterClasses(password string) int {
+	var lower, upper, digit, symbol int
+	for _, r := range password {
+		switch {
+		case unicode.IsLower(r):
+			lower = 1
+		case unicode.IsUpper(r):
+			upper = 1
+		case unicode.IsDigit(r):
+			digit = 1
+		default:
+			symbol = 1
+		}
+	}
+	return lower + upper + digit + symbol
+}
+
+// Hash validates the password of a new user and returns its hash
+func (p *PasswordPolicy) Hash(username, password string) (string, error) {
+	if err := p.Validate(username, password); err != nil {
+		return "", err
+	}
+	return crypto.HashPassword(password)
+}
+
+// Check validates a new password of a user and refuses the current and
+// recent passwords
+func (p *PasswordPolicy) Check(ctx context.Context, user *gormmodels.User, password string) error {
+	if err := p.Validate(user.Username, password); err != nil {
+		return err
+	}
+	return p.checkHistory(ctx, user, password)
+}
+
+// SetPassword checks a new password of a user and stores it
+func (p *PasswordPolicy) SetPassword(ctx context.Context, user *gormmodels.User, password string) error {
+	if err := p.Check(ctx, user, password); err != nil {
+		return err
+	}
+	hash, err := crypto.HashPassword(password)
+	if err != nil {
+		return fmt.Errorf("failed to hash password: %w", err)
+	}
+	return p.db.WithContext(ctx).Transaction(func(tx *gorm.DB) error {
+		return p.StoreHash(tx, user, hash)
+	})
+}
+
+// SetUserPassword sets the password of the local user with the given
+// username and ends their sessions, for tools that work on the database
+// directly. It returns the user.
+func (p *PasswordPolicy) SetUserPassword(ctx context.Context, username, password string) (*gormmodels.User, error) {
+	var user gormmodels.User
+	if err := p.db.WithContext(ctx).First(&user, "username = ?", username).Error; err != nil {
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			return nil, fmt.Errorf("user not found")
+		}
+		return nil, fmt.Errorf("failed to get user: %w", err)
+	}
+	if user.AuthProvider != gormmodels.AuthProviderLocal {
+		return nil, fmt.Errorf("only local users have a password in ORCA")
+	}
+	if err := p.Check(ctx, &user, password); err != nil {
+		return nil, err
+	}
+	hash, err := crypto.HashPassword(password)
+	if err != nil {
+		return nil, fmt.Errorf("failed to hash password: %w", err)
+	}
+	err = p.db.WithContext(ctx).Transaction(func(tx *gorm.DB) error {
+		if err := p.StoreHash(tx, &user, hash); err != nil {
+			return err
+		}
+		if err := tx.Where("user_id = ?", user.ID).Delete(&gormmodels.MFAChallenge{}).Error; err != nil {
+			return err
+		}
+		return tx.Where("user_id = ?", user.ID).Delete(&gormmodels.Session{}).Error
+	})
+	if err != nil {
+		return nil, err
+	}
+	return &user, nil
+}
+
+// StoreHash replaces the password hash of a user within a transaction,
+// keeping the previous hash in the history
+func (p *PasswordPolicy) StoreHash(tx *gorm.DB, user *gormmodels.User, hash string) error {
+	if err := tx.Model(&gormmodels.User{}).Where("id = ?", user.ID).Update("password_hash", hash).Error; err != nil {
+		return err
+	}
+	if p.cfg.HistorySize == 0 || user.PasswordHash == "" {
+		return nil
+	}
+	if err := tx.Create(&gormmodels.PasswordHistory{UserID: user.ID, PasswordHash: user.PasswordHash}).Error; err != nil {
+		return err
+	}
+
+	// Forget hashes beyond the history size
+	var expired []string
+	if err := tx.Model(&gormmodels.PasswordHistory{}).
+		Where("user_id = ?", user.ID).
+		Order("created_at DESC").Order("id DESC").
+		Offset(p.cfg.HistorySize).Limit(1000).
+		Pluck("id", &expired).Error; err != nil {
+		return err
+	}
+	if len(expired) == 0 {
+		return nil
+	}
+	return tx.Where("id IN ?", expired).Delete(&gormmodels.PasswordHistory{}).Error
+}
+
+func (p *PasswordPolicy) checkHistory(ctx context.Context, user *gormmodels.User, password string) error {
+	if p.cfg.HistorySize == 0 {
+		return nil
+	}
+	var previous []string
+	if err := p.db.WithContext(ctx).Model(&gormmodels.PasswordHistory{}).
+		Where("user_id = ?", user.ID).
+		Order("created_at DESC").Order("id DESC").
+		Limit(p.cfg.HistorySize).
+		Pluck("password_hash", &previous).Error; err != nil {
+		return fmt.Errorf("failed to get password history: %w", err)
+	}
+	if user.PasswordHash != "" {
+		previous = append(previous, user.PasswordHash)
+	}
+	for _, hash := range previous {
+		if valid, _ := crypto.VerifyPassword(password, hash); valid {
+			return &PasswordPolicyError{Reason: fmt.Sprintf("password must differ from the last %d passwords", p.cfg.HistorySize)}
+		}
+	}
+	return nil
+}
+
+// Rehash replaces the stored hash of a user who just logged in with the
+// given password when it was made with weaker Argon2 parameters than the
+// current ones. The password is not checked against the policy, as it was
+// accepted when it was set.
+func (p *PasswordPolicy) Rehash(ctx context.Context, user *gormmodels.User, password string) error {
+	if !crypto.NeedsRehash(user.PasswordHash) {
+		return nil
+	}
+	hash, err := crypto.HashPassword(password)
+	if err != nil {
+		return fmt.Errorf("failed to hash password: %w", err)
+	}
+	// Leave the hash alone when the password changed meanwhile
+	result := p.db.WithContext(ctx).Model(&gormmodels.User{}).
+		Where("id = ? AND password_hash = ?", user.ID, user.PasswordHash).
+		Update("password_hash", hash)
+	if result.Error != nil {
+		return fmt.Errorf("failed to update password hash: %w", result.Error)
+	}
+	if result.RowsAffected > 0 {
+		p.logger.WithField("user_id", user.ID).Info("Rehashed password with current Argon2 parameters")
+		user.PasswordHash = hash
+	}
+	return nil
+}
@@ -0,0 +1,141 @@
+package services_test
+
+import (
+	"context"
+	"crypto/sha1"
+	"encoding/hex"
+	"errors"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/sirupsen/logrus"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"gorm.io/driver/sqlite"
+	"gorm.io/gorm"
+
+	"github.com/orca-ng/orca/internal/config"
+	"github.com/orca-ng/orca/internal/database"
+	gormmodels "github.com/orca-ng/orca/internal/models/gorm"
+	"github.com/orca-ng/orca/internal/services"
+	pkgcrypto "github.com/orca-ng/orca/pkg/crypto"
+)
+
+func setupPasswordPolicy(t *testing.T, cfg config.PasswordPolicyConfig) (*services.PasswordPolicy, *gorm.DB) {
+	t.Helper()
+	db, err := gorm.Open(sqlite.Open(":memory:"), &gorm.Config{})
+	require.NoError(t, err)
+	require.NoError(t, db.AutoMigrate(&gormmodels.User{}, &gormmodels.PasswordHistory{}, &gormmodels.Session{}, &gormmodels.MFAChallenge{}))
+	policy, err := services.NewPasswordPolicy(&database.GormDB{DB: db}, cfg, logrus.New())
+	require.NoError(t, err)
+	return policy, db
+}
+
+func TestPasswordPolicyValidate(t *testing.T) {
+	hash := sha1.Sum([]byte("Tr0ub4dor&3-Horse"))
+	list := filepath.Join(t.TempDir(), "breached.txt")
+	require.NoError(t, os.WriteFile(list, []byte("Password123!\r\n\n"+strings.ToUpper(hex.EncodeToString(hash[:]))+":4211\n"), 0o600))
+
+	policy, _ := setupPasswordPolicy(t, config.PasswordPolicyConfig{MinLength: 12, MinClasses: 3, BreachedListFile: list})
+
+	for password, reason := range map[string]string{
+		"Sh0rt!":              "at least 12 characters",
+		"lowercase and space": "at least 3 of",
+		"Password123!":        "breached",
+		"Tr0ub4dor&3-Horse":   "breached",
+		"My-ALICE-password-1": "username",
+	} {
+		err := policy.Validate("alice", password)
+		var policyErr *services.PasswordPolicyError
+		require.True(t, errors.As(err, &policyErr), password)
+		assert.Contains(t, policyErr.Reason, reason, password)
+	}
+	assert.NoError(t, policy.Validate("alice", "Correct-Horse-42"))
+	assert.NoError(t, policy.Validate("alice", "ünïcödé-Wörds 9"))
+
+	_, err := services.NewPasswordPolicy(nil, config.PasswordPolicyConfig{MinLength: 12, BreachedListFile: filepath.Join(t.TempDir(), "missing")}, logrus.New())
+	assert.Error(t, err)
+}
+
+func TestPasswordHistory(t *testing.T) {
+	policy, db := setupPasswordPolicy(t, config.PasswordPolicyConfig{MinLength: 8, HistorySize: 2})
+	ctx := context.Background()
+
+	hash, err := pkgcrypto.HashPassword("initial-0")
+	require.NoError(t, err)
+	require.NoError(t, db.Create(&gormmodels.User{ID: "usr_bob", Username: "bob", PasswordHash: hash, IsActive: true}).Error)
+	setPassword := func(password string) error {
+		var user gormmodels.User
+		require.NoError(t, db.First(&user, "id = ?", "usr_bob").Error)
+		return policy.SetPassword(ctx, &user, password)
+	}
+
+	for _, password := range []string{"second-1", "third-22", "fourth-333"} {
+		require.NoError(t, setPassword(password))
+	}
+	var count int64
+	require.NoError(t, db.Model(&gormmodels.PasswordHistory{}).Where("user_id = ?", "usr_bob").Count(&count).Error)
+	assert.Equal(t, int64(2), count)
+
+	// The current and the two previous passwords are refused, older ones not
+	for _, password := range []string{"fourth-333", "third-22", "second-1"} {
+		var policyErr *services.PasswordPolicyError
+		assert.True(t, errors.As(setPassword(password), &policyErr), password)
+	}
+	assert.NoError(t, setPassword("initial-0"))
+
+	_, err = policy.SetUserPassword(ctx, "nobody", "whatever-123")
+	assert.Error(t, err)
+}
+
+func TestSetUserPasswordEndsSessions(t *testing.T) {
+	policy, db := setupPasswordPolicy(t, config.PasswordPolicyConfig{MinLength: 8})
+	ctx := context.Background()
+
+	require.NoError(t, db.Create(&gormmodels.User{ID: "usr_bob", Username: "bob", IsActive: true}).Error)
+	require.NoError(t, db.Create(&gormmodels.Session{ID: "ses_bob", UserID: "usr_bob", Token: "bob", ExpiresAt: time.Now().Add(time.Hour)}).Error)
+	require.NoError(t, db.Create(&gormmodels.Session{ID: "ses_alice", UserID: "usr_alice", Token: "alice", ExpiresAt: time.Now().Add(time.Hour)}).Error)
+
+	user, err := policy.SetUserPassword(ctx, "bob", "new-password-1")
+	require.NoError(t, err)
+	assert.Equal(t, "usr_bob", user.ID)
+
+	var sessions []string
+	require.NoError(t, db.Model(&gormmodels.Session{}).Pluck("id", &sessions).Error)
+	assert.Equal(t, []string{"ses_alice"}, sessions)
+}
+
+func TestPasswordRehash(t *testing.T) {
+	policy, db := setupPasswordPolicy(t, config.PasswordPolicyConfig{MinLength: 8})
+	ctx := context.Background()
+
+	weak, err := pkgcrypto.HashPasswordWithParams("old-password", &pkgcrypto.Argon2Params{
+		Memory:      16 * 1024,
+		Iterations:  1,
+		Parallelism: 2,
+		SaltLength:  16,
+		KeyLength:   32,
+	})
+	require.NoError(t, err)
+	assert.True(t, pkgcrypto.NeedsRehash(weak))
+	user := gormmodels.User{ID: "usr_carol", Username: "carol", PasswordHash: weak, IsActive: true}
+	require.NoError(t, db.Create(&user).Error)
+
+	require.NoError(t, policy.Rehash(ctx, &user, "old-password"))
+	var stored gormmodels.User
+	require.NoError(t, db.First(&stored, "id = ?", user.ID).Error)
+	assert.NotEqual(t, weak, stored.PasswordHash)
+	assert.Equal(t, stored.PasswordHash, user.PasswordHash)
+	assert.False(t, pkgcrypto.NeedsRehash(stored.PasswordHash))
+	valid, err := pkgcrypto.VerifyPassword("old-password", stored.PasswordHash)
+	require.NoError(t, err)
+	assert.True(t, valid)
+
+	// Hashes with the current parameters are left alone
+	require.NoError(t, policy.Rehash(ctx, &user, "old-password"))
+	require.NoError(t, db.First(&stored, "id = ?", user.ID).Error)
+	assert.Equal(t, user.PasswordHash, stored.PasswordHash)
+}
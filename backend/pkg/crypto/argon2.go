@@ -59,6 +59,20 @@ func VerifyPassword(password, encodedHash string) (bool, error) {
 	return false, nil
 }
 
+// NeedsRehash reports whether a hash was made with parameters weaker than
+// DefaultArgon2Params, so that it should be replaced on the next login.
+func NeedsRehash(encodedHash string) bool {
+	params, _, _, err := decodeHash(encodedHash)
+	if err != nil {
+		return false
+	}
+	return params.Memory < DefaultArgon2Params.Memory ||
+		params.Iterations < DefaultArgon2Params.Iterations ||
+		params.Parallelism < DefaultArgon2Params.Parallelism ||
+		params.SaltLength < DefaultArgon2Params.SaltLength ||
+		params.KeyLength < DefaultArgon2Params.KeyLength
+}
+
 func decodeHash(encodedHash string) (*Argon2Params, []byte, []byte, error) {
 	vals := strings.Split(encodedHash, "$")
 	if len(vals) != 6 {
@@ -0,0 +1,32 @@
+package session
+
+import (
+	"strings"
+)
+
+// APITokenPrefix starts every API token, telling them apart from session tokens
+const APITokenPrefix = "orca_"
+
+// apiTokenDisplayLength is how much of a token is kept to recognise it by
+const apiTokenDisplayLength = len(APITokenPrefix) + 8
+
+// GenerateAPIToken returns a new API token and the part of it that may be
+// stored and shown to identify it
+func GenerateAPIToken() (token, display string, err error) {
+	random, err := GenerateToken()
+	if err != nil {
+		return "", "", err
+	}
+	token = APITokenPrefix + random
+	return token, token[:apiTokenDisplayLength], nil
+}
+
+// IsAPIToken reports whether a bearer token is an API token
+func IsAPIToken(token string) bool {
+	return strings.HasPrefix(token, APITokenPrefix)
+}
+
+// HashAPIToken returns the hash an API token is stored and looked up by
+func HashAPIToken(token string) string {
+	return HashToken(token)
+}
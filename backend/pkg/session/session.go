@@ -2,7 +2,9 @@ package session
 
 import (
 	"crypto/rand"
+	"crypto/sha256"
 	"encoding/base64"
+	"encoding/hex"
 	"fmt"
 )
 
@@ -14,4 +16,11 @@ func GenerateToken() (string, error) {
 		return "", fmt.Errorf("failed to generate session token: %w", err)
 	}
 	return base64.RawURLEncoding.EncodeToString(b), nil
-}
\ No newline at end of file
+}
+
+// HashToken returns the hash of a random token for storing it. Tokens are
+// random, so a fast hash is enough.
+func HashToken(token string) string {
+	sum := sha256.Sum256([]byte(token))
+	return hex.EncodeToString(sum[:])
+}
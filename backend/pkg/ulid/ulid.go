@@ -24,6 +24,14 @@ const (
 	VaultAuthPrefix Prefix = "cva"
 	SyncJobPrefix Prefix = "sj"
 	SyncConfigPrefix Prefix = "sc"
+	ReplicaPrefix Prefix = "rep"
+	CertificateExpiryPrefix Prefix = "cex"
+	RoleAssignmentPrefix Prefix = "rla"
+	APITokenPrefix Prefix = "tok"
+	MFARecoveryCodePrefix Prefix = "mrc"
+	MFAChallengePrefix Prefix = "mfc"
+	AuditEventPrefix Prefix = "aev"
+	PasswordHistoryPrefix Prefix = "pwh"
 )
 
 func New(prefix Prefix) string {
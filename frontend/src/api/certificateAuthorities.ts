@@ -64,6 +64,44 @@ export interface UpdateCertificateAuthorityRequest {
   is_active?: boolean;
 }
 
+export interface ServerCertificateInfo extends CertificateChainInfo {
+  spki_fingerprint: string;
+  certificate: string; // PEM
+  registered: boolean;
+}
+
+export interface FetchCertificateChainResponse {
+  url: string;
+  certificates: ServerCertificateInfo[]; // leaf first
+  ca_certificate?: string; // PEM of the CA certificates, ready for create
+}
+
+// Result of the background check of a stored CA chain or a PVWA's chain
+export interface CertificateExpiry {
+  id: string;
+  source_type: 'certificate_authority' | 'pvwa';
+  source_id: string; // certificate authority or CyberArk instance
+  source_name: string;
+  fingerprint: string;
+  subject: string;
+  issuer: string;
+  is_ca: boolean;
+  not_after: string;
+  days_remaining: number;
+  status: 'valid' | 'expiring' | 'expired';
+  threshold?: number; // smallest warning threshold reached, 0 once expired
+  notified_threshold?: number;
+  checked_at: string;
+  created_at: string;
+  updated_at: string;
+}
+
+export interface CertificateExpiryResponse {
+  certificates: CertificateExpiry[];
+  count: number;
+  thresholds: number[]; // days, largest first
+}
+
 export const certificateAuthoritiesApi = {
   list: () =>
     apiClient.get<{ certificate_authorities: CertificateAuthorityInfo[] }>('/certificate-authorities'),
@@ -79,4 +117,14 @@ export const certificateAuthoritiesApi = {
 
   delete: (id: string) =>
     apiClient.delete<void>(`/certificate-authorities/${id}`),
-};
\ No newline at end of file
+
+  // Retrieves the chain a server presents without trusting it
+  fetchChain: (url: string) =>
+    apiClient.post<FetchCertificateChainResponse>('/certificate-authorities/fetch-chain', { url }),
+
+  expiry: (params?: { status?: CertificateExpiry['status']; source_type?: CertificateExpiry['source_type'] }) =>
+    apiClient.get<CertificateExpiryResponse>('/certificates/expiry', { params }),
+
+  checkExpiry: () =>
+    apiClient.post<CertificateExpiryResponse>('/certificates/expiry/check'),
+};
@@ -8,6 +8,25 @@ export interface User {
   last_login_at?: string;
   is_active: boolean;
   is_admin: boolean;
+  auth_provider?: 'local' | 'oidc' | 'ldap' | 'service';
+  email?: string;
+}
+
+// An active session; the token itself is never returned
+export interface Session {
+  id: string;
+  created_at: string;
+  expires_at: string;
+  user_agent?: string;
+  ip_address?: string;
+  current: boolean; // the session of this browser
+}
+
+export interface AuthProviders {
+  local: boolean;
+  oidc: boolean;
+  ldap: boolean;
+  oidc_login_url?: string;
 }
 
 export interface LoginRequest {
@@ -15,9 +34,20 @@ export interface LoginRequest {
   password: string;
 }
 
+// Either the signed in user, or a challenge for the second factor
 export interface LoginResponse {
-  user: User;
-  message: string;
+  user?: User;
+  message?: string;
+  mfa_required?: boolean;
+  mfa_token?: string;
+  enrollment_required?: boolean; // the account requires MFA but has not enrolled
+  expires_at?: string;
+  recovery_codes?: string[]; // set once, when the login completed an enrolment
+}
+
+export interface MFAEnrollment {
+  secret: string;
+  otpauth_url: string;
 }
 
 export interface Safe {
@@ -49,15 +79,17 @@ export interface Group {
 export interface CreateUserRequest {
   username: string;
   password: string;
+  email?: string;
   is_admin?: boolean;
   is_active?: boolean;
 }
 
+// Passwords are changed with resetUserPassword
 export interface UpdateUserRequest {
   username?: string;
-  password?: string;
+  email?: string;
   is_admin?: boolean;
-  is_active?: boolean;
+  is_active?: boolean; // disabling ends the user's sessions
 }
 
 class ApiClient {
@@ -94,6 +126,22 @@ class ApiClient {
     });
   }
 
+  // Second step of a login with MFA, with a TOTP or recovery code
+  async loginMFA(mfaToken: string, code: string): Promise<LoginResponse> {
+    return this.request<LoginResponse>('/auth/login/mfa', {
+      method: 'POST',
+      body: JSON.stringify({ mfa_token: mfaToken, code }),
+    });
+  }
+
+  // Enrolment required by a login, confirmed by loginMFA
+  async enrollMFALogin(mfaToken: string): Promise<MFAEnrollment> {
+    return this.request<MFAEnrollment>('/auth/login/mfa/enroll', {
+      method: 'POST',
+      body: JSON.stringify({ mfa_token: mfaToken }),
+    });
+  }
+
   async logout(): Promise<void> {
     await this.request('/auth/logout', {
       method: 'POST',
@@ -104,6 +152,10 @@ class ApiClient {
     return this.request<User>('/auth/me');
   }
 
+  async getAuthProviders(): Promise<AuthProviders> {
+    return this.request<AuthProviders>('/auth/providers');
+  }
+
   // Safe methods
   async getSafes(filters?: any): Promise<{ safes: Safe[] }> {
     return this.get('/safes', { params: filters });
@@ -146,6 +198,32 @@ class ApiClient {
     return this.delete(`/users/${id}`);
   }
 
+  // Ends the user's sessions
+  async resetUserPassword(id: string, password: string): Promise<void> {
+    return this.post(`/users/${id}/password`, { password });
+  }
+
+  async getUserSessions(id: string): Promise<{ sessions: Session[]; count: number }> {
+    return this.get(`/users/${id}/sessions`);
+  }
+
+  async revokeUserSession(id: string, sessionId: string): Promise<void> {
+    return this.delete(`/users/${id}/sessions/${sessionId}`);
+  }
+
+  async revokeUserSessions(id: string): Promise<void> {
+    return this.delete(`/users/${id}/sessions`);
+  }
+
+  // Sessions of the current user
+  async getMySessions(): Promise<{ sessions: Session[]; count: number }> {
+    return this.get('/auth/sessions');
+  }
+
+  async revokeMySession(sessionId: string): Promise<void> {
+    return this.delete(`/auth/sessions/${sessionId}`);
+  }
+
   // Group methods
   async getGroups(filters?: any): Promise<{ groups: Group[] }> {
     return this.get('/groups', { params: filters });
@@ -187,9 +265,10 @@ class ApiClient {
     });
   }
 
-  async delete<T>(endpoint: string): Promise<T> {
+  async delete<T>(endpoint: string, data?: any): Promise<T> {
     return this.request<T>(endpoint, {
       method: 'DELETE',
+      body: data ? JSON.stringify(data) : undefined,
     });
   }
 }
@@ -1,51 +1,121 @@
 import { apiClient } from './client';
 
+export type AuthMethod = 'cyberark' | 'ldap' | 'radius' | 'windows' | 'pki';
+
+export interface ClientCertificateInfo {
+  subject: string;
+  issuer: string;
+  fingerprint: string;
+  not_before: string;
+  not_after: string;
+}
+
+// SHA-256 fingerprint, hex encoded, of the PVWA's certificate (leaf) or of
+// the public key of any certificate in its chain (spki)
+export interface CertificatePin {
+  type: 'leaf' | 'spki';
+  fingerprint: string;
+}
+
+// Privilege Cloud instances use the OAuth client ID and secret of the
+// Identity tenant at identity_url as username and password
+export type InstanceType = 'self_hosted' | 'privilege_cloud';
+
 export interface CyberArkInstance {
   id: string;
   name: string;
+  instance_type: InstanceType;
   base_url: string;
+  identity_url?: string;
   username: string;
+  auth_method: AuthMethod;
   concurrent_sessions: boolean;
   skip_tls_verify: boolean;
   is_active: boolean;
   last_test_at?: string;
   last_test_success?: boolean;
   last_test_error?: string;
+  requests_per_second: number;
+  max_in_flight_requests: number;
+  client_certificate?: ClientCertificateInfo;
+  trusted_ca_ids: string[]; // empty: any active certificate authority
+  pinned_certificates: CertificatePin[];
+  breaker?: CircuitBreakerStatus;
   created_at: string;
   updated_at: string;
   created_by?: string;
   updated_by?: string;
 }
 
+export interface CircuitBreakerStatus {
+  state: 'closed' | 'open' | 'half_open';
+  consecutive_failures: number;
+  opened_at?: string;
+  retry_at?: string;
+  in_flight: number;
+}
+
 export interface CreateCyberArkInstanceRequest {
   name: string;
+  instance_type?: InstanceType;
   base_url: string;
+  identity_url?: string;
   username: string;
-  password: string;
+  password?: string; // not needed for pki
+  auth_method?: AuthMethod;
+  client_certificate?: string; // PEM, for mutual TLS or pki logon
+  client_key?: string;
+  trusted_ca_ids?: string[];
+  pinned_certificates?: CertificatePin[];
   concurrent_sessions?: boolean;
   skip_tls_verify?: boolean;
+  requests_per_second?: number;
+  max_in_flight_requests?: number;
+  challenge_response?: string;
 }
 
 export interface UpdateCyberArkInstanceRequest {
   name?: string;
+  instance_type?: InstanceType;
   base_url?: string;
+  identity_url?: string;
   username?: string;
   password?: string;
+  auth_method?: AuthMethod;
+  client_certificate?: string; // empty string removes the certificate
+  client_key?: string;
+  trusted_ca_ids?: string[]; // replaces the list; empty trusts any active CA
+  pinned_certificates?: CertificatePin[]; // replaces the list
   concurrent_sessions?: boolean;
   skip_tls_verify?: boolean;
   is_active?: boolean;
+  requests_per_second?: number;
+  max_in_flight_requests?: number;
+  challenge_response?: string;
 }
 
 export interface TestConnectionRequest {
+  instance_type?: InstanceType;
   base_url: string;
+  identity_url?: string;
   username: string;
   password: string;
   skip_tls_verify: boolean;
+  auth_method?: AuthMethod;
+  client_certificate?: string;
+  client_key?: string;
+  trusted_ca_ids?: string[];
+  pinned_certificates?: CertificatePin[];
+  concurrent_sessions?: boolean;
+  challenge_response?: string; // answer to a RADIUS challenge from an earlier attempt
 }
 
 export interface TestConnectionResponse {
   success: boolean;
   message: string;
+  error_code?: string; // PVWA error code, e.g. PASWS013E for wrong credentials
+  challenge?: string; // RADIUS challenge to answer with challenge_response
+  client_certificate?: ClientCertificateInfo;
   response_time_ms: number;
   version?: string;
 }
@@ -88,7 +158,8 @@ export const cyberarkApi = {
   },
 
   // Test an existing instance's connection
-  testInstanceConnection: async (id: string): Promise<TestConnectionResponse> => {
-    return await apiClient.post<TestConnectionResponse>(`/cyberark/instances/${id}/test`);
+  testInstanceConnection: async (id: string, challengeResponse?: string): Promise<TestConnectionResponse> => {
+    const data = challengeResponse ? { challenge_response: challengeResponse } : undefined;
+    return await apiClient.post<TestConnectionResponse>(`/cyberark/instances/${id}/test`, data);
   },
 };
\ No newline at end of file
@@ -0,0 +1,32 @@
+import { apiClient, MFAEnrollment } from '@/api/client';
+
+export interface MFAStatus {
+  enabled: boolean;
+  required: boolean; // by a role or for everyone
+  recovery_codes_remaining: number;
+}
+
+export const mfaApi = {
+  status: () =>
+    apiClient.get<MFAStatus>('/auth/mfa'),
+
+  enroll: () =>
+    apiClient.post<MFAEnrollment>('/auth/mfa/enroll'),
+
+  // The recovery codes are only returned here and by regenerateRecoveryCodes
+  confirm: (code: string) =>
+    apiClient.post<{ recovery_codes: string[] }>('/auth/mfa/confirm', { code }),
+
+  regenerateRecoveryCodes: (code: string) =>
+    apiClient.post<{ recovery_codes: string[] }>('/auth/mfa/recovery-codes', { code }),
+
+  disable: (code: string) =>
+    apiClient.delete<{ message: string }>('/auth/mfa', { code }),
+
+  userStatus: (userId: string) =>
+    apiClient.get<MFAStatus>(`/users/${userId}/mfa`),
+
+  // Lets the user enrol again, for a lost device
+  resetUser: (userId: string) =>
+    apiClient.delete<{ message: string }>(`/users/${userId}/mfa`),
+};
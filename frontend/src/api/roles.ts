@@ -0,0 +1,80 @@
+import { apiClient } from '@/api/client';
+
+export interface Role {
+  id: string;
+  name: string;
+  description: string;
+  permissions: string[];
+  is_system: boolean;
+  require_mfa: boolean;
+  created_at: string;
+  updated_at: string;
+}
+
+export interface RoleAssignment {
+  id: string;
+  user_id: string;
+  role_id: string;
+  cyberark_instance_id?: string; // unset for a global assignment
+  created_by?: string;
+  created_at: string;
+  role?: Role;
+}
+
+export interface PermissionSummary {
+  global: string[];
+  instances: Record<string, string[]>;
+  scopes?: string[]; // set when signed in with an API token
+}
+
+export interface CreateRoleRequest {
+  name: string;
+  description?: string;
+  permissions: string[];
+  require_mfa?: boolean;
+}
+
+export interface UpdateRoleRequest {
+  name?: string;
+  description?: string;
+  permissions?: string[];
+  require_mfa?: boolean; // may also be changed on built-in roles
+}
+
+export interface AssignRoleRequest {
+  role_id: string;
+  cyberark_instance_id?: string;
+}
+
+export const rolesApi = {
+  // Permissions of the signed in user
+  myPermissions: () =>
+    apiClient.get<PermissionSummary>('/auth/permissions'),
+
+  permissions: () =>
+    apiClient.get<{ permissions: string[]; global_only: string[] }>('/permissions'),
+
+  list: () =>
+    apiClient.get<{ roles: Role[]; count: number }>('/roles'),
+
+  get: (id: string) =>
+    apiClient.get<Role>(`/roles/${id}`),
+
+  create: (data: CreateRoleRequest) =>
+    apiClient.post<Role>('/roles', data),
+
+  update: (id: string, data: UpdateRoleRequest) =>
+    apiClient.put<Role>(`/roles/${id}`, data),
+
+  delete: (id: string) =>
+    apiClient.delete<void>(`/roles/${id}`),
+
+  userAssignments: (userId: string) =>
+    apiClient.get<{ assignments: RoleAssignment[]; count: number }>(`/users/${userId}/roles`),
+
+  assign: (userId: string, data: AssignRoleRequest) =>
+    apiClient.post<RoleAssignment>(`/users/${userId}/roles`, data),
+
+  unassign: (userId: string, assignmentId: string) =>
+    apiClient.delete<void>(`/users/${userId}/roles/${assignmentId}`),
+};
@@ -0,0 +1,45 @@
+import { apiClient, User } from '@/api/client';
+
+export interface APIToken {
+  id: string;
+  user_id: string;
+  name: string;
+  display: string; // start of the token, to recognise it by
+  scopes: string[];
+  expires_at?: string; // unset for no expiry
+  last_used_at?: string;
+  last_used_ip?: string;
+  revoked_at?: string;
+  revoked_by?: string;
+  created_by?: string;
+  created_at: string;
+}
+
+export interface CreateServiceAccountRequest {
+  username: string;
+  email?: string;
+}
+
+export interface CreateAPITokenRequest {
+  name: string;
+  scopes: string[];
+  expires_in_days?: number; // 0 for no expiry
+}
+
+export const serviceAccountsApi = {
+  list: () =>
+    apiClient.get<{ service_accounts: User[]; count: number }>('/service-accounts'),
+
+  create: (data: CreateServiceAccountRequest) =>
+    apiClient.post<User>('/service-accounts', data),
+
+  tokens: (accountId: string) =>
+    apiClient.get<{ tokens: APIToken[]; count: number }>(`/service-accounts/${accountId}/tokens`),
+
+  // The token is only returned here
+  createToken: (accountId: string, data: CreateAPITokenRequest) =>
+    apiClient.post<{ token: string; api_token: APIToken }>(`/service-accounts/${accountId}/tokens`, data),
+
+  revokeToken: (accountId: string, tokenId: string) =>
+    apiClient.delete<APIToken>(`/service-accounts/${accountId}/tokens/${tokenId}`),
+};
@@ -1,12 +1,12 @@
 import { createContext, useContext, ReactNode } from 'react';
-import { User } from '@/api/client';
+import { LoginResponse, User } from '@/api/client';
 import { useCurrentUser, useLogin as useLoginMutation, useLogout as useLogoutMutation } from '@/hooks/useAuth';
 
 interface AuthContextType {
   user: User | null | undefined;
   isLoading: boolean;
   isAuthenticated: boolean;
-  login: (username: string, password: string) => Promise<void>;
+  login: (username: string, password: string) => Promise<LoginResponse>;
   logout: () => Promise<void>;
   refreshUser: () => Promise<void>;
 }
@@ -19,7 +19,7 @@ export function AuthProvider({ children }: { children: ReactNode }) {
   const logoutMutation = useLogoutMutation();
 
   const login = async (username: string, password: string) => {
-    await loginMutation.mutateAsync({ username, password });
+    return loginMutation.mutateAsync({ username, password });
   };
 
   const logout = async () => {
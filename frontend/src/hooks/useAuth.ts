@@ -25,6 +25,10 @@ export function useLogin() {
   return useMutation({
     mutationFn: (data: LoginRequest) => apiClient.login(data),
     onSuccess: (response) => {
+      // A login waiting for the second factor has no user yet
+      if (!response.user) {
+        return;
+      }
       // Set user data in cache
       queryClient.setQueryData(authKeys.user(), response.user);
       navigate('/');
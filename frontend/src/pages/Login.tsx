@@ -1,6 +1,7 @@
-import { useState, useEffect } from 'react';
+import { useState, useEffect, FormEvent } from 'react';
 import { useNavigate } from 'react-router-dom';
 import { useAuth } from '@/contexts/AuthContext';
+import { apiClient, MFAEnrollment } from '@/api/client';
 import { Button } from '@/components/ui/button';
 import { Input } from '@/components/ui/input';
 import { OrcaIcon } from '@/components/OrcaIcon';
@@ -25,13 +26,22 @@ const loginSchema = z.object({
 
 type LoginFormData = z.infer<typeof loginSchema>;
 
+// A login waiting for the second factor
+interface MFAChallenge {
+  token: string;
+  enrollment?: MFAEnrollment; // set when the account must enrol first
+}
+
 export function Login() {
   const navigate = useNavigate();
-  const { login } = useAuth();
+  const { login, refreshUser } = useAuth();
   const [error, setError] = useState('');
   const [isLoading, setIsLoading] = useState(false);
   const [backgroundImage, setBackgroundImage] = useState('');
   const [imageLoaded, setImageLoaded] = useState(false);
+  const [mfa, setMfa] = useState<MFAChallenge | null>(null);
+  const [code, setCode] = useState('');
+  const [recoveryCodes, setRecoveryCodes] = useState<string[]>([]);
 
   const form = useForm<LoginFormData>({
     resolver: zodResolver(loginSchema),
@@ -59,7 +69,14 @@ export function Login() {
     setIsLoading(true);
 
     try {
-      await login(values.username, values.password);
+      const response = await login(values.username, values.password);
+      if (response.mfa_required && response.mfa_token) {
+        const enrollment = response.enrollment_required
+          ? await apiClient.enrollMFALogin(response.mfa_token)
+          : undefined;
+        setMfa({ token: response.mfa_token, enrollment });
+        return;
+      }
       navigate('/');
     } catch (err) {
       setError(err instanceof Error ? err.message : 'Login failed');
@@ -68,6 +85,39 @@ export function Login() {
     }
   };
 
+  const handleMFASubmit = async (e: FormEvent) => {
+    e.preventDefault();
+    if (!mfa) return;
+    setError('');
+    setIsLoading(true);
+
+    try {
+      const response = await apiClient.loginMFA(mfa.token, code.trim());
+      if (response.recovery_codes?.length) {
+        // Shown once, before leaving the page
+        setRecoveryCodes(response.recovery_codes);
+        return;
+      }
+      await refreshUser();
+      navigate('/');
+    } catch (err) {
+      const message = err instanceof Error ? err.message : 'Verification failed';
+      setError(message);
+      setCode('');
+      // The challenge is gone once it expires or has too many attempts
+      if (message.includes('log in again')) {
+        setMfa(null);
+      }
+    } finally {
+      setIsLoading(false);
+    }
+  };
+
+  const handleContinue = async () => {
+    await refreshUser();
+    navigate('/');
+  };
+
   return (
     <div className="relative min-h-screen overflow-hidden">
       {/* Fallback gradient while image loads */}
@@ -116,6 +166,83 @@ export function Login() {
                 <LogoWithStroke className="h-16 w-auto text-gray-700" />
               </div>
               
+              {recoveryCodes.length > 0 ? (
+              <div className="space-y-4">
+                <p className="text-sm text-gray-700">
+                  Two-factor authentication is enabled. Store these recovery codes somewhere safe;
+                  each can be used once in place of an authentication code.
+                </p>
+                <div className="grid grid-cols-2 gap-2 rounded bg-gray-50 border border-gray-200 p-4 font-mono text-sm text-gray-900">
+                  {recoveryCodes.map((recoveryCode) => (
+                    <span key={recoveryCode}>{recoveryCode}</span>
+                  ))}
+                </div>
+                <Button
+                  type="button"
+                  onClick={handleContinue}
+                  className="w-full h-12 bg-gray-700 hover:bg-gray-800 text-white font-medium rounded"
+                >
+                  Continue
+                </Button>
+              </div>
+              ) : mfa ? (
+              <form onSubmit={handleMFASubmit} className="space-y-4">
+                {error && (
+                  <Alert variant="destructive" className="bg-red-50 border-red-200">
+                    <AlertCircle className="h-4 w-4" />
+                    <AlertDescription>{error}</AlertDescription>
+                  </Alert>
+                )}
+
+                {mfa.enrollment ? (
+                  <div className="space-y-2 text-sm text-gray-700">
+                    <p>
+                      Your account requires two-factor authentication. Add this key to your
+                      authenticator app, then enter the code it shows.
+                    </p>
+                    <p className="rounded bg-gray-50 border border-gray-200 p-3 font-mono text-gray-900 break-all">
+                      {mfa.enrollment.secret}
+                    </p>
+                    <a href={mfa.enrollment.otpauth_url} className="text-gray-500 underline break-all">
+                      Open in authenticator app
+                    </a>
+                  </div>
+                ) : (
+                  <p className="text-sm text-gray-700">
+                    Enter the code from your authenticator app, or a recovery code.
+                  </p>
+                )}
+
+                <Input
+                  placeholder="Authentication code"
+                  autoComplete="one-time-code"
+                  inputMode="numeric"
+                  autoFocus
+                  className="h-12 bg-gray-50 border-gray-200 text-gray-900 placeholder:text-gray-400 focus:bg-white focus:border-gray-400 rounded"
+                  disabled={isLoading}
+                  value={code}
+                  onChange={(e) => setCode(e.target.value)}
+                />
+
+                <Button
+                  type="submit"
+                  className="w-full h-12 bg-gray-700 hover:bg-gray-800 text-white font-medium rounded"
+                  disabled={isLoading || !code.trim()}
+                >
+                  {isLoading ? 'Verifying...' : 'Verify'}
+                </Button>
+
+                <Button
+                  type="button"
+                  variant="ghost"
+                  className="w-full text-gray-500"
+                  onClick={() => { setMfa(null); setCode(''); setError(''); }}
+                  disabled={isLoading}
+                >
+                  Back
+                </Button>
+              </form>
+              ) : (
               <div className="space-y-6">
                 <Form {...form}>
                   <form onSubmit={form.handleSubmit(handleSubmit)} className="space-y-4">
@@ -193,6 +320,7 @@ export function Login() {
                   Log in with Entra ID
                 </Button>
               </div>
+              )}
           </div>
 
           {/* Footer info */}